@@ -161,6 +161,12 @@ type MetricSpec struct {
 	// You can only specify either ScaleDownFactor or ScaleDownAdjustment.
 	// +optional
 	ScaleDownAdjustment int `json:"scaleDownAdjustment,omitempty"`
+
+	// PollingInterval is how often the metric is recomputed by polling GitHub API, like "1m".
+	// Only applicable to TotalNumberOfQueuedAndInProgressWorkflowRuns.
+	// Defaults to recomputing on each sync period, reusing the result for the cache duration.
+	// +optional
+	PollingInterval *metav1.Duration `json:"pollingInterval,omitempty"`
 }
 
 // ScheduledOverride can be used to override a few fields of HorizontalRunnerAutoscalerSpec on schedule.
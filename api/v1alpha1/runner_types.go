@@ -47,12 +47,26 @@ type RunnerConfig struct {
 	// +optional
 	Labels []string `json:"labels,omitempty"`
 
+	// LabelTemplates are Go templates rendered into additional runner labels once the runner pod is scheduled onto a node.
+	// Each template can refer to the metadata of the runner pod and the node, like
+	// `zone-{{ index .Node.Labels "topology.kubernetes.io/zone" }}`.
+	// A template rendered into an empty string is omitted.
+	// +optional
+	LabelTemplates []string `json:"labelTemplates,omitempty"`
+
 	// +optional
 	Group string `json:"group,omitempty"`
 
 	// +optional
 	Ephemeral *bool `json:"ephemeral,omitempty"`
 
+	// JIT tells that the runner is registered with a just-in-time runner configuration,
+	// which deregisters the runner from GitHub by itself once it stops.
+	// ARC then considers the runner already unregistered once it is missing on GitHub or the runner has stopped, without calling RemoveRunner.
+	// This is honored only for ephemeral runners.
+	// +optional
+	JIT *bool `json:"jit,omitempty"`
+
 	// +optional
 	Image string `json:"image"`
 
@@ -71,6 +85,85 @@ type RunnerConfig struct {
 	VolumeSizeLimit *resource.Quantity `json:"volumeSizeLimit,omitempty"`
 	// +optional
 	VolumeStorageMedium *string `json:"volumeStorageMedium,omitempty"`
+
+	// GitHubAPICredentialsFrom references the credentials used to register and unregister the runner,
+	// instead of the controller-wide credentials.
+	// This is currently honored only by Runner, RunnerReplicaSet, and RunnerDeployment.
+	// +optional
+	GitHubAPICredentialsFrom *GitHubAPICredentialsFrom `json:"githubAPICredentialsFrom,omitempty"`
+
+	// SucceededPodPolicy determines what to do when the runner pod of a non-ephemeral runner has stopped successfully.
+	// Restart, the default, unregisters the runner and recreates the runner pod for the same runner.
+	// Delete deletes the runner so that it is replaced with a new runner, as is always done for an ephemeral runner.
+	// This is currently honored only by Runner, RunnerReplicaSet, and RunnerDeployment.
+	// +optional
+	// +kubebuilder:validation:Enum=Restart;Delete
+	SucceededPodPolicy SucceededPodPolicy `json:"succeededPodPolicy,omitempty"`
+
+	// OwnerDeletionPolicy determines what to do with the runner being deleted along with its RunnerDeployment or RunnerReplicaSet.
+	// Complete, the default, completes the graceful stop, waiting for the runner to finish its job and be unregistered.
+	// Abort deletes the runner pod without waiting for the graceful stop, even if it has already started.
+	// A runner aborted that way may stay registered on GitHub until GitHub removes it as offline.
+	// Runners replaced on a RunnerDeployment update are always stopped gracefully.
+	// +optional
+	// +kubebuilder:validation:Enum=Complete;Abort
+	OwnerDeletionPolicy OwnerDeletionPolicy `json:"ownerDeletionPolicy,omitempty"`
+
+	// PreUnregistrationExec is the command ARC runs in the runner container via the pod exec API
+	// before removing the runner from GitHub on a graceful stop, e.g. to flush caches.
+	// +optional
+	PreUnregistrationExec *PreUnregistrationExec `json:"preUnregistrationExec,omitempty"`
+}
+
+type SucceededPodPolicy string
+
+const (
+	SucceededPodPolicyRestart SucceededPodPolicy = "Restart"
+	SucceededPodPolicyDelete  SucceededPodPolicy = "Delete"
+)
+
+type OwnerDeletionPolicy string
+
+const (
+	OwnerDeletionPolicyComplete OwnerDeletionPolicy = "Complete"
+	OwnerDeletionPolicyAbort    OwnerDeletionPolicy = "Abort"
+)
+
+type PreUnregistrationExec struct {
+	// Command is the command to run in the runner container. It's not run in a shell.
+	// +kubebuilder:validation:MinItems=1
+	Command []string `json:"command"`
+
+	// TimeoutSeconds is the duration to wait for the command to exit. Defaults to 60, and can be up to 300.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=300
+	TimeoutSeconds *int64 `json:"timeoutSeconds,omitempty"`
+
+	// FailurePolicy determines what to do when the command failed or timed out.
+	// Ignore, the default, removes the runner from GitHub anyway.
+	// Fail retries the command until it succeeds, without removing the runner from GitHub,
+	// until the unregistration timeout passes.
+	// +optional
+	// +kubebuilder:validation:Enum=Ignore;Fail
+	FailurePolicy PreUnregistrationExecFailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+type PreUnregistrationExecFailurePolicy string
+
+const (
+	PreUnregistrationExecFailurePolicyIgnore PreUnregistrationExecFailurePolicy = "Ignore"
+	PreUnregistrationExecFailurePolicyFail   PreUnregistrationExecFailurePolicy = "Fail"
+)
+
+type GitHubAPICredentialsFrom struct {
+	// SecretRef is the reference to a secret in the same namespace as the runner.
+	// The secret must contain either github_token, or all of github_app_id, github_app_installation_id, and github_app_private_key.
+	SecretRef SecretReference `json:"secretRef,omitempty"`
+}
+
+type SecretReference struct {
+	Name string `json:"name"`
 }
 
 // RunnerPodSpec defines the desired pod spec fields of the runner pod
@@ -192,6 +285,46 @@ type RunnerStatus struct {
 	// +optional
 	// +nullable
 	LastRegistrationCheckTime *metav1.Time `json:"lastRegistrationCheckTime,omitempty"`
+	// UnregistrationAttempts is the number of attempts to unregister the runner that haven't completed the unregistration yet,
+	// including ones postponed due to rate limits, network errors, and the runner being busy.
+	// It's reset to zero once the unregistration completes.
+	// +optional
+	UnregistrationAttempts int `json:"unregistrationAttempts,omitempty"`
+	// LastUnregistrationError is the error of the last failed attempt to unregister the runner.
+	// It's cleared once the unregistration completes.
+	// +optional
+	// +nullable
+	LastUnregistrationError *RunnerUnregistrationError `json:"lastUnregistrationError,omitempty"`
+	// OS is the operating system the runner reported to GitHub, e.g. `Linux`, as of the latest registration check.
+	// +optional
+	OS string `json:"os,omitempty"`
+	// Architecture is the architecture of the runner, e.g. `X64` and `ARM64`, as of the latest registration check.
+	// It's taken from the default label GitHub adds to the runner for its architecture.
+	// +optional
+	Architecture string `json:"architecture,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// RunnerConditionGitHubAPICredentialsValid tells if the credentials referenced via spec.githubAPICredentialsFrom
+	// can be used to register and unregister the runner.
+	RunnerConditionGitHubAPICredentialsValid = "GitHubAPICredentialsValid"
+
+	// RunnerConditionUnregistrationFailed tells that ARC gave up unregistering the runner after exhausting the retry budget.
+	RunnerConditionUnregistrationFailed = "UnregistrationFailed"
+
+	// RunnerConditionRegistered tells if the runner was listed on GitHub as of the latest registration check.
+	RunnerConditionRegistered = "Registered"
+)
+
+// RunnerUnregistrationError is an error of unregistering the runner from GitHub
+type RunnerUnregistrationError struct {
+	Message string `json:"message"`
+	// Time is when the error was first observed. It isn't updated while the same error repeats.
+	Time metav1.Time `json:"time"`
 }
 
 // RunnerStatusRegistration contains runner registration status
@@ -211,6 +344,8 @@ type RunnerStatusRegistration struct {
 // +kubebuilder:printcolumn:JSONPath=".spec.repository",name=Repository,type=string
 // +kubebuilder:printcolumn:JSONPath=".spec.labels",name=Labels,type=string
 // +kubebuilder:printcolumn:JSONPath=".status.phase",name=Status,type=string
+// +kubebuilder:printcolumn:JSONPath=".status.os",name=OS,type=string
+// +kubebuilder:printcolumn:JSONPath=".status.architecture",name=Arch,type=string
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // Runner is the Schema for the runners API
@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const (
@@ -39,12 +40,79 @@ type RunnerDeploymentSpec struct {
 	// +nullable
 	EffectiveTime *metav1.Time `json:"effectiveTime"`
 
+	// Paused stops ARC from scaling the deployment and recreating its runners, usually for a maintenance window.
+	// Runners that are already being stopped are still unregistered and removed gracefully.
+	//
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// MinReadyRunners is the minimum number of ready runners to keep while replacing runners on a template update.
+	// When set, ARC scales down the old runner replica sets gradually, gracefully stopping their runners only as long as
+	// the ready runners across the old and the new runner replica sets don't drop below this,
+	// instead of waiting for all the new runners to become ready and then removing all the old runners at once.
+	// It's capped at the desired number of replicas.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MinReadyRunners *int `json:"minReadyRunners,omitempty"`
+
+	// RollingUpdate makes ARC replace runners on a template update gradually, like a rolling update of a Deployment.
+	// The new runner replica set is scaled up and the old ones are scaled down within the limits of maxSurge and maxUnavailable.
+	// Old runners are stopped gracefully, waiting for busy runners to finish their jobs, before new runners are created in their place.
+	// When unset, all the new runners are created at once, and the old runners are removed once all the new runners are ready.
+	//
+	// +optional
+	RollingUpdate *RunnerDeploymentRollingUpdate `json:"rollingUpdate,omitempty"`
+
+	// DrainOnSecretRotation makes ARC replace all the runners when the data of the secret referenced by
+	// template.spec.githubAPICredentialsFrom.secretRef changes, so that the runners are re-registered with the new credentials.
+	// The old runners are stopped gracefully the same way as on a template update, honoring rollingUpdate and minReadyRunners.
+	// Enabling this on an existing runnerdeployment replaces its runners once.
+	//
+	// +optional
+	DrainOnSecretRotation bool `json:"drainOnSecretRotation,omitempty"`
+
+	// MaxRunnerAge is the maximum age of a runner pod, like "24h".
+	// ARC gracefully stops runners whose pods are older than this, waiting for busy runners to finish their jobs,
+	// and recreates their pods, regardless of autoscaling.
+	// At most as many runners are recycled at once as the ready runners stay at or above minReadyRunners,
+	// or one at a time when minReadyRunners is unset.
+	//
+	// +optional
+	MaxRunnerAge *metav1.Duration `json:"maxRunnerAge,omitempty"`
+
+	// MaxDrainDuration is the maximum duration of replacing the runners on a template update, like "1h",
+	// measured from status.drainStartTime.
+	// Once exceeded, ARC stops waiting for the remaining old runners to finish their jobs and unregister,
+	// and deletes them along with the old runner replica sets after trying to remove each runner from GitHub once.
+	// When unset, the old runners are stopped gracefully however long it takes.
+	//
+	// +optional
+	MaxDrainDuration *metav1.Duration `json:"maxDrainDuration,omitempty"`
+
 	// +optional
 	// +nullable
 	Selector *metav1.LabelSelector `json:"selector"`
 	Template RunnerTemplate        `json:"template"`
 }
 
+// RunnerDeploymentRollingUpdate configures the rolling replacement of runners on a template update.
+type RunnerDeploymentRollingUpdate struct {
+	// MaxSurge is the maximum number of runners that can be created over the desired replicas during the update.
+	// It can be an absolute number (e.g. 5) or a percentage of the desired replicas (e.g. 10%), rounded up.
+	// Defaults to 25%.
+	//
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+
+	// MaxUnavailable is the maximum number of runners below the desired replicas that can be unavailable during the update.
+	// It can be an absolute number (e.g. 5) or a percentage of the desired replicas (e.g. 10%), rounded down.
+	// Defaults to 0. When both maxSurge and maxUnavailable are 0, maxSurge is treated as 1.
+	//
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
 type RunnerDeploymentStatus struct {
 	// See K8s deployment controller code for reference
 	// https://github.com/kubernetes/kubernetes/blob/ea0764452222146c47ec826977f49d7001b0ea8c/pkg/controller/deployment/sync.go#L487-L505
@@ -72,8 +140,29 @@ type RunnerDeploymentStatus struct {
 	// Replicas is the total number of replicas
 	// +optional
 	Replicas *int `json:"replicas"`
+
+	// ObservedSecretVersion is the version of the data of the secret referenced by template.spec.githubAPICredentialsFrom.secretRef
+	// that the newest runners are created with, when drainOnSecretRotation is enabled.
+	// +optional
+	ObservedSecretVersion string `json:"observedSecretVersion,omitempty"`
+
+	// DrainStartTime is when ARC started replacing the runners of the old runner replica sets, which spec.maxDrainDuration is measured from.
+	// It's unset when there are no old runner replica sets.
+	// +optional
+	DrainStartTime *metav1.Time `json:"drainStartTime,omitempty"`
+
+	// Conditions is the latest available observations of the runner deployment's state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+const (
+	// RunnerDeploymentConditionPaused tells if the runner deployment is paused via spec.paused.
+	RunnerDeploymentConditionPaused = "Paused"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:shortName=rdeploy
 // +kubebuilder:subresource:status
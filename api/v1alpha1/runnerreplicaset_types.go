@@ -35,6 +35,12 @@ type RunnerReplicaSetSpec struct {
 	// +nullable
 	EffectiveTime *metav1.Time `json:"effectiveTime"`
 
+	// Paused is inherited from the RunnerDeployment's spec.paused.
+	// When true, the runnerreplicaset controller neither creates nor deletes runners to match Replicas.
+	//
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
 	// +optional
 	// +nullable
 	Selector *metav1.LabelSelector `json:"selector"`
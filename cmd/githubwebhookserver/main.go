@@ -73,6 +73,11 @@ func main() {
 		syncPeriod           time.Duration
 		logLevel             string
 
+		deliveryCacheSize int
+		deliveryCacheTTL  time.Duration
+
+		stopRunnersOfCancelledJobs bool
+
 		ghClient *github.Client
 	)
 
@@ -92,6 +97,9 @@ func main() {
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.DurationVar(&syncPeriod, "sync-period", 10*time.Minute, "Determines the minimum frequency at which K8s resources managed by this controller are reconciled. When you use autoscaling, set to a lower value like 10 minute, because this corresponds to the minimum time to react on demand change")
 	flag.StringVar(&logLevel, "log-level", logging.LogLevelDebug, `The verbosity of the logging. Valid values are "debug", "info", "warn", "error". Defaults to "debug".`)
+	flag.IntVar(&deliveryCacheSize, "webhook-delivery-cache-size", controllers.DefaultWebhookDeliveryCacheSize, "The maximum number of webhook delivery IDs remembered to ignore redeliveries of already processed webhook events.")
+	flag.DurationVar(&deliveryCacheTTL, "webhook-delivery-cache-ttl", controllers.DefaultWebhookDeliveryCacheTTL, "How long a webhook delivery ID is remembered to ignore redeliveries of already processed webhook events.")
+	flag.BoolVar(&stopRunnersOfCancelledJobs, "stop-runners-of-cancelled-jobs", false, "Gracefully stop and recreate the runner a workflow job was assigned to once the job is cancelled and the runner is no longer busy, instead of waiting for GitHub to reclaim the runner. Requires the webhook to send workflow_job events.")
 	flag.StringVar(&webhookSecretToken, "github-webhook-secret-token", "", "The personal access token of GitHub.")
 	flag.StringVar(&c.Token, "github-token", c.Token, "The personal access token of GitHub.")
 	flag.Int64Var(&c.AppID, "github-app-id", c.AppID, "The application ID of GitHub App.")
@@ -164,6 +172,11 @@ func main() {
 		SecretKeyBytes: []byte(webhookSecretToken),
 		Namespace:      watchNamespace,
 		GitHubClient:   ghClient,
+
+		DeliveryCacheSize: deliveryCacheSize,
+		DeliveryCacheTTL:  deliveryCacheTTL,
+
+		StopRunnersOfCancelledJobs: stopRunnersOfCancelledJobs,
 	}
 
 	if err = hraGitHubWebhook.SetupWithManager(mgr); err != nil {
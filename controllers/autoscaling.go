@@ -160,18 +160,24 @@ func (r *HorizontalRunnerAutoscalerReconciler) suggestReplicasByQueuedAndInProgr
 
 	var total, inProgress, queued, completed, unknown int
 	type callback func()
-	listWorkflowJobs := func(user string, repoName string, runID int64, fallback_cb callback) {
+	listWorkflowJobs := func(user string, repoName string, runID int64, fallback_cb callback) error {
 		if runID == 0 {
 			fallback_cb()
-			return
+			return nil
 		}
 		opt := github.ListWorkflowJobsOptions{ListOptions: github.ListOptions{PerPage: 50}}
 		var allJobs []*github.WorkflowJob
 		for {
 			jobs, resp, err := r.GitHubClient.Actions.ListWorkflowJobs(context.TODO(), user, repoName, runID, &opt)
 			if err != nil {
+				// Continuing to list jobs of other workflow runs after hitting the rate limit only results in more errors
+				// and leaves us the number of replicas computed from the partial result, hence we give up computing it.
+				if _, limited := rateLimitRetryDelay(err); limited {
+					return err
+				}
+
 				r.Log.Error(err, "Error listing workflow jobs")
-				return //err
+				return nil
 			}
 			allJobs = append(allJobs, jobs.Jobs...)
 			if resp.NextPage == 0 {
@@ -200,6 +206,8 @@ func (r *HorizontalRunnerAutoscalerReconciler) suggestReplicasByQueuedAndInProgr
 				}
 			}
 		}
+
+		return nil
 	}
 
 	for _, repo := range repos {
@@ -220,9 +228,13 @@ func (r *HorizontalRunnerAutoscalerReconciler) suggestReplicasByQueuedAndInProgr
 			case "completed":
 				completed++
 			case "in_progress":
-				listWorkflowJobs(user, repoName, run.GetID(), func() { inProgress++ })
+				if err := listWorkflowJobs(user, repoName, run.GetID(), func() { inProgress++ }); err != nil {
+					return nil, err
+				}
 			case "queued":
-				listWorkflowJobs(user, repoName, run.GetID(), func() { queued++ })
+				if err := listWorkflowJobs(user, repoName, run.GetID(), func() { queued++ }); err != nil {
+					return nil, err
+				}
 			default:
 				unknown++
 			}
@@ -246,6 +258,18 @@ func (r *HorizontalRunnerAutoscalerReconciler) suggestReplicasByQueuedAndInProgr
 	return &necessaryReplicas, nil
 }
 
+// workflowRunsPollingInterval returns the polling interval of the TotalNumberOfQueuedAndInProgressWorkflowRuns metric,
+// or zero if it isn't configured.
+func workflowRunsPollingInterval(hra v1alpha1.HorizontalRunnerAutoscaler) time.Duration {
+	for _, m := range hra.Spec.Metrics {
+		if m.Type == v1alpha1.AutoscalingMetricTypeTotalNumberOfQueuedAndInProgressWorkflowRuns && m.PollingInterval != nil {
+			return m.PollingInterval.Duration
+		}
+	}
+
+	return 0
+}
+
 func (r *HorizontalRunnerAutoscalerReconciler) suggestReplicasByPercentageRunnersBusy(st scaleTarget, hra v1alpha1.HorizontalRunnerAutoscaler, metrics v1alpha1.MetricSpec) (*int, error) {
 	ctx := context.Background()
 	scaleUpThreshold := defaultScaleUpThreshold
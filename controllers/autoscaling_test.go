@@ -3,16 +3,23 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
 	"github.com/actions-runner-controller/actions-runner-controller/github"
 	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
@@ -34,6 +41,14 @@ func newGithubClient(server *httptest.Server) *github.Client {
 	return client
 }
 
+// newGithubConfig returns the controller-wide config that points the clients MultiGitHubClient creates from secrets to the server,
+// like newGithubClient does for the default client.
+func newGithubConfig(server *httptest.Server) github.Config {
+	return github.Config{
+		URL: server.URL + "/",
+	}
+}
+
 func TestDetermineDesiredReplicas_RepositoryRunner(t *testing.T) {
 	intPtr := func(v int) *int {
 		return &v
@@ -518,3 +533,143 @@ func TestDetermineDesiredReplicas_OrganizationalRunner(t *testing.T) {
 		})
 	}
 }
+
+func TestHorizontalRunnerAutoscalerReconciler_WorkflowRunsPolling(t *testing.T) {
+	intPtr := func(v int) *int {
+		return &v
+	}
+
+	workflowRuns := `{"total_count": 2, "workflow_runs":[{"id": 1, "status":"queued"}, {"id": 2, "status":"in_progress"}]}"`
+	workflowRunsQueued := `{"total_count": 1, "workflow_runs":[{"id": 1, "status":"queued"}]}"`
+	workflowRunsInProgress := `{"total_count": 1, "workflow_runs":[{"id": 2, "status":"in_progress"}]}"`
+
+	tests := []struct {
+		name         string
+		workflowJobs fake.Response
+		interval     time.Duration
+		wantRequeue  time.Duration
+		wantReplicas *int
+	}{
+		{
+			name:         "requeue after the polling interval",
+			workflowJobs: fake.Response{Status: http.StatusOK, Body: `{"jobs": [{"status": "queued"}, {"status": "queued"}]}`},
+			interval:     time.Minute,
+			wantRequeue:  time.Minute,
+			wantReplicas: intPtr(4),
+		},
+		{
+			name:         "no requeue by default",
+			workflowJobs: fake.Response{Status: http.StatusOK, Body: `{"jobs": [{"status": "queued"}, {"status": "queued"}]}`},
+			wantReplicas: intPtr(4),
+		},
+		{
+			name:         "requeue after the rate limit delay",
+			workflowJobs: fake.RateLimitExceededResponse(),
+			interval:     time.Minute,
+			wantRequeue:  retryDelayOnGitHubAPIRateLimitError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRepositoryWorkflowRunsResponse(200, workflowRuns, workflowRunsQueued, workflowRunsInProgress),
+				fake.WithListWorkflowJobsHandler(fake.NewScriptedHandler(tt.workflowJobs)),
+				fake.WithListRunnersResponse(200, fake.RunnersListBody),
+			)
+			defer server.Close()
+
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+			_ = v1alpha1.AddToScheme(scheme)
+
+			metric := v1alpha1.MetricSpec{
+				Type: v1alpha1.AutoscalingMetricTypeTotalNumberOfQueuedAndInProgressWorkflowRuns,
+			}
+			if tt.interval > 0 {
+				metric.PollingInterval = &metav1.Duration{Duration: tt.interval}
+			}
+
+			hra := &v1alpha1.HorizontalRunnerAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "testhra",
+				},
+				Spec: v1alpha1.HorizontalRunnerAutoscalerSpec{
+					MinReplicas: intPtr(1),
+					MaxReplicas: intPtr(10),
+					Metrics:     []v1alpha1.MetricSpec{metric},
+				},
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(hra).Build()
+
+			h := &HorizontalRunnerAutoscalerReconciler{
+				Client:       c,
+				Log:          logr.Discard(),
+				Recorder:     record.NewFakeRecorder(10),
+				GitHubClient: newGithubClient(server),
+				Scheme:       scheme,
+			}
+
+			rd := v1alpha1.RunnerDeployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "testrd",
+				},
+				Spec: v1alpha1.RunnerDeploymentSpec{
+					Template: v1alpha1.RunnerTemplate{
+						Spec: v1alpha1.RunnerSpec{
+							RunnerConfig: v1alpha1.RunnerConfig{
+								Repository: "test/valid",
+							},
+						},
+					},
+				},
+			}
+
+			var gotReplicas *int
+
+			ctx := context.Background()
+			st := h.scaleTargetFromRD(ctx, rd)
+
+			res, err := h.reconcile(ctx, ctrl.Request{}, logr.Discard(), *hra, st, func(replicas int) error {
+				gotReplicas = &replicas
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("reconcile() error = %v", err)
+			}
+
+			if res.RequeueAfter != tt.wantRequeue {
+				t.Errorf("unexpected requeue: got %s, want %s", res.RequeueAfter, tt.wantRequeue)
+			}
+
+			if tt.wantReplicas == nil {
+				if gotReplicas != nil {
+					t.Errorf("unexpected desired replicas: got %d, want none", *gotReplicas)
+				}
+				return
+			}
+
+			if gotReplicas == nil || *gotReplicas != *tt.wantReplicas {
+				t.Fatalf("unexpected desired replicas: got %v, want %d", gotReplicas, *tt.wantReplicas)
+			}
+
+			var updated v1alpha1.HorizontalRunnerAutoscaler
+			if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "testhra"}, &updated); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(updated.Status.CacheEntries) != 1 {
+				t.Fatalf("unexpected cache entries: %+v", updated.Status.CacheEntries)
+			}
+
+			if tt.interval > 0 {
+				if exp := updated.Status.CacheEntries[0].ExpirationTime.Time; exp.After(time.Now().Add(tt.interval)) {
+					t.Errorf("cache entry expires at %s, which is later than the next polling", exp)
+				}
+			}
+		})
+	}
+}
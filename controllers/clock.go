@@ -0,0 +1,16 @@
+package controllers
+
+import "time"
+
+// Clock tells the current time to the graceful stop of runners,
+// so that tests can control the time to see how the timeouts and delays expire.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the Clock used in production.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+)
+
+// DefaultPreflightRecheckInterval is how often GitHubPermissionsPreflight rechecks the permissions on readiness probes
+// after a failed check, so that the controller becomes ready once the permissions are fixed, without a restart.
+const DefaultPreflightRecheckInterval = time.Minute
+
+// PreflightScope is the enterprise, organization, or repository whose runners the controller manages.
+type PreflightScope struct {
+	Enterprise   string
+	Organization string
+	Repository   string
+}
+
+func (s PreflightScope) String() string {
+	if s.Repository != "" {
+		return s.Repository
+	}
+	if s.Organization != "" {
+		return s.Organization
+	}
+	return "enterprises/" + s.Enterprise
+}
+
+// ParsePreflightScope parses the scope in the form of OWNER/REPO for a repository, ORG for an organization,
+// or enterprises/ENTERPRISE for an enterprise, the same as the paths of the scopes on GitHub.
+func ParsePreflightScope(s string) (PreflightScope, error) {
+	parts := strings.Split(s, "/")
+
+	for _, p := range parts {
+		if p == "" {
+			return PreflightScope{}, fmt.Errorf("invalid scope %q: must be one of OWNER/REPO, ORG, and enterprises/ENTERPRISE", s)
+		}
+	}
+
+	switch {
+	case len(parts) == 1:
+		return PreflightScope{Organization: s}, nil
+	case len(parts) == 2 && parts[0] == "enterprises":
+		return PreflightScope{Enterprise: parts[1]}, nil
+	case len(parts) == 2:
+		return PreflightScope{Repository: s}, nil
+	}
+
+	return PreflightScope{}, fmt.Errorf("invalid scope %q: must be one of OWNER/REPO, ORG, and enterprises/ENTERPRISE", s)
+}
+
+// GitHubPermissionsPreflight verifies that the controller-wide GitHub API credentials can list and remove runners
+// in the scopes the controller manages, so that missing permissions are reported on startup,
+// rather than as unregistration failures long after.
+//
+// Its ReadyzCheck reports missing permissions via the readiness probe.
+type GitHubPermissionsPreflight struct {
+	GitHubClient *github.Client
+	Scopes       []PreflightScope
+	Log          logr.Logger
+
+	// RecheckInterval defaults to DefaultPreflightRecheckInterval.
+	RecheckInterval time.Duration
+
+	mu        sync.Mutex
+	err       error
+	checkedAt time.Time
+}
+
+// Run checks the permissions for all the scopes and returns the first failure.
+func (p *GitHubPermissionsPreflight) Run(ctx context.Context) error {
+	var firstErr error
+
+	for _, scope := range p.Scopes {
+		err := p.GitHubClient.CheckRunnerPermissions(ctx, scope.Enterprise, scope.Organization, scope.Repository)
+		if err == nil {
+			p.Log.Info("Verified GitHub API permissions to list and remove runners", "scope", scope.String())
+			continue
+		}
+
+		err = fmt.Errorf("checking GitHub API permissions for %s: %w", scope, err)
+
+		if IsPreflightPermissionError(err) {
+			p.Log.Error(err, "GitHub API credentials lack the permissions to manage runners. Runners will fail to unregister until the permissions are fixed", "scope", scope.String())
+		} else {
+			p.Log.Info("WARNING: Failed to check GitHub API permissions. Rechecking on readiness probes", "scope", scope.String(), "error", err.Error())
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	p.mu.Lock()
+	p.err = firstErr
+	p.checkedAt = time.Now()
+	p.mu.Unlock()
+
+	return firstErr
+}
+
+// ReadyzCheck is the healthz.Checker that fails while the last check found the credentials lack the permissions.
+// Check failures for other reasons, like network errors, don't make the controller unready.
+// A failed check is retried at most once per RecheckInterval.
+func (p *GitHubPermissionsPreflight) ReadyzCheck(req *http.Request) error {
+	p.mu.Lock()
+	err, checkedAt := p.err, p.checkedAt
+	p.mu.Unlock()
+
+	interval := p.RecheckInterval
+	if interval <= 0 {
+		interval = DefaultPreflightRecheckInterval
+	}
+
+	if err != nil && time.Since(checkedAt) >= interval {
+		err = p.Run(req.Context())
+	}
+
+	if !IsPreflightPermissionError(err) {
+		return nil
+	}
+
+	return err
+}
+
+// IsPreflightPermissionError returns true when the error tells that the credentials lack the permissions,
+// rather than that the check failed for other reasons like network errors.
+func IsPreflightPermissionError(err error) bool {
+	var (
+		denied       *github.PermissionDenied
+		insufficient *github.InsufficientTokenScopes
+	)
+
+	return errors.As(err, &denied) || errors.As(err, &insufficient)
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+)
+
+func TestParsePreflightScope(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    PreflightScope
+		wantErr bool
+	}{
+		{in: "myorg/myrepo", want: PreflightScope{Repository: "myorg/myrepo"}},
+		{in: "myorg", want: PreflightScope{Organization: "myorg"}},
+		{in: "enterprises/myent", want: PreflightScope{Enterprise: "myent"}},
+		{in: "", wantErr: true},
+		{in: "myorg/", wantErr: true},
+		{in: "a/b/c", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePreflightScope(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePreflightScope(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("ParsePreflightScope(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+
+		if !tt.wantErr && got.String() != tt.in {
+			t.Errorf("unexpected String() of %q: %s", tt.in, got.String())
+		}
+	}
+}
+
+func TestGitHubPermissionsPreflight_InsufficientPermissions(t *testing.T) {
+	var denied int32 = 1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rate_limit":
+			fmt.Fprint(w, `{"resources": {}}`)
+		case "/repos/test/valid/actions/runners":
+			fmt.Fprint(w, fake.RunnersListBody)
+		case "/repos/test/valid/actions/runners/remove-token":
+			if atomic.LoadInt32(&denied) == 1 {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"token": "fake-remove-token"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p := &GitHubPermissionsPreflight{
+		GitHubClient:    newGithubClient(server),
+		Scopes:          []PreflightScope{{Repository: "test/valid"}},
+		Log:             logr.Discard(),
+		RecheckInterval: time.Nanosecond,
+	}
+
+	err := p.Run(context.Background())
+	if !IsPreflightPermissionError(err) {
+		t.Fatalf("expected a permission error, got %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+
+	if err := p.ReadyzCheck(req); !IsPreflightPermissionError(err) {
+		t.Errorf("expected the readiness check to fail with the permission error, got %v", err)
+	}
+
+	// The controller becomes ready once the permissions are fixed.
+	atomic.StoreInt32(&denied, 0)
+
+	if err := p.ReadyzCheck(req); err != nil {
+		t.Errorf("expected the readiness check to pass after the permissions are fixed, got %v", err)
+	}
+}
+
+func TestGitHubPermissionsPreflight_ReadyOnCheckFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rate_limit":
+			fmt.Fprint(w, `{"resources": {}}`)
+		case "/repos/test/valid/actions/runners":
+			fmt.Fprint(w, fake.RunnersListBody)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	p := &GitHubPermissionsPreflight{
+		GitHubClient:    newGithubClient(server),
+		Scopes:          []PreflightScope{{Repository: "test/valid"}},
+		Log:             logr.Discard(),
+		RecheckInterval: time.Nanosecond,
+	}
+
+	err := p.Run(context.Background())
+	if err == nil || IsPreflightPermissionError(err) {
+		t.Fatalf("expected a non-permission error, got %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+
+	if err := p.ReadyzCheck(req); err != nil {
+		t.Errorf("expected the readiness check to pass on errors other than missing permissions, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultGracefulStopAnnotationPrefix is the default prefix of the unregistration start and complete timestamp annotations.
+const DefaultGracefulStopAnnotationPrefix = "actions-runner-controller/"
+
+const (
+	// legacyUnregistrationCompleteTimestamp and legacyUnregistrationStartTimestamp are the annotation keys
+	// older versions of ARC used without any prefix.
+	// They are still read, and rewritten to the prefixed keys on the next graceful stop tick.
+	legacyUnregistrationCompleteTimestamp = "unregistration-complete-timestamp"
+	legacyUnregistrationStartTimestamp    = "unregistration-start-timestamp"
+)
+
+// gracefulStopAnnotationKeys is the set of annotation keys the graceful stop writes to runner pods.
+type gracefulStopAnnotationKeys struct {
+	complete string
+	start    string
+
+	// legacy maps the prefixed annotation keys to the legacy ones.
+	// It's empty when the prefix is empty, in which case the legacy keys are used as-is.
+	legacy map[string]string
+}
+
+func newGracefulStopAnnotationKeys(prefix string) *gracefulStopAnnotationKeys {
+	keys := &gracefulStopAnnotationKeys{
+		complete: prefix + legacyUnregistrationCompleteTimestamp,
+		start:    prefix + legacyUnregistrationStartTimestamp,
+		legacy:   map[string]string{},
+	}
+
+	if prefix != "" {
+		keys.legacy[keys.complete] = legacyUnregistrationCompleteTimestamp
+		keys.legacy[keys.start] = legacyUnregistrationStartTimestamp
+	}
+
+	return keys
+}
+
+var (
+	gracefulStopAnnotationsMu sync.Mutex
+
+	// gracefulStopAnnotationPrefix is the prefix set by SetGracefulStopAnnotationPrefix.
+	gracefulStopAnnotationPrefix = DefaultGracefulStopAnnotationPrefix
+
+	// gracefulStopAnnotations is computed from gracefulStopAnnotationPrefix on the first read,
+	// and never changes afterwards.
+	gracefulStopAnnotations *gracefulStopAnnotationKeys
+)
+
+func currentGracefulStopAnnotationKeys() *gracefulStopAnnotationKeys {
+	gracefulStopAnnotationsMu.Lock()
+	defer gracefulStopAnnotationsMu.Unlock()
+
+	if gracefulStopAnnotations == nil {
+		gracefulStopAnnotations = newGracefulStopAnnotationKeys(gracefulStopAnnotationPrefix)
+	}
+
+	return gracefulStopAnnotations
+}
+
+func unregistrationCompleteTimestamp() string {
+	return currentGracefulStopAnnotationKeys().complete
+}
+
+func unregistrationStartTimestamp() string {
+	return currentGracefulStopAnnotationKeys().start
+}
+
+func legacyGracefulStopAnnotationKeys() map[string]string {
+	return currentGracefulStopAnnotationKeys().legacy
+}
+
+func validateGracefulStopAnnotationPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+
+	if !strings.HasSuffix(prefix, "/") {
+		return fmt.Errorf("graceful stop annotation prefix %q must end with \"/\"", prefix)
+	}
+
+	if errs := validation.IsQualifiedName(prefix + legacyUnregistrationStartTimestamp); len(errs) > 0 {
+		return fmt.Errorf("invalid graceful stop annotation prefix %q: %s", prefix, strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// SetGracefulStopAnnotationPrefix changes the prefix of the unregistration start and complete timestamp annotations,
+// so that they don't collide with annotations written by other tools.
+// An empty prefix results in the legacy keys without any prefix.
+// The keys are fixed once they are read, so it must be called before starting the controllers.
+// Calling it afterwards results in an error.
+func SetGracefulStopAnnotationPrefix(prefix string) error {
+	if err := validateGracefulStopAnnotationPrefix(prefix); err != nil {
+		return err
+	}
+
+	gracefulStopAnnotationsMu.Lock()
+	defer gracefulStopAnnotationsMu.Unlock()
+
+	if gracefulStopAnnotations != nil {
+		return fmt.Errorf("graceful stop annotation prefix can't be changed after the annotations are in use")
+	}
+
+	gracefulStopAnnotationPrefix = prefix
+
+	return nil
+}
+
+// migrateLegacyGracefulStopAnnotations rewrites the legacy unregistration timestamp annotations of the pod to the prefixed keys.
+// It returns the pod as-is when there's nothing to migrate.
+func migrateLegacyGracefulStopAnnotations(ctx context.Context, c client.Client, pod *corev1.Pod) (*corev1.Pod, error) {
+	var updated *corev1.Pod
+
+	for key, legacy := range legacyGracefulStopAnnotationKeys() {
+		v, ok := pod.Annotations[legacy]
+		if !ok {
+			continue
+		}
+
+		if updated == nil {
+			updated = pod.DeepCopy()
+		}
+
+		if _, ok := updated.Annotations[key]; !ok {
+			updated.Annotations[key] = v
+		}
+		delete(updated.Annotations, legacy)
+	}
+
+	if updated == nil {
+		return pod, nil
+	}
+
+	if err := c.Patch(ctx, updated, client.MergeFrom(pod)); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
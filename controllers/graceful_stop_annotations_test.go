@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetAnnotation_LegacyGracefulStopKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        string
+		wantOk      bool
+	}{
+		{
+			name:        "prefixed",
+			annotations: map[string]string{"actions-runner-controller/unregistration-complete-timestamp": "new"},
+			want:        "new",
+			wantOk:      true,
+		},
+		{
+			name:        "legacy",
+			annotations: map[string]string{"unregistration-complete-timestamp": "old"},
+			want:        "old",
+			wantOk:      true,
+		},
+		{
+			name: "prefixed takes precedence",
+			annotations: map[string]string{
+				"actions-runner-controller/unregistration-complete-timestamp": "new",
+				"unregistration-complete-timestamp":                           "old",
+			},
+			want:   "new",
+			wantOk: true,
+		},
+		{
+			name:        "missing",
+			annotations: map[string]string{"unregistration-start-timestamp": "old"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+
+			got, ok := getAnnotation(pod, unregistrationCompleteTimestamp())
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("getAnnotation() = (%q, %v), want (%q, %v)", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestNewGracefulStopAnnotationKeys(t *testing.T) {
+	keys := newGracefulStopAnnotationKeys("example.com/")
+
+	if keys.start != "example.com/unregistration-start-timestamp" {
+		t.Errorf("unexpected start timestamp key: %s", keys.start)
+	}
+
+	if got := keys.legacy[keys.start]; got != "unregistration-start-timestamp" {
+		t.Errorf("expected the legacy start timestamp key, got %q", got)
+	}
+
+	keys = newGracefulStopAnnotationKeys("")
+
+	if keys.complete != "unregistration-complete-timestamp" || len(keys.legacy) != 0 {
+		t.Errorf("expected the legacy keys with the empty prefix, got %s", keys.complete)
+	}
+}
+
+func TestSetGracefulStopAnnotationPrefix(t *testing.T) {
+	for _, invalid := range []string{"example.com", "Example_com/", "a/b/"} {
+		if err := SetGracefulStopAnnotationPrefix(invalid); err == nil {
+			t.Errorf("expected error for prefix %q", invalid)
+		}
+	}
+
+	_ = unregistrationStartTimestamp()
+
+	if err := SetGracefulStopAnnotationPrefix("example.com/"); err == nil {
+		t.Error("expected error for changing the prefix after the keys are in use")
+	}
+
+	if got := unregistrationStartTimestamp(); got != DefaultGracefulStopAnnotationPrefix+"unregistration-start-timestamp" {
+		t.Errorf("expected the keys to be unchanged, got %s", got)
+	}
+}
+
+func TestTickRunnerGracefulStop_MigratesLegacyAnnotations(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+	)
+	defer server.Close()
+
+	started := formatUnregistrationTimestamp(time.Now().Add(-10 * time.Second))
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test3",
+			Annotations: map[string]string{
+				"unregistration-start-timestamp": started,
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+	_, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second}, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", pod.Name, pod)
+	if err != nil {
+		t.Fatalf("tickRunnerGracefulStop() error = %v", err)
+	}
+	if res == nil {
+		t.Fatal("expected the unregistration to be in progress")
+	}
+
+	var got corev1.Pod
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := got.Annotations["actions-runner-controller/unregistration-start-timestamp"]; v != started {
+		t.Errorf("expected the start timestamp to be migrated as-is: got %q, want %q", v, started)
+	}
+
+	if _, ok := got.Annotations["unregistration-start-timestamp"]; ok {
+		t.Errorf("expected the legacy annotation to be removed: %v", got.Annotations)
+	}
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// GracefulStopAuditPhaseStarted is the phase of the audit record sent when the graceful stop of a runner has started.
+	GracefulStopAuditPhaseStarted = "started"
+	// GracefulStopAuditPhaseCompleted is the phase of the audit record sent when the runner has been unregistered.
+	GracefulStopAuditPhaseCompleted = "completed"
+	// GracefulStopAuditPhaseFailed is the phase of the audit record sent when ARC gave up unregistering the runner.
+	GracefulStopAuditPhaseFailed = "failed"
+
+	// GracefulStopAuditSignatureHeader is the header of the audit webhook requests that has the HMAC-SHA256 signature of the body
+	// in the same format as GitHub's X-Hub-Signature-256, so that the receiver can verify the request came from ARC.
+	GracefulStopAuditSignatureHeader = "X-ARC-Signature-256"
+
+	DefaultGracefulStopAuditWebhookMaxRetries = 5
+	DefaultGracefulStopAuditWebhookRetryDelay = time.Second
+	DefaultGracefulStopAuditWebhookQueueSize  = 1000
+)
+
+// GracefulStopAuditRecord is the record of a graceful stop transition of a runner sent to the audit sink.
+type GracefulStopAuditRecord struct {
+	Namespace    string `json:"namespace"`
+	Runner       string `json:"runner"`
+	Enterprise   string `json:"enterprise,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Repository   string `json:"repository,omitempty"`
+
+	// Phase is one of started, completed, and failed.
+	Phase  string `json:"phase"`
+	Reason string `json:"reason,omitempty"`
+
+	Timestamp                       time.Time `json:"timestamp"`
+	UnregistrationStartTimestamp    string    `json:"unregistrationStartTimestamp,omitempty"`
+	UnregistrationCompleteTimestamp string    `json:"unregistrationCompleteTimestamp,omitempty"`
+
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// GracefulStopAuditSink receives the graceful stop transitions of runners, e.g. to ship them to an external audit system.
+// Send is called within reconciliations, so it must not block.
+type GracefulStopAuditSink interface {
+	Send(record GracefulStopAuditRecord)
+}
+
+// auditGracefulStop sends the graceful stop transition of the runner pod to config.AuditSink, if any.
+// It also counts the transition for the graceful stop summary regardless of the sink,
+// and records the completed and failed ones into config.StoppedRunnerHistory, if any.
+// attempts is the number of the unregistration attempts made so far.
+func auditGracefulStop(config GracefulStopConfig, phase string, now time.Time, enterprise, org, repo, runner string, pod *corev1.Pod, reason UnregistrationReason, attempts int, err error) {
+	gracefulStopCounts.add(phase)
+
+	historic := config.StoppedRunnerHistory != nil && phase != GracefulStopAuditPhaseStarted
+
+	if (config.AuditSink == nil && !historic) || pod == nil {
+		return
+	}
+
+	record := GracefulStopAuditRecord{
+		Namespace:    pod.Namespace,
+		Runner:       runner,
+		Enterprise:   enterprise,
+		Organization: org,
+		Repository:   repo,
+		Phase:        phase,
+		Reason:       string(unregistrationReasonOf(pod, reason)),
+		Timestamp:    now,
+		Attempts:     attempts,
+	}
+
+	record.UnregistrationStartTimestamp, _ = getAnnotation(pod, unregistrationStartTimestamp())
+	record.UnregistrationCompleteTimestamp, _ = getAnnotation(pod, unregistrationCompleteTimestamp())
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	if historic {
+		config.StoppedRunnerHistory.add(record)
+	}
+
+	if config.AuditSink != nil {
+		config.AuditSink.Send(record)
+	}
+}
+
+// GracefulStopAuditWebhook is the GracefulStopAuditSink that POSTs each record as JSON to the URL.
+//
+// Records are queued and sent one by one in the order of the transitions by Start, retrying failed requests with an exponential backoff,
+// so that a slow or unavailable audit endpoint never blocks graceful stops. Records that don't fit in the queue are dropped with an error log.
+type GracefulStopAuditWebhook struct {
+	URL string
+	// Secret signs the request bodies with HMAC-SHA256 into the GracefulStopAuditSignatureHeader header. Empty disables the signing.
+	Secret []byte
+
+	// Client defaults to an http.Client with a 10 seconds timeout.
+	Client *http.Client
+	// MaxRetries is the number of retries of a failed request until the record is dropped. Defaults to DefaultGracefulStopAuditWebhookMaxRetries.
+	MaxRetries int
+	// RetryDelay is the delay until the first retry, which doubles per retry. Defaults to DefaultGracefulStopAuditWebhookRetryDelay.
+	RetryDelay time.Duration
+	// QueueSize defaults to DefaultGracefulStopAuditWebhookQueueSize.
+	QueueSize int
+
+	Log logr.Logger
+
+	once  sync.Once
+	queue chan GracefulStopAuditRecord
+}
+
+func (w *GracefulStopAuditWebhook) init() {
+	w.once.Do(func() {
+		size := w.QueueSize
+		if size <= 0 {
+			size = DefaultGracefulStopAuditWebhookQueueSize
+		}
+
+		w.queue = make(chan GracefulStopAuditRecord, size)
+	})
+}
+
+// Send implements GracefulStopAuditSink.
+func (w *GracefulStopAuditWebhook) Send(record GracefulStopAuditRecord) {
+	w.init()
+
+	select {
+	case w.queue <- record:
+	default:
+		w.Log.Error(fmt.Errorf("audit queue is full"), "Dropped the graceful stop audit record", "namespace", record.Namespace, "runner", record.Runner, "phase", record.Phase)
+	}
+}
+
+// Start implements manager.Runnable.
+func (w *GracefulStopAuditWebhook) Start(ctx context.Context) error {
+	w.init()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case record := <-w.queue:
+			if err := w.post(ctx, record); err != nil && ctx.Err() == nil {
+				w.Log.Error(err, "Failed to send the graceful stop audit record", "namespace", record.Namespace, "runner", record.Runner, "phase", record.Phase)
+			}
+		}
+	}
+}
+
+// post sends the record, retrying on network errors, 429, and 5xx responses.
+func (w *GracefulStopAuditWebhook) post(ctx context.Context, record GracefulStopAuditRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	maxRetries := w.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultGracefulStopAuditWebhookMaxRetries
+	}
+
+	delay := w.RetryDelay
+	if delay <= 0 {
+		delay = DefaultGracefulStopAuditWebhookRetryDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		retryable, err := w.postOnce(ctx, body)
+		if err == nil {
+			return nil
+		}
+
+		if !retryable || attempt >= maxRetries {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+
+		w.Log.V(1).Info("Retrying to send the graceful stop audit record", "runner", record.Runner, "phase", record.Phase, "retryDelay", delay, "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+func (w *GracefulStopAuditWebhook) postOnce(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(w.Secret) > 0 {
+		req.Header.Set(GracefulStopAuditSignatureHeader, signGracefulStopAuditRecord(w.Secret, body))
+	}
+
+	c := w.Client
+	if c == nil {
+		c = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+
+	retryable := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+
+	return retryable, fmt.Errorf("unexpected status %s from the audit webhook", res.Status)
+}
+
+// signGracefulStopAuditRecord returns the value of GracefulStopAuditSignatureHeader for the body.
+func signGracefulStopAuditRecord(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type recordingAuditSink struct {
+	records []GracefulStopAuditRecord
+}
+
+func (s *recordingAuditSink) Send(record GracefulStopAuditRecord) {
+	s.records = append(s.records, record)
+}
+
+func TestTickRunnerGracefulStop_Audit(t *testing.T) {
+	sink := &recordingAuditSink{}
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(fake.NewScriptedHandler(fake.RunnerBusyResponse("test1"), fake.Response{Status: http.StatusNoContent})),
+	)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+	tick := func(pod *corev1.Pod) *corev1.Pod {
+		t.Helper()
+
+		updated, _, _ := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, BusyRunnerPollInterval: time.Second, AuditSink: sink}, UnregistrationReasonScaleDown, logr.Discard(), newGithubClient(server), c, "", "", "test/valid", pod.Name, pod)
+		if updated == nil {
+			t.Fatalf("expected the updated pod")
+		}
+
+		return updated
+	}
+
+	pod = tick(pod)
+
+	if len(sink.records) != 1 || sink.records[0].Phase != GracefulStopAuditPhaseStarted {
+		t.Fatalf("expected the started record only while the runner is busy, got %+v", sink.records)
+	}
+
+	tick(pod)
+
+	if len(sink.records) != 2 {
+		t.Fatalf("expected the started and completed records, got %+v", sink.records)
+	}
+
+	completed := sink.records[1]
+
+	if completed.Phase != GracefulStopAuditPhaseCompleted || completed.Runner != "test1" || completed.Repository != "test/valid" || completed.Reason != string(UnregistrationReasonScaleDown) {
+		t.Errorf("unexpected completed record: %+v", completed)
+	}
+
+	if completed.Attempts != 2 || completed.UnregistrationStartTimestamp == "" || completed.UnregistrationCompleteTimestamp == "" {
+		t.Errorf("expected the completed record to have the attempts and the timestamps: %+v", completed)
+	}
+}
+
+func TestGracefulStopAuditWebhook(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+		received GracefulStopAuditRecord
+		signed   bool
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests++
+
+		// The first request fails, and the retry succeeds.
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+
+		signed = r.Header.Get(GracefulStopAuditSignatureHeader) == signGracefulStopAuditRecord([]byte("secret"), body)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	webhook := &GracefulStopAuditWebhook{
+		URL:        server.URL,
+		Secret:     []byte("secret"),
+		RetryDelay: time.Millisecond,
+		Log:        logr.Discard(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go webhook.Start(ctx)
+
+	webhook.Send(GracefulStopAuditRecord{Namespace: "default", Runner: "test1", Phase: GracefulStopAuditPhaseCompleted, Attempts: 1})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := requests >= 2
+		mu.Unlock()
+
+		if done || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if requests != 2 {
+		t.Fatalf("expected the failed request to be retried once, got %d requests", requests)
+	}
+
+	if received.Runner != "test1" || received.Phase != GracefulStopAuditPhaseCompleted || received.Attempts != 1 {
+		t.Errorf("unexpected record: %+v", received)
+	}
+
+	if !signed {
+		t.Errorf("expected the request to be signed with the secret")
+	}
+}
+
+func TestGracefulStopAuditWebhook_GivesUp(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantRequests int
+	}{
+		{
+			name:         "retryable",
+			status:       http.StatusInternalServerError,
+			wantRequests: 3,
+		},
+		{
+			name:         "not retryable",
+			status:       http.StatusBadRequest,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			webhook := &GracefulStopAuditWebhook{URL: server.URL, MaxRetries: 2, RetryDelay: time.Millisecond, Log: logr.Discard()}
+
+			if err := webhook.post(context.Background(), GracefulStopAuditRecord{Runner: "test1"}); err == nil {
+				t.Errorf("expected an error")
+			}
+
+			if requests != tt.wantRequests {
+				t.Errorf("unexpected number of requests: got %d, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
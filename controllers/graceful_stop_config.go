@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// GracefulStopConfig configures the graceful stops of runners.
+// It's embedded in the runner, runner pod, and runner set reconcilers, so that all of them stop runners the same way.
+type GracefulStopConfig struct {
+	// UnregistrationTimeout is the duration until ARC gives up retrying to unregister a runner and deletes the runner pod.
+	// It can be overridden per runner pod via the AnnotationKeyUnregistrationTimeout annotation.
+	UnregistrationTimeout time.Duration
+
+	// UnregistrationRetryDelay is the delay between retries while ARC is waiting for a runner to be unregistered.
+	// Defaults to DefaultUnregistrationRetryDelay.
+	UnregistrationRetryDelay time.Duration
+
+	// MaxUnregistrationRetryDelay makes the delay between retries adaptive. See RequeuePolicy.MaxInProgressDelay.
+	MaxUnregistrationRetryDelay time.Duration
+
+	// BusyRunnerPollInterval is the delay between retries while a runner is running a job.
+	// Defaults to UnregistrationRetryDelay.
+	BusyRunnerPollInterval time.Duration
+
+	// PatchConflictRetryDelay is the delay until retrying after patching the runner pod failed with a conflict.
+	PatchConflictRetryDelay time.Duration
+
+	// MinRateLimitRetryDelay is the minimum the AnnotationKeyRateLimitRetryDelay annotation of a runner pod can shorten
+	// the delay until retrying after hitting GitHub API rate limits to.
+	MinRateLimitRetryDelay time.Duration
+
+	// RegistrationRaceGracePeriod is how long since the runner pod creation ARC waits for a runner not found on GitHub to register.
+	RegistrationRaceGracePeriod time.Duration
+
+	// PostUnregistrationDelay is the delay between a successful unregistration and the runner pod deletion.
+	PostUnregistrationDelay time.Duration
+
+	// UnregistrationStartJitter is the maximum of the random delay before the first unregistration attempt of each runner pod.
+	UnregistrationStartJitter time.Duration
+
+	// MaxUnregistrationAttempts is the retry budget of failed unregistration attempts that are not transient. Zero disables the budget.
+	MaxUnregistrationAttempts int
+
+	// RequireReadyToStop holds the graceful stop of each runner pod until it's annotated with AnnotationKeyReadyToStop.
+	RequireReadyToStop bool
+
+	// ConfirmUnregistration makes ARC confirm that each removed runner has disappeared on GitHub before deleting the runner pod.
+	ConfirmUnregistration bool
+
+	// DisableInlineUnregistration makes ARC skip removing runners from GitHub while stopping them, leaving it to OfflineRunnerCleaner.
+	DisableInlineUnregistration bool
+
+	// RunnerOwnership restricts the runners ARC removes from GitHub to the ones it owns.
+	RunnerOwnership RunnerOwnership
+
+	// SkipBusyRunnerRemoval makes ARC see the busy flag of the runner listed on GitHub before removing it,
+	// and wait for a busy runner to finish its job without calling RemoveRunner, which fails with 422 for busy runners anyway.
+	// It saves a GitHub API call on every retry for a busy runner, at the cost of waiting up to the age of the cached ListRunners response
+	// after the job completes.
+	SkipBusyRunnerRemoval bool
+
+	// RunnerNameTemplate is the Go template rendering the name of the runner registered on GitHub from the name of the runner pod,
+	// e.g. `cluster-a-{{ .Name }}`, for runners registered with names transformed by e.g. a custom entrypoint.
+	// Empty means the runner is registered with the name of the runner pod as-is.
+	RunnerNameTemplate string
+
+	// RunnerNameSuffixPattern is the regular expression fully matching the suffix GitHub may append to the name of a runner
+	// registered with the name of another runner, e.g. `-\d+`. A runner not found by its name is looked up by the name followed by such suffix.
+	// Empty disables it.
+	RunnerNameSuffixPattern string
+
+	// DuplicateRunnerNamePolicy is how ARC unregisters runners whose names are shared by other runners on GitHub.
+	// Defaults to DuplicateRunnerNamePolicyFail.
+	DuplicateRunnerNamePolicy DuplicateRunnerNamePolicy
+
+	// TerminatingPodUnregistration is how ARC unregisters runners whose pods are already terminating.
+	// Defaults to TerminatingPodUnregistrationGraceful.
+	TerminatingPodUnregistration TerminatingPodUnregistration
+
+	// RunnerPodNeverCreatedGracePeriod is how long ARC waits for a missing or pending runner pod before concluding
+	// that the runner will never register, to not delete the runner or its pod while the pod is just slow to be scheduled.
+	// Zero makes ARC conclude it immediately.
+	RunnerPodNeverCreatedGracePeriod time.Duration
+
+	// PodDeletionPropagationPolicy is the propagation policy ARC deletes runner pods with once they're gracefully stopped.
+	// Empty means the default of the API server, which is Background for pods.
+	PodDeletionPropagationPolicy metav1.DeletionPropagation
+
+	// UnregistrationProgressLogInterval is the interval of logging the in-progress unregistration of each runner at info level.
+	// The logs in between are emitted at V(1). Zero logs every one at info level.
+	UnregistrationProgressLogInterval time.Duration
+
+	// GitHubRunnerLabelsAnnotation is the key of the annotation ARC records the labels of the runner registered on GitHub to
+	// on the runner pod. Empty disables it.
+	GitHubRunnerLabelsAnnotation string
+
+	// PodExecutor runs the spec.preUnregistrationExec commands of runners.
+	// Nil makes ARC skip the commands with warnings.
+	PodExecutor RunnerPodExecutor
+
+	// ShutdownLogMarker is the regular expression the tail of the logs of the runner container must match
+	// before ARC completes the unregistration of the runner. Empty disables it.
+	ShutdownLogMarker string
+
+	// ShutdownLogMarkerTimeout is the duration since the start of the graceful stop until ARC gives up waiting for ShutdownLogMarker.
+	ShutdownLogMarkerTimeout time.Duration
+
+	// PodLogReader reads the runner container logs to verify ShutdownLogMarker. It's required when ShutdownLogMarker is set.
+	PodLogReader RunnerPodLogReader
+
+	// AuditSink receives the graceful stop transitions of runners. Nil disables the audit.
+	AuditSink GracefulStopAuditSink
+
+	// StoppedRunnerHistory records the runners that completed or failed the unregistration. Nil disables the history.
+	StoppedRunnerHistory *StoppedRunnerHistory
+}
+
+// Validate returns an error if any of the settings is invalid, so that it can be reported before starting the controllers.
+func (c GracefulStopConfig) Validate() error {
+	if _, err := parseRunnerNameTemplate(c.RunnerNameTemplate); err != nil {
+		return err
+	}
+
+	if c.RunnerNameSuffixPattern != "" {
+		if _, err := regexp.Compile(c.RunnerNameSuffixPattern); err != nil {
+			return fmt.Errorf("invalid runner name suffix pattern %q: %w", c.RunnerNameSuffixPattern, err)
+		}
+	}
+
+	switch c.DuplicateRunnerNamePolicy {
+	case "", DuplicateRunnerNamePolicyFail, DuplicateRunnerNamePolicyRemoveAll, DuplicateRunnerNamePolicyRemoveOfflineOnly:
+	default:
+		return fmt.Errorf("invalid duplicate runner name policy %q: must be one of %s, %s, and %s", c.DuplicateRunnerNamePolicy, DuplicateRunnerNamePolicyFail, DuplicateRunnerNamePolicyRemoveAll, DuplicateRunnerNamePolicyRemoveOfflineOnly)
+	}
+
+	switch c.TerminatingPodUnregistration {
+	case "", TerminatingPodUnregistrationGraceful, TerminatingPodUnregistrationBestEffort, TerminatingPodUnregistrationSkip:
+	default:
+		return fmt.Errorf("invalid terminating pod unregistration %q: must be one of %s, %s, and %s", c.TerminatingPodUnregistration, TerminatingPodUnregistrationGraceful, TerminatingPodUnregistrationBestEffort, TerminatingPodUnregistrationSkip)
+	}
+
+	switch p := c.PodDeletionPropagationPolicy; p {
+	case "", metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan:
+	default:
+		return fmt.Errorf("invalid pod deletion propagation policy %q: must be one of %s, %s, and %s", p, metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan)
+	}
+
+	if key := c.GitHubRunnerLabelsAnnotation; key != "" {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid github runner labels annotation %q: %s", key, strings.Join(errs, "; "))
+		}
+	}
+
+	if c.ShutdownLogMarker != "" {
+		if _, err := regexp.Compile(c.ShutdownLogMarker); err != nil {
+			return fmt.Errorf("invalid shutdown log marker %q: %w", c.ShutdownLogMarker, err)
+		}
+
+		if c.PodLogReader == nil {
+			return fmt.Errorf("shutdown log marker %q requires a pod log reader", c.ShutdownLogMarker)
+		}
+	}
+
+	return nil
+}
+
+func (c GracefulStopConfig) unregistrationRetryDelay() time.Duration {
+	retryDelay := DefaultUnregistrationRetryDelay
+
+	if c.UnregistrationRetryDelay > 0 {
+		retryDelay = c.UnregistrationRetryDelay
+	}
+	return retryDelay
+}
+
+func (c GracefulStopConfig) busyRunnerPollInterval() time.Duration {
+	if c.BusyRunnerPollInterval > 0 {
+		return c.BusyRunnerPollInterval
+	}
+	return c.unregistrationRetryDelay()
+}
+
+func (c GracefulStopConfig) requeuePolicy() RequeuePolicy {
+	return RequeuePolicy{
+		InProgressDelay:    c.unregistrationRetryDelay(),
+		MaxInProgressDelay: c.MaxUnregistrationRetryDelay,
+		BusyDelay:          c.busyRunnerPollInterval(),
+		ConflictDelay:      c.PatchConflictRetryDelay,
+		MinRateLimitDelay:  c.MinRateLimitRetryDelay,
+	}
+}
+
+// runnerAPI returns the RunnerAPI to be used for unregistering runners,
+// which confirms, defers, and restricts the removal of runners as configured.
+func (c GracefulStopConfig) runnerAPI(api github.RunnerAPI) github.RunnerAPI {
+	return withRunnerOwnership(withInlineUnregistrationDisabled(withUnregistrationConfirmation(api, c.ConfirmUnregistration), c.DisableInlineUnregistration), c.RunnerOwnership)
+}
+
+// tickGracefulStop ticks the graceful stop of the runner with the configuration, unregistering it via ghClient wrapped by runnerAPI.
+// See tickRunnerGracefulStop for how to handle the results.
+func (c GracefulStopConfig) tickGracefulStop(ctx context.Context, reason UnregistrationReason, log logr.Logger, ghClient github.RunnerAPI, kc client.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+	return tickRunnerGracefulStop(ctx, realClock{}, c, reason, log, c.runnerAPI(ghClient), kc, enterprise, organization, repository, runner, pod)
+}
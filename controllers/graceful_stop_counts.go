@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// GracefulStopSummaryPath is the path of the metrics endpoint that serves GracefulStopSummaryHandler.
+	GracefulStopSummaryPath = "/debug/graceful-stop/summary"
+
+	DefaultGracefulStopCountsSyncPeriod = time.Minute
+
+	// gracefulStopCountsSaveTimeout bounds saving the counts on shutdown, which is done after the manager's context is cancelled.
+	gracefulStopCountsSaveTimeout = 10 * time.Second
+)
+
+// GracefulStopCounts is the cumulative number of the graceful stop transitions of runners, per phase of GracefulStopAuditRecord.
+type GracefulStopCounts struct {
+	Started   int64 `json:"started"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+}
+
+type gracefulStopCounter struct {
+	mu     sync.Mutex
+	counts GracefulStopCounts
+}
+
+// gracefulStopCounts counts the graceful stop transitions observed by this process, on top of the counts restored by GracefulStopCountsPersister.
+var gracefulStopCounts = &gracefulStopCounter{}
+
+func (c *gracefulStopCounter) add(phase string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch phase {
+	case GracefulStopAuditPhaseStarted:
+		c.counts.Started++
+	case GracefulStopAuditPhaseCompleted:
+		c.counts.Completed++
+	case GracefulStopAuditPhaseFailed:
+		c.counts.Failed++
+	}
+}
+
+// restore adds the counts saved by a previous process to the counts of this process.
+func (c *gracefulStopCounter) restore(saved GracefulStopCounts) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts.Started += saved.Started
+	c.counts.Completed += saved.Completed
+	c.counts.Failed += saved.Failed
+}
+
+func (c *gracefulStopCounter) snapshot() GracefulStopCounts {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts
+}
+
+// GracefulStopCountsPersister saves the cumulative graceful stop counts into a ConfigMap every SyncPeriod and on shutdown,
+// and restores them on start, so that the totals in the graceful stop summary survive controller restarts and upgrades.
+// It doesn't affect the Prometheus metrics, which reset on restarts as usual.
+//
+// It runs only on the leader, which is the only replica that stops runners.
+type GracefulStopCountsPersister struct {
+	// Client writes the ConfigMap.
+	Client client.Client
+	// Reader reads the ConfigMap. It should bypass the cache, so that the controller doesn't need to watch all the ConfigMaps in the cluster.
+	Reader client.Reader
+	Log    logr.Logger
+
+	Namespace string
+	Name      string
+
+	SyncPeriod time.Duration
+
+	// counter is the counter to save and restore. It's gracefulStopCounts unless overridden for testing.
+	counter *gracefulStopCounter
+}
+
+// Start implements manager.Runnable.
+func (p *GracefulStopCountsPersister) Start(ctx context.Context) error {
+	period := p.SyncPeriod
+	if period <= 0 {
+		period = DefaultGracefulStopCountsSyncPeriod
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	var restored bool
+
+	for {
+		if !restored {
+			// We never save before restoring, which would overwrite the saved counts with the smaller counts of this process.
+			if err := p.restore(ctx); err != nil {
+				p.Log.Error(err, "Failed to restore the graceful stop counts. Retrying later.", "configmap", p.key())
+			} else {
+				restored = true
+			}
+		} else if err := p.save(ctx); err != nil {
+			p.Log.Error(err, "Failed to save the graceful stop counts", "configmap", p.key())
+		}
+
+		select {
+		case <-ctx.Done():
+			if restored {
+				saveCtx, cancel := context.WithTimeout(context.Background(), gracefulStopCountsSaveTimeout)
+				if err := p.save(saveCtx); err != nil {
+					p.Log.Error(err, "Failed to save the graceful stop counts on shutdown", "configmap", p.key())
+				}
+				cancel()
+			}
+
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *GracefulStopCountsPersister) key() types.NamespacedName {
+	return types.NamespacedName{Namespace: p.Namespace, Name: p.Name}
+}
+
+func (p *GracefulStopCountsPersister) getCounter() *gracefulStopCounter {
+	if p.counter != nil {
+		return p.counter
+	}
+
+	return gracefulStopCounts
+}
+
+func (p *GracefulStopCountsPersister) restore(ctx context.Context) error {
+	var cm corev1.ConfigMap
+	if err := p.Reader.Get(ctx, p.key(), &cm); err != nil {
+		if kerrors.IsNotFound(err) {
+			// Nothing has been saved yet.
+			return nil
+		}
+
+		return err
+	}
+
+	saved, err := gracefulStopCountsFromConfigMap(&cm)
+	if err != nil {
+		return err
+	}
+
+	p.getCounter().restore(saved)
+
+	p.Log.Info("Restored the graceful stop counts", "configmap", p.key(), "started", saved.Started, "completed", saved.Completed, "failed", saved.Failed)
+
+	return nil
+}
+
+func (p *GracefulStopCountsPersister) save(ctx context.Context) error {
+	return saveConfigMapData(ctx, p.Client, p.Reader, p.key(), gracefulStopCountsToConfigMapData(p.getCounter().snapshot()))
+}
+
+// saveConfigMapData replaces the data of the configmap, creating the configmap if missing.
+func saveConfigMapData(ctx context.Context, c client.Client, r client.Reader, key types.NamespacedName, data map[string]string) error {
+	var cm corev1.ConfigMap
+	if err := r.Get(ctx, key, &cm); err != nil {
+		if !kerrors.IsNotFound(err) {
+			return err
+		}
+
+		cm = corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: key.Namespace,
+				Name:      key.Name,
+			},
+			Data: data,
+		}
+
+		return c.Create(ctx, &cm)
+	}
+
+	updated := cm.DeepCopy()
+	updated.Data = data
+
+	return c.Patch(ctx, updated, client.MergeFrom(&cm))
+}
+
+func gracefulStopCountsToConfigMapData(counts GracefulStopCounts) map[string]string {
+	return map[string]string{
+		GracefulStopAuditPhaseStarted:   strconv.FormatInt(counts.Started, 10),
+		GracefulStopAuditPhaseCompleted: strconv.FormatInt(counts.Completed, 10),
+		GracefulStopAuditPhaseFailed:    strconv.FormatInt(counts.Failed, 10),
+	}
+}
+
+func gracefulStopCountsFromConfigMap(cm *corev1.ConfigMap) (GracefulStopCounts, error) {
+	var counts GracefulStopCounts
+
+	for phase, count := range map[string]*int64{
+		GracefulStopAuditPhaseStarted:   &counts.Started,
+		GracefulStopAuditPhaseCompleted: &counts.Completed,
+		GracefulStopAuditPhaseFailed:    &counts.Failed,
+	} {
+		v, ok := cm.Data[phase]
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return GracefulStopCounts{}, fmt.Errorf("invalid %s count %q in configmap %s/%s", phase, v, cm.Namespace, cm.Name)
+		}
+
+		*count = n
+	}
+
+	return counts, nil
+}
+
+// GracefulStopSummary is the summary of the graceful stops of runners served by GracefulStopSummaryHandler.
+type GracefulStopSummary struct {
+	// Phases is the number of the runner pods per unregistration phase, i.e. in_progress, timed_out, and completed.
+	Phases map[string]int `json:"phases"`
+
+	// Totals is the cumulative number of the graceful stop transitions of runners,
+	// including the ones before controller restarts when GracefulStopCountsPersister is enabled.
+	Totals GracefulStopCounts `json:"totals"`
+}
+
+// GracefulStopSummaryHandler serves the GracefulStopSummary as JSON.
+// Like GracefulStopStateHandler, it's meant to be added to the metrics endpoint.
+type GracefulStopSummaryHandler struct {
+	Client client.Reader
+	Log    logr.Logger
+
+	// UnregistrationTimeout is the controller-wide unregistration timeout, used to tell timed out graceful stops from in-progress ones.
+	UnregistrationTimeout time.Duration
+}
+
+func (h *GracefulStopSummaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var pods corev1.PodList
+	if err := h.Client.List(r.Context(), &pods); err != nil {
+		h.Log.Error(err, "Failed to list pods for the graceful stop summary")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	summary := GracefulStopSummary{
+		Phases: countRunnerUnregistrationPhases(pods.Items, h.UnregistrationTimeout, time.Now()),
+		Totals: gracefulStopCounts.snapshot(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		h.Log.Error(err, "Failed to write the graceful stop summary")
+	}
+}
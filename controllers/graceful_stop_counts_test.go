@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/controllers/metrics"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGracefulStopCountsPersister_SaveAndRestore(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).Build()
+
+	before := &gracefulStopCounter{}
+	before.add(GracefulStopAuditPhaseStarted)
+	before.add(GracefulStopAuditPhaseStarted)
+	before.add(GracefulStopAuditPhaseCompleted)
+	before.add(GracefulStopAuditPhaseFailed)
+
+	p := &GracefulStopCountsPersister{Client: c, Reader: c, Log: logr.Discard(), Namespace: "actions-runner-system", Name: "graceful-stop-counts", counter: before}
+
+	// The first save creates the configmap, and the second one updates it.
+	if err := p.save(context.Background()); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	before.add(GracefulStopAuditPhaseCompleted)
+
+	if err := p.save(context.Background()); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	var cm corev1.ConfigMap
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: p.Namespace, Name: p.Name}, &cm); err != nil {
+		t.Fatal(err)
+	}
+
+	if cm.Data[GracefulStopAuditPhaseCompleted] != "2" {
+		t.Errorf("unexpected configmap data: %v", cm.Data)
+	}
+
+	// The restarted controller counts on top of the restored counts.
+	after := &gracefulStopCounter{}
+	after.add(GracefulStopAuditPhaseStarted)
+
+	p.counter = after
+
+	if err := p.restore(context.Background()); err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+
+	want := GracefulStopCounts{Started: 3, Completed: 2, Failed: 1}
+	if got := after.snapshot(); got != want {
+		t.Errorf("unexpected counts after restore: got %+v, want %+v", got, want)
+	}
+}
+
+func TestGracefulStopCountsPersister_RestoreNotFound(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).Build()
+
+	counter := &gracefulStopCounter{}
+	counter.add(GracefulStopAuditPhaseStarted)
+
+	p := &GracefulStopCountsPersister{Client: c, Reader: c, Log: logr.Discard(), Namespace: "default", Name: "graceful-stop-counts", counter: counter}
+
+	if err := p.restore(context.Background()); err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+
+	if got, want := counter.snapshot(), (GracefulStopCounts{Started: 1}); got != want {
+		t.Errorf("unexpected counts: got %+v, want %+v", got, want)
+	}
+}
+
+func TestGracefulStopCountsPersister_RestoreInvalid(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "graceful-stop-counts"},
+		Data: map[string]string{
+			GracefulStopAuditPhaseStarted:   "3",
+			GracefulStopAuditPhaseCompleted: "two",
+		},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(cm).Build()
+
+	counter := &gracefulStopCounter{}
+
+	p := &GracefulStopCountsPersister{Client: c, Reader: c, Log: logr.Discard(), Namespace: cm.Namespace, Name: cm.Name, counter: counter}
+
+	if err := p.restore(context.Background()); err == nil {
+		t.Fatal("expected the invalid count to be rejected")
+	}
+
+	// None of the counts must be restored, so that the next attempt doesn't count them twice.
+	if got := counter.snapshot(); got != (GracefulStopCounts{}) {
+		t.Errorf("unexpected counts: got %+v", got)
+	}
+}
+
+func TestGracefulStopSummaryHandler(t *testing.T) {
+	started := time.Now().Add(-30 * time.Second).UTC().Format(time.RFC3339)
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "example-runner",
+			Annotations: map[string]string{unregistrationStartTimestamp(): started},
+		},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+	before := gracefulStopCounts.snapshot()
+
+	auditGracefulStop(GracefulStopConfig{}, GracefulStopAuditPhaseStarted, time.Now(), "", "", "test/valid", pod.Name, pod, UnregistrationReasonScaleDown, 0, nil)
+
+	h := &GracefulStopSummaryHandler{Client: c, Log: logr.Discard(), UnregistrationTimeout: time.Minute}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, GracefulStopSummaryPath, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var got GracefulStopSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Phases[metrics.RunnerUnregistrationPhaseInProgress] != 1 {
+		t.Errorf("unexpected phases: %v", got.Phases)
+	}
+
+	if got.Totals.Started != before.Started+1 {
+		t.Errorf("unexpected started total: got %d, want %d", got.Totals.Started, before.Started+1)
+	}
+}
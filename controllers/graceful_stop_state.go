@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// GracefulStopStatePath is the path of the metrics endpoint that serves GracefulStopStateHandler.
+	GracefulStopStatePath = "/debug/graceful-stop"
+
+	// gracefulStopPhaseNotStarted is the phase of a runner pod whose graceful stop has not started.
+	gracefulStopPhaseNotStarted = "not_started"
+)
+
+// RunnerGracefulStopState is the graceful stop state of a runner pod, aggregated from its annotations
+// and the UnregistrationFailed condition of its runner.
+type RunnerGracefulStopState struct {
+	Namespace    string `json:"namespace"`
+	Name         string `json:"name"`
+	Enterprise   string `json:"enterprise,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Repository   string `json:"repository,omitempty"`
+
+	// Phase is one of not_started, in_progress, timed_out, and completed.
+	Phase string `json:"phase"`
+
+	UnregistrationStartTimestamp    string `json:"unregistrationStartTimestamp,omitempty"`
+	UnregistrationCompleteTimestamp string `json:"unregistrationCompleteTimestamp,omitempty"`
+
+	Attempts      int `json:"attempts"`
+	AttemptsTotal int `json:"attemptsTotal"`
+
+	EffectiveTimeout string                      `json:"effectiveTimeout"`
+	TimeoutSource    UnregistrationTimeoutSource `json:"timeoutSource"`
+
+	LastError string `json:"lastError,omitempty"`
+}
+
+// GracefulStopStateHandler serves the graceful stop state of all the runner pods as a JSON array, so that on-call engineers
+// can see in one place how runners are being drained, instead of grepping logs across controller pods.
+//
+// It's meant to be added to the metrics endpoint, which is served behind kube-rbac-proxy in the default deployment,
+// so that only the users authorized to get the non-resource URL GracefulStopStatePath can see it.
+type GracefulStopStateHandler struct {
+	Client client.Reader
+	Log    logr.Logger
+
+	// UnregistrationTimeout is the controller-wide unregistration timeout, used to compute the effective timeout of each runner pod.
+	UnregistrationTimeout time.Duration
+}
+
+func (h *GracefulStopStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var opts []client.ListOption
+	if ns := r.URL.Query().Get("namespace"); ns != "" {
+		opts = append(opts, client.InNamespace(ns))
+	}
+
+	var pods corev1.PodList
+	if err := h.Client.List(r.Context(), &pods, opts...); err != nil {
+		h.Log.Error(err, "Failed to list pods for the graceful stop state")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var runners v1alpha1.RunnerList
+	if err := h.Client.List(r.Context(), &runners, opts...); err != nil {
+		h.Log.Error(err, "Failed to list runners for the graceful stop state")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	states := runnerGracefulStopStates(pods.Items, runners.Items, h.UnregistrationTimeout, time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(states); err != nil {
+		h.Log.Error(err, "Failed to write the graceful stop state")
+	}
+}
+
+// runnerGracefulStopStates returns the graceful stop states of the runner pods, sorted by namespace and name.
+// Pods that are neither created by Runners nor RunnerSets are ignored.
+func runnerGracefulStopStates(pods []corev1.Pod, runners []v1alpha1.Runner, unregistrationTimeout time.Duration, now time.Time) []RunnerGracefulStopState {
+	failures := map[types.NamespacedName]string{}
+
+	for _, runner := range runners {
+		if c := meta.FindStatusCondition(runner.Status.Conditions, v1alpha1.RunnerConditionUnregistrationFailed); c != nil && c.Status == metav1.ConditionTrue {
+			failures[types.NamespacedName{Namespace: runner.Namespace, Name: runner.Name}] = c.Message
+		}
+	}
+
+	states := []RunnerGracefulStopState{}
+
+	for i := range pods {
+		pod := &pods[i]
+
+		if !isManagedRunnerPod(pod) {
+			continue
+		}
+
+		enterprise, org, repo := runnerPodScope(pod)
+
+		phase, ok := runnerPodUnregistrationPhase(pod, unregistrationTimeout, now)
+		if !ok {
+			phase = gracefulStopPhaseNotStarted
+		}
+
+		started, _ := getAnnotation(pod, unregistrationStartTimestamp())
+		completed, _ := getAnnotation(pod, unregistrationCompleteTimestamp())
+		timeout, source := EffectiveUnregistrationTimeout(pod, unregistrationTimeout)
+
+		states = append(states, RunnerGracefulStopState{
+			Namespace:                       pod.Namespace,
+			Name:                            pod.Name,
+			Enterprise:                      enterprise,
+			Organization:                    org,
+			Repository:                      repo,
+			Phase:                           phase,
+			UnregistrationStartTimestamp:    started,
+			UnregistrationCompleteTimestamp: completed,
+			Attempts:                        unregistrationAttempts(pod),
+			AttemptsTotal:                   unregistrationAttemptsTotal(pod),
+			EffectiveTimeout:                timeout.String(),
+			TimeoutSource:                   source,
+			LastError:                       failures[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}],
+		})
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Namespace != states[j].Namespace {
+			return states[i].Namespace < states[j].Namespace
+		}
+		return states[i].Name < states[j].Name
+	})
+
+	return states
+}
+
+// isManagedRunnerPod returns true if the pod is created by a Runner or a RunnerSet.
+func isManagedRunnerPod(pod *corev1.Pod) bool {
+	if _, ok := pod.Labels[LabelKeyRunnerSetName]; ok {
+		return true
+	}
+
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "Runner" {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGracefulStopStateHandler(t *testing.T) {
+	started := time.Now().Add(-30 * time.Second).UTC().Format(time.RFC3339)
+
+	controller := true
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-runner"},
+		Status: v1alpha1.RunnerStatus{
+			Conditions: []metav1.Condition{{
+				Type:    v1alpha1.RunnerConditionUnregistrationFailed,
+				Status:  metav1.ConditionTrue,
+				Reason:  "RetryBudgetExhausted",
+				Message: "failed to unregister runner after 3 attempts",
+			}},
+		},
+	}
+
+	objs := []runtime.Object{
+		runner,
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "example-runner",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: v1alpha1.GroupVersion.String(), Kind: "Runner", Name: "example-runner", Controller: &controller},
+				},
+				Annotations: map[string]string{
+					unregistrationStartTimestamp():           started,
+					AnnotationKeyUnregistrationAttempts:      "3",
+					AnnotationKeyUnregistrationAttemptsTotal: "5",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "runner", Env: []corev1.EnvVar{{Name: EnvVarRepo, Value: "test/valid"}}}},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "example-runnerset-0",
+				Labels:    map[string]string{LabelKeyRunnerSetName: "example-runnerset"},
+				Annotations: map[string]string{
+					AnnotationKeyUnregistrationTimeout: "10m",
+				},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "unrelated"},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	h := &GracefulStopStateHandler{
+		Client:                clientfake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build(),
+		Log:                   logr.Discard(),
+		UnregistrationTimeout: time.Minute,
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, GracefulStopStatePath, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var got []RunnerGracefulStopState
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []RunnerGracefulStopState{
+		{
+			Namespace:                    "default",
+			Name:                         "example-runner",
+			Repository:                   "test/valid",
+			Phase:                        "in_progress",
+			UnregistrationStartTimestamp: started,
+			Attempts:                     3,
+			AttemptsTotal:                5,
+			EffectiveTimeout:             "1m0s",
+			TimeoutSource:                UnregistrationTimeoutSourceFlag,
+			LastError:                    "failed to unregister runner after 3 attempts",
+		},
+		{
+			Namespace:        "default",
+			Name:             "example-runnerset-0",
+			Phase:            "not_started",
+			EffectiveTimeout: "10m0s",
+			TimeoutSource:    UnregistrationTimeoutSourceAnnotation,
+		},
+	}
+
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("unexpected graceful stop state (-want +got):\n%s", d)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, GracefulStopStatePath, nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status for POST: %d", rec.Code)
+	}
+}
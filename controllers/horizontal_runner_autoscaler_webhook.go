@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -68,6 +69,24 @@ type HorizontalRunnerAutoscalerGitHubWebhook struct {
 	// Set to empty for letting it watch for all namespaces.
 	Namespace string
 	Name      string
+
+	// DeliveryCacheSize is the maximum number of webhook delivery IDs remembered to ignore redeliveries.
+	// Defaults to DefaultWebhookDeliveryCacheSize.
+	DeliveryCacheSize int
+
+	// DeliveryCacheTTL is how long a webhook delivery ID is remembered to ignore redeliveries.
+	// Defaults to DefaultWebhookDeliveryCacheTTL.
+	DeliveryCacheTTL time.Duration
+
+	// StopRunnersOfCancelledJobs makes the webhook server mark the runner pod a cancelled workflow job was assigned to
+	// for recycling, so that the runner is gracefully stopped and recreated as soon as it's no longer busy.
+	StopRunnersOfCancelledJobs bool
+
+	deliveryCacheOnce sync.Once
+	deliveryCache     *webhookDeliveryCache
+
+	jobAssignmentCacheOnce sync.Once
+	jobAssignmentCache     *workflowJobAssignmentCache
 }
 
 func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) Reconcile(_ context.Context, request reconcile.Request) (reconcile.Result, error) {
@@ -78,6 +97,8 @@ func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) Reconcile(_ context.C
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=horizontalrunnerautoscalers/finalizers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=horizontalrunnerautoscalers/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runners,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch
 
 func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) Handle(w http.ResponseWriter, r *http.Request) {
 	var (
@@ -145,12 +166,30 @@ func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) Handle(w http.Respons
 
 	var target *ScaleTarget
 
+	delivery := r.Header.Get("X-GitHub-Delivery")
+
 	log := autoscaler.Log.WithValues(
 		"event", webhookType,
 		"hookID", r.Header.Get("X-GitHub-Hook-ID"),
-		"delivery", r.Header.Get("X-GitHub-Delivery"),
+		"delivery", delivery,
 	)
 
+	if delivery != "" && autoscaler.getDeliveryCache().seen(delivery, time.Now()) {
+		ok = true
+
+		w.WriteHeader(http.StatusOK)
+
+		msg := "ignored redelivery of an already processed webhook event"
+
+		log.V(1).Info(msg)
+
+		if written, err := w.Write([]byte(msg)); err != nil {
+			log.Error(err, "failed writing http response", "msg", msg, "written", written)
+		}
+
+		return
+	}
+
 	var enterpriseEvent struct {
 		Enterprise struct {
 			Slug string `json:"slug,omitempty"`
@@ -231,6 +270,10 @@ func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) Handle(w http.Respons
 
 		labels := e.WorkflowJob.Labels
 
+		if autoscaler.StopRunnersOfCancelledJobs {
+			autoscaler.handleWorkflowJobAssignment(r.Context(), log, e, payload, enterpriseSlug)
+		}
+
 		switch action := e.GetAction(); action {
 		case "queued", "completed":
 			target, err = autoscaler.getJobScaleUpTargetForRepoOrOrg(
@@ -244,6 +287,8 @@ func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) Handle(w http.Respons
 			)
 
 			if target != nil {
+				target.WorkflowJobID = e.WorkflowJob.GetID()
+
 				if e.GetAction() == "queued" {
 					target.Amount = 1
 				} else if e.GetAction() == "completed" {
@@ -313,6 +358,10 @@ func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) Handle(w http.Respons
 		return
 	}
 
+	if delivery != "" {
+		autoscaler.getDeliveryCache().add(delivery, time.Now())
+	}
+
 	ok = true
 
 	w.WriteHeader(http.StatusOK)
@@ -378,6 +427,10 @@ func matchTriggerConditionAgainstEvent(types []string, eventAction *string) bool
 type ScaleTarget struct {
 	v1alpha1.HorizontalRunnerAutoscaler
 	v1alpha1.ScaleUpTrigger
+
+	// WorkflowJobID is the ID of the workflow job that triggered the scale, if any.
+	// It's used to keep track of the capacity reservation for each job.
+	WorkflowJobID int64
 }
 
 func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) searchScaleTargets(hras []v1alpha1.HorizontalRunnerAutoscaler, f func(v1alpha1.ScaleUpTrigger) bool) []ScaleTarget {
@@ -655,7 +708,11 @@ func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) getJobScaleTarget(ctx
 
 	autoscaler.Log.V(1).Info(fmt.Sprintf("Found %d HRAs by key", len(hras)), "key", name)
 
-HRA:
+	var (
+		target            *ScaleTarget
+		targetExtraLabels int
+	)
+
 	for _, hra := range hras {
 		if !hra.ObjectMeta.DeletionTimestamp.IsZero() {
 			continue
@@ -681,6 +738,8 @@ HRA:
 			duration.Duration = 10 * time.Minute
 		}
 
+		var runnerLabels []string
+
 		switch hra.Spec.ScaleTargetRef.Kind {
 		case "RunnerSet":
 			var rs v1alpha1.RunnerSet
@@ -689,30 +748,7 @@ HRA:
 				return nil, err
 			}
 
-			// Ensure that the RunnerSet-managed runners have all the labels requested by the workflow_job.
-			for _, l := range labels {
-				var matched bool
-
-				// ignore "self-hosted" label as all instance here are self-hosted
-				if l == "self-hosted" {
-					continue
-				}
-
-				// TODO labels related to OS and architecture needs to be explicitly declared or the current implementation will not be able to find them.
-
-				for _, l2 := range rs.Spec.Labels {
-					if l == l2 {
-						matched = true
-						break
-					}
-				}
-
-				if !matched {
-					continue HRA
-				}
-			}
-
-			return &ScaleTarget{HorizontalRunnerAutoscaler: hra, ScaleUpTrigger: v1alpha1.ScaleUpTrigger{Duration: duration}}, nil
+			runnerLabels = rs.Spec.Labels
 		case "RunnerDeployment", "":
 			var rd v1alpha1.RunnerDeployment
 
@@ -720,36 +756,75 @@ HRA:
 				return nil, err
 			}
 
-			// Ensure that the RunnerDeployment-managed runners have all the labels requested by the workflow_job.
-			for _, l := range labels {
-				var matched bool
+			runnerLabels = rd.Spec.Template.Spec.Labels
+		default:
+			return nil, fmt.Errorf("unsupported scaleTargetRef.kind: %v", hra.Spec.ScaleTargetRef.Kind)
+		}
 
-				// ignore "self-hosted" label as all instance here are self-hosted
-				if l == "self-hosted" {
-					continue
-				}
+		// Ensure that the scale target's runners have all the labels requested by the workflow_job.
+		extra, ok := matchWorkflowJobLabels(labels, runnerLabels)
+		if !ok {
+			continue
+		}
 
-				// TODO labels related to OS and architecture needs to be explicitly declared or the current implementation will not be able to find them.
+		// Prefer the scale target whose runners have the fewest labels the workflow_job didn't request,
+		// so that e.g. a job that doesn't request the "gpu" label doesn't scale the pool of expensive GPU runners
+		// when there's a pool of general purpose runners that can run it.
+		if target == nil || extra < targetExtraLabels {
+			target = &ScaleTarget{HorizontalRunnerAutoscaler: hra, ScaleUpTrigger: v1alpha1.ScaleUpTrigger{Duration: duration}}
+			targetExtraLabels = extra
+		}
 
-				for _, l2 := range rd.Spec.Template.Spec.Labels {
-					if l == l2 {
-						matched = true
-						break
-					}
-				}
+		if extra == 0 {
+			break
+		}
+	}
 
-				if !matched {
-					continue HRA
-				}
+	if target != nil {
+		autoscaler.Log.V(1).Info("Found the scale target with the best matching runner labels", "key", name, "hra", target.HorizontalRunnerAutoscaler.Name, "labels", labels, "extraLabels", targetExtraLabels)
+	}
+
+	return target, nil
+}
+
+// matchWorkflowJobLabels returns true if the runners with runnerLabels have all the labels requested by the workflow_job,
+// along with the number of the runner labels the workflow_job didn't request.
+func matchWorkflowJobLabels(jobLabels, runnerLabels []string) (int, bool) {
+	requested := map[string]struct{}{}
+
+	for _, l := range jobLabels {
+		// ignore "self-hosted" label as all instance here are self-hosted
+		if l == "self-hosted" {
+			continue
+		}
+
+		// TODO labels related to OS and architecture needs to be explicitly declared or the current implementation will not be able to find them.
+
+		var matched bool
+
+		for _, l2 := range runnerLabels {
+			if l == l2 {
+				matched = true
+				break
 			}
+		}
 
-			return &ScaleTarget{HorizontalRunnerAutoscaler: hra, ScaleUpTrigger: v1alpha1.ScaleUpTrigger{Duration: duration}}, nil
-		default:
-			return nil, fmt.Errorf("unsupported scaleTargetRef.kind: %v", hra.Spec.ScaleTargetRef.Kind)
+		if !matched {
+			return 0, false
+		}
+
+		requested[l] = struct{}{}
+	}
+
+	var extra int
+
+	for _, l := range runnerLabels {
+		if _, ok := requested[l]; !ok {
+			extra++
 		}
 	}
 
-	return nil, nil
+	return extra, true
 }
 
 func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) tryScale(ctx context.Context, target *ScaleTarget) error {
@@ -767,7 +842,20 @@ func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) tryScale(ctx context.
 
 	capacityReservations := getValidCapacityReservations(copy)
 
-	if amount > 0 {
+	if target.WorkflowJobID != 0 {
+		reservations, changed := reserveCapacityForWorkflowJob(capacityReservations, target.WorkflowJobID, amount, time.Now(), target.ScaleUpTrigger.Duration.Duration)
+		if !changed {
+			autoscaler.Log.V(1).Info(
+				fmt.Sprintf("Skipped patching hra %s as the capacity reservation for the workflow job is up to date", target.HorizontalRunnerAutoscaler.Name),
+				"workflowJobID", target.WorkflowJobID,
+				"amount", amount,
+			)
+
+			return nil
+		}
+
+		copy.Spec.CapacityReservations = reservations
+	} else if amount > 0 {
 		now := time.Now()
 		copy.Spec.CapacityReservations = append(capacityReservations, v1alpha1.CapacityReservation{
 			EffectiveTime:  metav1.Time{Time: now},
@@ -809,6 +897,14 @@ func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) tryScale(ctx context.
 	return nil
 }
 
+func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) getDeliveryCache() *webhookDeliveryCache {
+	autoscaler.deliveryCacheOnce.Do(func() {
+		autoscaler.deliveryCache = newWebhookDeliveryCache(autoscaler.DeliveryCacheSize, autoscaler.DeliveryCacheTTL)
+	})
+
+	return autoscaler.deliveryCache
+}
+
 func getValidCapacityReservations(autoscaler *v1alpha1.HorizontalRunnerAutoscaler) []v1alpha1.CapacityReservation {
 	var capacityReservations []v1alpha1.CapacityReservation
 
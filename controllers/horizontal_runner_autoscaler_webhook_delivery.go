@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+)
+
+const (
+	// DefaultWebhookDeliveryCacheSize is the maximum number of webhook delivery IDs remembered for deduplication.
+	DefaultWebhookDeliveryCacheSize = 10000
+
+	// DefaultWebhookDeliveryCacheTTL is how long a webhook delivery ID is remembered for deduplication.
+	DefaultWebhookDeliveryCacheTTL = time.Hour
+
+	workflowJobCapacityReservationNamePrefix = "workflow-job-"
+)
+
+// webhookDeliveryCache remembers the IDs of webhook deliveries that have been processed,
+// so that redeliveries of the same event are not processed twice.
+type webhookDeliveryCache struct {
+	cache *ttlCache
+}
+
+func newWebhookDeliveryCache(size int, ttl time.Duration) *webhookDeliveryCache {
+	return &webhookDeliveryCache{cache: newWebhookTTLCache(size, ttl)}
+}
+
+// newWebhookTTLCache returns the cache sized with --webhook-delivery-cache-size and --webhook-delivery-cache-ttl,
+// defaulting to DefaultWebhookDeliveryCacheSize and DefaultWebhookDeliveryCacheTTL.
+func newWebhookTTLCache(size int, ttl time.Duration) *ttlCache {
+	if size <= 0 {
+		size = DefaultWebhookDeliveryCacheSize
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultWebhookDeliveryCacheTTL
+	}
+
+	return newTTLCache(size, ttl)
+}
+
+// seen tells if the delivery has already been processed within the TTL.
+func (c *webhookDeliveryCache) seen(id string, now time.Time) bool {
+	_, ok := c.cache.get(id, now)
+
+	return ok
+}
+
+// add records the delivery as processed.
+func (c *webhookDeliveryCache) add(id string, now time.Time) {
+	c.cache.add(id, struct{}{}, now)
+}
+
+func workflowJobCapacityReservationName(jobID int64) string {
+	return fmt.Sprintf("%s%d", workflowJobCapacityReservationNamePrefix, jobID)
+}
+
+// reserveCapacityForWorkflowJob returns the capacity reservations updated for the workflow job event
+// and whether it changed anything.
+//
+// Each workflow job is tracked by a capacity reservation named after the job ID, so that a duplicate queued event
+// doesn't add a second reservation for the same job, and a duplicate completed event doesn't remove a reservation
+// of another job.
+// A completed job leaves a reservation with zero replicas until it expires, so that a queued event
+// delivered after the completed event doesn't add a reservation for the already completed job.
+// As the reservations are stored in the HorizontalRunnerAutoscaler, this survives restarts of the webhook server.
+func reserveCapacityForWorkflowJob(reservations []v1alpha1.CapacityReservation, jobID int64, amount int, now time.Time, duration time.Duration) ([]v1alpha1.CapacityReservation, bool) {
+	name := workflowJobCapacityReservationName(jobID)
+
+	for i, r := range reservations {
+		if r.Name != name {
+			continue
+		}
+
+		if amount > 0 || r.Replicas == 0 {
+			// Either the job is already queued, or already completed.
+			return reservations, false
+		}
+
+		updated := append([]v1alpha1.CapacityReservation{}, reservations...)
+		updated[i] = v1alpha1.CapacityReservation{
+			Name:           name,
+			ExpirationTime: r.ExpirationTime,
+		}
+
+		return updated, true
+	}
+
+	if amount > 0 {
+		return append(reservations, v1alpha1.CapacityReservation{
+			Name:           name,
+			EffectiveTime:  metav1.Time{Time: now},
+			ExpirationTime: metav1.Time{Time: now.Add(duration)},
+			Replicas:       amount,
+		}), true
+	}
+
+	// The completed event came before the queued event, or the job was queued before the webhook server started
+	// tracking jobs by ID. In the latter case, we remove an unnamed reservation as we did before.
+	var updated []v1alpha1.CapacityReservation
+
+	var found bool
+
+	for _, r := range reservations {
+		if !found && r.Name == "" && r.Replicas+amount == 0 {
+			found = true
+		} else {
+			updated = append(updated, r)
+		}
+	}
+
+	return append(updated, v1alpha1.CapacityReservation{
+		Name:           name,
+		ExpirationTime: metav1.Time{Time: now.Add(duration)},
+	}), true
+}
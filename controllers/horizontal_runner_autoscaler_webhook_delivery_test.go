@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	actionsv1alpha1 "github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/google/go-github/v39/github"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestWebhookDeliveryCache(t *testing.T) {
+	now := time.Now()
+
+	c := newWebhookDeliveryCache(2, time.Minute)
+
+	c.add("a", now)
+	if !c.seen("a", now) {
+		t.Errorf("delivery a should have been seen")
+	}
+	if c.seen("b", now) {
+		t.Errorf("delivery b should not have been seen")
+	}
+
+	c.add("b", now)
+	c.add("c", now)
+	if c.seen("a", now) {
+		t.Errorf("delivery a should have been evicted as the cache is full")
+	}
+	if !c.seen("b", now) || !c.seen("c", now) {
+		t.Errorf("deliveries b and c should have been seen")
+	}
+
+	if c.seen("c", now.Add(time.Minute)) {
+		t.Errorf("delivery c should have been expired")
+	}
+}
+
+func TestWebhookWorkflowJob_Deliveries(t *testing.T) {
+	type delivery struct {
+		id     string
+		action string
+		jobID  int64
+	}
+
+	tests := []struct {
+		name       string
+		deliveries []delivery
+		want       int
+	}{
+		{
+			name: "redelivered queued event",
+			deliveries: []delivery{
+				{id: "1", action: "queued", jobID: 1},
+				{id: "1", action: "queued", jobID: 1},
+			},
+			want: 1,
+		},
+		{
+			name: "duplicate queued events",
+			deliveries: []delivery{
+				{id: "1", action: "queued", jobID: 1},
+				{id: "2", action: "queued", jobID: 1},
+			},
+			want: 1,
+		},
+		{
+			name: "duplicate completed events",
+			deliveries: []delivery{
+				{id: "1", action: "queued", jobID: 1},
+				{id: "2", action: "queued", jobID: 2},
+				{id: "3", action: "completed", jobID: 1},
+				{id: "4", action: "completed", jobID: 1},
+			},
+			want: 1,
+		},
+		{
+			name: "completed event before queued event",
+			deliveries: []delivery{
+				{id: "1", action: "completed", jobID: 1},
+				{id: "2", action: "queued", jobID: 1},
+			},
+			want: 0,
+		},
+		{
+			name: "completed event of unknown job",
+			deliveries: []delivery{
+				{id: "1", action: "queued", jobID: 1},
+				{id: "2", action: "completed", jobID: 2},
+				{id: "3", action: "completed", jobID: 1},
+			},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open("testdata/org_webhook_workflow_job_payload.json")
+			if err != nil {
+				t.Fatalf("could not open the fixture: %s", err)
+			}
+			defer f.Close()
+			var e github.WorkflowJobEvent
+			if err := json.NewDecoder(f).Decode(&e); err != nil {
+				t.Fatalf("invalid json: %s", err)
+			}
+
+			hra := &actionsv1alpha1.HorizontalRunnerAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-name",
+				},
+				Spec: actionsv1alpha1.HorizontalRunnerAutoscalerSpec{
+					ScaleTargetRef: actionsv1alpha1.ScaleTargetRef{
+						Name: "test-name",
+					},
+				},
+			}
+
+			rd := &actionsv1alpha1.RunnerDeployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-name",
+				},
+				Spec: actionsv1alpha1.RunnerDeploymentSpec{
+					Template: actionsv1alpha1.RunnerTemplate{
+						Spec: actionsv1alpha1.RunnerSpec{
+							RunnerConfig: actionsv1alpha1.RunnerConfig{
+								Organization: "MYORG",
+								Labels:       []string{"label1"},
+							},
+						},
+					},
+				},
+			}
+
+			client := fake.NewFakeClientWithScheme(sc, hra, rd)
+
+			hraWebhook := &HorizontalRunnerAutoscalerGitHubWebhook{Client: client}
+
+			logs := installTestLogger(hraWebhook)
+
+			defer func() {
+				if t.Failed() {
+					t.Logf("diagnostics: %s", logs.String())
+				}
+			}()
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/", hraWebhook.Handle)
+
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			for _, d := range tt.deliveries {
+				action := d.action
+				jobID := d.jobID
+				e.Action = &action
+				e.WorkflowJob.ID = &jobID
+
+				resp, err := sendWebhookWithDelivery(server, "workflow_job", d.id, &e)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("unexpected status of delivery %s: %d: %s", d.id, resp.StatusCode, body)
+				}
+			}
+
+			var got actionsv1alpha1.HorizontalRunnerAutoscaler
+			if err := client.Get(context.Background(), types.NamespacedName{Name: "test-name"}, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			var reserved int
+			for _, r := range getValidCapacityReservations(&got) {
+				reserved += r.Replicas
+			}
+
+			if reserved != tt.want {
+				t.Errorf("unexpected reserved replicas: got %d, want %d: %+v", reserved, tt.want, got.Spec.CapacityReservations)
+			}
+		})
+	}
+}
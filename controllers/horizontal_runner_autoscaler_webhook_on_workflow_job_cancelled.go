@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+)
+
+// UnregistrationReasonWorkflowCancelled is for runners recreated because the workflow job they were running has been cancelled.
+const UnregistrationReasonWorkflowCancelled UnregistrationReason = "workflow-cancelled"
+
+// workflowJobAssignment is the runner a workflow job has been assigned to.
+type workflowJobAssignment struct {
+	RunnerName string   `json:"runner_name,omitempty"`
+	Labels     []string `json:"labels,omitempty"`
+}
+
+// workflowJobAssignmentFromPayload extracts the runner assigned to the job from the workflow_job event payload.
+// go-github's WorkflowJob doesn't have the runner fields, so we parse them by ourselves.
+func workflowJobAssignmentFromPayload(payload []byte) (workflowJobAssignment, error) {
+	var e struct {
+		WorkflowJob workflowJobAssignment `json:"workflow_job"`
+	}
+
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return workflowJobAssignment{}, err
+	}
+
+	return e.WorkflowJob, nil
+}
+
+// workflowJobAssignmentCache remembers the runner each workflow job has been assigned to on the in_progress event,
+// so that the runner of a cancelled job can be found even when the completed event doesn't tell it.
+// It's bounded the same way as webhookDeliveryCache.
+type workflowJobAssignmentCache struct {
+	cache *ttlCache
+}
+
+func newWorkflowJobAssignmentCache(size int, ttl time.Duration) *workflowJobAssignmentCache {
+	return &workflowJobAssignmentCache{cache: newWebhookTTLCache(size, ttl)}
+}
+
+func (c *workflowJobAssignmentCache) add(jobID int64, a workflowJobAssignment, now time.Time) {
+	c.cache.add(jobID, a, now)
+}
+
+// pop returns the runner the job has been assigned to and forgets it, as the job is completed.
+func (c *workflowJobAssignmentCache) pop(jobID int64, now time.Time) (workflowJobAssignment, bool) {
+	v, ok := c.cache.pop(jobID, now)
+	if !ok {
+		return workflowJobAssignment{}, false
+	}
+
+	return v.(workflowJobAssignment), true
+}
+
+func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) getJobAssignmentCache() *workflowJobAssignmentCache {
+	autoscaler.jobAssignmentCacheOnce.Do(func() {
+		autoscaler.jobAssignmentCache = newWorkflowJobAssignmentCache(autoscaler.DeliveryCacheSize, autoscaler.DeliveryCacheTTL)
+	})
+
+	return autoscaler.jobAssignmentCache
+}
+
+// stopRunnerOfCancelledJob marks the pod of the runner the cancelled job has been assigned to for recycling,
+// so that the runner controller gracefully stops the runner once it's no longer busy and recreates the pod,
+// instead of waiting for GitHub to reclaim the runner.
+//
+// The runner is looked up by the name and must be in the scope of the event and have all the labels requested by the job,
+// so that a runner of another organization or another cluster with the same name isn't stopped.
+// Only runners managed by RunnerDeployments or Runners are supported, as RunnerSet runner pods aren't recycled.
+func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) stopRunnerOfCancelledJob(ctx context.Context, clock Clock, log logr.Logger, enterprise, owner, repo string, a workflowJobAssignment) error {
+	if a.RunnerName == "" {
+		log.V(1).Info("Skipped stopping the runner of the cancelled workflow job as it's unknown which runner the job was assigned to")
+
+		return nil
+	}
+
+	log = log.WithValues("runner", a.RunnerName)
+
+	var runners v1alpha1.RunnerList
+	if err := autoscaler.List(ctx, &runners, client.InNamespace(autoscaler.Namespace)); err != nil {
+		return err
+	}
+
+	for i := range runners.Items {
+		runner := &runners.Items[i]
+
+		if runner.Name != a.RunnerName || !runner.DeletionTimestamp.IsZero() || !runnerMatchesWorkflowJob(runner, enterprise, owner, repo, a.Labels) {
+			continue
+		}
+
+		var pod corev1.Pod
+		if err := autoscaler.Get(ctx, types.NamespacedName{Namespace: runner.Namespace, Name: runner.Name}, &pod); err != nil {
+			if kerrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+
+		if _, ok := getAnnotation(&pod, AnnotationKeyRecycle); ok || !pod.DeletionTimestamp.IsZero() {
+			log.V(1).Info("Runner pod of the cancelled workflow job is already being recycled or deleted", "namespace", pod.Namespace)
+
+			return nil
+		}
+
+		updated := pod.DeepCopy()
+		setAnnotation(updated, AnnotationKeyRecycle, formatUnregistrationTimestamp(clock.Now()))
+		setAnnotation(updated, AnnotationKeyUnregistrationReason, string(UnregistrationReasonWorkflowCancelled))
+
+		if err := autoscaler.Patch(ctx, updated, client.MergeFrom(&pod)); err != nil {
+			return fmt.Errorf("patching runner pod %s/%s to have %s annotation: %w", pod.Namespace, pod.Name, AnnotationKeyRecycle, err)
+		}
+
+		log.Info("Marked the runner pod of the cancelled workflow job for recycling", "namespace", pod.Namespace)
+
+		return nil
+	}
+
+	log.V(1).Info("Runner of the cancelled workflow job not found")
+
+	return nil
+}
+
+// runnerMatchesWorkflowJob returns true if the runner is in the scope of the workflow_job event and has all the labels the job requested.
+func runnerMatchesWorkflowJob(runner *v1alpha1.Runner, enterprise, owner, repo string, labels []string) bool {
+	switch {
+	case runner.Spec.Repository != "":
+		if !strings.EqualFold(runner.Spec.Repository, owner+"/"+repo) {
+			return false
+		}
+	case runner.Spec.Organization != "":
+		if !strings.EqualFold(runner.Spec.Organization, owner) {
+			return false
+		}
+	case runner.Spec.Enterprise != "":
+		if !strings.EqualFold(runner.Spec.Enterprise, enterprise) {
+			return false
+		}
+	default:
+		return false
+	}
+
+	for _, l := range labels {
+		// ignore "self-hosted" label as all instance here are self-hosted
+		if l == "self-hosted" {
+			continue
+		}
+
+		var matched bool
+
+		for _, l2 := range runner.Spec.Labels {
+			if strings.EqualFold(l, l2) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// handleWorkflowJobAssignment remembers the runner the job has been assigned to on the in_progress event,
+// and stops the runner once the job completed as cancelled.
+// It only logs errors, so that the runner failing to be stopped doesn't prevent the webhook server from scaling down.
+func (autoscaler *HorizontalRunnerAutoscalerGitHubWebhook) handleWorkflowJobAssignment(ctx context.Context, log logr.Logger, e *gogithub.WorkflowJobEvent, payload []byte, enterprise string) {
+	jobID := e.GetWorkflowJob().GetID()
+
+	switch e.GetAction() {
+	case "in_progress":
+		a, err := workflowJobAssignmentFromPayload(payload)
+		if err != nil {
+			log.Error(err, "could not parse webhook payload for extracting the runner assigned to the workflow job")
+			return
+		}
+
+		if a.RunnerName != "" {
+			autoscaler.getJobAssignmentCache().add(jobID, a, time.Now())
+		}
+	case "completed":
+		assigned, assignedOK := autoscaler.getJobAssignmentCache().pop(jobID, time.Now())
+
+		if e.GetWorkflowJob().GetConclusion() != "cancelled" {
+			return
+		}
+
+		a, err := workflowJobAssignmentFromPayload(payload)
+		if err != nil {
+			log.Error(err, "could not parse webhook payload for extracting the runner assigned to the workflow job")
+		}
+
+		if a.RunnerName == "" && assignedOK {
+			a = assigned
+		}
+
+		if len(a.Labels) == 0 {
+			a.Labels = e.GetWorkflowJob().Labels
+		}
+
+		if err := autoscaler.stopRunnerOfCancelledJob(ctx, realClock{}, log, enterprise, e.GetRepo().GetOwner().GetLogin(), e.GetRepo().GetName(), a); err != nil {
+			log.Error(err, "could not stop the runner of the cancelled workflow job", "runner", a.RunnerName)
+		}
+	}
+}
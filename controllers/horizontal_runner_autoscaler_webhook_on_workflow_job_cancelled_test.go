@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	actionsv1alpha1 "github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestWebhookWorkflowJob_Cancelled(t *testing.T) {
+	type delivery struct {
+		action     string
+		conclusion string
+		runnerName string
+	}
+
+	tests := []struct {
+		name         string
+		organization string
+		deliveries   []delivery
+		want         bool
+	}{
+		{
+			name:         "runner name captured at assignment",
+			organization: "MYORG",
+			deliveries: []delivery{
+				{action: "in_progress", runnerName: "example-runner"},
+				{action: "completed", conclusion: "cancelled"},
+			},
+			want: true,
+		},
+		{
+			name:         "runner name in completed event",
+			organization: "MYORG",
+			deliveries: []delivery{
+				{action: "completed", conclusion: "cancelled", runnerName: "example-runner"},
+			},
+			want: true,
+		},
+		{
+			name:         "successful job",
+			organization: "MYORG",
+			deliveries: []delivery{
+				{action: "in_progress", runnerName: "example-runner"},
+				{action: "completed", conclusion: "success", runnerName: "example-runner"},
+			},
+		},
+		{
+			name:         "runner of another organization",
+			organization: "OTHERORG",
+			deliveries: []delivery{
+				{action: "in_progress", runnerName: "example-runner"},
+				{action: "completed", conclusion: "cancelled", runnerName: "example-runner"},
+			},
+		},
+		{
+			name:         "unknown runner",
+			organization: "MYORG",
+			deliveries: []delivery{
+				{action: "completed", conclusion: "cancelled"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := ioutil.ReadFile("testdata/org_webhook_workflow_job_payload.json")
+			if err != nil {
+				t.Fatalf("could not open the fixture: %s", err)
+			}
+
+			runner := &actionsv1alpha1.Runner{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "example-runner",
+				},
+				Spec: actionsv1alpha1.RunnerSpec{
+					RunnerConfig: actionsv1alpha1.RunnerConfig{
+						Organization: tt.organization,
+						Labels:       []string{"label1"},
+					},
+				},
+			}
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "example-runner",
+				},
+			}
+
+			client := fake.NewFakeClientWithScheme(sc, runner, pod)
+
+			hraWebhook := &HorizontalRunnerAutoscalerGitHubWebhook{Client: client, StopRunnersOfCancelledJobs: true}
+
+			logs := installTestLogger(hraWebhook)
+
+			defer func() {
+				if t.Failed() {
+					t.Logf("diagnostics: %s", logs.String())
+				}
+			}()
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/", hraWebhook.Handle)
+
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			for _, d := range tt.deliveries {
+				var e map[string]interface{}
+				if err := json.Unmarshal(b, &e); err != nil {
+					t.Fatalf("invalid json: %s", err)
+				}
+
+				e["action"] = d.action
+				job := e["workflow_job"].(map[string]interface{})
+				job["status"] = d.action
+				if d.conclusion != "" {
+					job["conclusion"] = d.conclusion
+				}
+				if d.runnerName != "" {
+					job["runner_name"] = d.runnerName
+				}
+
+				resp, err := sendWebhook(server, "workflow_job", e)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("unexpected status of %s event: %d: %s", d.action, resp.StatusCode, body)
+				}
+			}
+
+			var got corev1.Pod
+			if err := client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "example-runner"}, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			_, recycled := getAnnotation(&got, AnnotationKeyRecycle)
+			if recycled != tt.want {
+				t.Errorf("unexpected %s annotation: got %v, want %v", AnnotationKeyRecycle, recycled, tt.want)
+			}
+
+			if tt.want && got.Annotations[AnnotationKeyUnregistrationReason] != string(UnregistrationReasonWorkflowCancelled) {
+				t.Errorf("unexpected %s annotation: %q", AnnotationKeyUnregistrationReason, got.Annotations[AnnotationKeyUnregistrationReason])
+			}
+		})
+	}
+}
+
+func TestWorkflowJobAssignmentCache(t *testing.T) {
+	now := time.Now()
+
+	c := newWorkflowJobAssignmentCache(1, time.Minute)
+
+	c.add(1, workflowJobAssignment{RunnerName: "a"}, now)
+	c.add(2, workflowJobAssignment{RunnerName: "b"}, now)
+
+	if _, ok := c.pop(1, now); ok {
+		t.Errorf("job 1 should have been evicted as the cache is full")
+	}
+
+	if a, ok := c.pop(2, now); !ok || a.RunnerName != "b" {
+		t.Errorf("unexpected assignment of job 2: %v, %v", a, ok)
+	}
+
+	if _, ok := c.pop(2, now); ok {
+		t.Errorf("job 2 should have been forgotten once popped")
+	}
+
+	c.add(3, workflowJobAssignment{RunnerName: "c"}, now)
+
+	if _, ok := c.pop(3, now.Add(time.Minute)); ok {
+		t.Errorf("job 3 should have been expired")
+	}
+}
@@ -392,6 +392,115 @@ func TestWebhookWorkflowJobWithSelfHostedLabel(t *testing.T) {
 	})
 }
 
+func TestWebhookWorkflowJobWithCapabilityLabels(t *testing.T) {
+	newPool := func(name string, labels ...string) []runtime.Object {
+		return []runtime.Object{
+			&actionsv1alpha1.HorizontalRunnerAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+				Spec: actionsv1alpha1.HorizontalRunnerAutoscalerSpec{
+					ScaleTargetRef: actionsv1alpha1.ScaleTargetRef{
+						Name: name,
+					},
+				},
+			},
+			&actionsv1alpha1.RunnerDeployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+				Spec: actionsv1alpha1.RunnerDeploymentSpec{
+					Template: actionsv1alpha1.RunnerTemplate{
+						Spec: actionsv1alpha1.RunnerSpec{
+							RunnerConfig: actionsv1alpha1.RunnerConfig{
+								Organization: "MYORG",
+								Labels:       labels,
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	var initObjs []runtime.Object
+	// The GPU pools are listed before the general purpose pool, so that they would be chosen if the first matching pool won.
+	initObjs = append(initObjs, newPool("a-gpu-highmem", "label1", "gpu", "highmem")...)
+	initObjs = append(initObjs, newPool("b-gpu", "label1", "gpu")...)
+	initObjs = append(initObjs, newPool("c-cpu", "label1")...)
+
+	tests := []struct {
+		labels   []string
+		wantBody string
+	}{
+		{
+			labels:   []string{"label1"},
+			wantBody: "scaled c-cpu by 1",
+		},
+		{
+			labels:   []string{"self-hosted", "label1"},
+			wantBody: "scaled c-cpu by 1",
+		},
+		{
+			labels:   []string{"label1", "gpu"},
+			wantBody: "scaled b-gpu by 1",
+		},
+		{
+			labels:   []string{"highmem", "gpu"},
+			wantBody: "scaled a-gpu-highmem by 1",
+		},
+		{
+			labels:   []string{"label1", "tpu"},
+			wantBody: "no horizontalrunnerautoscaler to scale for this github event",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v", tt.labels), func(t *testing.T) {
+			f, err := os.Open("testdata/org_webhook_workflow_job_payload.json")
+			if err != nil {
+				t.Fatalf("could not open the fixture: %s", err)
+			}
+			defer f.Close()
+			var e github.WorkflowJobEvent
+			if err := json.NewDecoder(f).Decode(&e); err != nil {
+				t.Fatalf("invalid json: %s", err)
+			}
+
+			e.WorkflowJob.Labels = tt.labels
+
+			testServerWithInitObjs(t,
+				"workflow_job",
+				&e,
+				200,
+				tt.wantBody,
+				initObjs,
+			)
+		})
+	}
+}
+
+func TestMatchWorkflowJobLabels(t *testing.T) {
+	tests := []struct {
+		jobLabels    []string
+		runnerLabels []string
+		wantExtra    int
+		wantOK       bool
+	}{
+		{jobLabels: []string{"self-hosted"}, runnerLabels: nil, wantExtra: 0, wantOK: true},
+		{jobLabels: []string{"gpu"}, runnerLabels: []string{"gpu", "highmem"}, wantExtra: 1, wantOK: true},
+		{jobLabels: []string{"self-hosted"}, runnerLabels: []string{"gpu"}, wantExtra: 1, wantOK: true},
+		{jobLabels: []string{"gpu", "highmem"}, runnerLabels: []string{"gpu"}, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		extra, ok := matchWorkflowJobLabels(tt.jobLabels, tt.runnerLabels)
+		if extra != tt.wantExtra || ok != tt.wantOK {
+			t.Errorf("matchWorkflowJobLabels(%v, %v) = %d, %v, want %d, %v", tt.jobLabels, tt.runnerLabels, extra, ok, tt.wantExtra, tt.wantOK)
+		}
+	}
+}
+
 func TestGetRequest(t *testing.T) {
 	hra := HorizontalRunnerAutoscalerGitHubWebhook{}
 	request, _ := http.NewRequest(http.MethodGet, "/", nil)
@@ -511,6 +620,10 @@ func testServer(t *testing.T, eventType string, event interface{}, wantCode int,
 }
 
 func sendWebhook(server *httptest.Server, eventType string, event interface{}) (*http.Response, error) {
+	return sendWebhookWithDelivery(server, eventType, "", event)
+}
+
+func sendWebhookWithDelivery(server *httptest.Server, eventType, delivery string, event interface{}) (*http.Response, error) {
 	jsonBuf := &bytes.Buffer{}
 	enc := json.NewEncoder(jsonBuf)
 	enc.SetIndent("  ", "")
@@ -536,6 +649,10 @@ func sendWebhook(server *httptest.Server, eventType string, event interface{}) (
 		Body: ioutil.NopCloser(bytes.NewBuffer(reqBody)),
 	}
 
+	if delivery != "" {
+		req.Header.Set("X-GitHub-Delivery", delivery)
+	}
+
 	return http.DefaultClient.Do(req)
 }
 
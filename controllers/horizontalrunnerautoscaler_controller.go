@@ -288,6 +288,12 @@ func (r *HorizontalRunnerAutoscalerReconciler) reconcile(ctx context.Context, re
 	if err != nil {
 		r.Recorder.Event(&hra, corev1.EventTypeNormal, "RunnerAutoscalingFailure", err.Error())
 
+		if delay, limited := rateLimitRetryDelay(err); limited {
+			log.Error(err, fmt.Sprintf("Could not compute replicas due to GitHub API rate limit. Retrying in %s to avoid excessive GitHub API calls", delay))
+
+			return ctrl.Result{RequeueAfter: delay}, nil
+		}
+
 		log.Error(err, "Could not compute replicas")
 
 		return ctrl.Result{}, err
@@ -320,6 +326,12 @@ func (r *HorizontalRunnerAutoscalerReconciler) reconcile(ctx context.Context, re
 			cacheDuration = 10 * time.Minute
 		}
 
+		// Requeue scheduled by RequeueAfter can happen a bit earlier, so we let the cache entry expire a bit earlier
+		// than the polling interval to not skip polling on the requeue.
+		if pollingInterval := workflowRunsPollingInterval(hra); pollingInterval > 0 && pollingInterval-time.Second < cacheDuration {
+			cacheDuration = pollingInterval - time.Second
+		}
+
 		updated.Status.CacheEntries = append(cacheEntries, v1alpha1.CacheEntry{
 			Key:            v1alpha1.CacheEntryKeyDesiredReplicas,
 			Value:          computedReplicas,
@@ -358,6 +370,10 @@ func (r *HorizontalRunnerAutoscalerReconciler) reconcile(ctx context.Context, re
 		}
 	}
 
+	if pollingInterval := workflowRunsPollingInterval(hra); pollingInterval > 0 {
+		return ctrl.Result{RequeueAfter: pollingInterval}, nil
+	}
+
 	return ctrl.Result{}, nil
 }
 
@@ -104,14 +104,13 @@ func SetupIntegrationTest(ctx2 context.Context) *testEnvironment {
 			Scheme:                      scheme.Scheme,
 			Log:                         logf.Log,
 			Recorder:                    mgr.GetEventRecorderFor("runnerreplicaset-controller"),
-			GitHubClient:                env.ghClient,
+			GitHubClient:                NewMultiGitHubClient(mgr.GetClient(), env.ghClient, github2.Config{}),
 			RunnerImage:                 "example/runner:test",
 			DockerImage:                 "example/docker:test",
 			Name:                        controllerName("runner"),
 			RegistrationRecheckInterval: time.Millisecond,
 			RegistrationRecheckJitter:   time.Millisecond,
-			UnregistrationTimeout:       1 * time.Second,
-			UnregistrationRetryDelay:    1 * time.Second,
+			GracefulStopConfig:          GracefulStopConfig{UnregistrationTimeout: 1 * time.Second, UnregistrationRetryDelay: 1 * time.Second},
 		}
 		err = runnerController.SetupWithManager(mgr)
 		Expect(err).NotTo(HaveOccurred(), "failed to setup runner controller")
@@ -121,7 +120,7 @@ func SetupIntegrationTest(ctx2 context.Context) *testEnvironment {
 			Scheme:       scheme.Scheme,
 			Log:          logf.Log,
 			Recorder:     mgr.GetEventRecorderFor("runnerreplicaset-controller"),
-			GitHubClient: env.ghClient,
+			GitHubClient: NewMultiGitHubClient(mgr.GetClient(), env.ghClient, github2.Config{}),
 			Name:         controllerName("runnerreplicaset"),
 		}
 		err = replicasetController.SetupWithManager(mgr)
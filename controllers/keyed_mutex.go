@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+)
+
+// keyedMutex provides a mutual exclusion lock per key.
+//
+// An entry for a key is created on the first Lock call and removed once no one holds or waits for the lock,
+// so the number of entries is bounded by the number of concurrent callers rather than the number of keys ever seen.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedMutexEntry
+}
+
+type keyedMutexEntry struct {
+	// ch is a channel with the buffer size of 1 that is used as a mutex that can be waited on with a context
+	ch chan struct{}
+
+	// refs is the number of callers holding or waiting for the lock
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{
+		locks: map[string]*keyedMutexEntry{},
+	}
+}
+
+// Lock blocks until it acquires the lock for the key, or the context is done.
+// On success, the caller must call the returned function to release the lock.
+func (m *keyedMutex) Lock(ctx context.Context, key string) (func(), error) {
+	m.mu.Lock()
+	e, ok := m.locks[key]
+	if !ok {
+		e = &keyedMutexEntry{ch: make(chan struct{}, 1)}
+		m.locks[key] = e
+	}
+	e.refs++
+	m.mu.Unlock()
+
+	select {
+	case e.ch <- struct{}{}:
+		var once sync.Once
+
+		return func() {
+			once.Do(func() {
+				<-e.ch
+				m.release(key, e)
+			})
+		}, nil
+	case <-ctx.Done():
+		m.release(key, e)
+
+		return nil, ctx.Err()
+	}
+}
+
+func (m *keyedMutex) release(key string, e *keyedMutexEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.refs--
+	if e.refs == 0 {
+		delete(m.locks, key)
+	}
+}
+
+// len returns the number of keys being locked or waited for.
+func (m *keyedMutex) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.locks)
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutex_SameKey(t *testing.T) {
+	m := newKeyedMutex()
+
+	var (
+		wg      sync.WaitGroup
+		running int32
+		overlap int32
+	)
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				unlock, err := m.Lock(context.Background(), "default/runner")
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+
+				if atomic.AddInt32(&running, 1) > 1 {
+					atomic.StoreInt32(&overlap, 1)
+				}
+				time.Sleep(10 * time.Microsecond)
+				atomic.AddInt32(&running, -1)
+
+				unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if overlap != 0 {
+		t.Error("two goroutines held the lock for the same key at the same time")
+	}
+
+	if n := m.len(); n != 0 {
+		t.Errorf("expected all the entries to be cleaned up, but got %d", n)
+	}
+}
+
+func TestKeyedMutex_DifferentKeys(t *testing.T) {
+	m := newKeyedMutex()
+
+	unlock1, err := m.Lock(context.Background(), "default/runner1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer unlock1()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	unlock2, err := m.Lock(ctx, "default/runner2")
+	if err != nil {
+		t.Fatalf("a lock for another key must not block: %v", err)
+	}
+	unlock2()
+
+	if n := m.len(); n != 1 {
+		t.Errorf("unexpected number of entries: %d", n)
+	}
+}
+
+func TestKeyedMutex_RespectsContext(t *testing.T) {
+	m := newKeyedMutex()
+
+	unlock, err := m.Lock(context.Background(), "default/runner")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := m.Lock(ctx, "default/runner"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	unlock()
+	// Calling the unlock function twice must not release the lock held by someone else
+	unlock()
+
+	if n := m.len(); n != 0 {
+		t.Errorf("expected all the entries to be cleaned up, but got %d", n)
+	}
+}
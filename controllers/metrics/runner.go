@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	runnerUnregistrationPhase  = "phase"
+	runnerUnregistrationReason = "reason"
+
+	scopeEnterprise   = "enterprise"
+	scopeOrganization = "organization"
+	scopeRepository   = "repository"
+
+	RunnerUnregistrationPhaseInProgress = "in_progress"
+	RunnerUnregistrationPhaseTimedOut   = "timed_out"
+	RunnerUnregistrationPhaseCompleted  = "completed"
+)
+
+var (
+	runnerMetrics = []prometheus.Collector{
+		runnersUnregistrationPhase,
+		githubAPIRateLimitDelaySeconds,
+		runnerUnregistrationAttempts,
+		runnerUnregistrationDurationSeconds,
+		ghostRunnersDetected,
+		ghostRunnersCleaned,
+		removeRunnerBusy,
+		runnersListCacheInvalidations,
+	}
+
+	runnerUnregistrationPhases = []string{
+		RunnerUnregistrationPhaseInProgress,
+		RunnerUnregistrationPhaseTimedOut,
+		RunnerUnregistrationPhaseCompleted,
+	}
+)
+
+var (
+	runnersUnregistrationPhase = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "arc_runners_unregistration_phase",
+			Help: "Number of runner pods currently in each phase of the graceful stop",
+		},
+		[]string{runnerUnregistrationPhase},
+	)
+	githubAPIRateLimitDelaySeconds = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "arc_github_api_rate_limit_delay_seconds_total",
+			Help: "Cumulative seconds reconciliations were delayed due to GitHub API rate limits",
+		},
+		[]string{scopeEnterprise, scopeOrganization, scopeRepository},
+	)
+	runnerUnregistrationAttempts = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "arc_runner_unregistration_attempts",
+			Help:    "Number of attempts it took to unregister each runner, including retries due to rate limits, network errors, and busy runners",
+			Buckets: []float64{1, 2, 3, 5, 10, 20, 50, 100},
+		},
+	)
+	runnerUnregistrationDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "arc_runner_unregistration_duration_seconds",
+			Help:    "Seconds each runner spent in the unregistration phase, from the start of the graceful stop to the completion of the unregistration",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+		},
+		[]string{runnerUnregistrationReason},
+	)
+	ghostRunnersDetected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "arc_ghost_runners_detected_total",
+			Help: "Number of offline runners found on GitHub that are managed by ARC but have no runner pod",
+		},
+		[]string{scopeEnterprise, scopeOrganization, scopeRepository},
+	)
+	ghostRunnersCleaned = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "arc_ghost_runners_cleaned_total",
+			Help: "Number of ghost runners removed from GitHub by ARC",
+		},
+		[]string{scopeEnterprise, scopeOrganization, scopeRepository},
+	)
+	removeRunnerBusy = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "arc_remove_runner_busy_total",
+			Help: "Number of RemoveRunner calls that GitHub refused with 422 as the runner was still running a job",
+		},
+		[]string{scopeEnterprise, scopeOrganization, scopeRepository},
+	)
+	runnersListCacheInvalidations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "arc_runners_list_cache_invalidations_total",
+			Help: "Number of cached ListRunners responses ARC invalidated as they repeatedly missed a runner seen registered before",
+		},
+		[]string{scopeEnterprise, scopeOrganization, scopeRepository},
+	)
+)
+
+// SetRunnersUnregistrationPhases sets the number of runner pods per unregistration phase.
+// counts must contain all the runner pods being stopped, as phases missing in counts are set to zero.
+func SetRunnersUnregistrationPhases(counts map[string]int) {
+	for _, phase := range runnerUnregistrationPhases {
+		runnersUnregistrationPhase.With(prometheus.Labels{runnerUnregistrationPhase: phase}).Set(float64(counts[phase]))
+	}
+}
+
+// AddGitHubAPIRateLimitDelay adds the delay of a reconciliation requeued due to GitHub API rate limits
+// to the cumulative delay of the runner scope.
+func AddGitHubAPIRateLimitDelay(enterprise, organization, repository string, delay time.Duration) {
+	githubAPIRateLimitDelaySeconds.With(prometheus.Labels{
+		scopeEnterprise:   enterprise,
+		scopeOrganization: organization,
+		scopeRepository:   repository,
+	}).Add(delay.Seconds())
+}
+
+// ObserveRunnerUnregistrationAttempts records the number of attempts it took to complete the unregistration of a runner.
+func ObserveRunnerUnregistrationAttempts(attempts int) {
+	runnerUnregistrationAttempts.Observe(float64(attempts))
+}
+
+// ObserveRunnerUnregistrationDuration records the time a runner stopped for the reason spent from the start to the completion of the unregistration.
+func ObserveRunnerUnregistrationDuration(reason string, d time.Duration) {
+	runnerUnregistrationDurationSeconds.With(prometheus.Labels{runnerUnregistrationReason: reason}).Observe(d.Seconds())
+}
+
+// IncGhostRunnersDetected counts a ghost runner newly found in the runner scope.
+func IncGhostRunnersDetected(enterprise, organization, repository string) {
+	ghostRunnersDetected.With(prometheus.Labels{
+		scopeEnterprise:   enterprise,
+		scopeOrganization: organization,
+		scopeRepository:   repository,
+	}).Inc()
+}
+
+// IncGhostRunnersCleaned counts a ghost runner removed from GitHub in the runner scope.
+func IncGhostRunnersCleaned(enterprise, organization, repository string) {
+	ghostRunnersCleaned.With(prometheus.Labels{
+		scopeEnterprise:   enterprise,
+		scopeOrganization: organization,
+		scopeRepository:   repository,
+	}).Inc()
+}
+
+// IncRemoveRunnerBusy counts a RemoveRunner call refused as the runner in the runner scope was busy.
+func IncRemoveRunnerBusy(enterprise, organization, repository string) {
+	removeRunnerBusy.With(prometheus.Labels{
+		scopeEnterprise:   enterprise,
+		scopeOrganization: organization,
+		scopeRepository:   repository,
+	}).Inc()
+}
+
+// IncRunnersListCacheInvalidations counts a forced invalidation of the cached list of runners in the runner scope.
+func IncRunnersListCacheInvalidations(enterprise, organization, repository string) {
+	runnersListCacheInvalidations.With(prometheus.Labels{
+		scopeEnterprise:   enterprise,
+		scopeOrganization: organization,
+		scopeRepository:   repository,
+	}).Inc()
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func findMetricFamily(t *testing.T, name string) *dto.MetricFamily {
+	t.Helper()
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range families {
+		if f.GetName() == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+func TestObserveRunnerUnregistrationDuration(t *testing.T) {
+	ObserveRunnerUnregistrationDuration("scale-down", 90*time.Second)
+
+	f := findMetricFamily(t, "arc_runner_unregistration_duration_seconds")
+	if f == nil {
+		t.Fatalf("expected arc_runner_unregistration_duration_seconds to be registered")
+	}
+
+	for _, m := range f.GetMetric() {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == runnerUnregistrationReason && l.GetValue() == "scale-down" && m.GetHistogram().GetSampleCount() > 0 {
+				return
+			}
+		}
+	}
+
+	t.Errorf("expected the observation for the scale-down reason: %v", f.GetMetric())
+}
+
+// The runner controller work queue metrics are provided by controller-runtime,
+// labeled with the name of the controller, which is the name of the work queue.
+func TestRunnerControllerWorkQueueMetrics(t *testing.T) {
+	q := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "runner-controller")
+	defer q.ShutDown()
+
+	q.Add("default/example")
+
+	f := findMetricFamily(t, "workqueue_depth")
+	if f == nil {
+		t.Fatalf("expected workqueue_depth to be registered")
+	}
+
+	for _, m := range f.GetMetric() {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == "name" && l.GetValue() == "runner-controller" && m.GetGauge().GetValue() == 1 {
+				return
+			}
+		}
+	}
+
+	t.Errorf("expected the depth of the runner-controller work queue: %v", f.GetMetric())
+}
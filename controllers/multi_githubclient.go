@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// The keys in the secret referenced by spec.githubAPICredentialsFrom.secretRef.
+	// Those are the same as the ones used in the controller-manager secret so that
+	// you can reuse the same secret layout for per-runner credentials.
+	secretKeyGitHubToken             = "github_token"
+	secretKeyGitHubAppID             = "github_app_id"
+	secretKeyGitHubAppInstallationID = "github_app_installation_id"
+	secretKeyGitHubAppPrivateKey     = "github_app_private_key"
+)
+
+const (
+	// credentialsFailureTTL is how long a failure to create or validate the client for the credentials in a secret is remembered,
+	// so that a broken secret doesn't result in a GitHub API call on every reconciliation of every runner using it.
+	credentialsFailureTTL = time.Minute
+
+	credentialsFailureCacheSize = 1000
+)
+
+// MultiGitHubClient provides the GitHub API client to be used for each runner.
+//
+// A runner uses the controller-wide default client unless it references its own credentials via
+// spec.githubAPICredentialsFrom, or its namespace has the secret named NamespaceCredentialsSecretName.
+// Clients for referenced credentials are created on demand and cached per
+// secret and the content of the secret, so that a rotated secret results in a new client.
+type MultiGitHubClient struct {
+	// NamespaceCredentialsSecretName is the name of the secret that provides the default GitHub API credentials
+	// for runners in the namespace of the secret.
+	// Runners in namespaces without the secret use the controller-wide default client.
+	// It's disabled when empty.
+	NamespaceCredentialsSecretName string
+
+	// mu guards clients. It's never held while creating or validating a client, so that a slow GitHub API call for one secret
+	// doesn't block the runners using other credentials.
+	mu sync.Mutex
+
+	client client.Client
+
+	githubClient *github.Client
+
+	// githubConfig is the controller-wide GitHub API client configuration.
+	// Everything but the credentials is inherited to clients created from referenced credentials.
+	githubConfig github.Config
+
+	// The key is the namespaced name of the secret, and the value is the client created from the secret.
+	clients map[types.NamespacedName]*credentialsClient
+
+	// failures remembers the errors of creating and validating the clients, keyed by credentialsFailureKey.
+	failures *ttlCache
+}
+
+type credentialsClient struct {
+	resourceVersion string
+	hash            string
+
+	// mu serializes the creation and the validations of the client for the secret.
+	mu     sync.Mutex
+	client *github.Client
+	// validScopes is the scopes the token scopes of the client have been validated for.
+	validScopes map[RunnerScope]bool
+}
+
+// credentialsFailureKey is the key of a failure to create or validate the client for the content of the secret and the runner scope.
+type credentialsFailureKey struct {
+	secret types.NamespacedName
+	hash   string
+	scope  RunnerScope
+}
+
+func NewMultiGitHubClient(client client.Client, githubClient *github.Client, githubConfig github.Config) *MultiGitHubClient {
+	return &MultiGitHubClient{
+		client:       client,
+		githubClient: githubClient,
+		githubConfig: githubConfig,
+		clients:      map[types.NamespacedName]*credentialsClient{},
+		failures:     newTTLCache(credentialsFailureCacheSize, credentialsFailureTTL),
+	}
+}
+
+// Default returns the controller-wide GitHub API client.
+func (c *MultiGitHubClient) Default() *github.Client {
+	return c.githubClient
+}
+
+// InitForRunner returns the GitHub API client to be used for registering and unregistering the runner.
+//
+// When the runner references its own credentials, the client is validated to have the token scopes required to
+// manage runners in the runner's scope before being returned for the first time.
+// Otherwise the namespace-wide credentials are used if NamespaceCredentialsSecretName is set and the secret exists in the runner's namespace.
+func (c *MultiGitHubClient) InitForRunner(ctx context.Context, r *v1alpha1.Runner) (*github.Client, error) {
+	if r.Spec.GitHubAPICredentialsFrom != nil && r.Spec.GitHubAPICredentialsFrom.SecretRef.Name != "" {
+		nsName := types.NamespacedName{
+			Namespace: r.Namespace,
+			Name:      r.Spec.GitHubAPICredentialsFrom.SecretRef.Name,
+		}
+
+		var secret corev1.Secret
+		if err := c.client.Get(ctx, nsName, &secret); err != nil {
+			return nil, fmt.Errorf("failed to get secret %s for github api credentials: %w", nsName, err)
+		}
+
+		return c.initForSecret(ctx, r, secret)
+	}
+
+	if c.NamespaceCredentialsSecretName != "" {
+		nsName := types.NamespacedName{
+			Namespace: r.Namespace,
+			Name:      c.NamespaceCredentialsSecretName,
+		}
+
+		var secret corev1.Secret
+		if err := c.client.Get(ctx, nsName, &secret); err == nil {
+			return c.initForSecret(ctx, r, secret)
+		} else if !kerrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get secret %s for namespace github api credentials: %w", nsName, err)
+		}
+	}
+
+	return c.githubClient, nil
+}
+
+// InitForRunnerSet returns the GitHub API client to be used for registering and unregistering the runners of the runnerset.
+// See InitForRunner for how the credentials are resolved.
+func (c *MultiGitHubClient) InitForRunnerSet(ctx context.Context, rs *v1alpha1.RunnerSet) (*github.Client, error) {
+	return c.InitForRunner(ctx, &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: rs.Namespace,
+		},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig: rs.Spec.RunnerConfig,
+		},
+	})
+}
+
+// DiscardRegistrationToken discards the registration tokens cached for the scope of the runner in the clients the runner may have used.
+//
+// Unlike InitForRunner, it neither reads the secrets nor creates or validates any client, so that it works even after the credentials
+// are gone, e.g. while the namespace is being deleted. A client that isn't cached has no token to discard anyway.
+func (c *MultiGitHubClient) DiscardRegistrationToken(r *v1alpha1.Runner) bool {
+	names := []string{c.NamespaceCredentialsSecretName}
+	if r.Spec.GitHubAPICredentialsFrom != nil {
+		names = append(names, r.Spec.GitHubAPICredentialsFrom.SecretRef.Name)
+	}
+
+	clients := []*github.Client{c.githubClient}
+
+	c.mu.Lock()
+	for _, name := range names {
+		if cached, ok := c.clients[types.NamespacedName{Namespace: r.Namespace, Name: name}]; ok && name != "" {
+			clients = append(clients, cached.client)
+		}
+	}
+	c.mu.Unlock()
+
+	var discarded bool
+
+	for _, cli := range clients {
+		if cli != nil && cli.DiscardRegistrationToken(r.Spec.Enterprise, r.Spec.Organization, r.Spec.Repository) {
+			discarded = true
+		}
+	}
+
+	return discarded
+}
+
+// initForSecret returns the client for the credentials in the secret, validated for the scope of the runner.
+//
+// The cached client is reused as long as the secret's resourceVersion is unchanged.
+// A changed resourceVersion invalidates the cached client only when the content of the secret has actually changed,
+// so that e.g. updating labels of the secret doesn't result in recreating and revalidating the client.
+// The client is validated once for each scope it's used for, and a failure is remembered for credentialsFailureTTL.
+func (c *MultiGitHubClient) initForSecret(ctx context.Context, r *v1alpha1.Runner, secret corev1.Secret) (*github.Client, error) {
+	nsName := types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
+
+	cached, replaced := c.credentialsClientFor(nsName, secret)
+	if replaced != nil {
+		replaced.close()
+	}
+
+	key := credentialsFailureKey{
+		secret: nsName,
+		hash:   cached.hash,
+		scope:  RunnerScope{Enterprise: r.Spec.Enterprise, Organization: r.Spec.Organization, Repository: r.Spec.Repository},
+	}
+
+	if err, ok := c.failures.get(key, time.Now()); ok {
+		return nil, err.(error)
+	}
+
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	if cached.validScopes[key.scope] {
+		return cached.client, nil
+	}
+
+	// Another reconciliation may have failed for the same key while we were waiting for the lock.
+	if err, ok := c.failures.get(key, time.Now()); ok {
+		return nil, err.(error)
+	}
+
+	if err := c.initCredentialsClient(ctx, cached, secret, key.scope); err != nil {
+		c.failures.add(key, err, time.Now())
+
+		return nil, err
+	}
+
+	return cached.client, nil
+}
+
+// credentialsClientFor returns the cache entry for the content of the secret, replacing the entry for the outdated content if any.
+// The replaced entry is returned as well, to be closed by the caller without holding c.mu.
+func (c *MultiGitHubClient) credentialsClientFor(nsName types.NamespacedName, secret corev1.Secret) (*credentialsClient, *credentialsClient) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.clients[nsName]
+	if ok && cached.resourceVersion == secret.ResourceVersion {
+		return cached, nil
+	}
+
+	hash := hashSecretData(secret.Data)
+
+	if ok && cached.hash == hash {
+		cached.resourceVersion = secret.ResourceVersion
+
+		return cached, nil
+	}
+
+	replaced := cached
+
+	cached = &credentialsClient{resourceVersion: secret.ResourceVersion, hash: hash, validScopes: map[RunnerScope]bool{}}
+
+	c.clients[nsName] = cached
+
+	return cached, replaced
+}
+
+// close closes the client of the entry, if any, so that e.g. its rate limit breaker is no longer reported to the metrics.
+func (cc *credentialsClient) close() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if cc.client != nil {
+		cc.client.Close()
+	}
+}
+
+// initCredentialsClient creates the client for the entry unless it's already created, and validates it for the scope.
+// Must be called with cached.mu held.
+func (c *MultiGitHubClient) initCredentialsClient(ctx context.Context, cached *credentialsClient, secret corev1.Secret, scope RunnerScope) error {
+	nsName := types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
+
+	if cached.client == nil {
+		conf, err := c.configFromSecret(secret)
+		if err != nil {
+			return fmt.Errorf("invalid github api credentials in secret %s: %w", nsName, err)
+		}
+
+		cli, err := conf.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create github api client from secret %s: %w", nsName, err)
+		}
+
+		cached.client = cli
+	}
+
+	if err := cached.client.ValidateTokenScopes(ctx, scope.Enterprise, scope.Organization, scope.Repository); err != nil {
+		return err
+	}
+
+	cached.validScopes[scope] = true
+
+	return nil
+}
+
+func (c *MultiGitHubClient) configFromSecret(secret corev1.Secret) (*github.Config, error) {
+	conf := github.Config{
+		EnterpriseURL:   c.githubConfig.EnterpriseURL,
+		URL:             c.githubConfig.URL,
+		UploadURL:       c.githubConfig.UploadURL,
+		RunnerGitHubURL: c.githubConfig.RunnerGitHubURL,
+		// Each credential has its own API rate limit, so the client gets its own request limiter with the same settings.
+		RequestsPerMinute:             c.githubConfig.RequestsPerMinute,
+		RequestsBurst:                 c.githubConfig.RequestsBurst,
+		OrganizationRequestsPerMinute: c.githubConfig.OrganizationRequestsPerMinute,
+		DisableRequestLimiterMetrics:  true,
+		DebugLog:                      c.githubConfig.DebugLog,
+		ListRunnersTimeout:            c.githubConfig.ListRunnersTimeout,
+		RemoveRunnerTimeout:           c.githubConfig.RemoveRunnerTimeout,
+		ProxyURL:                      c.githubConfig.ProxyURL,
+		NoProxy:                       c.githubConfig.NoProxy,
+		ListRunnersPath:               c.githubConfig.ListRunnersPath,
+		RemoveRunnerPath:              c.githubConfig.RemoveRunnerPath,
+		Transport:                     c.githubConfig.Transport,
+		Log:                           c.githubConfig.Log,
+	}
+
+	if token := string(secret.Data[secretKeyGitHubToken]); token != "" {
+		conf.Token = token
+
+		return &conf, nil
+	}
+
+	appID := string(secret.Data[secretKeyGitHubAppID])
+	if appID == "" {
+		return nil, fmt.Errorf("either %s or %s must be set", secretKeyGitHubToken, secretKeyGitHubAppID)
+	}
+
+	var err error
+
+	conf.AppID, err = strconv.ParseInt(appID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer: %w", secretKeyGitHubAppID, err)
+	}
+
+	conf.AppInstallationID, err = strconv.ParseInt(string(secret.Data[secretKeyGitHubAppInstallationID]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer: %w", secretKeyGitHubAppInstallationID, err)
+	}
+
+	conf.AppPrivateKey = string(secret.Data[secretKeyGitHubAppPrivateKey])
+
+	return &conf, nil
+}
+
+func hashSecretData(data map[string][]byte) string {
+	var keys []string
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%x;", k, data[k])
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
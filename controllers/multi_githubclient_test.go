@@ -0,0 +1,563 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestMultiGitHubClient_InitForRunner(t *testing.T) {
+	newRunner := func(secretName string) *v1alpha1.Runner {
+		r := &v1alpha1.Runner{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "test1",
+			},
+		}
+		r.Spec.Repository = "test/valid"
+		if secretName != "" {
+			r.Spec.GitHubAPICredentialsFrom = &v1alpha1.GitHubAPICredentialsFrom{
+				SecretRef: v1alpha1.SecretReference{Name: secretName},
+			}
+		}
+		return r
+	}
+
+	patSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "repo-pat",
+		},
+		Data: map[string][]byte{
+			"github_token": []byte("repo-pat"),
+		},
+	}
+
+	invalidSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "invalid",
+		},
+		Data: map[string][]byte{
+			"foo": []byte("bar"),
+		},
+	}
+
+	tests := []struct {
+		name                string
+		runner              *v1alpha1.Runner
+		scopes              string
+		wantDefault         bool
+		wantErr             bool
+		wantInsufficientErr bool
+		wantUnregistered    bool
+	}{
+		{
+			name:             "default client",
+			runner:           newRunner(""),
+			scopes:           "",
+			wantDefault:      true,
+			wantUnregistered: true,
+		},
+		{
+			name:             "pat-backed unregistration",
+			runner:           newRunner("repo-pat"),
+			scopes:           "repo, workflow",
+			wantUnregistered: true,
+		},
+		{
+			name:                "insufficient scopes",
+			runner:              newRunner("repo-pat"),
+			scopes:              "workflow",
+			wantErr:             true,
+			wantInsufficientErr: true,
+		},
+		{
+			name:    "missing secret",
+			runner:  newRunner("missing"),
+			wantErr: true,
+		},
+		{
+			name:    "invalid secret",
+			runner:  newRunner("invalid"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithOAuthScopes(tt.scopes),
+			)
+			defer server.Close()
+
+			defaultClient := newGithubClient(server)
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+
+			c := clientfake.NewFakeClientWithScheme(scheme, patSecret, invalidSecret)
+
+			multi := NewMultiGitHubClient(c, defaultClient, newGithubConfig(server))
+
+			ghc, err := multi.InitForRunner(context.Background(), tt.runner)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InitForRunner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantInsufficientErr {
+				var e *github.InsufficientTokenScopes
+				if !errors.As(err, &e) {
+					t.Errorf("InitForRunner() error = %v, want InsufficientTokenScopes", err)
+				}
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if (ghc == defaultClient) != tt.wantDefault {
+				t.Errorf("InitForRunner() returned the default client = %v, want %v", ghc == defaultClient, tt.wantDefault)
+			}
+
+			cached, err := multi.InitForRunner(context.Background(), tt.runner)
+			if err != nil {
+				t.Fatalf("InitForRunner() error on second call = %v", err)
+			}
+			if cached != ghc {
+				t.Errorf("InitForRunner() did not reuse the cached client for the unchanged secret")
+			}
+
+			unregistered, err := unregisterRunner(context.Background(), GracefulStopConfig{}, logr.Discard(), ghc, "", "", tt.runner.Spec.Repository, tt.runner.Name)
+			if err != nil {
+				t.Fatalf("unregisterRunner() error = %v", err)
+			}
+			if unregistered != tt.wantUnregistered {
+				t.Errorf("unregisterRunner() = %v, want %v", unregistered, tt.wantUnregistered)
+			}
+		})
+	}
+}
+
+func TestRunnerPodReconciler_GitHubClientFor(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithOAuthScopes("repo, workflow"),
+	)
+	defer server.Close()
+
+	defaultClient := newGithubClient(server)
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "repo-pat",
+		},
+		Data: map[string][]byte{
+			"github_token": []byte("repo-pat"),
+		},
+	}
+
+	runnerSet := &v1alpha1.RunnerSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "example-runnerset",
+		},
+		Spec: v1alpha1.RunnerSetSpec{
+			RunnerConfig: v1alpha1.RunnerConfig{
+				Repository: "test/valid",
+				GitHubAPICredentialsFrom: &v1alpha1.GitHubAPICredentialsFrom{
+					SecretRef: v1alpha1.SecretReference{Name: "repo-pat"},
+				},
+			},
+		},
+	}
+
+	newPod := func(runnerSetName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      runnerSetName + "-0",
+				Labels:    map[string]string{LabelKeyRunnerSetName: runnerSetName},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "runner", Env: []corev1.EnvVar{{Name: EnvVarRepo, Value: "test/valid"}}}},
+			},
+		}
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(secret, runnerSet).Build()
+
+	r := &RunnerPodReconciler{
+		Client:       c,
+		GitHubClient: NewMultiGitHubClient(c, defaultClient, newGithubConfig(server)),
+	}
+
+	ctx := context.Background()
+
+	ghc, err := r.gitHubClientFor(ctx, newPod(runnerSet.Name))
+	if err != nil {
+		t.Fatalf("gitHubClientFor() error = %v", err)
+	}
+	if ghc == defaultClient {
+		t.Errorf("gitHubClientFor() returned the default client for the pod of the runnerset with its own credentials")
+	}
+
+	ghc, err = r.gitHubClientFor(ctx, newPod("deleted-runnerset"))
+	if err != nil {
+		t.Fatalf("gitHubClientFor() error = %v", err)
+	}
+	if ghc != defaultClient {
+		t.Errorf("gitHubClientFor() did not return the default client for the pod of the deleted runnerset")
+	}
+}
+
+func TestMultiGitHubClient_InitForRunner_NamespaceCredentials(t *testing.T) {
+	newSecret := func(namespace, token string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      "github-api-credentials",
+			},
+			Data: map[string][]byte{
+				"github_token": []byte(token),
+			},
+		}
+	}
+
+	newRunner := func(namespace string) *v1alpha1.Runner {
+		r := &v1alpha1.Runner{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      "test1",
+			},
+		}
+		r.Spec.Repository = "test/valid"
+		return r
+	}
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithOAuthScopes("repo"),
+	)
+	defer server.Close()
+
+	defaultClient := newGithubClient(server)
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newSecret("tenant-a", "pat-a"),
+		newSecret("tenant-b", "pat-b"),
+	).Build()
+
+	multi := NewMultiGitHubClient(c, defaultClient, newGithubConfig(server))
+	multi.NamespaceCredentialsSecretName = "github-api-credentials"
+
+	ctx := context.Background()
+
+	initForRunner := func(t *testing.T, namespace string) *github.Client {
+		t.Helper()
+
+		ghc, err := multi.InitForRunner(ctx, newRunner(namespace))
+		if err != nil {
+			t.Fatalf("InitForRunner() error = %v", err)
+		}
+		return ghc
+	}
+
+	a := initForRunner(t, "tenant-a")
+	b := initForRunner(t, "tenant-b")
+
+	if a == defaultClient || b == defaultClient {
+		t.Fatalf("InitForRunner() returned the default client for a namespace with its own credentials")
+	}
+	if a == b {
+		t.Fatalf("InitForRunner() returned the same client for namespaces with distinct credentials")
+	}
+
+	if ghc := initForRunner(t, "tenant-c"); ghc != defaultClient {
+		t.Errorf("InitForRunner() did not return the default client for a namespace without credentials")
+	}
+
+	if ghc := initForRunner(t, "tenant-a"); ghc != a {
+		t.Errorf("InitForRunner() did not reuse the cached client for the unchanged secret")
+	}
+
+	var secret corev1.Secret
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "tenant-a", Name: "github-api-credentials"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+
+	secret.Labels = map[string]string{"foo": "bar"}
+	if err := c.Update(ctx, &secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if ghc := initForRunner(t, "tenant-a"); ghc != a {
+		t.Errorf("InitForRunner() recreated the client for the secret whose content is unchanged")
+	}
+
+	secret.Data["github_token"] = []byte("rotated-pat-a")
+	if err := c.Update(ctx, &secret); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := initForRunner(t, "tenant-a")
+	if rotated == a {
+		t.Errorf("InitForRunner() did not invalidate the cached client for the rotated secret")
+	}
+
+	if ghc := initForRunner(t, "tenant-b"); ghc != b {
+		t.Errorf("InitForRunner() invalidated the cached client for the other namespace")
+	}
+}
+
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestMultiGitHubClient_InitForRunner_InheritsTransport(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithOAuthScopes("repo"),
+	)
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "repo-pat",
+		},
+		Data: map[string][]byte{
+			"github_token": []byte("repo-pat"),
+		},
+	}).Build()
+
+	transport := &countingTransport{}
+
+	conf := newGithubConfig(server)
+	conf.Transport = transport
+
+	multi := NewMultiGitHubClient(c, newGithubClient(server), conf)
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+	}
+	runner.Spec.Repository = "test/valid"
+	runner.Spec.GitHubAPICredentialsFrom = &v1alpha1.GitHubAPICredentialsFrom{
+		SecretRef: v1alpha1.SecretReference{Name: "repo-pat"},
+	}
+
+	ghc, err := multi.InitForRunner(context.Background(), runner)
+	if err != nil {
+		t.Fatalf("InitForRunner() error = %v", err)
+	}
+
+	if _, err := ghc.ListRunners(context.Background(), "", "", "test/valid"); err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&transport.requests) == 0 {
+		t.Errorf("expected the client for the secret to make GitHub API calls via the configured transport")
+	}
+}
+
+func TestMultiGitHubClient_InitForRunner_ValidatesEachScope(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithOAuthScopes("repo"),
+	)
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "repo-pat",
+		},
+		Data: map[string][]byte{
+			"github_token": []byte("repo-pat"),
+		},
+	}).Build()
+
+	transport := &countingTransport{}
+
+	conf := newGithubConfig(server)
+	conf.Transport = transport
+
+	multi := NewMultiGitHubClient(c, newGithubClient(server), conf)
+
+	newRunner := func(spec v1alpha1.RunnerConfig) *v1alpha1.Runner {
+		spec.GitHubAPICredentialsFrom = &v1alpha1.GitHubAPICredentialsFrom{
+			SecretRef: v1alpha1.SecretReference{Name: "repo-pat"},
+		}
+
+		return &v1alpha1.Runner{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "test1",
+			},
+			Spec: v1alpha1.RunnerSpec{RunnerConfig: spec},
+		}
+	}
+
+	repoRunner := newRunner(v1alpha1.RunnerConfig{Repository: "test/valid"})
+	orgRunner := newRunner(v1alpha1.RunnerConfig{Organization: "test"})
+
+	ctx := context.Background()
+
+	if _, err := multi.InitForRunner(ctx, repoRunner); err != nil {
+		t.Fatalf("InitForRunner() error = %v", err)
+	}
+
+	// The client validated for the repository must still be validated for the organization, which requires admin:org.
+	_, err := multi.InitForRunner(ctx, orgRunner)
+
+	var e *github.InsufficientTokenScopes
+	if !errors.As(err, &e) {
+		t.Fatalf("InitForRunner() error = %v, want InsufficientTokenScopes", err)
+	}
+
+	requests := atomic.LoadInt32(&transport.requests)
+
+	if _, err := multi.InitForRunner(ctx, orgRunner); !errors.As(err, &e) {
+		t.Errorf("InitForRunner() error on second call = %v, want InsufficientTokenScopes", err)
+	}
+
+	if _, err := multi.InitForRunner(ctx, repoRunner); err != nil {
+		t.Errorf("InitForRunner() error on second call = %v", err)
+	}
+
+	if got := atomic.LoadInt32(&transport.requests); got != requests {
+		t.Errorf("expected the validation results to be cached, got %d more GitHub API calls", got-requests)
+	}
+}
+
+func TestMultiGitHubClient_InitForRunner_ClosesReplacedClient(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+
+	// Every response tells that the rate limit of the credentials is exhausted, which opens the breaker of the client.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		fmt.Fprint(w, `{"resources": {}}`)
+	}))
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "repo-pat",
+		},
+		Data: map[string][]byte{
+			"github_token": []byte("repo-pat"),
+		},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build()
+
+	multi := NewMultiGitHubClient(c, newGithubClient(server), newGithubConfig(server))
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig: v1alpha1.RunnerConfig{
+				Repository: "test/valid",
+				GitHubAPICredentialsFrom: &v1alpha1.GitHubAPICredentialsFrom{
+					SecretRef: v1alpha1.SecretReference{Name: "repo-pat"},
+				},
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	before := gatherRateLimitBreakerOpen(t)
+
+	if _, err := multi.InitForRunner(ctx, runner); err != nil {
+		t.Fatalf("InitForRunner() error = %v", err)
+	}
+
+	if got := gatherRateLimitBreakerOpen(t); got != before+1 {
+		t.Fatalf("expected the breaker of the client to be open, got %v open breakers, want %v", got, before+1)
+	}
+
+	// Rotating the token replaces the client, whose open breaker must no longer be counted.
+	var updated corev1.Secret
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "repo-pat"}, &updated); err != nil {
+		t.Fatal(err)
+	}
+	updated.Data["github_token"] = []byte("rotated-repo-pat")
+	if err := c.Update(ctx, &updated); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := multi.InitForRunner(ctx, runner); err != nil {
+		t.Fatalf("InitForRunner() error = %v", err)
+	}
+
+	if got := gatherRateLimitBreakerOpen(t); got != before+1 {
+		t.Errorf("expected only the breaker of the new client to be counted, got %v open breakers, want %v", got, before+1)
+	}
+}
+
+func gatherRateLimitBreakerOpen(t *testing.T) float64 {
+	t.Helper()
+
+	families, err := ctrlmetrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range families {
+		if f.GetName() == "github_rate_limit_breaker_open" {
+			return f.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/controllers/metrics"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const DefaultOfflineRunnerCleanupInterval = 1 * time.Minute
+
+// errRunnerBusyDeferred is returned by unregisterRunner instead of the RemoveRunner error for a busy runner,
+// when the inline unregistration is disabled.
+var errRunnerBusyDeferred = errors.New("runner is still running a job")
+
+// deferringRunnerAPI makes unregisterRunner skip RemoveRunner, leaving the removal of the runner from GitHub to OfflineRunnerCleaner.
+// unregisterRunner still lists runners to see if the runner is busy, which is usually served from the cache.
+type deferringRunnerAPI struct {
+	github.RunnerAPI
+}
+
+// withInlineUnregistrationDisabled returns the RunnerAPI to be used for unregistering runners,
+// which never removes runners from GitHub when disabled is true.
+func withInlineUnregistrationDisabled(api github.RunnerAPI, disabled bool) github.RunnerAPI {
+	if !disabled {
+		return api
+	}
+
+	return &deferringRunnerAPI{RunnerAPI: api}
+}
+
+// OfflineRunnerCleaner periodically removes offline runners that ARC no longer runs from GitHub, in batch.
+// It's used along with --disable-inline-unregistration, so that the reconcilers don't wait for RemoveRunner calls
+// while the runners are eventually removed from GitHub.
+//
+// A runner on GitHub is considered to be managed by ARC when its name starts with the name of a RunnerDeployment,
+// a RunnerReplicaSet, or a RunnerSet followed by a hyphen. Such a runner is removed once it's offline and not busy,
+// unless it has a runner pod that hasn't completed the graceful stop or a Runner that isn't being deleted.
+// Runners created by standalone Runners are left to GitHub, which removes offline self-hosted runners on its own after a while.
+//
+// Such runners are called ghost runners, as they are often left behind by runner pods that disappeared without the graceful stop,
+// e.g. on node crashes. With GracePeriod, it can also be used without --disable-inline-unregistration only to clean up ghost runners.
+type OfflineRunnerCleaner struct {
+	Client       client.Reader
+	GitHubClient *MultiGitHubClient
+	Log          logr.Logger
+
+	Interval time.Duration
+
+	// GracePeriod is how long a runner needs to stay a ghost before being removed, counted from when the cleaner first found it.
+	// Zero removes ghost runners as soon as they are found.
+	GracePeriod time.Duration
+
+	// firstSeen records when the cleaner first found each ghost runner, keyed by the scope and the runner name.
+	firstSeen map[string]time.Time
+}
+
+// Start implements manager.Runnable.
+func (c *OfflineRunnerCleaner) Start(ctx context.Context) error {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultOfflineRunnerCleanupInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.cleanup(ctx); err != nil {
+			c.Log.Error(err, "Failed to clean up offline runners")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// offlineRunnerCleanupScope is the enterprise, organization, or repository to list runners to clean up.
+type offlineRunnerCleanupScope struct {
+	Enterprise, Organization, Repository string
+
+	Client github.RunnerAPI
+}
+
+func (s offlineRunnerCleanupScope) key() string {
+	return s.Enterprise + "/" + s.Organization + "/" + s.Repository
+}
+
+// staleRunnerSelector tells if a runner on GitHub is stale, based on the runner resources and pods in the cluster.
+type staleRunnerSelector struct {
+	// namePrefixes are the prefixes of the names of the runners managed by ARC.
+	namePrefixes []string
+	// inUse holds the names of the runners that may still come back online.
+	inUse map[string]struct{}
+}
+
+func (s staleRunnerSelector) isStale(runner *gogithub.Runner) bool {
+	if runner.GetStatus() != "offline" || runner.GetBusy() {
+		return false
+	}
+
+	name := runner.GetName()
+
+	if _, ok := s.inUse[name]; ok {
+		return false
+	}
+
+	for _, p := range s.namePrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectStaleRunners returns the runners that are safe to remove from GitHub.
+func (s staleRunnerSelector) selectStaleRunners(runners []*gogithub.Runner) []*gogithub.Runner {
+	var stale []*gogithub.Runner
+
+	for _, r := range runners {
+		if s.isStale(r) {
+			stale = append(stale, r)
+		}
+	}
+
+	return stale
+}
+
+func (c *OfflineRunnerCleaner) cleanup(ctx context.Context) error {
+	selector, scopes, err := c.collect(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	seen := map[string]struct{}{}
+
+	for _, scope := range scopes {
+		log := c.Log.WithValues("enterprise", scope.Enterprise, "organization", scope.Organization, "repository", scope.Repository)
+
+		runners, err := scope.Client.ListRunners(ctx, scope.Enterprise, scope.Organization, scope.Repository)
+		if err != nil {
+			log.Error(err, "Failed to list runners to clean up")
+
+			// Keep counting the grace period of the ghost runners found earlier in the scope.
+			for key := range c.firstSeen {
+				if strings.HasPrefix(key, scope.key()+"/") {
+					seen[key] = struct{}{}
+				}
+			}
+
+			continue
+		}
+
+		stale := c.selectRemovableRunners(scope, selector.selectStaleRunners(runners), now, seen)
+
+		var removed int
+
+		for _, r := range stale {
+			if err := scope.Client.RemoveRunner(ctx, scope.Enterprise, scope.Organization, scope.Repository, r.GetID()); err != nil {
+				log.Error(err, "Failed to remove offline runner", "runner", r.GetName(), "runnerID", r.GetID())
+				continue
+			}
+
+			metrics.IncGhostRunnersCleaned(scope.Enterprise, scope.Organization, scope.Repository)
+
+			removed++
+		}
+
+		if len(stale) > 0 {
+			log.Info("Removed offline runners", "removed", removed, "stale", len(stale))
+		}
+	}
+
+	// Forget the runners that are no longer ghosts, so that they get the full grace period if they become ghosts again.
+	for key := range c.firstSeen {
+		if _, ok := seen[key]; !ok {
+			delete(c.firstSeen, key)
+		}
+	}
+
+	return nil
+}
+
+// selectRemovableRunners records the ghost runners of the scope as seen and returns the ones that have been ghosts for longer than the grace period.
+func (c *OfflineRunnerCleaner) selectRemovableRunners(scope offlineRunnerCleanupScope, ghosts []*gogithub.Runner, now time.Time, seen map[string]struct{}) []*gogithub.Runner {
+	if c.firstSeen == nil {
+		c.firstSeen = map[string]time.Time{}
+	}
+
+	var removable []*gogithub.Runner
+
+	for _, r := range ghosts {
+		key := scope.key() + "/" + r.GetName()
+
+		seen[key] = struct{}{}
+
+		first, ok := c.firstSeen[key]
+		if !ok {
+			first = now
+			c.firstSeen[key] = first
+
+			metrics.IncGhostRunnersDetected(scope.Enterprise, scope.Organization, scope.Repository)
+		}
+
+		if now.Sub(first) >= c.GracePeriod {
+			removable = append(removable, r)
+		}
+	}
+
+	return removable
+}
+
+// collect returns the selector for stale runners and the scopes to list runners, from the resources in the cluster.
+func (c *OfflineRunnerCleaner) collect(ctx context.Context) (staleRunnerSelector, []offlineRunnerCleanupScope, error) {
+	selector := staleRunnerSelector{inUse: map[string]struct{}{}}
+
+	var (
+		scopes []offlineRunnerCleanupScope
+		seen   = map[string]struct{}{}
+	)
+
+	addScope := func(s offlineRunnerCleanupScope) {
+		if _, ok := seen[s.key()]; ok {
+			return
+		}
+		seen[s.key()] = struct{}{}
+		scopes = append(scopes, s)
+	}
+
+	var rds v1alpha1.RunnerDeploymentList
+	if err := c.Client.List(ctx, &rds); err != nil {
+		return selector, nil, err
+	}
+
+	for _, rd := range rds.Items {
+		selector.namePrefixes = append(selector.namePrefixes, rd.Name+"-")
+	}
+
+	var rss v1alpha1.RunnerReplicaSetList
+	if err := c.Client.List(ctx, &rss); err != nil {
+		return selector, nil, err
+	}
+
+	for _, rs := range rss.Items {
+		selector.namePrefixes = append(selector.namePrefixes, rs.Name+"-")
+	}
+
+	var runnerSets v1alpha1.RunnerSetList
+	if err := c.Client.List(ctx, &runnerSets); err != nil {
+		return selector, nil, err
+	}
+
+	for _, rs := range runnerSets.Items {
+		selector.namePrefixes = append(selector.namePrefixes, rs.Name+"-")
+
+		addScope(offlineRunnerCleanupScope{
+			Enterprise:   rs.Spec.Enterprise,
+			Organization: rs.Spec.Organization,
+			Repository:   rs.Spec.Repository,
+			Client:       c.GitHubClient.Default(),
+		})
+	}
+
+	var runners v1alpha1.RunnerList
+	if err := c.Client.List(ctx, &runners); err != nil {
+		return selector, nil, err
+	}
+
+	for i := range runners.Items {
+		runner := &runners.Items[i]
+
+		if runner.DeletionTimestamp.IsZero() {
+			selector.inUse[runner.Name] = struct{}{}
+		}
+
+		ghc, err := c.GitHubClient.InitForRunner(ctx, runner)
+		if err != nil {
+			c.Log.Error(err, "Failed to initialize GitHub API client to clean up offline runners", "runner", runner.Name)
+			continue
+		}
+
+		addScope(offlineRunnerCleanupScope{
+			Enterprise:   runner.Spec.Enterprise,
+			Organization: runner.Spec.Organization,
+			Repository:   runner.Spec.Repository,
+			Client:       ghc,
+		})
+	}
+
+	var pods corev1.PodList
+	if err := c.Client.List(ctx, &pods); err != nil {
+		return selector, nil, err
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+
+		if _, ok := getAnnotation(pod, unregistrationCompleteTimestamp()); ok {
+			continue
+		}
+
+		selector.inUse[pod.Name] = struct{}{}
+	}
+
+	return selector, scopes, nil
+}
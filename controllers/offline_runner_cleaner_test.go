@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStaleRunnerSelector_SelectStaleRunners(t *testing.T) {
+	runner := func(name, status string, busy bool) *gogithub.Runner {
+		return &gogithub.Runner{Name: gogithub.String(name), Status: gogithub.String(status), Busy: gogithub.Bool(busy)}
+	}
+
+	s := staleRunnerSelector{
+		namePrefixes: []string{"example-", "example-runnerset-"},
+		inUse: map[string]struct{}{
+			"example-running": {},
+		},
+	}
+
+	got := s.selectStaleRunners([]*gogithub.Runner{
+		runner("example-stopped", "offline", false),
+		runner("example-online", "online", false),
+		runner("example-busy", "offline", true),
+		runner("example-running", "offline", false),
+		runner("example-runnerset-0", "offline", false),
+		runner("unmanaged", "offline", false),
+		runner("example", "offline", false),
+	})
+
+	var names []string
+	for _, r := range got {
+		names = append(names, r.GetName())
+	}
+
+	want := []string{"example-stopped", "example-runnerset-0"}
+
+	if d := cmp.Diff(want, names); d != "" {
+		t.Errorf("unexpected stale runners (-want +got):\n%s", d)
+	}
+}
+
+func TestOfflineRunnerCleaner_Cleanup(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, `
+{
+  "total_count": 4,
+  "runners": [
+    {"id": 2, "name": "example-abcde-running", "os": "linux", "status": "offline", "busy": false},
+    {"id": 1, "name": "example-abcde-stopped", "os": "linux", "status": "offline", "busy": false},
+    {"id": 3, "name": "example-abcde-online", "os": "linux", "status": "online", "busy": false},
+    {"id": 4, "name": "unmanaged", "os": "linux", "status": "offline", "busy": false}
+  ]
+}
+`),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	spec := v1alpha1.RunnerSpec{
+		RunnerConfig: v1alpha1.RunnerConfig{
+			Repository: "test/valid",
+		},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1alpha1.RunnerReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-abcde"},
+		},
+		&v1alpha1.Runner{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-abcde-running"},
+			Spec:       spec,
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-abcde-running"},
+		},
+	).Build()
+
+	cleaner := &OfflineRunnerCleaner{
+		Client:       c,
+		GitHubClient: NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+		Log:          logr.Discard(),
+	}
+
+	if err := cleaner.cleanup(context.Background()); err != nil {
+		t.Fatalf("cleanup() error = %v", err)
+	}
+
+	var paths []string
+	for _, call := range removeRunner.Calls() {
+		paths = append(paths, call.Path)
+	}
+
+	want := []string{"/repos/test/valid/actions/runners/1"}
+
+	if d := cmp.Diff(want, paths); d != "" {
+		t.Errorf("unexpected remove runner calls (-want +got):\n%s", d)
+	}
+}
+
+func TestOfflineRunnerCleaner_GhostRunnerGracePeriod(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, `
+{
+  "total_count": 2,
+  "runners": [
+    {"id": 1, "name": "example-abcde-ghost", "os": "linux", "status": "offline", "busy": false},
+    {"id": 2, "name": "example-abcde-running", "os": "linux", "status": "offline", "busy": false}
+  ]
+}
+`),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1alpha1.RunnerReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-abcde"},
+		},
+		&v1alpha1.Runner{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-abcde-running"},
+			Spec: v1alpha1.RunnerSpec{
+				RunnerConfig: v1alpha1.RunnerConfig{
+					Repository: "test/valid",
+				},
+			},
+		},
+	).Build()
+
+	cleaner := &OfflineRunnerCleaner{
+		Client:       c,
+		GitHubClient: NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+		Log:          logr.Discard(),
+		GracePeriod:  time.Hour,
+	}
+
+	gather := func(name string) float64 {
+		return gatherScopeCounter(t, name, "", "", "test/valid")
+	}
+
+	detected, cleaned := gather("arc_ghost_runners_detected_total"), gather("arc_ghost_runners_cleaned_total")
+
+	if err := cleaner.cleanup(context.Background()); err != nil {
+		t.Fatalf("cleanup() error = %v", err)
+	}
+
+	if n := len(removeRunner.Calls()); n != 0 {
+		t.Errorf("ghost runner must not be removed within the grace period: got %d remove runner calls", n)
+	}
+	if got := gather("arc_ghost_runners_detected_total") - detected; got != 1 {
+		t.Errorf("unexpected number of detected ghost runners: got %v, want 1", got)
+	}
+
+	// The ghost is counted only once while it stays a ghost.
+	if err := cleaner.cleanup(context.Background()); err != nil {
+		t.Fatalf("cleanup() error = %v", err)
+	}
+	if got := gather("arc_ghost_runners_detected_total") - detected; got != 1 {
+		t.Errorf("unexpected number of detected ghost runners: got %v, want 1", got)
+	}
+
+	for key := range cleaner.firstSeen {
+		cleaner.firstSeen[key] = time.Now().Add(-2 * time.Hour)
+	}
+
+	if err := cleaner.cleanup(context.Background()); err != nil {
+		t.Fatalf("cleanup() error = %v", err)
+	}
+
+	var paths []string
+	for _, call := range removeRunner.Calls() {
+		paths = append(paths, call.Path)
+	}
+
+	if d := cmp.Diff([]string{"/repos/test/valid/actions/runners/1"}, paths); d != "" {
+		t.Errorf("unexpected remove runner calls (-want +got):\n%s", d)
+	}
+	if got := gather("arc_ghost_runners_cleaned_total") - cleaned; got != 1 {
+		t.Errorf("unexpected number of cleaned ghost runners: got %v, want 1", got)
+	}
+}
+
+func TestOfflineRunnerCleaner_SelectRemovableRunners(t *testing.T) {
+	cleaner := &OfflineRunnerCleaner{GracePeriod: time.Minute}
+	scope := offlineRunnerCleanupScope{Repository: "test/valid"}
+
+	ghost := &gogithub.Runner{Name: gogithub.String("example-ghost")}
+
+	now := time.Now()
+
+	if got := cleaner.selectRemovableRunners(scope, []*gogithub.Runner{ghost}, now, map[string]struct{}{}); len(got) != 0 {
+		t.Errorf("unexpected removable runners on first sight: %v", got)
+	}
+
+	if got := cleaner.selectRemovableRunners(scope, []*gogithub.Runner{ghost}, now.Add(time.Minute), map[string]struct{}{}); len(got) != 1 {
+		t.Errorf("expected the ghost runner to be removable after the grace period, got %v", got)
+	}
+}
+
+func TestUnregisterRunner_InlineUnregistrationDisabled(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	ghc := withInlineUnregistrationDisabled(newGithubClient(server), true)
+
+	ok, err := unregisterRunner(context.Background(), GracefulStopConfig{}, logr.Discard(), ghc, "", "", "test/valid", "test1")
+	if err != nil {
+		t.Fatalf("unregisterRunner() error = %v", err)
+	}
+	if !ok {
+		t.Errorf("expected the runner to be considered unregistered")
+	}
+
+	if n := len(removeRunner.Calls()); n != 0 {
+		t.Errorf("unexpected number of remove runner calls: got %d, want 0", n)
+	}
+}
+
+func TestUnregisterRunner_InlineUnregistrationDisabled_Busy(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, `{"total_count": 1, "runners": [{"id": 1, "name": "test1", "os": "linux", "status": "online", "busy": true}]}`),
+	)
+	defer server.Close()
+
+	ghc := withInlineUnregistrationDisabled(newGithubClient(server), true)
+
+	_, err := unregisterRunner(context.Background(), GracefulStopConfig{}, logr.Discard(), ghc, "", "", "test/valid", "test1")
+	if !isRunnerBusyError(err) {
+		t.Errorf("expected busy runner error, got %v", err)
+	}
+}
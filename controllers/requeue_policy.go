@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/apierrors"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// RequeuePolicy determines how long ARC waits before retrying a graceful stop of a runner,
+// depending on why the graceful stop is postponed.
+// Zero fields fall back to the defaults, see DefaultRequeuePolicy.
+type RequeuePolicy struct {
+	// InProgressDelay is the delay between retries while ARC is waiting for the runner to be unregistered.
+	InProgressDelay time.Duration
+
+	// MaxInProgressDelay makes the delay between retries while ARC is waiting for the runner to be unregistered or to finish its job adaptive.
+	// When it's greater than InProgressDelay or BusyDelay, the delay starts at MaxInProgressDelay on the start of the unregistration,
+	// and shrinks linearly to InProgressDelay or BusyDelay as the unregistration timeout approaches.
+	// Zero disables it, so that ARC retries at the fixed delays.
+	MaxInProgressDelay time.Duration
+
+	// RateLimitDelay is the delay until retrying after hitting GitHub API rate limits.
+	// A longer Retry-After sent with a secondary rate limit error takes precedence.
+	RateLimitDelay time.Duration
+
+	// MinRateLimitDelay is the minimum the AnnotationKeyRateLimitRetryDelay annotation of a runner pod can shorten RateLimitDelay to.
+	MinRateLimitDelay time.Duration
+
+	// BusyDelay is the delay between retries while the runner is running a job.
+	BusyDelay time.Duration
+
+	// NetworkErrorBackoff is the delay until retrying after a transient network error.
+	// It doubles per unregistration attempt of the runner pod, up to NetworkErrorMaxBackoff.
+	// When zero, the request is requeued with the exponential backoff of the controller's workqueue.
+	NetworkErrorBackoff time.Duration
+
+	// NetworkErrorMaxBackoff caps NetworkErrorBackoff. Zero means no cap.
+	NetworkErrorMaxBackoff time.Duration
+
+	// ConflictDelay is the delay until retrying after patching the runner pod failed with a conflict,
+	// e.g. because another controller updated the pod at the same time.
+	ConflictDelay time.Duration
+}
+
+// DefaultRequeuePolicy returns the RequeuePolicy ARC uses unless configured otherwise.
+func DefaultRequeuePolicy() RequeuePolicy {
+	return RequeuePolicy{
+		InProgressDelay:   DefaultUnregistrationRetryDelay,
+		RateLimitDelay:    retryDelayOnGitHubAPIRateLimitError,
+		MinRateLimitDelay: DefaultMinRateLimitRetryDelay,
+		BusyDelay:         DefaultUnregistrationRetryDelay,
+		ConflictDelay:     DefaultPatchConflictRetryDelay,
+	}
+}
+
+func (p RequeuePolicy) withDefaults() RequeuePolicy {
+	d := DefaultRequeuePolicy()
+
+	if p.InProgressDelay <= 0 {
+		p.InProgressDelay = d.InProgressDelay
+	}
+
+	if p.RateLimitDelay <= 0 {
+		p.RateLimitDelay = d.RateLimitDelay
+	}
+
+	if p.MinRateLimitDelay <= 0 {
+		p.MinRateLimitDelay = d.MinRateLimitDelay
+	}
+
+	if p.BusyDelay <= 0 {
+		p.BusyDelay = p.InProgressDelay
+	}
+
+	if p.ConflictDelay <= 0 {
+		p.ConflictDelay = d.ConflictDelay
+	}
+
+	return p
+}
+
+// forPod returns the policy with RateLimitDelay overridden by the AnnotationKeyRateLimitRetryDelay annotation of the runner pod, if any.
+// The override is clamped to MinRateLimitDelay, so that a runner can't retry fast enough to exhaust the GitHub API rate limit shared with other runners.
+// An invalid override is logged and ignored.
+func (p RequeuePolicy) forPod(log logr.Logger, pod *corev1.Pod) RequeuePolicy {
+	if pod == nil {
+		return p
+	}
+
+	v, ok := getAnnotation(pod, AnnotationKeyRateLimitRetryDelay)
+	if !ok {
+		return p
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Info("Ignored the invalid rate limit retry delay of the runner pod.", "annotation", AnnotationKeyRateLimitRetryDelay, "value", v)
+		return p
+	}
+
+	if d < p.MinRateLimitDelay {
+		log.V(1).Info("Clamped the rate limit retry delay of the runner pod to the minimum.", "annotation", AnnotationKeyRateLimitRetryDelay, "value", v, "minRateLimitRetryDelay", p.MinRateLimitDelay)
+		d = p.MinRateLimitDelay
+	}
+
+	p.RateLimitDelay = d
+
+	return p
+}
+
+// adaptiveDelay returns the delay between retries while waiting for the unregistration that started elapsed ago to complete within the timeout,
+// given the base delay ARC would retry at without MaxInProgressDelay.
+//
+// It polls loosely early on, when the runner is likely still running its job, and tightens as the timeout nears,
+// so that the runner pod is deleted promptly at the end. It never requeues past the timeout.
+func (p RequeuePolicy) adaptiveDelay(base, elapsed, timeout time.Duration) time.Duration {
+	if p.MaxInProgressDelay <= base || timeout <= 0 {
+		return base
+	}
+
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	remaining := timeout - elapsed
+	if remaining <= 0 {
+		return base
+	}
+
+	d := base + time.Duration(float64(p.MaxInProgressDelay-base)*float64(remaining)/float64(timeout))
+	if d > remaining {
+		d = remaining
+	}
+
+	return d
+}
+
+// rateLimitRetryDelay returns the delay until retrying the GitHub API call that failed due to the rate limit or the secondary rate limit.
+// The second return value is false if err isn't caused by rate limits.
+func (p RequeuePolicy) rateLimitRetryDelay(err error) (time.Duration, bool) {
+	// Errors returned by github.Client are already classified, but the ones of go-github calls made directly, e.g. by the autoscaler, aren't.
+	err = apierrors.Classify(context.Background(), "", err)
+
+	var (
+		rateLimitErr          *apierrors.RateLimited
+		secondaryRateLimitErr *apierrors.SecondaryRateLimited
+	)
+
+	if errors.As(err, &rateLimitErr) {
+		return p.RateLimitDelay, true
+	}
+
+	if errors.As(err, &secondaryRateLimitErr) {
+		if d := secondaryRateLimitErr.RetryAfter; d > p.RateLimitDelay {
+			return d, true
+		}
+
+		return p.RateLimitDelay, true
+	}
+
+	return 0, false
+}
+
+// networkErrorResult returns the result to requeue with after a transient network error,
+// given the number of the unregistration attempts made so far.
+func (p RequeuePolicy) networkErrorResult(attempts int) *ctrl.Result {
+	if p.NetworkErrorBackoff <= 0 {
+		return &ctrl.Result{Requeue: true}
+	}
+
+	d := p.NetworkErrorBackoff
+	for i := 0; i < attempts; i++ {
+		if p.NetworkErrorMaxBackoff > 0 && d >= p.NetworkErrorMaxBackoff || d > math.MaxInt64/2 {
+			break
+		}
+		d *= 2
+	}
+
+	if p.NetworkErrorMaxBackoff > 0 && d > p.NetworkErrorMaxBackoff {
+		d = p.NetworkErrorMaxBackoff
+	}
+
+	return &ctrl.Result{RequeueAfter: d}
+}
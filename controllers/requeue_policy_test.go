@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRequeuePolicy_WithDefaults(t *testing.T) {
+	if got, want := (RequeuePolicy{}).withDefaults(), DefaultRequeuePolicy(); got != want {
+		t.Errorf("unexpected defaults: got %+v, want %+v", got, want)
+	}
+
+	got := RequeuePolicy{InProgressDelay: 5 * time.Second}.withDefaults()
+	if got.BusyDelay != 5*time.Second {
+		t.Errorf("BusyDelay should default to InProgressDelay: got %v", got.BusyDelay)
+	}
+	if got.RateLimitDelay != retryDelayOnGitHubAPIRateLimitError {
+		t.Errorf("unexpected RateLimitDelay: got %v, want %v", got.RateLimitDelay, retryDelayOnGitHubAPIRateLimitError)
+	}
+}
+
+func TestRequeuePolicy_NetworkErrorResult(t *testing.T) {
+	if res := (RequeuePolicy{}).networkErrorResult(3); !res.Requeue || res.RequeueAfter != 0 {
+		t.Errorf("expected the workqueue backoff without NetworkErrorBackoff, got %v", res)
+	}
+
+	p := RequeuePolicy{NetworkErrorBackoff: time.Second, NetworkErrorMaxBackoff: 10 * time.Second}
+
+	for attempts, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if got := p.networkErrorResult(attempts).RequeueAfter; got != want {
+			t.Errorf("attempts %d: got %v, want %v", attempts, got, want)
+		}
+	}
+
+	uncapped := RequeuePolicy{NetworkErrorBackoff: time.Second}
+	if got := uncapped.networkErrorResult(1000).RequeueAfter; got <= 0 {
+		t.Errorf("backoff must not overflow: got %v", got)
+	}
+}
+
+func TestRequeuePolicy_AdaptiveDelay(t *testing.T) {
+	p := RequeuePolicy{MaxInProgressDelay: 2 * time.Minute}
+
+	tests := []struct {
+		elapsed time.Duration
+		want    time.Duration
+	}{
+		{elapsed: 0, want: 2 * time.Minute},
+		{elapsed: 5 * time.Minute, want: 65 * time.Second},
+		{elapsed: 9 * time.Minute, want: 21 * time.Second},
+		// It never requeues past the timeout.
+		{elapsed: 9*time.Minute + 55*time.Second, want: 5 * time.Second},
+		{elapsed: 11 * time.Minute, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := p.adaptiveDelay(10*time.Second, tt.elapsed, 10*time.Minute); got != tt.want {
+			t.Errorf("adaptiveDelay() at %v elapsed = %v, want %v", tt.elapsed, got, tt.want)
+		}
+	}
+
+	if got := (RequeuePolicy{}).adaptiveDelay(10*time.Second, 0, 10*time.Minute); got != 10*time.Second {
+		t.Errorf("expected the fixed delay without MaxInProgressDelay, got %v", got)
+	}
+}
+
+func TestRequeuePolicy_ForPod(t *testing.T) {
+	p := RequeuePolicy{RateLimitDelay: time.Minute, MinRateLimitDelay: 10 * time.Second}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        time.Duration
+	}{
+		{
+			name: "no override",
+			want: time.Minute,
+		},
+		{
+			name:        "shorter override",
+			annotations: map[string]string{AnnotationKeyRateLimitRetryDelay: "15s"},
+			want:        15 * time.Second,
+		},
+		{
+			name:        "longer override",
+			annotations: map[string]string{AnnotationKeyRateLimitRetryDelay: "5m"},
+			want:        5 * time.Minute,
+		},
+		{
+			name:        "override clamped to the minimum",
+			annotations: map[string]string{AnnotationKeyRateLimitRetryDelay: "1s"},
+			want:        10 * time.Second,
+		},
+		{
+			name:        "invalid override",
+			annotations: map[string]string{AnnotationKeyRateLimitRetryDelay: "soon"},
+			want:        time.Minute,
+		},
+		{
+			name:        "non-positive override",
+			annotations: map[string]string{AnnotationKeyRateLimitRetryDelay: "0s"},
+			want:        time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+
+			if got := p.forPod(logr.Discard(), pod).RateLimitDelay; got != tt.want {
+				t.Errorf("RateLimitDelay = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := p.forPod(logr.Discard(), nil).RateLimitDelay; got != time.Minute {
+		t.Errorf("expected no override without the pod, got %v", got)
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,11 +31,16 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -53,6 +60,15 @@ const (
 	// This is an annotation internal to actions-runner-controller and can change in backward-incompatible ways
 	annotationKeyRegistrationOnly = "actions-runner-controller/registration-only"
 
+	// AnnotationKeyCleanStopContainers is the annotation to override the comma-separated names of the containers
+	// whose termination counts as a successful stop of the runner pod. Defaults to "runner".
+	AnnotationKeyCleanStopContainers = "actions-runner-controller/clean-stop-containers"
+
+	// AnnotationKeyCleanStopExitCodes is the annotation to override the comma-separated exit codes
+	// that count as a successful stop of the runner pod. Defaults to "0".
+	// This is useful for custom runner images that intentionally exit with a non-zero code on clean completion.
+	AnnotationKeyCleanStopExitCodes = "actions-runner-controller/clean-stop-exit-codes"
+
 	EnvVarOrg        = "RUNNER_ORG"
 	EnvVarRepo       = "RUNNER_REPO"
 	EnvVarEnterprise = "RUNNER_ENTERPRISE"
@@ -64,7 +80,7 @@ type RunnerReconciler struct {
 	Log                         logr.Logger
 	Recorder                    record.EventRecorder
 	Scheme                      *runtime.Scheme
-	GitHubClient                *github.Client
+	GitHubClient                *MultiGitHubClient
 	RunnerImage                 string
 	RunnerImagePullSecrets      []string
 	DockerImage                 string
@@ -73,8 +89,25 @@ type RunnerReconciler struct {
 	RegistrationRecheckInterval time.Duration
 	RegistrationRecheckJitter   time.Duration
 
-	UnregistrationTimeout    time.Duration
-	UnregistrationRetryDelay time.Duration
+	GracefulStopConfig
+
+	// PauseScaleUpsOnRateLimit makes the reconciler pause creating runner pods while the GitHub API rate limit of the credentials is exhausted.
+	PauseScaleUpsOnRateLimit bool
+
+	// StartupReconcileRamp spreads the first reconciliations of the runners that existed before the controller started. Nil disables it.
+	StartupReconcileRamp *StartupReconcileRamp
+
+	// EphemeralRunnerMaxIdle is how long an ephemeral runner can stay idle without running any job since the registration,
+	// until the runner pod is gracefully stopped and recreated. Zero disables it.
+	EphemeralRunnerMaxIdle time.Duration
+
+	NodeDrain NodeDrainConfig
+
+	// StatusUpdateWindow is the window within which the status updates of each runner are coalesced.
+	// Zero only suppresses updates that don't change the runner status.
+	StatusUpdateWindow time.Duration
+
+	statusUpdates *runnerStatusCoalescer
 }
 
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runners,verbs=get;list;watch;create;update;patch;delete
@@ -83,6 +116,8 @@ type RunnerReconciler struct {
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods/finalizers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
 
 func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("runner", req.NamespacedName)
@@ -92,12 +127,31 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	if d := startupReconcileDelay(log, r.StartupReconcileRamp, &runner, time.Now()); d > 0 {
+		return ctrl.Result{RequeueAfter: d}, nil
+	}
+
 	err := runner.Validate()
 	if err != nil {
 		log.Info("Failed to validate runner spec", "error", err.Error())
 		return ctrl.Result{}, nil
 	}
 
+	ghc, err := r.GitHubClient.InitForRunner(ctx, &runner)
+	if err != nil {
+		if runner.ObjectMeta.DeletionTimestamp.IsZero() {
+			return r.processGitHubAPICredentialsError(ctx, runner, log, err)
+		}
+
+		// The referenced secret is often deleted along with the runner, or may never get fixed.
+		// We don't want that to block the runner deletion forever, so we try unregistering the runner with the controller-wide credentials instead.
+		log.Error(err, "Failed to initialize GitHub API client for the runner being deleted. Falling back to the controller-wide credentials to unregister the runner")
+
+		ghc = r.GitHubClient.Default()
+	} else if err := r.updateGitHubAPICredentialsCondition(ctx, runner, log); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if runner.ObjectMeta.DeletionTimestamp.IsZero() {
 		finalizers, added := addFinalizer(runner.ObjectMeta.Finalizers, finalizerName)
 
@@ -129,7 +183,7 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		}
 
 		// Request to remove a runner. DeletionTimestamp was set in the runner - we need to unregister runner
-		return r.processRunnerDeletion(runner, ctx, log, p)
+		return r.processRunnerDeletion(runner, ctx, log, ghc, p)
 	}
 
 	registrationOnly := metav1.HasAnnotation(runner.ObjectMeta, annotationKeyRegistrationOnly)
@@ -145,6 +199,9 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 
 				return ctrl.Result{Requeue: true}, nil
 			}
+		} else if err := r.removeRunnerPodFinalizer(ctx, log, &pod); err != nil {
+			// The registration-only runner is intended to stay registered, so we remove the finalizer without unregistering it.
+			return ctrl.Result{}, err
 		} else if err := r.Delete(ctx, &pod); err != nil {
 			if !kerrors.IsNotFound(err) {
 				log.Info(fmt.Sprintf("Retrying soon as we failed to delete registration-only runner pod: %v", err))
@@ -166,23 +223,60 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			// An error ocurred
 			return ctrl.Result{}, err
 		}
-		return r.processRunnerCreation(ctx, runner, log)
+		return r.processRunnerCreation(ctx, runner, log, ghc)
 	}
 
 	// Pod already exists
 
 	if !pod.ObjectMeta.DeletionTimestamp.IsZero() {
-		return r.processRunnerPodDeletion(ctx, runner, log, pod)
+		return r.processRunnerPodDeletion(ctx, runner, log, ghc, pod)
 	}
 
-	// If pod has ended up succeeded we need to restart it
+	// Pods created by older versions of ARC don't have the finalizer.
+	if finalizers, added := addFinalizer(pod.ObjectMeta.Finalizers, runnerPodFinalizerName); added {
+		updated := pod.DeepCopy()
+		updated.ObjectMeta.Finalizers = finalizers
+
+		if err := r.Patch(ctx, updated, client.MergeFrom(&pod)); err != nil {
+			log.Error(err, "Failed to add finalizer to runner pod")
+			return ctrl.Result{}, err
+		}
+
+		pod = *updated
+	}
+
+	if err := ensureRunnerLabels(ctx, r.Client, log, &pod); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if res, err := drainRunnerPodOnUnschedulableNode(ctx, r.Client, log, r.NodeDrain, r.PodDeletionPropagationPolicy, &pod, func(pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+		updated, res, err := r.tickRunnerGracefulStop(ctx, runner, UnregistrationReasonNodeDrain, log, ghc, pod)
+		if res != nil {
+			result, err := r.processUnregistrationResult(ctx, runner, log, *res, err)
+			return nil, &result, err
+		}
+		return updated, nil, nil
+	}); res != nil {
+		return *res, err
+	}
+
+	// An OOMKilled runner is never a clean stop, so we recreate its pod regardless of the succeeded pod policy.
+	if !registrationOnly && runnerContainerOOMKilled(&pod) {
+		return r.recreateOOMKilledRunnerPod(ctx, runner, log, ghc, &pod)
+	}
+
+	// If pod has ended up succeeded we need to either restart it or delete the runner, depending on the succeeded pod policy.
 	// Happens e.g. when dind is in runner and run completes
-	stopped := runnerPodOrContainerIsStopped(&pod)
+	stopped := runnerPodOrContainerIsStopped(&pod, runnerPodCleanStopConfig(log, &pod))
 
 	ephemeral := runner.Spec.Ephemeral == nil || *runner.Spec.Ephemeral
 
-	if stopped && ephemeral {
-		log.V(1).Info("Ephemeral runner has been stopped successfully. Marking this runner for deletion.")
+	if stopped && runnerIsDeletedOnSuccess(runner, registrationOnly) {
+		if ephemeral {
+			log.V(1).Info("Ephemeral runner has been stopped successfully. Marking this runner for deletion.")
+		} else {
+			log.V(1).Info("Runner has been stopped successfully and its succeeded pod policy is Delete. Marking this runner for deletion.")
+		}
 
 		// This is the key to make ephemeral runners to work reliably with webhook-based autoscale.
 		// See https://github.com/actions-runner-controller/actions-runner-controller/issues/911#issuecomment-1046161384 for more context.
@@ -202,6 +296,20 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 
 	restart := stopped
 
+	// recycled is true when the runnerdeployment marked the pod for recycling as it exceeded maxRunnerAge,
+	// or the webhook server marked it as the workflow job assigned to the runner has been cancelled.
+	// We restart the runner regardless of its registration state, after waiting for the job of the busy runner to complete.
+	_, recycled := getAnnotation(&pod, AnnotationKeyRecycle)
+	if recycled && !restart && !registrationOnly {
+		if reason := unregistrationReasonOf(&pod, UnregistrationReasonMaxAge); reason == UnregistrationReasonWorkflowCancelled {
+			log.Info("Workflow job assigned to the runner has been cancelled. Recreating the pod.", "podCreationTimestamp", pod.CreationTimestamp)
+		} else {
+			log.Info("Runner pod exceeded maxRunnerAge of the runnerdeployment. Recreating the pod.", "podCreationTimestamp", pod.CreationTimestamp)
+		}
+
+		restart = true
+	}
+
 	if registrationOnly && stopped {
 		restart = false
 
@@ -211,13 +319,13 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		)
 	}
 
-	if updated, err := r.updateRegistrationToken(ctx, runner); err != nil {
+	if updated, err := r.updateRegistrationToken(ctx, runner, ghc); err != nil {
 		return ctrl.Result{}, err
 	} else if updated {
 		return ctrl.Result{Requeue: true}, nil
 	}
 
-	newPod, err := r.newPod(runner)
+	newPod, err := r.newPod(runner, ghc)
 	if err != nil {
 		log.Error(err, "Could not create pod")
 		return ctrl.Result{}, err
@@ -235,6 +343,9 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 
 	var registrationRecheckDelay time.Duration
 
+	// idleRecheckDelay is when the ephemeral runner idle since the registration is due to be recreated.
+	var idleRecheckDelay time.Duration
+
 	// all checks done below only decide whether a restart is needed
 	// if a restart was already decided before, there is no need for the checks
 	// saving API calls and scary log messages
@@ -278,7 +389,8 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		notFound := false
 		offline := false
 
-		runnerBusy, err := r.GitHubClient.IsRunnerBusy(ctx, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name)
+		registered, err := ghc.GetRunner(ctx, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name)
+		runnerBusy := registered.GetBusy()
 
 		currentTime := time.Now()
 
@@ -309,6 +421,44 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			}
 		}
 
+		if !notFound {
+			if err := markRunnerPodRegistrationSeen(ctx, realClock{}, r.Client, log, &pod); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			if err := recordGitHubRunnerLabels(ctx, r.Client, log, r.GitHubRunnerLabelsAnnotation, &pod, registered); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+
+		if runnerBusy {
+			if err := markRunnerPodJobSeen(ctx, r.Client, log, &pod); err != nil {
+				return ctrl.Result{}, err
+			}
+		} else if remaining, ok := ephemeralRunnerIdleRemaining(&pod, r.EphemeralRunnerMaxIdle, currentTime); ok && ephemeral && !registrationOnly && !notFound && !offline {
+			if remaining <= 0 {
+				log.Info(
+					"Ephemeral runner has been idle without running any job since the registration. "+
+						"Recreating the pod so that a fresh runner picks up jobs.",
+					"registrationFirstSeenTimestamp", pod.Annotations[AnnotationKeyRegistrationFirstSeenTimestamp],
+					"currentTime", currentTime,
+					"ephemeralRunnerMaxIdle", r.EphemeralRunnerMaxIdle,
+				)
+
+				restart = true
+			} else {
+				idleRecheckDelay = remaining
+			}
+		}
+
+		if err := r.updateRegisteredCondition(ctx, runner, log, !notFound); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if err := r.updatePlatform(ctx, runner, log, registered); err != nil {
+			return ctrl.Result{}, err
+		}
+
 		// See the `newPod` function called above for more information
 		// about when this hash changes.
 		curHash := pod.Labels[LabelKeyPodTemplateHash]
@@ -398,7 +548,7 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			updated := runner.DeepCopy()
 			updated.Status.LastRegistrationCheckTime = &metav1.Time{Time: time.Now()}
 
-			if err := r.Status().Patch(ctx, updated, client.MergeFrom(&runner)); err != nil {
+			if err := r.patchStatus(ctx, &runner, updated, false); err != nil {
 				log.Error(err, "Failed to update runner status for LastRegistrationCheckTime")
 				return ctrl.Result{}, err
 			}
@@ -420,23 +570,36 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			updated.Status.Reason = pod.Status.Reason
 			updated.Status.Message = pod.Status.Message
 
-			if err := r.Status().Patch(ctx, updated, client.MergeFrom(&runner)); err != nil {
+			if err := r.patchStatus(ctx, &runner, updated, false); err != nil {
 				log.Error(err, "Failed to update runner status for Phase/Reason/Message")
 				return ctrl.Result{}, err
 			}
 		}
 
+		if idleRecheckDelay > 0 {
+			return ctrl.Result{RequeueAfter: idleRecheckDelay}, nil
+		}
+
 		return ctrl.Result{}, nil
 	}
 
-	updatedPod, res, err := tickRunnerGracefulStop(ctx, r.unregistrationTimeout(), r.unregistrationRetryDelay(), log, r.GitHubClient, r.Client, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name, &pod)
+	reason := UnregistrationReasonRestart
+	if recycled {
+		reason = unregistrationReasonOf(&pod, UnregistrationReasonMaxAge)
+	}
+
+	updatedPod, res, err := r.tickRunnerGracefulStop(ctx, runner, reason, log, ghc, &pod)
 	if res != nil {
-		return *res, err
+		return r.processUnregistrationResult(ctx, runner, log, *res, err)
+	}
+
+	if err := r.removeRunnerPodFinalizer(ctx, log, updatedPod); err != nil {
+		return ctrl.Result{}, err
 	}
 
 	// Only delete the pod if we successfully unregistered the runner or the runner is already deleted from the service.
 	// This should help us avoid race condition between runner pickup job after we think the runner is not busy.
-	if err := r.Delete(ctx, updatedPod); err != nil {
+	if err := deleteRunnerPod(ctx, r.Client, r.PodDeletionPropagationPolicy, updatedPod); err != nil {
 		log.Error(err, "Failed to delete pod resource")
 		return ctrl.Result{}, err
 	}
@@ -447,7 +610,130 @@ func (r *RunnerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	return ctrl.Result{}, nil
 }
 
-func runnerPodOrContainerIsStopped(pod *corev1.Pod) bool {
+// CleanStopConfig defines which container terminations count as a successful stop of a runner pod.
+type CleanStopConfig struct {
+	// ContainerNames is the names of the containers whose termination is considered.
+	ContainerNames []string
+	// ExitCodes is the exit codes that count as a clean completion of the container.
+	ExitCodes []int32
+}
+
+// DefaultCleanStopConfig returns the config that treats the runner container exited with 0 as a clean stop.
+func DefaultCleanStopConfig() CleanStopConfig {
+	return CleanStopConfig{
+		ContainerNames: []string{containerName},
+		ExitCodes:      []int32{0},
+	}
+}
+
+func (c CleanStopConfig) isDefault() bool {
+	d := DefaultCleanStopConfig()
+
+	return reflect.DeepEqual(c, d)
+}
+
+func (c CleanStopConfig) matches(status corev1.ContainerStatus, state corev1.ContainerState) bool {
+	if state.Terminated == nil {
+		return false
+	}
+
+	var nameMatched bool
+	for _, n := range c.ContainerNames {
+		if n == status.Name {
+			nameMatched = true
+			break
+		}
+	}
+
+	if !nameMatched {
+		return false
+	}
+
+	for _, code := range c.ExitCodes {
+		if code == state.Terminated.ExitCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cleanStopConfigFromPod reads the clean stop config from the AnnotationKeyCleanStopContainers and
+// AnnotationKeyCleanStopExitCodes annotations on the pod, defaulting each to that of DefaultCleanStopConfig.
+//
+// It returns the default config along with an error when any of the annotations is invalid.
+func cleanStopConfigFromPod(pod *corev1.Pod) (CleanStopConfig, error) {
+	conf := DefaultCleanStopConfig()
+
+	if v, ok := getAnnotation(pod, AnnotationKeyCleanStopContainers); ok {
+		var names []string
+		for _, n := range strings.Split(v, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, n)
+			}
+		}
+
+		if len(names) == 0 {
+			return DefaultCleanStopConfig(), fmt.Errorf("annotation %s must contain at least one container name", AnnotationKeyCleanStopContainers)
+		}
+
+		conf.ContainerNames = names
+	}
+
+	if v, ok := getAnnotation(pod, AnnotationKeyCleanStopExitCodes); ok {
+		var codes []int32
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.TrimSpace(c); c == "" {
+				continue
+			}
+
+			code, err := strconv.ParseInt(c, 10, 32)
+			if err != nil {
+				return DefaultCleanStopConfig(), fmt.Errorf("annotation %s must be comma-separated exit codes: %w", AnnotationKeyCleanStopExitCodes, err)
+			}
+
+			codes = append(codes, int32(code))
+		}
+
+		if len(codes) == 0 {
+			return DefaultCleanStopConfig(), fmt.Errorf("annotation %s must contain at least one exit code", AnnotationKeyCleanStopExitCodes)
+		}
+
+		conf.ExitCodes = codes
+	}
+
+	return conf, nil
+}
+
+// runnerPodCleanStopConfig is a convenient wrapper of cleanStopConfigFromPod that logs
+// and falls back to the default config on invalid annotations.
+func runnerPodCleanStopConfig(log logr.Logger, pod *corev1.Pod) CleanStopConfig {
+	conf, err := cleanStopConfigFromPod(pod)
+	if err != nil {
+		log.Error(err, "Ignoring invalid clean stop config. Falling back to the default")
+	}
+
+	return conf
+}
+
+// runnerIsDeletedOnSuccess returns true if the runner should be deleted, rather than having its pod recreated,
+// once the runner pod has stopped successfully.
+//
+// An ephemeral runner is always deleted because it has unregistered itself by the time it stops.
+// A non-ephemeral runner is restarted unless its succeeded pod policy is Delete.
+// Note that a non-ephemeral runner pod with dockerdWithinRunnerContainer stops only when the runner process exits,
+// whereas one with the docker sidecar keeps running dockerd after the runner container exits.
+// The latter is detected as stopped by the clean stop config and treated the same, so the policy applies to both.
+// A registration-only runner is never deleted here, as it's already handled separately.
+func runnerIsDeletedOnSuccess(runner v1alpha1.Runner, registrationOnly bool) bool {
+	if runner.Spec.Ephemeral == nil || *runner.Spec.Ephemeral {
+		return true
+	}
+
+	return !registrationOnly && runner.Spec.SucceededPodPolicy == v1alpha1.SucceededPodPolicyDelete
+}
+
+func runnerPodOrContainerIsStopped(pod *corev1.Pod, conf CleanStopConfig) bool {
 	// If pod has ended up succeeded we need to restart it
 	// Happens e.g. when dind is in runner and run completes
 	stopped := pod.Status.Phase == corev1.PodSucceeded
@@ -455,11 +741,13 @@ func runnerPodOrContainerIsStopped(pod *corev1.Pod) bool {
 	if !stopped {
 		if pod.Status.Phase == corev1.PodRunning {
 			for _, status := range pod.Status.ContainerStatuses {
-				if status.Name != containerName {
-					continue
+				if conf.matches(status, status.State) {
+					stopped = true
 				}
 
-				if status.State.Terminated != nil && status.State.Terminated.ExitCode == 0 {
+				// A container exited with a non-zero code is restarted by the kubelet due to the OnFailure restart policy,
+				// so a custom exit code can be observed only as the last termination state while it's waiting for the restart.
+				if !conf.isDefault() && status.State.Waiting != nil && conf.matches(status, status.LastTerminationState) {
 					stopped = true
 				}
 			}
@@ -469,13 +757,36 @@ func runnerPodOrContainerIsStopped(pod *corev1.Pod) bool {
 	return stopped
 }
 
-func (r *RunnerReconciler) processRunnerDeletion(runner v1alpha1.Runner, ctx context.Context, log logr.Logger, pod *corev1.Pod) (reconcile.Result, error) {
+func (r *RunnerReconciler) processRunnerDeletion(runner v1alpha1.Runner, ctx context.Context, log logr.Logger, ghc *github.Client, pod *corev1.Pod) (reconcile.Result, error) {
 	finalizers, removed := removeFinalizer(runner.ObjectMeta.Finalizers, finalizerName)
 
 	if removed {
-		_, res, err := tickRunnerGracefulStop(ctx, r.unregistrationTimeout(), r.unregistrationRetryDelay(), log, r.GitHubClient, r.Client, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name, pod)
+		if runner.Spec.OwnerDeletionPolicy == v1alpha1.OwnerDeletionPolicyAbort {
+			ownerDeleted, err := runnerOwnerIsDeleted(ctx, r.Client, runner)
+			if err != nil {
+				log.Error(err, "Failed to see if the owner of the runner is deleted")
+				return ctrl.Result{}, err
+			}
+
+			if ownerDeleted {
+				return r.abortRunnerDeletion(ctx, runner, log, pod, finalizers)
+			}
+		}
+
+		if metav1.HasAnnotation(runner.ObjectMeta, AnnotationKeyForceStop) {
+			return r.forceRunnerDeletion(ctx, runner, log, ghc, pod, finalizers)
+		}
+
+		updatedPod, res, err := r.tickRunnerGracefulStop(ctx, runner, unregistrationReasonOf(&runner, UnregistrationReasonManual), log, ghc, pod)
 		if res != nil {
-			return *res, err
+			return r.processUnregistrationResult(ctx, runner, log, *res, err)
+		}
+
+		// The runner pod is garbage-collected once the runner is gone, and nothing removes the pod finalizer after that.
+		if updatedPod != nil {
+			if err := r.removeRunnerPodFinalizer(ctx, log, updatedPod); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
 
 		newRunner := runner.DeepCopy()
@@ -492,25 +803,123 @@ func (r *RunnerReconciler) processRunnerDeletion(runner v1alpha1.Runner, ctx con
 	return ctrl.Result{}, nil
 }
 
-func (r *RunnerReconciler) unregistrationTimeout() time.Duration {
-	unregistrationTimeout := DefaultUnregistrationTimeout
+// abortRunnerDeletion deletes the runner pod and removes the runner finalizer without waiting for the graceful stop,
+// as requested by the Abort owner deletion policy.
+func (r *RunnerReconciler) abortRunnerDeletion(ctx context.Context, runner v1alpha1.Runner, log logr.Logger, pod *corev1.Pod, finalizers []string) (reconcile.Result, error) {
+	if err := r.deleteRunnerWithoutGracefulStop(ctx, runner, log, pod, finalizers); err != nil {
+		return ctrl.Result{}, err
+	}
 
-	if r.UnregistrationTimeout > 0 {
-		unregistrationTimeout = r.UnregistrationTimeout
+	r.Recorder.Event(&runner, corev1.EventTypeWarning, "GracefulStopAborted", "Deleted the runner without unregistering it as its owner was deleted")
+
+	log.Info("Aborted the graceful stop of the runner as its owner was deleted. The runner may stay registered on GitHub until it's removed as offline.", "ownerDeletionPolicy", runner.Spec.OwnerDeletionPolicy)
+
+	return ctrl.Result{}, nil
+}
+
+// deleteRunnerWithoutGracefulStop deletes the runner pod and removes the runner finalizer.
+func (r *RunnerReconciler) deleteRunnerWithoutGracefulStop(ctx context.Context, runner v1alpha1.Runner, log logr.Logger, pod *corev1.Pod, finalizers []string) error {
+	if pod != nil {
+		if err := r.removeRunnerPodFinalizer(ctx, log, pod); err != nil {
+			return err
+		}
+
+		if err := r.Delete(ctx, pod); err != nil && !kerrors.IsNotFound(err) {
+			log.Error(err, "Failed to delete runner pod")
+			return err
+		}
 	}
-	return unregistrationTimeout
+
+	newRunner := runner.DeepCopy()
+	newRunner.ObjectMeta.Finalizers = finalizers
+
+	if err := r.Patch(ctx, newRunner, client.MergeFrom(&runner)); err != nil {
+		log.Error(err, "Failed to update runner for finalizer removal")
+		return err
+	}
+
+	return nil
 }
 
-func (r *RunnerReconciler) unregistrationRetryDelay() time.Duration {
-	retryDelay := DefaultUnregistrationRetryDelay
+// tickRunnerGracefulStop ticks the graceful stop of the runner with the controller's configuration,
+// and reflects the number of unregistration attempts of the runner pod and the last unregistration error in the runner status.
+func (r *RunnerReconciler) tickRunnerGracefulStop(ctx context.Context, runner v1alpha1.Runner, reason UnregistrationReason, log logr.Logger, ghc *github.Client, pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+	if pod == nil {
+		// The runner pod is created right after the runner, so it may be missing only because it's not observed yet.
+		ctx = withRunnerPodExpectedSince(ctx, runner.CreationTimestamp.Time)
+	}
+
+	updatedPod, res, err := r.tickGracefulStop(ctx, reason, log, ghc, r.Client, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name, pod)
 
-	if r.UnregistrationRetryDelay > 0 {
-		retryDelay = r.UnregistrationRetryDelay
+	attempts := runner.Status.UnregistrationAttempts
+	if res == nil {
+		attempts = 0
+	} else if updatedPod != nil {
+		attempts = unregistrationAttemptsTotal(updatedPod)
 	}
-	return retryDelay
+
+	lastErr := nextLastUnregistrationError(runner.Status.LastUnregistrationError, res, err, time.Now())
+
+	if attempts != runner.Status.UnregistrationAttempts || lastErr != runner.Status.LastUnregistrationError {
+		updated := runner.DeepCopy()
+		updated.Status.UnregistrationAttempts = attempts
+		updated.Status.LastUnregistrationError = lastErr
+
+		// This is only for observability, so we don't want a failure here to block the graceful stop.
+		// It's debounced while the graceful stop is requeued, which writes the latest attempts later, but never once it has finished.
+		debounce := res != nil && res.RequeueAfter > 0
+		if err := r.patchStatus(ctx, &runner, updated, debounce); err != nil && !kerrors.IsNotFound(err) {
+			log.Error(err, "Failed to update runner status for unregistration attempts")
+		}
+	}
+
+	return updatedPod, res, err
 }
 
-func (r *RunnerReconciler) processRunnerPodDeletion(ctx context.Context, runner v1alpha1.Runner, log logr.Logger, pod corev1.Pod) (reconcile.Result, error) {
+// processRunnerPodDeletion unregisters the runner before letting Kubernetes delete the runner pod
+// that is being deleted out of ARC's control, like on node drain or force deletion.
+//
+// The runner pod finalizer blocks the deletion until the unregistration completes,
+// or the unregistration timeout elapses since the deletion so that the pod doesn't get stuck.
+func (r *RunnerReconciler) processRunnerPodDeletion(ctx context.Context, runner v1alpha1.Runner, log logr.Logger, ghc *github.Client, pod corev1.Pod) (reconcile.Result, error) {
+	if _, hasFinalizer := removeFinalizer(pod.ObjectMeta.Finalizers, runnerPodFinalizerName); hasFinalizer {
+		updatedPod := &pod
+
+		timeout, _ := EffectiveUnregistrationTimeout(&pod, r.UnregistrationTimeout)
+
+		if remaining := time.Until(pod.DeletionTimestamp.Add(timeout)); remaining > 0 {
+			p, res, err := r.tickRunnerGracefulStop(ctx, runner, UnregistrationReasonManual, log, ghc, &pod)
+			if res != nil {
+				result, err := r.processUnregistrationResult(ctx, runner, log, *res, err)
+
+				// Make sure we come back by the deadline to remove the finalizer, even when giving up the unregistration.
+				if result.RequeueAfter == 0 || result.RequeueAfter > remaining {
+					result.RequeueAfter = remaining
+				}
+
+				return result, err
+			}
+
+			updatedPod = p
+		} else {
+			log.Info(
+				"Runner pod deletion has taken longer than the unregistration timeout. "+
+					"Removing the finalizer without unregistering the runner to not get the pod stuck. "+
+					"The runner may remain on GitHub until GitHub removes it as offline.",
+				"podDeletionTimestamp", pod.DeletionTimestamp,
+				"unregistrationTimeout", timeout,
+			)
+
+			r.Recorder.Event(&runner, corev1.EventTypeWarning, "UnregistrationTimeout", fmt.Sprintf("Gave up unregistering the runner of the deleted pod '%s'", pod.Name))
+		}
+
+		if err := r.removeRunnerPodFinalizer(ctx, log, updatedPod); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, nil
+	}
+
 	deletionTimeout := 1 * time.Minute
 	currentTime := time.Now()
 	deletionDidTimeout := currentTime.Sub(pod.DeletionTimestamp.Add(deletionTimeout)) > 0
@@ -546,14 +955,39 @@ func (r *RunnerReconciler) processRunnerPodDeletion(ctx context.Context, runner
 	}
 }
 
-func (r *RunnerReconciler) processRunnerCreation(ctx context.Context, runner v1alpha1.Runner, log logr.Logger) (reconcile.Result, error) {
-	if updated, err := r.updateRegistrationToken(ctx, runner); err != nil {
+// removeRunnerPodFinalizer removes the runner pod finalizer so that Kubernetes can delete the pod.
+// It's a no-op if the pod doesn't have the finalizer or is already gone.
+func (r *RunnerReconciler) removeRunnerPodFinalizer(ctx context.Context, log logr.Logger, pod *corev1.Pod) error {
+	finalizers, removed := removeFinalizer(pod.ObjectMeta.Finalizers, runnerPodFinalizerName)
+	if !removed {
+		return nil
+	}
+
+	updated := pod.DeepCopy()
+	updated.ObjectMeta.Finalizers = finalizers
+
+	if err := r.Patch(ctx, updated, client.MergeFrom(pod)); err != nil && !kerrors.IsNotFound(err) {
+		log.Error(err, "Failed to remove finalizer from runner pod")
+		return err
+	}
+
+	*pod = *updated
+
+	return nil
+}
+
+func (r *RunnerReconciler) processRunnerCreation(ctx context.Context, runner v1alpha1.Runner, log logr.Logger, ghc *github.Client) (reconcile.Result, error) {
+	if d := scaleUpPauseDelay(log, r.PauseScaleUpsOnRateLimit, ghc, time.Now()); d > 0 {
+		return ctrl.Result{RequeueAfter: d}, nil
+	}
+
+	if updated, err := r.updateRegistrationToken(ctx, runner, ghc); err != nil {
 		return ctrl.Result{}, err
 	} else if updated {
 		return ctrl.Result{Requeue: true}, nil
 	}
 
-	newPod, err := r.newPod(runner)
+	newPod, err := r.newPod(runner, ghc)
 	if err != nil {
 		log.Error(err, "Could not create pod")
 		return ctrl.Result{}, err
@@ -588,17 +1022,147 @@ func (r *RunnerReconciler) processRunnerCreation(ctx context.Context, runner v1a
 // - (false, err) when it postponed unregistration due to the runner being busy, or it tried to unregister the runner but failed due to
 //   an error returned by GitHub API.
 func (r *RunnerReconciler) unregisterRunner(ctx context.Context, enterprise, org, repo, name string) (bool, error) {
-	return unregisterRunner(ctx, r.GitHubClient, enterprise, org, repo, name)
+	return unregisterRunner(ctx, r.GracefulStopConfig, r.Log, withRunnerOwnership(r.GitHubClient.Default(), r.RunnerOwnership), enterprise, org, repo, name)
+}
+
+// processUnregistrationResult surfaces the runner unregistration that exhausted the retry budget, was denied due to missing permissions,
+// failed due to the scope not found on GitHub, or has no valid scope via an event and the UnregistrationFailed condition, and stops requeueing so that operators can intervene.
+// Any other result is returned as-is.
+func (r *RunnerReconciler) processUnregistrationResult(ctx context.Context, runner v1alpha1.Runner, log logr.Logger, res ctrl.Result, err error) (ctrl.Result, error) {
+	if isInvalidRunnerScope(err) {
+		r.Recorder.Event(&runner, corev1.EventTypeWarning, "InvalidScope", err.Error())
+
+		if err := r.setCondition(ctx, runner, metav1.Condition{
+			Type:    v1alpha1.RunnerConditionUnregistrationFailed,
+			Status:  metav1.ConditionTrue,
+			Reason:  "InvalidScope",
+			Message: fmt.Sprintf("%s. Fix spec.enterprise, spec.organization, or spec.repository of the runner to retry", err.Error()),
+		}); err != nil {
+			log.Error(err, "Failed to update runner status")
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	if !isUnregistrationFailed(err) {
+		return res, err
+	}
+
+	log.Error(err, "Failed to unregister runner. Giving up until the cause is fixed")
+
+	r.Recorder.Event(&runner, corev1.EventTypeWarning, "UnregistrationFailed", err.Error())
+
+	reason := "RetryBudgetExhausted"
+	if isPermissionDeniedError(err) {
+		reason = "PermissionDenied"
+	} else if isScopeNotFoundError(err) {
+		reason = "ScopeNotFound"
+	}
+
+	if err := r.setCondition(ctx, runner, metav1.Condition{
+		Type:    v1alpha1.RunnerConditionUnregistrationFailed,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: fmt.Sprintf("%s. Remove the %s annotation from the runner pod to retry", err.Error(), AnnotationKeyUnregistrationAttempts),
+	}); err != nil {
+		log.Error(err, "Failed to update runner status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *RunnerReconciler) processGitHubAPICredentialsError(ctx context.Context, runner v1alpha1.Runner, log logr.Logger, err error) (reconcile.Result, error) {
+	reason := "InvalidCredentials"
+
+	var insufficientScopes *github.InsufficientTokenScopes
+	if errors.As(err, &insufficientScopes) {
+		reason = "InsufficientTokenScopes"
+	}
+
+	log.Error(err, "Failed to initialize GitHub API client for the runner. Retrying in a minute")
+
+	r.Recorder.Event(&runner, corev1.EventTypeWarning, reason, err.Error())
+
+	if err := r.setCondition(ctx, runner, metav1.Condition{
+		Type:    v1alpha1.RunnerConditionGitHubAPICredentialsValid,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: err.Error(),
+	}); err != nil {
+		log.Error(err, "Failed to update runner status for Conditions")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: time.Minute}, nil
 }
 
-func (r *RunnerReconciler) updateRegistrationToken(ctx context.Context, runner v1alpha1.Runner) (bool, error) {
+func (r *RunnerReconciler) updateGitHubAPICredentialsCondition(ctx context.Context, runner v1alpha1.Runner, log logr.Logger) error {
+	if runner.Spec.GitHubAPICredentialsFrom == nil {
+		return nil
+	}
+
+	if err := r.setCondition(ctx, runner, metav1.Condition{
+		Type:    v1alpha1.RunnerConditionGitHubAPICredentialsValid,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Validated",
+		Message: fmt.Sprintf("Credentials in secret %s have the token scopes required to manage the runner", runner.Spec.GitHubAPICredentialsFrom.SecretRef.Name),
+	}); err != nil {
+		log.Error(err, "Failed to update runner status for Conditions")
+		return err
+	}
+
+	return nil
+}
+
+// updateRegisteredCondition reflects the result of the latest registration check in the Registered condition.
+func (r *RunnerReconciler) updateRegisteredCondition(ctx context.Context, runner v1alpha1.Runner, log logr.Logger, registered bool) error {
+	cond := metav1.Condition{
+		Type:    v1alpha1.RunnerConditionRegistered,
+		Status:  metav1.ConditionTrue,
+		Reason:  "RunnerFound",
+		Message: "The runner is listed on GitHub. Note that ListRunners responses can be cached for up to 60 seconds",
+	}
+
+	if !registered {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "RunnerNotFound"
+		cond.Message = "The runner is not listed on GitHub. Note that ListRunners responses can be cached for up to 60 seconds, so a runner that has just registered may not be listed yet"
+	}
+
+	if err := r.setCondition(ctx, runner, cond); err != nil {
+		log.Error(err, "Failed to update runner status for Conditions")
+		return err
+	}
+
+	return nil
+}
+
+// setCondition patches the runner status with the condition, only when the condition has changed
+// so that we don't trigger another reconcilation loop for nothing.
+func (r *RunnerReconciler) setCondition(ctx context.Context, runner v1alpha1.Runner, cond metav1.Condition) error {
+	cond.ObservedGeneration = runner.Generation
+
+	if cur := meta.FindStatusCondition(runner.Status.Conditions, cond.Type); cur != nil &&
+		cur.Status == cond.Status && cur.Reason == cond.Reason && cur.Message == cond.Message && cur.ObservedGeneration == cond.ObservedGeneration {
+		return nil
+	}
+
+	updated := runner.DeepCopy()
+	meta.SetStatusCondition(&updated.Status.Conditions, cond)
+
+	return r.patchStatus(ctx, &runner, updated, false)
+}
+
+func (r *RunnerReconciler) updateRegistrationToken(ctx context.Context, runner v1alpha1.Runner, ghc *github.Client) (bool, error) {
 	if runner.IsRegisterable() {
 		return false, nil
 	}
 
 	log := r.Log.WithValues("runner", runner.Name)
 
-	rt, err := r.GitHubClient.GetRegistrationToken(ctx, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name)
+	rt, err := ghc.GetRegistrationToken(ctx, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name)
 	if err != nil {
 		r.Recorder.Event(&runner, corev1.EventTypeWarning, "FailedUpdateRegistrationToken", "Updating registration token failed")
 		log.Error(err, "Failed to get new registration token")
@@ -614,7 +1178,7 @@ func (r *RunnerReconciler) updateRegistrationToken(ctx context.Context, runner v
 		ExpiresAt:    metav1.NewTime(rt.GetExpiresAt().Time),
 	}
 
-	if err := r.Status().Patch(ctx, updated, client.MergeFrom(&runner)); err != nil {
+	if err := r.patchStatus(ctx, &runner, updated, false); err != nil {
 		log.Error(err, "Failed to update runner status for Registration")
 		return false, err
 	}
@@ -625,7 +1189,7 @@ func (r *RunnerReconciler) updateRegistrationToken(ctx context.Context, runner v
 	return true, nil
 }
 
-func (r *RunnerReconciler) newPod(runner v1alpha1.Runner) (corev1.Pod, error) {
+func (r *RunnerReconciler) newPod(runner v1alpha1.Runner, ghc *github.Client) (corev1.Pod, error) {
 	var template corev1.Pod
 
 	labels := map[string]string{}
@@ -657,7 +1221,7 @@ func (r *RunnerReconciler) newPod(runner v1alpha1.Runner) (corev1.Pod, error) {
 		filterLabels(runner.ObjectMeta.Labels, LabelKeyRunnerTemplateHash),
 		runner.ObjectMeta.Annotations,
 		runner.Spec,
-		r.GitHubClient.GithubBaseURL,
+		ghc.GithubBaseURL,
 		// Token change should trigger replacement.
 		// We need to include this explicitly here because
 		// runner.Spec does not contain the possibly updated token stored in the
@@ -670,6 +1234,9 @@ func (r *RunnerReconciler) newPod(runner v1alpha1.Runner) (corev1.Pod, error) {
 		Namespace:   runner.ObjectMeta.Namespace,
 		Labels:      labels,
 		Annotations: runner.ObjectMeta.Annotations,
+		// The finalizer makes Kubernetes wait for the runner to be unregistered before deleting the pod.
+		// See processRunnerPodDeletion.
+		Finalizers: []string{runnerPodFinalizerName},
 	}
 
 	template.ObjectMeta = objectMeta
@@ -700,7 +1267,7 @@ func (r *RunnerReconciler) newPod(runner v1alpha1.Runner) (corev1.Pod, error) {
 
 	registrationOnly := metav1.HasAnnotation(runner.ObjectMeta, annotationKeyRegistrationOnly)
 
-	pod, err := newRunnerPod(template, runner.Spec.RunnerConfig, r.RunnerImage, r.RunnerImagePullSecrets, r.DockerImage, r.DockerRegistryMirror, r.GitHubClient.GithubBaseURL, registrationOnly)
+	pod, err := newRunnerPod(template, runner.Spec.RunnerConfig, r.RunnerImage, r.RunnerImagePullSecrets, r.DockerImage, r.DockerRegistryMirror, ghc.GithubBaseURL, registrationOnly)
 	if err != nil {
 		return pod, err
 	}
@@ -1136,6 +1703,14 @@ func newRunnerPod(template corev1.Pod, runnerSpec v1alpha1.RunnerConfig, default
 		}
 	}
 
+	if err := addRunnerLabelTemplates(pod, runnerContainer, runnerSpec.LabelTemplates); err != nil {
+		return *pod, err
+	}
+
+	if err := validatePreUnregistrationExec(runnerSpec.PreUnregistrationExec); err != nil {
+		return *pod, err
+	}
+
 	if runnerContainerIndex == -1 {
 		pod.Spec.Containers = append([]corev1.Container{*runnerContainer}, pod.Spec.Containers...)
 
@@ -1154,6 +1729,10 @@ func newRunnerPod(template corev1.Pod, runnerSpec v1alpha1.RunnerConfig, default
 		}
 	}
 
+	if ephemeral && runnerSpec.JIT != nil && *runnerSpec.JIT {
+		pod.ObjectMeta.Annotations = CloneAndAddLabel(pod.ObjectMeta.Annotations, AnnotationKeyJIT, "true")
+	}
+
 	return *pod, nil
 }
 
@@ -1164,12 +1743,27 @@ func (r *RunnerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 
 	r.Recorder = mgr.GetEventRecorderFor(name)
+	r.statusUpdates = newRunnerStatusCoalescer(r.StatusUpdateWindow)
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.Runner{}, builder.WithPredicates(ignoreUnregistrationAttemptsUpdates())).
+		Owns(&corev1.Pod{}, builder.WithPredicates(ignoreUnregistrationAttemptsUpdates()))
+
+	if r.NodeDrain.Enabled {
+		b = b.Watches(
+			&source.Kind{Type: &corev1.Node{}},
+			handler.EnqueueRequestsFromMapFunc(runnerPodRequestsOnNode(mgr.GetClient(), r.Log, func(pod *corev1.Pod) (reconcile.Request, bool) {
+				owner := metav1.GetControllerOf(pod)
+				if owner == nil || owner.Kind != "Runner" {
+					return reconcile.Request{}, false
+				}
+				return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}}, true
+			})),
+			builder.WithPredicates(nodeBecameUnschedulable()),
+		)
+	}
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.Runner{}).
-		Owns(&corev1.Pod{}).
-		Named(name).
-		Complete(r)
+	return b.Named(name).Complete(r)
 }
 
 func addFinalizer(finalizers []string, finalizerName string) ([]string, bool) {
@@ -0,0 +1,1235 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRunnerPodOrContainerIsStopped(t *testing.T) {
+	terminated := func(name string, exitCode int32) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Name: name,
+			State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode},
+			},
+		}
+	}
+
+	waitingAfter := func(name string, exitCode int32) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Name: name,
+			State: corev1.ContainerState{
+				Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+			},
+			LastTerminationState: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode},
+			},
+		}
+	}
+
+	newPod := func(phase corev1.PodPhase, annotations map[string]string, statuses ...corev1.ContainerStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "runner",
+				Annotations: annotations,
+			},
+			Status: corev1.PodStatus{
+				Phase:             phase,
+				ContainerStatuses: statuses,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		pod     *corev1.Pod
+		want    bool
+		wantErr bool
+	}{
+		{
+			name: "succeeded pod",
+			pod:  newPod(corev1.PodSucceeded, nil),
+			want: true,
+		},
+		{
+			name: "runner exited with 0",
+			pod:  newPod(corev1.PodRunning, nil, terminated("runner", 0), corev1.ContainerStatus{Name: "docker"}),
+			want: true,
+		},
+		{
+			name: "runner exited with 2 by default",
+			pod:  newPod(corev1.PodRunning, nil, terminated("runner", 2)),
+			want: false,
+		},
+		{
+			name: "other container exited with 0 by default",
+			pod:  newPod(corev1.PodRunning, nil, terminated("docker", 0)),
+			want: false,
+		},
+		{
+			name: "custom exit code",
+			pod: newPod(corev1.PodRunning, map[string]string{
+				AnnotationKeyCleanStopExitCodes: "0, 2",
+			}, terminated("runner", 2)),
+			want: true,
+		},
+		{
+			name: "custom exit code observed as the last termination state",
+			pod: newPod(corev1.PodRunning, map[string]string{
+				AnnotationKeyCleanStopExitCodes: "2",
+			}, waitingAfter("runner", 2)),
+			want: true,
+		},
+		{
+			name: "exit code not in the custom set",
+			pod: newPod(corev1.PodRunning, map[string]string{
+				AnnotationKeyCleanStopExitCodes: "2",
+			}, terminated("runner", 0)),
+			want: false,
+		},
+		{
+			name: "custom container names",
+			pod: newPod(corev1.PodRunning, map[string]string{
+				AnnotationKeyCleanStopContainers: "wrapper",
+				AnnotationKeyCleanStopExitCodes:  "2",
+			}, terminated("runner", 1), terminated("wrapper", 2)),
+			want: true,
+		},
+		{
+			name: "invalid exit codes fall back to the default",
+			pod: newPod(corev1.PodRunning, map[string]string{
+				AnnotationKeyCleanStopExitCodes: "two",
+			}, terminated("runner", 0)),
+			want:    true,
+			wantErr: true,
+		},
+		{
+			name: "empty container names fall back to the default",
+			pod: newPod(corev1.PodRunning, map[string]string{
+				AnnotationKeyCleanStopContainers: " , ",
+			}, terminated("runner", 0)),
+			want:    true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := cleanStopConfigFromPod(tt.pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cleanStopConfigFromPod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := runnerPodOrContainerIsStopped(tt.pod, conf); got != tt.want {
+				t.Errorf("runnerPodOrContainerIsStopped() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunnerReconciler_SucceededPodPolicy(t *testing.T) {
+	tests := []struct {
+		name              string
+		ephemeral         *bool
+		policy            v1alpha1.SucceededPodPolicy
+		wantRunnerDeleted bool
+		wantPodDeleted    bool
+	}{
+		{
+			name:              "ephemeral runner is deleted",
+			ephemeral:         nil,
+			wantRunnerDeleted: true,
+		},
+		{
+			name:              "ephemeral runner is deleted regardless of the restart policy",
+			ephemeral:         boolPtr(true),
+			policy:            v1alpha1.SucceededPodPolicyRestart,
+			wantRunnerDeleted: true,
+		},
+		{
+			name:           "persistent runner is restarted by default",
+			ephemeral:      boolPtr(false),
+			wantPodDeleted: true,
+		},
+		{
+			name:           "persistent runner is restarted",
+			ephemeral:      boolPtr(false),
+			policy:         v1alpha1.SucceededPodPolicyRestart,
+			wantPodDeleted: true,
+		},
+		{
+			name:              "persistent runner is deleted",
+			ephemeral:         boolPtr(false),
+			policy:            v1alpha1.SucceededPodPolicyDelete,
+			wantRunnerDeleted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerResponse(http.StatusNoContent, ""),
+			)
+			defer server.Close()
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+			_ = v1alpha1.AddToScheme(scheme)
+
+			runner := &v1alpha1.Runner{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:  "default",
+					Name:       "test1",
+					Finalizers: []string{finalizerName},
+				},
+				Spec: v1alpha1.RunnerSpec{
+					RunnerConfig: v1alpha1.RunnerConfig{
+						Repository:         "test/valid",
+						Ephemeral:          tt.ephemeral,
+						SucceededPodPolicy: tt.policy,
+					},
+				},
+				Status: v1alpha1.RunnerStatus{
+					Registration: v1alpha1.RunnerStatusRegistration{
+						Repository: "test/valid",
+						Token:      fake.RegistrationToken,
+						ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+					},
+				},
+			}
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "test1",
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodSucceeded,
+				},
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner, pod).Build()
+
+			r := &RunnerReconciler{
+				Client:       c,
+				Log:          logr.Discard(),
+				Recorder:     record.NewFakeRecorder(10),
+				Scheme:       scheme,
+				GitHubClient: NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+				RunnerImage:  "example/runner:test",
+				DockerImage:  "example/docker:test",
+			}
+
+			ctx := context.Background()
+			key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			var gotRunner v1alpha1.Runner
+			if err := c.Get(ctx, key, &gotRunner); err != nil {
+				t.Fatal(err)
+			}
+			if deleted := !gotRunner.DeletionTimestamp.IsZero(); deleted != tt.wantRunnerDeleted {
+				t.Errorf("runner deleted = %v, want %v", deleted, tt.wantRunnerDeleted)
+			}
+
+			var gotPod corev1.Pod
+			err := c.Get(ctx, key, &gotPod)
+			if err != nil && !kerrors.IsNotFound(err) {
+				t.Fatal(err)
+			}
+			if deleted := kerrors.IsNotFound(err); deleted != tt.wantPodDeleted {
+				t.Errorf("runner pod deleted = %v, want %v", deleted, tt.wantPodDeleted)
+			}
+		})
+	}
+}
+
+func TestRunnerReconciler_RegisteredCondition(t *testing.T) {
+	listed := fake.Response{Status: http.StatusOK, Body: fake.RunnersListBody}
+	missing := fake.Response{Status: http.StatusOK, Body: `{"total_count": 0, "runners": []}`}
+
+	listRunners := fake.NewScriptedHandler(listed, listed, missing, listed)
+
+	server := fake.NewServer(fake.WithListRunnersHandler(listRunners))
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "test1",
+			Finalizers: []string{finalizerName},
+		},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig: v1alpha1.RunnerConfig{
+				Repository: "test/valid",
+			},
+		},
+		Status: v1alpha1.RunnerStatus{
+			Phase: string(corev1.PodRunning),
+			Registration: v1alpha1.RunnerStatusRegistration{
+				Repository: "test/valid",
+				Token:      fake.RegistrationToken,
+				ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+			},
+		},
+	}
+
+	ghc := newGithubClient(server)
+
+	r := &RunnerReconciler{
+		Log:                         logr.Discard(),
+		Recorder:                    record.NewFakeRecorder(10),
+		Scheme:                      scheme,
+		RunnerImage:                 "example/runner:test",
+		DockerImage:                 "example/docker:test",
+		RegistrationRecheckInterval: time.Nanosecond,
+	}
+
+	pod, err := r.newPod(*runner, ghc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The pod is younger than the registration timeout so that the Registered=False runner is not restarted.
+	pod.CreationTimestamp = metav1.Now()
+	pod.Status.Phase = corev1.PodRunning
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner, &pod).Build()
+
+	r.Client = c
+	r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+	reconcile := func() v1alpha1.Runner {
+		t.Helper()
+
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+
+		var got v1alpha1.Runner
+		if err := c.Get(ctx, key, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		return got
+	}
+
+	assertRegistered := func(runner v1alpha1.Runner, want metav1.ConditionStatus, wantReason string) {
+		t.Helper()
+
+		cond := meta.FindStatusCondition(runner.Status.Conditions, v1alpha1.RunnerConditionRegistered)
+		if cond == nil {
+			t.Fatalf("missing %s condition", v1alpha1.RunnerConditionRegistered)
+		}
+		if cond.Status != want || cond.Reason != wantReason {
+			t.Errorf("unexpected %s condition: got %s/%s, want %s/%s", v1alpha1.RunnerConditionRegistered, cond.Status, cond.Reason, want, wantReason)
+		}
+	}
+
+	first := reconcile()
+	assertRegistered(first, metav1.ConditionTrue, "RunnerFound")
+
+	second := reconcile()
+	assertRegistered(second, metav1.ConditionTrue, "RunnerFound")
+	if second.ResourceVersion != first.ResourceVersion {
+		t.Errorf("runner status was updated although the Registered condition did not change")
+	}
+
+	third := reconcile()
+	assertRegistered(third, metav1.ConditionFalse, "RunnerNotFound")
+
+	fourth := reconcile()
+	assertRegistered(fourth, metav1.ConditionTrue, "RunnerFound")
+
+	if got := len(listRunners.Calls()); got != 4 {
+		t.Errorf("unexpected number of list runners calls: got %d, want 4", got)
+	}
+}
+
+func TestRunnerReconciler_Recycle(t *testing.T) {
+	tests := []struct {
+		name             string
+		recycle          bool
+		wantRemoveRunner int
+		wantPodDeleted   bool
+	}{
+		{
+			name: "runner pod not marked for recycling",
+		},
+		{
+			name:             "runner pod marked for recycling",
+			recycle:          true,
+			wantRemoveRunner: 1,
+			wantPodDeleted:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerHandler(removeRunner),
+			)
+			defer server.Close()
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+			_ = v1alpha1.AddToScheme(scheme)
+
+			runner := &v1alpha1.Runner{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:  "default",
+					Name:       "test1",
+					Finalizers: []string{finalizerName},
+				},
+				Spec: v1alpha1.RunnerSpec{
+					RunnerConfig: v1alpha1.RunnerConfig{
+						Repository: "test/valid",
+					},
+				},
+				Status: v1alpha1.RunnerStatus{
+					Phase: string(corev1.PodRunning),
+					Registration: v1alpha1.RunnerStatusRegistration{
+						Repository: "test/valid",
+						Token:      fake.RegistrationToken,
+						ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+					},
+				},
+			}
+
+			ghc := newGithubClient(server)
+
+			r := &RunnerReconciler{
+				Log:         logr.Discard(),
+				Recorder:    record.NewFakeRecorder(10),
+				Scheme:      scheme,
+				RunnerImage: "example/runner:test",
+				DockerImage: "example/docker:test",
+			}
+
+			pod, err := r.newPod(*runner, ghc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pod.CreationTimestamp = metav1.NewTime(time.Now().Add(-25 * time.Hour))
+			pod.Status.Phase = corev1.PodRunning
+			if tt.recycle {
+				setAnnotation(&pod, AnnotationKeyRecycle, time.Now().Format(time.RFC3339))
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner, &pod).Build()
+
+			r.Client = c
+			r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+			ctx := context.Background()
+			key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if got := len(removeRunner.Calls()); got != tt.wantRemoveRunner {
+				t.Errorf("unexpected number of remove runner calls: got %d, want %d", got, tt.wantRemoveRunner)
+			}
+
+			var updated corev1.Pod
+			err = c.Get(ctx, key, &updated)
+			if deleted := kerrors.IsNotFound(err) || err == nil && !updated.DeletionTimestamp.IsZero(); deleted != tt.wantPodDeleted {
+				t.Errorf("unexpected pod deletion: got %v, want %v (err = %v)", deleted, tt.wantPodDeleted, err)
+			}
+
+			if err == nil && tt.wantPodDeleted {
+				if got := updated.Annotations[AnnotationKeyUnregistrationReason]; got != string(UnregistrationReasonMaxAge) {
+					t.Errorf("unexpected unregistration reason: got %q, want %q", got, UnregistrationReasonMaxAge)
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerReconciler_PodFinalizer(t *testing.T) {
+	removed := fake.Response{Status: http.StatusNoContent}
+	busy := fake.RunnerBusyResponse("test1")
+
+	tests := []struct {
+		name string
+		// podDeletedAgo is how long ago the pod was deleted. Zero means the pod isn't deleted.
+		podDeletedAgo    time.Duration
+		forceDeleted     bool
+		runnerDeleted    bool
+		removeRunner     fake.Response
+		wantRemoveRunner int
+		wantPodGone      bool
+		wantFinalizer    bool
+	}{
+		{
+			name:          "existing pod gets the finalizer",
+			removeRunner:  removed,
+			wantFinalizer: true,
+		},
+		{
+			name:             "deleted pod is unregistered before removal",
+			podDeletedAgo:    time.Second,
+			removeRunner:     removed,
+			wantRemoveRunner: 1,
+			wantPodGone:      true,
+		},
+		{
+			name:             "force-deleted pod is unregistered before removal",
+			podDeletedAgo:    time.Second,
+			forceDeleted:     true,
+			removeRunner:     removed,
+			wantRemoveRunner: 1,
+			wantPodGone:      true,
+		},
+		{
+			name:             "deleted pod of busy runner waits for unregistration",
+			podDeletedAgo:    time.Second,
+			removeRunner:     busy,
+			wantRemoveRunner: 1,
+			wantFinalizer:    true,
+		},
+		{
+			name:          "deleted pod is removed without unregistration after the timeout",
+			podDeletedAgo: 2 * DefaultUnregistrationTimeout,
+			removeRunner:  busy,
+			wantPodGone:   true,
+		},
+		{
+			name:             "runner deletion removes the pod finalizer",
+			runnerDeleted:    true,
+			removeRunner:     removed,
+			wantRemoveRunner: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removeRunner := fake.NewScriptedHandler(tt.removeRunner)
+
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerHandler(removeRunner),
+			)
+			defer server.Close()
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+			_ = v1alpha1.AddToScheme(scheme)
+
+			runner := &v1alpha1.Runner{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:  "default",
+					Name:       "test1",
+					Finalizers: []string{finalizerName},
+				},
+				Spec: v1alpha1.RunnerSpec{
+					RunnerConfig: v1alpha1.RunnerConfig{
+						Repository: "test/valid",
+					},
+				},
+				Status: v1alpha1.RunnerStatus{
+					Phase: string(corev1.PodRunning),
+					Registration: v1alpha1.RunnerStatusRegistration{
+						Repository: "test/valid",
+						Token:      fake.RegistrationToken,
+						ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+					},
+				},
+			}
+
+			ghc := newGithubClient(server)
+
+			r := &RunnerReconciler{
+				Log:         logr.Discard(),
+				Recorder:    record.NewFakeRecorder(10),
+				Scheme:      scheme,
+				RunnerImage: "example/runner:test",
+				DockerImage: "example/docker:test",
+			}
+
+			pod, err := r.newPod(*runner, ghc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pod.CreationTimestamp = metav1.Now()
+			pod.Status.Phase = corev1.PodRunning
+
+			if tt.podDeletedAgo == 0 && !tt.runnerDeleted {
+				// Emulates a pod created by an older version of ARC
+				pod.Finalizers = nil
+			}
+
+			if tt.podDeletedAgo > 0 {
+				pod.DeletionTimestamp = &metav1.Time{Time: time.Now().Add(-tt.podDeletedAgo)}
+			}
+
+			if tt.runnerDeleted {
+				runner.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner, &pod).Build()
+
+			if tt.forceDeleted {
+				var force int64
+				if err := c.Delete(context.Background(), &pod, &client.DeleteOptions{GracePeriodSeconds: &force}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r.Client = c
+			r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+			ctx := context.Background()
+			key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if got := len(removeRunner.Calls()); got != tt.wantRemoveRunner {
+				t.Errorf("unexpected number of remove runner calls: got %d, want %d", got, tt.wantRemoveRunner)
+			}
+
+			var gotPod corev1.Pod
+			err = c.Get(ctx, key, &gotPod)
+			if err != nil && !kerrors.IsNotFound(err) {
+				t.Fatal(err)
+			}
+			if gone := kerrors.IsNotFound(err); gone != tt.wantPodGone {
+				t.Fatalf("runner pod gone = %v, want %v", gone, tt.wantPodGone)
+			}
+			if tt.wantPodGone {
+				return
+			}
+
+			if _, hasFinalizer := removeFinalizer(gotPod.Finalizers, runnerPodFinalizerName); hasFinalizer != tt.wantFinalizer {
+				t.Errorf("runner pod has finalizer = %v, want %v", hasFinalizer, tt.wantFinalizer)
+			}
+		})
+	}
+}
+
+func TestRunnerReconciler_UnregistrationAttemptsStatus(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(
+		fake.RunnerBusyResponse("test1"),
+		fake.RunnerBusyResponse("test1"),
+		fake.Response{Status: http.StatusNoContent},
+	)
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "test1",
+			Finalizers: []string{finalizerName},
+		},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig: v1alpha1.RunnerConfig{
+				Repository: "test/valid",
+			},
+		},
+		Status: v1alpha1.RunnerStatus{
+			Phase: string(corev1.PodRunning),
+			Registration: v1alpha1.RunnerStatusRegistration{
+				Repository: "test/valid",
+				Token:      fake.RegistrationToken,
+				ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+			},
+		},
+	}
+
+	ghc := newGithubClient(server)
+
+	r := &RunnerReconciler{
+		Log:         logr.Discard(),
+		Recorder:    record.NewFakeRecorder(10),
+		Scheme:      scheme,
+		RunnerImage: "example/runner:test",
+		DockerImage: "example/docker:test",
+	}
+
+	pod, err := r.newPod(*runner, ghc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod.CreationTimestamp = metav1.Now()
+	pod.Status.Phase = corev1.PodRunning
+	pod.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner, &pod).Build()
+
+	r.Client = c
+	r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+	for i, want := range []int{1, 2, 0} {
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("reconcile %d: Reconcile() error = %v", i, err)
+		}
+
+		var got v1alpha1.Runner
+		if err := c.Get(ctx, key, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Status.UnregistrationAttempts != want {
+			t.Errorf("reconcile %d: unexpected status.unregistrationAttempts: got %d, want %d", i, got.Status.UnregistrationAttempts, want)
+		}
+	}
+
+	if err := c.Get(ctx, key, &pod); !kerrors.IsNotFound(err) {
+		t.Errorf("expected the runner pod to be gone after the unregistration, got %v", err)
+	}
+}
+
+func TestRunnerReconciler_LastUnregistrationErrorStatus(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(
+		fake.Response{Status: http.StatusBadRequest, Body: `{"message": "Bad request"}`},
+		fake.Response{Status: http.StatusBadRequest, Body: `{"message": "Bad request"}`},
+		fake.Response{Status: http.StatusNoContent},
+	)
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "test1",
+			Finalizers: []string{finalizerName},
+		},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig: v1alpha1.RunnerConfig{
+				Repository: "test/valid",
+			},
+		},
+		Status: v1alpha1.RunnerStatus{
+			Phase: string(corev1.PodRunning),
+			Registration: v1alpha1.RunnerStatusRegistration{
+				Repository: "test/valid",
+				Token:      fake.RegistrationToken,
+				ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+			},
+		},
+	}
+
+	ghc := newGithubClient(server)
+
+	r := &RunnerReconciler{
+		Log:         logr.Discard(),
+		Recorder:    record.NewFakeRecorder(10),
+		Scheme:      scheme,
+		RunnerImage: "example/runner:test",
+		DockerImage: "example/docker:test",
+	}
+
+	pod, err := r.newPod(*runner, ghc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod.CreationTimestamp = metav1.Now()
+	pod.Status.Phase = corev1.PodRunning
+	pod.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner, &pod).Build()
+
+	r.Client = c
+	r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+	get := func() v1alpha1.Runner {
+		t.Helper()
+
+		var got v1alpha1.Runner
+		if err := c.Get(ctx, key, &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err == nil {
+		t.Fatal("reconcile 0: Reconcile() error = nil, want the unregistration error")
+	}
+
+	first := get()
+	if first.Status.LastUnregistrationError == nil || !strings.Contains(first.Status.LastUnregistrationError.Message, "400 Bad request") {
+		t.Fatalf("reconcile 0: unexpected status.lastUnregistrationError: %+v", first.Status.LastUnregistrationError)
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err == nil {
+		t.Fatal("reconcile 1: Reconcile() error = nil, want the unregistration error")
+	}
+
+	second := get()
+	if !reflect.DeepEqual(second.Status.LastUnregistrationError, first.Status.LastUnregistrationError) {
+		t.Errorf("reconcile 1: expected the same error to be kept as-is: got %+v, want %+v", second.Status.LastUnregistrationError, first.Status.LastUnregistrationError)
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("reconcile 2: Reconcile() error = %v", err)
+	}
+
+	if got := get(); got.Status.LastUnregistrationError != nil {
+		t.Errorf("reconcile 2: expected status.lastUnregistrationError to be cleared, got %+v", got.Status.LastUnregistrationError)
+	}
+}
+
+func TestOnlyUnregistrationAttemptsChanged(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test1", ResourceVersion: "1"}}
+
+	counted := pod.DeepCopy()
+	counted.ResourceVersion = "2"
+	counted.Annotations = map[string]string{AnnotationKeyUnregistrationAttemptsTotal: "1"}
+
+	if !onlyUnregistrationAttemptsChanged(pod, counted) {
+		t.Errorf("counting an unregistration attempt on the pod must be ignored")
+	}
+
+	started := counted.DeepCopy()
+	started.ResourceVersion = "3"
+	started.Annotations[AnnotationKeyUnregistrationAttemptsTotal] = "2"
+	started.Annotations[AnnotationKeyUnregistrationAttempts] = "1"
+
+	if onlyUnregistrationAttemptsChanged(counted, started) {
+		t.Errorf("other changes to the pod must not be ignored")
+	}
+
+	runner := &v1alpha1.Runner{ObjectMeta: metav1.ObjectMeta{Name: "test1", ResourceVersion: "1"}}
+
+	runnerCounted := runner.DeepCopy()
+	runnerCounted.ResourceVersion = "2"
+	runnerCounted.Status.UnregistrationAttempts = 1
+
+	if !onlyUnregistrationAttemptsChanged(runner, runnerCounted) {
+		t.Errorf("counting an unregistration attempt on the runner status must be ignored")
+	}
+
+	deleted := runnerCounted.DeepCopy()
+	deleted.ResourceVersion = "3"
+	deleted.Status.UnregistrationAttempts = 2
+	deleted.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	if onlyUnregistrationAttemptsChanged(runnerCounted, deleted) {
+		t.Errorf("other changes to the runner must not be ignored")
+	}
+
+	failed := runnerCounted.DeepCopy()
+	failed.ResourceVersion = "4"
+	failed.Status.LastUnregistrationError = &v1alpha1.RunnerUnregistrationError{Message: "failed", Time: metav1.Now()}
+
+	if !onlyUnregistrationAttemptsChanged(runnerCounted, failed) {
+		t.Errorf("recording the last unregistration error on the runner status must be ignored")
+	}
+}
+
+func TestRunnerReconciler_OwnerDeletionPolicy(t *testing.T) {
+	tests := []struct {
+		name             string
+		policy           v1alpha1.OwnerDeletionPolicy
+		deploymentExists bool
+		wantAborted      bool
+	}{
+		{
+			name:        "complete graceful stop on owner deletion",
+			wantAborted: false,
+		},
+		{
+			name:        "abort graceful stop on owner deletion",
+			policy:      v1alpha1.OwnerDeletionPolicyAbort,
+			wantAborted: true,
+		},
+		{
+			name:             "abort policy doesn't apply to runner replaced on deployment update",
+			policy:           v1alpha1.OwnerDeletionPolicyAbort,
+			deploymentExists: true,
+			wantAborted:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removeRunner := fake.NewScriptedHandler(fake.RunnerBusyResponse("test1"))
+
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerHandler(removeRunner),
+			)
+			defer server.Close()
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+			_ = v1alpha1.AddToScheme(scheme)
+
+			runner := &v1alpha1.Runner{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:         "default",
+					Name:              "test1",
+					Finalizers:        []string{finalizerName},
+					DeletionTimestamp: &metav1.Time{Time: time.Now()},
+					Labels:            map[string]string{LabelKeyRunnerDeploymentName: "example"},
+					OwnerReferences: []metav1.OwnerReference{
+						{
+							APIVersion: v1alpha1.GroupVersion.String(),
+							Kind:       "RunnerReplicaSet",
+							Name:       "example-abcde",
+							UID:        "example-abcde-uid",
+							Controller: boolPtr(true),
+						},
+					},
+				},
+				Spec: v1alpha1.RunnerSpec{
+					RunnerConfig: v1alpha1.RunnerConfig{
+						Repository:          "test/valid",
+						OwnerDeletionPolicy: tt.policy,
+					},
+				},
+				Status: v1alpha1.RunnerStatus{
+					Phase: string(corev1.PodRunning),
+					Registration: v1alpha1.RunnerStatusRegistration{
+						Repository: "test/valid",
+						Token:      fake.RegistrationToken,
+						ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+					},
+				},
+			}
+
+			ghc := newGithubClient(server)
+
+			r := &RunnerReconciler{
+				Log:         logr.Discard(),
+				Recorder:    record.NewFakeRecorder(10),
+				Scheme:      scheme,
+				RunnerImage: "example/runner:test",
+				DockerImage: "example/docker:test",
+			}
+
+			pod, err := r.newPod(*runner, ghc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pod.CreationTimestamp = metav1.Now()
+
+			objs := []client.Object{runner, &pod}
+
+			if tt.deploymentExists {
+				objs = append(objs, &v1alpha1.RunnerDeployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example"}})
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+			r.Client = c
+			r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+			ctx := context.Background()
+			key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			wantRemoveRunner := 1
+			if tt.wantAborted {
+				wantRemoveRunner = 0
+			}
+
+			if got := len(removeRunner.Calls()); got != wantRemoveRunner {
+				t.Errorf("unexpected number of remove runner calls: got %d, want %d", got, wantRemoveRunner)
+			}
+
+			var updatedPod corev1.Pod
+			err = c.Get(ctx, key, &updatedPod)
+			if podDeleted := kerrors.IsNotFound(err); podDeleted != tt.wantAborted {
+				t.Errorf("unexpected pod deletion: got %v, want %v (error: %v)", podDeleted, tt.wantAborted, err)
+			}
+
+			var updatedRunner v1alpha1.Runner
+			if err := c.Get(ctx, key, &updatedRunner); err != nil && !kerrors.IsNotFound(err) {
+				t.Fatal(err)
+			}
+
+			if finalized := len(updatedRunner.Finalizers) == 0; finalized != tt.wantAborted {
+				t.Errorf("unexpected runner finalizer removal: got %v, want %v", finalized, tt.wantAborted)
+			}
+		})
+	}
+}
+
+func TestRunnerReconciler_ForceStop(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(fake.RunnerBusyResponse("test1"))
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "test1",
+			Finalizers:        []string{finalizerName},
+			DeletionTimestamp: &metav1.Time{Time: time.Now()},
+			Annotations:       map[string]string{AnnotationKeyForceStop: time.Now().Format(time.RFC3339)},
+		},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig: v1alpha1.RunnerConfig{
+				Repository: "test/valid",
+			},
+		},
+		Status: v1alpha1.RunnerStatus{
+			Phase: string(corev1.PodRunning),
+			Registration: v1alpha1.RunnerStatusRegistration{
+				Repository: "test/valid",
+				Token:      fake.RegistrationToken,
+				ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+			},
+		},
+	}
+
+	ghc := newGithubClient(server)
+
+	r := &RunnerReconciler{
+		Log:         logr.Discard(),
+		Recorder:    record.NewFakeRecorder(10),
+		Scheme:      scheme,
+		RunnerImage: "example/runner:test",
+		DockerImage: "example/docker:test",
+	}
+
+	pod, err := r.newPod(*runner, ghc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod.CreationTimestamp = metav1.Now()
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner, &pod).Build()
+
+	r.Client = c
+	r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if !res.IsZero() {
+		t.Errorf("expected the busy runner forced to stop not to be retried, got %+v", res)
+	}
+
+	if got := len(removeRunner.Calls()); got != 1 {
+		t.Errorf("expected the runner to be removed from GitHub once, got %d calls", got)
+	}
+
+	var updatedPod corev1.Pod
+	if err := c.Get(ctx, key, &updatedPod); !kerrors.IsNotFound(err) {
+		t.Errorf("expected the runner pod to be deleted, got error %v", err)
+	}
+
+	var updatedRunner v1alpha1.Runner
+	if err := c.Get(ctx, key, &updatedRunner); err != nil && !kerrors.IsNotFound(err) {
+		t.Fatal(err)
+	}
+
+	if len(updatedRunner.Finalizers) != 0 {
+		t.Errorf("expected the runner finalizer to be removed, got %v", updatedRunner.Finalizers)
+	}
+}
+
+func TestRunnerReconciler_ForceStopWithoutPod(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(fake.RunnerBusyResponse("test1"))
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "test1",
+			Finalizers:        []string{finalizerName},
+			DeletionTimestamp: &metav1.Time{Time: time.Now()},
+			Annotations:       map[string]string{AnnotationKeyForceStop: time.Now().Format(time.RFC3339)},
+		},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig: v1alpha1.RunnerConfig{
+				Repository: "test/valid",
+			},
+		},
+		Status: v1alpha1.RunnerStatus{
+			Phase: string(corev1.PodRunning),
+			Registration: v1alpha1.RunnerStatusRegistration{
+				Repository: "test/valid",
+				Token:      fake.RegistrationToken,
+				ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+			},
+		},
+	}
+
+	ghc := newGithubClient(server)
+
+	r := &RunnerReconciler{
+		Log:         logr.Discard(),
+		Recorder:    record.NewFakeRecorder(10),
+		Scheme:      scheme,
+		RunnerImage: "example/runner:test",
+		DockerImage: "example/docker:test",
+	}
+
+	// The runner pod has already gone, e.g. deleted by a node drain.
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner).Build()
+
+	r.Client = c
+	r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if !res.IsZero() {
+		t.Errorf("expected the busy runner forced to stop not to be retried, got %+v", res)
+	}
+
+	if got := len(removeRunner.Calls()); got != 1 {
+		t.Errorf("expected the runner to be removed from GitHub once, got %d calls", got)
+	}
+
+	var updatedRunner v1alpha1.Runner
+	if err := c.Get(ctx, key, &updatedRunner); err != nil && !kerrors.IsNotFound(err) {
+		t.Fatal(err)
+	}
+
+	if len(updatedRunner.Finalizers) != 0 {
+		t.Errorf("expected the runner finalizer to be removed, got %v", updatedRunner.Finalizers)
+	}
+}
+
+func TestRunnerReconciler_DeletionWithMissingCredentialsSecret(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+	)
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	// The secret has been deleted along with the runner.
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "test1",
+			Finalizers:        []string{finalizerName},
+			DeletionTimestamp: &metav1.Time{Time: time.Now()},
+		},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig: v1alpha1.RunnerConfig{
+				Repository: "test/valid",
+				GitHubAPICredentialsFrom: &v1alpha1.GitHubAPICredentialsFrom{
+					SecretRef: v1alpha1.SecretReference{Name: "deleted"},
+				},
+			},
+		},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner).Build()
+
+	r := &RunnerReconciler{
+		Client:       c,
+		Log:          logr.Discard(),
+		Recorder:     record.NewFakeRecorder(10),
+		Scheme:       scheme,
+		GitHubClient: NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+	}
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+
+	var updated v1alpha1.Runner
+	if err := c.Get(ctx, key, &updated); err != nil && !kerrors.IsNotFound(err) {
+		t.Fatal(err)
+	}
+
+	if len(updated.Finalizers) != 0 {
+		t.Errorf("expected the runner to be unregistered with the default client and the finalizer to be removed, got %v", updated.Finalizers)
+	}
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
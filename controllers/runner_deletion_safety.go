@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+)
+
+// RunnerScope is the enterprise, organization, or repository a runner is registered to.
+type RunnerScope struct {
+	Enterprise   string
+	Organization string
+	// Repository is in the form of OWNER/REPO.
+	Repository string
+}
+
+// RunnerDeletionSafetyReason tells why a runner pod is or isn't safe to delete.
+type RunnerDeletionSafetyReason string
+
+const (
+	// RunnerDeletionSafetyReasonJITRunnerStopped is for a stopped JIT runner, which has already deregistered itself.
+	RunnerDeletionSafetyReasonJITRunnerStopped RunnerDeletionSafetyReason = "JITRunnerStopped"
+	// RunnerDeletionSafetyReasonRunnerBusy is for a runner registered on GitHub and running a job.
+	RunnerDeletionSafetyReasonRunnerBusy RunnerDeletionSafetyReason = "RunnerBusy"
+	// RunnerDeletionSafetyReasonRunnerRegistered is for an idle runner registered on GitHub,
+	// which GitHub may assign a job to unless it's unregistered before the runner pod is deleted.
+	RunnerDeletionSafetyReasonRunnerRegistered RunnerDeletionSafetyReason = "RunnerRegistered"
+	// RunnerDeletionSafetyReasonRunnerPodMayAppear is for a runner not found on GitHub whose runner pod isn't observed yet,
+	// but the runner is recently created and its pod may be about to appear.
+	RunnerDeletionSafetyReasonRunnerPodMayAppear RunnerDeletionSafetyReason = "RunnerPodMayAppear"
+	// RunnerDeletionSafetyReasonRunnerPodNotFound is for a runner not found on GitHub nor its runner pod on Kubernetes.
+	RunnerDeletionSafetyReasonRunnerPodNotFound RunnerDeletionSafetyReason = "RunnerPodNotFound"
+	// RunnerDeletionSafetyReasonUnregistered is for a runner pod ARC has already marked as unregistered.
+	RunnerDeletionSafetyReasonUnregistered RunnerDeletionSafetyReason = "Unregistered"
+	// RunnerDeletionSafetyReasonRunnerPodStopped is for a runner pod whose runner has stopped.
+	RunnerDeletionSafetyReasonRunnerPodStopped RunnerDeletionSafetyReason = "RunnerPodStopped"
+	// RunnerDeletionSafetyReasonJITRunnerNotFound is for a JIT runner not found on GitHub, which can't be about to register.
+	RunnerDeletionSafetyReasonJITRunnerNotFound RunnerDeletionSafetyReason = "JITRunnerNotFound"
+	// RunnerDeletionSafetyReasonRunnerPodPending is for a runner not found on GitHub whose runner pod is still pending,
+	// and may register the runner once it's started.
+	RunnerDeletionSafetyReasonRunnerPodPending RunnerDeletionSafetyReason = "RunnerPodPending"
+	// RunnerDeletionSafetyReasonRegistrationRace is for a runner not found on GitHub whose runner pod is recently created
+	// and may be about to register.
+	RunnerDeletionSafetyReasonRegistrationRace RunnerDeletionSafetyReason = "RegistrationRace"
+	// RunnerDeletionSafetyReasonUnregistrationInProgress is for a runner not found on GitHub
+	// whose unregistration has started but not timed out yet.
+	RunnerDeletionSafetyReasonUnregistrationInProgress RunnerDeletionSafetyReason = "UnregistrationInProgress"
+	// RunnerDeletionSafetyReasonUnregistrationTimedOut is for a runner not found on GitHub whose unregistration has timed out.
+	RunnerDeletionSafetyReasonUnregistrationTimedOut RunnerDeletionSafetyReason = "UnregistrationTimedOut"
+	// RunnerDeletionSafetyReasonUnregistrationNotStarted is for a runner not found on GitHub whose unregistration hasn't started yet.
+	RunnerDeletionSafetyReasonUnregistrationNotStarted RunnerDeletionSafetyReason = "UnregistrationNotStarted"
+)
+
+// RunnerDeletionSafety is ARC's determination of whether a runner pod is safe to delete.
+type RunnerDeletionSafety struct {
+	Safe   bool
+	Reason RunnerDeletionSafetyReason
+	// Remaining is how long until the runner pod may become safe to delete, for unsafe results that time out,
+	// e.g. the remaining unregistration timeout. Zero otherwise.
+	Remaining time.Duration
+}
+
+// IsRunnerSafeToDelete tells if the runner pod is safe to delete without unregistering the runner, in the same way as ARC
+// decides it on the graceful stop, but without any side effects like removing the runner from GitHub or annotating the pod.
+// It's intended for tools and other controllers, e.g. a validating webhook denying manual deletions of runner pods.
+//
+// It lists the runners on GitHub to see if the runner is registered. The name is the name of the runner pod, which
+// is looked up on GitHub according to the runner name template and suffix pattern of the config as ARC does.
+// pod can be nil when the runner pod is already gone. config should be the same as the runner controllers are configured with,
+// whose unregistration timeout is overridden by the unregistration timeout annotation of the pod.
+func IsRunnerSafeToDelete(ctx context.Context, api github.RunnerAPI, scope RunnerScope, name string, pod *corev1.Pod, now time.Time, config GracefulStopConfig) (RunnerDeletionSafety, error) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	if isJITRunnerPod(pod) && runnerPodOrContainerIsStopped(pod, runnerPodCleanStopConfig(log, pod)) {
+		return RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonJITRunnerStopped}, nil
+	}
+
+	if err := validateRunnerScope(scope.Enterprise, scope.Organization, scope.Repository); err != nil {
+		return RunnerDeletionSafety{}, err
+	}
+
+	api, ownership := unwrapRunnerOwnership(api)
+
+	name, err := registeredRunnerName(log, config.RunnerNameTemplate, name)
+	if err != nil {
+		return RunnerDeletionSafety{}, err
+	}
+
+	found, err := findRegisteredRunner(ctx, config, log, api, scope.Enterprise, scope.Organization, scope.Repository, name)
+	if err != nil {
+		return RunnerDeletionSafety{}, err
+	}
+
+	if found != nil && (ownership == nil || ownership.Owns(found)) {
+		if found.GetBusy() {
+			return RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonRunnerBusy}, nil
+		}
+
+		return RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonRunnerRegistered}, nil
+	}
+
+	return unregisteredRunnerDeletionSafety(ctx, config, log, pod, now)
+}
+
+// unregisteredRunnerDeletionSafety tells if the runner pod is safe to delete once its runner is known to be missing on GitHub,
+// either because it has just been unregistered or it has never registered.
+// The runner missing on GitHub doesn't always mean the pod can be safely removed, as the runner may be about to register.
+func unregisteredRunnerDeletionSafety(ctx context.Context, config GracefulStopConfig, log logr.Logger, pod *corev1.Pod, now time.Time) (RunnerDeletionSafety, error) {
+	if pod == nil {
+		// If the pod does not exist for the runner,
+		// it may be due to that the runner pod has never been created.
+		// In that case we can safely assume that the runner will never be registered,
+		// unless the runner is so new that the pod may just not be observed yet.
+		if remaining := missingRunnerPodGracePeriodRemaining(ctx, config.RunnerPodNeverCreatedGracePeriod, now); remaining > 0 {
+			return RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonRunnerPodMayAppear, Remaining: remaining}, nil
+		}
+
+		return RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonRunnerPodNotFound}, nil
+	}
+
+	if completed, _ := getAnnotation(pod, unregistrationCompleteTimestamp()); completed != "" {
+		// If it's already unregistered in the previous reconcilation loop,
+		// you can safely assume that it won't get registered again so it's safe to delete the runner pod.
+		return RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonUnregistered}, nil
+	}
+
+	if runnerPodOrContainerIsStopped(pod, runnerPodCleanStopConfig(log, pod)) {
+		// If it's an ephemeral runner with the actions/runner container exited with 0,
+		// we can safely assume that it has unregistered itself from GitHub Actions
+		// so it's natural that RemoveRunner fails due to 404.
+		return RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonRunnerPodStopped}, nil
+	}
+
+	if isJITRunnerPod(pod) {
+		// Unlike a classic runner, a JIT runner missing on GitHub can't be about to register,
+		// so it's expected that it's gone and we don't need to wait for the pod to stop or the unregistration to time out.
+		return RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonJITRunnerNotFound}, nil
+	}
+
+	if remaining := pendingRunnerPodGracePeriodRemaining(pod, config.RunnerPodNeverCreatedGracePeriod, now); remaining > 0 {
+		// The runner pod may be waiting for e.g. a spot instance to come up, and register the runner once it's started.
+		return RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonRunnerPodPending, Remaining: remaining}, nil
+	}
+
+	if remaining := registrationRaceGracePeriodRemaining(pod, config.RegistrationRaceGracePeriod, now); remaining > 0 {
+		// This is case 2-3 described in unregisterRunner.
+		// Deleting the pod now can result in GitHub assigning a job to the runner that is going away,
+		// so we wait until it's more likely that the runner isn't coming up.
+		return RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonRegistrationRace, Remaining: remaining}, nil
+	}
+
+	if ts, _ := getAnnotation(pod, unregistrationStartTimestamp()); ts != "" {
+		t, err := parseUnregistrationTimestamp(ts)
+		if err != nil {
+			return RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonUnregistrationInProgress}, err
+		}
+
+		timeout, _ := EffectiveUnregistrationTimeout(pod, config.UnregistrationTimeout)
+
+		if remaining := t.Add(timeout).Sub(now); remaining > 0 {
+			return RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonUnregistrationInProgress, Remaining: remaining}, nil
+		}
+
+		return RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonUnregistrationTimedOut}, nil
+	}
+
+	// A runner and a runner pod that is created by this version of ARC should match
+	// any of the above branches.
+	//
+	// But we leave this match all branch for potential backward-compatibility.
+	return RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonUnregistrationNotStarted}, nil
+}
+
+// unwrapRunnerOwnership returns the RunnerAPI wrapped by withRunnerOwnership along with the runner ownership,
+// or the RunnerAPI as-is and nil if it isn't wrapped.
+func unwrapRunnerOwnership(client github.RunnerAPI) (github.RunnerAPI, *RunnerOwnership) {
+	if o, ok := client.(*ownershipCheckingRunnerAPI); ok {
+		return o.RunnerAPI, &o.ownership
+	}
+
+	return client, nil
+}
+
+// registeredRunnerName returns the name of the runner registered on GitHub for the runner pod named name,
+// rendered from the runner name template text.
+func registeredRunnerName(log logr.Logger, text, name string) (string, error) {
+	n, err := githubRunnerName(text, name)
+	if err != nil {
+		return "", err
+	}
+
+	if n != name {
+		log.V(1).Info("Looking up the runner by the name rendered from the runner name template", "registeredName", n)
+	}
+
+	return n, nil
+}
+
+// findRegisteredRunner returns the runner registered on GitHub with the name, or nil if it's not found.
+// When more than one runner has the name, it selects one of them per the duplicate runner name policy of the config.
+func findRegisteredRunner(ctx context.Context, config GracefulStopConfig, log logr.Logger, client github.RunnerAPI, enterprise, org, repo, name string) (*gogithub.Runner, error) {
+	runners, err := client.ListRunnersWithFilter(ctx, enterprise, org, repo, github.RunnerFilter{Name: name, All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*gogithub.Runner
+	for _, runner := range runners {
+		if runner.GetName() == name {
+			matches = append(matches, runner)
+		}
+	}
+
+	var found *gogithub.Runner
+	if len(matches) == 1 {
+		found = matches[0]
+	} else if len(matches) > 1 {
+		found, err = selectDuplicateRunner(log, config.DuplicateRunnerNamePolicy, name, matches)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if found == nil {
+		found, err = findSuffixedRunner(ctx, log, client, config.RunnerNameSuffixPattern, enterprise, org, repo, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if found == nil || found.GetID() == int64(0) {
+		return nil, nil
+	}
+
+	return found, nil
+}
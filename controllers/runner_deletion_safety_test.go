@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsRunnerSafeToDelete(t *testing.T) {
+	now := time.Now()
+
+	scope := RunnerScope{Repository: "test/valid"}
+
+	runner := func(busy bool) *gogithub.Runner {
+		return &gogithub.Runner{ID: gogithub.Int64(1), Name: gogithub.String("test1"), Status: gogithub.String("online"), Busy: gogithub.Bool(busy)}
+	}
+
+	newPod := func(age time.Duration, annotations map[string]string, status corev1.PodStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "default",
+				Name:              "test1",
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				Annotations:       annotations,
+			},
+			Status: status,
+		}
+	}
+
+	running := corev1.PodStatus{
+		Phase:             corev1.PodRunning,
+		ContainerStatuses: []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+	}
+
+	succeeded := corev1.PodStatus{Phase: corev1.PodSucceeded}
+
+	tests := []struct {
+		name                        string
+		scope                       RunnerScope
+		runners                     []*gogithub.Runner
+		pod                         *corev1.Pod
+		registrationRaceGracePeriod time.Duration
+		want                        RunnerDeletionSafety
+		wantErr                     bool
+	}{
+		{
+			name:    "busy runner",
+			runners: []*gogithub.Runner{runner(true)},
+			pod:     newPod(time.Hour, nil, running),
+			want:    RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonRunnerBusy},
+		},
+		{
+			name:    "idle runner",
+			runners: []*gogithub.Runner{runner(false)},
+			pod:     newPod(time.Hour, nil, running),
+			want:    RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonRunnerRegistered},
+		},
+		{
+			name:    "stopped JIT runner",
+			runners: []*gogithub.Runner{runner(false)},
+			pod:     newPod(time.Hour, map[string]string{AnnotationKeyJIT: "true"}, succeeded),
+			want:    RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonJITRunnerStopped},
+		},
+		{
+			name: "missing runner pod",
+			want: RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonRunnerPodNotFound},
+		},
+		{
+			name: "already unregistered",
+			pod:  newPod(time.Hour, map[string]string{unregistrationCompleteTimestamp(): formatUnregistrationTimestamp(now)}, running),
+			want: RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonUnregistered},
+		},
+		{
+			name: "stopped runner pod",
+			pod:  newPod(time.Hour, nil, succeeded),
+			want: RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonRunnerPodStopped},
+		},
+		{
+			name: "missing JIT runner",
+			pod:  newPod(time.Hour, map[string]string{AnnotationKeyJIT: "true"}, running),
+			want: RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonJITRunnerNotFound},
+		},
+		{
+			name:                        "recently created runner pod",
+			pod:                         newPod(time.Minute, nil, running),
+			registrationRaceGracePeriod: 3 * time.Minute,
+			want:                        RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonRegistrationRace, Remaining: 2 * time.Minute},
+		},
+		{
+			name:                        "runner pod seen registered",
+			pod:                         newPod(time.Minute, map[string]string{AnnotationKeyRegistrationFirstSeenTimestamp: now.Format(time.RFC3339)}, running),
+			registrationRaceGracePeriod: 3 * time.Minute,
+			want:                        RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonUnregistrationNotStarted},
+		},
+		{
+			name: "unregistration in progress",
+			pod:  newPod(time.Hour, map[string]string{unregistrationStartTimestamp(): formatUnregistrationTimestamp(now.Add(-time.Minute))}, running),
+			want: RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonUnregistrationInProgress, Remaining: 9 * time.Minute},
+		},
+		{
+			name: "unregistration timeout overridden by the annotation",
+			pod: newPod(time.Hour, map[string]string{
+				unregistrationStartTimestamp():     formatUnregistrationTimestamp(now.Add(-time.Minute)),
+				AnnotationKeyUnregistrationTimeout: "30s",
+			}, running),
+			want: RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonUnregistrationTimedOut},
+		},
+		{
+			name: "unregistration timed out",
+			pod:  newPod(time.Hour, map[string]string{unregistrationStartTimestamp(): formatUnregistrationTimestamp(now.Add(-11 * time.Minute))}, running),
+			want: RunnerDeletionSafety{Safe: true, Reason: RunnerDeletionSafetyReasonUnregistrationTimedOut},
+		},
+		{
+			name:    "invalid unregistration start timestamp",
+			pod:     newPod(time.Hour, map[string]string{unregistrationStartTimestamp(): "invalid"}, running),
+			want:    RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonUnregistrationInProgress},
+			wantErr: true,
+		},
+		{
+			name: "unregistration not started",
+			pod:  newPod(time.Hour, nil, running),
+			want: RunnerDeletionSafety{Reason: RunnerDeletionSafetyReasonUnregistrationNotStarted},
+		},
+		{
+			name:    "invalid scope",
+			scope:   RunnerScope{Repository: "valid"},
+			runners: []*gogithub.Runner{runner(true)},
+			pod:     newPod(time.Hour, nil, running),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := scope
+			if tt.scope != (RunnerScope{}) {
+				s = tt.scope
+			}
+
+			api := &fakeRunnerAPI{runners: tt.runners}
+
+			got, err := IsRunnerSafeToDelete(context.Background(), api, s, "test1", tt.pod, now, GracefulStopConfig{UnregistrationTimeout: 10 * time.Minute, RegistrationRaceGracePeriod: tt.registrationRaceGracePeriod})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IsRunnerSafeToDelete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("IsRunnerSafeToDelete() = %+v, want %+v", got, tt.want)
+			}
+
+			if len(api.removed) > 0 {
+				t.Errorf("IsRunnerSafeToDelete() must not remove runners, removed %v", api.removed)
+			}
+		})
+	}
+}
+
+func TestIsRunnerSafeToDelete_RunnerNotOwned(t *testing.T) {
+	api := withRunnerOwnership(&fakeRunnerAPI{runners: []*gogithub.Runner{
+		{ID: gogithub.Int64(1), Name: gogithub.String("test1"), Busy: gogithub.Bool(true)},
+	}}, RunnerOwnership{NamePrefixes: []string{"arc-"}})
+
+	got, err := IsRunnerSafeToDelete(context.Background(), api, RunnerScope{Organization: "test"}, "test1", nil, time.Now(), GracefulStopConfig{UnregistrationTimeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.Safe || got.Reason != RunnerDeletionSafetyReasonRunnerPodNotFound {
+		t.Errorf("expected the runner not owned by ARC to be treated as missing, got %+v", got)
+	}
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/apierrors"
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+)
+
+// DuplicateRunnerNamePolicy determines how ARC unregisters the runner of a runner pod
+// when GitHub lists more than one runner with the name of the runner pod, e.g. when the name is reused across runner groups.
+type DuplicateRunnerNamePolicy string
+
+const (
+	// DuplicateRunnerNamePolicyFail refuses to guess which runner to remove, and retries the unregistration with an error
+	// until the duplicates are resolved, e.g. removed manually, or the unregistration times out.
+	DuplicateRunnerNamePolicyFail DuplicateRunnerNamePolicy = "fail"
+
+	// DuplicateRunnerNamePolicyRemoveAll removes all the runners with the name.
+	DuplicateRunnerNamePolicyRemoveAll DuplicateRunnerNamePolicy = "remove-all"
+
+	// DuplicateRunnerNamePolicyRemoveOfflineOnly treats the online runner as the runner of the runner pod and removes it along with
+	// the offline runners with the same name, which are ghosts left behind by previous runner pods with the name.
+	// It fails the same as DuplicateRunnerNamePolicyFail when more than one of the runners are online.
+	DuplicateRunnerNamePolicyRemoveOfflineOnly DuplicateRunnerNamePolicy = "remove-offline-only"
+)
+
+// selectDuplicateRunner returns the runner to treat as the runner of the runner pod among the runners with the same name,
+// per the policy.
+func selectDuplicateRunner(log logr.Logger, policy DuplicateRunnerNamePolicy, name string, matches []*gogithub.Runner) (*gogithub.Runner, error) {
+	ids := runnerIDs(matches)
+
+	log.Info(
+		"WARNING: Found more than one runner with the same name on GitHub.",
+		"registeredName", name,
+		"runnerIDs", ids,
+		"duplicateRunnerNamePolicy", policy,
+	)
+
+	switch policy {
+	case DuplicateRunnerNamePolicyRemoveAll:
+		return matches[0], nil
+	case DuplicateRunnerNamePolicyRemoveOfflineOnly:
+		var online []*gogithub.Runner
+		for _, runner := range matches {
+			if runner.GetStatus() != "offline" {
+				online = append(online, runner)
+			}
+		}
+
+		switch len(online) {
+		case 0:
+			return matches[0], nil
+		case 1:
+			return online[0], nil
+		}
+
+		return nil, fmt.Errorf("found %d online runners named %q on GitHub, refusing to guess which one to remove: %v", len(online), name, runnerIDs(online))
+	}
+
+	return nil, fmt.Errorf("found %d runners named %q on GitHub, refusing to guess which one to remove: %v", len(matches), name, ids)
+}
+
+// removeDuplicateRunners removes the runners with the name other than the runner with the id, per the policy,
+// so that no ghost runner is left behind with the name.
+// Runners that aren't owned by ARC per the runner ownership are never removed.
+func removeDuplicateRunners(ctx context.Context, log logr.Logger, client github.RunnerAPI, policy DuplicateRunnerNamePolicy, ownership *RunnerOwnership, enterprise, org, repo, name string, id int64) error {
+	if policy == "" || policy == DuplicateRunnerNamePolicyFail {
+		return nil
+	}
+
+	runners, err := client.ListRunnersWithFilter(ctx, enterprise, org, repo, github.RunnerFilter{Name: name, All: true})
+	if err != nil {
+		return err
+	}
+
+	for _, runner := range runners {
+		if runner.GetName() != name || runner.GetID() == id || runner.GetID() == int64(0) {
+			continue
+		}
+
+		if policy == DuplicateRunnerNamePolicyRemoveOfflineOnly && runner.GetStatus() != "offline" {
+			continue
+		}
+
+		if ownership != nil && !ownership.Owns(runner) {
+			log.Info("WARNING: Refused to remove the duplicate runner from GitHub as it isn't managed by ARC.", "runnerID", runner.GetID())
+			continue
+		}
+
+		if err := client.RemoveRunner(ctx, enterprise, org, repo, runner.GetID()); err != nil {
+			var e *apierrors.NotFound
+			if errors.As(err, &e) {
+				continue
+			}
+
+			return fmt.Errorf("failed to remove the duplicate runner %d named %q: %w", runner.GetID(), name, err)
+		}
+
+		log.Info("Removed the duplicate runner from GitHub", "runnerID", runner.GetID(), "status", runner.GetStatus())
+	}
+
+	return nil
+}
+
+func runnerIDs(runners []*gogithub.Runner) []int64 {
+	ids := make([]int64, 0, len(runners))
+	for _, runner := range runners {
+		ids = append(ids, runner.GetID())
+	}
+
+	return ids
+}
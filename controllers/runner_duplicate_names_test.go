@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	gogithub "github.com/google/go-github/v39/github"
+)
+
+func TestUnregisterRunner_DuplicateRunnerNames(t *testing.T) {
+	tests := []struct {
+		policy DuplicateRunnerNamePolicy
+		// statuses are the statuses of the runners with IDs 1 and 2, both named test1.
+		statuses    [2]string
+		wantErr     bool
+		wantRemoved []int64
+	}{
+		{policy: DuplicateRunnerNamePolicyFail, statuses: [2]string{"offline", "online"}, wantErr: true},
+		{policy: DuplicateRunnerNamePolicyRemoveAll, statuses: [2]string{"online", "online"}, wantRemoved: []int64{2, 1}},
+		{policy: DuplicateRunnerNamePolicyRemoveOfflineOnly, statuses: [2]string{"offline", "online"}, wantRemoved: []int64{1, 2}},
+		{policy: DuplicateRunnerNamePolicyRemoveOfflineOnly, statuses: [2]string{"online", "online"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy)+"/"+tt.statuses[0]+"-"+tt.statuses[1], func(t *testing.T) {
+			api := &fakeRunnerAPI{runners: []*gogithub.Runner{
+				{ID: gogithub.Int64(1), Name: gogithub.String("test1"), Status: gogithub.String(tt.statuses[0]), Busy: gogithub.Bool(false)},
+				{ID: gogithub.Int64(2), Name: gogithub.String("test1"), Status: gogithub.String(tt.statuses[1]), Busy: gogithub.Bool(false)},
+				{ID: gogithub.Int64(3), Name: gogithub.String("test2"), Status: gogithub.String("online"), Busy: gogithub.Bool(false)},
+			}}
+
+			ok, err := unregisterRunner(context.Background(), GracefulStopConfig{DuplicateRunnerNamePolicy: tt.policy}, logr.Discard(), api, "", "", "test/valid", "test1")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error for the duplicate runner names")
+				}
+			} else if err != nil || !ok {
+				t.Fatalf("unregisterRunner() = %v, %v", ok, err)
+			}
+
+			if d := cmp.Diff(tt.wantRemoved, api.removed); d != "" {
+				t.Errorf("unexpected removed runners (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestGracefulStopConfig_InvalidDuplicateRunnerNamePolicy(t *testing.T) {
+	if err := (GracefulStopConfig{DuplicateRunnerNamePolicy: "remove"}).Validate(); err == nil {
+		t.Errorf("expected an invalid duplicate runner name policy to be rejected")
+	}
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AnnotationKeyJobSeenTimestamp is the annotation ARC adds to the runner pod when it first saw the runner busy running a job.
+// Its absence along with AnnotationKeyRegistrationFirstSeenTimestamp tells us that the runner has been idle since the registration.
+const AnnotationKeyJobSeenTimestamp = "actions-runner-controller/job-seen-timestamp"
+
+// markRunnerPodJobSeen adds the AnnotationKeyJobSeenTimestamp annotation to the runner pod unless it already has one.
+func markRunnerPodJobSeen(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod) error {
+	if _, ok := getAnnotation(pod, AnnotationKeyJobSeenTimestamp); ok {
+		return nil
+	}
+
+	updated := pod.DeepCopy()
+	setAnnotation(updated, AnnotationKeyJobSeenTimestamp, time.Now().Format(time.RFC3339))
+
+	if err := c.Patch(ctx, updated, client.MergeFrom(pod)); err != nil {
+		log.Error(err, fmt.Sprintf("Failed to patch pod to have %s annotation", AnnotationKeyJobSeenTimestamp))
+		return err
+	}
+
+	*pod = *updated
+
+	return nil
+}
+
+// ephemeralRunnerIdleRemaining returns how long the ephemeral runner can stay idle until it's recreated,
+// which is negative once it has been idle for longer than maxIdle since the registration.
+//
+// It returns false when the idle timeout doesn't apply, i.e. maxIdle is zero, the runner hasn't been seen registered yet,
+// or the runner has been seen running a job, in which case the ephemeral runner exits on its own once the job completes.
+func ephemeralRunnerIdleRemaining(pod *corev1.Pod, maxIdle time.Duration, now time.Time) (time.Duration, bool) {
+	if maxIdle <= 0 {
+		return 0, false
+	}
+
+	if _, ok := getAnnotation(pod, AnnotationKeyJobSeenTimestamp); ok {
+		return 0, false
+	}
+
+	if _, ok := lastJobInfoFromPod(pod); ok {
+		return 0, false
+	}
+
+	v, ok := getAnnotation(pod, AnnotationKeyRegistrationFirstSeenTimestamp)
+	if !ok {
+		return 0, false
+	}
+
+	registered, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, false
+	}
+
+	return registered.Add(maxIdle).Sub(now), true
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRunnerReconciler_EphemeralRunnerMaxIdle(t *testing.T) {
+	const maxIdle = time.Hour
+
+	tests := []struct {
+		name           string
+		ephemeral      bool
+		registeredAgo  time.Duration
+		jobSeen        bool
+		busy           bool
+		wantPodDeleted bool
+		wantJobSeen    bool
+		wantRequeue    bool
+	}{
+		{
+			name:           "idle expired",
+			ephemeral:      true,
+			registeredAgo:  2 * time.Hour,
+			wantPodDeleted: true,
+		},
+		{
+			name:          "idle within the limit",
+			ephemeral:     true,
+			registeredAgo: 10 * time.Minute,
+			wantRequeue:   true,
+		},
+		{
+			name:          "ran a job",
+			ephemeral:     true,
+			registeredAgo: 2 * time.Hour,
+			jobSeen:       true,
+			wantJobSeen:   true,
+		},
+		{
+			name:          "running a job",
+			ephemeral:     true,
+			registeredAgo: 2 * time.Hour,
+			busy:          true,
+			wantJobSeen:   true,
+		},
+		{
+			name:          "not ephemeral",
+			registeredAgo: 2 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runners := fake.RunnersListBody
+			if tt.busy {
+				runners = strings.Replace(runners, `"name": "test1", "os": "linux", "status": "online", "busy": false`, `"name": "test1", "os": "linux", "status": "online", "busy": true`, 1)
+			}
+
+			removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, runners),
+				fake.WithRemoveRunnerHandler(removeRunner),
+			)
+			defer server.Close()
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+			_ = v1alpha1.AddToScheme(scheme)
+
+			runner := &v1alpha1.Runner{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:  "default",
+					Name:       "test1",
+					Finalizers: []string{finalizerName},
+				},
+				Spec: v1alpha1.RunnerSpec{
+					RunnerConfig: v1alpha1.RunnerConfig{
+						Repository: "test/valid",
+						Ephemeral:  &tt.ephemeral,
+					},
+				},
+				Status: v1alpha1.RunnerStatus{
+					Phase: string(corev1.PodRunning),
+					Registration: v1alpha1.RunnerStatusRegistration{
+						Repository: "test/valid",
+						Token:      fake.RegistrationToken,
+						ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+					},
+				},
+			}
+
+			ghc := newGithubClient(server)
+
+			r := &RunnerReconciler{
+				Log:                    logr.Discard(),
+				Recorder:               record.NewFakeRecorder(10),
+				Scheme:                 scheme,
+				RunnerImage:            "example/runner:test",
+				DockerImage:            "example/docker:test",
+				EphemeralRunnerMaxIdle: maxIdle,
+			}
+
+			pod, err := r.newPod(*runner, ghc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pod.CreationTimestamp = metav1.NewTime(time.Now().Add(-tt.registeredAgo - time.Minute))
+			pod.Status.Phase = corev1.PodRunning
+			setAnnotation(&pod, AnnotationKeyRegistrationFirstSeenTimestamp, time.Now().Add(-tt.registeredAgo).Format(time.RFC3339))
+			if tt.jobSeen {
+				setAnnotation(&pod, AnnotationKeyJobSeenTimestamp, time.Now().Add(-time.Minute).Format(time.RFC3339))
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects([]client.Object{runner, &pod}...).Build()
+
+			r.Client = c
+			r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+			ctx := context.Background()
+			key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			var updated corev1.Pod
+			err = c.Get(ctx, key, &updated)
+			if err != nil && !kerrors.IsNotFound(err) {
+				t.Fatal(err)
+			}
+
+			if deleted := kerrors.IsNotFound(err) || !updated.DeletionTimestamp.IsZero(); deleted != tt.wantPodDeleted {
+				t.Errorf("unexpected pod deletion: got %v, want %v", deleted, tt.wantPodDeleted)
+			}
+
+			if removed := len(removeRunner.Calls()) > 0; removed != tt.wantPodDeleted {
+				t.Errorf("unexpected unregistration: got %v, want %v", removed, tt.wantPodDeleted)
+			}
+
+			if _, seen := getAnnotation(&updated, AnnotationKeyJobSeenTimestamp); seen != tt.wantJobSeen {
+				t.Errorf("unexpected presence of %s annotation: got %v, want %v", AnnotationKeyJobSeenTimestamp, seen, tt.wantJobSeen)
+			}
+
+			if requeued := res.RequeueAfter > 0; requeued != tt.wantRequeue {
+				t.Errorf("unexpected RequeueAfter: %v", res.RequeueAfter)
+			} else if tt.wantRequeue && res.RequeueAfter > maxIdle-tt.registeredAgo {
+				t.Errorf("expected to be requeued when the idle timeout expires, got RequeueAfter %v", res.RequeueAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultGitHubRunnerLabelsAnnotation is the default key of the annotation ARC adds to the runner pod
+// to record the labels the runner is registered with on GitHub. The value is a JSON array of the labels.
+const DefaultGitHubRunnerLabelsAnnotation = "actions-runner-controller/github-runner-labels"
+
+// recordGitHubRunnerLabels annotates the runner pod with the labels of the runner found registered on GitHub into the annotation key,
+// so that the labels the runner actually got can be seen on the pod, e.g. during drains and audits.
+// It's a no-op if the key is empty or the pod is already annotated with the same labels.
+func recordGitHubRunnerLabels(ctx context.Context, c client.Client, log logr.Logger, key string, pod *corev1.Pod, runner *gogithub.Runner) error {
+	if key == "" || runner == nil {
+		return nil
+	}
+
+	labels := runnerLabelNames(runner)
+	if labels == nil {
+		labels = []string{}
+	}
+
+	v, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+
+	if current, ok := getAnnotation(pod, key); ok && current == string(v) {
+		return nil
+	}
+
+	updated := pod.DeepCopy()
+	setAnnotation(updated, key, string(v))
+
+	if err := c.Patch(ctx, updated, client.MergeFrom(pod)); err != nil {
+		log.Error(err, fmt.Sprintf("Failed to patch pod to have %s annotation", key))
+		return err
+	}
+
+	*pod = *updated
+
+	return nil
+}
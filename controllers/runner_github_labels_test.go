@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRecordGitHubRunnerLabels(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, `
+{
+  "total_count": 1,
+  "runners": [
+    {"id": 1, "name": "test1", "os": "linux", "status": "online", "busy": false, "labels": [{"id": 1, "name": "self-hosted", "type": "read-only"}, {"id": 2, "name": "gpu", "type": "custom"}]}
+  ]
+}
+`),
+	)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+			Annotations: map[string]string{
+				DefaultGitHubRunnerLabelsAnnotation: `["self-hosted"]`,
+			},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+	registered, err := newGithubClient(server).GetRunner(context.Background(), "", "", "test/valid", pod.Name)
+	if err != nil {
+		t.Fatalf("GetRunner() error = %v", err)
+	}
+
+	if err := recordGitHubRunnerLabels(context.Background(), c, logr.Discard(), DefaultGitHubRunnerLabelsAnnotation, pod, registered); err != nil {
+		t.Fatalf("recordGitHubRunnerLabels() error = %v", err)
+	}
+
+	var got corev1.Pod
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `["self-hosted","gpu"]`; got.Annotations[DefaultGitHubRunnerLabelsAnnotation] != want {
+		t.Errorf("unexpected %s annotation: got %q, want %q", DefaultGitHubRunnerLabelsAnnotation, got.Annotations[DefaultGitHubRunnerLabelsAnnotation], want)
+	}
+}
+
+func TestGitHubRunnerLabelsAnnotation(t *testing.T) {
+	if err := (GracefulStopConfig{GitHubRunnerLabelsAnnotation: "example.com/labels/"}).Validate(); err == nil {
+		t.Errorf("expected an invalid annotation key to be rejected")
+	}
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"}}
+
+	// The disabled annotation must not be patched, which would fail as the pod doesn't exist.
+	c := clientfake.NewClientBuilder().WithScheme(runtime.NewScheme()).Build()
+
+	if err := recordGitHubRunnerLabels(context.Background(), c, logr.Discard(), "", pod, &gogithub.Runner{Name: gogithub.String("test1")}); err != nil {
+		t.Errorf("recordGitHubRunnerLabels() error = %v", err)
+	}
+}
@@ -2,22 +2,26 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"strconv"
 	"time"
 
+	"github.com/actions-runner-controller/actions-runner-controller/controllers/metrics"
 	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/apierrors"
 	"github.com/go-logr/logr"
 	gogithub "github.com/google/go-github/v39/github"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
-	unregistrationCompleteTimestamp = "unregistration-complete-timestamp"
-	unregistrationStartTimestamp    = "unregistration-start-timestamp"
-
 	// DefaultUnregistrationTimeout is the duration until ARC gives up retrying the combo of ListRunners API (to detect the runner ID by name)
 	// and RemoveRunner API (to actually unregister the runner) calls.
 	// This needs to be longer than 60 seconds because a part of the combo, the ListRunners API, seems to use the Cache-Control header of max-age=60s
@@ -27,74 +31,659 @@ const (
 
 	// This can be any value but a larger value can make an unregistration timeout longer than configured in practice.
 	DefaultUnregistrationRetryDelay = 30 * time.Second
+
+	// DefaultPatchConflictRetryDelay is the default delay until retrying the graceful stop after patching the runner pod failed with a conflict.
+	// It's short as conflicts go away as soon as we see the latest pod, but long enough not to hot-loop against another writer.
+	DefaultPatchConflictRetryDelay = 2 * time.Second
+
+	// DefaultMinRateLimitRetryDelay is the default minimum AnnotationKeyRateLimitRetryDelay can shorten the delay until retrying
+	// after hitting GitHub API rate limits to.
+	DefaultMinRateLimitRetryDelay = 10 * time.Second
+
+	// AnnotationKeyUnregistrationTimeout is the annotation to override the unregistration timeout per runner pod.
+	// The value must be parsable by time.ParseDuration, like "10m".
+	AnnotationKeyUnregistrationTimeout = "actions-runner-controller/unregistration-timeout"
+
+	// AnnotationKeyRateLimitRetryDelay is the annotation to override the delay until retrying the unregistration after hitting GitHub API rate limits
+	// per runner pod, e.g. to drain critical runners sooner than others. The value must be parsable by time.ParseDuration, like "15s".
+	// It's clamped to the configured minimum to protect the rate limit shared with other runners.
+	AnnotationKeyRateLimitRetryDelay = "actions-runner-controller/rate-limit-retry-delay"
+
+	// AnnotationKeyRegistrationFirstSeenTimestamp is the annotation ARC adds to the runner pod when it first saw
+	// the runner registered on GitHub.
+	// Its absence tells us that the runner may be still about to register, which is case 2-3 described in unregisterRunner.
+	AnnotationKeyRegistrationFirstSeenTimestamp = "actions-runner-controller/registration-first-seen-timestamp"
+
+	// AnnotationKeyUnregistrationAttempts is the annotation ARC uses to count failed unregistration attempts of the runner pod
+	// that are likely to be permanent, like ones caused by a revoked token or a deleted repository.
+	// Remove it to reset the retry budget after fixing the cause.
+	AnnotationKeyUnregistrationAttempts = "actions-runner-controller/unregistration-attempts"
+
+	// AnnotationKeyUnregistrationAttemptsTotal is the annotation ARC uses to count all the unregistration attempts of the runner pod
+	// that didn't complete the unregistration, including ones postponed due to rate limits, network errors, and busy runners.
+	// Unlike AnnotationKeyUnregistrationAttempts, it's only for observability and never stops ARC from retrying.
+	// It's removed once the unregistration completes.
+	AnnotationKeyUnregistrationAttemptsTotal = "actions-runner-controller/unregistration-attempts-total"
+
+	// AnnotationKeyUnregistrationStartDelay is the annotation ARC uses to store the random delay before the first unregistration attempt
+	// of the runner pod, chosen when the graceful stop started. The value is parsable by time.ParseDuration.
+	AnnotationKeyUnregistrationStartDelay = "actions-runner-controller/unregistration-start-delay"
+
+	// AnnotationKeyReadyToStop is the annotation external tooling adds to the runner pod to permit ARC to start the graceful stop,
+	// when ARC is configured to require it. Its value is ignored.
+	AnnotationKeyReadyToStop = "actions-runner-controller/ready-to-stop"
+)
+
+// randomUnregistrationStartDelay returns a random duration in [0, max). It's a variable for testing.
+var randomUnregistrationStartDelay = func(max time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// UnregistrationFailed is returned by tickRunnerGracefulStop when ARC gave up unregistering the runner
+// after exhausting the retry budget.
+// The caller is expected to surface it to operators, and stop requeueing.
+type UnregistrationFailed struct {
+	Attempts int
+	// Err is the error of the last attempt. It's nil when the budget had been already exhausted in a previous reconciliation.
+	Err error
+}
+
+func (e *UnregistrationFailed) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("gave up unregistering runner after %d failed attempts", e.Attempts)
+	}
+
+	return fmt.Sprintf("gave up unregistering runner after %d failed attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *UnregistrationFailed) Unwrap() error {
+	return e.Err
+}
+
+// UnregistrationTimeoutSource tells where the effective unregistration timeout came from.
+type UnregistrationTimeoutSource string
+
+const (
+	UnregistrationTimeoutSourceAnnotation UnregistrationTimeoutSource = "annotation"
+	UnregistrationTimeoutSourceFlag       UnregistrationTimeoutSource = "flag"
+	UnregistrationTimeoutSourceDefault    UnregistrationTimeoutSource = "default"
 )
 
+// EffectiveUnregistrationTimeout returns the unregistration timeout that ARC applies to the runner pod,
+// along with the source of the value.
+//
+// The precedence is:
+// 1. The AnnotationKeyUnregistrationTimeout annotation on the pod, if it is a valid positive duration
+// 2. The controller-wide value configured via the --unregistration-timeout flag, if positive
+// 3. DefaultUnregistrationTimeout
+func EffectiveUnregistrationTimeout(pod *corev1.Pod, configured time.Duration) (time.Duration, UnregistrationTimeoutSource) {
+	if pod != nil {
+		if v, ok := getAnnotation(pod, AnnotationKeyUnregistrationTimeout); ok {
+			if d, err := time.ParseDuration(v); err == nil && d > 0 {
+				return d, UnregistrationTimeoutSourceAnnotation
+			}
+		}
+	}
+
+	if configured > 0 {
+		return configured, UnregistrationTimeoutSourceFlag
+	}
+
+	return DefaultUnregistrationTimeout, UnregistrationTimeoutSourceDefault
+}
+
 // tickRunnerGracefulStop reconciles the runner and the runner pod in a way so that
 // we can delete the runner pod without disrupting a workflow job.
 //
-// This function returns a non-nil pointer to corev1.Pod as the first return value
+// This function returns a non-nil pointer to corev1.Pod as the first return value along with a nil *ctrl.Result
 // if the runner is considered to have gracefully stopped, hence it's pod is safe for deletion.
 //
+// clock tells the current time used for the unregistration timestamps, and the timeouts and delays measured from them.
+//
+// config configures the graceful stop. Its retry delays make the RequeuePolicy, and its other fields work as follows.
+// ghClient is used as is. Use GracefulStopConfig.tickGracefulStop to unregister the runner via the RunnerAPI wrapped as configured.
+//
+// config.UnregistrationTimeout is the controller-wide timeout configured via the flag. It can be zero, in which case
+// the default is used. See EffectiveUnregistrationTimeout for the precedence.
+//
+// config.RegistrationRaceGracePeriod is the duration since the pod creation during which a runner that isn't found on GitHub
+// and has never been seen registered is considered to be about to register. Zero disables the grace period.
+//
+// config.PostUnregistrationDelay is the duration to wait after the unregistration completed before reporting the pod is safe for deletion,
+// so that e.g. log shippers running in the pod can flush the tail of the runner logs. Zero disables the delay.
+//
+// config.UnregistrationStartJitter is the maximum of the random delay before the first unregistration attempt of the runner pod,
+// so that runners stopped at once, e.g. on a scale down, don't list runners on GitHub at the same time.
+// The delay is chosen once per pod and stored in the AnnotationKeyUnregistrationStartDelay annotation. Zero disables the delay.
+//
+// config.MaxUnregistrationAttempts is the retry budget for failed unregistration attempts that are not transient.
+// Once exhausted, this returns UnregistrationFailed instead of retrying forever.
+// It also returns UnregistrationFailed on the first attempt denied due to missing permissions, or failed due to the enterprise, organization,
+// or repository not found on GitHub, regardless of the budget.
+// Zero disables the budget. The attempts are counted via an annotation on the pod, so the budget doesn't apply when pod is nil.
+//
+// reason tells why the caller selected the runner for the graceful stop. It's recorded in the AnnotationKeyUnregistrationReason
+// annotation when the graceful stop starts, so that it stays the same across ticks.
+//
+// config.RequireReadyToStop makes it hold the graceful stop of the runner pod until the pod is annotated with AnnotationKeyReadyToStop,
+// so that external tooling can decide when each runner drains. It doesn't hold a graceful stop that has already started.
+//
+// If the runner pod has the spec.preUnregistrationExec command of the runner, it's run once before the first unregistration attempt.
+//
 // It's a "tick" operation so a graceful stop can take multiple calls to complete.
 // This function is designed to complete a length graceful stop process in a unblocking way.
 // When it wants to be retried later, the function returns a non-nil *ctrl.Result as the second return value, may or may not populating the error in the second return value.
 // The caller is expected to return the returned ctrl.Result and error to postpone the current reconcilation loop and trigger a scheduled retry.
-func tickRunnerGracefulStop(ctx context.Context, unregistrationTimeout time.Duration, retryDelay time.Duration, log logr.Logger, ghClient *github.Client, c client.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+// Along with a non-nil *ctrl.Result, the first return value can be the pod updated to count the unregistration attempt,
+// which the caller can use to surface the attempts, but it doesn't mean the pod is safe for deletion.
+//
+// Only one call per runner can be in progress at a time, even across controllers and concurrent reconciles,
+// so that we don't patch the same annotations concurrently or call RemoveRunner twice for the same runner.
+func tickRunnerGracefulStop(ctx context.Context, clock Clock, config GracefulStopConfig, reason UnregistrationReason, log logr.Logger, ghClient github.RunnerAPI, c client.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+	requeue := config.requeuePolicy().withDefaults()
+
+	if err := validateRunnerScope(enterprise, organization, repository); err != nil {
+		log.Error(err, "Unable to unregister runner. Giving up until the runner spec is fixed")
+		return pod, &ctrl.Result{}, err
+	}
+
+	unlock, err := runnerGracefulStopLocks.Lock(ctx, runnerGracefulStopLockKey(runner, pod))
+	if err != nil {
+		log.Info("Context is done while waiting for another graceful stop of the same runner to complete. Retrying soon.", "error", err.Error())
+		return nil, &ctrl.Result{RequeueAfter: requeue.InProgressDelay}, nil
+	}
+	defer unlock()
+
 	if pod != nil {
-		if _, ok := getAnnotation(pod, unregistrationStartTimestamp); !ok {
-			updated := pod.DeepCopy()
-			setAnnotation(updated, unregistrationStartTimestamp, time.Now().Format(time.RFC3339))
-			if err := c.Patch(ctx, updated, client.MergeFrom(pod)); err != nil {
-				log.Error(err, fmt.Sprintf("Failed to patch pod to have %s annotation", unregistrationStartTimestamp))
+		pod, err = migrateLegacyGracefulStopAnnotations(ctx, c, pod)
+		if err != nil {
+			log.Error(err, "Failed to patch pod to migrate legacy graceful stop annotations")
+			return nil, &ctrl.Result{}, err
+		}
+
+		_, started := getAnnotation(pod, unregistrationStartTimestamp())
+
+		if _, ready := pod.Annotations[AnnotationKeyReadyToStop]; !started && config.RequireReadyToStop && !ready {
+			log.Info("Holding the graceful stop of the runner until the runner pod is annotated as ready to stop.", "annotation", AnnotationKeyReadyToStop, "reason", reason)
+			return pod, &ctrl.Result{RequeueAfter: requeue.InProgressDelay}, nil
+		}
+
+		if !started {
+			updated, err := patchRunnerPodWithRetries(ctx, c, log, pod, func(updated *corev1.Pod) {
+				setAnnotation(updated, unregistrationStartTimestamp(), formatUnregistrationTimestamp(clock.Now()))
+				if config.UnregistrationStartJitter > 0 {
+					setAnnotation(updated, AnnotationKeyUnregistrationStartDelay, randomUnregistrationStartDelay(config.UnregistrationStartJitter).String())
+				}
+				if reason != "" {
+					setAnnotation(updated, AnnotationKeyUnregistrationReason, string(reason))
+				}
+			})
+			if err != nil {
+				if latest, res := patchConflictResult(ctx, c, log, requeue, pod, err); res != nil {
+					return latest, res, nil
+				}
+				log.Error(err, fmt.Sprintf("Failed to patch pod to have %s annotation", unregistrationStartTimestamp()))
 				return nil, &ctrl.Result{}, err
 			}
 			pod = updated
 
-			log.Info("Runner has started unregistration")
+			log.Info("Runner has started unregistration", "reason", reason)
+			auditGracefulStop(config, GracefulStopAuditPhaseStarted, clock.Now(), enterprise, organization, repository, runner, pod, reason, 0, nil)
 		} else {
-			log.Info("Runner has already started unregistration")
+			log.Info("Runner has already started unregistration", "reason", unregistrationReasonOf(pod, reason))
+		}
+
+		if attempts := unregistrationAttempts(pod); config.MaxUnregistrationAttempts > 0 && attempts >= config.MaxUnregistrationAttempts {
+			return pod, &ctrl.Result{}, &UnregistrationFailed{Attempts: attempts}
+		}
+
+		if remaining := unregistrationStartDelayRemaining(pod, clock.Now()); remaining > 0 && !skipsGracefulStop(config.TerminatingPodUnregistration, pod) {
+			log.Info("Delaying the first unregistration attempt to spread GitHub API calls across runners.", "remaining", remaining)
+			return pod, &ctrl.Result{RequeueAfter: remaining}, nil
+		}
+
+		if !skipsGracefulStop(config.TerminatingPodUnregistration, pod) {
+			updated, res, err := runPreUnregistrationExec(ctx, clock, config, requeue, log, c, pod)
+			if res != nil {
+				return updated, res, err
+			}
+			pod = updated
 		}
 	}
 
-	if res, err := ensureRunnerUnregistration(ctx, unregistrationTimeout, retryDelay, log, ghClient, enterprise, organization, repository, runner, pod); res != nil {
-		return nil, res, err
+	if unregisterTerminatingRunner(ctx, config, log, ghClient, enterprise, organization, repository, runner, pod) {
+		// The pod is going away regardless, so we complete the unregistration without retrying.
+	} else if res, err := ensureRunnerUnregistration(ctx, clock, config, requeue, log, ghClient, enterprise, organization, repository, runner, pod); res != nil {
+		// Retrying won't help until the permissions are fixed, or the scope deleted from GitHub is recreated,
+		// so we give up regardless of the retry budget.
+		permissionDenied := isPermissionDeniedError(err)
+		scopeNotFound := isScopeNotFoundError(err)
+
+		if pod == nil {
+			if permissionDenied || scopeNotFound {
+				return nil, &ctrl.Result{}, &UnregistrationFailed{Attempts: 1, Err: err}
+			}
+
+			return nil, res, err
+		}
+
+		if _, ok := getAnnotation(pod, unregistrationCompleteTimestamp()); ok {
+			// The unregistration has already completed, so this doesn't count as an attempt.
+			return pod, res, err
+		}
+
+		budgeted := err != nil && config.MaxUnregistrationAttempts > 0 && !isTransientUnregistrationError(err)
+
+		var attempts int
+
+		updated, patchErr := patchRunnerPodWithRetries(ctx, c, log, pod, func(updated *corev1.Pod) {
+			setAnnotation(updated, AnnotationKeyUnregistrationAttemptsTotal, strconv.Itoa(unregistrationAttemptsTotal(updated)+1))
+
+			attempts = unregistrationAttempts(updated)
+			if budgeted || permissionDenied || scopeNotFound {
+				attempts++
+				setAnnotation(updated, AnnotationKeyUnregistrationAttempts, strconv.Itoa(attempts))
+			}
+		})
+		if patchErr != nil {
+			if latest, res := patchConflictResult(ctx, c, log, requeue, pod, patchErr); res != nil {
+				return latest, res, nil
+			}
+			log.Error(patchErr, fmt.Sprintf("Failed to patch pod to have %s annotation", AnnotationKeyUnregistrationAttemptsTotal))
+			return nil, &ctrl.Result{}, patchErr
+		}
+
+		if permissionDenied {
+			log.Info("Runner unregistration failed due to missing permissions. Giving up until the permissions are fixed and the annotation is removed.", "attempts", attempts, "annotation", AnnotationKeyUnregistrationAttempts)
+			auditGracefulStop(config, GracefulStopAuditPhaseFailed, clock.Now(), enterprise, organization, repository, runner, updated, reason, unregistrationAttemptsTotal(updated), err)
+			return updated, &ctrl.Result{}, &UnregistrationFailed{Attempts: attempts, Err: err}
+		}
+
+		if scopeNotFound {
+			log.Info("Runner unregistration failed as the scope of the runner was not found on GitHub. Giving up until the scope is recreated or the runner spec is fixed, and the annotation is removed.", "attempts", attempts, "annotation", AnnotationKeyUnregistrationAttempts)
+			auditGracefulStop(config, GracefulStopAuditPhaseFailed, clock.Now(), enterprise, organization, repository, runner, updated, reason, unregistrationAttemptsTotal(updated), err)
+			return updated, &ctrl.Result{}, &UnregistrationFailed{Attempts: attempts, Err: err}
+		}
+
+		if !budgeted {
+			return updated, res, err
+		}
+
+		if attempts >= config.MaxUnregistrationAttempts {
+			log.Info("Runner unregistration has exhausted the retry budget. Giving up until the cause is fixed and the annotation is removed.", "attempts", attempts, "annotation", AnnotationKeyUnregistrationAttempts)
+			auditGracefulStop(config, GracefulStopAuditPhaseFailed, clock.Now(), enterprise, organization, repository, runner, updated, reason, unregistrationAttemptsTotal(updated), err)
+			return updated, &ctrl.Result{}, &UnregistrationFailed{Attempts: attempts, Err: err}
+		}
+
+		log.Info("Runner unregistration failed. Retrying.", "attempts", attempts, "maxAttempts", config.MaxUnregistrationAttempts)
+
+		return updated, res, err
 	}
 
 	if pod != nil {
-		if _, ok := getAnnotation(pod, unregistrationCompleteTimestamp); !ok {
-			updated := pod.DeepCopy()
-			setAnnotation(updated, unregistrationCompleteTimestamp, time.Now().Format(time.RFC3339))
-			if err := c.Patch(ctx, updated, client.MergeFrom(pod)); err != nil {
-				log.Error(err, fmt.Sprintf("Failed to patch pod to have %s annotation", unregistrationCompleteTimestamp))
+		if _, ok := getAnnotation(pod, unregistrationCompleteTimestamp()); !ok {
+			if remaining := shutdownLogMarkerRemaining(ctx, config, log, pod, clock.Now()); remaining > 0 {
+				delay := requeue.InProgressDelay
+				if delay <= 0 || remaining < delay {
+					delay = remaining
+				}
+
+				progressLog := unregistrationProgressLogs.logger(log, config.UnregistrationProgressLogInterval, runnerGracefulStopLockKey(runner, pod), clock.Now())
+				progressLog.Info("Runner has been removed from GitHub. Waiting for the shutdown log marker in the runner container logs before completing the unregistration.", "remaining", remaining)
+
+				return nil, &ctrl.Result{RequeueAfter: delay}, nil
+			}
+
+			var (
+				attempts int
+				lastJob  *LastJobInfo
+			)
+
+			updated, err := patchRunnerPodWithRetries(ctx, c, log, pod, func(updated *corev1.Pod) {
+				// The successful attempt counts, too.
+				attempts = unregistrationAttemptsTotal(updated) + 1
+				delete(updated.Annotations, AnnotationKeyUnregistrationAttemptsTotal)
+
+				// We record the last job the runner ran for auditing and debugging, when the runner told us about it.
+				// It's done along with the completion of the unregistration, as the runner never runs another job after that.
+				lastJob = nil
+				if info, ok := lastJobInfoFromPod(updated); ok {
+					if v, err := json.Marshal(info); err == nil {
+						setAnnotation(updated, AnnotationKeyLastJob, string(v))
+						lastJob = info
+					}
+				}
+
+				setAnnotation(updated, unregistrationCompleteTimestamp(), formatUnregistrationTimestamp(clock.Now()))
+			})
+			if err != nil {
+				if latest, res := patchConflictResult(ctx, c, log, requeue, pod, err); res != nil {
+					return latest, res, nil
+				}
+				log.Error(err, fmt.Sprintf("Failed to patch pod to have %s annotation", unregistrationCompleteTimestamp()))
 				return nil, &ctrl.Result{}, err
 			}
 			pod = updated
 
-			log.Info("Runner has completed unregistration")
+			metrics.ObserveRunnerUnregistrationAttempts(attempts)
+
+			if lastJob != nil {
+				log.Info("Recorded the last job of the runner", "jobID", lastJob.JobID, "runID", lastJob.RunID, "workflow", lastJob.Workflow)
+			}
+
+			if v, ok := getAnnotation(pod, unregistrationStartTimestamp()); ok {
+				if started, err := parseUnregistrationTimestamp(v); err == nil {
+					metrics.ObserveRunnerUnregistrationDuration(string(unregistrationReasonOf(pod, reason)), clock.Now().Sub(started))
+				}
+			}
+
+			log.Info("Runner has completed unregistration", "attempts", attempts)
+			auditGracefulStop(config, GracefulStopAuditPhaseCompleted, clock.Now(), enterprise, organization, repository, runner, pod, reason, attempts, nil)
 		} else {
 			log.Info("Runner has already completed unregistration")
 		}
+
+		if remaining := postUnregistrationDelayRemaining(pod, config.PostUnregistrationDelay, clock.Now()); remaining > 0 {
+			log.Info("Delaying the runner pod deletion after the unregistration.", "postUnregistrationDelay", config.PostUnregistrationDelay, "remaining", remaining)
+			return nil, &ctrl.Result{RequeueAfter: remaining}, nil
+		}
 	}
 
 	return pod, nil, nil
 }
 
+// maxPodPatchConflictRetries is the number of times patchRunnerPodWithRetries re-fetches the runner pod and retries the patch on conflicts,
+// before giving up and letting the caller requeue the graceful stop.
+const maxPodPatchConflictRetries = 3
+
+// patchRunnerPodWithRetries patches the runner pod with the changes made by mutate to a copy of the pod.
+// The pod passed by the caller can be stale, so on a conflict it re-fetches the latest pod and re-applies mutate to it,
+// retrying up to maxPodPatchConflictRetries times. mutate must compute the changes from the pod it's given,
+// not from the original pod, as it's called once per attempt.
+// It returns the patched pod, or the last error, which is a conflict once the retries are exhausted.
+func patchRunnerPodWithRetries(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod, mutate func(*corev1.Pod)) (*corev1.Pod, error) {
+	base := pod
+
+	for i := 0; ; i++ {
+		updated := base.DeepCopy()
+		mutate(updated)
+
+		err := c.Patch(ctx, updated, client.MergeFrom(base))
+		if err == nil {
+			return updated, nil
+		}
+
+		if !kerrors.IsConflict(err) || i >= maxPodPatchConflictRetries {
+			return nil, err
+		}
+
+		var latest corev1.Pod
+		if getErr := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, &latest); getErr != nil {
+			log.V(1).Info("Failed to re-fetch the runner pod after a patch conflict", "error", getErr.Error())
+			return nil, err
+		}
+
+		log.V(1).Info("Retrying to patch the runner pod with the re-fetched pod after a conflict", "retry", i+1, "maxRetries", maxPodPatchConflictRetries, "error", err.Error())
+
+		base = &latest
+	}
+}
+
+// patchConflictResult returns the latest runner pod and the result to retry the graceful stop with after a short delay,
+// when patching the pod failed with a conflict, e.g. because another controller annotated the pod at the same time.
+// Returning the error instead would requeue the pod immediately, which turns into a hot loop as long as the other writer keeps updating the pod.
+// It returns a nil *ctrl.Result if err isn't a conflict.
+func patchConflictResult(ctx context.Context, c client.Client, log logr.Logger, requeue RequeuePolicy, pod *corev1.Pod, err error) (*corev1.Pod, *ctrl.Result) {
+	if !kerrors.IsConflict(err) {
+		return nil, nil
+	}
+
+	latest := pod
+	var fetched corev1.Pod
+	if getErr := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, &fetched); getErr == nil {
+		latest = &fetched
+	} else {
+		log.V(1).Info("Failed to re-fetch the runner pod after a patch conflict", "error", getErr.Error())
+	}
+
+	log.Info("Runner pod was modified concurrently while updating the graceful stop annotations. Retrying with the latest pod soon.", "retryDelay", requeue.ConflictDelay, "error", err.Error())
+
+	return latest, &ctrl.Result{RequeueAfter: requeue.ConflictDelay}
+}
+
+// isPermissionDeniedError returns true if the GitHub API call failed due to missing permissions of the GitHub App or the token.
+func isPermissionDeniedError(err error) bool {
+	var e *apierrors.Forbidden
+	return errors.As(err, &e)
+}
+
+// isScopeNotFoundError returns true if the GitHub API call failed as the enterprise, organization, or repository of the runner
+// was not found on GitHub, e.g. because it has been deleted, as opposed to the runner not being found.
+func isScopeNotFoundError(err error) bool {
+	var e *apierrors.ScopeNotFound
+	return errors.As(err, &e)
+}
+
+// isUnregistrationFailed returns true if err tells that the unregistration exhausted the retry budget.
+func isUnregistrationFailed(err error) bool {
+	var failed *UnregistrationFailed
+	return errors.As(err, &failed)
+}
+
+// unregistrationAttemptsTotal returns the number of unregistration attempts that didn't complete the unregistration recorded on the pod.
+func unregistrationAttemptsTotal(pod *corev1.Pod) int {
+	v, ok := getAnnotation(pod, AnnotationKeyUnregistrationAttemptsTotal)
+	if !ok {
+		return 0
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0
+	}
+
+	return n
+}
+
+// unregistrationAttempts returns the number of failed unregistration attempts recorded on the pod.
+func unregistrationAttempts(pod *corev1.Pod) int {
+	v, ok := getAnnotation(pod, AnnotationKeyUnregistrationAttempts)
+	if !ok {
+		return 0
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0
+	}
+
+	return n
+}
+
+// rateLimitRetryDelay returns the delay until retrying the GitHub API call that failed due to the rate limit or the secondary rate limit,
+// according to the default RequeuePolicy.
+// The second return value is false if err isn't caused by rate limits.
+func rateLimitRetryDelay(err error) (time.Duration, bool) {
+	return DefaultRequeuePolicy().rateLimitRetryDelay(err)
+}
+
+// isTransientUnregistrationError returns true if the unregistration error is likely to go away by retrying,
+// in which case it doesn't consume the retry budget.
+// That includes the runner being busy running a job, as it's expected to finish eventually.
+func isTransientUnregistrationError(err error) bool {
+	var (
+		rateLimitErr          *apierrors.RateLimited
+		secondaryRateLimitErr *apierrors.SecondaryRateLimited
+		transientErr          *apierrors.Transient
+		resErr                *gogithub.ErrorResponse
+		notConfirmedErr       *UnregistrationNotConfirmed
+	)
+
+	switch {
+	case errors.As(err, &rateLimitErr), errors.As(err, &secondaryRateLimitErr), errors.As(err, &transientErr):
+		return true
+	case isRunnerBusyError(err), errors.As(err, &notConfirmedErr):
+		return true
+	case errors.As(err, &resErr) && resErr.Response != nil:
+		return resErr.Response.StatusCode >= 500
+	}
+
+	return false
+}
+
+// errRunnerBusySkipped is returned by unregisterRunner instead of calling RemoveRunner for a runner listed as busy,
+// when the removal of busy runners is skipped.
+var errRunnerBusySkipped = errors.New("runner is still running a job")
+
+// isRunnerBusyError returns true if RemoveRunner failed because the runner is still running a job.
+func isRunnerBusyError(err error) bool {
+	if errors.Is(err, errRunnerBusyDeferred) || errors.Is(err, errRunnerBusySkipped) {
+		return true
+	}
+
+	var e *apierrors.Busy
+
+	return errors.As(err, &e)
+}
+
+// unregistrationStartDelayRemaining returns how long it needs to wait until the first unregistration attempt of the runner pod,
+// or zero if it can be attempted now.
+// The delay is measured since the unregistration start, so it also counts toward the unregistration timeout.
+func unregistrationStartDelayRemaining(pod *corev1.Pod, now time.Time) time.Duration {
+	if _, ok := getAnnotation(pod, unregistrationCompleteTimestamp()); ok {
+		return 0
+	}
+
+	v, ok := getAnnotation(pod, AnnotationKeyUnregistrationStartDelay)
+	if !ok {
+		return 0
+	}
+
+	delay, err := time.ParseDuration(v)
+	if err != nil || delay <= 0 {
+		return 0
+	}
+
+	ts, ok := getAnnotation(pod, unregistrationStartTimestamp())
+	if !ok {
+		return 0
+	}
+
+	t, err := parseUnregistrationTimestamp(ts)
+	if err != nil {
+		return 0
+	}
+
+	remaining := t.Add(delay).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// postUnregistrationDelayRemaining returns how long it needs to wait until the post-unregistration delay elapses since
+// the unregistration completed, or zero if it already elapsed.
+func postUnregistrationDelayRemaining(pod *corev1.Pod, delay time.Duration, now time.Time) time.Duration {
+	if delay <= 0 {
+		return 0
+	}
+
+	ts, ok := getAnnotation(pod, unregistrationCompleteTimestamp())
+	if !ok {
+		return 0
+	}
+
+	t, err := parseUnregistrationTimestamp(ts)
+	if err != nil {
+		return 0
+	}
+
+	remaining := t.Add(delay).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
 // If the first return value is nil, it's safe to delete the runner pod.
-func ensureRunnerUnregistration(ctx context.Context, unregistrationTimeout time.Duration, retryDelay time.Duration, log logr.Logger, ghClient *github.Client, enterprise, organization, repository, runner string, pod *corev1.Pod) (*ctrl.Result, error) {
-	ok, err := unregisterRunner(ctx, ghClient, enterprise, organization, repository, runner)
+// Otherwise the delay until the retry is determined by the requeue policy, depending on why the unregistration is postponed.
+func ensureRunnerUnregistration(ctx context.Context, clock Clock, config GracefulStopConfig, requeue RequeuePolicy, log logr.Logger, ghClient github.RunnerAPI, enterprise, organization, repository, runner string, pod *corev1.Pod) (*ctrl.Result, error) {
+	requeue = requeue.withDefaults().forPod(log, pod)
+
+	if isJITRunnerPod(pod) && runnerPodOrContainerIsStopped(pod, runnerPodCleanStopConfig(log, pod)) {
+		// A stopped JIT runner has already deregistered itself, so there's nothing to list or remove on GitHub.
+		log.Info("JIT runner has stopped and deregistered itself. Skipped unregistering the runner from GitHub.")
+
+		return nil, nil
+	}
+
+	listCtx, listAge := github.WithRunnersListAge(ctx)
+
+	ok, err := unregisterRunner(listCtx, config, log, ghClient, enterprise, organization, repository, runner)
+	if err == nil && !ok && shouldInvalidateRunnerList(log, listAge, runner, pod) {
+		log.Info(
+			"WARNING: Runner seen registered before has repeatedly been missing in the list of runners served from the cache, "+
+				"while the runner is still running. Invalidating the cached list and retrying once uncached.",
+			"cacheAge", listAge.Age.Round(time.Second),
+		)
+
+		metrics.IncRunnersListCacheInvalidations(enterprise, organization, repository)
+
+		listCtx, listAge = github.WithRunnersListAge(github.WithCacheInvalidation(ctx))
+
+		ok, err = unregisterRunner(listCtx, config, log, ghClient, enterprise, organization, repository, runner)
+	}
+
 	if err != nil {
-		if errors.Is(err, &gogithub.RateLimitError{}) {
+		if delay, ok := requeue.rateLimitRetryDelay(err); ok {
 			// We log the underlying error when we failed calling GitHub API to list or unregisters,
 			// or the runner is still busy.
 			log.Error(
 				err,
 				fmt.Sprintf(
 					"Failed to unregister runner due to GitHub API rate limits. Delaying retry for %s to avoid excessive GitHub API calls",
-					retryDelayOnGitHubAPIRateLimitError,
+					delay,
 				),
 			)
 
-			return &ctrl.Result{RequeueAfter: retryDelayOnGitHubAPIRateLimitError}, err
+			metrics.AddGitHubAPIRateLimitDelay(enterprise, organization, repository, delay)
+
+			return &ctrl.Result{RequeueAfter: delay}, err
+		}
+
+		var transientErr *apierrors.Transient
+		if errors.As(err, &transientErr) {
+			// Brief network blips within the cluster are common and not worth an error log.
+			// Requeue without returning the error so that the request is retried with backoff,
+			// without controller-runtime logging it as a reconciler error.
+			log.Info("Failed to unregister runner due to a transient network error. Retrying with backoff.", "error", err.Error())
+
+			var attempts int
+			if pod != nil {
+				attempts = unregistrationAttemptsTotal(pod)
+			}
+
+			return requeue.networkErrorResult(attempts), nil
+		}
+
+		if isRunnerBusyError(err) {
+			// The runner is running a job. We can poll more often than the in-progress delay here,
+			// so that the runner pod is deleted soon after the job completes.
+			busyDelay := requeue.BusyDelay
+			if pod != nil {
+				if ts, ok := getAnnotation(pod, unregistrationStartTimestamp()); ok {
+					if started, err := parseUnregistrationTimestamp(ts); err == nil {
+						timeout, _ := EffectiveUnregistrationTimeout(pod, config.UnregistrationTimeout)
+						busyDelay = requeue.adaptiveDelay(busyDelay, clock.Now().Sub(started), timeout)
+					}
+				}
+			}
+
+			log.Info("Runner is busy running a job. Retrying unregistration later.", "busyRunnerPollInterval", requeue.BusyDelay, "retryDelay", busyDelay)
+
+			return &ctrl.Result{RequeueAfter: busyDelay}, nil
 		}
 
 		log.Error(err, "Failed to unregister runner before deleting the pod.")
@@ -102,52 +691,151 @@ func ensureRunnerUnregistration(ctx context.Context, unregistrationTimeout time.
 		return &ctrl.Result{}, err
 	} else if ok {
 		log.Info("Runner has just been unregistered. Removing the runner pod.")
-	} else if pod == nil {
-		// `r.unregisterRunner()` will returns `false, nil` if the runner is not found on GitHub.
-		// However, that doesn't always mean the pod can be safely removed.
-		//
-		// If the pod does not exist for the runner,
-		// it may be due to that the runner pod has never been created.
-		// In that case we can safely assume that the runner will never be registered.
+	} else {
+		safety, err := unregisteredRunnerDeletionSafety(listCtx, config, log, pod, clock.Now())
+		if err != nil {
+			return &ctrl.Result{RequeueAfter: requeue.InProgressDelay}, err
+		}
+
+		if res := logRunnerDeletionSafety(log, requeue, clock, config, listAge, runner, pod, safety); res != nil {
+			return res, nil
+		}
+	}
+
+	unregistrationProgressLogs.forget(runnerGracefulStopLockKey(runner, pod))
+	staleRunnerListMisses.forget(runnerGracefulStopLockKey(runner, pod))
 
+	return nil, nil
+}
+
+// logRunnerDeletionSafety logs why the runner pod not found on GitHub is or isn't safe to delete,
+// and returns the result to retry later with if it isn't safe yet.
+func logRunnerDeletionSafety(log logr.Logger, requeue RequeuePolicy, clock Clock, config GracefulStopConfig, listAge *github.RunnersListAge, runner string, pod *corev1.Pod, safety RunnerDeletionSafety) *ctrl.Result {
+	requeueAfter := requeue.InProgressDelay
+	if safety.Remaining > 0 && safety.Remaining < requeueAfter {
+		requeueAfter = safety.Remaining
+	}
+
+	switch safety.Reason {
+	case RunnerDeletionSafetyReasonRunnerPodMayAppear:
+		log.Info(
+			"Runner was not found on GitHub and the runner pod was not found on Kubernetes, but the runner is recently created and its pod may be about to appear. Retrying later.",
+			"runnerPodNeverCreatedGracePeriod", config.RunnerPodNeverCreatedGracePeriod,
+			"remaining", safety.Remaining,
+		)
+	case RunnerDeletionSafetyReasonRunnerPodNotFound:
 		log.Info("Runner was not found on GitHub and the runner pod was not found on Kuberntes.")
-	} else if pod.Annotations[unregistrationCompleteTimestamp] != "" {
-		// If it's already unregistered in the previous reconcilation loop,
-		// you can safely assume that it won't get registered again so it's safe to delete the runner pod.
+	case RunnerDeletionSafetyReasonUnregistered:
 		log.Info("Runner pod is marked as already unregistered.")
-	} else if runnerPodOrContainerIsStopped(pod) {
-		// If it's an ephemeral runner with the actions/runner container exited with 0,
-		// we can safely assume that it has unregistered itself from GitHub Actions
-		// so it's natural that RemoveRunner fails due to 404.
-
+	case RunnerDeletionSafetyReasonRunnerPodStopped:
 		// If pod has ended up succeeded we need to restart it
 		// Happens e.g. when dind is in runner and run completes
 		log.Info("Runner pod has been stopped with a successful status.")
-	} else if ts := pod.Annotations[unregistrationStartTimestamp]; ts != "" {
-		t, err := time.Parse(time.RFC3339, ts)
-		if err != nil {
-			return &ctrl.Result{RequeueAfter: retryDelay}, err
+	case RunnerDeletionSafetyReasonJITRunnerNotFound:
+		log.Info("JIT runner was not found on GitHub, as expected for a runner that deregisters itself. Removing the runner pod.")
+	case RunnerDeletionSafetyReasonRunnerPodPending:
+		log.Info(
+			"Runner was not found on GitHub but the runner pod is still pending and may register the runner once it's started. Retrying later.",
+			"podCreationTimestamp", pod.CreationTimestamp,
+			"runnerPodNeverCreatedGracePeriod", config.RunnerPodNeverCreatedGracePeriod,
+			"remaining", safety.Remaining,
+		)
+	case RunnerDeletionSafetyReasonRegistrationRace:
+		kvs := []interface{}{
+			"podCreationTimestamp", pod.CreationTimestamp,
+			"registrationRaceGracePeriod", config.RegistrationRaceGracePeriod,
+			"remaining", safety.Remaining,
 		}
 
-		if r := time.Until(t.Add(unregistrationTimeout)); r > 0 {
-			log.Info("Runner unregistration is in-progress.", "timeout", unregistrationTimeout, "remaining", r)
-			return &ctrl.Result{RequeueAfter: retryDelay}, err
+		if listAge.FromCache {
+			// GitHub allows caching the list of runners for up to a minute, which is a common source of confusion
+			// when the runner is seen registered in GitHub UI but not by ARC.
+			log.Info(
+				"WARNING: Runner was not found on GitHub but the result may be stale, as the list of runners was served from the cache. "+
+					"The runner pod is recently created and may have already registered. Retrying later to avoid racing with the registration.",
+				append(kvs, "cacheAge", listAge.Age.Round(time.Second))...,
+			)
+		} else {
+			log.Info(
+				"Runner was not found on GitHub but the runner pod is recently created and may be about to register. Retrying later to avoid racing with the registration.",
+				kvs...,
+			)
 		}
+	case RunnerDeletionSafetyReasonUnregistrationInProgress:
+		timeout, source := EffectiveUnregistrationTimeout(pod, config.UnregistrationTimeout)
+		progressLog := unregistrationProgressLogs.logger(log, config.UnregistrationProgressLogInterval, runnerGracefulStopLockKey(runner, pod), clock.Now())
+		retryDelay := requeue.adaptiveDelay(requeue.InProgressDelay, timeout-safety.Remaining, timeout)
+		progressLog.Info("Runner unregistration is in-progress.", "timeout", timeout, "timeoutSource", source, "remaining", safety.Remaining, "retryDelay", retryDelay)
 
-		log.Info("Runner unregistration has been timed out. The runner pod will be deleted soon.", "timeout", unregistrationTimeout)
-	} else {
-		// A runner and a runner pod that is created by this version of ARC should match
-		// any of the above branches.
-		//
-		// But we leave this match all branch for potential backward-compatibility.
+		return &ctrl.Result{RequeueAfter: retryDelay}
+	case RunnerDeletionSafetyReasonUnregistrationTimedOut:
+		timeout, source := EffectiveUnregistrationTimeout(pod, config.UnregistrationTimeout)
+		log.Info("Runner unregistration has been timed out. The runner pod will be deleted soon.", "timeout", timeout, "timeoutSource", source)
+	case RunnerDeletionSafetyReasonUnregistrationNotStarted:
 		// The caller is expected to take appropriate actions, like annotating the pod as started the unregistration process,
 		// and retry later.
 		log.V(1).Info("Runner unregistration is being retried later.")
 
-		return &ctrl.Result{RequeueAfter: retryDelay}, nil
+		return &ctrl.Result{RequeueAfter: requeue.InProgressDelay}
 	}
 
-	return nil, nil
+	if !safety.Safe {
+		return &ctrl.Result{RequeueAfter: requeueAfter}
+	}
+
+	return nil
+}
+
+// registrationRaceGracePeriodRemaining returns the remaining duration of the registration race grace period of the runner pod,
+// or zero if the pod is out of the grace period or has been seen registered.
+func registrationRaceGracePeriodRemaining(pod *corev1.Pod, gracePeriod time.Duration, now time.Time) time.Duration {
+	if gracePeriod <= 0 || pod.CreationTimestamp.IsZero() {
+		return 0
+	}
+
+	if _, ok := getAnnotation(pod, AnnotationKeyRegistrationFirstSeenTimestamp); ok {
+		return 0
+	}
+
+	remaining := pod.CreationTimestamp.Add(gracePeriod).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// markRunnerPodRegistrationSeen annotates the runner pod with the time ARC first saw the runner registered on GitHub.
+// It's a no-op if the pod is already annotated.
+func markRunnerPodRegistrationSeen(ctx context.Context, clock Clock, c client.Client, log logr.Logger, pod *corev1.Pod) error {
+	if _, ok := getAnnotation(pod, AnnotationKeyRegistrationFirstSeenTimestamp); ok {
+		return nil
+	}
+
+	updated := pod.DeepCopy()
+	setAnnotation(updated, AnnotationKeyRegistrationFirstSeenTimestamp, formatUnregistrationTimestamp(clock.Now()))
+
+	if err := c.Patch(ctx, updated, client.MergeFrom(pod)); err != nil {
+		log.Error(err, fmt.Sprintf("Failed to patch pod to have %s annotation", AnnotationKeyRegistrationFirstSeenTimestamp))
+		return err
+	}
+
+	*pod = *updated
+
+	return nil
+}
+
+// runnerGracefulStopLocks serializes graceful stops per runner.
+var runnerGracefulStopLocks = newKeyedMutex()
+
+// runnerGracefulStopLockKey returns the namespace/name of the runner pod, which is also the namespaced name of the runner.
+// The pod can be nil when it's already gone, in which case we have only the name to lock on.
+func runnerGracefulStopLockKey(runner string, pod *corev1.Pod) string {
+	if pod == nil {
+		return "/" + runner
+	}
+
+	return pod.Namespace + "/" + pod.Name
 }
 
 func getAnnotation(pod *corev1.Pod, key string) (string, bool) {
@@ -156,10 +844,37 @@ func getAnnotation(pod *corev1.Pod, key string) (string, bool) {
 	}
 
 	v, ok := pod.Annotations[key]
+	if !ok {
+		if legacy, isPrefixed := legacyGracefulStopAnnotationKeys()[key]; isPrefixed {
+			v, ok = pod.Annotations[legacy]
+		}
+	}
 
 	return v, ok
 }
 
+// formatUnregistrationTimestamp formats the time for the unregistration start and complete timestamp annotations.
+// The time is always in UTC so that the annotations read the same regardless of the timezone of the node ARC runs on.
+func formatUnregistrationTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseUnregistrationTimestamp parses the value of the unregistration start or complete timestamp annotation.
+// It accepts both RFC3339Nano and RFC3339 so that annotations added by older versions of ARC,
+// that formatted the local time in RFC3339, keep working.
+func parseUnregistrationTimestamp(v string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		if legacy, legacyErr := time.Parse(time.RFC3339, v); legacyErr == nil {
+			return legacy, nil
+		}
+
+		return time.Time{}, err
+	}
+
+	return t, nil
+}
+
 func setAnnotation(pod *corev1.Pod, key, value string) {
 	if pod.Annotations == nil {
 		pod.Annotations = map[string]string{}
@@ -172,7 +887,7 @@ func setAnnotation(pod *corev1.Pod, key, value string) {
 //
 // This function returns:
 //
-// Case 1. (true, nil) when it has successfully unregistered the runner.
+// Case 1. (true, nil) when it has successfully unregistered the runner, or RemoveRunner returned 404 for the runner ID we've just seen in ListRunners.
 // Case 2. (false, nil) when (2-1.) the runner has been already unregistered OR (2-2.) the runner will never be created OR (2-3.) the runner is not created yet and it is about to be registered(hence we couldn't see it's existence from GitHub Actions API yet)
 // Case 3. (false, err) when it postponed unregistration due to the runner being busy, or it tried to unregister the runner but failed due to
 //   an error returned by GitHub API.
@@ -203,24 +918,81 @@ func setAnnotation(pod *corev1.Pod, key, value string) {
 // There isn't a single right grace period that works for everyone.
 // The longer the grace period is, the earlier a cluster resource shortage can occur due to throttoled runner pod deletions,
 // while the shorter the grace period is, the more likely you may encounter the race issue.
-func unregisterRunner(ctx context.Context, client *github.Client, enterprise, org, repo, name string) (bool, error) {
-	runners, err := client.ListRunners(ctx, enterprise, org, repo)
+// ensureRunnerUnregistration implements it as the registration race grace period, configurable via --registration-race-grace-period,
+// which applies only until ARC sees the runner registered on GitHub for the first time.
+//
+// With the runner ownership configured via withRunnerOwnership, a runner that isn't owned by ARC is never removed
+// and is reported as "Case 2." as if it wasn't found.
+//
+// The runner is looked up on GitHub per config.RunnerNameTemplate, config.DuplicateRunnerNamePolicy, and config.RunnerNameSuffixPattern,
+// and config.SkipBusyRunnerRemoval makes it not call RemoveRunner for a runner listed as busy.
+func unregisterRunner(ctx context.Context, config GracefulStopConfig, log logr.Logger, client github.RunnerAPI, enterprise, org, repo, name string) (bool, error) {
+	client, ownership := unwrapRunnerOwnership(client)
+
+	name, err := registeredRunnerName(log, config.RunnerNameTemplate, name)
 	if err != nil {
 		return false, err
 	}
 
-	id := int64(0)
-	for _, runner := range runners {
-		if runner.GetName() == name {
-			id = runner.GetID()
-			break
-		}
+	found, err := findRegisteredRunner(ctx, config, log, client, enterprise, org, repo, name)
+	if err != nil {
+		return false, err
 	}
 
-	if id == int64(0) {
+	if found == nil {
 		return false, nil
 	}
 
+	id := found.GetID()
+	busy := found.GetBusy()
+
+	// This helps diagnosing the runner pod matched to a wrong runner, e.g. in an organization shared with other ARC installations.
+	log.V(2).Info(
+		"Matched the runner on GitHub",
+		"runnerID", id,
+		"registeredName", found.GetName(),
+		"status", found.GetStatus(),
+		"busy", busy,
+		"os", found.GetOS(),
+		"labels", runnerLabelNames(found),
+	)
+
+	if ownership != nil && !ownership.Owns(found) {
+		// The runner pod is going away without its runner, if any, ever registered under this name,
+		// so we treat it the same as the runner not being found.
+		log.Info(
+			"WARNING: Refused to remove the runner from GitHub as it isn't managed by ARC. It has the same name as the runner pod but doesn't match the configured runner ownership.",
+			"runnerID", id,
+			"labels", runnerLabelNames(found),
+			"managedNamePrefixes", ownership.NamePrefixes,
+			"managedLabels", ownership.Labels,
+		)
+
+		return false, nil
+	}
+
+	if _, ok := client.(*deferringRunnerAPI); ok {
+		// The runner is removed from GitHub by OfflineRunnerCleaner once it goes offline after the pod deletion.
+		// We can't rely on RemoveRunner failing for a busy runner here, so we see the busy flag instead.
+		if busy {
+			return false, errRunnerBusyDeferred
+		}
+
+		log.Info("Skipped removing the runner from GitHub as the inline unregistration is disabled.", "runnerID", id)
+
+		return true, nil
+	}
+
+	if err := removeDuplicateRunners(ctx, log, client, config.DuplicateRunnerNamePolicy, ownership, enterprise, org, repo, name, id); err != nil {
+		return false, err
+	}
+
+	if config.SkipBusyRunnerRemoval && busy {
+		log.V(1).Info("Skipped removing the runner from GitHub as it's listed as busy.", "runnerID", id)
+
+		return false, errRunnerBusySkipped
+	}
+
 	// For the record, historically ARC did not try to call RemoveRunner on a busy runner, but it's no longer true.
 	// The reason ARC did so was to let a runner running a job to not stop prematurely.
 	//
@@ -242,8 +1014,28 @@ func unregisterRunner(ctx context.Context, client *github.Client, enterprise, or
 	//
 	// TODO: Probably we can just remove the runner by ID without seeing if the runner is busy, by treating it as busy when a remove-runner call failed with 422?
 	if err := client.RemoveRunner(ctx, enterprise, org, repo, id); err != nil {
+		// ListRunners responses can be cached for up to 60 seconds, so the runner we found above may have been
+		// removed already, either by ARC in a previous reconcilation loop or by the runner itself.
+		// A 404 here means the runner is gone, which is exactly what we wanted.
+		var e *apierrors.NotFound
+		if errors.As(err, &e) {
+			log.Info("Runner was listed on GitHub but RemoveRunner returned 404. Considering it as already unregistered.", "runnerID", id)
+
+			return true, nil
+		}
+
+		if isRunnerBusyError(err) {
+			metrics.IncRemoveRunnerBusy(enterprise, org, repo)
+		}
+
 		return false, err
 	}
 
+	if c, ok := client.(*confirmingRunnerAPI); ok {
+		if err := c.confirmRunnerRemoval(ctx, log, enterprise, org, repo, name, id); err != nil {
+			return false, err
+		}
+	}
+
 	return true, nil
 }
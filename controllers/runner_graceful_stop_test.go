@@ -0,0 +1,1914 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/apierrors"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestEffectiveUnregistrationTimeout(t *testing.T) {
+	podWithAnnotations := func(annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "runner",
+				Annotations: annotations,
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		pod        *corev1.Pod
+		configured time.Duration
+		want       time.Duration
+		wantSource UnregistrationTimeoutSource
+	}{
+		{
+			name:       "annotation",
+			pod:        podWithAnnotations(map[string]string{AnnotationKeyUnregistrationTimeout: "10m"}),
+			configured: 2 * time.Minute,
+			want:       10 * time.Minute,
+			wantSource: UnregistrationTimeoutSourceAnnotation,
+		},
+		{
+			name:       "invalid annotation falls back to flag",
+			pod:        podWithAnnotations(map[string]string{AnnotationKeyUnregistrationTimeout: "ten minutes"}),
+			configured: 2 * time.Minute,
+			want:       2 * time.Minute,
+			wantSource: UnregistrationTimeoutSourceFlag,
+		},
+		{
+			name:       "non-positive annotation falls back to flag",
+			pod:        podWithAnnotations(map[string]string{AnnotationKeyUnregistrationTimeout: "0s"}),
+			configured: 2 * time.Minute,
+			want:       2 * time.Minute,
+			wantSource: UnregistrationTimeoutSourceFlag,
+		},
+		{
+			name:       "flag",
+			pod:        podWithAnnotations(nil),
+			configured: 2 * time.Minute,
+			want:       2 * time.Minute,
+			wantSource: UnregistrationTimeoutSourceFlag,
+		},
+		{
+			name:       "default",
+			pod:        podWithAnnotations(nil),
+			want:       DefaultUnregistrationTimeout,
+			wantSource: UnregistrationTimeoutSourceDefault,
+		},
+		{
+			name:       "nil pod",
+			pod:        nil,
+			configured: 2 * time.Minute,
+			want:       2 * time.Minute,
+			wantSource: UnregistrationTimeoutSourceFlag,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, source := EffectiveUnregistrationTimeout(tt.pod, tt.configured)
+			if got != tt.want {
+				t.Errorf("EffectiveUnregistrationTimeout() got = %v, want %v", got, tt.want)
+			}
+			if source != tt.wantSource {
+				t.Errorf("EffectiveUnregistrationTimeout() source = %v, want %v", source, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestUnregisterRunner(t *testing.T) {
+	tests := []struct {
+		name         string
+		runner       string
+		removeStatus int
+		want         bool
+		wantErr      bool
+	}{
+		{
+			name:         "removed",
+			runner:       "test1",
+			removeStatus: http.StatusNoContent,
+			want:         true,
+		},
+		{
+			name:         "listed but already removed",
+			runner:       "test1",
+			removeStatus: http.StatusNotFound,
+			want:         true,
+		},
+		{
+			name:         "not listed",
+			runner:       "test3",
+			removeStatus: http.StatusNoContent,
+			want:         false,
+		},
+		{
+			name:         "remove failed",
+			runner:       "test1",
+			removeStatus: http.StatusInternalServerError,
+			want:         false,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerResponse(tt.removeStatus, ""),
+			)
+			defer server.Close()
+
+			client := newGithubClient(server)
+
+			got, err := unregisterRunner(context.Background(), GracefulStopConfig{}, logr.Discard(), client, "", "", "test/valid", tt.runner)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unregisterRunner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("unregisterRunner() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnregisterRunner_MatchedRunnerDebugLog(t *testing.T) {
+	client := &fakeRunnerAPI{
+		runners: []*gogithub.Runner{
+			{
+				ID:     gogithub.Int64(42),
+				Name:   gogithub.String("test1"),
+				OS:     gogithub.String("linux"),
+				Status: gogithub.String("online"),
+				Labels: []*gogithub.RunnerLabels{{Name: gogithub.String("self-hosted")}},
+			},
+		},
+	}
+
+	var logs []string
+
+	log := funcr.New(func(prefix, args string) {
+		logs = append(logs, args)
+	}, funcr.Options{Verbosity: 2})
+
+	if _, err := unregisterRunner(context.Background(), GracefulStopConfig{}, log, client, "", "", "test/valid", "test1"); err != nil {
+		t.Fatalf("unregisterRunner() error = %v", err)
+	}
+
+	for _, l := range logs {
+		if strings.Contains(l, "Matched the runner on GitHub") {
+			for _, want := range []string{`"runnerID"=42`, `"status"="online"`, `"os"="linux"`, `"self-hosted"`} {
+				if !strings.Contains(l, want) {
+					t.Errorf("expected the debug log to contain %s: %s", want, l)
+				}
+			}
+			return
+		}
+	}
+
+	t.Errorf("expected the debug log of the matched runner, got %v", logs)
+}
+
+func TestTickRunnerGracefulStop_LastJob(t *testing.T) {
+	newPod := func(msg string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "test1",
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "runner",
+						LastTerminationState: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{Message: msg},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+		wantOk  bool
+	}{
+		{
+			name:    "job info written by the runner",
+			message: `{"jobID":123,"runID":456,"workflow":"CI","repository":"test/valid"}` + "\n",
+			want:    `{"jobID":123,"runID":456,"workflow":"CI","repository":"test/valid"}`,
+			wantOk:  true,
+		},
+		{
+			name:    "no termination message",
+			message: "",
+			wantOk:  false,
+		},
+		{
+			name:    "unrelated termination message",
+			message: "runner exited",
+			wantOk:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+			)
+			defer server.Close()
+
+			pod := newPod(tt.message)
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+			updated, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, BusyRunnerPollInterval: time.Second}, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", pod.Name, pod)
+			if err != nil || res != nil {
+				t.Fatalf("tickRunnerGracefulStop() res = %v, err = %v", res, err)
+			}
+
+			var live corev1.Pod
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, p := range []*corev1.Pod{updated, &live} {
+				if _, ok := getAnnotation(p, unregistrationCompleteTimestamp()); !ok {
+					t.Errorf("expected %s annotation to be set", unregistrationCompleteTimestamp())
+				}
+
+				got, ok := getAnnotation(p, AnnotationKeyLastJob)
+				if ok != tt.wantOk {
+					t.Fatalf("unexpected presence of %s annotation: got %v, want %v", AnnotationKeyLastJob, ok, tt.wantOk)
+				}
+				if got != tt.want {
+					t.Errorf("unexpected %s annotation: got %q, want %q", AnnotationKeyLastJob, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_RegistrationRaceGracePeriod(t *testing.T) {
+	newPod := func(createdAgo time.Duration, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "default",
+				Name:              "test3",
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-createdAgo)),
+				Annotations:       annotations,
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+			},
+		}
+	}
+
+	seen := map[string]string{
+		AnnotationKeyRegistrationFirstSeenTimestamp: time.Now().Add(-time.Minute).Format(time.RFC3339),
+	}
+
+	tests := []struct {
+		name        string
+		pod         *corev1.Pod
+		gracePeriod time.Duration
+		// wantGrace is true when ARC is expected to wait for the registration until the end of the grace period,
+		// rather than retrying the unregistration after the usual retry delay.
+		wantGrace bool
+	}{
+		{
+			name:        "created seconds ago and not registered yet",
+			pod:         newPod(5*time.Second, nil),
+			gracePeriod: time.Minute,
+			wantGrace:   true,
+		},
+		{
+			name:        "created seconds ago but seen registered before",
+			pod:         newPod(5*time.Second, seen),
+			gracePeriod: time.Minute,
+		},
+		{
+			name:        "out of the grace period",
+			pod:         newPod(2*time.Minute, nil),
+			gracePeriod: time.Minute,
+		},
+		{
+			name:        "grace period disabled",
+			pod:         newPod(5*time.Second, nil),
+			gracePeriod: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+			)
+			defer server.Close()
+
+			retryDelay := 5 * time.Minute
+
+			res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, RegistrationRaceGracePeriod: tt.gracePeriod}, RequeuePolicy{InProgressDelay: retryDelay}, logr.Discard(), newGithubClient(server), "", "", "test/valid", tt.pod.Name, tt.pod)
+			if err != nil {
+				t.Fatalf("ensureRunnerUnregistration() error = %v", err)
+			}
+			if res == nil {
+				t.Fatal("ensureRunnerUnregistration() = nil, want requeue")
+			}
+
+			if tt.wantGrace {
+				if res.RequeueAfter <= 0 || res.RequeueAfter > tt.gracePeriod {
+					t.Errorf("unexpected RequeueAfter: got %v, want within the grace period %v", res.RequeueAfter, tt.gracePeriod)
+				}
+			} else if res.RequeueAfter != retryDelay {
+				t.Errorf("unexpected RequeueAfter: got %v, want %v", res.RequeueAfter, retryDelay)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_RegistrationRaceGracePeriod_StaleCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, max-age=60, s-maxage=60")
+		w.Header().Set("Date", time.Now().Add(-20*time.Second).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, fake.RunnersListBody)
+	}))
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "test3",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-5 * time.Second)),
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+
+	ghClient := newGithubClient(server)
+
+	for i, wantStale := range []bool{false, true} {
+		var logs []string
+
+		log := funcr.New(func(prefix, args string) {
+			logs = append(logs, args)
+		}, funcr.Options{})
+
+		res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, RegistrationRaceGracePeriod: time.Minute}, RequeuePolicy{InProgressDelay: 5 * time.Minute}, log, ghClient, "", "", "test/valid", pod.Name, pod)
+		if err != nil {
+			t.Fatalf("call %d: ensureRunnerUnregistration() error = %v", i, err)
+		}
+		if res == nil || res.RequeueAfter <= 0 || res.RequeueAfter > time.Minute {
+			t.Fatalf("call %d: ensureRunnerUnregistration() = %v, want requeue within the grace period", i, res)
+		}
+
+		all := strings.Join(logs, "\n")
+
+		if stale := strings.Contains(all, "the result may be stale") && strings.Contains(all, `"cacheAge"`); stale != wantStale {
+			t.Errorf("call %d: unexpected stale cache warning = %v, want %v: %s", i, stale, wantStale, all)
+		}
+	}
+}
+
+func TestEnsureRunnerUnregistration_TransientNetworkError(t *testing.T) {
+	ghClient := &github.Client{
+		Client: gogithub.NewClient(&http.Client{
+			Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+				return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+			}),
+		}),
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+	}
+
+	res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute}, RequeuePolicy{InProgressDelay: time.Second, BusyDelay: time.Second}, logr.Discard(), ghClient, "", "", "test/valid", pod.Name, pod)
+	if err != nil {
+		t.Fatalf("ensureRunnerUnregistration() error = %v, want nil", err)
+	}
+	if res == nil || !res.Requeue {
+		t.Errorf("ensureRunnerUnregistration() = %v, want requeue with backoff", res)
+	}
+}
+
+func TestEnsureRunnerUnregistration_Scripted(t *testing.T) {
+	const (
+		timeout                = time.Minute
+		retryDelay             = 5 * time.Minute
+		busyRunnerPollInterval = 10 * time.Second
+	)
+
+	const noRunnersListBody = `{"total_count": 0, "runners": []}`
+
+	listed := fake.Response{Status: http.StatusOK, Body: fake.RunnersListBody}
+	removed := fake.Response{Status: http.StatusNoContent}
+
+	newPod := func(unregistrationStartedAgo time.Duration) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "test1",
+				Annotations: map[string]string{
+					AnnotationKeyRegistrationFirstSeenTimestamp: time.Now().Add(-time.Hour).Format(time.RFC3339),
+				},
+			},
+		}
+
+		if unregistrationStartedAgo > 0 {
+			pod.Annotations[unregistrationStartTimestamp()] = time.Now().Add(-unregistrationStartedAgo).Format(time.RFC3339)
+		}
+
+		return pod
+	}
+
+	// step is the expected outcome of a call to ensureRunnerUnregistration.
+	// A zero step means the runner pod is safe to be deleted.
+	type step struct {
+		requeueAfter time.Duration
+		wantErr      bool
+	}
+
+	tests := []struct {
+		name            string
+		pod             *corev1.Pod
+		listRunners     []fake.Response
+		removeRunner    []fake.Response
+		steps           []step
+		wantRemoveCalls int
+	}{
+		{
+			name:            "busy runner is polled until the job completes",
+			pod:             newPod(0),
+			listRunners:     []fake.Response{listed},
+			removeRunner:    []fake.Response{fake.RunnerBusyResponse("test1"), fake.RunnerBusyResponse("test1"), removed},
+			steps:           []step{{requeueAfter: busyRunnerPollInterval}, {requeueAfter: busyRunnerPollInterval}, {}},
+			wantRemoveCalls: 3,
+		},
+		{
+			name:            "rate-limited list runners is retried after the rate-limit delay",
+			pod:             newPod(0),
+			listRunners:     []fake.Response{fake.RateLimitExceededResponse(), listed},
+			removeRunner:    []fake.Response{removed},
+			steps:           []step{{requeueAfter: retryDelayOnGitHubAPIRateLimitError, wantErr: true}, {}},
+			wantRemoveCalls: 1,
+		},
+		{
+			name:            "runner removed concurrently is considered unregistered",
+			pod:             newPod(0),
+			listRunners:     []fake.Response{listed},
+			removeRunner:    []fake.Response{{Status: http.StatusNotFound, Body: `{"message": "Not Found"}`}},
+			steps:           []step{{}},
+			wantRemoveCalls: 1,
+		},
+		{
+			name:        "missing runner is waited for until the unregistration timeout",
+			pod:         newPod(time.Second),
+			listRunners: []fake.Response{{Status: http.StatusOK, Body: noRunnersListBody}},
+			steps:       []step{{requeueAfter: retryDelay}},
+		},
+		{
+			name:        "missing runner is given up on after the unregistration timeout",
+			pod:         newPod(2 * timeout),
+			listRunners: []fake.Response{{Status: http.StatusOK, Body: noRunnersListBody}},
+			steps:       []step{{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listRunners := fake.NewScriptedHandler(tt.listRunners...)
+			removeRunner := fake.NewScriptedHandler(tt.removeRunner...)
+
+			server := fake.NewServer(
+				fake.WithListRunnersHandler(listRunners),
+				fake.WithRemoveRunnerHandler(removeRunner),
+			)
+			defer server.Close()
+
+			ghClient := newGithubClient(server)
+
+			for i, want := range tt.steps {
+				res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: timeout}, RequeuePolicy{InProgressDelay: retryDelay, BusyDelay: busyRunnerPollInterval}, logr.Discard(), ghClient, "", "", "test/valid", tt.pod.Name, tt.pod)
+				if (err != nil) != want.wantErr {
+					t.Fatalf("step %d: ensureRunnerUnregistration() error = %v, wantErr %v", i, err, want.wantErr)
+				}
+
+				if want == (step{}) {
+					if res != nil {
+						t.Fatalf("step %d: ensureRunnerUnregistration() = %v, want nil", i, res)
+					}
+					continue
+				}
+
+				if res == nil || res.RequeueAfter != want.requeueAfter {
+					t.Fatalf("step %d: ensureRunnerUnregistration() = %v, want RequeueAfter %v", i, res, want.requeueAfter)
+				}
+			}
+
+			for _, c := range listRunners.Calls() {
+				if got := c.Query.Get("name"); got != tt.pod.Name {
+					t.Errorf("unexpected name query parameter of list runners: got %q, want %q", got, tt.pod.Name)
+				}
+			}
+
+			if got := len(removeRunner.Calls()); got != tt.wantRemoveCalls {
+				t.Errorf("unexpected number of remove runner calls: got %d, want %d", got, tt.wantRemoveCalls)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_RateLimitDelayMetric(t *testing.T) {
+	const (
+		enterprise = ""
+		org        = ""
+		repo       = "test/valid"
+	)
+
+	tests := []struct {
+		name        string
+		listRunners fake.Response
+		wantDelay   time.Duration
+	}{
+		{
+			name:        "rate limit",
+			listRunners: fake.RateLimitExceededResponse(),
+			wantDelay:   retryDelayOnGitHubAPIRateLimitError,
+		},
+		{
+			name:        "secondary rate limit",
+			listRunners: fake.SecondaryRateLimitExceededResponse(2 * time.Minute),
+			wantDelay:   2 * time.Minute,
+		},
+		{
+			name:        "other error",
+			listRunners: fake.Response{Status: http.StatusNotFound, Body: `{"message": "Not Found"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(fake.WithListRunnersHandler(fake.NewScriptedHandler(tt.listRunners)))
+			defer server.Close()
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "test1",
+				},
+			}
+
+			before := gatherRateLimitDelaySeconds(t, enterprise, org, repo)
+
+			res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute}, RequeuePolicy{InProgressDelay: time.Second, BusyDelay: time.Second}, logr.Discard(), newGithubClient(server), enterprise, org, repo, pod.Name, pod)
+			if err == nil {
+				t.Fatalf("ensureRunnerUnregistration() error = nil, want error")
+			}
+			if tt.wantDelay > 0 && (res == nil || res.RequeueAfter != tt.wantDelay) {
+				t.Errorf("ensureRunnerUnregistration() = %v, want RequeueAfter %v", res, tt.wantDelay)
+			}
+
+			if got := gatherRateLimitDelaySeconds(t, enterprise, org, repo) - before; got != tt.wantDelay.Seconds() {
+				t.Errorf("unexpected increase of the rate limit delay: got %vs, want %vs", got, tt.wantDelay.Seconds())
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_RemoveRunnerBusyMetric(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(fake.NewScriptedHandler(fake.RunnerBusyResponse("test1"), fake.Response{Status: http.StatusNoContent})),
+	)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+	}
+
+	before := gatherScopeCounter(t, "arc_remove_runner_busy_total", "", "", "test/valid")
+
+	for i, want := range []float64{1, 1} {
+		if _, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute}, RequeuePolicy{InProgressDelay: time.Second, BusyDelay: time.Second}, logr.Discard(), newGithubClient(server), "", "", "test/valid", pod.Name, pod); err != nil {
+			t.Fatalf("call %d: ensureRunnerUnregistration() error = %v", i, err)
+		}
+
+		if got := gatherScopeCounter(t, "arc_remove_runner_busy_total", "", "", "test/valid") - before; got != want {
+			t.Errorf("call %d: unexpected increase of arc_remove_runner_busy_total: got %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestEnsureRunnerUnregistration_SkipBusyRunnerRemoval(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+	}
+
+	runner := &gogithub.Runner{ID: gogithub.Int64(1), Name: gogithub.String("test1"), Status: gogithub.String("online"), Busy: gogithub.Bool(true)}
+
+	api := &fakeRunnerAPI{runners: []*gogithub.Runner{runner}}
+
+	requeue := RequeuePolicy{InProgressDelay: time.Second, BusyDelay: 2 * time.Second}
+
+	config := GracefulStopConfig{UnregistrationTimeout: time.Minute, SkipBusyRunnerRemoval: true}
+
+	res, err := ensureRunnerUnregistration(context.Background(), realClock{}, config, requeue, logr.Discard(), api, "", "", "test/valid", pod.Name, pod)
+	if err != nil {
+		t.Fatalf("ensureRunnerUnregistration() error = %v", err)
+	}
+
+	if res == nil || res.RequeueAfter != requeue.BusyDelay {
+		t.Fatalf("ensureRunnerUnregistration() = %v, want RequeueAfter %v", res, requeue.BusyDelay)
+	}
+
+	if len(api.removed) != 0 {
+		t.Fatalf("expected the busy runner not to be removed, removed %v", api.removed)
+	}
+
+	// Once the runner finishes its job, it's removed as usual.
+	runner.Busy = gogithub.Bool(false)
+
+	if _, err := ensureRunnerUnregistration(context.Background(), realClock{}, config, requeue, logr.Discard(), api, "", "", "test/valid", pod.Name, pod); err != nil {
+		t.Fatalf("ensureRunnerUnregistration() error = %v", err)
+	}
+
+	if len(api.removed) != 1 {
+		t.Errorf("expected the idle runner to be removed, removed %v", api.removed)
+	}
+}
+
+func gatherRateLimitDelaySeconds(t *testing.T, enterprise, org, repo string) float64 {
+	t.Helper()
+
+	return gatherScopeCounter(t, "arc_github_api_rate_limit_delay_seconds_total", enterprise, org, repo)
+}
+
+// gatherScopeCounter returns the value of the counter with the enterprise, organization, and repository labels.
+func gatherScopeCounter(t *testing.T, name, enterprise, org, repo string) float64 {
+	t.Helper()
+
+	families, err := ctrlmetrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+
+			if labels["enterprise"] == enterprise && labels["organization"] == org && labels["repository"] == repo {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+// fakeRunnerAPI is an in-memory github.RunnerAPI.
+type fakeRunnerAPI struct {
+	runners []*gogithub.Runner
+	removed []int64
+
+	// removeErr is returned by RemoveRunner when set.
+	removeErr error
+}
+
+func (f *fakeRunnerAPI) ListRunners(ctx context.Context, enterprise, org, repo string) ([]*gogithub.Runner, error) {
+	return f.ListRunnersWithFilter(ctx, enterprise, org, repo, github.RunnerFilter{})
+}
+
+func (f *fakeRunnerAPI) ListRunnersWithFilter(ctx context.Context, enterprise, org, repo string, filter github.RunnerFilter) ([]*gogithub.Runner, error) {
+	var runners []*gogithub.Runner
+	for _, r := range f.runners {
+		if (filter.Name == "" || r.GetName() == filter.Name) && (filter.Status == "" || r.GetStatus() == filter.Status) {
+			runners = append(runners, r)
+		}
+	}
+	return runners, nil
+}
+
+func (f *fakeRunnerAPI) RemoveRunner(ctx context.Context, enterprise, org, repo string, runnerID int64) error {
+	if f.removeErr != nil {
+		return f.removeErr
+	}
+
+	for i, r := range f.runners {
+		if r.GetID() == runnerID {
+			f.runners = append(f.runners[:i], f.runners[i+1:]...)
+			f.removed = append(f.removed, runnerID)
+			return nil
+		}
+	}
+	return fmt.Errorf("runner %d not found", runnerID)
+}
+
+func TestEnsureRunnerUnregistration_ClassifiedErrors(t *testing.T) {
+	requeue := RequeuePolicy{InProgressDelay: time.Second, RateLimitDelay: time.Minute, BusyDelay: 2 * time.Second, NetworkErrorBackoff: 3 * time.Second}
+
+	cause := errors.New("cause")
+
+	tests := []struct {
+		name      string
+		err       error
+		wantDelay time.Duration
+		wantErr   bool
+		wantDone  bool
+	}{
+		{
+			name:      "rate limited",
+			err:       &apierrors.RateLimited{Err: cause},
+			wantDelay: time.Minute,
+			wantErr:   true,
+		},
+		{
+			name:      "secondary rate limited with a longer retry-after",
+			err:       &apierrors.SecondaryRateLimited{RetryAfter: 2 * time.Minute, Err: cause},
+			wantDelay: 2 * time.Minute,
+			wantErr:   true,
+		},
+		{
+			name:      "transient",
+			err:       &apierrors.Transient{Err: cause},
+			wantDelay: 3 * time.Second,
+		},
+		{
+			name:      "busy",
+			err:       &apierrors.Busy{Err: cause},
+			wantDelay: 2 * time.Second,
+		},
+		{
+			name:     "not found",
+			err:      &apierrors.NotFound{Err: cause},
+			wantDone: true,
+		},
+		{
+			name:    "forbidden",
+			err:     &apierrors.Forbidden{Operation: "remove runner", Err: cause},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeRunnerAPI{
+				runners:   []*gogithub.Runner{{ID: gogithub.Int64(1), Name: gogithub.String("test1"), Status: gogithub.String("online")}},
+				removeErr: fmt.Errorf("failed to remove runner: %w", tt.err),
+			}
+
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"}}
+
+			res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute}, requeue, logr.Discard(), api, "", "", "test/valid", pod.Name, pod)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ensureRunnerUnregistration() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if tt.wantDone {
+				if res != nil {
+					t.Errorf("ensureRunnerUnregistration() = %v, want nil", res)
+				}
+				return
+			}
+
+			if res == nil {
+				t.Fatal("ensureRunnerUnregistration() = nil, want requeue")
+			}
+
+			if res.RequeueAfter != tt.wantDelay {
+				t.Errorf("unexpected RequeueAfter: got %v, want %v", res.RequeueAfter, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_RateLimitRetryDelayOverride(t *testing.T) {
+	requeue := RequeuePolicy{RateLimitDelay: time.Minute, MinRateLimitDelay: 10 * time.Second}
+
+	tests := []struct {
+		override  string
+		wantDelay time.Duration
+	}{
+		{override: "", wantDelay: time.Minute},
+		{override: "20s", wantDelay: 20 * time.Second},
+		{override: "1s", wantDelay: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.override, func(t *testing.T) {
+			api := &fakeRunnerAPI{
+				runners:   []*gogithub.Runner{{ID: gogithub.Int64(1), Name: gogithub.String("test1"), Status: gogithub.String("online")}},
+				removeErr: fmt.Errorf("failed to remove runner: %w", &apierrors.RateLimited{Err: errors.New("cause")}),
+			}
+
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"}}
+			if tt.override != "" {
+				setAnnotation(pod, AnnotationKeyRateLimitRetryDelay, tt.override)
+			}
+
+			res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute}, requeue, logr.Discard(), api, "", "", "test/valid", pod.Name, pod)
+			if err == nil {
+				t.Errorf("expected the rate limit error to be returned")
+			}
+
+			if res == nil || res.RequeueAfter != tt.wantDelay {
+				t.Errorf("ensureRunnerUnregistration() = %v, want RequeueAfter %v", res, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_RunnerAPI(t *testing.T) {
+	api := &fakeRunnerAPI{
+		runners: []*gogithub.Runner{
+			{ID: gogithub.Int64(1), Name: gogithub.String("test1"), Status: gogithub.String("online")},
+			{ID: gogithub.Int64(2), Name: gogithub.String("test2"), Status: gogithub.String("online")},
+		},
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test2",
+		},
+	}
+
+	res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute}, RequeuePolicy{InProgressDelay: time.Second, BusyDelay: time.Second}, logr.Discard(), api, "", "", "test/valid", pod.Name, pod)
+	if err != nil {
+		t.Fatalf("ensureRunnerUnregistration() error = %v", err)
+	}
+	if res != nil {
+		t.Errorf("ensureRunnerUnregistration() = %v, want nil", res)
+	}
+
+	if len(api.removed) != 1 || api.removed[0] != 2 {
+		t.Errorf("unexpected removed runner IDs: got %v, want [2]", api.removed)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// fakeClock is a Clock that tells the time set by the test.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestTickRunnerGracefulStop_PostUnregistrationDelay(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+	)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+	clock := &fakeClock{now: time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)}
+
+	tick := func() (*corev1.Pod, *ctrl.Result) {
+		t.Helper()
+
+		var live corev1.Pod
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+			t.Fatal(err)
+		}
+
+		updated, res, err := tickRunnerGracefulStop(context.Background(), clock, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, BusyRunnerPollInterval: time.Second, PostUnregistrationDelay: time.Minute}, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", live.Name, &live)
+		if err != nil {
+			t.Fatalf("tickRunnerGracefulStop() error = %v", err)
+		}
+
+		return updated, res
+	}
+
+	updated, res := tick()
+	if updated != nil {
+		t.Errorf("expected the pod not to be reported as safe for deletion within the delay")
+	}
+	if res == nil || res.RequeueAfter != time.Minute {
+		t.Fatalf("unexpected result within the delay: %v", res)
+	}
+
+	var live corev1.Pod
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := getAnnotation(&live, unregistrationCompleteTimestamp()); v != formatUnregistrationTimestamp(clock.Now()) {
+		t.Fatalf("unexpected %s annotation: got %q, want the time of the fake clock", unregistrationCompleteTimestamp(), v)
+	}
+
+	clock.Advance(time.Minute - time.Nanosecond)
+
+	updated, res = tick()
+	if updated != nil || res == nil || res.RequeueAfter != time.Nanosecond {
+		t.Fatalf("unexpected result just before the delay elapses: pod = %v, res = %v", updated, res)
+	}
+
+	clock.Advance(time.Nanosecond)
+
+	updated, res = tick()
+	if res != nil {
+		t.Errorf("unexpected result after the delay: %v", res)
+	}
+	if updated == nil {
+		t.Errorf("expected the pod to be reported as safe for deletion after the delay")
+	}
+}
+
+func TestEnsureRunnerUnregistration_TimeoutBoundary(t *testing.T) {
+	const timeout = time.Minute
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, `{"total_count": 0, "runners": []}`),
+	)
+	defer server.Close()
+
+	clock := &fakeClock{now: time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+			Annotations: map[string]string{
+				unregistrationStartTimestamp(): formatUnregistrationTimestamp(clock.Now()),
+			},
+		},
+	}
+
+	ensure := func() *ctrl.Result {
+		t.Helper()
+
+		res, err := ensureRunnerUnregistration(context.Background(), clock, GracefulStopConfig{UnregistrationTimeout: timeout}, RequeuePolicy{InProgressDelay: time.Second, BusyDelay: time.Second}, logr.Discard(), newGithubClient(server), "", "", "test/valid", pod.Name, pod)
+		if err != nil {
+			t.Fatalf("ensureRunnerUnregistration() error = %v", err)
+		}
+
+		return res
+	}
+
+	clock.Advance(timeout - time.Nanosecond)
+
+	if res := ensure(); res == nil || res.RequeueAfter != time.Second {
+		t.Fatalf("expected the unregistration to be in progress just before the timeout, got %v", res)
+	}
+
+	clock.Advance(time.Nanosecond)
+
+	if res := ensure(); res != nil {
+		t.Errorf("expected the unregistration to time out exactly at the timeout, got %v", res)
+	}
+
+	// The timeout annotation on the pod takes precedence over the flag.
+	setAnnotation(pod, AnnotationKeyUnregistrationTimeout, "2m")
+
+	if res := ensure(); res == nil || res.RequeueAfter != time.Second {
+		t.Errorf("expected the unregistration to be in progress within the timeout of the annotation, got %v", res)
+	}
+
+	clock.Advance(timeout)
+
+	if res := ensure(); res != nil {
+		t.Errorf("expected the unregistration to time out exactly at the timeout of the annotation, got %v", res)
+	}
+}
+
+func TestTickRunnerGracefulStop_RetryBudget(t *testing.T) {
+	tests := []struct {
+		name         string
+		listStatus   int
+		wantAttempts []string
+		wantFailed   []bool
+	}{
+		{
+			name:         "permanent error exhausts the budget",
+			listStatus:   http.StatusUnprocessableEntity,
+			wantAttempts: []string{"1", "2", "2"},
+			wantFailed:   []bool{false, true, true},
+		},
+		{
+			name:         "transient error does not consume the budget",
+			listStatus:   http.StatusBadGateway,
+			wantAttempts: []string{"", "", ""},
+			wantFailed:   []bool{false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(tt.listStatus, `{"message": "error"}`),
+			)
+			defer server.Close()
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "test1",
+				},
+			}
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+			for i := range tt.wantAttempts {
+				var live corev1.Pod
+				if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+					t.Fatal(err)
+				}
+
+				_, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, BusyRunnerPollInterval: time.Second, MaxUnregistrationAttempts: 2}, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", live.Name, &live)
+				if err == nil || res == nil {
+					t.Fatalf("attempt %d: expected error and result, got res = %v, err = %v", i, res, err)
+				}
+
+				if got := isUnregistrationFailed(err); got != tt.wantFailed[i] {
+					t.Errorf("attempt %d: unexpected UnregistrationFailed: got %v, want %v: %v", i, got, tt.wantFailed[i], err)
+				}
+
+				if tt.wantFailed[i] && (res.Requeue || res.RequeueAfter > 0) {
+					t.Errorf("attempt %d: expected no requeue after the budget is exhausted, got %v", i, res)
+				}
+
+				if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+					t.Fatal(err)
+				}
+
+				got, _ := getAnnotation(&live, AnnotationKeyUnregistrationAttempts)
+				if got != tt.wantAttempts[i] {
+					t.Errorf("attempt %d: unexpected %s annotation: got %q, want %q", i, AnnotationKeyUnregistrationAttempts, got, tt.wantAttempts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTickRunnerGracefulStop_PermissionDenied(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "4999")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+		})),
+	)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+	// The retry budget is disabled, but the permission error is terminal anyway.
+	_, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, BusyRunnerPollInterval: time.Second}, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", pod.Name, pod)
+	if !isUnregistrationFailed(err) || !isPermissionDeniedError(err) {
+		t.Fatalf("expected UnregistrationFailed due to the permission error, got %v", err)
+	}
+
+	if res == nil || res.Requeue || res.RequeueAfter > 0 {
+		t.Errorf("expected no requeue, got %v", res)
+	}
+
+	var live corev1.Pod
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := getAnnotation(&live, AnnotationKeyUnregistrationAttempts); got != "1" {
+		t.Errorf("unexpected %s annotation: got %q, want %q", AnnotationKeyUnregistrationAttempts, got, "1")
+	}
+
+	_, _, err = tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second}, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", "test1", nil)
+	if !isUnregistrationFailed(err) {
+		t.Errorf("expected UnregistrationFailed without the pod, got %v", err)
+	}
+}
+
+func TestTickRunnerGracefulStop_ScopeNotFound(t *testing.T) {
+	// The repository has been deleted, so listing its runners fails with 404 on every attempt.
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusNotFound, `{"message": "Not Found"}`),
+	)
+	defer server.Close()
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig: v1alpha1.RunnerConfig{
+				Repository: "test/deleted",
+			},
+		},
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner, pod).Build()
+
+	// The retry budget is disabled, but the scope not found is terminal anyway.
+	_, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, BusyRunnerPollInterval: time.Second}, "", logr.Discard(), newGithubClient(server), c, "", "", "test/deleted", pod.Name, pod)
+	if !isUnregistrationFailed(err) || !isScopeNotFoundError(err) {
+		t.Fatalf("expected UnregistrationFailed due to the scope not found, got %v", err)
+	}
+
+	if res == nil || res.Requeue || res.RequeueAfter > 0 {
+		t.Errorf("expected no requeue, got %v", res)
+	}
+
+	var live corev1.Pod
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := getAnnotation(&live, AnnotationKeyUnregistrationAttempts); got != "1" {
+		t.Errorf("unexpected %s annotation: got %q, want %q", AnnotationKeyUnregistrationAttempts, got, "1")
+	}
+
+	r := &RunnerReconciler{
+		Client:   c,
+		Log:      logr.Discard(),
+		Recorder: record.NewFakeRecorder(10),
+		Scheme:   scheme,
+	}
+
+	result, err := r.processUnregistrationResult(context.Background(), *runner, logr.Discard(), *res, err)
+	if err != nil || !result.IsZero() {
+		t.Fatalf("expected the runner to stop requeueing, got %+v, %v", result, err)
+	}
+
+	var updated v1alpha1.Runner
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(runner), &updated); err != nil {
+		t.Fatal(err)
+	}
+
+	cond := meta.FindStatusCondition(updated.Status.Conditions, v1alpha1.RunnerConditionUnregistrationFailed)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != "ScopeNotFound" {
+		t.Fatalf("expected the UnregistrationFailed condition due to the scope not found, got %+v", cond)
+	}
+
+	if !strings.Contains(cond.Message, "repository test/deleted not found") {
+		t.Errorf("expected the condition message to tell the scope not found, got %q", cond.Message)
+	}
+}
+
+func TestParseUnregistrationTimestamp(t *testing.T) {
+	want := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "legacy RFC3339 in UTC",
+			value: "2022-03-01T10:00:00Z",
+			want:  want,
+		},
+		{
+			name:  "legacy RFC3339 in local time",
+			value: "2022-03-01T19:00:00+09:00",
+			want:  want,
+		},
+		{
+			name:  "RFC3339Nano in UTC",
+			value: "2022-03-01T10:00:00.123456789Z",
+			want:  want.Add(123456789 * time.Nanosecond),
+		},
+		{
+			name:    "invalid",
+			value:   "2022-03-01 10:00:00",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUnregistrationTimestamp(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseUnregistrationTimestamp(%q) = %v, want error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseUnregistrationTimestamp(%q) error = %v", tt.value, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseUnregistrationTimestamp(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatUnregistrationTimestamp(t *testing.T) {
+	local := time.Date(2022, 3, 1, 19, 0, 0, 123456789, time.FixedZone("JST", 9*60*60))
+
+	v := formatUnregistrationTimestamp(local)
+	if want := "2022-03-01T10:00:00.123456789Z"; v != want {
+		t.Errorf("formatUnregistrationTimestamp() = %q, want %q", v, want)
+	}
+
+	got, err := parseUnregistrationTimestamp(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(local) {
+		t.Errorf("unexpected round-tripped time: got %v, want %v", got, local)
+	}
+}
+
+func TestMarkRunnerPodRegistrationSeen(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2022, 3, 1, 19, 0, 0, 123456789, time.FixedZone("JST", 9*60*60))}
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"}}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+	if err := markRunnerPodRegistrationSeen(context.Background(), clock, c, logr.Discard(), pod); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := pod.Annotations[AnnotationKeyRegistrationFirstSeenTimestamp], "2022-03-01T10:00:00.123456789Z"; got != want {
+		t.Errorf("unexpected %s annotation: got %q, want %q", AnnotationKeyRegistrationFirstSeenTimestamp, got, want)
+	}
+
+	// The first time the registration is seen is kept as is.
+	clock.Advance(time.Hour)
+
+	if err := markRunnerPodRegistrationSeen(context.Background(), clock, c, logr.Discard(), pod); err != nil {
+		t.Fatal(err)
+	}
+
+	var live corev1.Pod
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := live.Annotations[AnnotationKeyRegistrationFirstSeenTimestamp], "2022-03-01T10:00:00.123456789Z"; got != want {
+		t.Errorf("unexpected %s annotation of the live pod: got %q, want %q", AnnotationKeyRegistrationFirstSeenTimestamp, got, want)
+	}
+}
+
+func TestTickRunnerGracefulStop_UnregistrationAttemptsTotal(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(
+		fake.RunnerBusyResponse("test1"),
+		fake.RateLimitExceededResponse(),
+		fake.Response{Status: http.StatusNoContent},
+	)
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+	wantAttempts := []string{"1", "2", ""}
+
+	for i, want := range wantAttempts {
+		var live corev1.Pod
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+			t.Fatal(err)
+		}
+
+		updated, res, _ := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, BusyRunnerPollInterval: time.Second, MaxUnregistrationAttempts: 2}, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", live.Name, &live)
+
+		if last := i == len(wantAttempts)-1; last != (res == nil) {
+			t.Fatalf("attempt %d: unexpected result: %v", i, res)
+		}
+
+		if updated == nil {
+			t.Fatalf("attempt %d: expected the updated pod to be returned", i)
+		}
+
+		if got, _ := getAnnotation(updated, AnnotationKeyUnregistrationAttemptsTotal); got != want {
+			t.Errorf("attempt %d: unexpected %s annotation of the returned pod: got %q, want %q", i, AnnotationKeyUnregistrationAttemptsTotal, got, want)
+		}
+
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, _ := getAnnotation(&live, AnnotationKeyUnregistrationAttemptsTotal); got != want {
+			t.Errorf("attempt %d: unexpected %s annotation: got %q, want %q", i, AnnotationKeyUnregistrationAttemptsTotal, got, want)
+		}
+
+		// Busy runners and rate limits never consume the retry budget.
+		if got, _ := getAnnotation(&live, AnnotationKeyUnregistrationAttempts); got != "" {
+			t.Errorf("attempt %d: unexpected %s annotation: %q", i, AnnotationKeyUnregistrationAttempts, got)
+		}
+	}
+}
+
+func TestTickRunnerGracefulStop_UnregistrationStartJitter(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	const jitter = 15 * time.Second
+
+	var pods []client.Object
+	for _, name := range []string{"test1", "test2", "test3", "test4"} {
+		pods = append(pods, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}})
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pods...).Build()
+
+	tick := func(t *testing.T, name string) (*corev1.Pod, *ctrl.Result) {
+		t.Helper()
+
+		var live corev1.Pod
+		if err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, &live); err != nil {
+			t.Fatal(err)
+		}
+
+		updated, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, BusyRunnerPollInterval: time.Second, UnregistrationStartJitter: jitter}, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", live.Name, &live)
+		if err != nil {
+			t.Fatalf("tickRunnerGracefulStop() error = %v", err)
+		}
+
+		return updated, res
+	}
+
+	seen := map[string]string{}
+
+	for _, p := range pods {
+		updated, _ := tick(t, p.GetName())
+
+		v, ok := getAnnotation(updated, AnnotationKeyUnregistrationStartDelay)
+		if !ok {
+			t.Fatalf("%s: missing %s annotation", p.GetName(), AnnotationKeyUnregistrationStartDelay)
+		}
+
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || d >= jitter {
+			t.Errorf("%s: invalid delay %q", p.GetName(), v)
+		}
+
+		if other, ok := seen[v]; ok {
+			t.Errorf("%s: got the same delay %s as %s", p.GetName(), v, other)
+		}
+		seen[v] = p.GetName()
+	}
+
+	// The delay is chosen only once per pod.
+	for v, name := range seen {
+		updated, _ := tick(t, name)
+
+		if got, _ := getAnnotation(updated, AnnotationKeyUnregistrationStartDelay); got != v {
+			t.Errorf("%s: delay changed across ticks: got %s, want %s", name, got, v)
+		}
+	}
+}
+
+func TestTickRunnerGracefulStop_UnregistrationStartDelay(t *testing.T) {
+	defer func(f func(time.Duration) time.Duration) { randomUnregistrationStartDelay = f }(randomUnregistrationStartDelay)
+	randomUnregistrationStartDelay = func(time.Duration) time.Duration { return 10 * time.Second }
+
+	removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"}}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+	_, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, BusyRunnerPollInterval: time.Second, UnregistrationStartJitter: 15 * time.Second}, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", pod.Name, pod)
+	if err != nil {
+		t.Fatalf("tickRunnerGracefulStop() error = %v", err)
+	}
+
+	if res == nil || res.RequeueAfter <= 0 || res.RequeueAfter > 10*time.Second {
+		t.Errorf("expected the first attempt to be delayed by up to 10s, got %v", res)
+	}
+
+	if n := len(removeRunner.Calls()); n != 0 {
+		t.Errorf("unexpected number of remove runner calls: got %d, want 0", n)
+	}
+}
+
+func TestEnsureRunnerUnregistration_RequeuePolicy(t *testing.T) {
+	policy := RequeuePolicy{
+		InProgressDelay:        7 * time.Second,
+		RateLimitDelay:         11 * time.Second,
+		BusyDelay:              3 * time.Second,
+		NetworkErrorBackoff:    2 * time.Second,
+		NetworkErrorMaxBackoff: 5 * time.Second,
+	}
+
+	networkErrorClient := &github.Client{
+		Client: gogithub.NewClient(&http.Client{
+			Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+				return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+			}),
+		}),
+	}
+
+	newPod := func(name string, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        name,
+				Annotations: annotations,
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		server  []fake.Option
+		client  *github.Client
+		pod     *corev1.Pod
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name:   "unregistration in progress",
+			server: []fake.Option{fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody)},
+			pod:    newPod("test3", map[string]string{unregistrationStartTimestamp(): formatUnregistrationTimestamp(time.Now())}),
+			want:   policy.InProgressDelay,
+		},
+		{
+			name:   "unregistration not started",
+			server: []fake.Option{fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody)},
+			pod:    newPod("test3", nil),
+			want:   policy.InProgressDelay,
+		},
+		{
+			name:    "rate limit",
+			server:  []fake.Option{fake.WithListRunnersHandler(fake.NewScriptedHandler(fake.RateLimitExceededResponse()))},
+			pod:     newPod("test1", nil),
+			want:    policy.RateLimitDelay,
+			wantErr: true,
+		},
+		{
+			name: "busy",
+			server: []fake.Option{
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerHandler(fake.NewScriptedHandler(fake.RunnerBusyResponse("test1"))),
+			},
+			pod:  newPod("test1", nil),
+			want: policy.BusyDelay,
+		},
+		{
+			name:   "network error",
+			client: networkErrorClient,
+			pod:    newPod("test1", map[string]string{AnnotationKeyUnregistrationAttemptsTotal: "1"}),
+			want:   4 * time.Second,
+		},
+		{
+			name:   "network error backoff capped",
+			client: networkErrorClient,
+			pod:    newPod("test1", map[string]string{AnnotationKeyUnregistrationAttemptsTotal: "5"}),
+			want:   policy.NetworkErrorMaxBackoff,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ghClient := tt.client
+			if ghClient == nil {
+				server := fake.NewServer(tt.server...)
+				defer server.Close()
+
+				ghClient = newGithubClient(server)
+			}
+
+			res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute}, policy, logr.Discard(), ghClient, "", "", "test/valid", tt.pod.Name, tt.pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ensureRunnerUnregistration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if res == nil || res.RequeueAfter != tt.want {
+				t.Errorf("ensureRunnerUnregistration() = %v, want RequeueAfter %v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_AdaptiveDelay(t *testing.T) {
+	policy := RequeuePolicy{
+		InProgressDelay:    10 * time.Second,
+		BusyDelay:          5 * time.Second,
+		MaxInProgressDelay: 2 * time.Minute,
+	}
+
+	clock := &fakeClock{now: time.Now()}
+
+	tests := []struct {
+		name    string
+		runner  string
+		removed fake.Response
+		elapsed time.Duration
+		want    time.Duration
+	}{
+		{
+			name:    "in progress early",
+			runner:  "test3",
+			elapsed: 0,
+			want:    2 * time.Minute,
+		},
+		{
+			name:    "in progress near the timeout",
+			runner:  "test3",
+			elapsed: 9 * time.Minute,
+			want:    21 * time.Second,
+		},
+		{
+			name:    "busy early",
+			runner:  "test1",
+			removed: fake.RunnerBusyResponse("test1"),
+			elapsed: 0,
+			want:    2 * time.Minute,
+		},
+		{
+			name:    "busy past the timeout",
+			runner:  "test1",
+			removed: fake.RunnerBusyResponse("test1"),
+			elapsed: 11 * time.Minute,
+			want:    policy.BusyDelay,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerHandler(fake.NewScriptedHandler(tt.removed)),
+			)
+			defer server.Close()
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      tt.runner,
+					Annotations: map[string]string{
+						unregistrationStartTimestamp(): formatUnregistrationTimestamp(clock.now.Add(-tt.elapsed)),
+					},
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+				},
+			}
+
+			res, err := ensureRunnerUnregistration(context.Background(), clock, GracefulStopConfig{UnregistrationTimeout: 10 * time.Minute}, policy, logr.Discard(), newGithubClient(server), "", "", "test/valid", pod.Name, pod)
+			if err != nil {
+				t.Fatalf("ensureRunnerUnregistration() error = %v", err)
+			}
+			if res == nil || res.RequeueAfter != tt.want {
+				t.Errorf("ensureRunnerUnregistration() = %v, want RequeueAfter %v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestTickRunnerGracefulStop_RequireReadyToStop(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantHold    bool
+	}{
+		{
+			name:     "held until annotated",
+			wantHold: true,
+		},
+		{
+			name:        "annotated as ready to stop",
+			annotations: map[string]string{AnnotationKeyReadyToStop: "true"},
+		},
+		{
+			name:        "already started",
+			annotations: map[string]string{unregistrationStartTimestamp(): formatUnregistrationTimestamp(time.Now())},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerHandler(removeRunner),
+			)
+			defer server.Close()
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "default",
+					Name:        "test1",
+					Annotations: tt.annotations,
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+				},
+			}
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+			_, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, BusyRunnerPollInterval: time.Second, RequireReadyToStop: true}, UnregistrationReasonScaleDown, logr.Discard(), newGithubClient(server), c, "", "", "test/valid", pod.Name, pod)
+			if err != nil {
+				t.Fatalf("tickRunnerGracefulStop() error = %v", err)
+			}
+
+			var live corev1.Pod
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+				t.Fatal(err)
+			}
+
+			_, started := getAnnotation(&live, unregistrationStartTimestamp())
+			removed := len(removeRunner.Calls()) > 0
+
+			if tt.wantHold {
+				if res == nil || res.RequeueAfter != time.Second {
+					t.Errorf("tickRunnerGracefulStop() = %v, want RequeueAfter %v", res, time.Second)
+				}
+				if started || removed {
+					t.Errorf("expected the graceful stop to be held: started = %v, removed = %v", started, removed)
+				}
+				return
+			}
+
+			if res != nil {
+				t.Errorf("tickRunnerGracefulStop() = %v, want nil", res)
+			}
+			if !started || !removed {
+				t.Errorf("expected the graceful stop to proceed: started = %v, removed = %v", started, removed)
+			}
+		})
+	}
+}
+
+// conflictingClient fails the first conflicts patches with a conflict, as if another controller had updated the object in between.
+type conflictingClient struct {
+	client.Client
+	conflicts int
+}
+
+func (c *conflictingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if c.conflicts > 0 {
+		c.conflicts--
+		return kerrors.NewConflict(corev1.Resource("pods"), obj.GetName(), errors.New("the object has been modified"))
+	}
+
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestTickRunnerGracefulStop_PatchConflict(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	// The retries with the re-fetched pod keep conflicting, so the graceful stop should give up patching and requeue.
+	c := &conflictingClient{Client: clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build(), conflicts: maxPodPatchConflictRetries + 1}
+
+	// Another controller annotates the pod, which the graceful stop should see on the retry.
+	var live corev1.Pod
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+		t.Fatal(err)
+	}
+	setAnnotation(&live, "example.com/other", "true")
+	if err := c.Client.Update(context.Background(), &live); err != nil {
+		t.Fatal(err)
+	}
+
+	config := GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, PatchConflictRetryDelay: 3 * time.Second}
+
+	latest, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, config, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", pod.Name, pod)
+	if err != nil {
+		t.Fatalf("expected the conflict not to be returned as an error, which requeues immediately: %v", err)
+	}
+
+	if res == nil || res.RequeueAfter != config.PatchConflictRetryDelay {
+		t.Fatalf("tickRunnerGracefulStop() = %v, want RequeueAfter %v", res, config.PatchConflictRetryDelay)
+	}
+
+	if latest == nil || latest.Annotations["example.com/other"] != "true" {
+		t.Fatalf("expected the latest pod to be re-fetched, got %v", latest)
+	}
+
+	if n := len(removeRunner.Calls()); n != 0 {
+		t.Errorf("expected the unregistration not to start before the start annotation is written, got %d calls", n)
+	}
+
+	latest, res, err = tickRunnerGracefulStop(context.Background(), realClock{}, config, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", latest.Name, latest)
+	if err != nil || res != nil {
+		t.Fatalf("tickRunnerGracefulStop() res = %v, err = %v", res, err)
+	}
+
+	if _, ok := getAnnotation(latest, unregistrationCompleteTimestamp()); !ok || latest.Annotations["example.com/other"] != "true" {
+		t.Errorf("expected the retry with the latest pod to complete the unregistration keeping the other annotation: %v", latest.Annotations)
+	}
+}
+
+func TestTickRunnerGracefulStop_PatchConflictRetry(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test1",
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := &conflictingClient{Client: clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build(), conflicts: 1}
+
+	// Another controller annotates the pod after the caller fetched it, which makes the pod passed to the graceful stop stale.
+	var live corev1.Pod
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &live); err != nil {
+		t.Fatal(err)
+	}
+	setAnnotation(&live, "example.com/other", "true")
+	setAnnotation(&live, AnnotationKeyUnregistrationAttemptsTotal, "2")
+	if err := c.Client.Update(context.Background(), &live); err != nil {
+		t.Fatal(err)
+	}
+
+	config := GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, PatchConflictRetryDelay: 3 * time.Second}
+
+	latest, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, config, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", pod.Name, pod)
+	if err != nil || res != nil {
+		t.Fatalf("expected the conflict to be retried with the re-fetched pod without requeueing: res = %v, err = %v", res, err)
+	}
+
+	if n := len(removeRunner.Calls()); n != 1 {
+		t.Errorf("expected the runner to be unregistered once, got %d calls", n)
+	}
+
+	var got corev1.Pod
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []*corev1.Pod{latest, &got} {
+		if _, ok := getAnnotation(p, unregistrationStartTimestamp()); !ok {
+			t.Errorf("expected the %s annotation to be patched on the latest pod: %v", unregistrationStartTimestamp(), p.Annotations)
+		}
+
+		if _, ok := getAnnotation(p, unregistrationCompleteTimestamp()); !ok {
+			t.Errorf("expected the %s annotation to be patched: %v", unregistrationCompleteTimestamp(), p.Annotations)
+		}
+
+		if p.Annotations["example.com/other"] != "true" {
+			t.Errorf("expected the annotation added concurrently to be kept: %v", p.Annotations)
+		}
+
+		if _, ok := getAnnotation(p, AnnotationKeyUnregistrationAttemptsTotal); ok {
+			t.Errorf("expected the %s annotation of the latest pod to be removed on completion: %v", AnnotationKeyUnregistrationAttemptsTotal, p.Annotations)
+		}
+	}
+}
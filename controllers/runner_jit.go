@@ -0,0 +1,17 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AnnotationKeyJIT is added to the runner pod of an ephemeral runner with spec.jit,
+// to tell that the runner deregisters itself from GitHub once it stops.
+const AnnotationKeyJIT = "actions-runner-controller/jit"
+
+// isJITRunnerPod returns true if the runner pod runs a runner registered with a just-in-time runner configuration.
+//
+// Unlike a classic runner, a JIT runner is registered on GitHub along with the configuration before the pod starts,
+// so it can't be about to register when it's missing on GitHub. It's gone either by completing its job or being removed.
+func isJITRunnerPod(pod *corev1.Pod) bool {
+	return pod != nil && pod.Annotations[AnnotationKeyJIT] == "true"
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewRunnerPod_JIT(t *testing.T) {
+	boolPtr := func(v bool) *bool {
+		return &v
+	}
+
+	tests := []struct {
+		name      string
+		ephemeral *bool
+		jit       *bool
+		want      bool
+	}{
+		{
+			name: "classic",
+		},
+		{
+			name: "jit",
+			jit:  boolPtr(true),
+			want: true,
+		},
+		{
+			name:      "jit is ignored for non-ephemeral runners",
+			ephemeral: boolPtr(false),
+			jit:       boolPtr(true),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runnerSpec := v1alpha1.RunnerConfig{
+				Repository: "test/valid",
+				Ephemeral:  tt.ephemeral,
+				JIT:        tt.jit,
+			}
+
+			pod, err := newRunnerPod(corev1.Pod{}, runnerSpec, "runner:latest", nil, "docker:dind", "", "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := isJITRunnerPod(&pod); got != tt.want {
+				t.Errorf("isJITRunnerPod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_JITRunnerNotFound(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantRequeue bool
+	}{
+		{
+			name:        "classic runner may be about to register",
+			wantRequeue: true,
+		},
+		{
+			name:        "jit runner has deregistered itself",
+			annotations: map[string]string{AnnotationKeyJIT: "true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+			)
+			defer server.Close()
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:         "default",
+					Name:              "test3",
+					CreationTimestamp: metav1.NewTime(time.Now().Add(-5 * time.Second)),
+					Annotations:       tt.annotations,
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+				},
+			}
+
+			res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, RegistrationRaceGracePeriod: time.Minute}, RequeuePolicy{InProgressDelay: time.Second}, logr.Discard(), newGithubClient(server), "", "", "test/valid", pod.Name, pod)
+			if err != nil {
+				t.Fatalf("ensureRunnerUnregistration() error = %v", err)
+			}
+
+			if got := res != nil; got != tt.wantRequeue {
+				t.Errorf("ensureRunnerUnregistration() = %v, want requeue %v", res, tt.wantRequeue)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_StoppedJITRunner(t *testing.T) {
+	var calls int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "test1",
+			Annotations: map[string]string{AnnotationKeyJIT: "true"},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+		},
+	}
+
+	res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute}, RequeuePolicy{InProgressDelay: time.Second}, logr.Discard(), newGithubClient(server), "", "", "test/valid", pod.Name, pod)
+	if err != nil || res != nil {
+		t.Fatalf("ensureRunnerUnregistration() = %v, %v, want nil", res, err)
+	}
+
+	if calls != 0 {
+		t.Errorf("expected no GitHub API calls for a stopped JIT runner, got %d", calls)
+	}
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// AnnotationKeyRunnerLabelTemplates is the annotation ARC adds to the runner pod to tell the templates of the runner labels
+	// to be computed from the pod and the node it's scheduled onto. The value is a JSON array of the templates.
+	AnnotationKeyRunnerLabelTemplates = "actions-runner-controller/runner-label-templates"
+
+	// AnnotationKeyRunnerLabels is the annotation ARC adds to the runner pod once it's scheduled,
+	// to tell the runner the labels computed from the label templates. The value is a JSON array of the labels.
+	// The runner reads it via the downward API volume to register itself with the labels.
+	AnnotationKeyRunnerLabels = "actions-runner-controller/runner-labels"
+
+	// EnvVarRunnerLabelsFile is the path to the file the runner reads the labels computed from the label templates from.
+	EnvVarRunnerLabelsFile = "RUNNER_LABELS_FILE"
+
+	runnerLabelsVolumeName = "runner-labels"
+	runnerLabelsMountPath  = "/etc/actions-runner-controller/runner-labels"
+	runnerLabelsFileName   = "labels"
+)
+
+// RunnerLabelTemplateData is the data available to runner label templates.
+// For example, `zone-{{ index .Node.Labels "topology.kubernetes.io/zone" }}` results in e.g. `zone-us-east-1a`.
+type RunnerLabelTemplateData struct {
+	Pod  RunnerLabelTemplateObject
+	Node RunnerLabelTemplateObject
+}
+
+// RunnerLabelTemplateObject is the metadata of a Kubernetes object available to runner label templates.
+type RunnerLabelTemplateObject struct {
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// parseRunnerLabelTemplates parses the runner label templates, so that invalid templates can be rejected before creating runner pods.
+func parseRunnerLabelTemplates(templates []string) ([]*template.Template, error) {
+	var parsed []*template.Template
+
+	for i, t := range templates {
+		tmpl, err := template.New(fmt.Sprintf("labelTemplates[%d]", i)).Option("missingkey=zero").Parse(t)
+		if err != nil {
+			return nil, fmt.Errorf("parsing runner label template %q: %w", t, err)
+		}
+
+		parsed = append(parsed, tmpl)
+	}
+
+	return parsed, nil
+}
+
+// renderRunnerLabels computes the runner labels from the templates, the pod, and the node the pod is scheduled onto.
+// A template that results in an empty string is omitted, so that e.g. a template referring to a missing node label doesn't
+// end up in an empty label. node can be nil, in which case node fields are empty.
+func renderRunnerLabels(templates []string, pod *corev1.Pod, node *corev1.Node) ([]string, error) {
+	parsed, err := parseRunnerLabelTemplates(templates)
+	if err != nil {
+		return nil, err
+	}
+
+	data := RunnerLabelTemplateData{
+		Pod: RunnerLabelTemplateObject{
+			Name:        pod.Name,
+			Namespace:   pod.Namespace,
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		},
+	}
+
+	if node != nil {
+		data.Node = RunnerLabelTemplateObject{
+			Name:        node.Name,
+			Labels:      node.Labels,
+			Annotations: node.Annotations,
+		}
+	}
+
+	var labels []string
+
+	seen := map[string]struct{}{}
+
+	for _, tmpl := range parsed {
+		var buf bytes.Buffer
+
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("rendering runner label template %s: %w", tmpl.Name(), err)
+		}
+
+		l := strings.TrimSpace(buf.String())
+		if l == "" {
+			continue
+		}
+
+		if strings.ContainsAny(l, ",\"") {
+			return nil, fmt.Errorf("runner label %q rendered from template %s must not contain commas or double quotes", l, tmpl.Name())
+		}
+
+		if _, ok := seen[l]; ok {
+			continue
+		}
+
+		seen[l] = struct{}{}
+		labels = append(labels, l)
+	}
+
+	return labels, nil
+}
+
+// addRunnerLabelTemplates makes the runner pod wait for the labels computed from the templates,
+// that is exposed to the runner container via the downward API volume.
+func addRunnerLabelTemplates(pod *corev1.Pod, runnerContainer *corev1.Container, templates []string) error {
+	if len(templates) == 0 {
+		return nil
+	}
+
+	if _, err := parseRunnerLabelTemplates(templates); err != nil {
+		return err
+	}
+
+	v, err := json.Marshal(templates)
+	if err != nil {
+		return err
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+
+	pod.Annotations[AnnotationKeyRunnerLabelTemplates] = string(v)
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: runnerLabelsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{
+					{
+						Path: runnerLabelsFileName,
+						FieldRef: &corev1.ObjectFieldSelector{
+							FieldPath: fmt.Sprintf("metadata.annotations['%s']", AnnotationKeyRunnerLabels),
+						},
+					},
+				},
+			},
+		},
+	})
+
+	runnerContainer.VolumeMounts = append(runnerContainer.VolumeMounts, corev1.VolumeMount{
+		Name:      runnerLabelsVolumeName,
+		MountPath: runnerLabelsMountPath,
+		ReadOnly:  true,
+	})
+
+	runnerContainer.Env = append(runnerContainer.Env, corev1.EnvVar{
+		Name:  EnvVarRunnerLabelsFile,
+		Value: runnerLabelsMountPath + "/" + runnerLabelsFileName,
+	})
+
+	return nil
+}
+
+// ensureRunnerLabels annotates the scheduled runner pod with the runner labels computed from the label templates.
+// It's a no-op if the pod has no label templates, isn't scheduled yet, or is already annotated.
+//
+// The runner labels are used only for registration. ARC always finds the runner on GitHub by name,
+// so the labels computed here don't affect unregistration.
+func ensureRunnerLabels(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod) error {
+	v, ok := getAnnotation(pod, AnnotationKeyRunnerLabelTemplates)
+	if !ok {
+		return nil
+	}
+
+	if _, ok := getAnnotation(pod, AnnotationKeyRunnerLabels); ok {
+		return nil
+	}
+
+	if pod.Spec.NodeName == "" {
+		return nil
+	}
+
+	var templates []string
+	if err := json.Unmarshal([]byte(v), &templates); err != nil {
+		log.Error(err, fmt.Sprintf("Failed to parse %s annotation. Registering the runner without the label templates", AnnotationKeyRunnerLabelTemplates))
+	}
+
+	var node *corev1.Node
+
+	var n corev1.Node
+	if err := c.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, &n); err != nil {
+		if !kerrors.IsNotFound(err) {
+			return err
+		}
+
+		log.Info("Node of the runner pod not found. Computing runner labels without the node metadata", "node", pod.Spec.NodeName)
+	} else {
+		node = &n
+	}
+
+	labels, err := renderRunnerLabels(templates, pod, node)
+	if err != nil {
+		// We don't want the runner to wait for the labels forever.
+		log.Error(err, "Failed to compute runner labels. Registering the runner without the label templates")
+	}
+
+	if labels == nil {
+		labels = []string{}
+	}
+
+	value, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+
+	updated := pod.DeepCopy()
+	setAnnotation(updated, AnnotationKeyRunnerLabels, string(value))
+
+	if err := c.Patch(ctx, updated, client.MergeFrom(pod)); err != nil {
+		log.Error(err, fmt.Sprintf("Failed to patch pod to have %s annotation", AnnotationKeyRunnerLabels))
+		return err
+	}
+
+	*pod = *updated
+
+	log.Info("Computed runner labels from the templates", "labels", labels)
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRenderRunnerLabels(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "example-runner",
+			Namespace:   "default",
+			Labels:      map[string]string{"app": "ci"},
+			Annotations: map[string]string{"team": "infra"},
+		},
+	}
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-1",
+			Labels: map[string]string{
+				"topology.kubernetes.io/zone":      "us-east-1a",
+				"node.kubernetes.io/instance-type": "m5.large",
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		templates []string
+		node      *corev1.Node
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "no templates",
+			templates: nil,
+			node:      node,
+			want:      nil,
+		},
+		{
+			name: "pod and node metadata",
+			templates: []string{
+				`zone-{{ index .Node.Labels "topology.kubernetes.io/zone" }}`,
+				`{{ index .Node.Labels "node.kubernetes.io/instance-type" }}`,
+				`node-{{ .Node.Name }}`,
+				`{{ .Pod.Namespace }}-{{ index .Pod.Labels "app" }}`,
+				`team-{{ index .Pod.Annotations "team" }}`,
+			},
+			node: node,
+			want: []string{"zone-us-east-1a", "m5.large", "node-node-1", "default-ci", "team-infra"},
+		},
+		{
+			name: "empty results and duplicates are omitted",
+			templates: []string{
+				`{{ index .Node.Labels "missing" }}`,
+				` {{ .Node.Name }} `,
+				`{{ .Node.Name }}`,
+			},
+			node: node,
+			want: []string{"node-1"},
+		},
+		{
+			name:      "missing node",
+			templates: []string{`{{ .Pod.Name }}`, `{{ index .Node.Labels "topology.kubernetes.io/zone" }}`},
+			node:      nil,
+			want:      []string{"example-runner"},
+		},
+		{
+			name:      "comma in the rendered label",
+			templates: []string{`{{ .Pod.Name }},{{ .Node.Name }}`},
+			node:      node,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid template",
+			templates: []string{`{{ .Node.Name `},
+			node:      node,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderRunnerLabels(tt.templates, pod, tt.node)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("renderRunnerLabels() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renderRunnerLabels() error = %v", err)
+			}
+
+			if d := cmp.Diff(tt.want, got); d != "" {
+				t.Errorf("unexpected labels (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerLabels(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node-1",
+			Labels: map[string]string{"topology.kubernetes.io/zone": "us-east-1a"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		nodeName   string
+		templates  string
+		labels     string
+		wantLabels string
+		wantFound  bool
+	}{
+		{
+			name:      "no label templates",
+			nodeName:  "node-1",
+			wantFound: false,
+		},
+		{
+			name:      "not scheduled",
+			templates: `["zone-{{ index .Node.Labels \"topology.kubernetes.io/zone\" }}"]`,
+			wantFound: false,
+		},
+		{
+			name:       "scheduled",
+			nodeName:   "node-1",
+			templates:  `["zone-{{ index .Node.Labels \"topology.kubernetes.io/zone\" }}"]`,
+			wantLabels: `["zone-us-east-1a"]`,
+			wantFound:  true,
+		},
+		{
+			name:       "already computed",
+			nodeName:   "node-1",
+			templates:  `["zone-{{ index .Node.Labels \"topology.kubernetes.io/zone\" }}"]`,
+			labels:     `["zone-us-west-2a"]`,
+			wantLabels: `["zone-us-west-2a"]`,
+			wantFound:  true,
+		},
+		{
+			name:       "invalid label does not block the registration",
+			nodeName:   "node-1",
+			templates:  `["{{ .Node.Name }},{{ .Pod.Name }}"]`,
+			wantLabels: `[]`,
+			wantFound:  true,
+		},
+		{
+			name:       "missing node",
+			nodeName:   "node-2",
+			templates:  `["{{ .Pod.Name }}"]`,
+			wantLabels: `["example-runner"]`,
+			wantFound:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "example-runner",
+					Namespace:   "default",
+					Annotations: map[string]string{},
+				},
+				Spec: corev1.PodSpec{NodeName: tt.nodeName},
+			}
+			if tt.templates != "" {
+				pod.Annotations[AnnotationKeyRunnerLabelTemplates] = tt.templates
+			}
+			if tt.labels != "" {
+				pod.Annotations[AnnotationKeyRunnerLabels] = tt.labels
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(node, pod).Build()
+
+			if err := ensureRunnerLabels(context.Background(), c, logr.Discard(), pod); err != nil {
+				t.Fatalf("ensureRunnerLabels() error = %v", err)
+			}
+
+			var updated corev1.Pod
+			if err := c.Get(context.Background(), types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, &updated); err != nil {
+				t.Fatal(err)
+			}
+
+			got, found := getAnnotation(&updated, AnnotationKeyRunnerLabels)
+			if found != tt.wantFound {
+				t.Fatalf("unexpected presence of %s annotation: got %v, want %v", AnnotationKeyRunnerLabels, found, tt.wantFound)
+			}
+			if got != tt.wantLabels {
+				t.Errorf("unexpected runner labels: got %s, want %s", got, tt.wantLabels)
+			}
+		})
+	}
+}
+
+func TestNewRunnerPod_LabelTemplates(t *testing.T) {
+	runnerSpec := v1alpha1.RunnerConfig{
+		Repository:     "test/valid",
+		LabelTemplates: []string{`zone-{{ index .Node.Labels "topology.kubernetes.io/zone" }}`},
+	}
+
+	pod, err := newRunnerPod(corev1.Pod{}, runnerSpec, "runner:latest", nil, "docker:dind", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pod.Annotations[AnnotationKeyRunnerLabelTemplates]; got != `["zone-{{ index .Node.Labels \"topology.kubernetes.io/zone\" }}"]` {
+		t.Errorf("unexpected %s annotation: %s", AnnotationKeyRunnerLabelTemplates, got)
+	}
+
+	var env string
+	for _, e := range pod.Spec.Containers[0].Env {
+		if e.Name == EnvVarRunnerLabelsFile {
+			env = e.Value
+		}
+	}
+	if env != "/etc/actions-runner-controller/runner-labels/labels" {
+		t.Errorf("unexpected %s: %q", EnvVarRunnerLabelsFile, env)
+	}
+
+	runnerSpec.LabelTemplates = []string{`{{ .Node.Name `}
+
+	if _, err := newRunnerPod(corev1.Pod{}, runnerSpec, "runner:latest", nil, "docker:dind", "", "", false); err == nil {
+		t.Errorf("newRunnerPod() succeeded with an invalid label template")
+	}
+}
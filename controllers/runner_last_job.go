@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AnnotationKeyLastJob is the annotation ARC adds to the runner pod on unregistration, to record the last job the runner ran.
+	// The value is a JSON-encoded LastJobInfo.
+	AnnotationKeyLastJob = "actions-runner-controller/last-job"
+)
+
+// LastJobInfo is the information about the last workflow job a runner ran.
+//
+// ARC reads it from the termination message of the runner container, which is the content of the file at
+// the container's terminationMessagePath (/dev/termination-log by default).
+// A custom runner image or a job-completed hook can write it like:
+//
+//   echo '{"jobID":123,"runID":456,"workflow":"CI","repository":"owner/repo"}' > /dev/termination-log
+type LastJobInfo struct {
+	JobID      int64  `json:"jobID,omitempty"`
+	RunID      int64  `json:"runID,omitempty"`
+	Workflow   string `json:"workflow,omitempty"`
+	Repository string `json:"repository,omitempty"`
+}
+
+// lastJobInfoFromPod returns the last job info written by the runner container,
+// or false if it isn't available.
+func lastJobInfoFromPod(pod *corev1.Pod) (*LastJobInfo, bool) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != containerName {
+			continue
+		}
+
+		// The runner container may have been restarted after writing the info, in which case
+		// it can be found only in the last termination state.
+		for _, state := range []corev1.ContainerState{status.State, status.LastTerminationState} {
+			if state.Terminated == nil {
+				continue
+			}
+
+			if info, ok := parseLastJobInfo(state.Terminated.Message); ok {
+				return info, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func parseLastJobInfo(msg string) (*LastJobInfo, bool) {
+	msg = strings.TrimSpace(msg)
+	if msg == "" {
+		return nil, false
+	}
+
+	var info LastJobInfo
+	if err := json.Unmarshal([]byte(msg), &info); err != nil {
+		return nil, false
+	}
+
+	if info.JobID == 0 && info.RunID == 0 && info.Workflow == "" {
+		return nil, false
+	}
+
+	return &info, true
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"sync"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// staleRunnerListThreshold is the number of consecutive unregistration attempts that don't find the runner seen registered before
+// in the cached list of runners, until ARC suspects the cache entry is stale and invalidates it.
+//
+// A single miss can be legit, as GitHub allows caching the list for up to a minute and someone may have removed the runner,
+// but a runner still running in its pod shouldn't keep missing in the list.
+const staleRunnerListThreshold = 2
+
+// staleRunnerListMisses counts the consecutive misses of the runners per runner pod.
+var staleRunnerListMisses = newMissCounter()
+
+type missCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newMissCounter() *missCounter {
+	return &missCounter{counts: map[string]int{}}
+}
+
+// inc counts a miss of key, and returns the number of the consecutive misses so far.
+func (c *missCounter) inc(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[key]++
+
+	return c.counts[key]
+}
+
+func (c *missCounter) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.counts, key)
+}
+
+// shouldInvalidateRunnerList returns true if the runner not found in the list of runners should have been listed,
+// and the list may be stale as it was served from the cache, for staleRunnerListThreshold times in a row.
+// The runner should have been listed when ARC saw it registered before and its runner is still running,
+// as a runner removed from GitHub by itself or by others would stop.
+func shouldInvalidateRunnerList(log logr.Logger, listAge *github.RunnersListAge, runner string, pod *corev1.Pod) bool {
+	key := runnerGracefulStopLockKey(runner, pod)
+
+	if pod == nil || !listAge.FromCache || isJITRunnerPod(pod) || runnerPodOrContainerIsStopped(pod, runnerPodCleanStopConfig(log, pod)) {
+		staleRunnerListMisses.forget(key)
+		return false
+	}
+
+	if _, ok := getAnnotation(pod, AnnotationKeyRegistrationFirstSeenTimestamp); !ok {
+		staleRunnerListMisses.forget(key)
+		return false
+	}
+
+	if staleRunnerListMisses.inc(key) < staleRunnerListThreshold {
+		return false
+	}
+
+	staleRunnerListMisses.forget(key)
+
+	return true
+}
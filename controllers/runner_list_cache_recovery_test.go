@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEnsureRunnerUnregistration_InvalidatesStaleRunnerList(t *testing.T) {
+	var (
+		registered bool
+		lists      int
+		removed    int
+	)
+
+	// The clock of the server is an hour ahead, which keeps the cached list without the runner fresh long after the max-age.
+	date := time.Now().Add(time.Hour).UTC()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			lists++
+
+			w.Header().Set("Cache-Control", "private, max-age=60, s-maxage=60")
+			w.Header().Set("Date", date.Format(http.TimeFormat))
+
+			runners := gogithub.Runners{}
+			if registered {
+				runners.TotalCount = 1
+				runners.Runners = []*gogithub.Runner{{ID: gogithub.Int64(1), Name: gogithub.String("test1"), Status: gogithub.String("online"), Busy: gogithub.Bool(false)}}
+			}
+
+			json.NewEncoder(w).Encode(runners)
+		case http.MethodDelete:
+			removed++
+
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	ghc := newGithubClient(server)
+
+	// The list without the runner is cached before the runner registers.
+	if _, err := ghc.ListRunnersWithFilter(context.Background(), "", "", "test/valid", github.RunnerFilter{Name: "test1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	registered = true
+
+	now := time.Now()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "test1",
+			CreationTimestamp: metav1.NewTime(now.Add(-10 * time.Minute)),
+			Annotations: map[string]string{
+				AnnotationKeyRegistrationFirstSeenTimestamp: formatUnregistrationTimestamp(now.Add(-9 * time.Minute)),
+				unregistrationStartTimestamp():              formatUnregistrationTimestamp(now),
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+		},
+	}
+
+	defer staleRunnerListMisses.forget(runnerGracefulStopLockKey("test1", pod))
+
+	requeue := RequeuePolicy{InProgressDelay: 10 * time.Second}
+
+	for i := 0; i < staleRunnerListThreshold-1; i++ {
+		res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Hour}, requeue, logr.Discard(), ghc, "", "", "test/valid", "test1", pod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res == nil {
+			t.Fatalf("attempt %d: expected the unregistration to be retried", i)
+		}
+	}
+
+	if removed != 0 || lists != 1 {
+		t.Fatalf("expected the cached list to be used until the threshold: removed = %d, lists = %d", removed, lists)
+	}
+
+	res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Hour}, requeue, logr.Discard(), ghc, "", "", "test/valid", "test1", pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res != nil {
+		t.Errorf("expected the runner to be unregistered after invalidating the cached list, got %+v", res)
+	}
+
+	if removed != 1 || lists != 2 {
+		t.Errorf("expected the runner found in the list fetched after the invalidation to be removed: removed = %d, lists = %d", removed, lists)
+	}
+}
+
+func TestShouldInvalidateRunnerList_RunnerStopped(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "test1",
+			Annotations: map[string]string{AnnotationKeyRegistrationFirstSeenTimestamp: formatUnregistrationTimestamp(time.Now())},
+		},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}}},
+		},
+	}
+
+	defer staleRunnerListMisses.forget(runnerGracefulStopLockKey("test1", pod))
+
+	for i := 0; i < staleRunnerListThreshold*2; i++ {
+		if shouldInvalidateRunnerList(logr.Discard(), &github.RunnersListAge{FromCache: true}, "test1", pod) {
+			t.Fatalf("expected the list missing the stopped runner not to be invalidated")
+		}
+	}
+}
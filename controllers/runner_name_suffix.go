@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+)
+
+// findSuffixedRunner returns the runner registered with the name followed by a suffix fully matching the regular expression pattern,
+// e.g. `-\d+`, or nil if there's none or the pattern is empty.
+//
+// It returns an error when more than one runner matches, as we can't tell which one is the runner of the pod,
+// and removing a wrong one would stop a runner of another pod.
+func findSuffixedRunner(ctx context.Context, log logr.Logger, client github.RunnerAPI, pattern, enterprise, org, repo, name string) (*gogithub.Runner, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	re, err := regexp.Compile("^" + regexp.QuoteMeta(name) + "(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+
+	// GitHub filters runners by the exact name, so we need to list all the runners in the scope to see suffixed names.
+	runners, err := client.ListRunnersWithFilter(ctx, enterprise, org, repo, github.RunnerFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*gogithub.Runner
+
+	for _, runner := range runners {
+		if re.MatchString(runner.GetName()) {
+			matches = append(matches, runner)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		log.Info("Runner is registered on GitHub with a suffixed name.", "registeredName", matches[0].GetName(), "runnerID", matches[0].GetID())
+
+		return matches[0], nil
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, runner := range matches {
+		names = append(names, runner.GetName())
+	}
+
+	return nil, fmt.Errorf("found %d runners whose names are %q followed by a suffix matching %q, refusing to guess which one to remove: %v", len(matches), name, pattern, names)
+}
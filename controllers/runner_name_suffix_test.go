@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+)
+
+func TestUnregisterRunner_SuffixedName(t *testing.T) {
+	runner := func(id int64, name string) *gogithub.Runner {
+		return &gogithub.Runner{ID: gogithub.Int64(id), Name: gogithub.String(name), Status: gogithub.String("offline")}
+	}
+
+	tests := []struct {
+		name        string
+		pattern     string
+		runners     []*gogithub.Runner
+		want        bool
+		wantRemoved []int64
+		wantErr     bool
+	}{
+		{
+			name:        "exact name preferred over suffixed names",
+			pattern:     `-\d+`,
+			runners:     []*gogithub.Runner{runner(1, "example-abcde-1"), runner(2, "example-abcde")},
+			want:        true,
+			wantRemoved: []int64{2},
+		},
+		{
+			name:        "suffixed name",
+			pattern:     `-\d+`,
+			runners:     []*gogithub.Runner{runner(1, "example-abcde-1"), runner(2, "example-fghij")},
+			want:        true,
+			wantRemoved: []int64{1},
+		},
+		{
+			name:    "suffix not fully matching the pattern",
+			pattern: `-\d+`,
+			runners: []*gogithub.Runner{runner(1, "example-abcde-1x"), runner(2, "example-abcdef")},
+		},
+		{
+			name:    "ambiguous suffixed names",
+			pattern: `-\d+`,
+			runners: []*gogithub.Runner{runner(1, "example-abcde-1"), runner(2, "example-abcde-2")},
+			wantErr: true,
+		},
+		{
+			name:    "disabled",
+			runners: []*gogithub.Runner{runner(1, "example-abcde-1")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeRunnerAPI{runners: tt.runners}
+
+			got, err := unregisterRunner(context.Background(), GracefulStopConfig{RunnerNameSuffixPattern: tt.pattern}, logr.Discard(), client, "", "", "test/valid", "example-abcde")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unregisterRunner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("unregisterRunner() = %v, want %v", got, tt.want)
+			}
+
+			if len(client.removed) != len(tt.wantRemoved) || len(tt.wantRemoved) > 0 && client.removed[0] != tt.wantRemoved[0] {
+				t.Errorf("unexpected removed runners: got %v, want %v", client.removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestGracefulStopConfig_InvalidRunnerNameSuffixPattern(t *testing.T) {
+	if err := (GracefulStopConfig{RunnerNameSuffixPattern: `-(\d+`}).Validate(); err == nil {
+		t.Errorf("expected an invalid pattern to be rejected")
+	}
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// runnerNameTemplateData is the data the runner name template is executed with.
+type runnerNameTemplateData struct {
+	// Name is the name of the runner pod, which is also the name of the Runner for RunnerDeployment runners.
+	Name string
+}
+
+// parseRunnerNameTemplate parses the Go template the name of the runner registered on GitHub is rendered from,
+// e.g. `cluster-a-{{ .Name }}`. It returns nil for an empty text, which means the runner is registered with the name of the runner pod.
+func parseRunnerNameTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("runner-name").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid runner name template %q: %w", text, err)
+	}
+
+	// Catch templates referring to unknown fields or rendering nothing before any runner is unregistered with them.
+	if _, err := renderRunnerName(tmpl, "example"); err != nil {
+		return nil, fmt.Errorf("invalid runner name template %q: %w", text, err)
+	}
+
+	return tmpl, nil
+}
+
+// githubRunnerName returns the name of the runner registered on GitHub for the runner pod named name,
+// rendered from the runner name template text.
+func githubRunnerName(text, name string) (string, error) {
+	tmpl, err := parseRunnerNameTemplate(text)
+	if err != nil || tmpl == nil {
+		return name, err
+	}
+
+	return renderRunnerName(tmpl, name)
+}
+
+func renderRunnerName(tmpl *template.Template, name string) (string, error) {
+	var buf bytes.Buffer
+
+	if err := tmpl.Execute(&buf, runnerNameTemplateData{Name: name}); err != nil {
+		return "", err
+	}
+
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("runner name template rendered an empty name for %q", name)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+)
+
+func TestUnregisterRunner_NameTemplate(t *testing.T) {
+	runner := func(id int64, name string) *gogithub.Runner {
+		return &gogithub.Runner{ID: gogithub.Int64(id), Name: gogithub.String(name), Status: gogithub.String("offline")}
+	}
+
+	tests := []struct {
+		name        string
+		template    string
+		runners     []*gogithub.Runner
+		want        bool
+		wantRemoved []int64
+	}{
+		{
+			name:        "prefixed name",
+			template:    "cluster-a-{{ .Name }}",
+			runners:     []*gogithub.Runner{runner(1, "example-abcde"), runner(2, "cluster-a-example-abcde"), runner(3, "cluster-b-example-abcde")},
+			want:        true,
+			wantRemoved: []int64{2},
+		},
+		{
+			name:     "runner of another cluster",
+			template: "cluster-a-{{ .Name }}",
+			runners:  []*gogithub.Runner{runner(3, "cluster-b-example-abcde")},
+		},
+		{
+			name:        "identity",
+			runners:     []*gogithub.Runner{runner(1, "example-abcde"), runner(2, "cluster-a-example-abcde")},
+			want:        true,
+			wantRemoved: []int64{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeRunnerAPI{runners: tt.runners}
+
+			got, err := unregisterRunner(context.Background(), GracefulStopConfig{RunnerNameTemplate: tt.template}, logr.Discard(), client, "", "", "test/valid", "example-abcde")
+			if err != nil {
+				t.Fatalf("unregisterRunner() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("unregisterRunner() = %v, want %v", got, tt.want)
+			}
+
+			if len(client.removed) != len(tt.wantRemoved) || len(tt.wantRemoved) > 0 && client.removed[0] != tt.wantRemoved[0] {
+				t.Errorf("unexpected removed runners: got %v, want %v", client.removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestGracefulStopConfig_InvalidRunnerNameTemplate(t *testing.T) {
+	for _, text := range []string{"cluster-a-{{ .Name", "cluster-a-{{ .Namespace }}", "{{ if false }}{{ end }}"} {
+		if err := (GracefulStopConfig{RunnerNameTemplate: text}).Validate(); err == nil {
+			t.Errorf("expected %q to be rejected", text)
+		}
+	}
+}
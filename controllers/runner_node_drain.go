@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// LabelKeyNodeDrain is the label ARC adds to the runner pod once it started stopping the runner gracefully
+	// because the node the pod is running on became unschedulable.
+	// It's a label rather than an annotation so that ARC can count the in-progress drains with a label selector.
+	LabelKeyNodeDrain = "actions-runner-controller/node-drain"
+
+	// DefaultMaxConcurrentNodeDrains is the maximum number of runner pods that are gracefully stopped at the same time
+	// due to their nodes becoming unschedulable.
+	DefaultMaxConcurrentNodeDrains = 10
+
+	// TaintKeyClusterAutoscalerToBeDeleted is the taint cluster-autoscaler adds to a node it's going to scale down.
+	TaintKeyClusterAutoscalerToBeDeleted = "ToBeDeletedByClusterAutoscaler"
+
+	nodeDrainRetryDelay = 10 * time.Second
+)
+
+// NodeDrainConfig configures the graceful stop of runners on nodes that became unschedulable,
+// like on cordon, drain, cluster-autoscaler scale down, or spot instance reclamation.
+type NodeDrainConfig struct {
+	// Enabled makes ARC watch nodes and gracefully stop runners on unschedulable nodes proactively,
+	// instead of waiting for the runner pods to be evicted.
+	Enabled bool
+
+	// MaxConcurrentDrains is the maximum number of runner pods gracefully stopped at the same time due to node drains,
+	// across all the nodes. Defaults to DefaultMaxConcurrentNodeDrains.
+	MaxConcurrentDrains int
+}
+
+func (c NodeDrainConfig) maxConcurrentDrains() int {
+	if c.MaxConcurrentDrains > 0 {
+		return c.MaxConcurrentDrains
+	}
+	return DefaultMaxConcurrentNodeDrains
+}
+
+// nodeIsUnschedulable returns true if the node is cordoned or tainted to stop accepting new pods soon.
+func nodeIsUnschedulable(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+
+	for _, t := range node.Spec.Taints {
+		if t.Effect != corev1.TaintEffectNoSchedule && t.Effect != corev1.TaintEffectNoExecute {
+			continue
+		}
+
+		switch t.Key {
+		case corev1.TaintNodeUnschedulable, TaintKeyClusterAutoscalerToBeDeleted:
+			return true
+		}
+	}
+
+	return false
+}
+
+// nodeBecameUnschedulable is the predicate to watch nodes only when they become unschedulable,
+// so that node status updates don't enqueue runners.
+func nodeBecameUnschedulable() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			node, ok := e.Object.(*corev1.Node)
+			return ok && nodeIsUnschedulable(node)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			old, ok := e.ObjectOld.(*corev1.Node)
+			if !ok {
+				return false
+			}
+
+			node, ok := e.ObjectNew.(*corev1.Node)
+
+			return ok && !nodeIsUnschedulable(old) && nodeIsUnschedulable(node)
+		},
+		DeleteFunc: func(event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(event.GenericEvent) bool {
+			return false
+		},
+	}
+}
+
+// runnerPodRequestsOnNode returns the map function that enqueues the requests for the runner pods on the node.
+// toRequest returns the request to enqueue for the pod, or false if the pod isn't managed by the controller.
+func runnerPodRequestsOnNode(c client.Client, log logr.Logger, toRequest func(pod *corev1.Pod) (reconcile.Request, bool)) func(client.Object) []reconcile.Request {
+	return func(obj client.Object) []reconcile.Request {
+		var pods corev1.PodList
+
+		// We don't index pods by the node name, as the pods are already in the informer cache and
+		// a node becomes unschedulable far less frequently than pods change.
+		if err := c.List(context.Background(), &pods); err != nil {
+			log.Error(err, "Failed to list pods to drain runners on the unschedulable node", "node", obj.GetName())
+			return nil
+		}
+
+		var reqs []reconcile.Request
+
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+
+			if pod.Spec.NodeName != obj.GetName() {
+				continue
+			}
+
+			if req, ok := toRequest(pod); ok {
+				reqs = append(reqs, req)
+			}
+		}
+
+		if len(reqs) > 0 {
+			log.Info("Node became unschedulable. Draining runners on the node", "node", obj.GetName(), "runners", len(reqs))
+		}
+
+		return reqs
+	}
+}
+
+// runnerPodIsOnUnschedulableNode returns true if the runner pod is running on an unschedulable node.
+func runnerPodIsOnUnschedulableNode(ctx context.Context, c client.Client, pod *corev1.Pod) (bool, error) {
+	if pod.Spec.NodeName == "" {
+		return false, nil
+	}
+
+	var node corev1.Node
+	if err := c.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, &node); err != nil {
+		if kerrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return nodeIsUnschedulable(&node), nil
+}
+
+// acquireNodeDrainSlot marks the runner pod as being drained, unless as many runner pods as the limit are already being drained.
+// It returns true if the pod is marked, including when it has been marked before.
+//
+// The in-progress drains are counted from the labelled pods, so that the limit survives controller restarts, and
+// each drain releases its slot once the pod is gone.
+func acquireNodeDrainSlot(ctx context.Context, c client.Client, log logr.Logger, pod *corev1.Pod, maxConcurrentDrains int) (bool, error) {
+	if _, ok := pod.Labels[LabelKeyNodeDrain]; ok {
+		return true, nil
+	}
+
+	var draining corev1.PodList
+	if err := c.List(ctx, &draining, client.HasLabels{LabelKeyNodeDrain}); err != nil {
+		return false, err
+	}
+
+	if len(draining.Items) >= maxConcurrentDrains {
+		log.V(1).Info("Postponing drain of the runner on the unschedulable node as too many runners are being drained", "draining", len(draining.Items), "maxConcurrentDrains", maxConcurrentDrains)
+		return false, nil
+	}
+
+	updated := pod.DeepCopy()
+	if updated.Labels == nil {
+		updated.Labels = map[string]string{}
+	}
+	updated.Labels[LabelKeyNodeDrain] = "true"
+
+	if err := c.Patch(ctx, updated, client.MergeFrom(pod)); err != nil {
+		log.Error(err, fmt.Sprintf("Failed to patch pod to have %s label", LabelKeyNodeDrain))
+		return false, err
+	}
+
+	*pod = *updated
+
+	return true, nil
+}
+
+// drainRunnerPodOnUnschedulableNode gracefully stops the runner whose pod is running on an unschedulable node,
+// and deletes the pod once the runner is unregistered, so that the runner is recreated onto another node.
+//
+// It returns a nil *ctrl.Result when the pod doesn't need to be drained.
+// Once the drain has started, it continues even if the node becomes schedulable again,
+// as the runner may have already been unregistered. The pod is deleted with the propagation policy.
+func drainRunnerPodOnUnschedulableNode(ctx context.Context, c client.Client, log logr.Logger, conf NodeDrainConfig, propagationPolicy metav1.DeletionPropagation, pod *corev1.Pod, gracefulStop func(pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error)) (*ctrl.Result, error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+
+	if _, ok := pod.Labels[LabelKeyNodeDrain]; !ok {
+		unschedulable, err := runnerPodIsOnUnschedulableNode(ctx, c, pod)
+		if err != nil {
+			return &ctrl.Result{}, err
+		}
+
+		if !unschedulable {
+			return nil, nil
+		}
+
+		acquired, err := acquireNodeDrainSlot(ctx, c, log, pod, conf.maxConcurrentDrains())
+		if err != nil {
+			return &ctrl.Result{}, err
+		}
+
+		if !acquired {
+			return &ctrl.Result{RequeueAfter: nodeDrainRetryDelay}, nil
+		}
+
+		log.Info("Gracefully stopping the runner as its node became unschedulable", "node", pod.Spec.NodeName)
+	}
+
+	updatedPod, res, err := gracefulStop(pod)
+	if res != nil {
+		return res, err
+	}
+
+	if updatedPod == nil {
+		updatedPod = pod
+	}
+
+	// The runner pod finalizer is removed by the pod deletion handler, which sees the unregistration already completed.
+	if err := deleteRunnerPod(ctx, c, propagationPolicy, updatedPod); err != nil && !kerrors.IsNotFound(err) {
+		log.Error(err, "Failed to delete the runner pod on the unschedulable node")
+		return &ctrl.Result{}, err
+	}
+
+	log.Info("Deleted the runner pod on the unschedulable node", "node", updatedPod.Spec.NodeName)
+
+	return &ctrl.Result{}, nil
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestNodeIsUnschedulable(t *testing.T) {
+	tests := []struct {
+		name string
+		spec corev1.NodeSpec
+		want bool
+	}{
+		{
+			name: "schedulable",
+			want: false,
+		},
+		{
+			name: "cordoned",
+			spec: corev1.NodeSpec{Unschedulable: true},
+			want: true,
+		},
+		{
+			name: "unschedulable taint",
+			spec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}}},
+			want: true,
+		},
+		{
+			name: "cluster-autoscaler scale down",
+			spec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: TaintKeyClusterAutoscalerToBeDeleted, Value: "1650000000", Effect: corev1.TaintEffectNoSchedule}}},
+			want: true,
+		},
+		{
+			name: "prefer no schedule",
+			spec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: TaintKeyClusterAutoscalerToBeDeleted, Effect: corev1.TaintEffectPreferNoSchedule}}},
+			want: false,
+		},
+		{
+			name: "unrelated taint",
+			spec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: "dedicated", Value: "ci", Effect: corev1.TaintEffectNoSchedule}}},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeIsUnschedulable(&corev1.Node{Spec: tt.spec}); got != tt.want {
+				t.Errorf("nodeIsUnschedulable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeBecameUnschedulable(t *testing.T) {
+	schedulable := &corev1.Node{}
+	cordoned := &corev1.Node{Spec: corev1.NodeSpec{Unschedulable: true}}
+
+	p := nodeBecameUnschedulable()
+
+	if !p.Update(event.UpdateEvent{ObjectOld: schedulable, ObjectNew: cordoned}) {
+		t.Errorf("cordon must enqueue the runners on the node")
+	}
+	if p.Update(event.UpdateEvent{ObjectOld: cordoned, ObjectNew: cordoned}) {
+		t.Errorf("updates to the already cordoned node must not enqueue the runners on the node")
+	}
+	if p.Update(event.UpdateEvent{ObjectOld: cordoned, ObjectNew: schedulable}) {
+		t.Errorf("uncordon must not enqueue the runners on the node")
+	}
+	if !p.Create(event.CreateEvent{Object: cordoned}) {
+		t.Errorf("the cordoned node seen on startup must enqueue the runners on the node")
+	}
+}
+
+func TestRunnerPodRequestsOnNode(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	pod := func(name, node string, owned bool) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       corev1.PodSpec{NodeName: node},
+		}
+		if owned {
+			p.Labels = map[string]string{LabelKeyRunnerSetName: "example"}
+		}
+		return p
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		pod("runner-on-node-1", "node-1", true),
+		pod("runner-on-node-2", "node-2", true),
+		pod("other-on-node-1", "node-1", false),
+	).Build()
+
+	mapFn := runnerPodRequestsOnNode(c, logr.Discard(), func(pod *corev1.Pod) (reconcile.Request, bool) {
+		if _, ok := pod.Labels[LabelKeyRunnerSetName]; !ok {
+			return reconcile.Request{}, false
+		}
+		return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}}, true
+	})
+
+	got := mapFn(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+
+	want := []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "default", Name: "runner-on-node-1"}}}
+
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("unexpected requests (-want +got):\n%s", d)
+	}
+}
+
+func TestRunnerReconciler_NodeDrain(t *testing.T) {
+	tests := []struct {
+		name             string
+		node             corev1.NodeSpec
+		draining         int
+		wantRemoveRunner int
+		wantPodDeleted   bool
+		wantDrainLabel   bool
+		wantRequeueAfter time.Duration
+	}{
+		{
+			name: "runner on schedulable node",
+		},
+		{
+			name:             "runner on tainted node",
+			node:             corev1.NodeSpec{Taints: []corev1.Taint{{Key: TaintKeyClusterAutoscalerToBeDeleted, Effect: corev1.TaintEffectNoSchedule}}},
+			wantRemoveRunner: 1,
+			wantPodDeleted:   true,
+			wantDrainLabel:   true,
+		},
+		{
+			name:             "runner on cordoned node within the concurrency limit",
+			node:             corev1.NodeSpec{Unschedulable: true},
+			draining:         1,
+			wantRemoveRunner: 1,
+			wantPodDeleted:   true,
+			wantDrainLabel:   true,
+		},
+		{
+			name:             "runner on cordoned node beyond the concurrency limit",
+			node:             corev1.NodeSpec{Unschedulable: true},
+			draining:         2,
+			wantRequeueAfter: nodeDrainRetryDelay,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerHandler(removeRunner),
+			)
+			defer server.Close()
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+			_ = v1alpha1.AddToScheme(scheme)
+
+			runner := &v1alpha1.Runner{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:  "default",
+					Name:       "test1",
+					Finalizers: []string{finalizerName},
+				},
+				Spec: v1alpha1.RunnerSpec{
+					RunnerConfig: v1alpha1.RunnerConfig{
+						Repository: "test/valid",
+					},
+				},
+				Status: v1alpha1.RunnerStatus{
+					Phase: string(corev1.PodRunning),
+					Registration: v1alpha1.RunnerStatusRegistration{
+						Repository: "test/valid",
+						Token:      fake.RegistrationToken,
+						ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+					},
+				},
+			}
+
+			ghc := newGithubClient(server)
+
+			r := &RunnerReconciler{
+				Log:         logr.Discard(),
+				Recorder:    record.NewFakeRecorder(10),
+				Scheme:      scheme,
+				RunnerImage: "example/runner:test",
+				DockerImage: "example/docker:test",
+				NodeDrain: NodeDrainConfig{
+					Enabled:             true,
+					MaxConcurrentDrains: 2,
+				},
+			}
+
+			pod, err := r.newPod(*runner, ghc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pod.CreationTimestamp = metav1.Now()
+			pod.Status.Phase = corev1.PodRunning
+			pod.Spec.NodeName = "node-1"
+
+			objs := []client.Object{
+				runner,
+				&pod,
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Spec: tt.node},
+			}
+
+			for i := 0; i < tt.draining; i++ {
+				objs = append(objs, &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "draining-" + string(rune('a'+i)),
+						Labels:    map[string]string{LabelKeyNodeDrain: "true"},
+					},
+				})
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+			r.Client = c
+			r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+			ctx := context.Background()
+			key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if res.RequeueAfter != tt.wantRequeueAfter {
+				t.Errorf("unexpected RequeueAfter: got %v, want %v", res.RequeueAfter, tt.wantRequeueAfter)
+			}
+
+			if got := len(removeRunner.Calls()); got != tt.wantRemoveRunner {
+				t.Errorf("unexpected number of remove runner calls: got %d, want %d", got, tt.wantRemoveRunner)
+			}
+
+			var updated corev1.Pod
+			if err := c.Get(ctx, key, &updated); err != nil {
+				t.Fatal(err)
+			}
+
+			if deleted := !updated.DeletionTimestamp.IsZero(); deleted != tt.wantPodDeleted {
+				t.Errorf("unexpected pod deletion: got %v, want %v", deleted, tt.wantPodDeleted)
+			}
+
+			if _, labelled := updated.Labels[LabelKeyNodeDrain]; labelled != tt.wantDrainLabel {
+				t.Errorf("unexpected presence of %s label: got %v, want %v", LabelKeyNodeDrain, labelled, tt.wantDrainLabel)
+			}
+
+			if tt.wantPodDeleted {
+				if got := updated.Annotations[AnnotationKeyUnregistrationReason]; got != string(UnregistrationReasonNodeDrain) {
+					t.Errorf("unexpected unregistration reason: got %q, want %q", got, UnregistrationReasonNodeDrain)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// containerReasonOOMKilled is the reason of the terminated state of a container killed for exceeding its memory limit.
+const containerReasonOOMKilled = "OOMKilled"
+
+// runnerContainerOOMKilled returns true if the runner container of the pod has been OOMKilled and hasn't come back.
+// It's told apart from a clean exit by the reason of the terminated state, as an OOMKilled container usually exits with 137 but so does a container killed for other reasons.
+//
+// The kubelet restarts the OOMKilled container due to the OnFailure restart policy. A restarted container that is running may have picked up a new job,
+// so the last termination state counts only while the restarted container isn't running, e.g. while it's waiting in the crash loop back-off.
+func runnerContainerOOMKilled(pod *corev1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != containerName {
+			continue
+		}
+
+		if t := status.State.Terminated; t != nil {
+			return t.Reason == containerReasonOOMKilled
+		}
+
+		if t := status.LastTerminationState.Terminated; t != nil && status.State.Running == nil {
+			return t.Reason == containerReasonOOMKilled
+		}
+	}
+
+	return false
+}
+
+// runnerContainerTerminated returns true if the runner container of the pod is terminated and hasn't been restarted yet.
+func runnerContainerTerminated(pod *corev1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == containerName {
+			return status.State.Terminated != nil
+		}
+	}
+
+	return false
+}
+
+// recreateOOMKilledRunnerPod unregisters the runner of the OOMKilled runner pod and deletes the pod, so that the pod is recreated in the next reconciliation.
+//
+// While the runner container is still terminated, it can't be running a job even if GitHub still lists the runner as busy,
+// so the runner is unregistered without waiting for it to be no longer busy, the same as a forced stop.
+// Otherwise, e.g. while the restarted container is in the crash loop back-off, the container may come back and pick up a job,
+// so the runner is gracefully stopped like any other.
+func (r *RunnerReconciler) recreateOOMKilledRunnerPod(ctx context.Context, runner v1alpha1.Runner, log logr.Logger, ghc *github.Client, pod *corev1.Pod) (ctrl.Result, error) {
+	key := runnerGracefulStopLockKey(runner.Name, pod)
+
+	progressLog := unregistrationProgressLogs.logger(log, r.UnregistrationProgressLogInterval, key, time.Now())
+	progressLog.Info("Runner container has been OOMKilled. Unregistering the runner and recreating the pod.", "podCreationTimestamp", pod.CreationTimestamp)
+
+	updatedPod := pod
+
+	if runnerContainerTerminated(pod) {
+		unregistered, err := unregisterRunner(ctx, r.GracefulStopConfig, log, withRunnerOwnership(ghc, r.RunnerOwnership), runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name)
+		if err != nil {
+			log.Info("Failed to unregister the OOMKilled runner. Not retrying as the runner container is gone. The runner is replaced on GitHub once the recreated pod registers with the same name.", "error", err.Error())
+		} else if unregistered {
+			log.Info("Unregistered the OOMKilled runner")
+		}
+
+		unregistrationProgressLogs.forget(key)
+	} else {
+		var (
+			res *ctrl.Result
+			err error
+		)
+
+		updatedPod, res, err = r.tickRunnerGracefulStop(ctx, runner, UnregistrationReasonOOMKilled, log, ghc, pod)
+		if res != nil {
+			return r.processUnregistrationResult(ctx, runner, log, *res, err)
+		}
+	}
+
+	if err := r.removeRunnerPodFinalizer(ctx, log, updatedPod); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := deleteRunnerPod(ctx, r.Client, r.PodDeletionPropagationPolicy, updatedPod); client.IgnoreNotFound(err) != nil {
+		log.Error(err, "Failed to delete OOMKilled runner pod")
+		return ctrl.Result{}, err
+	}
+
+	r.Recorder.Event(&runner, corev1.EventTypeWarning, "RunnerOOMKilled", fmt.Sprintf("Deleted pod '%s' to recreate the runner as its runner container has been OOMKilled", pod.Name))
+
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRunnerContainerOOMKilled(t *testing.T) {
+	terminated := func(reason string, exitCode int32) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode}}
+	}
+
+	tests := []struct {
+		name   string
+		status corev1.ContainerStatus
+		want   bool
+	}{
+		{
+			name:   "oom killed",
+			status: corev1.ContainerStatus{Name: containerName, State: terminated(containerReasonOOMKilled, 137)},
+			want:   true,
+		},
+		{
+			name: "restarted and running after oom killed",
+			status: corev1.ContainerStatus{
+				Name:                 containerName,
+				State:                corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+				LastTerminationState: terminated(containerReasonOOMKilled, 137),
+				RestartCount:         1,
+			},
+		},
+		{
+			name: "waiting to restart after oom killed",
+			status: corev1.ContainerStatus{
+				Name:                 containerName,
+				State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: terminated(containerReasonOOMKilled, 137),
+				RestartCount:         1,
+			},
+			want: true,
+		},
+		{
+			name: "exited cleanly after restarted from oom killed",
+			status: corev1.ContainerStatus{
+				Name:                 containerName,
+				State:                terminated("Completed", 0),
+				LastTerminationState: terminated(containerReasonOOMKilled, 137),
+				RestartCount:         1,
+			},
+		},
+		{
+			name:   "clean exit",
+			status: corev1.ContainerStatus{Name: containerName, State: terminated("Completed", 0)},
+		},
+		{
+			name:   "killed for another reason",
+			status: corev1.ContainerStatus{Name: containerName, State: terminated("Error", 137)},
+		},
+		{
+			name:   "docker sidecar oom killed",
+			status: corev1.ContainerStatus{Name: "docker", State: terminated(containerReasonOOMKilled, 137)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{tt.status}}}
+
+			if got := runnerContainerOOMKilled(pod); got != tt.want {
+				t.Errorf("runnerContainerOOMKilled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newOOMKilledRunnerReconciler returns the reconciler along with the client that has the runner and its pod with the container status.
+func newOOMKilledRunnerReconciler(t *testing.T, ghc *github.Client, status corev1.ContainerStatus) (*RunnerReconciler, client.Client, *record.FakeRecorder) {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "test1",
+			Finalizers: []string{finalizerName},
+		},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig: v1alpha1.RunnerConfig{
+				Repository: "test/valid",
+			},
+		},
+		Status: v1alpha1.RunnerStatus{
+			Phase: string(corev1.PodRunning),
+			Registration: v1alpha1.RunnerStatusRegistration{
+				Repository: "test/valid",
+				Token:      fake.RegistrationToken,
+				ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+			},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+
+	r := &RunnerReconciler{
+		Log:         logr.Discard(),
+		Recorder:    recorder,
+		Scheme:      scheme,
+		RunnerImage: "example/runner:test",
+		DockerImage: "example/docker:test",
+	}
+
+	pod, err := r.newPod(*runner, ghc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod.CreationTimestamp = metav1.Now()
+	pod.Status = corev1.PodStatus{
+		Phase:             corev1.PodRunning,
+		ContainerStatuses: []corev1.ContainerStatus{status},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner, &pod).Build()
+
+	r.Client = c
+	r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+	return r, c, recorder
+}
+
+func TestRunnerReconciler_OOMKilled(t *testing.T) {
+	// The runner died in the middle of a job, so GitHub still sees it busy until it notices the runner is gone.
+	removeRunner := fake.NewScriptedHandler(fake.RunnerBusyResponse("test1"), fake.Response{Status: http.StatusNoContent})
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	r, c, recorder := newOOMKilledRunnerReconciler(t, newGithubClient(server), corev1.ContainerStatus{
+		Name:  containerName,
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: containerReasonOOMKilled, ExitCode: 137}},
+	})
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+	// The terminated runner container can't be running the job, so the runner pod is deleted without waiting for the busy runner.
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if !res.IsZero() {
+		t.Errorf("expected the runner pod to be deleted without waiting for the busy runner, got %+v", res)
+	}
+
+	if got := len(removeRunner.Calls()); got != 1 {
+		t.Errorf("expected the runner to be removed from GitHub only once, got %d calls", got)
+	}
+
+	var deleted corev1.Pod
+	if err := c.Get(ctx, key, &deleted); !kerrors.IsNotFound(err) {
+		t.Fatalf("expected the OOMKilled runner pod to be deleted, got error %v", err)
+	}
+
+	select {
+	case e := <-recorder.Events:
+		if !strings.Contains(e, "RunnerOOMKilled") {
+			t.Errorf("unexpected event: %s", e)
+		}
+	default:
+		t.Errorf("expected the OOMKill to be recorded as an event")
+	}
+
+	// The runner itself is kept, and its pod is recreated.
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var recreated corev1.Pod
+	if err := c.Get(ctx, key, &recreated); err != nil {
+		t.Fatalf("expected the runner pod to be recreated: %v", err)
+	}
+}
+
+func TestRunnerReconciler_OOMKilled_CrashLoopBackOff(t *testing.T) {
+	removeRunner := fake.NewScriptedHandler(fake.RunnerBusyResponse("test1"), fake.Response{Status: http.StatusNoContent})
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	// The restarted container may come back and pick up a job, so the runner is gracefully stopped.
+	r, c, _ := newOOMKilledRunnerReconciler(t, newGithubClient(server), corev1.ContainerStatus{
+		Name:                 containerName,
+		State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: containerReasonOOMKilled, ExitCode: 137}},
+	})
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if res.RequeueAfter <= 0 {
+		t.Errorf("expected the graceful stop to wait for the busy runner, got %+v", res)
+	}
+
+	var stopping corev1.Pod
+	if err := c.Get(ctx, key, &stopping); err != nil {
+		t.Fatalf("expected the runner pod to be kept while the runner is busy: %v", err)
+	}
+
+	if got := stopping.Annotations[AnnotationKeyUnregistrationReason]; got != string(UnregistrationReasonOOMKilled) {
+		t.Errorf("unexpected unregistration reason: got %q, want %q", got, UnregistrationReasonOOMKilled)
+	}
+
+	res, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if !res.IsZero() {
+		t.Errorf("expected the runner pod to be deleted once the runner is unregistered, got %+v", res)
+	}
+
+	if got := len(removeRunner.Calls()); got != 2 {
+		t.Errorf("expected the runner to be removed from GitHub on the retry, got %d calls", got)
+	}
+
+	var deleted corev1.Pod
+	if err := c.Get(ctx, key, &deleted); !kerrors.IsNotFound(err) {
+		t.Fatalf("expected the OOMKilled runner pod to be deleted, got error %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// runnerOwnerIsDeleted returns true if the runner is being deleted because its RunnerDeployment,
+// or its RunnerReplicaSet that isn't managed by a RunnerDeployment, is deleted.
+//
+// An old RunnerReplicaSet is deleted by the RunnerDeployment controller on every template update,
+// so the deletion of the RunnerReplicaSet alone doesn't count when it's managed by a RunnerDeployment that still exists.
+// Once the RunnerReplicaSet is gone, the RunnerDeployment is looked up by the runner-deployment-name label of the runner.
+func runnerOwnerIsDeleted(ctx context.Context, c client.Client, runner v1alpha1.Runner) (bool, error) {
+	ref := metav1.GetControllerOf(&runner)
+	if ref == nil || ref.Kind != "RunnerReplicaSet" {
+		return false, nil
+	}
+
+	var (
+		rs     v1alpha1.RunnerReplicaSet
+		rsGone bool
+		rdName string
+	)
+
+	if err := c.Get(ctx, types.NamespacedName{Namespace: runner.Namespace, Name: ref.Name}, &rs); err != nil {
+		if !kerrors.IsNotFound(err) {
+			return false, err
+		}
+
+		rsGone = true
+		rdName = runner.Labels[LabelKeyRunnerDeploymentName]
+	} else {
+		rsGone = !rs.DeletionTimestamp.IsZero() || rs.UID != ref.UID
+
+		if rdRef := metav1.GetControllerOf(&rs); rdRef != nil && rdRef.Kind == "RunnerDeployment" {
+			rdName = rdRef.Name
+		}
+	}
+
+	if rdName == "" {
+		return rsGone, nil
+	}
+
+	if !rsGone {
+		return false, nil
+	}
+
+	var rd v1alpha1.RunnerDeployment
+	if err := c.Get(ctx, types.NamespacedName{Namespace: runner.Namespace, Name: rdName}, &rd); err != nil {
+		if kerrors.IsNotFound(err) {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	return !rd.DeletionTimestamp.IsZero(), nil
+}
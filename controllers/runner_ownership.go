@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	gogithub "github.com/google/go-github/v39/github"
+)
+
+// RunnerOwnership tells if a runner on GitHub is managed by ARC, so that ARC never removes a runner it doesn't manage
+// but that happens to have the same name as a runner pod, e.g. a runner registered manually or by another ARC installation.
+//
+// A runner is owned when its name starts with any of NamePrefixes, or it has any of Labels.
+// The zero value owns every runner.
+type RunnerOwnership struct {
+	NamePrefixes []string
+	Labels       []string
+}
+
+func (o RunnerOwnership) enabled() bool {
+	return len(o.NamePrefixes) > 0 || len(o.Labels) > 0
+}
+
+// Owns returns true when the runner is managed by ARC.
+func (o RunnerOwnership) Owns(runner *gogithub.Runner) bool {
+	if !o.enabled() {
+		return true
+	}
+
+	name := runner.GetName()
+
+	for _, p := range o.NamePrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+
+	for _, l := range runner.Labels {
+		for _, want := range o.Labels {
+			if l.GetName() == want {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ownershipCheckingRunnerAPI makes unregisterRunner refuse to remove runners that aren't owned by ARC.
+type ownershipCheckingRunnerAPI struct {
+	github.RunnerAPI
+
+	ownership RunnerOwnership
+}
+
+// withRunnerOwnership returns the RunnerAPI to be used for unregistering runners,
+// which removes only the runners owned by ARC when the ownership is configured.
+func withRunnerOwnership(api github.RunnerAPI, ownership RunnerOwnership) github.RunnerAPI {
+	if !ownership.enabled() {
+		return api
+	}
+
+	return &ownershipCheckingRunnerAPI{RunnerAPI: api, ownership: ownership}
+}
+
+func runnerLabelNames(runner *gogithub.Runner) []string {
+	var names []string
+
+	for _, l := range runner.Labels {
+		names = append(names, l.GetName())
+	}
+
+	return names
+}
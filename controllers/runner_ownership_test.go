@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+)
+
+func TestRunnerOwnership_Owns(t *testing.T) {
+	runner := &gogithub.Runner{
+		Name:   gogithub.String("example-runnerdeploy-abcde-fghij"),
+		Labels: []*gogithub.RunnerLabels{{Name: gogithub.String("self-hosted")}, {Name: gogithub.String("arc-managed")}},
+	}
+
+	tests := []struct {
+		name      string
+		ownership RunnerOwnership
+		want      bool
+	}{
+		{
+			name: "not configured",
+			want: true,
+		},
+		{
+			name:      "name prefix",
+			ownership: RunnerOwnership{NamePrefixes: []string{"other-", "example-runnerdeploy-"}},
+			want:      true,
+		},
+		{
+			name:      "label",
+			ownership: RunnerOwnership{Labels: []string{"arc-managed"}},
+			want:      true,
+		},
+		{
+			name:      "neither",
+			ownership: RunnerOwnership{NamePrefixes: []string{"other-"}, Labels: []string{"other"}},
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ownership.Owns(runner); got != tt.want {
+				t.Errorf("Owns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnregisterRunner_NotOwned(t *testing.T) {
+	tests := []struct {
+		name        string
+		ownership   RunnerOwnership
+		want        bool
+		wantRemoved bool
+	}{
+		{
+			name:      "not owned",
+			ownership: RunnerOwnership{NamePrefixes: []string{"example-"}, Labels: []string{"arc-managed"}},
+		},
+		{
+			name:        "owned",
+			ownership:   RunnerOwnership{NamePrefixes: []string{"test"}},
+			want:        true,
+			wantRemoved: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var removed bool
+
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					removed = true
+					w.WriteHeader(http.StatusNoContent)
+				})),
+			)
+			defer server.Close()
+
+			api := withRunnerOwnership(newGithubClient(server), tt.ownership)
+
+			// test1 is listed on GitHub without labels.
+			got, err := unregisterRunner(context.Background(), GracefulStopConfig{}, logr.Discard(), api, "", "", "test/valid", "test1")
+			if err != nil {
+				t.Fatalf("unregisterRunner() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("unregisterRunner() = %v, want %v", got, tt.want)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("RemoveRunner called = %v, want %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
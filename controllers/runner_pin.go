@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AnnotationKeyPin is the annotation to pin a runner or a runner pod, usually for live inspection of a stuck job.
+// Setting it to "true" prevents ARC from choosing the runner for a scale-down.
+// A pinned runner needs to be removed manually, or unpinned so that it's scaled down as usual.
+const AnnotationKeyPin = "actions-runner-controller/pin"
+
+// isPinned returns true if the object is annotated with AnnotationKeyPin set to a true value.
+func isPinned(obj metav1.Object) bool {
+	v, ok := obj.GetAnnotations()[AnnotationKeyPin]
+	if !ok {
+		return false
+	}
+
+	pinned, err := strconv.ParseBool(v)
+
+	return err == nil && pinned
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+)
+
+// runnerArchitectures are the architectures GitHub adds as the default labels of self-hosted runners.
+var runnerArchitectures = []string{"X64", "X86", "ARM64", "ARM"}
+
+// runnerPlatform returns the OS and the architecture of the runner found registered on GitHub.
+// ListRunners doesn't return the architecture, so it's taken from the default label of the runner for its architecture.
+func runnerPlatform(runner *gogithub.Runner) (string, string) {
+	var arch string
+
+	for _, l := range runner.Labels {
+		if l.GetType() != "" && l.GetType() != "read-only" {
+			continue
+		}
+
+		for _, a := range runnerArchitectures {
+			if strings.EqualFold(l.GetName(), a) {
+				arch = a
+				break
+			}
+		}
+
+		if arch != "" {
+			break
+		}
+	}
+
+	return runner.GetOS(), arch
+}
+
+// updatePlatform records the OS and the architecture of the runner found registered on GitHub in the runner status,
+// only when they have changed so that we don't trigger another reconcilation loop for nothing.
+func (r *RunnerReconciler) updatePlatform(ctx context.Context, runner v1alpha1.Runner, log logr.Logger, registered *gogithub.Runner) error {
+	if registered == nil {
+		return nil
+	}
+
+	os, arch := runnerPlatform(registered)
+
+	if runner.Status.OS == os && runner.Status.Architecture == arch {
+		return nil
+	}
+
+	updated := runner.DeepCopy()
+	updated.Status.OS = os
+	updated.Status.Architecture = arch
+
+	if err := r.patchStatus(ctx, &runner, updated, false); err != nil {
+		log.Error(err, "Failed to update runner status for OS and Architecture")
+		return err
+	}
+
+	return nil
+}
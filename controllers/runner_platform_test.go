@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRunnerPlatform(t *testing.T) {
+	tests := []struct {
+		name     string
+		runner   *gogithub.Runner
+		wantOS   string
+		wantArch string
+	}{
+		{
+			name: "default labels",
+			runner: &gogithub.Runner{OS: gogithub.String("Linux"), Labels: []*gogithub.RunnerLabels{
+				{Name: gogithub.String("self-hosted"), Type: gogithub.String("read-only")},
+				{Name: gogithub.String("Linux"), Type: gogithub.String("read-only")},
+				{Name: gogithub.String("ARM64"), Type: gogithub.String("read-only")},
+			}},
+			wantOS:   "Linux",
+			wantArch: "ARM64",
+		},
+		{
+			name: "custom label named after an architecture",
+			runner: &gogithub.Runner{OS: gogithub.String("Linux"), Labels: []*gogithub.RunnerLabels{
+				{Name: gogithub.String("arm"), Type: gogithub.String("custom")},
+				{Name: gogithub.String("x64"), Type: gogithub.String("read-only")},
+			}},
+			wantOS:   "Linux",
+			wantArch: "X64",
+		},
+		{
+			name:   "no architecture label",
+			runner: &gogithub.Runner{OS: gogithub.String("Windows")},
+			wantOS: "Windows",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os, arch := runnerPlatform(tt.runner)
+			if os != tt.wantOS || arch != tt.wantArch {
+				t.Errorf("runnerPlatform() = %q, %q, want %q, %q", os, arch, tt.wantOS, tt.wantArch)
+			}
+		})
+	}
+}
+
+func TestRunnerReconciler_UpdatePlatform(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	runner := &v1alpha1.Runner{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"}}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner).Build()
+
+	r := &RunnerReconciler{Client: c}
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: runner.Namespace, Name: runner.Name}
+
+	registered := &gogithub.Runner{
+		Name: gogithub.String("test1"),
+		OS:   gogithub.String("Linux"),
+		Labels: []*gogithub.RunnerLabels{
+			{Name: gogithub.String("self-hosted"), Type: gogithub.String("read-only")},
+			{Name: gogithub.String("X64"), Type: gogithub.String("read-only")},
+		},
+	}
+
+	get := func() v1alpha1.Runner {
+		t.Helper()
+
+		var got v1alpha1.Runner
+		if err := c.Get(ctx, key, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		return got
+	}
+
+	if err := r.updatePlatform(ctx, get(), logr.Discard(), registered); err != nil {
+		t.Fatal(err)
+	}
+
+	got := get()
+	if got.Status.OS != "Linux" || got.Status.Architecture != "X64" {
+		t.Fatalf("unexpected platform in status: os = %q, architecture = %q", got.Status.OS, got.Status.Architecture)
+	}
+
+	// Neither an unchanged platform nor a runner not found on GitHub updates the status.
+	for _, registered := range []*gogithub.Runner{registered, nil} {
+		if err := r.updatePlatform(ctx, got, logr.Discard(), registered); err != nil {
+			t.Fatal(err)
+		}
+
+		if rv := get().ResourceVersion; rv != got.ResourceVersion {
+			t.Errorf("expected the status not to be updated: resource version changed from %s to %s", got.ResourceVersion, rv)
+		}
+	}
+}
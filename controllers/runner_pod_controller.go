@@ -27,13 +27,20 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	corev1 "k8s.io/api/core/v1"
 
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
 	"github.com/actions-runner-controller/actions-runner-controller/github"
 )
 
@@ -43,13 +50,21 @@ type RunnerPodReconciler struct {
 	Log                         logr.Logger
 	Recorder                    record.EventRecorder
 	Scheme                      *runtime.Scheme
-	GitHubClient                *github.Client
+	GitHubClient                *MultiGitHubClient
 	Name                        string
 	RegistrationRecheckInterval time.Duration
 	RegistrationRecheckJitter   time.Duration
 
-	UnregistrationTimeout    time.Duration
-	UnregistrationRetryDelay time.Duration
+	GracefulStopConfig
+
+	// StartupReconcileRamp spreads the first reconciliations of the runner pods that existed before the controller started. Nil disables it.
+	StartupReconcileRamp *StartupReconcileRamp
+
+	NodeDrain NodeDrainConfig
+
+	// DrainOnPVCReclaim makes ARC watch persistent volume claims and gracefully stop runners using claims being reclaimed,
+	// before releasing the claims. See AnnotationKeyReclaimPVC.
+	DrainOnPVCReclaim bool
 }
 
 const (
@@ -61,6 +76,8 @@ const (
 )
 
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;delete
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -76,18 +93,23 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, nil
 	}
 
-	var enterprise, org, repo string
+	if d := startupReconcileDelay(log, r.StartupReconcileRamp, &runnerPod, time.Now()); d > 0 {
+		return ctrl.Result{RequeueAfter: d}, nil
+	}
 
-	envvars := runnerPod.Spec.Containers[0].Env
-	for _, e := range envvars {
-		switch e.Name {
-		case EnvVarEnterprise:
-			enterprise = e.Value
-		case EnvVarOrg:
-			org = e.Value
-		case EnvVarRepo:
-			repo = e.Value
+	enterprise, org, repo := runnerPodScope(&runnerPod)
+
+	ghc, err := r.gitHubClientFor(ctx, &runnerPod)
+	if err != nil {
+		if runnerPod.ObjectMeta.DeletionTimestamp.IsZero() {
+			log.Error(err, "Failed to initialize GitHub client for runner pod")
+			return ctrl.Result{}, err
 		}
+
+		// We fall back to the default client so that the runner pod being deleted isn't stuck with the finalizer,
+		// e.g. after the credentials secret of the runnerset has been deleted.
+		log.Error(err, "Failed to initialize GitHub client for runner pod. Falling back to the default client")
+		ghc = r.GitHubClient.Default()
 	}
 
 	if runnerPod.ObjectMeta.DeletionTimestamp.IsZero() {
@@ -104,13 +126,39 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 
 			return ctrl.Result{}, nil
 		}
+
+		if err := ensureRunnerLabels(ctx, r.Client, log, &runnerPod); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if res, err := drainRunnerPodOnUnschedulableNode(ctx, r.Client, log, r.NodeDrain, r.PodDeletionPropagationPolicy, &runnerPod, func(pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+			updated, res, err := r.tickGracefulStop(ctx, UnregistrationReasonNodeDrain, log, ghc, r.Client, enterprise, org, repo, pod.Name, pod)
+			if res != nil {
+				result, err := r.processUnregistrationResult(*pod, log, *res, err)
+				return nil, &result, err
+			}
+			return updated, nil, nil
+		}); res != nil {
+			return *res, err
+		}
+
+		if res, err := drainRunnerPodForPVCReclaim(ctx, r.Client, log, r.DrainOnPVCReclaim, r.PodDeletionPropagationPolicy, &runnerPod, func(pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+			updated, res, err := r.tickGracefulStop(ctx, UnregistrationReasonPVCReclaim, log, ghc, r.Client, enterprise, org, repo, pod.Name, pod)
+			if res != nil {
+				result, err := r.processUnregistrationResult(*pod, log, *res, err)
+				return nil, &result, err
+			}
+			return updated, nil, nil
+		}); res != nil {
+			return *res, err
+		}
 	} else {
 		finalizers, removed := removeFinalizer(runnerPod.ObjectMeta.Finalizers, runnerPodFinalizerName)
 
 		if removed {
-			updatedPod, res, err := tickRunnerGracefulStop(ctx, r.unregistrationTimeout(), r.unregistrationRetryDelay(), log, r.GitHubClient, r.Client, enterprise, org, repo, runnerPod.Name, &runnerPod)
+			updatedPod, res, err := r.tickGracefulStop(ctx, UnregistrationReasonManual, log, ghc, r.Client, enterprise, org, repo, runnerPod.Name, &runnerPod)
 			if res != nil {
-				return *res, err
+				return r.processUnregistrationResult(runnerPod, log, *res, err)
 			}
 
 			patchedPod := updatedPod.DeepCopy()
@@ -162,21 +210,7 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 
 	// If pod has ended up succeeded we need to restart it
 	// Happens e.g. when dind is in runner and run completes
-	stopped := runnerPod.Status.Phase == corev1.PodSucceeded
-
-	if !stopped {
-		if runnerPod.Status.Phase == corev1.PodRunning {
-			for _, status := range runnerPod.Status.ContainerStatuses {
-				if status.Name != containerName {
-					continue
-				}
-
-				if status.State.Terminated != nil && status.State.Terminated.ExitCode == 0 {
-					stopped = true
-				}
-			}
-		}
-	}
+	stopped := runnerPodOrContainerIsStopped(&runnerPod, runnerPodCleanStopConfig(log, &runnerPod))
 
 	restart := stopped
 
@@ -239,7 +273,7 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		notFound := false
 		offline := false
 
-		_, err := r.GitHubClient.IsRunnerBusy(ctx, enterprise, org, repo, runnerPod.Name)
+		registered, err := ghc.GetRunner(ctx, enterprise, org, repo, runnerPod.Name)
 
 		currentTime := time.Now()
 
@@ -270,6 +304,16 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 			}
 		}
 
+		if !notFound {
+			if err := markRunnerPodRegistrationSeen(ctx, realClock{}, r.Client, log, &runnerPod); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			if err := recordGitHubRunnerLabels(ctx, r.Client, log, r.GitHubRunnerLabelsAnnotation, &runnerPod, registered); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+
 		registrationTimeout := 10 * time.Minute
 		durationAfterRegistrationTimeout := currentTime.Sub(runnerPod.CreationTimestamp.Add(registrationTimeout))
 		registrationDidTimeout := durationAfterRegistrationTimeout > 0
@@ -351,13 +395,13 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, nil
 	}
 
-	updated, res, err := tickRunnerGracefulStop(ctx, r.unregistrationTimeout(), r.unregistrationRetryDelay(), log, r.GitHubClient, r.Client, enterprise, org, repo, runnerPod.Name, &runnerPod)
+	updated, res, err := r.tickGracefulStop(ctx, UnregistrationReasonRestart, log, ghc, r.Client, enterprise, org, repo, runnerPod.Name, &runnerPod)
 	if res != nil {
-		return *res, err
+		return r.processUnregistrationResult(runnerPod, log, *res, err)
 	}
 
 	// Delete current pod if recreation is needed
-	if err := r.Delete(ctx, updated); err != nil {
+	if err := deleteRunnerPod(ctx, r.Client, r.PodDeletionPropagationPolicy, updated); err != nil {
 		log.Error(err, "Failed to delete pod resource")
 		return ctrl.Result{}, err
 	}
@@ -368,22 +412,74 @@ func (r *RunnerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	return ctrl.Result{}, nil
 }
 
-func (r *RunnerPodReconciler) unregistrationTimeout() time.Duration {
-	unregistrationTimeout := DefaultUnregistrationTimeout
+// runnerPodScope returns the enterprise, organization, and repository the runner pod is registered to,
+// read from the envvars of the runner container.
+func runnerPodScope(pod *corev1.Pod) (enterprise, org, repo string) {
+	if len(pod.Spec.Containers) == 0 {
+		return
+	}
 
-	if r.UnregistrationTimeout > 0 {
-		unregistrationTimeout = r.UnregistrationTimeout
+	for _, e := range pod.Spec.Containers[0].Env {
+		switch e.Name {
+		case EnvVarEnterprise:
+			enterprise = e.Value
+		case EnvVarOrg:
+			org = e.Value
+		case EnvVarRepo:
+			repo = e.Value
+		}
 	}
-	return unregistrationTimeout
+
+	return
 }
 
-func (r *RunnerPodReconciler) unregistrationRetryDelay() time.Duration {
-	retryDelay := DefaultUnregistrationRetryDelay
+// gitHubClientFor returns the GitHub API client to be used for the runner of the runner pod, which is the one of the runnerset the pod belongs to.
+// The scope of the pod is used instead when the runnerset is already gone, e.g. while the pod is being deleted along with the runnerset.
+func (r *RunnerPodReconciler) gitHubClientFor(ctx context.Context, pod *corev1.Pod) (*github.Client, error) {
+	var rs v1alpha1.RunnerSet
+	if err := r.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Labels[LabelKeyRunnerSetName]}, &rs); err != nil {
+		if !kerrors.IsNotFound(err) {
+			return nil, err
+		}
 
-	if r.UnregistrationRetryDelay > 0 {
-		retryDelay = r.UnregistrationRetryDelay
+		enterprise, org, repo := runnerPodScope(pod)
+
+		rs = v1alpha1.RunnerSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: pod.Namespace,
+			},
+			Spec: v1alpha1.RunnerSetSpec{
+				RunnerConfig: v1alpha1.RunnerConfig{
+					Enterprise:   enterprise,
+					Organization: org,
+					Repository:   repo,
+				},
+			},
+		}
 	}
-	return retryDelay
+
+	return r.GitHubClient.InitForRunnerSet(ctx, &rs)
+}
+
+// processUnregistrationResult surfaces the runner unregistration that exhausted the retry budget or has no valid scope via an event on the pod,
+// and stops requeueing so that operators can intervene.
+// Any other result is returned as-is.
+func (r *RunnerPodReconciler) processUnregistrationResult(pod corev1.Pod, log logr.Logger, res ctrl.Result, err error) (ctrl.Result, error) {
+	if isInvalidRunnerScope(err) {
+		r.Recorder.Event(&pod, corev1.EventTypeWarning, "InvalidScope", fmt.Sprintf("%s. Fix the runner pod's %s, %s, or %s env to retry", err.Error(), EnvVarEnterprise, EnvVarOrg, EnvVarRepo))
+
+		return ctrl.Result{}, nil
+	}
+
+	if !isUnregistrationFailed(err) {
+		return res, err
+	}
+
+	log.Error(err, "Failed to unregister runner. Giving up until the cause is fixed")
+
+	r.Recorder.Event(&pod, corev1.EventTypeWarning, "UnregistrationFailed", fmt.Sprintf("%s. Remove the %s annotation to retry", err.Error(), AnnotationKeyUnregistrationAttempts))
+
+	return ctrl.Result{}, nil
 }
 
 func (r *RunnerPodReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -394,8 +490,34 @@ func (r *RunnerPodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	r.Recorder = mgr.GetEventRecorderFor(name)
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Pod{}).
-		Named(name).
-		Complete(r)
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Pod{}, builder.WithPredicates(ignoreUnregistrationAttemptsUpdates()))
+
+	if r.NodeDrain.Enabled {
+		b = b.Watches(
+			&source.Kind{Type: &corev1.Node{}},
+			handler.EnqueueRequestsFromMapFunc(runnerPodRequestsOnNode(mgr.GetClient(), r.Log, func(pod *corev1.Pod) (reconcile.Request, bool) {
+				if _, ok := pod.Labels[LabelKeyRunnerSetName]; !ok {
+					return reconcile.Request{}, false
+				}
+				return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}}, true
+			})),
+			builder.WithPredicates(nodeBecameUnschedulable()),
+		)
+	}
+
+	if r.DrainOnPVCReclaim {
+		b = b.Watches(
+			&source.Kind{Type: &corev1.PersistentVolumeClaim{}},
+			handler.EnqueueRequestsFromMapFunc(runnerPodRequestsForPVC(mgr.GetClient(), r.Log, func(pod *corev1.Pod) (reconcile.Request, bool) {
+				if _, ok := pod.Labels[LabelKeyRunnerSetName]; !ok {
+					return reconcile.Request{}, false
+				}
+				return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}}, true
+			})),
+			builder.WithPredicates(pvcBecameReclaimRequested()),
+		)
+	}
+
+	return b.Named(name).Complete(r)
 }
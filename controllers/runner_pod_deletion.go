@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// deleteRunnerPod deletes the runner pod that has been gracefully stopped, with the propagation policy,
+// so that the dependents of the runner pod, e.g. persistent volume claims owned by the pod, are deleted in the desired order.
+// An empty policy keeps the default of the API server.
+//
+// It's called only after the runner is unregistered. It explicitly requests the terminationGracePeriodSeconds of the pod,
+// e.g. set in the template of the RunnerDeployment, so that the runner process gets SIGTERM and then the full grace period
+// to e.g. finish uploading artifacts before it gets SIGKILL.
+func deleteRunnerPod(ctx context.Context, c client.Client, policy metav1.DeletionPropagation, pod *corev1.Pod) error {
+	var opts []client.DeleteOption
+
+	if pod.Spec.TerminationGracePeriodSeconds != nil {
+		opts = append(opts, client.GracePeriodSeconds(*pod.Spec.TerminationGracePeriodSeconds))
+	}
+
+	if policy != "" {
+		opts = append(opts, client.PropagationPolicy(policy))
+	}
+
+	return c.Delete(ctx, pod, opts...)
+}
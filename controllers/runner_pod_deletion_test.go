@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// deleteOptionsRecordingClient records the options of the last delete call.
+type deleteOptionsRecordingClient struct {
+	client.Client
+
+	deleteOptions *client.DeleteOptions
+}
+
+func (c *deleteOptionsRecordingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.deleteOptions = (&client.DeleteOptions{}).ApplyOptions(opts)
+
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func TestDeleteRunnerPod_PropagationPolicy(t *testing.T) {
+	foreground := metav1.DeletePropagationForeground
+
+	tests := []struct {
+		policy metav1.DeletionPropagation
+		want   *metav1.DeletionPropagation
+	}{
+		{policy: ""},
+		{policy: "Foreground", want: &foreground},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"}}
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+
+			c := &deleteOptionsRecordingClient{Client: clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()}
+
+			if err := deleteRunnerPod(context.Background(), c, tt.policy, pod); err != nil {
+				t.Fatalf("deleteRunnerPod() error = %v", err)
+			}
+
+			got := c.deleteOptions.PropagationPolicy
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("unexpected propagation policy: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGracefulStopConfig_InvalidPodDeletionPropagationPolicy(t *testing.T) {
+	if err := (GracefulStopConfig{PodDeletionPropagationPolicy: "foreground"}).Validate(); err == nil {
+		t.Errorf("expected an invalid propagation policy to be rejected")
+	}
+}
+
+func TestDeleteRunnerPod_TerminationGracePeriod(t *testing.T) {
+	var gracePeriod int64 = 300
+
+	server := fake.NewServer(fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody))
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	// terminationGracePeriodSeconds in the template of a RunnerDeployment ends up in the spec of each runner.
+	runner := v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig:  v1alpha1.RunnerConfig{Repository: "test/valid"},
+			RunnerPodSpec: v1alpha1.RunnerPodSpec{TerminationGracePeriodSeconds: &gracePeriod},
+		},
+	}
+
+	r := &RunnerReconciler{Scheme: scheme, RunnerImage: "example/runner:test", DockerImage: "example/docker:test"}
+
+	pod, err := r.newPod(runner, newGithubClient(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pod.Spec.TerminationGracePeriodSeconds == nil || *pod.Spec.TerminationGracePeriodSeconds != gracePeriod {
+		t.Fatalf("unexpected terminationGracePeriodSeconds of the runner pod: %v", pod.Spec.TerminationGracePeriodSeconds)
+	}
+
+	// The runner has already exited and is gone from GitHub, so that the graceful stop completes on the first tick.
+	pod.Status.Phase = corev1.PodSucceeded
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}}}
+
+	c := &deleteOptionsRecordingClient{Client: clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(&pod).Build()}
+
+	updated, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute}, "", logr.Discard(), &fakeRunnerAPI{}, c, "", "", "test/valid", pod.Name, &pod)
+	if err != nil || res != nil {
+		t.Fatalf("tickRunnerGracefulStop() res = %v, err = %v", res, err)
+	}
+
+	if c.deleteOptions != nil {
+		t.Fatalf("expected the runner pod not to be deleted before the unregistration completes")
+	}
+
+	if err := deleteRunnerPod(context.Background(), c, "", updated); err != nil {
+		t.Fatalf("deleteRunnerPod() error = %v", err)
+	}
+
+	if got := c.deleteOptions.GracePeriodSeconds; got == nil || *got != gracePeriod {
+		t.Errorf("unexpected grace period of the delete call: got %v, want %d", got, gracePeriod)
+	}
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type runnerPodExpectedSinceKey struct{}
+
+// withRunnerPodExpectedSince returns a context that tells ensureRunnerUnregistration the time since when the runner pod,
+// missing on unregistration, is expected to exist, e.g. the creation timestamp of the runner.
+func withRunnerPodExpectedSince(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, runnerPodExpectedSinceKey{}, t)
+}
+
+// missingRunnerPodGracePeriodRemaining returns the remaining time ARC should wait for the missing runner pod to appear.
+// gracePeriod is how long ARC keeps looking for the runner that isn't found on GitHub while its runner pod is missing or still pending,
+// before concluding that the runner pod has never been created or started and so the runner will never register.
+// Zero disables it, so that ARC concludes it immediately.
+func missingRunnerPodGracePeriodRemaining(ctx context.Context, gracePeriod time.Duration, now time.Time) time.Duration {
+	since, ok := ctx.Value(runnerPodExpectedSinceKey{}).(time.Time)
+	if !ok || since.IsZero() {
+		return 0
+	}
+
+	return runnerPodNeverCreatedGracePeriodRemaining(since, gracePeriod, now)
+}
+
+// pendingRunnerPodGracePeriodRemaining returns the remaining time ARC should wait for the pending runner pod
+// to start and register the runner. See missingRunnerPodGracePeriodRemaining for gracePeriod.
+func pendingRunnerPodGracePeriodRemaining(pod *corev1.Pod, gracePeriod time.Duration, now time.Time) time.Duration {
+	if pod.CreationTimestamp.IsZero() || !runnerPodIsPending(pod) {
+		return 0
+	}
+
+	return runnerPodNeverCreatedGracePeriodRemaining(pod.CreationTimestamp.Time, gracePeriod, now)
+}
+
+func runnerPodNeverCreatedGracePeriodRemaining(since time.Time, gracePeriod time.Duration, now time.Time) time.Duration {
+	if gracePeriod <= 0 {
+		return 0
+	}
+
+	remaining := since.Add(gracePeriod).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// runnerPodIsPending returns true if none of the containers of the runner pod has started yet,
+// e.g. because the pod is waiting for a node to be scheduled to or the images being pulled.
+func runnerPodIsPending(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodPending && pod.Status.Phase != "" {
+		return false
+	}
+
+	for _, s := range pod.Status.ContainerStatuses {
+		if s.State.Waiting == nil {
+			return false
+		}
+	}
+
+	return true
+}
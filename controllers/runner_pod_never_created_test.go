@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEnsureRunnerUnregistration_PendingPod(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+
+	pending := func(status corev1.PodStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "default",
+				Name:              "test1",
+				CreationTimestamp: metav1.NewTime(clock.now.Add(-5 * time.Minute)),
+				Annotations: map[string]string{
+					unregistrationStartTimestamp(): formatUnregistrationTimestamp(clock.now.Add(-5 * time.Minute)),
+				},
+			},
+			Status: status,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		pod         *corev1.Pod
+		advance     time.Duration
+		wantRequeue bool
+	}{
+		{
+			name:        "unscheduled",
+			pod:         pending(corev1.PodStatus{Phase: corev1.PodPending}),
+			wantRequeue: true,
+		},
+		{
+			name: "pulling images",
+			pod: pending(corev1.PodStatus{
+				Phase:             corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}}},
+			}),
+			wantRequeue: true,
+		},
+		{
+			name:    "pending beyond the grace period",
+			pod:     pending(corev1.PodStatus{Phase: corev1.PodPending}),
+			advance: 6 * time.Minute,
+		},
+		{
+			name: "running",
+			pod: pending(corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: clock.now}
+			clock.Advance(tt.advance)
+
+			// The unregistration timeout has already elapsed, so the runner pod would be deleted right away if it weren't pending.
+			res, err := ensureRunnerUnregistration(context.Background(), clock, GracefulStopConfig{UnregistrationTimeout: time.Minute, RunnerPodNeverCreatedGracePeriod: 10 * time.Minute}, RequeuePolicy{InProgressDelay: 10 * time.Second}, logr.Discard(), &fakeRunnerAPI{}, "", "", "test/valid", tt.pod.Name, tt.pod)
+			if err != nil {
+				t.Fatalf("ensureRunnerUnregistration() error = %v", err)
+			}
+
+			if !tt.wantRequeue {
+				if res != nil {
+					t.Errorf("ensureRunnerUnregistration() = %v, want nil", res)
+				}
+				return
+			}
+
+			if res == nil || res.RequeueAfter != 10*time.Second {
+				t.Errorf("ensureRunnerUnregistration() = %v, want RequeueAfter 10s", res)
+			}
+		})
+	}
+}
+
+func TestEnsureRunnerUnregistration_MissingPod(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+
+	ctx := withRunnerPodExpectedSince(context.Background(), clock.now.Add(-50*time.Second))
+
+	res, err := ensureRunnerUnregistration(ctx, clock, GracefulStopConfig{UnregistrationTimeout: time.Minute, RunnerPodNeverCreatedGracePeriod: time.Minute}, RequeuePolicy{InProgressDelay: time.Minute}, logr.Discard(), &fakeRunnerAPI{}, "", "", "test/valid", "test1", nil)
+	if err != nil {
+		t.Fatalf("ensureRunnerUnregistration() error = %v", err)
+	}
+
+	if res == nil || res.RequeueAfter != 10*time.Second {
+		t.Fatalf("ensureRunnerUnregistration() = %v, want RequeueAfter 10s until the grace period elapses", res)
+	}
+
+	clock.Advance(10 * time.Second)
+
+	if res, err := ensureRunnerUnregistration(ctx, clock, GracefulStopConfig{UnregistrationTimeout: time.Minute, RunnerPodNeverCreatedGracePeriod: time.Minute}, RequeuePolicy{InProgressDelay: time.Minute}, logr.Discard(), &fakeRunnerAPI{}, "", "", "test/valid", "test1", nil); err != nil || res != nil {
+		t.Errorf("ensureRunnerUnregistration() = %v, %v, want nil after the grace period", res, err)
+	}
+}
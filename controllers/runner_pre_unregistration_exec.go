@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// AnnotationKeyPreUnregistrationExecCompleteTimestamp is the annotation ARC adds to the runner pod once the pre-unregistration command
+	// has been run, so that it's run only once per graceful stop.
+	AnnotationKeyPreUnregistrationExecCompleteTimestamp = "actions-runner-controller/pre-unregistration-exec-complete-timestamp"
+
+	DefaultPreUnregistrationExecTimeout = time.Minute
+
+	// MaxPreUnregistrationExecTimeout caps spec.preUnregistrationExec.timeoutSeconds,
+	// as the reconciliation gracefully stopping the runner waits for the command to exit.
+	MaxPreUnregistrationExecTimeout = 5 * time.Minute
+)
+
+// RunnerPodExecutor runs a command in a container of a runner pod.
+type RunnerPodExecutor interface {
+	// Exec returns the stdout and stderr of the command, and an error if the command couldn't be run or exited with a non-zero code.
+	Exec(ctx context.Context, namespace, pod, container string, command []string) (string, string, error)
+}
+
+// ClientsetPodExecutor is the RunnerPodExecutor that runs commands via the pod exec API.
+type ClientsetPodExecutor struct {
+	Config    *rest.Config
+	Clientset kubernetes.Interface
+}
+
+var _ RunnerPodExecutor = &ClientsetPodExecutor{}
+
+func (e *ClientsetPodExecutor) Exec(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+	req := e.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	transport, upgrader, err := spdy.RoundTripperFor(e.Config)
+	if err != nil {
+		return "", "", err
+	}
+
+	closable := &closableUpgrader{Upgrader: upgrader}
+
+	exec, err := remotecommand.NewSPDYExecutorForTransports(transport, closable, "POST", req.URL())
+	if err != nil {
+		return "", "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	// The executor of this client-go version doesn't take a context, so we close the connection on the context done,
+	// which makes the stream return instead of leaking the goroutine.
+	// The command keeps running in the container until it exits by itself in that case.
+	done := make(chan error, 1)
+	go func() {
+		done <- exec.Stream(remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+	}()
+
+	select {
+	case err := <-done:
+		return stdout.String(), stderr.String(), err
+	case <-ctx.Done():
+		closable.close()
+		return "", "", fmt.Errorf("command did not exit in time: %w", ctx.Err())
+	}
+}
+
+// closableUpgrader is the spdy.Upgrader that keeps the connection it upgraded to, so that the connection can be closed from outside the executor.
+type closableUpgrader struct {
+	spdy.Upgrader
+
+	mu     sync.Mutex
+	conn   httpstream.Connection
+	closed bool
+}
+
+func (u *closableUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.closed {
+		conn.Close()
+		return nil, errors.New("connection closed before the upgrade completed")
+	}
+
+	u.conn = conn
+
+	return conn, nil
+}
+
+// close closes the connection, or the one being upgraded to as soon as the upgrade completes.
+func (u *closableUpgrader) close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.closed = true
+
+	if u.conn != nil {
+		u.conn.Close()
+	}
+}
+
+// validatePreUnregistrationExec returns an error if the pre-unregistration command can't be run.
+func validatePreUnregistrationExec(exec *v1alpha1.PreUnregistrationExec) error {
+	if exec == nil {
+		return nil
+	}
+
+	if len(exec.Command) == 0 {
+		return fmt.Errorf("preUnregistrationExec.command must not be empty")
+	}
+
+	return nil
+}
+
+// preUnregistrationExecOf returns the spec.preUnregistrationExec of the Runner or the RunnerSet owning the runner pod, if any.
+// It's read from the owner rather than from the pod, so that only those who can update the spec of runners
+// can make ARC run commands in runner pods.
+func preUnregistrationExecOf(ctx context.Context, c client.Client, pod *corev1.Pod) (*v1alpha1.PreUnregistrationExec, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return nil, nil
+	}
+
+	switch owner.Kind {
+	case "Runner":
+		var runner v1alpha1.Runner
+		if err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}, &runner); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+
+		return runner.Spec.PreUnregistrationExec, nil
+	case "StatefulSet":
+		var statefulSet appsv1.StatefulSet
+		if err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}, &statefulSet); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+
+		ref := metav1.GetControllerOf(&statefulSet)
+		if ref == nil || ref.Kind != "RunnerSet" {
+			return nil, nil
+		}
+
+		var runnerSet v1alpha1.RunnerSet
+		if err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: ref.Name}, &runnerSet); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+
+		return runnerSet.Spec.PreUnregistrationExec, nil
+	}
+
+	return nil, nil
+}
+
+// preUnregistrationExecTimeout returns the timeout of the pre-unregistration command, capped at MaxPreUnregistrationExecTimeout.
+func preUnregistrationExecTimeout(spec *v1alpha1.PreUnregistrationExec) time.Duration {
+	if spec.TimeoutSeconds == nil || *spec.TimeoutSeconds <= 0 {
+		return DefaultPreUnregistrationExecTimeout
+	}
+
+	if timeout := time.Duration(*spec.TimeoutSeconds) * time.Second; timeout < MaxPreUnregistrationExecTimeout {
+		return timeout
+	}
+
+	return MaxPreUnregistrationExecTimeout
+}
+
+// runPreUnregistrationExec runs the pre-unregistration command of the runner pod once per graceful stop,
+// before ARC tries to remove the runner from GitHub.
+// It returns a non-nil result when the unregistration needs to wait for the command to be retried per the Fail failure policy.
+// Runner pods whose runner container isn't running have nothing to run the command in, so it's skipped for them.
+// The command is run via config.PodExecutor, and retried per the Fail failure policy until config.UnregistrationTimeout.
+// A nil config.PodExecutor disables the commands.
+func runPreUnregistrationExec(ctx context.Context, clock Clock, config GracefulStopConfig, requeue RequeuePolicy, log logr.Logger, c client.Client, pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+	if pod == nil || config.PodExecutor == nil {
+		return pod, nil, nil
+	}
+
+	if _, ok := getAnnotation(pod, AnnotationKeyPreUnregistrationExecCompleteTimestamp); ok {
+		return pod, nil, nil
+	}
+
+	if !runnerContainerRunning(pod) {
+		return pod, nil, nil
+	}
+
+	spec, err := preUnregistrationExecOf(ctx, c, pod)
+	if err != nil {
+		log.Error(err, "Failed to get the owner of the runner pod to read its preUnregistrationExec")
+		return nil, &ctrl.Result{}, err
+	}
+
+	if spec == nil || len(spec.Command) == 0 {
+		return pod, nil, nil
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, preUnregistrationExecTimeout(spec))
+	stdout, stderr, err := config.PodExecutor.Exec(execCtx, pod.Namespace, pod.Name, containerName, spec.Command)
+	cancel()
+
+	if err != nil {
+		if spec.FailurePolicy == v1alpha1.PreUnregistrationExecFailurePolicyFail && !preUnregistrationExecTimedOut(pod, config.UnregistrationTimeout, clock.Now()) {
+			log.Info("Pre-unregistration command failed. Retrying before removing the runner from GitHub.", "command", spec.Command, "error", err.Error(), "stderr", strings.TrimSpace(stderr))
+			return pod, &ctrl.Result{RequeueAfter: requeue.InProgressDelay}, nil
+		}
+
+		log.Info("WARNING: Pre-unregistration command failed. Removing the runner from GitHub anyway.", "command", spec.Command, "failurePolicy", spec.FailurePolicy, "error", err.Error(), "stderr", strings.TrimSpace(stderr))
+	} else {
+		log.Info("Pre-unregistration command succeeded", "command", spec.Command)
+		log.V(1).Info("Output of the pre-unregistration command", "stdout", strings.TrimSpace(stdout), "stderr", strings.TrimSpace(stderr))
+	}
+
+	updated, patchErr := patchRunnerPodWithRetries(ctx, c, log, pod, func(updated *corev1.Pod) {
+		setAnnotation(updated, AnnotationKeyPreUnregistrationExecCompleteTimestamp, formatUnregistrationTimestamp(clock.Now()))
+	})
+	if patchErr != nil {
+		if latest, res := patchConflictResult(ctx, c, log, requeue, pod, patchErr); res != nil {
+			return latest, res, nil
+		}
+		log.Error(patchErr, fmt.Sprintf("Failed to patch pod to have %s annotation", AnnotationKeyPreUnregistrationExecCompleteTimestamp))
+		return nil, &ctrl.Result{}, patchErr
+	}
+
+	return updated, nil, nil
+}
+
+// preUnregistrationExecTimedOut returns true if the unregistration timeout has passed since the start of the graceful stop,
+// after which ARC stops retrying the failed pre-unregistration command so that the runner is still removed from GitHub.
+func preUnregistrationExecTimedOut(pod *corev1.Pod, unregistrationTimeout time.Duration, now time.Time) bool {
+	ts, ok := getAnnotation(pod, unregistrationStartTimestamp())
+	if !ok {
+		return false
+	}
+
+	started, err := parseUnregistrationTimestamp(ts)
+	if err != nil {
+		return false
+	}
+
+	timeout, _ := EffectiveUnregistrationTimeout(pod, unregistrationTimeout)
+
+	return !now.Before(started.Add(timeout))
+}
+
+// runnerContainerRunning returns true if the runner container of the pod is running.
+func runnerContainerRunning(pod *corev1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == containerName {
+			return status.State.Running != nil
+		}
+	}
+
+	return false
+}
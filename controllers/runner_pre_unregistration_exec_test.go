@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	gogithub "github.com/google/go-github/v39/github"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	ctrl "sigs.k8s.io/controller-runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakePodExecutor records the commands and fails them with err when set.
+type fakePodExecutor struct {
+	commands [][]string
+	err      error
+}
+
+func (e *fakePodExecutor) Exec(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+	e.commands = append(e.commands, command)
+
+	if e.err != nil {
+		return "", "sync failed", e.err
+	}
+
+	return "synced", "", nil
+}
+
+func TestTickRunnerGracefulStop_PreUnregistrationExec(t *testing.T) {
+	tests := []struct {
+		name          string
+		failurePolicy v1alpha1.PreUnregistrationExecFailurePolicy
+		err           error
+		// wantRetried tells that the runner is removed only after the unregistration timeout, as the command is retried until then.
+		wantRetried bool
+	}{
+		{name: "succeeded"},
+		{name: "failed and ignored", err: errors.New("exit code 1")},
+		{name: "failed and retried", failurePolicy: v1alpha1.PreUnregistrationExecFailurePolicyFail, err: errors.New("exit code 1"), wantRetried: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &fakePodExecutor{err: tt.err}
+
+			runner := &v1alpha1.Runner{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"},
+				Spec: v1alpha1.RunnerSpec{RunnerConfig: v1alpha1.RunnerConfig{
+					Repository:            "test/valid",
+					PreUnregistrationExec: &v1alpha1.PreUnregistrationExec{Command: []string{"/bin/sync-cache"}, FailurePolicy: tt.failurePolicy},
+				}},
+			}
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+				},
+			}
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+			_ = v1alpha1.AddToScheme(scheme)
+
+			if err := ctrl.SetControllerReference(runner, pod, scheme); err != nil {
+				t.Fatal(err)
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner, pod).Build()
+
+			api := &fakeRunnerAPI{runners: []*gogithub.Runner{{ID: gogithub.Int64(1), Name: gogithub.String("test1"), Status: gogithub.String("online"), Busy: gogithub.Bool(false)}}}
+
+			clock := &fakeClock{now: time.Now()}
+
+			config := GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: 10 * time.Second, PodExecutor: executor}
+
+			tick := func() (*corev1.Pod, bool) {
+				t.Helper()
+
+				updated, res, err := tickRunnerGracefulStop(context.Background(), clock, config, "", logr.Discard(), api, c, "", "", "test/valid", pod.Name, pod)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if updated != nil {
+					pod = updated
+				}
+
+				return updated, res != nil
+			}
+
+			if _, requeued := tick(); requeued != tt.wantRetried {
+				t.Fatalf("unexpected requeue on the first tick: %v", requeued)
+			}
+
+			if tt.wantRetried {
+				if len(api.removed) != 0 {
+					t.Fatalf("expected the runner not to be removed while the command is retried, removed %v", api.removed)
+				}
+
+				clock.Advance(time.Minute)
+
+				tick()
+			}
+
+			if d := cmp.Diff([]int64{1}, api.removed); d != "" {
+				t.Errorf("unexpected removed runners (-want +got):\n%s", d)
+			}
+
+			wantCommands := 1
+			if tt.wantRetried {
+				wantCommands = 2
+			}
+
+			if len(executor.commands) != wantCommands {
+				t.Errorf("unexpected number of the commands run: got %d, want %d", len(executor.commands), wantCommands)
+			}
+
+			if _, ok := getAnnotation(pod, AnnotationKeyPreUnregistrationExecCompleteTimestamp); !ok {
+				t.Errorf("expected the command to be recorded as completed: %v", pod.Annotations)
+			}
+		})
+	}
+}
+
+func TestRunPreUnregistrationExec_Skipped(t *testing.T) {
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"},
+		Spec: v1alpha1.RunnerSpec{RunnerConfig: v1alpha1.RunnerConfig{
+			Repository:            "test/valid",
+			PreUnregistrationExec: &v1alpha1.PreUnregistrationExec{Command: []string{"/bin/sync-cache"}},
+		}},
+	}
+
+	running := corev1.PodStatus{
+		Phase:             corev1.PodRunning,
+		ContainerStatuses: []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+	}
+
+	stopped := corev1.PodStatus{
+		Phase:             corev1.PodSucceeded,
+		ContainerStatuses: []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}}},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	owned := func(status corev1.PodStatus) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"}, Status: status}
+		if err := ctrl.SetControllerReference(runner, pod, scheme); err != nil {
+			t.Fatal(err)
+		}
+		return pod
+	}
+
+	tests := []struct {
+		name     string
+		pod      *corev1.Pod
+		executor bool
+	}{
+		{name: "stopped runner container", pod: owned(stopped), executor: true},
+		{name: "disabled", pod: owned(running)},
+		{name: "no owner", pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"}, Status: running}, executor: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &fakePodExecutor{}
+
+			config := GracefulStopConfig{UnregistrationTimeout: time.Minute}
+			if tt.executor {
+				config.PodExecutor = executor
+			}
+
+			// The pod must not be patched, which would fail as the pod doesn't exist.
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner).Build()
+
+			if _, res, err := runPreUnregistrationExec(context.Background(), realClock{}, config, RequeuePolicy{}, logr.Discard(), c, tt.pod); res != nil || err != nil {
+				t.Fatalf("runPreUnregistrationExec() res = %v, err = %v", res, err)
+			}
+
+			if len(executor.commands) != 0 {
+				t.Errorf("expected no command to be run, got %v", executor.commands)
+			}
+		})
+	}
+}
+
+func TestPreUnregistrationExecOf_RunnerSet(t *testing.T) {
+	exec := &v1alpha1.PreUnregistrationExec{Command: []string{"/bin/sync-cache"}}
+
+	runnerSet := &v1alpha1.RunnerSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example"},
+		Spec:       v1alpha1.RunnerSetSpec{RunnerConfig: v1alpha1.RunnerConfig{PreUnregistrationExec: exec}},
+	}
+
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-abcde"}}
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-abcde-0"}}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	if err := ctrl.SetControllerReference(runnerSet, statefulSet, scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctrl.SetControllerReference(statefulSet, pod, scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runnerSet, statefulSet, pod).Build()
+
+	got, err := preUnregistrationExecOf(context.Background(), c, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := cmp.Diff(exec, got); d != "" {
+		t.Errorf("unexpected preUnregistrationExec (-want +got):\n%s", d)
+	}
+}
+
+func TestPreUnregistrationExecTimeout(t *testing.T) {
+	seconds := func(s int64) *int64 { return &s }
+
+	tests := []struct {
+		timeoutSeconds *int64
+		want           time.Duration
+	}{
+		{want: DefaultPreUnregistrationExecTimeout},
+		{timeoutSeconds: seconds(30), want: 30 * time.Second},
+		{timeoutSeconds: seconds(3600), want: MaxPreUnregistrationExecTimeout},
+	}
+
+	for _, tt := range tests {
+		if got := preUnregistrationExecTimeout(&v1alpha1.PreUnregistrationExec{TimeoutSeconds: tt.timeoutSeconds}); got != tt.want {
+			t.Errorf("preUnregistrationExecTimeout(%v) = %v, want %v", tt.timeoutSeconds, got, tt.want)
+		}
+	}
+}
+
+// fakeConnection is the httpstream.Connection that only records whether it's closed.
+type fakeConnection struct {
+	httpstream.Connection
+	closed bool
+}
+
+func (c *fakeConnection) Close() error {
+	c.closed = true
+	return nil
+}
+
+// fakeUpgrader is the spdy.Upgrader that upgrades to conn.
+type fakeUpgrader struct {
+	conn *fakeConnection
+}
+
+func (u *fakeUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	return u.conn, nil
+}
+
+func TestClosableUpgrader(t *testing.T) {
+	upgraded := &fakeConnection{}
+
+	u := &closableUpgrader{Upgrader: &fakeUpgrader{conn: upgraded}}
+
+	if _, err := u.NewConnection(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	u.close()
+
+	if !upgraded.closed {
+		t.Errorf("expected the upgraded connection to be closed")
+	}
+
+	// The connection upgraded to after the close is closed right away, so that the stream returns.
+	late := &fakeConnection{}
+
+	u = &closableUpgrader{Upgrader: &fakeUpgrader{conn: late}}
+	u.close()
+
+	if _, err := u.NewConnection(nil); err == nil {
+		t.Errorf("expected the upgrade after the close to fail")
+	}
+
+	if !late.closed {
+		t.Errorf("expected the connection upgraded to after the close to be closed")
+	}
+}
+
+func TestNewRunnerPod_PreUnregistrationExec(t *testing.T) {
+	var timeout int64 = 30
+
+	runnerSpec := v1alpha1.RunnerConfig{
+		Repository:            "test/valid",
+		PreUnregistrationExec: &v1alpha1.PreUnregistrationExec{Command: []string{"/bin/sh", "-c", "sync-cache"}, TimeoutSeconds: &timeout},
+	}
+
+	if _, err := newRunnerPod(corev1.Pod{}, runnerSpec, "runner:latest", nil, "docker:dind", "", "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	runnerSpec.PreUnregistrationExec = &v1alpha1.PreUnregistrationExec{}
+
+	if _, err := newRunnerPod(corev1.Pod{}, runnerSpec, "runner:latest", nil, "docker:dind", "", "", false); err == nil {
+		t.Errorf("newRunnerPod() succeeded with an empty pre-unregistration command")
+	}
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// AnnotationKeyReclaimPVC is the annotation to put on a persistent volume claim of a RunnerSet runner to reclaim it.
+// ARC gracefully stops the runners using the claim first, and deletes the claim along with the runner pods once the runners are unregistered,
+// so that the volume is never released while a runner may still be writing to it.
+// The value of the annotation is ignored.
+const AnnotationKeyReclaimPVC = "actions-runner-controller/reclaim-pvc"
+
+// pvcReclaimRequested returns true if the persistent volume claim is annotated to be reclaimed, or is already being deleted.
+// A claim being deleted is kept by Kubernetes until the pods using it are gone, which is as well the time to stop the runners gracefully.
+func pvcReclaimRequested(pvc *corev1.PersistentVolumeClaim) bool {
+	if _, ok := pvc.Annotations[AnnotationKeyReclaimPVC]; ok {
+		return true
+	}
+
+	return !pvc.DeletionTimestamp.IsZero()
+}
+
+// pvcBecameReclaimRequested is the predicate to watch persistent volume claims only when their reclamation is requested,
+// so that claim status updates don't enqueue runners.
+func pvcBecameReclaimRequested() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			pvc, ok := e.Object.(*corev1.PersistentVolumeClaim)
+			return ok && pvcReclaimRequested(pvc)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			old, ok := e.ObjectOld.(*corev1.PersistentVolumeClaim)
+			if !ok {
+				return false
+			}
+
+			pvc, ok := e.ObjectNew.(*corev1.PersistentVolumeClaim)
+
+			return ok && !pvcReclaimRequested(old) && pvcReclaimRequested(pvc)
+		},
+		DeleteFunc: func(event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(event.GenericEvent) bool {
+			return false
+		},
+	}
+}
+
+// podClaimNames returns the names of the persistent volume claims the pod mounts.
+func podClaimNames(pod *corev1.Pod) []string {
+	var names []string
+
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim != nil {
+			names = append(names, v.PersistentVolumeClaim.ClaimName)
+		}
+	}
+
+	return names
+}
+
+// runnerPodRequestsForPVC returns the map function that enqueues the requests for the runner pods using the persistent volume claim.
+// toRequest returns the request to enqueue for the pod, or false if the pod isn't managed by the controller.
+func runnerPodRequestsForPVC(c client.Client, log logr.Logger, toRequest func(pod *corev1.Pod) (reconcile.Request, bool)) func(client.Object) []reconcile.Request {
+	return func(obj client.Object) []reconcile.Request {
+		var pods corev1.PodList
+
+		if err := c.List(context.Background(), &pods, client.InNamespace(obj.GetNamespace())); err != nil {
+			log.Error(err, "Failed to list pods to drain runners using the reclaimed persistent volume claim", "pvc", obj.GetName())
+			return nil
+		}
+
+		var reqs []reconcile.Request
+
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+
+			for _, name := range podClaimNames(pod) {
+				if name != obj.GetName() {
+					continue
+				}
+
+				if req, ok := toRequest(pod); ok {
+					reqs = append(reqs, req)
+				}
+
+				break
+			}
+		}
+
+		if len(reqs) > 0 {
+			log.Info("Persistent volume claim is being reclaimed. Draining runners using the claim", "pvc", obj.GetName(), "runners", len(reqs))
+		}
+
+		return reqs
+	}
+}
+
+// reclaimedPVCsOfPod returns the persistent volume claims mounted by the pod whose reclamation is requested.
+func reclaimedPVCsOfPod(ctx context.Context, c client.Client, pod *corev1.Pod) ([]corev1.PersistentVolumeClaim, error) {
+	var reclaimed []corev1.PersistentVolumeClaim
+
+	for _, name := range podClaimNames(pod) {
+		var pvc corev1.PersistentVolumeClaim
+		if err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: name}, &pvc); err != nil {
+			if kerrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		if pvcReclaimRequested(&pvc) {
+			reclaimed = append(reclaimed, pvc)
+		}
+	}
+
+	return reclaimed, nil
+}
+
+// drainRunnerPodForPVCReclaim gracefully stops the runner whose pod is using a persistent volume claim being reclaimed,
+// and deletes the claims and the pod once the runner is unregistered.
+//
+// It returns a nil *ctrl.Result when the pod doesn't need to be drained.
+// The claims are deleted before the pod, so that the pod recreated for the runner doesn't reuse the reclaimed volume.
+// Kubernetes keeps the claims until the pod is gone anyway. The pod is deleted with the propagation policy.
+func drainRunnerPodForPVCReclaim(ctx context.Context, c client.Client, log logr.Logger, enabled bool, propagationPolicy metav1.DeletionPropagation, pod *corev1.Pod, gracefulStop func(pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error)) (*ctrl.Result, error) {
+	if !enabled {
+		return nil, nil
+	}
+
+	reclaimed, err := reclaimedPVCsOfPod(ctx, c, pod)
+	if err != nil {
+		return &ctrl.Result{}, err
+	}
+
+	if len(reclaimed) == 0 {
+		return nil, nil
+	}
+
+	if _, ok := getAnnotation(pod, unregistrationStartTimestamp()); !ok {
+		log.Info("Gracefully stopping the runner as its persistent volume claim is being reclaimed", "pvc", reclaimed[0].Name)
+	}
+
+	updatedPod, res, err := gracefulStop(pod)
+	if res != nil {
+		return res, err
+	}
+
+	if updatedPod == nil {
+		updatedPod = pod
+	}
+
+	// This is the last line of defense against releasing the volume of a runner that may still be running a job.
+	if _, ok := getAnnotation(updatedPod, unregistrationCompleteTimestamp()); !ok {
+		log.Info(fmt.Sprintf("Postponing the reclamation of the persistent volume claim as the runner pod has no %s annotation", unregistrationCompleteTimestamp()), "pvc", reclaimed[0].Name)
+		return &ctrl.Result{RequeueAfter: DefaultUnregistrationRetryDelay}, nil
+	}
+
+	for i := range reclaimed {
+		pvc := &reclaimed[i]
+
+		if !pvc.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		if err := c.Delete(ctx, pvc); err != nil && !kerrors.IsNotFound(err) {
+			log.Error(err, "Failed to delete the reclaimed persistent volume claim", "pvc", pvc.Name)
+			return &ctrl.Result{}, err
+		}
+
+		log.Info("Deleted the reclaimed persistent volume claim", "pvc", pvc.Name)
+	}
+
+	// The runner pod finalizer is removed by the pod deletion handler, which sees the unregistration already completed.
+	if err := deleteRunnerPod(ctx, c, propagationPolicy, updatedPod); err != nil && !kerrors.IsNotFound(err) {
+		log.Error(err, "Failed to delete the runner pod using the reclaimed persistent volume claim")
+		return &ctrl.Result{}, err
+	}
+
+	log.Info("Deleted the runner pod using the reclaimed persistent volume claim")
+
+	return &ctrl.Result{}, nil
+}
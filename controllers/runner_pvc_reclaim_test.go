@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPVCBecameReclaimRequested(t *testing.T) {
+	now := metav1.Now()
+
+	unmarked := &corev1.PersistentVolumeClaim{}
+	marked := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationKeyReclaimPVC: "true"}}}
+	deleting := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}}
+
+	p := pvcBecameReclaimRequested()
+
+	if !p.Update(event.UpdateEvent{ObjectOld: unmarked, ObjectNew: marked}) {
+		t.Errorf("marking the claim must enqueue the runners using it")
+	}
+	if !p.Update(event.UpdateEvent{ObjectOld: unmarked, ObjectNew: deleting}) {
+		t.Errorf("deleting the claim must enqueue the runners using it")
+	}
+	if p.Update(event.UpdateEvent{ObjectOld: marked, ObjectNew: marked}) {
+		t.Errorf("updates to the already marked claim must not enqueue the runners using it")
+	}
+	if p.Update(event.UpdateEvent{ObjectOld: unmarked, ObjectNew: unmarked}) {
+		t.Errorf("updates to the unmarked claim must not enqueue the runners using it")
+	}
+	if !p.Create(event.CreateEvent{Object: marked}) {
+		t.Errorf("the marked claim seen on startup must enqueue the runners using it")
+	}
+}
+
+func TestRunnerPodRequestsForPVC(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	pod := func(namespace, name, claim string, owned bool) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{
+					{Name: "work", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim}}},
+				},
+			},
+		}
+		if owned {
+			p.Labels = map[string]string{LabelKeyRunnerSetName: "example"}
+		}
+		return p
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		pod("default", "runner-1", "work-runner-1", true),
+		pod("default", "runner-2", "work-runner-2", true),
+		pod("other", "runner-1", "work-runner-1", true),
+		pod("default", "other-1", "work-runner-1", false),
+	).Build()
+
+	mapFn := runnerPodRequestsForPVC(c, logr.Discard(), func(pod *corev1.Pod) (reconcile.Request, bool) {
+		if _, ok := pod.Labels[LabelKeyRunnerSetName]; !ok {
+			return reconcile.Request{}, false
+		}
+		return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}}, true
+	})
+
+	got := mapFn(&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "work-runner-1"}})
+
+	want := []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "default", Name: "runner-1"}}}
+
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("unexpected requests (-want +got):\n%s", d)
+	}
+}
+
+func TestRunnerPodReconciler_PVCReclaim(t *testing.T) {
+	tests := []struct {
+		name             string
+		annotations      map[string]string
+		removeRunner     fake.Response
+		wantRemoveRunner int
+		wantDrained      bool
+		wantRequeue      bool
+	}{
+		{
+			name:         "claim not reclaimed",
+			removeRunner: fake.Response{Status: http.StatusNoContent},
+		},
+		{
+			name:             "claim reclaimed",
+			annotations:      map[string]string{AnnotationKeyReclaimPVC: "true"},
+			removeRunner:     fake.Response{Status: http.StatusNoContent},
+			wantRemoveRunner: 1,
+			wantDrained:      true,
+		},
+		{
+			name:             "claim reclaimed while the runner is busy",
+			annotations:      map[string]string{AnnotationKeyReclaimPVC: "true"},
+			removeRunner:     fake.RunnerBusyResponse("test1"),
+			wantRemoveRunner: 1,
+			wantRequeue:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removeRunner := fake.NewScriptedHandler(tt.removeRunner)
+
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerHandler(removeRunner),
+			)
+			defer server.Close()
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+			_ = v1alpha1.AddToScheme(scheme)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:         "default",
+					Name:              "test1",
+					Labels:            map[string]string{LabelKeyRunnerSetName: "example"},
+					Finalizers:        []string{runnerPodFinalizerName},
+					CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "runner", Env: []corev1.EnvVar{{Name: EnvVarRepo, Value: "test/valid"}}}},
+					Volumes: []corev1.Volume{
+						{Name: "work", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "work-test1"}}},
+					},
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+				},
+			}
+
+			pvc := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "default",
+					Name:        "work-test1",
+					Annotations: tt.annotations,
+				},
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod, pvc).Build()
+
+			r := &RunnerPodReconciler{
+				Client:            c,
+				Log:               logr.Discard(),
+				Recorder:          record.NewFakeRecorder(10),
+				Scheme:            scheme,
+				GitHubClient:      NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+				DrainOnPVCReclaim: true,
+			}
+
+			ctx := context.Background()
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if requeue := res.RequeueAfter > 0; requeue != tt.wantRequeue {
+				t.Errorf("unexpected requeue: got %v, want %v", res, tt.wantRequeue)
+			}
+
+			if got := len(removeRunner.Calls()); got != tt.wantRemoveRunner {
+				t.Errorf("unexpected number of remove runner calls: got %d, want %d", got, tt.wantRemoveRunner)
+			}
+
+			var updatedPod corev1.Pod
+			if err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, &updatedPod); err != nil {
+				t.Fatal(err)
+			}
+
+			if deleted := !updatedPod.DeletionTimestamp.IsZero(); deleted != tt.wantDrained {
+				t.Errorf("unexpected pod deletion: got %v, want %v", deleted, tt.wantDrained)
+			}
+
+			var updatedPVC corev1.PersistentVolumeClaim
+			err = c.Get(ctx, types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}, &updatedPVC)
+			if deleted := kerrors.IsNotFound(err); deleted != tt.wantDrained {
+				t.Errorf("unexpected claim deletion: got %v, want %v (err = %v)", deleted, tt.wantDrained, err)
+			}
+
+			if tt.wantDrained {
+				if _, ok := getAnnotation(&updatedPod, unregistrationCompleteTimestamp()); !ok {
+					t.Errorf("expected the claim to be deleted only after the unregistration completed: %v", updatedPod.Annotations)
+				}
+
+				if got := updatedPod.Annotations[AnnotationKeyUnregistrationReason]; got != string(UnregistrationReasonPVCReclaim) {
+					t.Errorf("unexpected unregistration reason: got %q, want %q", got, UnregistrationReasonPVCReclaim)
+				}
+			}
+		})
+	}
+}
+
+func TestDrainRunnerPodForPVCReclaim_RequiresUnregistrationComplete(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{Name: "work", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "work-test1"}}},
+			},
+		},
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "work-test1",
+			Annotations: map[string]string{AnnotationKeyReclaimPVC: "true"},
+		},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod, pvc).Build()
+
+	// A graceful stop that returns without marking the unregistration complete must not release the volume.
+	res, err := drainRunnerPodForPVCReclaim(context.Background(), c, logr.Discard(), true, "", pod, func(pod *corev1.Pod) (*corev1.Pod, *ctrl.Result, error) {
+		return pod, nil, nil
+	})
+	if err != nil {
+		t.Fatalf("drainRunnerPodForPVCReclaim() error = %v", err)
+	}
+
+	if res == nil || res.RequeueAfter == 0 {
+		t.Errorf("expected the reclamation to be postponed, got %v", res)
+	}
+
+	var got corev1.PersistentVolumeClaim
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}, &got); err != nil {
+		t.Errorf("expected the claim to be kept: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// InvalidRunnerScope is returned by tickRunnerGracefulStop when the runner has no valid enterprise, organization, or repository
+// to unregister it from, e.g. because the runner was created before the admission webhook started validating it.
+// Retrying won't help until the runner spec is fixed, so the caller is expected to surface it to operators, and stop requeueing.
+type InvalidRunnerScope struct {
+	Enterprise   string
+	Organization string
+	Repository   string
+	Reason       string
+}
+
+func (e *InvalidRunnerScope) Error() string {
+	return fmt.Sprintf("runner has no valid scope to unregister it from (enterprise=%q, organization=%q, repository=%q): %s", e.Enterprise, e.Organization, e.Repository, e.Reason)
+}
+
+// validateRunnerScope returns an InvalidRunnerScope error unless the runner can be looked up on GitHub,
+// so that we never call GitHub API with an empty or malformed scope.
+func validateRunnerScope(enterprise, org, repo string) error {
+	invalid := func(reason string) error {
+		return &InvalidRunnerScope{Enterprise: enterprise, Organization: org, Repository: repo, Reason: reason}
+	}
+
+	if enterprise == "" && org == "" && repo == "" {
+		return invalid("enterprise, organization, and repository are all empty")
+	}
+
+	if repo != "" {
+		parts := strings.Split(repo, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return invalid("repository must be in the form of OWNER/REPO")
+		}
+	}
+
+	return nil
+}
+
+// isInvalidRunnerScope returns true if err tells that the runner has no valid scope to unregister it from.
+func isInvalidRunnerScope(err error) bool {
+	var invalid *InvalidRunnerScope
+	return errors.As(err, &invalid)
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRunnerReconciler_InvalidScope(t *testing.T) {
+	listRunners := fake.NewScriptedHandler(fake.Response{Status: http.StatusOK, Body: fake.RunnersListBody})
+	removeRunner := fake.NewScriptedHandler(fake.Response{Status: http.StatusNoContent})
+
+	server := fake.NewServer(
+		fake.WithListRunnersHandler(listRunners),
+		fake.WithRemoveRunnerHandler(removeRunner),
+	)
+	defer server.Close()
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	// The repository lacks the owner, which the admission webhook doesn't catch.
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "test1",
+			Finalizers: []string{finalizerName},
+		},
+		Spec: v1alpha1.RunnerSpec{
+			RunnerConfig: v1alpha1.RunnerConfig{
+				Repository: "valid",
+			},
+		},
+		Status: v1alpha1.RunnerStatus{
+			Phase: string(corev1.PodRunning),
+			Registration: v1alpha1.RunnerStatusRegistration{
+				Repository: "valid",
+				Token:      fake.RegistrationToken,
+				ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+			},
+		},
+	}
+
+	ghc := newGithubClient(server)
+
+	recorder := record.NewFakeRecorder(10)
+
+	r := &RunnerReconciler{
+		Log:         logr.Discard(),
+		Recorder:    recorder,
+		Scheme:      scheme,
+		RunnerImage: "example/runner:test",
+		DockerImage: "example/docker:test",
+	}
+
+	pod, err := r.newPod(*runner, ghc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod.CreationTimestamp = metav1.Now()
+	pod.Status.Phase = corev1.PodRunning
+	pod.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner, &pod).Build()
+
+	r.Client = c
+	r.GitHubClient = NewMultiGitHubClient(c, ghc, github.Config{})
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "test1"}
+
+	res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	// The runner pod is being deleted, so we only come back by the unregistration timeout to remove the finalizer.
+	if res.RequeueAfter < DefaultUnregistrationTimeout/2 || res.RequeueAfter > DefaultUnregistrationTimeout {
+		t.Errorf("expected the runner to be requeued only by the unregistration timeout, got %+v", res)
+	}
+
+	if n := len(listRunners.Calls()) + len(removeRunner.Calls()); n != 0 {
+		t.Errorf("expected no GitHub API calls, got %d", n)
+	}
+
+	var got v1alpha1.Runner
+	if err := c.Get(ctx, key, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	cond := meta.FindStatusCondition(got.Status.Conditions, v1alpha1.RunnerConditionUnregistrationFailed)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != "InvalidScope" {
+		t.Errorf("expected the %s condition with the InvalidScope reason, got %+v", v1alpha1.RunnerConditionUnregistrationFailed, cond)
+	}
+
+	select {
+	case e := <-recorder.Events:
+		if !strings.Contains(e, "InvalidScope") {
+			t.Errorf("unexpected event: %s", e)
+		}
+	default:
+		t.Errorf("expected an event")
+	}
+}
+
+func TestTickRunnerGracefulStop_EmptyScope(t *testing.T) {
+	listRunners := fake.NewScriptedHandler(fake.Response{Status: http.StatusOK, Body: fake.RunnersListBody})
+
+	server := fake.NewServer(fake.WithListRunnersHandler(listRunners))
+	defer server.Close()
+
+	// The runner pod has none of RUNNER_ENTERPRISE, RUNNER_ORG, and RUNNER_REPO envs.
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+	enterprise, org, repo := runnerPodScope(pod)
+
+	_, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second}, UnregistrationReasonScaleDown, logr.Discard(), newGithubClient(server), c, enterprise, org, repo, pod.Name, pod)
+	if !isInvalidRunnerScope(err) {
+		t.Fatalf("expected InvalidRunnerScope error, got %v", err)
+	}
+
+	if res == nil || res.RequeueAfter > 0 {
+		t.Errorf("expected the graceful stop not to be requeued, got %+v", res)
+	}
+
+	if n := len(listRunners.Calls()); n != 0 {
+		t.Errorf("expected no ListRunners calls, got %d", n)
+	}
+
+	var got corev1.Pod
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "test1"}, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := getAnnotation(&got, unregistrationStartTimestamp()); ok {
+		t.Errorf("expected the graceful stop not to start: %v", got.Annotations)
+	}
+}
+
+func TestValidateRunnerScope(t *testing.T) {
+	tests := []struct {
+		enterprise, org, repo string
+		wantErr               bool
+	}{
+		{wantErr: true},
+		{enterprise: "example"},
+		{org: "example"},
+		{repo: "example/repo"},
+		{repo: "example", wantErr: true},
+		{repo: "example/", wantErr: true},
+		{repo: "example/repo/sub", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := validateRunnerScope(tt.enterprise, tt.org, tt.repo)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateRunnerScope(%q, %q, %q) error = %v, wantErr %v", tt.enterprise, tt.org, tt.repo, err, tt.wantErr)
+		}
+	}
+}
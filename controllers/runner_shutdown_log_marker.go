@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"regexp"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultShutdownLogMarkerTimeout is the default duration since the start of the graceful stop of a runner
+	// until ARC gives up waiting for the shutdown log marker and completes the unregistration anyway.
+	DefaultShutdownLogMarkerTimeout = 5 * time.Minute
+
+	// shutdownLogMarkerTailLines is the number of the lines at the tail of the runner container logs to search for the shutdown log marker.
+	shutdownLogMarkerTailLines = 100
+)
+
+// RunnerPodLogReader reads the tail of the logs of a container of a runner pod.
+type RunnerPodLogReader interface {
+	TailLogs(ctx context.Context, namespace, pod, container string, lines int64) (string, error)
+}
+
+// ClientsetPodLogReader is the RunnerPodLogReader that reads the logs via the Kubernetes API.
+type ClientsetPodLogReader struct {
+	Clientset kubernetes.Interface
+}
+
+var _ RunnerPodLogReader = &ClientsetPodLogReader{}
+
+func (r *ClientsetPodLogReader) TailLogs(ctx context.Context, namespace, pod, container string, lines int64) (string, error) {
+	stream, err := r.Clientset.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{Container: container, TailLines: &lines}).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	logs, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return "", err
+	}
+
+	return string(logs), nil
+}
+
+// shutdownLogMarkerRemaining returns the remaining duration to wait for config.ShutdownLogMarker to appear in the runner container logs,
+// or zero if the marker is disabled, found, or timed out.
+// The marker is e.g. the line the runner prints once it finished the job, so that the runner pod isn't deleted
+// while it's still e.g. uploading artifacts although GitHub reports the runner idle.
+// Runner pods whose runner container never started have nothing to wait for, so it returns zero for them, too.
+// Failures to read the logs are treated the same as the marker not found, as the logs may not be available yet.
+func shutdownLogMarkerRemaining(ctx context.Context, config GracefulStopConfig, log logr.Logger, pod *corev1.Pod, now time.Time) time.Duration {
+	if config.ShutdownLogMarker == "" || config.PodLogReader == nil || pod == nil || !runnerContainerStarted(pod) {
+		return 0
+	}
+
+	// The marker is validated by GracefulStopConfig.Validate beforehand.
+	marker, err := regexp.Compile(config.ShutdownLogMarker)
+	if err != nil {
+		log.Error(err, "Skipped verifying the invalid shutdown log marker", "marker", config.ShutdownLogMarker)
+		return 0
+	}
+
+	var remaining time.Duration
+
+	if started, ok := getAnnotation(pod, unregistrationStartTimestamp()); ok {
+		if t, err := parseUnregistrationTimestamp(started); err == nil {
+			remaining = config.ShutdownLogMarkerTimeout - now.Sub(t)
+		}
+	}
+
+	logs, err := config.PodLogReader.TailLogs(ctx, pod.Namespace, pod.Name, containerName, shutdownLogMarkerTailLines)
+	if err != nil {
+		log.V(1).Info("Failed to read the runner container logs to verify the shutdown log marker", "error", err.Error())
+	} else if marker.MatchString(logs) {
+		log.V(1).Info("Found the shutdown log marker in the runner container logs", "marker", marker.String())
+		return 0
+	}
+
+	if remaining <= 0 {
+		log.Info("WARNING: Completing the runner unregistration without the shutdown log marker found in the runner container logs, as the timeout has passed.", "marker", marker.String(), "timeout", config.ShutdownLogMarkerTimeout)
+		return 0
+	}
+
+	return remaining
+}
+
+// runnerContainerStarted returns true if the runner container of the pod is running or has terminated.
+func runnerContainerStarted(pod *corev1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != containerName {
+			continue
+		}
+
+		return status.State.Running != nil || status.State.Terminated != nil || status.LastTerminationState.Terminated != nil
+	}
+
+	return false
+}
@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	gogithub "github.com/google/go-github/v39/github"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakePodLogReader returns the next one of logs on each read, and the last one once all the others are read.
+type fakePodLogReader struct {
+	logs  []string
+	err   error
+	reads int
+}
+
+func (r *fakePodLogReader) TailLogs(ctx context.Context, namespace, pod, container string, lines int64) (string, error) {
+	r.reads++
+
+	if r.err != nil {
+		return "", r.err
+	}
+
+	i := r.reads - 1
+	if i >= len(r.logs) {
+		i = len(r.logs) - 1
+	}
+
+	return r.logs[i], nil
+}
+
+func TestTickRunnerGracefulStop_ShutdownLogMarker(t *testing.T) {
+	tests := []struct {
+		name string
+		logs []string
+		err  error
+		// advance is the duration the clock advances between the ticks.
+		advance      time.Duration
+		wantRequeued bool
+	}{
+		{
+			name:         "marker appears on the next tick",
+			logs:         []string{"Uploading artifacts", "Job example completed with result: Succeeded"},
+			advance:      time.Second,
+			wantRequeued: true,
+		},
+		{
+			name: "marker found",
+			logs: []string{"Job example completed with result: Succeeded"},
+		},
+		{
+			name:         "marker never appears",
+			logs:         []string{"Uploading artifacts"},
+			advance:      time.Hour,
+			wantRequeued: true,
+		},
+		{
+			name:         "logs unavailable",
+			err:          errors.New("container not found"),
+			advance:      time.Hour,
+			wantRequeued: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &fakePodLogReader{logs: tt.logs, err: tt.err}
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "test1",
+				},
+				Status: corev1.PodStatus{
+					Phase:             corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+				},
+			}
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+			api := &fakeRunnerAPI{runners: []*gogithub.Runner{{ID: gogithub.Int64(1), Name: gogithub.String("test1"), Status: gogithub.String("online"), Busy: gogithub.Bool(false)}}}
+
+			clock := &fakeClock{now: time.Now()}
+
+			config := GracefulStopConfig{
+				UnregistrationTimeout:    10 * time.Minute,
+				UnregistrationRetryDelay: 10 * time.Second,
+				ShutdownLogMarker:        `Job .+ completed with result`,
+				ShutdownLogMarkerTimeout: time.Minute,
+				PodLogReader:             reader,
+			}
+
+			updated, res, err := tickRunnerGracefulStop(context.Background(), clock, config, "", logr.Discard(), api, c, "", "", "test/valid", pod.Name, pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.wantRequeued {
+				if res != nil {
+					t.Fatalf("tickRunnerGracefulStop() = %v, want nil", res)
+				}
+
+				if _, ok := getAnnotation(updated, unregistrationCompleteTimestamp()); !ok {
+					t.Errorf("expected the unregistration to complete as the marker is found: %v", updated.Annotations)
+				}
+
+				return
+			}
+
+			if res == nil || res.RequeueAfter != config.UnregistrationRetryDelay {
+				t.Fatalf("tickRunnerGracefulStop() = %v, want RequeueAfter %v", res, config.UnregistrationRetryDelay)
+			}
+
+			if len(api.removed) != 1 {
+				t.Errorf("expected the runner to be removed from GitHub before waiting for the marker, removed %v", api.removed)
+			}
+
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(pod), pod); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := getAnnotation(pod, unregistrationCompleteTimestamp()); ok {
+				t.Fatalf("expected the unregistration not to complete before the marker is found: %v", pod.Annotations)
+			}
+
+			// The runner exits once it's removed from GitHub, after which ARC reads the logs again.
+			pod.Status.Phase = corev1.PodSucceeded
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}}}
+			if err := c.Update(context.Background(), pod); err != nil {
+				t.Fatal(err)
+			}
+
+			clock.Advance(tt.advance)
+
+			updated, res, err = tickRunnerGracefulStop(context.Background(), clock, config, "", logr.Discard(), api, c, "", "", "test/valid", pod.Name, pod)
+			if err != nil || res != nil {
+				t.Fatalf("tickRunnerGracefulStop() res = %v, err = %v", res, err)
+			}
+
+			if _, ok := getAnnotation(updated, unregistrationCompleteTimestamp()); !ok {
+				t.Errorf("expected the unregistration to complete: %v", updated.Annotations)
+			}
+		})
+	}
+}
+
+func TestShutdownLogMarkerRemaining_RunnerContainerNotStarted(t *testing.T) {
+	reader := &fakePodLogReader{logs: []string{""}}
+
+	config := GracefulStopConfig{ShutdownLogMarker: `completed`, ShutdownLogMarkerTimeout: time.Minute, PodLogReader: reader}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodPending,
+			ContainerStatuses: []corev1.ContainerStatus{{Name: containerName, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}}},
+		},
+	}
+
+	if remaining := shutdownLogMarkerRemaining(context.Background(), config, logr.Discard(), pod, time.Now()); remaining != 0 {
+		t.Errorf("expected no wait for the runner container that never started, got %v", remaining)
+	}
+
+	if reader.reads != 0 {
+		t.Errorf("expected the logs not to be read, read %d times", reader.reads)
+	}
+}
+
+func TestGracefulStopConfig_InvalidShutdownLogMarker(t *testing.T) {
+	if err := (GracefulStopConfig{ShutdownLogMarker: `(`, PodLogReader: &fakePodLogReader{}}).Validate(); err == nil {
+		t.Errorf("expected an invalid regular expression to be rejected")
+	}
+
+	if err := (GracefulStopConfig{ShutdownLogMarker: `completed`}).Validate(); err == nil {
+		t.Errorf("expected the marker without a pod log reader to be rejected")
+	}
+}
+
+func TestClientsetPodLogReader(t *testing.T) {
+	reader := &ClientsetPodLogReader{Clientset: k8sfake.NewSimpleClientset()}
+
+	logs, err := reader.TailLogs(context.Background(), "default", "test1", containerName, shutdownLogMarkerTailLines)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake clientset streams a fixed body for any pod.
+	if logs != "fake logs" {
+		t.Errorf("unexpected logs: %q", logs)
+	}
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultRunnerStatusUpdateWindow is the default window within which the runner controller coalesces the status updates of each runner.
+const DefaultRunnerStatusUpdateWindow = 10 * time.Second
+
+// runnerStatusCoalescer coalesces the status updates of runners to reduce the load on the API server.
+//
+// It suppresses updates that don't change the runner status, including ones computed from the cached runner that hasn't caught up
+// with the update written within the window yet, and debounces updates that are only for observability to at most one per runner within the window.
+// Every update carries the whole runner status computed by the reconciliation, and suppressing one never writes an older status
+// after a newer one, so the last update written always wins.
+//
+// A nil *runnerStatusCoalescer only suppresses updates that don't change the cached runner status.
+type runnerStatusCoalescer struct {
+	mu     sync.Mutex
+	window time.Duration
+	last   map[types.NamespacedName]writtenRunnerStatus
+}
+
+type writtenRunnerStatus struct {
+	uid             types.UID
+	resourceVersion string
+	status          v1alpha1.RunnerStatus
+	at              time.Time
+}
+
+func newRunnerStatusCoalescer(window time.Duration) *runnerStatusCoalescer {
+	return &runnerStatusCoalescer{window: window, last: map[types.NamespacedName]writtenRunnerStatus{}}
+}
+
+// shouldWrite returns true if the update of the status of the cached runner to updated needs to be written now.
+//
+// debounce is true for updates only for observability, which are suppressed within the window since the last update of the runner.
+// The caller must make sure the runner is reconciled again, so that the latest status is written once the window has passed.
+func (c *runnerStatusCoalescer) shouldWrite(runner *v1alpha1.Runner, updated *v1alpha1.RunnerStatus, debounce bool, now time.Time) bool {
+	if equality.Semantic.DeepEqual(runner.Status, *updated) {
+		return false
+	}
+
+	if c == nil || c.window <= 0 {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.prune(now)
+
+	last, ok := c.last[types.NamespacedName{Namespace: runner.Namespace, Name: runner.Name}]
+	if !ok || last.uid != runner.UID {
+		return true
+	}
+
+	// The cached runner is behind the last update, which already has the status we are about to write.
+	if runner.ResourceVersion != last.resourceVersion && equality.Semantic.DeepEqual(last.status, *updated) {
+		return false
+	}
+
+	return !debounce
+}
+
+// written records the runner status update just written, whose resource version is the one the API server returned.
+func (c *runnerStatusCoalescer) written(updated *v1alpha1.Runner, now time.Time) {
+	if c == nil || c.window <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last[types.NamespacedName{Namespace: updated.Namespace, Name: updated.Name}] = writtenRunnerStatus{
+		uid:             updated.UID,
+		resourceVersion: updated.ResourceVersion,
+		status:          *updated.Status.DeepCopy(),
+		at:              now,
+	}
+}
+
+// prune drops the updates older than the window, which no longer suppress anything, so that runners gone don't leak entries.
+func (c *runnerStatusCoalescer) prune(now time.Time) {
+	for k, last := range c.last {
+		if now.Sub(last.at) >= c.window {
+			delete(c.last, k)
+		}
+	}
+}
+
+// patchStatus patches the status of the runner to the one of updated, unless the update is suppressed by the status coalescer.
+// See runnerStatusCoalescer for debounce.
+func (r *RunnerReconciler) patchStatus(ctx context.Context, runner *v1alpha1.Runner, updated *v1alpha1.Runner, debounce bool) error {
+	now := time.Now()
+
+	if !r.statusUpdates.shouldWrite(runner, &updated.Status, debounce, now) {
+		return nil
+	}
+
+	if err := r.Status().Patch(ctx, updated, client.MergeFrom(runner)); err != nil {
+		return err
+	}
+
+	r.statusUpdates.written(updated, now)
+
+	return nil
+}
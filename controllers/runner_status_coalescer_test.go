@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRunnerStatusCoalescer(t *testing.T) {
+	now := time.Now()
+	window := 10 * time.Second
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1", UID: "uid1", ResourceVersion: "1"},
+		Status:     v1alpha1.RunnerStatus{Phase: "Pending"},
+	}
+
+	running := v1alpha1.RunnerStatus{Phase: "Running"}
+
+	c := newRunnerStatusCoalescer(window)
+
+	if c.shouldWrite(runner, &runner.Status, false, now) {
+		t.Errorf("an update that doesn't change the status must be suppressed")
+	}
+
+	if !c.shouldWrite(runner, &running, false, now) {
+		t.Fatalf("the first update must be written")
+	}
+
+	written := runner.DeepCopy()
+	written.Status = running
+	written.ResourceVersion = "2"
+	c.written(written, now)
+
+	// The cached runner hasn't caught up with the update yet.
+	if c.shouldWrite(runner, &running, false, now.Add(time.Second)) {
+		t.Errorf("a redundant update computed from the stale cache must be suppressed")
+	}
+
+	attempts := v1alpha1.RunnerStatus{Phase: "Running", UnregistrationAttempts: 1}
+
+	if c.shouldWrite(written, &attempts, true, now.Add(time.Second)) {
+		t.Errorf("a debounced update within the window must be suppressed")
+	}
+
+	if !c.shouldWrite(written, &attempts, false, now.Add(time.Second)) {
+		t.Errorf("an update that isn't debounced must be written within the window")
+	}
+
+	if !c.shouldWrite(written, &attempts, true, now.Add(window)) {
+		t.Errorf("a debounced update must be written once the window has passed")
+	}
+
+	if !c.shouldWrite(runner, &running, false, now.Add(window)) {
+		t.Errorf("the stale cache must be trusted again once the window has passed")
+	}
+
+	recreated := runner.DeepCopy()
+	recreated.UID = "uid2"
+	c.written(written, now)
+
+	if !c.shouldWrite(recreated, &running, true, now.Add(time.Second)) {
+		t.Errorf("updates written for the runner before it was recreated must not suppress anything")
+	}
+}
+
+func TestRunnerStatusCoalescer_Disabled(t *testing.T) {
+	runner := &v1alpha1.Runner{Status: v1alpha1.RunnerStatus{Phase: "Pending"}}
+	running := v1alpha1.RunnerStatus{Phase: "Running"}
+
+	for _, c := range []*runnerStatusCoalescer{nil, newRunnerStatusCoalescer(0)} {
+		if c.shouldWrite(runner, &runner.Status, false, time.Now()) {
+			t.Errorf("an update that doesn't change the status must be suppressed")
+		}
+
+		c.written(&v1alpha1.Runner{Status: running}, time.Now())
+
+		if !c.shouldWrite(runner, &running, true, time.Now()) {
+			t.Errorf("an update that changes the status must be written")
+		}
+	}
+}
+
+func TestRunnerReconciler_PatchStatusSuppressesRedundantUpdates(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"},
+		Status:     v1alpha1.RunnerStatus{Phase: "Pending"},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner).Build()
+
+	r := &RunnerReconciler{
+		Client:        c,
+		statusUpdates: newRunnerStatusCoalescer(time.Minute),
+	}
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: runner.Namespace, Name: runner.Name}
+
+	var cached v1alpha1.Runner
+	if err := c.Get(ctx, key, &cached); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(status v1alpha1.RunnerStatus, debounce bool) string {
+		t.Helper()
+
+		updated := cached.DeepCopy()
+		updated.Status = status
+
+		if err := r.patchStatus(ctx, &cached, updated, debounce); err != nil {
+			t.Fatalf("patchStatus() error = %v", err)
+		}
+
+		var got v1alpha1.Runner
+		if err := c.Get(ctx, key, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		return got.ResourceVersion
+	}
+
+	rv := patch(v1alpha1.RunnerStatus{Phase: "Running"}, false)
+	if rv == cached.ResourceVersion {
+		t.Fatalf("expected the update to be written")
+	}
+
+	// Reconciliations seeing the stale cached runner compute the same update again.
+	for i := 0; i < 3; i++ {
+		if got := patch(v1alpha1.RunnerStatus{Phase: "Running"}, false); got != rv {
+			t.Errorf("expected the redundant update to be suppressed: resource version changed from %s to %s", rv, got)
+		}
+	}
+
+	if got := patch(v1alpha1.RunnerStatus{Phase: "Running", UnregistrationAttempts: 1}, true); got != rv {
+		t.Errorf("expected the debounced update to be suppressed: resource version changed from %s to %s", rv, got)
+	}
+
+	// The last update wins even though the earlier ones were suppressed.
+	if got := patch(v1alpha1.RunnerStatus{Phase: "Failed"}, false); got == rv {
+		t.Errorf("expected the update changing the phase to be written")
+	}
+
+	var got v1alpha1.Runner
+	if err := c.Get(ctx, key, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Status.Phase != "Failed" {
+		t.Errorf("unexpected phase: got %q, want %q", got.Status.Phase, "Failed")
+	}
+}
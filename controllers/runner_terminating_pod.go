@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TerminatingPodUnregistration determines how ARC unregisters the runner whose pod is already terminating,
+// e.g. because the node is evicting the pod, so that the runner is going away regardless of the graceful stop.
+type TerminatingPodUnregistration string
+
+const (
+	// TerminatingPodUnregistrationGraceful gracefully stops the runner the same as any other runner, retrying until the unregistration timeout.
+	TerminatingPodUnregistrationGraceful TerminatingPodUnregistration = "graceful"
+
+	// TerminatingPodUnregistrationBestEffort tries to remove the runner from GitHub once, and completes the unregistration
+	// even if the runner was busy or the GitHub API call failed.
+	TerminatingPodUnregistrationBestEffort TerminatingPodUnregistration = "best-effort"
+
+	// TerminatingPodUnregistrationSkip completes the unregistration without calling GitHub API at all.
+	// The runner stays registered on GitHub as offline until it's removed by GitHub or by e.g. --ghost-runner-grace-period.
+	TerminatingPodUnregistrationSkip TerminatingPodUnregistration = "skip"
+)
+
+// skipsGracefulStop returns true if the runner pod is terminating and the mode is not to gracefully stop the runner of such pod.
+func skipsGracefulStop(mode TerminatingPodUnregistration, pod *corev1.Pod) bool {
+	return pod != nil && !pod.DeletionTimestamp.IsZero() && mode != "" && mode != TerminatingPodUnregistrationGraceful
+}
+
+// unregisterTerminatingRunner unregisters the runner of the terminating pod per config.TerminatingPodUnregistration, without retrying.
+// It returns false when the runner needs to be gracefully stopped as usual instead.
+func unregisterTerminatingRunner(ctx context.Context, config GracefulStopConfig, log logr.Logger, ghClient github.RunnerAPI, enterprise, org, repo, runner string, pod *corev1.Pod) bool {
+	if !skipsGracefulStop(config.TerminatingPodUnregistration, pod) {
+		return false
+	}
+
+	if _, ok := getAnnotation(pod, unregistrationCompleteTimestamp()); ok {
+		return false
+	}
+
+	if config.TerminatingPodUnregistration == TerminatingPodUnregistrationSkip {
+		log.Info("Skipped unregistering the runner as the runner pod is already terminating. The runner may stay registered on GitHub until it's removed as offline.", "podDeletionTimestamp", pod.DeletionTimestamp)
+
+		return true
+	}
+
+	unregistered, err := unregisterRunner(ctx, config, log, ghClient, enterprise, org, repo, runner)
+	if err != nil {
+		log.Info("Failed to unregister the runner whose pod is already terminating. Not retrying as the runner pod is going away anyway. The runner may stay registered on GitHub until it's removed as offline.", "podDeletionTimestamp", pod.DeletionTimestamp, "error", err.Error())
+	} else if unregistered {
+		log.Info("Unregistered the runner whose pod is already terminating", "podDeletionTimestamp", pod.DeletionTimestamp)
+	} else {
+		log.Info("Runner whose pod is already terminating is not registered on GitHub", "podDeletionTimestamp", pod.DeletionTimestamp)
+	}
+
+	return true
+}
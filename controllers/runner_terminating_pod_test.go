@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTickRunnerGracefulStop_TerminatingPod(t *testing.T) {
+	tests := []struct {
+		name             string
+		mode             TerminatingPodUnregistration
+		removeRunner     fake.Response
+		wantRemoveRunner int
+		wantComplete     bool
+	}{
+		{
+			name:             "graceful retries the busy runner",
+			mode:             TerminatingPodUnregistrationGraceful,
+			removeRunner:     fake.RunnerBusyResponse("test1"),
+			wantRemoveRunner: 1,
+		},
+		{
+			name:             "best effort",
+			mode:             TerminatingPodUnregistrationBestEffort,
+			removeRunner:     fake.Response{Status: http.StatusNoContent},
+			wantRemoveRunner: 1,
+			wantComplete:     true,
+		},
+		{
+			name:             "best effort gives up on the busy runner",
+			mode:             TerminatingPodUnregistrationBestEffort,
+			removeRunner:     fake.RunnerBusyResponse("test1"),
+			wantRemoveRunner: 1,
+			wantComplete:     true,
+		},
+		{
+			name:         "skip",
+			mode:         TerminatingPodUnregistrationSkip,
+			removeRunner: fake.Response{Status: http.StatusNoContent},
+			wantComplete: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removeRunner := fake.NewScriptedHandler(tt.removeRunner)
+
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+				fake.WithRemoveRunnerHandler(removeRunner),
+			)
+			defer server.Close()
+
+			deletionTimestamp := metav1.NewTime(time.Now().Add(-time.Second))
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:         "default",
+					Name:              "test1",
+					Finalizers:        []string{runnerPodFinalizerName},
+					DeletionTimestamp: &deletionTimestamp,
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+				},
+			}
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+			updated, res, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second, BusyRunnerPollInterval: time.Second, TerminatingPodUnregistration: tt.mode}, "", logr.Discard(), newGithubClient(server), c, "", "", "test/valid", pod.Name, pod)
+
+			if got := len(removeRunner.Calls()); got != tt.wantRemoveRunner {
+				t.Errorf("unexpected number of remove runner calls: got %d, want %d", got, tt.wantRemoveRunner)
+			}
+
+			if !tt.wantComplete {
+				if res == nil {
+					t.Errorf("expected the graceful stop to be retried, got res = %v, err = %v", res, err)
+				}
+				return
+			}
+
+			if err != nil || res != nil {
+				t.Fatalf("expected the unregistration to complete without retrying, got res = %v, err = %v", res, err)
+			}
+
+			if _, ok := getAnnotation(updated, unregistrationCompleteTimestamp()); !ok {
+				t.Errorf("expected the pod to have %s annotation: %v", unregistrationCompleteTimestamp(), updated.Annotations)
+			}
+		})
+	}
+}
+
+func TestGracefulStopConfig_InvalidTerminatingPodUnregistration(t *testing.T) {
+	if err := (GracefulStopConfig{TerminatingPodUnregistration: "ignore"}).Validate(); err == nil {
+		t.Errorf("expected an invalid mode to be rejected")
+	}
+}
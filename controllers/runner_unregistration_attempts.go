@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// ignoreUnregistrationAttemptsUpdates is the predicate to ignore updates to runners and runner pods
+// that only count unregistration attempts or record the last unregistration error.
+//
+// Each attempt updates the pod annotation and the runner status. Without this, the update would trigger another reconciliation
+// that retries the unregistration immediately, instead of after the delay the previous attempt wanted.
+func ignoreUnregistrationAttemptsUpdates() predicate.Funcs {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !onlyUnregistrationAttemptsChanged(e.ObjectOld, e.ObjectNew)
+		},
+	}
+}
+
+func onlyUnregistrationAttemptsChanged(oldObj, newObj client.Object) bool {
+	switch o := oldObj.(type) {
+	case *corev1.Pod:
+		n, ok := newObj.(*corev1.Pod)
+		if !ok || o.Annotations[AnnotationKeyUnregistrationAttemptsTotal] == n.Annotations[AnnotationKeyUnregistrationAttemptsTotal] {
+			return false
+		}
+
+		o, n = o.DeepCopy(), n.DeepCopy()
+		delete(o.Annotations, AnnotationKeyUnregistrationAttemptsTotal)
+		delete(n.Annotations, AnnotationKeyUnregistrationAttemptsTotal)
+		o.ResourceVersion, n.ResourceVersion = "", ""
+		o.ManagedFields, n.ManagedFields = nil, nil
+
+		return equality.Semantic.DeepEqual(o, n)
+	case *v1alpha1.Runner:
+		n, ok := newObj.(*v1alpha1.Runner)
+		if !ok || (o.Status.UnregistrationAttempts == n.Status.UnregistrationAttempts && equality.Semantic.DeepEqual(o.Status.LastUnregistrationError, n.Status.LastUnregistrationError)) {
+			return false
+		}
+
+		o, n = o.DeepCopy(), n.DeepCopy()
+		o.Status.UnregistrationAttempts, n.Status.UnregistrationAttempts = 0, 0
+		o.Status.LastUnregistrationError, n.Status.LastUnregistrationError = nil, nil
+		o.ResourceVersion, n.ResourceVersion = "", ""
+		o.ManagedFields, n.ManagedFields = nil, nil
+
+		return equality.Semantic.DeepEqual(o, n)
+	}
+
+	return false
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// DefaultUnregistrationConfirmationAttempts is the number of times ARC lists runners to confirm that a runner has
+	// disappeared on GitHub after removing it, when --confirm-unregistration is enabled.
+	DefaultUnregistrationConfirmationAttempts = 3
+
+	defaultUnregistrationConfirmationInterval = 2 * time.Second
+)
+
+// UnregistrationNotConfirmed is returned when the runner was still listed on GitHub after RemoveRunner succeeded,
+// as many times as the confirmation attempts.
+type UnregistrationNotConfirmed struct {
+	Name     string
+	ID       int64
+	Attempts int
+}
+
+func (e *UnregistrationNotConfirmed) Error() string {
+	return fmt.Sprintf("runner %q (id %d) is still listed on GitHub after %d confirmation attempts since it was removed", e.Name, e.ID, e.Attempts)
+}
+
+// confirmingRunnerAPI makes unregisterRunner confirm that the runner has disappeared on GitHub after RemoveRunner succeeds,
+// for extra safety against rare cases where RemoveRunner succeeded but the runner was still there.
+type confirmingRunnerAPI struct {
+	github.RunnerAPI
+
+	attempts int
+	interval time.Duration
+}
+
+// withUnregistrationConfirmation returns the RunnerAPI to be used for unregistering runners,
+// which confirms each unregistration when confirm is true.
+func withUnregistrationConfirmation(api github.RunnerAPI, confirm bool) github.RunnerAPI {
+	if !confirm {
+		return api
+	}
+
+	return &confirmingRunnerAPI{
+		RunnerAPI: api,
+		attempts:  DefaultUnregistrationConfirmationAttempts,
+		interval:  defaultUnregistrationConfirmationInterval,
+	}
+}
+
+// confirmRunnerRemoval lists runners bypassing the cache until the removed runner disappears, up to the number of attempts.
+func (c *confirmingRunnerAPI) confirmRunnerRemoval(ctx context.Context, log logr.Logger, enterprise, org, repo, name string, id int64) error {
+	for i := 0; i < c.attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.interval):
+			}
+		}
+
+		runners, err := c.ListRunnersWithFilter(github.WithoutCache(ctx), enterprise, org, repo, github.RunnerFilter{Name: name})
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, r := range runners {
+			if r.GetID() == id {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil
+		}
+
+		log.V(1).Info("Runner is still listed on GitHub after it was removed. Retrying confirmation.", "runnerID", id, "attempt", i+1)
+	}
+
+	return &UnregistrationNotConfirmed{Name: name, ID: id, Attempts: c.attempts}
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+)
+
+func TestUnregisterRunner_Confirmation(t *testing.T) {
+	listed := fake.Response{Status: http.StatusOK, Body: fake.RunnersListBody}
+	gone := fake.Response{Status: http.StatusOK, Body: `{"total_count": 0, "runners": []}`}
+
+	tests := []struct {
+		name         string
+		listRunners  []fake.Response
+		wantErr      bool
+		wantListings int
+	}{
+		{
+			name:         "runner disappears on the first confirmation",
+			listRunners:  []fake.Response{listed, gone},
+			wantListings: 2,
+		},
+		{
+			name:         "runner disappears on the last confirmation",
+			listRunners:  []fake.Response{listed, listed, listed, gone},
+			wantListings: 4,
+		},
+		{
+			name:         "runner never disappears",
+			listRunners:  []fake.Response{listed},
+			wantErr:      true,
+			wantListings: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listRunners := fake.NewScriptedHandler(tt.listRunners...)
+
+			server := fake.NewServer(
+				fake.WithListRunnersHandler(listRunners),
+				fake.WithRemoveRunnerResponse(http.StatusNoContent, ""),
+			)
+			defer server.Close()
+
+			api := &confirmingRunnerAPI{
+				RunnerAPI: newGithubClient(server),
+				attempts:  3,
+			}
+
+			ok, err := unregisterRunner(context.Background(), GracefulStopConfig{}, logr.Discard(), api, "", "", "test/valid", "test1")
+			if tt.wantErr {
+				var e *UnregistrationNotConfirmed
+				if !errors.As(err, &e) {
+					t.Fatalf("unregisterRunner() error = %v, want UnregistrationNotConfirmed", err)
+				}
+				if !isTransientUnregistrationError(err) {
+					t.Errorf("UnregistrationNotConfirmed must not consume the retry budget")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unregisterRunner() error = %v", err)
+				}
+				if !ok {
+					t.Errorf("unregisterRunner() = false, want true")
+				}
+			}
+
+			calls := listRunners.Calls()
+			if len(calls) != tt.wantListings {
+				t.Fatalf("unexpected number of list runners calls: got %d, want %d", len(calls), tt.wantListings)
+			}
+
+			if got := calls[0].Header.Get("Cache-Control"); got != "" {
+				t.Errorf("unexpected Cache-Control header of the initial listing: %q", got)
+			}
+			for _, c := range calls[1:] {
+				if got := c.Header.Get("Cache-Control"); got != "no-cache" {
+					t.Errorf("unexpected Cache-Control header of a confirmation: got %q, want no-cache", got)
+				}
+			}
+		})
+	}
+}
+
+func TestWithUnregistrationConfirmation(t *testing.T) {
+	server := fake.NewServer(fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody))
+	defer server.Close()
+
+	ghClient := newGithubClient(server)
+
+	if api := withUnregistrationConfirmation(ghClient, false); api != ghClient {
+		t.Errorf("withUnregistrationConfirmation() wrapped the client although confirmation is disabled")
+	}
+
+	api, ok := withUnregistrationConfirmation(ghClient, true).(*confirmingRunnerAPI)
+	if !ok {
+		t.Fatalf("withUnregistrationConfirmation() did not wrap the client although confirmation is enabled")
+	}
+	if api.attempts != DefaultUnregistrationConfirmationAttempts {
+		t.Errorf("unexpected confirmation attempts: got %d, want %d", api.attempts, DefaultUnregistrationConfirmationAttempts)
+	}
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// nextLastUnregistrationError returns the status.lastUnregistrationError of the runner after a tick of its graceful stop.
+//
+// It's cleared once the unregistration completes, and set when the tick failed with an error.
+// The current one is kept as-is while the error text doesn't change, so that we don't update the runner status on every retry,
+// and the time tells when the runner got stuck.
+func nextLastUnregistrationError(current *v1alpha1.RunnerUnregistrationError, res *ctrl.Result, err error, now time.Time) *v1alpha1.RunnerUnregistrationError {
+	if res == nil {
+		return nil
+	}
+
+	if err == nil {
+		return current
+	}
+
+	// It doesn't tell anything new beyond the error of the attempt that exhausted the retry budget.
+	var failed *UnregistrationFailed
+	if errors.As(err, &failed) && failed.Err == nil && current != nil {
+		return current
+	}
+
+	if current != nil && current.Message == err.Error() {
+		return current
+	}
+
+	return &v1alpha1.RunnerUnregistrationError{
+		Message: err.Error(),
+		Time:    metav1.NewTime(now),
+	}
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestNextLastUnregistrationError(t *testing.T) {
+	now := time.Now()
+	current := &v1alpha1.RunnerUnregistrationError{Message: "failed", Time: metav1.NewTime(now.Add(-time.Minute))}
+
+	tests := []struct {
+		name    string
+		current *v1alpha1.RunnerUnregistrationError
+		res     *ctrl.Result
+		err     error
+		want    *v1alpha1.RunnerUnregistrationError
+	}{
+		{
+			name:    "cleared on completion",
+			current: current,
+		},
+		{
+			name:    "kept while retrying without error",
+			current: current,
+			res:     &ctrl.Result{RequeueAfter: time.Second},
+			want:    current,
+		},
+		{
+			name:    "kept while the error text doesn't change",
+			current: current,
+			res:     &ctrl.Result{},
+			err:     errors.New("failed"),
+			want:    current,
+		},
+		{
+			name:    "set on a new error",
+			current: current,
+			res:     &ctrl.Result{},
+			err:     errors.New("failed again"),
+			want:    &v1alpha1.RunnerUnregistrationError{Message: "failed again", Time: metav1.NewTime(now)},
+		},
+		{
+			name:    "kept when the retry budget had been already exhausted",
+			current: current,
+			res:     &ctrl.Result{},
+			err:     &UnregistrationFailed{Attempts: 3},
+			want:    current,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextLastUnregistrationError(tt.current, tt.res, tt.err, now)
+
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("nextLastUnregistrationError() = %+v, want nil", got)
+				}
+				return
+			}
+
+			if got == nil || got.Message != tt.want.Message || !got.Time.Equal(&tt.want.Time) {
+				t.Errorf("nextLastUnregistrationError() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
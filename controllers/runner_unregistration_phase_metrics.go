@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/controllers/metrics"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const DefaultUnregistrationPhaseMetricsSyncPeriod = 30 * time.Second
+
+// UnregistrationPhaseMetricsSyncer periodically updates the arc_runners_unregistration_phase gauge.
+//
+// Graceful stops of a runner span many reconciliations, possibly across the runner, runner pod, and runnerset controllers,
+// and a runner pod can disappear without being reconciled once more. So rather than incrementing and decrementing the gauge
+// on phase transitions observed by reconcilers, which drifts whenever an observation is missed,
+// this recomputes the gauge from scratch from the unregistration annotations of all the pods in the cache.
+// The gauge is therefore eventually consistent with the annotations, lagging behind by at most SyncPeriod.
+type UnregistrationPhaseMetricsSyncer struct {
+	Client client.Reader
+	Log    logr.Logger
+
+	// UnregistrationTimeout is the controller-wide unregistration timeout, used to tell timed out graceful stops from in-progress ones.
+	UnregistrationTimeout time.Duration
+	SyncPeriod            time.Duration
+}
+
+// Start implements manager.Runnable.
+func (s *UnregistrationPhaseMetricsSyncer) Start(ctx context.Context) error {
+	period := s.SyncPeriod
+	if period <= 0 {
+		period = DefaultUnregistrationPhaseMetricsSyncPeriod
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		if err := s.sync(ctx); err != nil {
+			s.Log.Error(err, "Failed to sync runner unregistration phase metrics")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *UnregistrationPhaseMetricsSyncer) sync(ctx context.Context) error {
+	var pods corev1.PodList
+	if err := s.Client.List(ctx, &pods); err != nil {
+		return err
+	}
+
+	metrics.SetRunnersUnregistrationPhases(countRunnerUnregistrationPhases(pods.Items, s.UnregistrationTimeout, time.Now()))
+
+	return nil
+}
+
+func countRunnerUnregistrationPhases(pods []corev1.Pod, unregistrationTimeout time.Duration, now time.Time) map[string]int {
+	counts := map[string]int{}
+
+	for i := range pods {
+		if phase, ok := runnerPodUnregistrationPhase(&pods[i], unregistrationTimeout, now); ok {
+			counts[phase]++
+		}
+	}
+
+	return counts
+}
+
+// runnerPodUnregistrationPhase returns the phase of the graceful stop of the runner pod, determined by the annotations
+// added by tickRunnerGracefulStop. The second return value is false when the graceful stop has not started.
+func runnerPodUnregistrationPhase(pod *corev1.Pod, unregistrationTimeout time.Duration, now time.Time) (string, bool) {
+	if _, ok := getAnnotation(pod, unregistrationCompleteTimestamp()); ok {
+		return metrics.RunnerUnregistrationPhaseCompleted, true
+	}
+
+	ts, ok := getAnnotation(pod, unregistrationStartTimestamp())
+	if !ok {
+		return "", false
+	}
+
+	started, err := parseUnregistrationTimestamp(ts)
+	if err != nil {
+		// ensureRunnerUnregistration keeps retrying in this case, so it's still in progress.
+		return metrics.RunnerUnregistrationPhaseInProgress, true
+	}
+
+	timeout, _ := EffectiveUnregistrationTimeout(pod, unregistrationTimeout)
+
+	if !now.Before(started.Add(timeout)) {
+		return metrics.RunnerUnregistrationPhaseTimedOut, true
+	}
+
+	return metrics.RunnerUnregistrationPhaseInProgress, true
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/controllers/metrics"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCountRunnerUnregistrationPhases(t *testing.T) {
+	now := time.Now()
+
+	pod := func(annotations map[string]string) corev1.Pod {
+		return corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+	}
+
+	pods := []corev1.Pod{
+		pod(nil),
+		pod(map[string]string{unregistrationStartTimestamp(): now.Add(-10 * time.Second).Format(time.RFC3339)}),
+		pod(map[string]string{unregistrationStartTimestamp(): now.Add(-2 * time.Minute).Format(time.RFC3339)}),
+		pod(map[string]string{
+			unregistrationStartTimestamp():     now.Add(-2 * time.Minute).Format(time.RFC3339),
+			AnnotationKeyUnregistrationTimeout: "10m",
+		}),
+		pod(map[string]string{
+			unregistrationStartTimestamp():    now.Add(-2 * time.Minute).Format(time.RFC3339),
+			unregistrationCompleteTimestamp(): now.Format(time.RFC3339),
+		}),
+	}
+
+	got := countRunnerUnregistrationPhases(pods, time.Minute, now)
+
+	want := map[string]int{
+		metrics.RunnerUnregistrationPhaseInProgress: 2,
+		metrics.RunnerUnregistrationPhaseTimedOut:   1,
+		metrics.RunnerUnregistrationPhaseCompleted:  1,
+	}
+
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("unexpected phase counts (-want +got):\n%s", d)
+	}
+}
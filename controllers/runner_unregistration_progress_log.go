@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// DefaultUnregistrationProgressLogInterval is the default interval of logging the in-progress unregistration of each runner at info level.
+const DefaultUnregistrationProgressLogInterval = 5 * time.Minute
+
+// unregistrationProgressLogs throttles the in-progress unregistration logs per runner,
+// which would otherwise flood the logs with identical lines on every requeue of a long drain.
+var unregistrationProgressLogs = newProgressLogThrottle()
+
+type progressLogThrottle struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func newProgressLogThrottle() *progressLogThrottle {
+	return &progressLogThrottle{last: map[string]time.Time{}}
+}
+
+// logger returns the logger to log the progress of key with.
+// It's log for the first log of key and once the interval has passed since the last one, and log.V(1) otherwise.
+// Zero interval disables the throttling.
+func (t *progressLogThrottle) logger(log logr.Logger, interval time.Duration, key string, now time.Time) logr.Logger {
+	if interval <= 0 {
+		return log
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Entries older than the interval are the same as missing ones, so we drop them to not leak entries of runners gone without completing the unregistration.
+	for k, last := range t.last {
+		if now.Sub(last) >= interval {
+			delete(t.last, k)
+		}
+	}
+
+	if _, ok := t.last[key]; ok {
+		return log.V(1)
+	}
+
+	t.last[key] = now
+
+	return log
+}
+
+// forget makes the next progress of key logged at info level, e.g. when key has moved on to another phase.
+func (t *progressLogThrottle) forget(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.last, key)
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEnsureRunnerUnregistration_ThrottlesInProgressLogs(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+	)
+	defer server.Close()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test3",
+			Annotations: map[string]string{
+				unregistrationStartTimestamp(): formatUnregistrationTimestamp(time.Now()),
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+
+	var info, debug int
+
+	log := funcr.New(func(prefix, args string) {
+		if !strings.Contains(args, "Runner unregistration is in-progress.") {
+			return
+		}
+
+		if strings.Contains(args, `"level"=0`) {
+			info++
+		} else {
+			debug++
+		}
+	}, funcr.Options{Verbosity: 1})
+
+	tick := func() {
+		t.Helper()
+
+		res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationProgressLogInterval: time.Hour}, RequeuePolicy{InProgressDelay: time.Second}, log, newGithubClient(server), "", "", "test/valid", pod.Name, pod)
+		if err != nil || res == nil {
+			t.Fatalf("ensureRunnerUnregistration() = %v, %v, want in-progress", res, err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		tick()
+	}
+
+	if info != 1 || debug != 2 {
+		t.Errorf("unexpected in-progress logs: got %d at info and %d at V(1), want 1 and 2", info, debug)
+	}
+
+	// The unregistration has timed out, which moves the runner on to another phase.
+	pod.Annotations[unregistrationStartTimestamp()] = formatUnregistrationTimestamp(time.Now().Add(-time.Hour))
+
+	if res, err := ensureRunnerUnregistration(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute}, RequeuePolicy{InProgressDelay: time.Second}, logr.Discard(), newGithubClient(server), "", "", "test/valid", pod.Name, pod); err != nil || res != nil {
+		t.Fatalf("ensureRunnerUnregistration() = %v, %v, want nil", res, err)
+	}
+
+	pod.Annotations[unregistrationStartTimestamp()] = formatUnregistrationTimestamp(time.Now())
+
+	tick()
+
+	if info != 2 {
+		t.Errorf("expected the in-progress log at info again after the phase change, got %d at info", info)
+	}
+}
+
+func TestProgressLogThrottle(t *testing.T) {
+	now := time.Now()
+
+	var lines []string
+
+	log := funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{})
+
+	throttle := newProgressLogThrottle()
+
+	throttle.logger(log, time.Minute, "a", now).Info("a")
+	throttle.logger(log, time.Minute, "a", now.Add(30*time.Second)).Info("a")
+	throttle.logger(log, time.Minute, "b", now.Add(30*time.Second)).Info("b")
+	throttle.logger(log, time.Minute, "a", now.Add(time.Minute)).Info("a")
+
+	if got := strings.Join(lines, "\n"); strings.Count(got, `"msg"="a"`) != 2 || strings.Count(got, `"msg"="b"`) != 1 {
+		t.Errorf("unexpected logs: %s", got)
+	}
+
+	lines = nil
+
+	disabled := newProgressLogThrottle()
+	disabled.logger(log, 0, "a", now).Info("a")
+	disabled.logger(log, 0, "a", now).Info("a")
+
+	if len(lines) != 2 {
+		t.Errorf("expected all the logs with the throttling disabled, got %v", lines)
+	}
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AnnotationKeyUnregistrationReason is the annotation ARC adds to the runner pod when its graceful stop started,
+// to tell why the runner was selected for the graceful stop, so that expected churn can be told apart from unexpected churn.
+//
+// ARC also adds it to a Runner before deleting it and to a RunnerReplicaSet being scaled down by a rolling update,
+// so that the reason is propagated down to the runner pod.
+const AnnotationKeyUnregistrationReason = "actions-runner-controller/unregistration-reason"
+
+// UnregistrationReason tells why a runner was selected for the graceful stop.
+type UnregistrationReason string
+
+const (
+	// UnregistrationReasonScaleDown is for runners removed because the desired replicas decreased.
+	UnregistrationReasonScaleDown UnregistrationReason = "scale-down"
+	// UnregistrationReasonRollingUpdate is for runners replaced by a rolling update of a RunnerDeployment.
+	UnregistrationReasonRollingUpdate UnregistrationReason = "rolling-update"
+	// UnregistrationReasonNodeDrain is for runners moved off a cordoned or tainted node.
+	UnregistrationReasonNodeDrain UnregistrationReason = "node-drain"
+	// UnregistrationReasonPVCReclaim is for RunnerSet runners whose persistent volume claim is being reclaimed.
+	UnregistrationReasonPVCReclaim UnregistrationReason = "pvc-reclaim"
+	// UnregistrationReasonRestart is for runners recreated by ARC, e.g. because they failed to register in time.
+	UnregistrationReasonRestart UnregistrationReason = "restart"
+	// UnregistrationReasonMaxAge is for runners recreated because their pods exceeded maxRunnerAge of the runnerdeployment.
+	UnregistrationReasonMaxAge UnregistrationReason = "max-age"
+	// UnregistrationReasonOOMKilled is for runners recreated because their runner container has been OOMKilled.
+	UnregistrationReasonOOMKilled UnregistrationReason = "oom-killed"
+	// UnregistrationReasonManual is for runners and runner pods deleted out of ARC's control, e.g. by kubectl delete.
+	UnregistrationReasonManual UnregistrationReason = "manual"
+)
+
+// unregistrationReasonOf returns the unregistration reason the object is annotated with, or the fallback if it has none.
+func unregistrationReasonOf(obj metav1.Object, fallback UnregistrationReason) UnregistrationReason {
+	if v := obj.GetAnnotations()[AnnotationKeyUnregistrationReason]; v != "" {
+		return UnregistrationReason(v)
+	}
+
+	return fallback
+}
+
+// annotateRunnerReplicaSetRunners records the unregistration reason on the runners of the runner replica set
+// that are about to be deleted along with the runner replica set.
+func annotateRunnerReplicaSetRunners(ctx context.Context, c client.Client, rs v1alpha1.RunnerReplicaSet, reason UnregistrationReason) error {
+	var runners v1alpha1.RunnerList
+	if err := c.List(ctx, &runners, client.InNamespace(rs.Namespace)); err != nil {
+		return err
+	}
+
+	for i := range runners.Items {
+		runner := &runners.Items[i]
+
+		if !metav1.IsControlledBy(runner, &rs) || !runner.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		if err := annotateUnregistrationReason(ctx, c, runner, reason); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// annotateUnregistrationReason records why the runner is about to be deleted, so that the runner controller can tell it on the graceful stop.
+func annotateUnregistrationReason(ctx context.Context, c client.Client, runner *v1alpha1.Runner, reason UnregistrationReason) error {
+	if runner.Annotations[AnnotationKeyUnregistrationReason] == string(reason) {
+		return nil
+	}
+
+	updated := runner.DeepCopy()
+	updated.Annotations = CloneAndAddLabel(updated.Annotations, AnnotationKeyUnregistrationReason, string(reason))
+
+	if err := c.Patch(ctx, updated, client.MergeFrom(runner)); err != nil {
+		return err
+	}
+
+	*runner = *updated
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	actionsv1alpha1 "github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTickRunnerGracefulStop_UnregistrationReason(t *testing.T) {
+	for _, reason := range []UnregistrationReason{
+		UnregistrationReasonScaleDown,
+		UnregistrationReasonRollingUpdate,
+		UnregistrationReasonNodeDrain,
+		UnregistrationReasonRestart,
+		UnregistrationReasonManual,
+	} {
+		t.Run(string(reason), func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+			)
+			defer server.Close()
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "test3",
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+				},
+			}
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+
+			tick := func(reason UnregistrationReason) corev1.Pod {
+				t.Helper()
+
+				var current corev1.Pod
+				if err := c.Get(context.Background(), types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, &current); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, _, err := tickRunnerGracefulStop(context.Background(), realClock{}, GracefulStopConfig{UnregistrationTimeout: time.Minute, UnregistrationRetryDelay: time.Second}, reason, logr.Discard(), newGithubClient(server), c, "", "", "test/valid", current.Name, &current); err != nil {
+					t.Fatalf("tickRunnerGracefulStop() error = %v", err)
+				}
+
+				var got corev1.Pod
+				if err := c.Get(context.Background(), types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, &got); err != nil {
+					t.Fatal(err)
+				}
+
+				return got
+			}
+
+			if got := tick(reason).Annotations[AnnotationKeyUnregistrationReason]; got != string(reason) {
+				t.Errorf("unexpected unregistration reason: got %q, want %q", got, reason)
+			}
+
+			// The reason is recorded only when the graceful stop starts.
+			if got := tick(UnregistrationReasonManual + "-other").Annotations[AnnotationKeyUnregistrationReason]; got != string(reason) {
+				t.Errorf("expected the unregistration reason to be kept across ticks: got %q, want %q", got, reason)
+			}
+		})
+	}
+}
+
+func TestRunnerReplicaSetReconciler_UnregistrationReason(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        UnregistrationReason
+	}{
+		{
+			name: "scale down",
+			want: UnregistrationReasonScaleDown,
+		},
+		{
+			name:        "rolling update",
+			annotations: map[string]string{AnnotationKeyUnregistrationReason: string(UnregistrationReasonRollingUpdate)},
+			want:        UnregistrationReasonRollingUpdate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+			)
+			defer server.Close()
+
+			sch := runtime.NewScheme()
+			_ = corev1.AddToScheme(sch)
+			_ = actionsv1alpha1.AddToScheme(sch)
+
+			rs := &actionsv1alpha1.RunnerReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "default",
+					Name:        "example",
+					UID:         "example-uid",
+					Annotations: tt.annotations,
+				},
+				Spec: actionsv1alpha1.RunnerReplicaSetSpec{
+					Replicas: intPtr(0),
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"foo": "bar"},
+					},
+				},
+			}
+
+			objs := []client.Object{rs}
+
+			for _, name := range []string{"test1", "test2"} {
+				runner := &actionsv1alpha1.Runner{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      name,
+						Labels:    map[string]string{"foo": "bar"},
+						// Keeps the deleted runner around so that we can see its annotations.
+						Finalizers: []string{finalizerName},
+					},
+					Spec: actionsv1alpha1.RunnerSpec{
+						RunnerConfig: actionsv1alpha1.RunnerConfig{
+							Repository: "test/valid",
+						},
+					},
+				}
+				if err := ctrl.SetControllerReference(rs, runner, sch); err != nil {
+					t.Fatal(err)
+				}
+
+				objs = append(objs, runner)
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build()
+
+			r := &RunnerReplicaSetReconciler{
+				Client:       c,
+				Log:          logr.Discard(),
+				Recorder:     record.NewFakeRecorder(10),
+				Scheme:       sch,
+				GitHubClient: NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+			}
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: rs.Namespace, Name: rs.Name}}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			var runners actionsv1alpha1.RunnerList
+			if err := c.List(context.Background(), &runners); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(runners.Items) != 2 {
+				t.Fatalf("unexpected runners: %d", len(runners.Items))
+			}
+
+			for _, runner := range runners.Items {
+				if runner.DeletionTimestamp.IsZero() {
+					t.Errorf("expected runner %s to be deleted", runner.Name)
+				}
+
+				if got := unregistrationReasonOf(&runner, ""); got != tt.want {
+					t.Errorf("unexpected unregistration reason of runner %s: got %q, want %q", runner.Name, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -28,11 +28,14 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -46,6 +49,8 @@ const (
 	LabelKeyRunnerDeploymentName = "runner-deployment-name"
 
 	runnerSetOwnerKey = ".metadata.controller"
+
+	runnerDeploymentFinalizerName = "runnerdeployment.actions.summerwind.dev"
 )
 
 // RunnerDeploymentReconciler reconciles a Runner object
@@ -56,6 +61,10 @@ type RunnerDeploymentReconciler struct {
 	Scheme             *runtime.Scheme
 	CommonRunnerLabels []string
 	Name               string
+
+	// GitHubClient is used to discard the registration tokens for the runners on deletion of the runnerdeployment.
+	// The finalizer for that is added only when this is set.
+	GitHubClient *MultiGitHubClient
 }
 
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runnerdeployments,verbs=get;list;watch;create;update;patch;delete
@@ -64,6 +73,9 @@ type RunnerDeploymentReconciler struct {
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runnerreplicasets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runnerreplicasets/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runners,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch
 
 func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("runnerdeployment", req.NamespacedName)
@@ -74,7 +86,23 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	}
 
 	if !rd.ObjectMeta.DeletionTimestamp.IsZero() {
-		return ctrl.Result{}, nil
+		return r.processRunnerDeploymentDeletion(ctx, rd, log)
+	}
+
+	if r.GitHubClient != nil {
+		finalizers, added := addFinalizer(rd.ObjectMeta.Finalizers, runnerDeploymentFinalizerName)
+
+		if added {
+			newRD := rd.DeepCopy()
+			newRD.ObjectMeta.Finalizers = finalizers
+
+			if err := r.Patch(ctx, newRD, client.MergeFrom(&rd)); err != nil {
+				log.Error(err, "Failed to add finalizer to runnerdeployment")
+				return ctrl.Result{}, err
+			}
+
+			return ctrl.Result{}, nil
+		}
 	}
 
 	metrics.SetRunnerDeployment(rd)
@@ -102,7 +130,53 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		oldSets = myRunnerReplicaSets[1:]
 	}
 
-	desiredRS, err := r.newRunnerReplicaSet(rd)
+	// The runnerreplicaset controller creates and deletes runners on its own to match the replicas,
+	// so we need to pause the replica sets too, not only this controller.
+	for i := range myRunnerReplicaSets {
+		rs := &myRunnerReplicaSets[i]
+
+		if rs.Spec.Paused == rd.Spec.Paused {
+			continue
+		}
+
+		updated := rs.DeepCopy()
+		updated.Spec.Paused = rd.Spec.Paused
+
+		if err := r.Client.Patch(ctx, updated, client.MergeFrom(rs)); err != nil {
+			log.Error(err, "Failed to update paused state of runnerreplicaset resource", "runnerreplicaset", rs.Name)
+
+			return ctrl.Result{}, err
+		}
+
+		*rs = *updated
+	}
+
+	if rd.Spec.Paused {
+		// We intentionally skip creating, replacing, scaling and deleting runner replica sets.
+		// Runners that had been marked for deletion before the deployment got paused are
+		// still gracefully stopped by the runner controller.
+		log.V(1).Info("Skipped reconciling runnerreplicasets because the runnerdeployment is paused")
+
+		var desiredReplicas int
+		if newestSet != nil {
+			desiredReplicas = getIntOrDefault(newestSet.Spec.Replicas, 1)
+		}
+
+		return r.updateStatus(ctx, log, rd, newestSet, oldSets, desiredReplicas)
+	}
+
+	// The version of the credentials secret is part of the template hash,
+	// so that rotating the secret replaces the runners the same way as updating the template.
+	rdWithSecretVersion, err := r.withSecretVersion(ctx, rd)
+	if err != nil {
+		r.Recorder.Event(&rd, corev1.EventTypeWarning, "SecretRotationFailure", err.Error())
+
+		log.Error(err, "Could not get the credentials secret of the runnerdeployment")
+
+		return ctrl.Result{}, err
+	}
+
+	desiredRS, err := r.newRunnerReplicaSet(rdWithSecretVersion)
 	if err != nil {
 		r.Recorder.Event(&rd, corev1.EventTypeNormal, "RunnerAutoscalingFailure", err.Error())
 
@@ -136,6 +210,19 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	}
 
 	if newestTemplateHash != desiredTemplateHash {
+		if rd.Spec.RollingUpdate != nil {
+			replicas, err := rollingUpdateInitialReplicas(rd.Spec.RollingUpdate, myRunnerReplicaSets, getIntOrDefault(desiredRS.Spec.Replicas, 1))
+			if err != nil {
+				r.Recorder.Event(&rd, corev1.EventTypeWarning, "InvalidRollingUpdate", err.Error())
+
+				log.Error(err, "Could not create runnerreplicaset")
+
+				return ctrl.Result{}, err
+			}
+
+			desiredRS.Spec.Replicas = &replicas
+		}
+
 		if err := r.Client.Create(ctx, desiredRS); err != nil {
 			log.Error(err, "Failed to create runnerreplicaset resource")
 
@@ -174,8 +261,9 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	currentDesiredReplicas := getIntOrDefault(newestSet.Spec.Replicas, defaultReplicas)
 	newDesiredReplicas := getIntOrDefault(desiredRS.Spec.Replicas, defaultReplicas)
 
-	// Please add more conditions that we can in-place update the newest runnerreplicaset without disruption
-	if currentDesiredReplicas != newDesiredReplicas {
+	// Please add more conditions that we can in-place update the newest runnerreplicaset without disruption.
+	// During a rolling update, the replicas of the newest runnerreplicaset are instead scaled up step by step below.
+	if currentDesiredReplicas != newDesiredReplicas && (rd.Spec.RollingUpdate == nil || len(oldSets) == 0) {
 		newestSet.Spec.Replicas = &newDesiredReplicas
 		newestSet.Spec.EffectiveTime = rd.Spec.EffectiveTime
 
@@ -207,11 +295,53 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			"old_runnerreplicasets_count", oldSetsCount,
 		)
 
+		if remaining, ok := drainDeadlineRemaining(rd, time.Now()); ok && remaining <= 0 {
+			if err := r.forceCompleteDrain(ctx, logWithDebugInfo, rd, oldSets, time.Now()); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			return r.updateStatus(ctx, log, rd, newestSet, nil, newDesiredReplicas)
+		}
+
+		if rd.Spec.RollingUpdate != nil {
+			drained, err := r.rollOutRunnerReplicaSets(ctx, logWithDebugInfo, rd, newestSet, oldSets, newDesiredReplicas)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+
+			if !drained {
+				if _, err := r.updateStatus(ctx, log, rd, newestSet, oldSets, newDesiredReplicas); err != nil {
+					return ctrl.Result{}, err
+				}
+
+				return ctrl.Result{RequeueAfter: rollingUpdateRetryDelay}, nil
+			}
+
+			return r.updateStatus(ctx, log, rd, newestSet, oldSets, newDesiredReplicas)
+		}
+
+		if rd.Spec.MinReadyRunners != nil {
+			drained, err := r.drainOldRunnerReplicaSets(ctx, logWithDebugInfo, rd, newestSet, oldSets, *rd.Spec.MinReadyRunners, currentDesiredReplicas)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+
+			if !drained {
+				if _, err := r.updateStatus(ctx, log, rd, newestSet, oldSets, newDesiredReplicas); err != nil {
+					return ctrl.Result{}, err
+				}
+
+				return ctrl.Result{RequeueAfter: minReadyRunnersRetryDelay}, nil
+			}
+
+			return r.updateStatus(ctx, log, rd, newestSet, oldSets, newDesiredReplicas)
+		}
+
 		if readyReplicas < currentDesiredReplicas {
 			logWithDebugInfo.
 				Info("Waiting until the newest runnerreplicaset to be 100% available")
 
-			return ctrl.Result{}, nil
+			return withDrainDeadline(ctrl.Result{}, rd, time.Now()), nil
 		}
 
 		if oldSetsCount > 0 {
@@ -222,6 +352,12 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		for i := range oldSets {
 			rs := oldSets[i]
 
+			if err := annotateRunnerReplicaSetRunners(ctx, r.Client, rs, UnregistrationReasonRollingUpdate); err != nil {
+				log.Error(err, "Failed to annotate runners of old runnerreplicaset with the unregistration reason", "runnerreplicaset", rs.Name)
+
+				return ctrl.Result{}, err
+			}
+
 			if err := r.Client.Delete(ctx, &rs); err != nil {
 				log.Error(err, "Failed to delete runnerreplicaset resource")
 
@@ -232,11 +368,69 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 			log.Info("Deleted runnerreplicaset", "runnerdeployment", rd.ObjectMeta.Name, "runnerreplicaset", rs.Name)
 		}
+
+		return r.updateStatus(ctx, log, rd, newestSet, oldSets, newDesiredReplicas)
 	}
 
+	// Runners of the old runner replica sets are replaced anyway, so we recycle aged runners only once the rollout has completed.
+	recycleDelay, err := r.recycleAgedRunners(ctx, log, rd, newestSet, newDesiredReplicas, time.Now())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	res, err := r.updateStatus(ctx, log, rd, newestSet, oldSets, newDesiredReplicas)
+	if err != nil || recycleDelay <= 0 {
+		return res, err
+	}
+
+	if res.IsZero() || res.RequeueAfter > recycleDelay {
+		res = ctrl.Result{RequeueAfter: recycleDelay}
+	}
+
+	return res, nil
+}
+
+// processRunnerDeploymentDeletion discards the registration token for the runners of the runnerdeployment and removes the finalizer.
+//
+// The runners themselves are unregistered by the runner controller, as they are garbage-collected along with the runnerdeployment
+// and each runner has its own finalizer for that. We don't wait for that here, because dependents are not deleted
+// until the owner is gone in case of the background cascading deletion.
+func (r *RunnerDeploymentReconciler) processRunnerDeploymentDeletion(ctx context.Context, rd v1alpha1.RunnerDeployment, log logr.Logger) (ctrl.Result, error) {
+	finalizers, removed := removeFinalizer(rd.ObjectMeta.Finalizers, runnerDeploymentFinalizerName)
+	if !removed {
+		return ctrl.Result{}, nil
+	}
+
+	if r.GitHubClient != nil {
+		spec := rd.Spec.Template.Spec
+
+		// Other runnerdeployments for the same scope may share the token.
+		// That's fine because GetRegistrationToken creates a new one for them on the next call.
+		//
+		// This never fails, so that the runnerdeployment can be deleted even after its credentials are gone,
+		// e.g. when the secret is deleted before the runnerdeployment on the namespace deletion.
+		if r.GitHubClient.DiscardRegistrationToken(&v1alpha1.Runner{ObjectMeta: metav1.ObjectMeta{Namespace: rd.Namespace}, Spec: spec}) {
+			log.Info("Discarded registration token", "enterprise", spec.Enterprise, "organization", spec.Organization, "repository", spec.Repository)
+		}
+	}
+
+	newRD := rd.DeepCopy()
+	newRD.ObjectMeta.Finalizers = finalizers
+
+	if err := r.Patch(ctx, newRD, client.MergeFrom(&rd)); err != nil {
+		log.Error(err, "Failed to remove finalizer from runnerdeployment")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *RunnerDeploymentReconciler) updateStatus(ctx context.Context, log logr.Logger, rd v1alpha1.RunnerDeployment, newestSet *v1alpha1.RunnerReplicaSet, oldSets []v1alpha1.RunnerReplicaSet, desiredReplicas int) (ctrl.Result, error) {
 	var replicaSets []v1alpha1.RunnerReplicaSet
 
-	replicaSets = append(replicaSets, *newestSet)
+	if newestSet != nil {
+		replicaSets = append(replicaSets, *newestSet)
+	}
 	replicaSets = append(replicaSets, oldSets...)
 
 	var totalCurrentReplicas, totalStatusAvailableReplicas, updatedReplicas int
@@ -256,7 +450,7 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		totalStatusAvailableReplicas += available
 	}
 
-	if newestSet.Status.Replicas != nil {
+	if newestSet != nil && newestSet.Status.Replicas != nil {
 		updatedReplicas = *newestSet.Status.Replicas
 	}
 
@@ -264,9 +458,17 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 
 	status.AvailableReplicas = &totalStatusAvailableReplicas
 	status.ReadyReplicas = &totalStatusAvailableReplicas
-	status.DesiredReplicas = &newDesiredReplicas
+	status.DesiredReplicas = &desiredReplicas
 	status.Replicas = &totalCurrentReplicas
 	status.UpdatedReplicas = &updatedReplicas
+	status.DrainStartTime = drainStartTime(rd, oldSets, time.Now())
+
+	if newestSet != nil && credentialsSecretName(&rd) != "" {
+		status.ObservedSecretVersion = newestSet.Spec.Template.ObjectMeta.Annotations[AnnotationKeySecretVersion]
+	}
+
+	status.Conditions = append([]metav1.Condition(nil), rd.Status.Conditions...)
+	meta.SetStatusCondition(&status.Conditions, runnerDeploymentPausedCondition(rd))
 
 	if !reflect.DeepEqual(rd.Status, status) {
 		updated := rd.DeepCopy()
@@ -283,6 +485,24 @@ func (r *RunnerDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	return ctrl.Result{}, nil
 }
 
+func runnerDeploymentPausedCondition(rd v1alpha1.RunnerDeployment) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               v1alpha1.RunnerDeploymentConditionPaused,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Resumed",
+		Message:            "Runners are scaled and recreated as usual",
+		ObservedGeneration: rd.Generation,
+	}
+
+	if rd.Spec.Paused {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "Paused"
+		cond.Message = "Runners are neither scaled nor recreated until spec.paused is unset"
+	}
+
+	return cond
+}
+
 func getIntOrDefault(p *int, d int) int {
 	if p == nil {
 		return d
@@ -422,6 +642,7 @@ func newRunnerReplicaSet(rd *v1alpha1.RunnerDeployment, commonRunnerLabels []str
 			Selector:      newRSSelector,
 			Template:      newRSTemplate,
 			EffectiveTime: rd.Spec.EffectiveTime,
+			Paused:        rd.Spec.Paused,
 		},
 	}
 
@@ -459,6 +680,10 @@ func (r *RunnerDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.RunnerDeployment{}).
 		Owns(&v1alpha1.RunnerReplicaSet{}).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(runnerDeploymentsForSecret(mgr.GetClient(), r.Log)),
+		).
 		Named(name).
 		Complete(r)
 }
@@ -3,11 +3,18 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/google/go-cmp/cmp"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -21,6 +28,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	actionsv1alpha1 "github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
 )
 
 func TestNewRunnerReplicaSet(t *testing.T) {
@@ -122,12 +131,1190 @@ func TestNewRunnerReplicaSet(t *testing.T) {
 	}
 }
 
+func TestRunnerDeploymentReconciler_Paused(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := actionsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	newDeployment := func(paused bool) *actionsv1alpha1.RunnerDeployment {
+		return &actionsv1alpha1.RunnerDeployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "example",
+			},
+			Spec: actionsv1alpha1.RunnerDeploymentSpec{
+				Replicas: intPtr(3),
+				Paused:   paused,
+				Template: actionsv1alpha1.RunnerTemplate{
+					Spec: actionsv1alpha1.RunnerSpec{
+						RunnerConfig: actionsv1alpha1.RunnerConfig{
+							Repository: "test/valid",
+						},
+					},
+				},
+			},
+		}
+	}
+
+	reconcile := func(t *testing.T, objs ...client.Object) client.Client {
+		t.Helper()
+
+		c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+		r := &RunnerDeploymentReconciler{
+			Client:   c,
+			Log:      logr.Discard(),
+			Recorder: record.NewFakeRecorder(10),
+			Scheme:   scheme,
+		}
+
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "example"}}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+
+		return c
+	}
+
+	assertPausedCondition := func(t *testing.T, c client.Client, want metav1.ConditionStatus) {
+		t.Helper()
+
+		var rd actionsv1alpha1.RunnerDeployment
+		if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "example"}, &rd); err != nil {
+			t.Fatal(err)
+		}
+
+		cond := meta.FindStatusCondition(rd.Status.Conditions, actionsv1alpha1.RunnerDeploymentConditionPaused)
+		if cond == nil {
+			t.Fatalf("missing %s condition", actionsv1alpha1.RunnerDeploymentConditionPaused)
+		}
+		if cond.Status != want {
+			t.Errorf("unexpected %s condition status: got %s, want %s", cond.Type, cond.Status, want)
+		}
+	}
+
+	t.Run("no runnerreplicaset is created while paused", func(t *testing.T) {
+		c := reconcile(t, newDeployment(true))
+
+		var rsList actionsv1alpha1.RunnerReplicaSetList
+		if err := c.List(context.Background(), &rsList); err != nil {
+			t.Fatal(err)
+		}
+		if len(rsList.Items) != 0 {
+			t.Errorf("unexpected number of runnerreplicasets: got %d, want 0", len(rsList.Items))
+		}
+
+		assertPausedCondition(t, c, metav1.ConditionTrue)
+	})
+
+	t.Run("existing runnerreplicaset is paused and not scaled", func(t *testing.T) {
+		unpaused := newDeployment(false)
+		unpaused.Spec.Replicas = intPtr(1)
+
+		rs, err := newRunnerReplicaSet(unpaused, nil, scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Name = "example-abcde"
+
+		c := reconcile(t, newDeployment(true), rs)
+
+		var got actionsv1alpha1.RunnerReplicaSet
+		if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: rs.Name}, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !got.Spec.Paused {
+			t.Errorf("expected the runnerreplicaset to be paused")
+		}
+		if r := getIntOrDefault(got.Spec.Replicas, 1); r != 1 {
+			t.Errorf("unexpected replicas of the paused runnerreplicaset: got %d, want 1", r)
+		}
+
+		assertPausedCondition(t, c, metav1.ConditionTrue)
+	})
+
+	t.Run("runnerreplicaset is created once resumed", func(t *testing.T) {
+		c := reconcile(t, newDeployment(false))
+
+		var rsList actionsv1alpha1.RunnerReplicaSetList
+		if err := c.List(context.Background(), &rsList); err != nil {
+			t.Fatal(err)
+		}
+		if len(rsList.Items) != 1 {
+			t.Fatalf("unexpected number of runnerreplicasets: got %d, want 1", len(rsList.Items))
+		}
+		if rsList.Items[0].Spec.Paused {
+			t.Errorf("expected the runnerreplicaset not to be paused")
+		}
+	})
+}
+
+func TestRunnerDeploymentReconciler_MinReadyRunners(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := actionsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	newDeployment := func(minReadyRunners int, labels ...string) *actionsv1alpha1.RunnerDeployment {
+		return &actionsv1alpha1.RunnerDeployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "example",
+			},
+			Spec: actionsv1alpha1.RunnerDeploymentSpec{
+				Replicas:        intPtr(3),
+				MinReadyRunners: intPtr(minReadyRunners),
+				Template: actionsv1alpha1.RunnerTemplate{
+					Spec: actionsv1alpha1.RunnerSpec{
+						RunnerConfig: actionsv1alpha1.RunnerConfig{
+							Repository: "test/valid",
+							Labels:     labels,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		minReadyRunners int
+		newestReady     int
+		oldReplicas     int
+		oldCurrent      int
+		oldReady        int
+
+		wantOldReplicas  int
+		wantOldDeleted   bool
+		wantRequeueAfter time.Duration
+	}{
+		{
+			name:             "stops old runners down to the floor",
+			minReadyRunners:  2,
+			oldReplicas:      3,
+			oldCurrent:       3,
+			oldReady:         3,
+			wantOldReplicas:  2,
+			wantRequeueAfter: minReadyRunnersRetryDelay,
+		},
+		{
+			name:             "waits at the floor while old runners are still being stopped",
+			minReadyRunners:  2,
+			oldReplicas:      2,
+			oldCurrent:       3,
+			oldReady:         3,
+			wantOldReplicas:  2,
+			wantRequeueAfter: minReadyRunnersRetryDelay,
+		},
+		{
+			name:             "stops more old runners as new runners become ready",
+			minReadyRunners:  2,
+			newestReady:      1,
+			oldReplicas:      2,
+			oldCurrent:       2,
+			oldReady:         2,
+			wantOldReplicas:  1,
+			wantRequeueAfter: minReadyRunnersRetryDelay,
+		},
+		{
+			name:             "floor is capped at the desired replicas",
+			minReadyRunners:  5,
+			newestReady:      1,
+			oldReplicas:      3,
+			oldCurrent:       3,
+			oldReady:         3,
+			wantOldReplicas:  2,
+			wantRequeueAfter: minReadyRunnersRetryDelay,
+		},
+		{
+			name:            "deletes old runnerreplicaset without runners",
+			minReadyRunners: 2,
+			newestReady:     3,
+			wantOldDeleted:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rd := newDeployment(tt.minReadyRunners)
+
+			newest, err := newRunnerReplicaSet(rd, nil, scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			newest.Name = "example-new"
+			newest.CreationTimestamp = metav1.NewTime(time.Now())
+			newest.Status.ReadyReplicas = intPtr(tt.newestReady)
+
+			old, err := newRunnerReplicaSet(newDeployment(tt.minReadyRunners, "old"), nil, scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			old.Name = "example-old"
+			old.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+			old.Spec.Replicas = intPtr(tt.oldReplicas)
+			old.Status.Replicas = intPtr(tt.oldCurrent)
+			old.Status.ReadyReplicas = intPtr(tt.oldReady)
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(rd, newest, old).Build()
+
+			r := &RunnerDeploymentReconciler{
+				Client:   c,
+				Log:      logr.Discard(),
+				Recorder: record.NewFakeRecorder(10),
+				Scheme:   scheme,
+			}
+
+			res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "example"}})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if res.RequeueAfter != tt.wantRequeueAfter {
+				t.Errorf("unexpected RequeueAfter: got %v, want %v", res.RequeueAfter, tt.wantRequeueAfter)
+			}
+
+			var got actionsv1alpha1.RunnerReplicaSet
+			err = c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: old.Name}, &got)
+			if tt.wantOldDeleted {
+				if !kerrors.IsNotFound(err) {
+					t.Errorf("expected the old runnerreplicaset to be deleted, got error %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r := getIntOrDefault(got.Spec.Replicas, 1); r != tt.wantOldReplicas {
+				t.Errorf("unexpected replicas of the old runnerreplicaset: got %d, want %d", r, tt.wantOldReplicas)
+			}
+		})
+	}
+}
+
+func TestRunnerDeploymentReconciler_RollingUpdate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := actionsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	newDeployment := func(rollingUpdate *actionsv1alpha1.RunnerDeploymentRollingUpdate, labels ...string) *actionsv1alpha1.RunnerDeployment {
+		return &actionsv1alpha1.RunnerDeployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "example",
+			},
+			Spec: actionsv1alpha1.RunnerDeploymentSpec{
+				Replicas:      intPtr(4),
+				RollingUpdate: rollingUpdate,
+				Template: actionsv1alpha1.RunnerTemplate{
+					Spec: actionsv1alpha1.RunnerSpec{
+						RunnerConfig: actionsv1alpha1.RunnerConfig{
+							Repository: "test/valid",
+							Labels:     labels,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	intOrStr := func(v intstr.IntOrString) *intstr.IntOrString {
+		return &v
+	}
+
+	tests := []struct {
+		name          string
+		rollingUpdate *actionsv1alpha1.RunnerDeploymentRollingUpdate
+		// busyOldRunners is the number of old runners that keep running jobs for the first few steps,
+		// during which they don't stop even when their runnerreplicaset is scaled down.
+		busyOldRunners int
+
+		wantInitialReplicas int
+		maxTotal            int
+		minReady            int
+	}{
+		{
+			name:                "surge",
+			rollingUpdate:       &actionsv1alpha1.RunnerDeploymentRollingUpdate{MaxSurge: intOrStr(intstr.FromInt(1))},
+			wantInitialReplicas: 1,
+			maxTotal:            5,
+			minReady:            4,
+		},
+		{
+			name:                "unavailable",
+			rollingUpdate:       &actionsv1alpha1.RunnerDeploymentRollingUpdate{MaxSurge: intOrStr(intstr.FromInt(0)), MaxUnavailable: intOrStr(intstr.FromString("50%"))},
+			wantInitialReplicas: 0,
+			maxTotal:            4,
+			minReady:            2,
+		},
+		{
+			name:                "defaults",
+			rollingUpdate:       &actionsv1alpha1.RunnerDeploymentRollingUpdate{},
+			wantInitialReplicas: 1,
+			maxTotal:            5,
+			minReady:            4,
+		},
+		{
+			name:                "busy old runners",
+			rollingUpdate:       &actionsv1alpha1.RunnerDeploymentRollingUpdate{MaxSurge: intOrStr(intstr.FromInt(1))},
+			busyOldRunners:      2,
+			wantInitialReplicas: 1,
+			maxTotal:            5,
+			minReady:            4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			rd := newDeployment(tt.rollingUpdate)
+
+			old, err := newRunnerReplicaSet(newDeployment(tt.rollingUpdate, "old"), nil, scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			old.Name = "example-old"
+			old.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+			old.Status.Replicas = intPtr(4)
+			old.Status.ReadyReplicas = intPtr(4)
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(rd, old).Build()
+
+			r := &RunnerDeploymentReconciler{
+				Client:   c,
+				Log:      logr.Discard(),
+				Recorder: record.NewFakeRecorder(100),
+				Scheme:   scheme,
+			}
+
+			list := func() []actionsv1alpha1.RunnerReplicaSet {
+				t.Helper()
+
+				var rsList actionsv1alpha1.RunnerReplicaSetList
+				if err := c.List(ctx, &rsList); err != nil {
+					t.Fatal(err)
+				}
+
+				return rsList.Items
+			}
+
+			reconcile := func() ctrl.Result {
+				t.Helper()
+
+				res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "example"}})
+				if err != nil {
+					t.Fatalf("Reconcile() error = %v", err)
+				}
+
+				// The fake client doesn't set the creation timestamp the reconciler relies on to find the newest runnerreplicaset.
+				for _, rs := range list() {
+					if rs.CreationTimestamp.IsZero() {
+						rs.CreationTimestamp = metav1.NewTime(time.Now())
+						if err := c.Update(ctx, &rs); err != nil {
+							t.Fatal(err)
+						}
+					}
+				}
+
+				return res
+			}
+
+			reconcile()
+
+			var newestName string
+			for _, rs := range list() {
+				if rs.Name != old.Name {
+					newestName = rs.Name
+					if got := getIntOrDefault(rs.Spec.Replicas, 1); got != tt.wantInitialReplicas {
+						t.Errorf("unexpected initial replicas of the new runnerreplicaset: got %d, want %d", got, tt.wantInitialReplicas)
+					}
+				}
+			}
+			if newestName == "" {
+				t.Fatal("expected a new runnerreplicaset to be created")
+			}
+
+			busy := tt.busyOldRunners
+
+			for step := 0; ; step++ {
+				if step > 20 {
+					t.Fatal("rolling update didn't complete")
+				}
+
+				// Emulate the runnerreplicaset controller, where runners become ready immediately
+				// and busy old runners don't stop until they finish their jobs.
+				var total, ready int
+				for _, rs := range list() {
+					replicas := getIntOrDefault(rs.Spec.Replicas, 1)
+					current := replicas
+					if rs.Name == old.Name && step < 3 && current < busy {
+						current = busy
+					}
+
+					rs.Status.Replicas = intPtr(current)
+					rs.Status.ReadyReplicas = intPtr(current)
+					if err := c.Update(ctx, &rs); err != nil {
+						t.Fatal(err)
+					}
+
+					total += current
+					ready += current
+				}
+
+				if total > tt.maxTotal {
+					t.Errorf("step %d: too many runners: got %d, want at most %d", step, total, tt.maxTotal)
+				}
+				if ready < tt.minReady {
+					t.Errorf("step %d: too few ready runners: got %d, want at least %d", step, ready, tt.minReady)
+				}
+
+				res := reconcile()
+
+				sets := list()
+
+				for _, rs := range sets {
+					if rs.Name == old.Name && getIntOrDefault(rs.Spec.Replicas, 1) < 4 {
+						if got := rs.Annotations[AnnotationKeyUnregistrationReason]; got != string(UnregistrationReasonRollingUpdate) {
+							t.Errorf("step %d: unexpected unregistration reason of the old runnerreplicaset: got %q, want %q", step, got, UnregistrationReasonRollingUpdate)
+						}
+					}
+				}
+				if len(sets) == 1 && sets[0].Name == newestName {
+					if got := getIntOrDefault(sets[0].Spec.Replicas, 1); got != 4 {
+						t.Errorf("unexpected replicas of the new runnerreplicaset after the rolling update: got %d, want 4", got)
+					}
+					break
+				}
+
+				if res.RequeueAfter != rollingUpdateRetryDelay {
+					t.Errorf("step %d: unexpected RequeueAfter: got %v, want %v", step, res.RequeueAfter, rollingUpdateRetryDelay)
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerDeploymentReconciler_DrainOnSecretRotation(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := actionsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "example"}
+
+	rd := &actionsv1alpha1.RunnerDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: key.Namespace,
+			Name:      key.Name,
+		},
+		Spec: actionsv1alpha1.RunnerDeploymentSpec{
+			Replicas:              intPtr(2),
+			DrainOnSecretRotation: true,
+			Template: actionsv1alpha1.RunnerTemplate{
+				Spec: actionsv1alpha1.RunnerSpec{
+					RunnerConfig: actionsv1alpha1.RunnerConfig{
+						Repository: "test/valid",
+						GitHubAPICredentialsFrom: &actionsv1alpha1.GitHubAPICredentialsFrom{
+							SecretRef: actionsv1alpha1.SecretReference{Name: "creds"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: "creds"},
+		Data:       map[string][]byte{"github_token": []byte("old")},
+	}
+
+	unrelated := rd.DeepCopy()
+	unrelated.Name = "unrelated"
+	unrelated.Spec.DrainOnSecretRotation = false
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(rd, unrelated, secret).Build()
+
+	r := &RunnerDeploymentReconciler{
+		Client:   c,
+		Log:      logr.Discard(),
+		Recorder: record.NewFakeRecorder(100),
+		Scheme:   scheme,
+	}
+
+	if got := runnerDeploymentsForSecret(c, logr.Discard())(secret); len(got) != 1 || got[0].NamespacedName != key {
+		t.Errorf("unexpected requests for the secret: %v", got)
+	}
+
+	list := func() []actionsv1alpha1.RunnerReplicaSet {
+		t.Helper()
+
+		var rsList actionsv1alpha1.RunnerReplicaSetList
+		if err := c.List(ctx, &rsList); err != nil {
+			t.Fatal(err)
+		}
+
+		return rsList.Items
+	}
+
+	reconcile := func() {
+		t.Helper()
+
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+
+		// The fake client doesn't set the creation timestamp the reconciler relies on to find the newest runnerreplicaset,
+		// and runners become ready immediately.
+		for i, rs := range list() {
+			if rs.CreationTimestamp.IsZero() {
+				rs.CreationTimestamp = metav1.NewTime(time.Now().Add(time.Duration(i) * time.Second))
+			}
+			rs.Status.Replicas = rs.Spec.Replicas
+			rs.Status.ReadyReplicas = rs.Spec.Replicas
+			rs.Status.AvailableReplicas = rs.Spec.Replicas
+			if err := c.Update(ctx, &rs); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	observedSecretVersion := func() string {
+		t.Helper()
+
+		var got actionsv1alpha1.RunnerDeployment
+		if err := c.Get(ctx, key, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		return got.Status.ObservedSecretVersion
+	}
+
+	reconcile()
+	reconcile()
+
+	sets := list()
+	if len(sets) != 1 {
+		t.Fatalf("unexpected number of runnerreplicasets: got %d, want 1", len(sets))
+	}
+
+	oldName := sets[0].Name
+	oldVersion := sets[0].Spec.Template.ObjectMeta.Annotations[AnnotationKeySecretVersion]
+	if oldVersion == "" {
+		t.Fatalf("expected the %s annotation on the runner template", AnnotationKeySecretVersion)
+	}
+
+	if got := observedSecretVersion(); got != oldVersion {
+		t.Errorf("unexpected observed secret version: got %q, want %q", got, oldVersion)
+	}
+
+	// Reconciling without rotating the secret must not replace the runners.
+	reconcile()
+	if sets := list(); len(sets) != 1 || sets[0].Name != oldName {
+		t.Fatalf("unexpected runnerreplicasets without the secret rotation: %v", sets)
+	}
+
+	secret.Data["github_token"] = []byte("new")
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	reconcile()
+
+	sets = list()
+	if len(sets) != 2 {
+		t.Fatalf("unexpected number of runnerreplicasets after the secret rotation: got %d, want 2", len(sets))
+	}
+
+	var newVersion string
+	for _, rs := range sets {
+		if rs.Name != oldName {
+			newVersion = rs.Spec.Template.ObjectMeta.Annotations[AnnotationKeySecretVersion]
+		}
+	}
+	if newVersion == "" || newVersion == oldVersion {
+		t.Fatalf("unexpected secret version of the new runnerreplicaset: got %q, old %q", newVersion, oldVersion)
+	}
+
+	// The old runners are drained once the new runners are ready.
+	reconcile()
+
+	sets = list()
+	if len(sets) != 1 || sets[0].Name == oldName {
+		t.Fatalf("expected only the new runnerreplicaset to remain: %v", sets)
+	}
+
+	if got := observedSecretVersion(); got != newVersion {
+		t.Errorf("unexpected observed secret version: got %q, want %q", got, newVersion)
+	}
+}
+
+func TestRunnerDeploymentReconciler_MaxRunnerAge(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := actionsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	const maxRunnerAge = 24 * time.Hour
+
+	tests := []struct {
+		name            string
+		minReadyRunners *int
+		podAges         []time.Duration
+		recycling       []bool
+
+		wantRecycled     []bool
+		wantRequeueAfter time.Duration
+	}{
+		{
+			name:             "requeues until the oldest runner exceeds the age",
+			podAges:          []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour},
+			wantRecycled:     []bool{false, false, false},
+			wantRequeueAfter: 21 * time.Hour,
+		},
+		{
+			name:             "recycles one runner at a time without minReadyRunners",
+			podAges:          []time.Duration{25 * time.Hour, 26 * time.Hour, time.Hour},
+			wantRecycled:     []bool{false, true, false},
+			wantRequeueAfter: minReadyRunnersRetryDelay,
+		},
+		{
+			name:             "recycles runners down to minReadyRunners",
+			minReadyRunners:  intPtr(1),
+			podAges:          []time.Duration{25 * time.Hour, 26 * time.Hour, time.Hour},
+			wantRecycled:     []bool{true, true, false},
+			wantRequeueAfter: 23 * time.Hour,
+		},
+		{
+			name:             "waits for the runners being recycled",
+			podAges:          []time.Duration{25 * time.Hour, 26 * time.Hour, time.Hour},
+			recycling:        []bool{false, true, false},
+			wantRecycled:     []bool{false, true, false},
+			wantRequeueAfter: minReadyRunnersRetryDelay,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+
+			rd := &actionsv1alpha1.RunnerDeployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "example",
+				},
+				Spec: actionsv1alpha1.RunnerDeploymentSpec{
+					Replicas:        intPtr(len(tt.podAges)),
+					MinReadyRunners: tt.minReadyRunners,
+					MaxRunnerAge:    &metav1.Duration{Duration: maxRunnerAge},
+					Template: actionsv1alpha1.RunnerTemplate{
+						Spec: actionsv1alpha1.RunnerSpec{
+							RunnerConfig: actionsv1alpha1.RunnerConfig{
+								Repository: "test/valid",
+							},
+						},
+					},
+				},
+			}
+
+			rs, err := newRunnerReplicaSet(rd, nil, scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Name = "example-abc"
+			rs.UID = "example-abc-uid"
+			rs.CreationTimestamp = metav1.NewTime(now.Add(-48 * time.Hour))
+
+			objs := []client.Object{rd, rs}
+
+			for i, age := range tt.podAges {
+				name := fmt.Sprintf("example-abc-%d", i)
+
+				runner := &actionsv1alpha1.Runner{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      name,
+						Labels:    rs.Spec.Template.ObjectMeta.Labels,
+					},
+					Status: actionsv1alpha1.RunnerStatus{
+						Phase: string(corev1.PodRunning),
+					},
+				}
+				if err := ctrl.SetControllerReference(rs, runner, scheme); err != nil {
+					t.Fatal(err)
+				}
+
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace:         "default",
+						Name:              name,
+						CreationTimestamp: metav1.NewTime(now.Add(-age)),
+					},
+				}
+				if tt.recycling != nil && tt.recycling[i] {
+					pod.Annotations = map[string]string{AnnotationKeyRecycle: now.Format(time.RFC3339)}
+				}
+
+				objs = append(objs, runner, pod)
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+			r := &RunnerDeploymentReconciler{
+				Client:   c,
+				Log:      logr.Discard(),
+				Recorder: record.NewFakeRecorder(10),
+				Scheme:   scheme,
+			}
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "example"}})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			// The requeue delays are measured from the time of the reconciliation slightly after now.
+			if d := tt.wantRequeueAfter - res.RequeueAfter; d < 0 || d > time.Minute {
+				t.Errorf("unexpected RequeueAfter: got %v, want %v", res.RequeueAfter, tt.wantRequeueAfter)
+			}
+
+			for i := range tt.podAges {
+				var pod corev1.Pod
+				if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: fmt.Sprintf("example-abc-%d", i)}, &pod); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, recycled := pod.Annotations[AnnotationKeyRecycle]; recycled != tt.wantRecycled[i] {
+					t.Errorf("unexpected recycling of pod %s: got %v, want %v", pod.Name, recycled, tt.wantRecycled[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerDeploymentReconciler_MaxDrainDuration(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := actionsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	const maxDrainDuration = time.Hour
+
+	newDeployment := func(labels ...string) *actionsv1alpha1.RunnerDeployment {
+		return &actionsv1alpha1.RunnerDeployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "example",
+			},
+			Spec: actionsv1alpha1.RunnerDeploymentSpec{
+				Replicas:         intPtr(2),
+				MaxDrainDuration: &metav1.Duration{Duration: maxDrainDuration},
+				Template: actionsv1alpha1.RunnerTemplate{
+					Spec: actionsv1alpha1.RunnerSpec{
+						RunnerConfig: actionsv1alpha1.RunnerConfig{
+							Repository: "test/valid",
+							Labels:     labels,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		drainStart time.Duration
+
+		wantForced       bool
+		wantRequeueAfter time.Duration
+	}{
+		{
+			name:             "waits for the old runners until the deadline",
+			drainStart:       10 * time.Minute,
+			wantRequeueAfter: 50 * time.Minute,
+		},
+		{
+			name:       "forces the old runners to stop past the deadline",
+			drainStart: 2 * time.Hour,
+			wantForced: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+
+			rd := newDeployment()
+			rd.Status.DrainStartTime = &metav1.Time{Time: now.Add(-tt.drainStart)}
+
+			newest, err := newRunnerReplicaSet(rd, nil, scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			newest.Name = "example-new"
+			newest.UID = "example-new-uid"
+			newest.CreationTimestamp = metav1.NewTime(now.Add(-tt.drainStart))
+
+			old, err := newRunnerReplicaSet(newDeployment("old"), nil, scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			old.Name = "example-old"
+			old.UID = "example-old-uid"
+			old.CreationTimestamp = metav1.NewTime(now.Add(-48 * time.Hour))
+
+			objs := []client.Object{rd, newest, old}
+
+			// One of the old runners has been already stopping, waiting for the job to complete.
+			for i, deleting := range []bool{false, true} {
+				runner := &actionsv1alpha1.Runner{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      fmt.Sprintf("example-old-%d", i),
+						Labels:    old.Spec.Template.ObjectMeta.Labels,
+					},
+				}
+				if deleting {
+					runner.Finalizers = []string{finalizerName}
+					runner.DeletionTimestamp = &metav1.Time{Time: now}
+				}
+				if err := ctrl.SetControllerReference(old, runner, scheme); err != nil {
+					t.Fatal(err)
+				}
+
+				objs = append(objs, runner)
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+			recorder := record.NewFakeRecorder(10)
+
+			r := &RunnerDeploymentReconciler{
+				Client:   c,
+				Log:      logr.Discard(),
+				Recorder: recorder,
+				Scheme:   scheme,
+			}
+
+			res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "example"}})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if d := tt.wantRequeueAfter - res.RequeueAfter; d < 0 || d > time.Minute {
+				t.Errorf("unexpected RequeueAfter: got %v, want %v", res.RequeueAfter, tt.wantRequeueAfter)
+			}
+
+			var oldSet actionsv1alpha1.RunnerReplicaSet
+			err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: old.Name}, &oldSet)
+			if deleted := kerrors.IsNotFound(err); deleted != tt.wantForced {
+				t.Errorf("unexpected deletion of the old runnerreplicaset: got %v, want %v (error: %v)", deleted, tt.wantForced, err)
+			}
+
+			for i := 0; i < 2; i++ {
+				var runner actionsv1alpha1.Runner
+				if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: fmt.Sprintf("example-old-%d", i)}, &runner); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, forced := runner.Annotations[AnnotationKeyForceStop]; forced != tt.wantForced {
+					t.Errorf("unexpected forced stop of runner %s: got %v, want %v", runner.Name, forced, tt.wantForced)
+				}
+			}
+
+			var updated actionsv1alpha1.RunnerDeployment
+			if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "example"}, &updated); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantForced {
+				if updated.Status.DrainStartTime != nil {
+					t.Errorf("expected the drain start time to be unset after the forced drain, got %v", updated.Status.DrainStartTime)
+				}
+
+				select {
+				case e := <-recorder.Events:
+					if !strings.Contains(e, "DrainDeadlineExceeded") {
+						t.Errorf("unexpected event: %s", e)
+					}
+				default:
+					t.Errorf("expected the forced drain to be recorded as an event")
+				}
+			} else if updated.Status.DrainStartTime == nil || !updated.Status.DrainStartTime.Time.Equal(rd.Status.DrainStartTime.Rfc3339Copy().Time) {
+				t.Errorf("expected the drain start time to be kept, got %v", updated.Status.DrainStartTime)
+			}
+		})
+	}
+}
+
+func TestRunnerDeploymentReconciler_RollingUpdateWithLaggingStatus(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := actionsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	maxUnavailable := intstr.FromInt(1)
+	maxSurge := intstr.FromInt(0)
+
+	rd := actionsv1alpha1.RunnerDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "example",
+		},
+		Spec: actionsv1alpha1.RunnerDeploymentSpec{
+			Replicas:      intPtr(4),
+			RollingUpdate: &actionsv1alpha1.RunnerDeploymentRollingUpdate{MaxSurge: &maxSurge, MaxUnavailable: &maxUnavailable},
+		},
+	}
+
+	newest := &actionsv1alpha1.RunnerReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-new"},
+		Spec:       actionsv1alpha1.RunnerReplicaSetSpec{Replicas: intPtr(2)},
+		Status:     actionsv1alpha1.RunnerReplicaSetStatus{Replicas: intPtr(2), ReadyReplicas: intPtr(2)},
+	}
+
+	// The old set has just been scaled down from 4 to 2, but its status still counts the runners being stopped as ready.
+	old := actionsv1alpha1.RunnerReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-old"},
+		Spec:       actionsv1alpha1.RunnerReplicaSetSpec{Replicas: intPtr(2)},
+		Status:     actionsv1alpha1.RunnerReplicaSetStatus{Replicas: intPtr(2), ReadyReplicas: intPtr(4)},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(newest, &old).Build()
+
+	r := &RunnerDeploymentReconciler{
+		Client:   c,
+		Log:      logr.Discard(),
+		Recorder: record.NewFakeRecorder(10),
+		Scheme:   scheme,
+	}
+
+	ctx := context.Background()
+
+	if _, err := r.rollOutRunnerReplicaSets(ctx, logr.Discard(), rd, newest, []actionsv1alpha1.RunnerReplicaSet{old}, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	var updated actionsv1alpha1.RunnerReplicaSet
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "example-old"}, &updated); err != nil {
+		t.Fatal(err)
+	}
+
+	// 4 runners are available, so only one of them can be stopped without going below 3.
+	if got := getIntOrDefault(updated.Spec.Replicas, 1); got != 1 {
+		t.Errorf("unexpected replicas of the old runnerreplicaset: got %d, want 1", got)
+	}
+}
+
+func TestRollingUpdateLimits(t *testing.T) {
+	intOrStr := func(v intstr.IntOrString) *intstr.IntOrString {
+		return &v
+	}
+
+	tests := []struct {
+		name               string
+		rollingUpdate      actionsv1alpha1.RunnerDeploymentRollingUpdate
+		desired            int
+		wantMaxSurge       int
+		wantMaxUnavailable int
+		wantErr            bool
+	}{
+		{
+			name:         "defaults",
+			desired:      10,
+			wantMaxSurge: 3,
+		},
+		{
+			name:               "percentages",
+			rollingUpdate:      actionsv1alpha1.RunnerDeploymentRollingUpdate{MaxSurge: intOrStr(intstr.FromString("10%")), MaxUnavailable: intOrStr(intstr.FromString("15%"))},
+			desired:            10,
+			wantMaxSurge:       1,
+			wantMaxUnavailable: 1,
+		},
+		{
+			name:          "both zero",
+			rollingUpdate: actionsv1alpha1.RunnerDeploymentRollingUpdate{MaxSurge: intOrStr(intstr.FromInt(0))},
+			desired:       10,
+			wantMaxSurge:  1,
+		},
+		{
+			name:          "invalid",
+			rollingUpdate: actionsv1alpha1.RunnerDeploymentRollingUpdate{MaxSurge: intOrStr(intstr.FromString("many"))},
+			desired:       10,
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			surge, unavailable, err := rollingUpdateLimits(&tt.rollingUpdate, tt.desired)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rollingUpdateLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if surge != tt.wantMaxSurge || unavailable != tt.wantMaxUnavailable {
+				t.Errorf("rollingUpdateLimits() = (%d, %d), want (%d, %d)", surge, unavailable, tt.wantMaxSurge, tt.wantMaxUnavailable)
+			}
+		})
+	}
+}
+
 // SetupDeploymentTest will set up a testing environment.
 // This includes:
 // * creating a Namespace to be used during the test
 // * starting the 'RunnerDeploymentReconciler'
 // * stopping the 'RunnerDeploymentReconciler" after the test ends
 // Call this function at the start of each of your tests.
+func TestRunnerDeploymentReconciler_Finalizer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := actionsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	server := fake.NewServer(fake.WithFixedResponses(&fake.FixedResponses{
+		ListRunners: fake.DefaultListRunnersHandler(),
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "example"}
+
+	rd := &actionsv1alpha1.RunnerDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: key.Namespace,
+			Name:      key.Name,
+		},
+		Spec: actionsv1alpha1.RunnerDeploymentSpec{
+			Replicas: intPtr(1),
+			Template: actionsv1alpha1.RunnerTemplate{
+				Spec: actionsv1alpha1.RunnerSpec{
+					RunnerConfig: actionsv1alpha1.RunnerConfig{
+						Repository: "test/valid",
+					},
+				},
+			},
+		},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(rd).Build()
+	ghClient := newGithubClient(server)
+
+	r := &RunnerDeploymentReconciler{
+		Client:       c,
+		Log:          logr.Discard(),
+		Recorder:     record.NewFakeRecorder(10),
+		Scheme:       scheme,
+		GitHubClient: NewMultiGitHubClient(c, ghClient, github.Config{}),
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var got actionsv1alpha1.RunnerDeployment
+	if err := c.Get(ctx, key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{runnerDeploymentFinalizerName}, got.Finalizers); diff != "" {
+		t.Fatalf("unexpected finalizers (-want +got):\n%s", diff)
+	}
+
+	// Simulate the runner controller having obtained a registration token for the runners of the deployment.
+	if _, err := ghClient.GetRegistrationToken(ctx, "", "", "test/valid", "example-runner"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Delete(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if err := c.Get(ctx, key, &got); err == nil {
+		t.Errorf("runnerdeployment still exists with finalizers %v", got.Finalizers)
+	}
+
+	if ghClient.DiscardRegistrationToken("", "", "test/valid") {
+		t.Errorf("registration token was not discarded on deletion of the runnerdeployment")
+	}
+
+	// Reconciling the deletion again, after the token has expired or been discarded, must be a no-op.
+	if _, err := r.processRunnerDeploymentDeletion(ctx, *rd.DeepCopy(), logr.Discard()); err != nil {
+		t.Errorf("processRunnerDeploymentDeletion() error = %v", err)
+	}
+}
+
+func TestRunnerDeploymentReconciler_FinalizerWithoutCredentials(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = actionsv1alpha1.AddToScheme(scheme)
+
+	server := fake.NewServer(fake.WithFixedResponses(&fake.FixedResponses{
+		ListRunners: fake.DefaultListRunnersHandler(),
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "example"}
+
+	now := metav1.Now()
+
+	// The secret has been deleted before the runnerdeployment, e.g. on the namespace deletion.
+	rd := &actionsv1alpha1.RunnerDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         key.Namespace,
+			Name:              key.Name,
+			Finalizers:        []string{runnerDeploymentFinalizerName},
+			DeletionTimestamp: &now,
+		},
+		Spec: actionsv1alpha1.RunnerDeploymentSpec{
+			Template: actionsv1alpha1.RunnerTemplate{
+				Spec: actionsv1alpha1.RunnerSpec{
+					RunnerConfig: actionsv1alpha1.RunnerConfig{
+						Repository: "test/valid",
+						GitHubAPICredentialsFrom: &actionsv1alpha1.GitHubAPICredentialsFrom{
+							SecretRef: actionsv1alpha1.SecretReference{Name: "deleted"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(rd).Build()
+
+	r := &RunnerDeploymentReconciler{
+		Client:       c,
+		Log:          logr.Discard(),
+		Recorder:     record.NewFakeRecorder(10),
+		Scheme:       scheme,
+		GitHubClient: NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+	}
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var got actionsv1alpha1.RunnerDeployment
+	if err := c.Get(ctx, key, &got); err == nil && len(got.Finalizers) > 0 {
+		t.Errorf("expected the finalizer to be removed without the credentials, got %v", got.Finalizers)
+	}
+}
+
 func SetupDeploymentTest(ctx2 context.Context) *corev1.Namespace {
 	var ctx context.Context
 	var cancel func()
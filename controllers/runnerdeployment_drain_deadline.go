@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// AnnotationKeyForceStop is the annotation ARC adds to a runner of an old runner replica set once the drain of its runnerdeployment
+// exceeded spec.maxDrainDuration. The runner controller then deletes the runner without waiting for the graceful stop,
+// after trying to remove the runner from GitHub once.
+// The value is the time the runner was marked for the forced stop.
+const AnnotationKeyForceStop = "actions-runner-controller/force-stop"
+
+// drainStartTime returns the drain start time to record in the status of the runnerdeployment.
+// It's kept from the first reconciliation that saw the old runner replica sets, and unset once they are gone.
+func drainStartTime(rd v1alpha1.RunnerDeployment, oldSets []v1alpha1.RunnerReplicaSet, now time.Time) *metav1.Time {
+	if len(oldSets) == 0 {
+		return nil
+	}
+
+	if rd.Status.DrainStartTime != nil {
+		return rd.Status.DrainStartTime
+	}
+
+	t := metav1.NewTime(now)
+
+	return &t
+}
+
+// drainDeadlineRemaining returns the duration until the drain of the runnerdeployment exceeds spec.maxDrainDuration.
+// It returns false when the runnerdeployment has no deadline or no drain in progress.
+func drainDeadlineRemaining(rd v1alpha1.RunnerDeployment, now time.Time) (time.Duration, bool) {
+	if rd.Spec.MaxDrainDuration == nil || rd.Spec.MaxDrainDuration.Duration <= 0 || rd.Status.DrainStartTime == nil {
+		return 0, false
+	}
+
+	return rd.Status.DrainStartTime.Add(rd.Spec.MaxDrainDuration.Duration).Sub(now), true
+}
+
+// withDrainDeadline shortens the requeue delay of the result so that the runnerdeployment is reconciled again
+// once the drain exceeds the deadline.
+func withDrainDeadline(res ctrl.Result, rd v1alpha1.RunnerDeployment, now time.Time) ctrl.Result {
+	remaining, ok := drainDeadlineRemaining(rd, now)
+	if !ok || remaining <= 0 {
+		return res
+	}
+
+	if res.RequeueAfter <= 0 || res.RequeueAfter > remaining {
+		res.RequeueAfter = remaining
+	}
+
+	return res
+}
+
+// forceCompleteDrain marks all the runners of the old runner replica sets for the forced stop, including the ones already being stopped,
+// and deletes the old runner replica sets.
+func (r *RunnerDeploymentReconciler) forceCompleteDrain(ctx context.Context, log logr.Logger, rd v1alpha1.RunnerDeployment, oldSets []v1alpha1.RunnerReplicaSet, now time.Time) error {
+	var runners v1alpha1.RunnerList
+	if err := r.List(ctx, &runners, client.InNamespace(rd.Namespace)); err != nil {
+		return err
+	}
+
+	var forced int
+
+	for i := range oldSets {
+		rs := oldSets[i]
+
+		for j := range runners.Items {
+			runner := &runners.Items[j]
+
+			if !metav1.IsControlledBy(runner, &rs) {
+				continue
+			}
+
+			if err := annotateForceStop(ctx, r.Client, runner, now); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Failed to mark runner of old runnerreplicaset for the forced stop", "runnerreplicaset", rs.Name, "runner", runner.Name)
+
+				return err
+			}
+
+			forced++
+		}
+
+		if err := r.Client.Delete(ctx, &rs); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to delete runnerreplicaset resource")
+
+			return err
+		}
+
+		log.Info("Deleted runnerreplicaset", "runnerdeployment", rd.ObjectMeta.Name, "runnerreplicaset", rs.Name)
+	}
+
+	msg := fmt.Sprintf("Forced %d remaining runner(s) of %d old runnerreplicaset(s) to stop as the drain exceeded maxDrainDuration of %s", forced, len(oldSets), rd.Spec.MaxDrainDuration.Duration)
+
+	r.Recorder.Event(&rd, corev1.EventTypeWarning, "DrainDeadlineExceeded", msg)
+
+	log.Info(msg, "drainStartTime", rd.Status.DrainStartTime)
+
+	return nil
+}
+
+// annotateForceStop marks the runner for the forced stop, along with the unregistration reason unless it already has one.
+func annotateForceStop(ctx context.Context, c client.Client, runner *v1alpha1.Runner, now time.Time) error {
+	if metav1.HasAnnotation(runner.ObjectMeta, AnnotationKeyForceStop) {
+		return nil
+	}
+
+	updated := runner.DeepCopy()
+	updated.Annotations = CloneAndAddLabel(updated.Annotations, AnnotationKeyForceStop, formatUnregistrationTimestamp(now))
+	if updated.Annotations[AnnotationKeyUnregistrationReason] == "" {
+		updated.Annotations[AnnotationKeyUnregistrationReason] = string(UnregistrationReasonRollingUpdate)
+	}
+
+	if err := c.Patch(ctx, updated, client.MergeFrom(runner)); err != nil {
+		return err
+	}
+
+	*runner = *updated
+
+	return nil
+}
+
+// forceRunnerDeletion deletes the runner marked for the forced stop without waiting for the graceful stop.
+// It tries to remove the runner from GitHub once, and proceeds even if the runner is busy or the GitHub API call failed,
+// in which case the runner stays registered on GitHub until it's removed as offline.
+func (r *RunnerReconciler) forceRunnerDeletion(ctx context.Context, runner v1alpha1.Runner, log logr.Logger, ghc *github.Client, pod *corev1.Pod, finalizers []string) (reconcile.Result, error) {
+	var completed bool
+	if pod != nil {
+		_, completed = getAnnotation(pod, unregistrationCompleteTimestamp())
+	}
+
+	if !completed {
+		unregistered, err := unregisterRunner(ctx, r.GracefulStopConfig, log, withRunnerOwnership(ghc, r.RunnerOwnership), runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name)
+		if err != nil {
+			log.Info("Failed to unregister the runner forced to stop. Not retrying as the drain deadline has been exceeded. The runner may stay registered on GitHub until it's removed as offline.", "error", err.Error())
+		} else if unregistered {
+			log.Info("Unregistered the runner forced to stop")
+		}
+	}
+
+	if err := r.deleteRunnerWithoutGracefulStop(ctx, runner, log, pod, finalizers); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	r.Recorder.Event(&runner, corev1.EventTypeWarning, "GracefulStopForced", "Deleted the runner without waiting for the graceful stop as the drain of its runnerdeployment exceeded maxDrainDuration")
+
+	log.Info("Forced the runner to stop as the drain of its runnerdeployment exceeded maxDrainDuration", "forceStop", runner.Annotations[AnnotationKeyForceStop])
+
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AnnotationKeyRecycle is the annotation ARC adds to a runner pod older than spec.maxRunnerAge of its runnerdeployment.
+// The runner controller gracefully stops the runner and recreates the pod once it sees the annotation.
+// The value is the time the pod was marked for recycling.
+const AnnotationKeyRecycle = "actions-runner-controller/recycle"
+
+// recycleAgedRunners marks the runner pods of the newest runner replica set older than spec.maxRunnerAge for recycling, oldest first,
+// as far as it can without dropping the ready runners below minReadyRunners, or one at a time when minReadyRunners is unset.
+//
+// It returns the delay until the next runner pod exceeds the age or until it can mark more runner pods, or zero if there's nothing to wait for.
+func (r *RunnerDeploymentReconciler) recycleAgedRunners(ctx context.Context, log logr.Logger, rd v1alpha1.RunnerDeployment, newestSet *v1alpha1.RunnerReplicaSet, desiredReplicas int, now time.Time) (time.Duration, error) {
+	if rd.Spec.MaxRunnerAge == nil || rd.Spec.MaxRunnerAge.Duration <= 0 || newestSet.Spec.Selector == nil {
+		return 0, nil
+	}
+
+	maxAge := rd.Spec.MaxRunnerAge.Duration
+
+	selector, err := metav1.LabelSelectorAsSelector(newestSet.Spec.Selector)
+	if err != nil {
+		return 0, err
+	}
+
+	var runners v1alpha1.RunnerList
+	if err := r.List(ctx, &runners, client.InNamespace(newestSet.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return 0, err
+	}
+
+	var (
+		ready      int
+		candidates []corev1.Pod
+		next       time.Duration
+	)
+
+	for _, runner := range runners.Items {
+		if !metav1.IsControlledBy(&runner, newestSet) || !runner.DeletionTimestamp.IsZero() || metav1.HasAnnotation(runner.ObjectMeta, annotationKeyRegistrationOnly) {
+			continue
+		}
+
+		var pod corev1.Pod
+		if err := r.Get(ctx, types.NamespacedName{Namespace: runner.Namespace, Name: runner.Name}, &pod); err != nil {
+			if kerrors.IsNotFound(err) {
+				continue
+			}
+			return 0, err
+		}
+
+		// A runner pod that is already being recycled or deleted doesn't count as ready, nor needs to be recycled again.
+		if _, ok := getAnnotation(&pod, AnnotationKeyRecycle); ok || !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		if runner.Status.Phase == string(corev1.PodRunning) {
+			ready++
+		}
+
+		if remaining := pod.CreationTimestamp.Add(maxAge).Sub(now); remaining > 0 {
+			if next == 0 || remaining < next {
+				next = remaining
+			}
+			continue
+		}
+
+		candidates = append(candidates, pod)
+	}
+
+	if len(candidates) == 0 {
+		return next, nil
+	}
+
+	minReadyRunners := desiredReplicas - 1
+	if rd.Spec.MinReadyRunners != nil {
+		minReadyRunners = *rd.Spec.MinReadyRunners
+	}
+	if minReadyRunners > desiredReplicas {
+		minReadyRunners = desiredReplicas
+	}
+	if minReadyRunners < 0 {
+		minReadyRunners = 0
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].CreationTimestamp.Before(&candidates[j].CreationTimestamp)
+	})
+
+	removable := ready - minReadyRunners
+
+	for i := range candidates {
+		if removable <= 0 {
+			log.Info("Waiting for more runners to become ready before recycling more runners older than maxRunnerAge", "ready", ready, "min_ready_runners", minReadyRunners, "waiting", len(candidates)-i)
+
+			return minReadyRunnersRetryDelay, nil
+		}
+
+		pod := &candidates[i]
+
+		updated := pod.DeepCopy()
+		setAnnotation(updated, AnnotationKeyRecycle, now.Format(time.RFC3339))
+
+		if err := r.Patch(ctx, updated, client.MergeFrom(pod)); err != nil {
+			log.Error(err, fmt.Sprintf("Failed to patch runner pod to have %s annotation", AnnotationKeyRecycle), "pod", pod.Name)
+			return 0, err
+		}
+
+		removable--
+
+		r.Recorder.Event(&rd, corev1.EventTypeNormal, "RunnerRecycled", fmt.Sprintf("Recycling runner '%s' older than maxRunnerAge %s", pod.Name, maxAge))
+
+		log.Info("Marked runner pod older than maxRunnerAge for recycling", "pod", pod.Name, "podCreationTimestamp", pod.CreationTimestamp, "maxRunnerAge", maxAge)
+	}
+
+	return next, nil
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// minReadyRunnersRetryDelay is how long to wait before retrying to scale down old runner replica sets
+// when doing so now would drop the ready runners below spec.minReadyRunners.
+const minReadyRunnersRetryDelay = 10 * time.Second
+
+// drainOldRunnerReplicaSets scales down the old runner replica sets, oldest first, as far as it can without
+// dropping the ready runners of the runnerdeployment below minReadyRunners, and deletes the ones that have no runners left.
+// The runnerreplicaset controller then gracefully stops the runners beyond the reduced replicas.
+//
+// oldSets must be sorted newest first.
+// It returns true once all the old runner replica sets are deleted.
+func (r *RunnerDeploymentReconciler) drainOldRunnerReplicaSets(ctx context.Context, log logr.Logger, rd v1alpha1.RunnerDeployment, newestSet *v1alpha1.RunnerReplicaSet, oldSets []v1alpha1.RunnerReplicaSet, minReadyRunners, desiredReplicas int) (bool, error) {
+	if minReadyRunners > desiredReplicas {
+		minReadyRunners = desiredReplicas
+	}
+
+	ready := getIntOrDefault(newestSet.Status.ReadyReplicas, 0)
+
+	for _, rs := range oldSets {
+		ready += effectiveReadyReplicas(rs)
+	}
+
+	removable := ready - minReadyRunners
+
+	drained := true
+
+	for i := len(oldSets) - 1; i >= 0; i-- {
+		rs := oldSets[i]
+
+		replicas := getIntOrDefault(rs.Spec.Replicas, 1)
+
+		if replicas == 0 && getIntOrDefault(rs.Status.Replicas, 0) == 0 {
+			if err := r.Client.Delete(ctx, &rs); err != nil {
+				log.Error(err, "Failed to delete runnerreplicaset resource")
+
+				return false, err
+			}
+
+			r.Recorder.Event(&rd, corev1.EventTypeNormal, "RunnerReplicaSetDeleted", fmt.Sprintf("Deleted runnerreplicaset '%s'", rs.Name))
+
+			log.Info("Deleted runnerreplicaset", "runnerdeployment", rd.ObjectMeta.Name, "runnerreplicaset", rs.Name)
+
+			continue
+		}
+
+		drained = false
+
+		if removable <= 0 || replicas == 0 {
+			continue
+		}
+
+		n := replicas
+		if n > removable {
+			n = removable
+		}
+		removable -= n
+
+		updated := rs.DeepCopy()
+		newReplicas := replicas - n
+		updated.Spec.Replicas = &newReplicas
+		updated.Annotations = CloneAndAddLabel(updated.Annotations, AnnotationKeyUnregistrationReason, string(UnregistrationReasonRollingUpdate))
+
+		if err := r.Client.Patch(ctx, updated, client.MergeFrom(&rs)); err != nil {
+			log.Error(err, "Failed to scale down old runnerreplicaset resource", "runnerreplicaset", rs.Name)
+
+			return false, err
+		}
+
+		log.Info("Scaled down old runnerreplicaset", "runnerreplicaset", rs.Name, "replicas_before", replicas, "replicas_after", newReplicas)
+	}
+
+	if !drained && removable <= 0 {
+		log.Info("Waiting for more runners of the newest runnerreplicaset to become ready before stopping more old runners", "ready", ready, "min_ready_runners", minReadyRunners)
+	}
+
+	return drained, nil
+}
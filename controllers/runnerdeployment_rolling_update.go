@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// rollingUpdateRetryDelay is how long to wait before retrying to scale the runner replica sets of a runnerdeployment
+// under a rolling update, while the new runners are becoming ready and the old runners are being stopped.
+const rollingUpdateRetryDelay = 10 * time.Second
+
+var (
+	defaultRollingUpdateMaxSurge       = intstr.FromString("25%")
+	defaultRollingUpdateMaxUnavailable = intstr.FromInt(0)
+)
+
+// rollingUpdateLimits resolves maxSurge and maxUnavailable of the rolling update against the desired replicas.
+func rollingUpdateLimits(ru *v1alpha1.RunnerDeploymentRollingUpdate, desired int) (int, int, error) {
+	surge, unavailable := defaultRollingUpdateMaxSurge, defaultRollingUpdateMaxUnavailable
+
+	if ru.MaxSurge != nil {
+		surge = *ru.MaxSurge
+	}
+
+	if ru.MaxUnavailable != nil {
+		unavailable = *ru.MaxUnavailable
+	}
+
+	maxSurge, err := intstr.GetScaledValueFromIntOrPercent(&surge, desired, true)
+	if err != nil || maxSurge < 0 {
+		return 0, 0, fmt.Errorf("invalid rollingUpdate.maxSurge %q: %v", surge.String(), err)
+	}
+
+	maxUnavailable, err := intstr.GetScaledValueFromIntOrPercent(&unavailable, desired, false)
+	if err != nil || maxUnavailable < 0 {
+		return 0, 0, fmt.Errorf("invalid rollingUpdate.maxUnavailable %q: %v", unavailable.String(), err)
+	}
+
+	if maxUnavailable > desired {
+		maxUnavailable = desired
+	}
+
+	if maxSurge == 0 && maxUnavailable == 0 {
+		// Otherwise the rolling update could never make progress.
+		maxSurge = 1
+	}
+
+	return maxSurge, maxUnavailable, nil
+}
+
+// rollingUpdateInitialReplicas returns the replicas for the runner replica set created on a template update,
+// so that the runners across the old ones and the new one don't exceed the desired replicas by more than maxSurge.
+func rollingUpdateInitialReplicas(ru *v1alpha1.RunnerDeploymentRollingUpdate, oldSets []v1alpha1.RunnerReplicaSet, desired int) (int, error) {
+	maxSurge, _, err := rollingUpdateLimits(ru, desired)
+	if err != nil {
+		return 0, err
+	}
+
+	replicas := desired + maxSurge - totalRunnerReplicaSetRunners(oldSets)
+
+	if replicas < 0 {
+		replicas = 0
+	} else if replicas > desired {
+		replicas = desired
+	}
+
+	return replicas, nil
+}
+
+func totalRunnerReplicaSetReplicas(sets []v1alpha1.RunnerReplicaSet) int {
+	var total int
+
+	for _, rs := range sets {
+		total += getIntOrDefault(rs.Spec.Replicas, 1)
+	}
+
+	return total
+}
+
+// totalRunnerReplicaSetRunners is like totalRunnerReplicaSetReplicas but also counts the runners beyond the replicas
+// that are still being stopped, e.g. because they are busy running jobs, so that they count toward maxSurge.
+func totalRunnerReplicaSetRunners(sets []v1alpha1.RunnerReplicaSet) int {
+	var total int
+
+	for _, rs := range sets {
+		n := getIntOrDefault(rs.Spec.Replicas, 1)
+		if current := getIntOrDefault(rs.Status.Replicas, 0); current > n {
+			n = current
+		}
+		total += n
+	}
+
+	return total
+}
+
+// effectiveReadyReplicas returns the ready runners of the runner replica set that aren't about to be stopped.
+//
+// Runners beyond the replicas are about to be stopped by the runnerreplicaset controller,
+// but the status may not reflect that yet. We don't count them as ready so that we don't
+// scale down further until the status catches up.
+func effectiveReadyReplicas(rs v1alpha1.RunnerReplicaSet) int {
+	ready := getIntOrDefault(rs.Status.ReadyReplicas, 0)
+
+	if stopping := getIntOrDefault(rs.Status.Replicas, 0) - getIntOrDefault(rs.Spec.Replicas, 1); stopping > 0 {
+		ready -= stopping
+	}
+
+	if ready < 0 {
+		return 0
+	}
+
+	return ready
+}
+
+// availableReplicas returns the ready runners of the runner replica set, up to its desired replicas.
+// Right after the runner replica set is scaled down, its status can still count the runners being stopped as ready,
+// which must not be counted as available.
+func availableReplicas(rs v1alpha1.RunnerReplicaSet) int {
+	ready := effectiveReadyReplicas(rs)
+
+	if replicas := getIntOrDefault(rs.Spec.Replicas, 1); ready > replicas {
+		return replicas
+	}
+
+	return ready
+}
+
+// rollOutRunnerReplicaSets advances the rolling update of the runnerdeployment by a step, the same way as the rolling update of a Deployment.
+// It scales up the newest runner replica set as far as maxSurge allows, and scales down the old ones, oldest first,
+// as far as maxUnavailable allows, removing the old runners that aren't ready first.
+// The runnerreplicaset controller then gracefully stops the old runners beyond the reduced replicas, waiting for busy runners to finish their jobs.
+// Old runner replica sets without runners are deleted.
+//
+// oldSets must be sorted newest first.
+// It returns true once all the old runner replica sets are deleted.
+func (r *RunnerDeploymentReconciler) rollOutRunnerReplicaSets(ctx context.Context, log logr.Logger, rd v1alpha1.RunnerDeployment, newestSet *v1alpha1.RunnerReplicaSet, oldSets []v1alpha1.RunnerReplicaSet, desired int) (bool, error) {
+	maxSurge, maxUnavailable, err := rollingUpdateLimits(rd.Spec.RollingUpdate, desired)
+	if err != nil {
+		r.Recorder.Event(&rd, corev1.EventTypeWarning, "InvalidRollingUpdate", err.Error())
+
+		return false, err
+	}
+
+	minAvailable := desired - maxUnavailable
+	if rd.Spec.MinReadyRunners != nil && *rd.Spec.MinReadyRunners > minAvailable {
+		minAvailable = *rd.Spec.MinReadyRunners
+		if minAvailable > desired {
+			minAvailable = desired
+		}
+	}
+
+	oldReplicas := totalRunnerReplicaSetReplicas(oldSets)
+
+	// Scale up the newest runner replica set.
+	// Old runners still running jobs count toward maxSurge until they stop.
+	newReplicas := getIntOrDefault(newestSet.Spec.Replicas, 1)
+	target := newReplicas
+	if newReplicas > desired {
+		target = desired
+	} else if allowed := desired + maxSurge - totalRunnerReplicaSetRunners(oldSets) - newReplicas; allowed > 0 {
+		target = newReplicas + allowed
+		if target > desired {
+			target = desired
+		}
+	}
+
+	if target != newReplicas {
+		updated := newestSet.DeepCopy()
+		updated.Spec.Replicas = &target
+		updated.Spec.EffectiveTime = rd.Spec.EffectiveTime
+
+		if err := r.Client.Patch(ctx, updated, client.MergeFrom(newestSet)); err != nil {
+			log.Error(err, "Failed to scale newest runnerreplicaset resource", "runnerreplicaset", newestSet.Name)
+
+			return false, err
+		}
+
+		log.Info("Scaled newest runnerreplicaset", "runnerreplicaset", newestSet.Name, "replicas_before", newReplicas, "replicas_after", target)
+
+		*newestSet = *updated
+	}
+
+	newUnavailable := target - effectiveReadyReplicas(*newestSet)
+	if newUnavailable < 0 {
+		newUnavailable = 0
+	}
+
+	// The number of old runners that can be stopped without going below minAvailable,
+	// assuming the new runners that aren't ready yet won't be ready soon.
+	maxScaledDown := oldReplicas + target - minAvailable - newUnavailable
+
+	available := availableReplicas(*newestSet)
+	for _, rs := range oldSets {
+		available += availableReplicas(rs)
+	}
+
+	// The number of ready old runners that can be stopped.
+	healthyScaleDown := available - minAvailable
+
+	drained := true
+
+	for i := len(oldSets) - 1; i >= 0; i-- {
+		rs := oldSets[i]
+
+		replicas := getIntOrDefault(rs.Spec.Replicas, 1)
+
+		if replicas == 0 && getIntOrDefault(rs.Status.Replicas, 0) == 0 {
+			if err := r.Client.Delete(ctx, &rs); err != nil {
+				log.Error(err, "Failed to delete runnerreplicaset resource")
+
+				return false, err
+			}
+
+			r.Recorder.Event(&rd, corev1.EventTypeNormal, "RunnerReplicaSetDeleted", fmt.Sprintf("Deleted runnerreplicaset '%s'", rs.Name))
+
+			log.Info("Deleted runnerreplicaset", "runnerdeployment", rd.ObjectMeta.Name, "runnerreplicaset", rs.Name)
+
+			continue
+		}
+
+		drained = false
+
+		ready := availableReplicas(rs)
+
+		// Stopping old runners that aren't ready doesn't reduce the available runners.
+		var n int
+		if unhealthy := replicas - ready; unhealthy > 0 && maxScaledDown > 0 {
+			n = unhealthy
+			if n > maxScaledDown {
+				n = maxScaledDown
+			}
+			maxScaledDown -= n
+		}
+
+		if healthy := ready; healthy > 0 && healthyScaleDown > 0 {
+			m := healthy
+			if m > healthyScaleDown {
+				m = healthyScaleDown
+			}
+			healthyScaleDown -= m
+			n += m
+		}
+
+		if n == 0 {
+			continue
+		}
+
+		updated := rs.DeepCopy()
+		newOldReplicas := replicas - n
+		updated.Spec.Replicas = &newOldReplicas
+		// Tells the runnerreplicaset controller that the runners are being replaced rather than scaled down.
+		updated.Annotations = CloneAndAddLabel(updated.Annotations, AnnotationKeyUnregistrationReason, string(UnregistrationReasonRollingUpdate))
+
+		if err := r.Client.Patch(ctx, updated, client.MergeFrom(&rs)); err != nil {
+			log.Error(err, "Failed to scale down old runnerreplicaset resource", "runnerreplicaset", rs.Name)
+
+			return false, err
+		}
+
+		log.Info("Scaled down old runnerreplicaset", "runnerreplicaset", rs.Name, "replicas_before", replicas, "replicas_after", newOldReplicas)
+	}
+
+	if !drained {
+		log.Info("Rolling update of runners is in progress", "max_surge", maxSurge, "max_unavailable", maxUnavailable, "available", available, "min_available", minAvailable)
+	}
+
+	return drained, nil
+}
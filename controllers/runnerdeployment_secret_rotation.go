@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// AnnotationKeySecretVersion is added to the runner template of a runner replica set created for a runnerdeployment with drainOnSecretRotation,
+// to tell the version of the credentials secret the runners are created with.
+// As it's part of the template hash, a new version makes the runnerdeployment replace all the runners.
+const AnnotationKeySecretVersion = "actions-runner-controller/secret-version"
+
+// secretVersionLength is the length of the secret version, which is a prefix of the sha256 of the secret data.
+const secretVersionLength = 16
+
+// credentialsSecretName returns the name of the secret to watch for the rotation, or an empty string when drainOnSecretRotation is disabled.
+func credentialsSecretName(rd *v1alpha1.RunnerDeployment) string {
+	if !rd.Spec.DrainOnSecretRotation {
+		return ""
+	}
+
+	if from := rd.Spec.Template.Spec.GitHubAPICredentialsFrom; from != nil {
+		return from.SecretRef.Name
+	}
+
+	return ""
+}
+
+// withSecretVersion returns the runnerdeployment whose runner template is annotated with the current version of the credentials secret,
+// so that the template hash changes when the secret is rotated.
+// It returns the runnerdeployment as-is when drainOnSecretRotation is disabled.
+func (r *RunnerDeploymentReconciler) withSecretVersion(ctx context.Context, rd v1alpha1.RunnerDeployment) (v1alpha1.RunnerDeployment, error) {
+	name := credentialsSecretName(&rd)
+	if name == "" {
+		return rd, nil
+	}
+
+	var secret corev1.Secret
+	if err := r.Get(ctx, types.NamespacedName{Namespace: rd.Namespace, Name: name}, &secret); err != nil {
+		return rd, fmt.Errorf("getting credentials secret %s for drainOnSecretRotation: %w", name, err)
+	}
+
+	updated := rd.DeepCopy()
+	updated.Spec.Template.ObjectMeta.Annotations = CloneAndAddLabel(updated.Spec.Template.ObjectMeta.Annotations, AnnotationKeySecretVersion, secretVersion(secret))
+
+	return *updated, nil
+}
+
+func secretVersion(secret corev1.Secret) string {
+	return hashSecretData(secret.Data)[:secretVersionLength]
+}
+
+// runnerDeploymentsForSecret maps a secret to the runnerdeployments in the same namespace that drain their runners on the rotation of the secret.
+func runnerDeploymentsForSecret(c client.Reader, log logr.Logger) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		var rds v1alpha1.RunnerDeploymentList
+		if err := c.List(context.Background(), &rds, client.InNamespace(obj.GetNamespace())); err != nil {
+			log.Error(err, "Failed to list runnerdeployments for the secret", "secret", obj.GetName())
+			return nil
+		}
+
+		var reqs []reconcile.Request
+
+		for i := range rds.Items {
+			rd := &rds.Items[i]
+
+			if credentialsSecretName(rd) == obj.GetName() {
+				reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: rd.Namespace, Name: rd.Name}})
+			}
+		}
+
+		return reqs
+	}
+}
@@ -28,6 +28,7 @@ import (
 
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -45,8 +46,17 @@ type RunnerReplicaSetReconciler struct {
 	Log          logr.Logger
 	Recorder     record.EventRecorder
 	Scheme       *runtime.Scheme
-	GitHubClient *github.Client
+	GitHubClient *MultiGitHubClient
 	Name         string
+
+	// MaxUnregistrationsPerReconcile is the maximum number of runners of a runnerreplicaset being unregistered at a time.
+	// On a large scale-down, a reconcile deletes only as many runners as this allows, counting the runners that are still
+	// being unregistered since the previous reconciles, and leaves the rest to subsequent reconciles.
+	// Zero disables the limit.
+	MaxUnregistrationsPerReconcile int
+
+	// ScaleDownScoring picks the idle runners to stop on a scale-down. See ScaleDownScoring for more details.
+	ScaleDownScoring ScaleDownScoring
 }
 
 const (
@@ -59,6 +69,7 @@ const (
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runners,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runners/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
 
 func (r *RunnerReplicaSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("runnerreplicaset", req.NamespacedName)
@@ -94,6 +105,9 @@ func (r *RunnerReplicaSetReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		ready     int
 		available int
 
+		// unregistering is the number of runners marked for deletion and being gracefully stopped by the runner controller.
+		unregistering int
+
 		lastSyncTime *time.Time
 	)
 
@@ -106,6 +120,7 @@ func (r *RunnerReplicaSetReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			// we don't need to bother calling GitHub API to re-mark the runner for deletion.
 			// Just hold on, and runners will disappear as long as the runner controller is up and running.
 			if !r.DeletionTimestamp.IsZero() {
+				unregistering++
 				continue
 			}
 
@@ -176,7 +191,11 @@ func (r *RunnerReplicaSetReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	effectiveTime := rs.Spec.EffectiveTime
 	ephemeral := rs.Spec.Template.Spec.Ephemeral == nil || *rs.Spec.Template.Spec.Ephemeral
 
-	if current < desired && ephemeral && lastSyncTime != nil && effectiveTime != nil && lastSyncTime.After(effectiveTime.Time) {
+	if rs.Spec.Paused {
+		// The owner RunnerDeployment is paused. Runners that are already marked for deletion are not counted in `current`
+		// and are still gracefully stopped by the runner controller, so skipping here won't block them.
+		log.V(1).Info("Skipped creating or deleting runners because the runnerreplicaset is paused", "desired", desired, "current", current, "ready", ready)
+	} else if current < desired && ephemeral && lastSyncTime != nil && effectiveTime != nil && lastSyncTime.After(effectiveTime.Time) {
 		log.V(1).Info("Detected that some ephemeral runners have disappeared. Usually this is due to that ephemeral runner completions so ARC does not create new runners until EffectiveTime is updated.", "lastSyncTime", metav1.Time{Time: *lastSyncTime}, "effectiveTime", *effectiveTime, "desired", desired, "available", current, "ready", ready)
 	} else if current > desired {
 		// If you use ephemeral runners with webhook-based autoscaler and the runner controller is working normally,
@@ -204,8 +223,31 @@ func (r *RunnerReplicaSetReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		// get runners that are currently offline/not busy/timed-out to register
 		var deletionCandidates []v1alpha1.Runner
 
+		// idleRunners is the registered runners that aren't busy, which are scored to pick the ones to stop
+		// after the offline runners and the runners that failed to register.
+		var idleRunners []v1alpha1.Runner
+
 		for _, runner := range allRunners.Items {
-			busy, err := r.GitHubClient.IsRunnerBusy(ctx, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name)
+			pinned, err := r.isRunnerPinned(ctx, runner)
+			if err != nil {
+				log.Error(err, "Failed to check if runner is pinned", "runnerName", runner.Name)
+				return ctrl.Result{}, err
+			}
+
+			if pinned {
+				log.Info(fmt.Sprintf("Skipped scaling down runner %s because it is pinned via the %s annotation. Remove the runner manually or unpin it to scale it down", runner.Name, AnnotationKeyPin), "runnerName", runner.Name)
+				continue
+			}
+
+			ghc, err := r.GitHubClient.InitForRunner(ctx, &runner)
+			if err != nil {
+				// The runner reconciler surfaces the credentials error on the runner, so we just skip it here
+				// rather than blocking the scale down of the other runners.
+				log.Error(err, "Failed to initialize GitHub API client for the runner. Skipped considering it for scale down", "runnerName", runner.Name)
+				continue
+			}
+
+			busy, err := ghc.IsRunnerBusy(ctx, runner.Spec.Enterprise, runner.Spec.Organization, runner.Spec.Repository, runner.Name)
 			if err != nil {
 				notRegistered := false
 				offline := false
@@ -259,17 +301,54 @@ func (r *RunnerReplicaSetReconciler) Reconcile(ctx context.Context, req ctrl.Req
 					deletionCandidates = append(deletionCandidates, runner)
 				}
 			} else if !busy {
-				deletionCandidates = append(deletionCandidates, runner)
+				if r.ScaleDownScoring.enabled() {
+					idleRunners = append(idleRunners, runner)
+				} else {
+					deletionCandidates = append(deletionCandidates, runner)
+				}
+			}
+		}
+
+		if len(idleRunners) > 0 {
+			ordered, err := r.orderIdleRunnersForScaleDown(ctx, rs, allRunners.Items, idleRunners, time.Now())
+			if err != nil {
+				log.Error(err, "Failed to list runner pods to score idle runners for scale down")
+				return ctrl.Result{}, err
 			}
+
+			deletionCandidates = append(deletionCandidates, ordered...)
 		}
 
 		if len(deletionCandidates) < n {
 			n = len(deletionCandidates)
 		}
 
+		if max := r.MaxUnregistrationsPerReconcile; max > 0 && unregistering+n > max {
+			allowed := max - unregistering
+			if allowed < 0 {
+				allowed = 0
+			}
+
+			log.Info(
+				fmt.Sprintf("Deferring the deletion of %d runner(s) to subsequent reconciles to limit concurrent unregistrations", n-allowed),
+				"unregistering", unregistering,
+				"maxUnregistrationsPerReconcile", max,
+			)
+
+			n = allowed
+		}
+
 		log.V(0).Info(fmt.Sprintf("Deleting %d runner(s)", n), "desired", desired, "current", current, "ready", ready)
 
+		reason := unregistrationReasonOf(&rs, UnregistrationReasonScaleDown)
+
 		for i := 0; i < n; i++ {
+			if err := annotateUnregistrationReason(ctx, r.Client, &deletionCandidates[i], reason); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Failed to annotate runner resource with the unregistration reason")
+
+				return ctrl.Result{}, err
+			}
+
 			if err := r.Client.Delete(ctx, &deletionCandidates[i]); client.IgnoreNotFound(err) != nil {
 				log.Error(err, "Failed to delete runner resource")
 
@@ -321,6 +400,21 @@ func (r *RunnerReplicaSetReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	return ctrl.Result{}, nil
 }
 
+// isRunnerPinned returns true if either the runner or its pod is pinned.
+// We check the pod too, as it's the pod that engineers usually look into and annotate when inspecting a stuck job.
+func (r *RunnerReplicaSetReconciler) isRunnerPinned(ctx context.Context, runner v1alpha1.Runner) (bool, error) {
+	if isPinned(&runner) {
+		return true, nil
+	}
+
+	var pod corev1.Pod
+	if err := r.Get(ctx, types.NamespacedName{Namespace: runner.Namespace, Name: runner.Name}, &pod); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	return isPinned(&pod), nil
+}
+
 func (r *RunnerReplicaSetReconciler) newRunner(rs v1alpha1.RunnerReplicaSet) (v1alpha1.Runner, error) {
 	objectMeta := rs.Spec.Template.ObjectMeta.DeepCopy()
 
@@ -2,10 +2,19 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
+	"net/http"
 	"net/http/httptest"
+	"testing"
 	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -18,6 +27,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	actionsv1alpha1 "github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
 	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
 )
 
@@ -60,7 +70,7 @@ func SetupTest(ctx2 context.Context) *corev1.Namespace {
 			Scheme:       scheme.Scheme,
 			Log:          logf.Log,
 			Recorder:     mgr.GetEventRecorderFor("runnerreplicaset-controller"),
-			GitHubClient: ghClient,
+			GitHubClient: NewMultiGitHubClient(mgr.GetClient(), ghClient, github.Config{}),
 			Name:         "runnerreplicaset-" + ns.Name,
 		}
 		err = controller.SetupWithManager(mgr)
@@ -99,6 +109,304 @@ func intPtr(v int) *int {
 	return &v
 }
 
+func TestRunnerReplicaSetReconciler_Paused(t *testing.T) {
+	sch := runtime.NewScheme()
+	if err := actionsv1alpha1.AddToScheme(sch); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	rs := &actionsv1alpha1.RunnerReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "example",
+		},
+		Spec: actionsv1alpha1.RunnerReplicaSetSpec{
+			Replicas: intPtr(2),
+			Paused:   true,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"foo": "bar"},
+			},
+			Template: actionsv1alpha1.RunnerTemplate{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"foo": "bar"},
+				},
+				Spec: actionsv1alpha1.RunnerSpec{
+					RunnerConfig: actionsv1alpha1.RunnerConfig{
+						Repository: "test/valid",
+					},
+				},
+			},
+		},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(sch).WithObjects(rs).Build()
+
+	r := &RunnerReplicaSetReconciler{
+		Client:   c,
+		Log:      logr.Discard(),
+		Recorder: record.NewFakeRecorder(10),
+		Scheme:   sch,
+	}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: rs.Namespace, Name: rs.Name}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var runners actionsv1alpha1.RunnerList
+	if err := c.List(context.Background(), &runners); err != nil {
+		t.Fatal(err)
+	}
+	if len(runners.Items) != 0 {
+		t.Errorf("unexpected number of runners created while paused: got %d, want 0", len(runners.Items))
+	}
+}
+
+func TestRunnerReplicaSetReconciler_ScaleDownSkipsPinnedRunners(t *testing.T) {
+	tests := []struct {
+		name          string
+		pinnedRunners []string
+		pinnedPods    []string
+		wantRemaining []string
+	}{
+		{
+			name:          "runner pinned",
+			pinnedRunners: []string{"test2"},
+			wantRemaining: []string{"test2"},
+		},
+		{
+			name:          "runner pod pinned",
+			pinnedPods:    []string{"test1"},
+			wantRemaining: []string{"test1"},
+		},
+		{
+			name:          "nothing pinned",
+			wantRemaining: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+			)
+			defer server.Close()
+
+			sch := runtime.NewScheme()
+			_ = corev1.AddToScheme(sch)
+			_ = actionsv1alpha1.AddToScheme(sch)
+
+			rs := &actionsv1alpha1.RunnerReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "example",
+					UID:       "example-uid",
+				},
+				Spec: actionsv1alpha1.RunnerReplicaSetSpec{
+					Replicas: intPtr(0),
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"foo": "bar"},
+					},
+				},
+			}
+
+			objs := []client.Object{rs}
+
+			// test1 is online and idle, and test2 is offline. Both are deletion candidates unless pinned.
+			for _, name := range []string{"test1", "test2"} {
+				runner := &actionsv1alpha1.Runner{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      name,
+						Labels:    map[string]string{"foo": "bar"},
+					},
+					Spec: actionsv1alpha1.RunnerSpec{
+						RunnerConfig: actionsv1alpha1.RunnerConfig{
+							Repository: "test/valid",
+						},
+					},
+				}
+				if err := ctrl.SetControllerReference(rs, runner, sch); err != nil {
+					t.Fatal(err)
+				}
+
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      name,
+					},
+				}
+
+				for _, n := range tt.pinnedRunners {
+					if n == name {
+						runner.Annotations = map[string]string{AnnotationKeyPin: "true"}
+					}
+				}
+				for _, n := range tt.pinnedPods {
+					if n == name {
+						pod.Annotations = map[string]string{AnnotationKeyPin: "true"}
+					}
+				}
+
+				objs = append(objs, runner, pod)
+			}
+
+			c := clientfake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build()
+
+			r := &RunnerReplicaSetReconciler{
+				Client:       c,
+				Log:          logr.Discard(),
+				Recorder:     record.NewFakeRecorder(10),
+				Scheme:       sch,
+				GitHubClient: NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+			}
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: rs.Namespace, Name: rs.Name}}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			var runners actionsv1alpha1.RunnerList
+			if err := c.List(context.Background(), &runners); err != nil {
+				t.Fatal(err)
+			}
+
+			remaining := []string{}
+			for _, runner := range runners.Items {
+				remaining = append(remaining, runner.Name)
+			}
+
+			if d := cmp.Diff(tt.wantRemaining, remaining); d != "" {
+				t.Errorf("unexpected remaining runners (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestRunnerReplicaSetReconciler_MaxUnregistrationsPerReconcile(t *testing.T) {
+	const (
+		numRunners = 50
+		max        = 10
+	)
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+	)
+	defer server.Close()
+
+	sch := runtime.NewScheme()
+	_ = corev1.AddToScheme(sch)
+	_ = actionsv1alpha1.AddToScheme(sch)
+
+	rs := &actionsv1alpha1.RunnerReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "example",
+			UID:       "example-uid",
+		},
+		Spec: actionsv1alpha1.RunnerReplicaSetSpec{
+			Replicas: intPtr(0),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"foo": "bar"},
+			},
+		},
+	}
+
+	objs := []client.Object{rs}
+
+	// None of the runners are registered on GitHub and they have timed out to register, so all of them are deletion candidates.
+	for i := 0; i < numRunners; i++ {
+		runner := &actionsv1alpha1.Runner{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      fmt.Sprintf("example-%d", i),
+				Labels:    map[string]string{"foo": "bar"},
+				// Emulates the graceful stop by the runner controller, which removes the finalizer once the runner is unregistered.
+				Finalizers: []string{finalizerName},
+			},
+			Spec: actionsv1alpha1.RunnerSpec{
+				RunnerConfig: actionsv1alpha1.RunnerConfig{
+					Repository: "test/valid",
+				},
+			},
+		}
+		if err := ctrl.SetControllerReference(rs, runner, sch); err != nil {
+			t.Fatal(err)
+		}
+
+		objs = append(objs, runner)
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build()
+
+	r := &RunnerReplicaSetReconciler{
+		Client:                         c,
+		Log:                            logr.Discard(),
+		Recorder:                       record.NewFakeRecorder(numRunners),
+		Scheme:                         sch,
+		GitHubClient:                   NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+		MaxUnregistrationsPerReconcile: max,
+	}
+
+	ctx := context.Background()
+
+	reconcile := func() {
+		t.Helper()
+
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: rs.Namespace, Name: rs.Name}}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+
+	list := func() (remaining, unregistering []actionsv1alpha1.Runner) {
+		t.Helper()
+
+		var runners actionsv1alpha1.RunnerList
+		if err := c.List(ctx, &runners); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, runner := range runners.Items {
+			if runner.DeletionTimestamp.IsZero() {
+				remaining = append(remaining, runner)
+			} else {
+				unregistering = append(unregistering, runner)
+			}
+		}
+
+		return remaining, unregistering
+	}
+
+	for pass := 0; pass < numRunners/max; pass++ {
+		reconcile()
+
+		remaining, unregistering := list()
+		if len(unregistering) != max {
+			t.Fatalf("pass %d: unexpected number of runners being unregistered: got %d, want %d", pass, len(unregistering), max)
+		}
+		if want := numRunners - (pass+1)*max; len(remaining) != want {
+			t.Fatalf("pass %d: unexpected number of remaining runners: got %d, want %d", pass, len(remaining), want)
+		}
+
+		// Runners still being unregistered count toward the limit.
+		reconcile()
+
+		if _, again := list(); len(again) != max {
+			t.Fatalf("pass %d: expected no more runners to be unregistered until the previous ones complete, got %d", pass, len(again))
+		}
+
+		for i := range unregistering {
+			runner := unregistering[i]
+			runner.Finalizers = nil
+			if err := c.Update(ctx, &runner); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if remaining, unregistering := list(); len(remaining) != 0 || len(unregistering) != 0 {
+		t.Errorf("expected all the runners to be deleted, got %d remaining and %d being unregistered", len(remaining), len(unregistering))
+	}
+}
+
 var _ = Context("Inside of a new namespace", func() {
 	ctx := context.TODO()
 	ns := SetupTest(ctx)
@@ -270,3 +578,81 @@ var _ = Context("Inside of a new namespace", func() {
 		})
 	})
 })
+
+func TestRunnerReplicaSetReconciler_ScaleDownSkipsRunnersWithInvalidCredentials(t *testing.T) {
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+	)
+	defer server.Close()
+
+	sch := runtime.NewScheme()
+	_ = corev1.AddToScheme(sch)
+	_ = actionsv1alpha1.AddToScheme(sch)
+
+	rs := &actionsv1alpha1.RunnerReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "example",
+			UID:       "example-uid",
+		},
+		Spec: actionsv1alpha1.RunnerReplicaSetSpec{
+			Replicas: intPtr(0),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"foo": "bar"},
+			},
+		},
+	}
+
+	objs := []client.Object{rs}
+
+	// example-0 references a missing secret, and is listed first.
+	for i := 0; i < 2; i++ {
+		runner := &actionsv1alpha1.Runner{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      fmt.Sprintf("example-%d", i),
+				Labels:    map[string]string{"foo": "bar"},
+			},
+			Spec: actionsv1alpha1.RunnerSpec{
+				RunnerConfig: actionsv1alpha1.RunnerConfig{
+					Repository: "test/valid",
+				},
+			},
+		}
+		if i == 0 {
+			runner.Spec.GitHubAPICredentialsFrom = &actionsv1alpha1.GitHubAPICredentialsFrom{
+				SecretRef: actionsv1alpha1.SecretReference{Name: "missing"},
+			}
+		}
+		if err := ctrl.SetControllerReference(rs, runner, sch); err != nil {
+			t.Fatal(err)
+		}
+
+		objs = append(objs, runner)
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build()
+
+	r := &RunnerReplicaSetReconciler{
+		Client:       c,
+		Log:          logr.Discard(),
+		Recorder:     record.NewFakeRecorder(10),
+		Scheme:       sch,
+		GitHubClient: NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+	}
+
+	ctx := context.Background()
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: rs.Namespace, Name: rs.Name}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var runners actionsv1alpha1.RunnerList
+	if err := c.List(ctx, &runners); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runners.Items) != 1 || runners.Items[0].Name != "example-0" {
+		t.Errorf("expected only the runner with the invalid credentials to remain, got %v", runners.Items)
+	}
+}
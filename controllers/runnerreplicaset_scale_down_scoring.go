@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ScaleDownScoring configures how the runnerreplicaset controller picks the idle runners to stop on a scale-down.
+//
+// Each idle runner is scored by the weighted sum of the density and the idleness, both normalized to [0, 1] across the idle runners:
+// the density is the number of runners of the runner replica set on the node of the runner pod,
+// and the idleness is how long the runner has been idle.
+// The runners are then picked one by one at random, with probabilities proportional to their scores,
+// so that the idle runners on the most-loaded nodes and the longest-idle runners are stopped first more often than not.
+// The density is recomputed after each pick, so that a single node isn't drained ahead of other loaded nodes.
+//
+// When both weights are zero, the idle runners are stopped in the listed order.
+type ScaleDownScoring struct {
+	NodeDensityWeight float64
+	IdlenessWeight    float64
+}
+
+// Validate returns an error if any of the weights is negative.
+func (s ScaleDownScoring) Validate() error {
+	if s.NodeDensityWeight < 0 || s.IdlenessWeight < 0 {
+		return fmt.Errorf("invalid scale down scoring weights %v and %v: must not be negative", s.NodeDensityWeight, s.IdlenessWeight)
+	}
+
+	return nil
+}
+
+func (s ScaleDownScoring) enabled() bool {
+	return s.NodeDensityWeight > 0 || s.IdlenessWeight > 0
+}
+
+// scaleDownRandom returns a random number in [0, 1). It's a variable for testing.
+var scaleDownRandom = rand.Float64
+
+// minScaleDownScore is added to every score so that runners scored zero, e.g. all on nodes with a single runner, can still be picked.
+const minScaleDownScore = 1e-6
+
+// scaleDownCandidate is an idle runner along with what it's scored by.
+type scaleDownCandidate struct {
+	runner v1alpha1.Runner
+	// node is the name of the node the runner pod is scheduled to. It's empty for a runner pod that isn't scheduled yet.
+	node string
+	idle time.Duration
+}
+
+// order returns the runners of the candidates in the order to stop them.
+// nodeRunners is the number of runners of the runner replica set per node, including the busy ones.
+func (s ScaleDownScoring) order(candidates []scaleDownCandidate, nodeRunners map[string]int) []v1alpha1.Runner {
+	remaining := append([]scaleDownCandidate{}, candidates...)
+
+	counts := map[string]int{}
+	for node, n := range nodeRunners {
+		counts[node] = n
+	}
+
+	var ordered []v1alpha1.Runner
+
+	for len(remaining) > 0 {
+		var (
+			maxCount int
+			maxIdle  time.Duration
+		)
+
+		for _, c := range remaining {
+			if c.node != "" && counts[c.node] > maxCount {
+				maxCount = counts[c.node]
+			}
+
+			if c.idle > maxIdle {
+				maxIdle = c.idle
+			}
+		}
+
+		scores := make([]float64, len(remaining))
+
+		var total float64
+
+		for i, c := range remaining {
+			score := minScaleDownScore
+
+			if c.node != "" && maxCount > 0 {
+				score += s.NodeDensityWeight * float64(counts[c.node]) / float64(maxCount)
+			}
+
+			if maxIdle > 0 {
+				score += s.IdlenessWeight * float64(c.idle) / float64(maxIdle)
+			}
+
+			scores[i] = score
+			total += score
+		}
+
+		picked := len(remaining) - 1
+
+		x := scaleDownRandom() * total
+		for i, score := range scores {
+			if x < score {
+				picked = i
+				break
+			}
+			x -= score
+		}
+
+		c := remaining[picked]
+
+		ordered = append(ordered, c.runner)
+
+		if c.node != "" {
+			counts[c.node]--
+		}
+
+		remaining = append(remaining[:picked], remaining[picked+1:]...)
+	}
+
+	return ordered
+}
+
+// orderIdleRunnersForScaleDown returns the idle runners of the runner replica set in the order to stop them, scored by r.ScaleDownScoring.
+// runners is all the runners of the runner replica set, which the density of the runners per node is counted from.
+func (r *RunnerReplicaSetReconciler) orderIdleRunnersForScaleDown(ctx context.Context, rs v1alpha1.RunnerReplicaSet, runners, idle []v1alpha1.Runner, now time.Time) ([]v1alpha1.Runner, error) {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(rs.Namespace)); err != nil {
+		return nil, err
+	}
+
+	// A runner pod has the same name as its runner.
+	podsByName := map[string]*corev1.Pod{}
+	for i := range pods.Items {
+		podsByName[pods.Items[i].Name] = &pods.Items[i]
+	}
+
+	nodeRunners := map[string]int{}
+
+	for _, runner := range runners {
+		if pod, ok := podsByName[runner.Name]; ok && pod.Spec.NodeName != "" {
+			nodeRunners[pod.Spec.NodeName]++
+		}
+	}
+
+	candidates := make([]scaleDownCandidate, 0, len(idle))
+
+	for _, runner := range idle {
+		c := scaleDownCandidate{runner: runner}
+
+		if pod, ok := podsByName[runner.Name]; ok {
+			c.node = pod.Spec.NodeName
+			c.idle = now.Sub(runnerPodIdleSince(pod))
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return r.ScaleDownScoring.order(candidates, nodeRunners), nil
+}
+
+// runnerPodIdleSince returns when the idle runner of the pod was last known to be active,
+// which is when ARC first saw it running a job, when ARC first saw it registered, or when the pod was created, whichever is available first.
+func runnerPodIdleSince(pod *corev1.Pod) time.Time {
+	for _, key := range []string{AnnotationKeyJobSeenTimestamp, AnnotationKeyRegistrationFirstSeenTimestamp} {
+		if v, ok := getAnnotation(pod, key); ok {
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				return t
+			}
+		}
+	}
+
+	return pod.CreationTimestamp.Time
+}
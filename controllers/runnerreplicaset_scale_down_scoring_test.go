@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	actionsv1alpha1 "github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func scaleDownCandidates(layout map[string][]time.Duration) ([]scaleDownCandidate, map[string]int) {
+	var candidates []scaleDownCandidate
+
+	nodeRunners := map[string]int{}
+
+	for node, idles := range layout {
+		for i, idle := range idles {
+			name := fmt.Sprintf("%s-%d", node, i)
+			candidates = append(candidates, scaleDownCandidate{runner: actionsv1alpha1.Runner{ObjectMeta: metav1.ObjectMeta{Name: name}}, node: node, idle: idle})
+			nodeRunners[node]++
+		}
+	}
+
+	return candidates, nodeRunners
+}
+
+func TestScaleDownScoring_Order(t *testing.T) {
+	defer func(f func() float64) { scaleDownRandom = f }(scaleDownRandom)
+
+	scaleDownRandom = rand.New(rand.NewSource(1)).Float64
+
+	const trials = 1000
+
+	tests := []struct {
+		name    string
+		scoring ScaleDownScoring
+		layout  map[string][]time.Duration
+		// wantFirstPrefix is the prefix of the name of the runner expected to be picked first in most of the trials.
+		wantFirstPrefix string
+		wantMinRatio    float64
+	}{
+		{
+			name:    "prefers runners on the most-loaded node",
+			scoring: ScaleDownScoring{NodeDensityWeight: 1},
+			layout: map[string][]time.Duration{
+				"node-a": {time.Minute, time.Minute, time.Minute, time.Minute},
+				"node-b": {time.Minute},
+				"node-c": {time.Minute},
+			},
+			wantFirstPrefix: "node-a-",
+			wantMinRatio:    0.75,
+		},
+		{
+			name:    "prefers the longest-idle runner",
+			scoring: ScaleDownScoring{IdlenessWeight: 1},
+			layout: map[string][]time.Duration{
+				"node-a": {time.Minute, time.Minute},
+				"node-b": {time.Minute, 2 * time.Hour},
+			},
+			wantFirstPrefix: "node-b-1",
+			wantMinRatio:    0.85,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates, nodeRunners := scaleDownCandidates(tt.layout)
+
+			var first int
+
+			for i := 0; i < trials; i++ {
+				ordered := tt.scoring.order(candidates, nodeRunners)
+
+				if len(ordered) != len(candidates) {
+					t.Fatalf("expected all the %d candidates to be ordered, got %d", len(candidates), len(ordered))
+				}
+
+				seen := map[string]bool{}
+				for _, r := range ordered {
+					if seen[r.Name] {
+						t.Fatalf("runner %s is ordered more than once", r.Name)
+					}
+					seen[r.Name] = true
+				}
+
+				if strings.HasPrefix(ordered[0].Name, tt.wantFirstPrefix) {
+					first++
+				}
+			}
+
+			if ratio := float64(first) / trials; ratio < tt.wantMinRatio {
+				t.Errorf("expected a runner prefixed with %s to be picked first in at least %v of the trials, got %v", tt.wantFirstPrefix, tt.wantMinRatio, ratio)
+			}
+		})
+	}
+}
+
+func TestRunnerReplicaSetReconciler_ScaleDownScoring(t *testing.T) {
+	defer func(f func() float64) { scaleDownRandom = f }(scaleDownRandom)
+
+	scaleDownRandom = func() float64 { return 0.5 }
+
+	layout := map[string]string{
+		"example-a1": "node-a",
+		"example-a2": "node-a",
+		"example-a3": "node-a",
+		"example-b1": "node-b",
+	}
+
+	var registered []string
+	for name := range layout {
+		registered = append(registered, fmt.Sprintf(`{"id": %d, "name": %q, "os": "linux", "status": "online", "busy": false}`, len(registered)+1, name))
+	}
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fmt.Sprintf(`{"total_count": %d, "runners": [%s]}`, len(registered), strings.Join(registered, ","))),
+	)
+	defer server.Close()
+
+	sch := runtime.NewScheme()
+	_ = corev1.AddToScheme(sch)
+	_ = actionsv1alpha1.AddToScheme(sch)
+
+	rs := &actionsv1alpha1.RunnerReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "example",
+			UID:       "example-uid",
+		},
+		Spec: actionsv1alpha1.RunnerReplicaSetSpec{
+			Replicas: intPtr(3),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"foo": "bar"},
+			},
+		},
+	}
+
+	objs := []client.Object{rs}
+
+	for name, node := range layout {
+		runner := &actionsv1alpha1.Runner{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+				Labels:    map[string]string{"foo": "bar"},
+			},
+			Spec: actionsv1alpha1.RunnerSpec{
+				RunnerConfig: actionsv1alpha1.RunnerConfig{
+					Repository: "test/valid",
+				},
+			},
+		}
+		if err := ctrl.SetControllerReference(rs, runner, sch); err != nil {
+			t.Fatal(err)
+		}
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       corev1.PodSpec{NodeName: node},
+		}
+
+		objs = append(objs, runner, pod)
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build()
+
+	r := &RunnerReplicaSetReconciler{
+		Client:           c,
+		Log:              logr.Discard(),
+		Recorder:         record.NewFakeRecorder(10),
+		Scheme:           sch,
+		GitHubClient:     NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+		ScaleDownScoring: ScaleDownScoring{NodeDensityWeight: 1},
+	}
+
+	ctx := context.Background()
+
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: rs.Namespace, Name: rs.Name}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var runners actionsv1alpha1.RunnerList
+	if err := c.List(ctx, &runners); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runners.Items) != 3 {
+		t.Fatalf("expected a runner to be deleted, got %d runners", len(runners.Items))
+	}
+
+	for _, runner := range runners.Items {
+		delete(layout, runner.Name)
+	}
+
+	for name, node := range layout {
+		if node != "node-a" {
+			t.Errorf("expected a runner on the most-loaded node-a to be deleted, got %s on %s", name, node)
+		}
+	}
+}
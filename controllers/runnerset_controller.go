@@ -18,7 +18,10 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -35,6 +38,7 @@ import (
 
 	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
 	"github.com/actions-runner-controller/actions-runner-controller/controllers/metrics"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
 	"github.com/go-logr/logr"
 )
 
@@ -57,6 +61,14 @@ type RunnerSetReconciler struct {
 	RunnerImagePullSecrets []string
 	DockerImage            string
 	DockerRegistryMirror   string
+
+	// GitHubClient provides the clients used to unregister runners before the statefulset is scaled down.
+	GitHubClient *MultiGitHubClient
+
+	GracefulStopConfig
+
+	// PauseScaleUpsOnRateLimit makes the reconciler pause scaling up statefulsets while the GitHub API rate limit is exhausted.
+	PauseScaleUpsOnRateLimit bool
 }
 
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runnersets,verbs=get;list;watch;create;update;patch;delete
@@ -64,6 +76,7 @@ type RunnerSetReconciler struct {
 // +kubebuilder:rbac:groups=actions.summerwind.dev,resources=runnersets/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=statefulsets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;create;update
 
@@ -182,7 +195,37 @@ func (r *RunnerSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 
 	// Please add more conditions that we can in-place update the newest runnerreplicaset without disruption
 	if currentDesiredReplicas != newDesiredReplicas {
-		v := int32(newDesiredReplicas)
+		var (
+			res *ctrl.Result
+			err error
+		)
+
+		replicas := newDesiredReplicas
+
+		ghc, err := r.GitHubClient.InitForRunnerSet(ctx, runnerSet)
+		if err != nil {
+			log.Error(err, "Failed to initialize GitHub client for runnerset")
+			return ctrl.Result{}, err
+		}
+
+		if newDesiredReplicas > currentDesiredReplicas {
+			if d := scaleUpPauseDelay(log, r.PauseScaleUpsOnRateLimit, ghc, time.Now()); d > 0 {
+				return ctrl.Result{RequeueAfter: d}, nil
+			}
+		}
+
+		if newDesiredReplicas < currentDesiredReplicas {
+			replicas, res, err = r.drainForScaleDown(ctx, log, ghc, liveStatefulSet, currentDesiredReplicas, newDesiredReplicas)
+			if replicas == currentDesiredReplicas {
+				if res == nil {
+					res = &ctrl.Result{RequeueAfter: r.unregistrationRetryDelay()}
+				}
+
+				return *res, err
+			}
+		}
+
+		v := int32(replicas)
 
 		updated := liveStatefulSet.DeepCopy()
 		updated.Spec.Replicas = &v
@@ -193,9 +236,17 @@ func (r *RunnerSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 			return ctrl.Result{}, err
 		}
 
+		if res != nil {
+			return *res, err
+		}
+
 		return ctrl.Result{}, nil
 	}
 
+	if err := r.recoverFromCancelledScaleDown(ctx, log, liveStatefulSet, newDesiredReplicas); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	statusReplicas := int(liveStatefulSet.Status.Replicas)
 	statusReadyReplicas := int(liveStatefulSet.Status.ReadyReplicas)
 	totalCurrentReplicas := int(liveStatefulSet.Status.CurrentReplicas)
@@ -224,6 +275,193 @@ func (r *RunnerSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	return ctrl.Result{}, nil
 }
 
+// drainForScaleDown gracefully stops the runner pods that are going to be removed by scaling the statefulset down
+// from current to desired replicas via ghc, and returns the number of replicas the statefulset can be scaled down to right now
+// without hard-killing any runner.
+//
+// A statefulset removes pods in the descending order of their ordinals. So we can scale it down only to
+// the highest ordinal whose runner hasn't completed unregistration, plus one.
+// All the pods to be removed are drained in parallel, and the rest of the scale-down happens in a later reconcilation.
+// The returned ctrl.Result is non-nil when any of the pods needs to be retried later.
+//
+// Note that this doesn't touch the persistent volume claims of the pods.
+// They are retained by the statefulset as usual, so that the data is reused when the statefulset is scaled up again.
+func (r *RunnerSetReconciler) drainForScaleDown(ctx context.Context, log logr.Logger, ghc *github.Client, sts *appsv1.StatefulSet, current, desired int) (int, *ctrl.Result, error) {
+	pods, err := r.podsByOrdinal(ctx, sts)
+	if err != nil {
+		log.Error(err, "Failed to list runner pods for scale-down")
+		return current, &ctrl.Result{}, err
+	}
+
+	var (
+		res      *ctrl.Result
+		firstErr error
+	)
+
+	replicas := current
+	stillDraining := false
+
+	for ordinal := current - 1; ordinal >= desired; ordinal-- {
+		pod, ok := pods[ordinal]
+
+		// A missing pod has never been created or is already gone, and a terminating pod is handled by the
+		// runnerpod controller that holds its finalizer.
+		// Either way, there's nothing to drain.
+		drained := !ok || !pod.DeletionTimestamp.IsZero()
+
+		if !drained && isPinned(pod) {
+			// The statefulset can only be scaled down by removing pods with the highest ordinals, so the pinned pod blocks
+			// scaling down past it. We stop here without draining pods with lower ordinals, which can't be removed anyway.
+			log.Info(
+				fmt.Sprintf("Pinned runner pod prevents scaling down statefulset below ordinal %d. Remove the pod manually or unpin it via the %s annotation to scale down", ordinal, AnnotationKeyPin),
+				"runnerpod", types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name},
+			)
+			break
+		}
+
+		if !drained {
+			podLog := log.WithValues("runnerpod", types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name})
+
+			enterprise, org, repo := runnerPodScope(pod)
+
+			_, podRes, err := r.tickGracefulStop(ctx, UnregistrationReasonScaleDown, podLog, ghc, r.Client, enterprise, org, repo, pod.Name, pod)
+			if isUnregistrationFailed(err) {
+				// We keep the pod as-is, which blocks the scale-down, so that operators can intervene.
+				podLog.Error(err, "Failed to unregister runner. Giving up until the cause is fixed")
+				r.Recorder.Event(pod, corev1.EventTypeWarning, "UnregistrationFailed", fmt.Sprintf("%s. Remove the %s annotation to retry", err.Error(), AnnotationKeyUnregistrationAttempts))
+				err = nil
+			} else if isInvalidRunnerScope(err) {
+				// Same as above. Retrying won't help until the runner pod has a valid scope.
+				r.Recorder.Event(pod, corev1.EventTypeWarning, "InvalidScope", err.Error())
+				err = nil
+			}
+
+			if podRes == nil {
+				drained = true
+			} else {
+				if res == nil {
+					res = podRes
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+
+		if !drained {
+			stillDraining = true
+		}
+
+		if drained && !stillDraining {
+			replicas = ordinal
+		}
+	}
+
+	if replicas != current {
+		log.Info("Scaling down statefulset after draining runner pods", "from", current, "to", replicas, "desired", desired)
+	} else {
+		log.V(1).Info("Waiting for runner pods to be drained before scaling down statefulset", "current", current, "desired", desired)
+	}
+
+	return replicas, res, firstErr
+}
+
+// recoverFromCancelledScaleDown resets the runner pods that started draining for a scale-down
+// that has been cancelled, by scaling up again before the scale-down completes.
+//
+// A pod whose runner has been unregistered is deleted so that the statefulset recreates it and the new runner registers itself again.
+// A pod that is still draining is just unmarked so that it isn't considered timed out on the next unregistration attempt.
+// Only the pods stopped with the scale-down unregistration reason are reset.
+func (r *RunnerSetReconciler) recoverFromCancelledScaleDown(ctx context.Context, log logr.Logger, sts *appsv1.StatefulSet, desired int) error {
+	pods, err := r.podsByOrdinal(ctx, sts)
+	if err != nil {
+		log.Error(err, "Failed to list runner pods")
+		return err
+	}
+
+	for ordinal, pod := range pods {
+		if ordinal >= desired || !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		// The runnerpod controller stops runner pods on its own, e.g. for a node drain or a restart.
+		// Those stops aren't cancelled by the replicas going back up, so we leave them as-is.
+		if unregistrationReasonOf(pod, "") != UnregistrationReasonScaleDown {
+			continue
+		}
+
+		if _, ok := getAnnotation(pod, unregistrationCompleteTimestamp()); ok {
+			if err := r.Delete(ctx, pod); err != nil && !errors.IsNotFound(err) {
+				log.Error(err, "Failed to delete unregistered runner pod after cancelled scale-down", "runnerpod", pod.Name)
+				return err
+			}
+
+			log.Info("Deleted unregistered runner pod to be recreated after cancelled scale-down", "runnerpod", pod.Name)
+
+			continue
+		}
+
+		if _, ok := getAnnotation(pod, unregistrationStartTimestamp()); ok {
+			updated := pod.DeepCopy()
+			delete(updated.Annotations, unregistrationStartTimestamp())
+			delete(updated.Annotations, legacyGracefulStopAnnotationKeys()[unregistrationStartTimestamp()])
+
+			if err := r.Patch(ctx, updated, client.MergeFrom(pod)); err != nil {
+				log.Error(err, "Failed to unmark runner pod as unregistering after cancelled scale-down", "runnerpod", pod.Name)
+				return err
+			}
+
+			log.Info("Unmarked runner pod as unregistering after cancelled scale-down", "runnerpod", pod.Name)
+		}
+	}
+
+	return nil
+}
+
+// podsByOrdinal returns the pods managed by the statefulset keyed by their ordinals.
+func (r *RunnerSetReconciler) podsByOrdinal(ctx context.Context, sts *appsv1.StatefulSet) (map[int]*corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var podList corev1.PodList
+	if err := r.List(ctx, &podList, client.InNamespace(sts.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+
+	pods := map[int]*corev1.Pod{}
+
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+
+		ordinal, ok := statefulSetPodOrdinal(sts, pod)
+		if !ok {
+			continue
+		}
+
+		pods[ordinal] = pod
+	}
+
+	return pods, nil
+}
+
+// statefulSetPodOrdinal returns the ordinal of the pod, which a statefulset gives to its pod as the name suffix like "-0".
+func statefulSetPodOrdinal(sts *appsv1.StatefulSet, pod *corev1.Pod) (int, bool) {
+	prefix := sts.Name + "-"
+
+	if !strings.HasPrefix(pod.Name, prefix) {
+		return 0, false
+	}
+
+	ordinal, err := strconv.Atoi(strings.TrimPrefix(pod.Name, prefix))
+	if err != nil || ordinal < 0 {
+		return 0, false
+	}
+
+	return ordinal, true
+}
+
 func getStatefulSetTemplateHash(rs *appsv1.StatefulSet) (string, bool) {
 	hash, ok := rs.Labels[LabelKeyRunnerTemplateHash]
 
@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRunnerSetReconciler_ScaleDown(t *testing.T) {
+	const runnersListBody = `
+{
+  "total_count": 2,
+  "runners": [
+    {"id": 1, "name": "example-runnerset-2", "os": "linux", "status": "online", "busy": false},
+    {"id": 2, "name": "example-runnerset-1", "os": "linux", "status": "online", "busy": false}
+  ]
+}
+`
+
+	const topOnlyRunnersListBody = `
+{
+  "total_count": 1,
+  "runners": [
+    {"id": 1, "name": "example-runnerset-2", "os": "linux", "status": "online", "busy": false}
+  ]
+}
+`
+
+	tests := []struct {
+		name             string
+		liveReplicas     int32
+		desiredReplicas  int32
+		runnersListBody  string
+		removeStatus     int
+		podAnnotations   map[int]map[string]string
+		wantReplicas     int32
+		wantErr          bool
+		wantUnregistered []int
+		wantDeleted      []int
+		wantUnmarked     []int
+		wantMarked       []int
+	}{
+		{
+			name:             "all pods to be removed are drained",
+			liveReplicas:     3,
+			desiredReplicas:  1,
+			runnersListBody:  runnersListBody,
+			removeStatus:     http.StatusNoContent,
+			wantReplicas:     1,
+			wantUnregistered: []int{1, 2},
+		},
+		{
+			name:             "highest ordinal is busy",
+			liveReplicas:     3,
+			desiredReplicas:  1,
+			runnersListBody:  runnersListBody,
+			removeStatus:     http.StatusUnprocessableEntity,
+			wantReplicas:     3,
+			wantUnregistered: []int{1},
+		},
+		{
+			name:             "lower ordinal is still draining",
+			liveReplicas:     3,
+			desiredReplicas:  1,
+			runnersListBody:  topOnlyRunnersListBody,
+			removeStatus:     http.StatusNoContent,
+			wantReplicas:     2,
+			wantUnregistered: []int{2},
+		},
+		{
+			name:            "highest ordinal is pinned",
+			liveReplicas:    3,
+			desiredReplicas: 1,
+			runnersListBody: runnersListBody,
+			removeStatus:    http.StatusNoContent,
+			podAnnotations: map[int]map[string]string{
+				2: {AnnotationKeyPin: "true"},
+			},
+			wantReplicas: 3,
+		},
+		{
+			name:            "lower ordinal is pinned",
+			liveReplicas:    3,
+			desiredReplicas: 1,
+			runnersListBody: runnersListBody,
+			removeStatus:    http.StatusNoContent,
+			podAnnotations: map[int]map[string]string{
+				1: {AnnotationKeyPin: "true"},
+			},
+			wantReplicas:     2,
+			wantUnregistered: []int{2},
+			wantUnmarked:     []int{1},
+		},
+		{
+			name:            "cancelled scale-down",
+			liveReplicas:    2,
+			desiredReplicas: 2,
+			runnersListBody: runnersListBody,
+			removeStatus:    http.StatusNoContent,
+			podAnnotations: map[int]map[string]string{
+				0: {
+					unregistrationStartTimestamp():    time.Now().Format(time.RFC3339),
+					AnnotationKeyUnregistrationReason: string(UnregistrationReasonScaleDown),
+				},
+				1: {
+					unregistrationStartTimestamp():    time.Now().Format(time.RFC3339),
+					unregistrationCompleteTimestamp(): time.Now().Format(time.RFC3339),
+					AnnotationKeyUnregistrationReason: string(UnregistrationReasonScaleDown),
+				},
+			},
+			wantReplicas: 2,
+			wantDeleted:  []int{1},
+			wantUnmarked: []int{0},
+		},
+		{
+			name:            "node drain isn't cancelled",
+			liveReplicas:    2,
+			desiredReplicas: 2,
+			runnersListBody: runnersListBody,
+			removeStatus:    http.StatusNoContent,
+			podAnnotations: map[int]map[string]string{
+				0: {
+					unregistrationStartTimestamp():    time.Now().Format(time.RFC3339),
+					AnnotationKeyUnregistrationReason: string(UnregistrationReasonNodeDrain),
+				},
+				1: {
+					unregistrationStartTimestamp():    time.Now().Format(time.RFC3339),
+					unregistrationCompleteTimestamp(): time.Now().Format(time.RFC3339),
+					AnnotationKeyUnregistrationReason: string(UnregistrationReasonNodeDrain),
+				},
+			},
+			wantReplicas: 2,
+			wantMarked:   []int{0, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fake.NewServer(
+				fake.WithListRunnersResponse(http.StatusOK, tt.runnersListBody),
+				fake.WithRemoveRunnerResponse(tt.removeStatus, ""),
+			)
+			defer server.Close()
+
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+			_ = appsv1.AddToScheme(scheme)
+			_ = v1alpha1.AddToScheme(scheme)
+
+			c := clientfake.NewClientBuilder().WithScheme(scheme).Build()
+
+			r := &RunnerSetReconciler{
+				Client:             c,
+				Log:                logr.Discard(),
+				Recorder:           record.NewFakeRecorder(10),
+				Scheme:             scheme,
+				RunnerImage:        "example/runner:test",
+				DockerImage:        "example/docker:test",
+				GitHubClient:       NewMultiGitHubClient(c, newGithubClient(server), github.Config{}),
+				GracefulStopConfig: GracefulStopConfig{UnregistrationTimeout: time.Hour, UnregistrationRetryDelay: time.Second},
+			}
+
+			ctx := context.Background()
+
+			runnerSet := &v1alpha1.RunnerSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "example-runnerset",
+				},
+				Spec: v1alpha1.RunnerSetSpec{
+					RunnerConfig: v1alpha1.RunnerConfig{
+						Repository: "test/valid",
+					},
+					StatefulSetSpec: appsv1.StatefulSetSpec{
+						Replicas: &tt.desiredReplicas,
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{
+								Containers: []corev1.Container{{Name: "runner"}},
+							},
+						},
+					},
+				},
+			}
+
+			if err := c.Create(ctx, runnerSet); err != nil {
+				t.Fatal(err)
+			}
+
+			sts, err := r.newStatefulSet(runnerSet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sts.Spec.Replicas = &tt.liveReplicas
+
+			if err := c.Create(ctx, sts); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < int(tt.liveReplicas); i++ {
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace:   "default",
+						Name:        fmt.Sprintf("%s-%d", sts.Name, i),
+						Labels:      sts.Spec.Template.Labels,
+						Annotations: tt.podAnnotations[i],
+					},
+					Spec: sts.Spec.Template.Spec,
+				}
+
+				if err := c.Create(ctx, pod); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: runnerSet.Name}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reconcile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var live appsv1.StatefulSet
+			if err := c.Get(ctx, client.ObjectKeyFromObject(sts), &live); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := *live.Spec.Replicas; got != tt.wantReplicas {
+				t.Errorf("unexpected statefulset replicas: got %d, want %d", got, tt.wantReplicas)
+			}
+
+			getPod := func(ordinal int) (*corev1.Pod, error) {
+				var pod corev1.Pod
+				err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: fmt.Sprintf("%s-%d", sts.Name, ordinal)}, &pod)
+				return &pod, err
+			}
+
+			for _, ordinal := range tt.wantUnregistered {
+				pod, err := getPod(ordinal)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, ok := getAnnotation(pod, unregistrationCompleteTimestamp()); !ok {
+					t.Errorf("expected pod %s to be unregistered", pod.Name)
+				}
+			}
+
+			for _, ordinal := range tt.wantDeleted {
+				if _, err := getPod(ordinal); !kerrors.IsNotFound(err) {
+					t.Errorf("expected pod with ordinal %d to be deleted, but got %v", ordinal, err)
+				}
+			}
+
+			for _, ordinal := range tt.wantUnmarked {
+				pod, err := getPod(ordinal)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, ok := getAnnotation(pod, unregistrationStartTimestamp()); ok {
+					t.Errorf("expected pod %s to be unmarked as unregistering", pod.Name)
+				}
+			}
+
+			for _, ordinal := range tt.wantMarked {
+				pod, err := getPod(ordinal)
+				if err != nil {
+					t.Fatalf("expected pod with ordinal %d to be kept: %v", ordinal, err)
+				}
+
+				if _, ok := getAnnotation(pod, unregistrationStartTimestamp()); !ok {
+					t.Errorf("expected pod %s to be kept marked as unregistering", pod.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestStatefulSetPodOrdinal(t *testing.T) {
+	sts := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "example-runnerset"}}
+
+	tests := []struct {
+		pod    string
+		want   int
+		wantOk bool
+	}{
+		{pod: "example-runnerset-0", want: 0, wantOk: true},
+		{pod: "example-runnerset-12", want: 12, wantOk: true},
+		{pod: "example-runnerset-foo", wantOk: false},
+		{pod: "other-runnerset-1", wantOk: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := statefulSetPodOrdinal(sts, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: tt.pod}})
+		if ok != tt.wantOk || got != tt.want {
+			t.Errorf("statefulSetPodOrdinal(%s) = (%d, %v), want (%d, %v)", tt.pod, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
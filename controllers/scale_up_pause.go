@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/go-logr/logr"
+)
+
+// minScaleUpPauseDelay is the minimum delay until checking again if scale ups can resume,
+// so that a rate limit about to be reset doesn't make the reconciliation spin.
+const minScaleUpPauseDelay = time.Second
+
+// rateLimitedUntil returns when the GitHub API rate limit of the client is expected to be reset. It's a variable so that tests can fake rate limits.
+var rateLimitedUntil = (*github.Client).RateLimitedUntil
+
+// scaleUpPauseDelay returns how long to wait before creating runner pods registered with the client, or zero if scale ups aren't paused.
+// pause makes the runner and runner set controllers pause creating runner pods while the GitHub API rate limit is exhausted,
+// as the runners can't be registered until the rate limit is reset anyway.
+// The graceful stops of the existing runners are not paused, so that scale downs can complete as soon as the rate limit allows.
+// Only the rate limit of the credentials of the client pauses the scale up, so that a tenant exhausting its own credentials doesn't
+// pause the runners using other credentials.
+func scaleUpPauseDelay(log logr.Logger, pause bool, ghc *github.Client, now time.Time) time.Duration {
+	if !pause {
+		return 0
+	}
+
+	until, ok := rateLimitedUntil(ghc)
+	if !ok {
+		return 0
+	}
+
+	d := until.Sub(now)
+	if d < minScaleUpPauseDelay {
+		d = minScaleUpPauseDelay
+	}
+
+	log.Info("Pausing scale up until the GitHub API rate limit is reset", "rateLimitResetTime", until, "delay", d)
+
+	return d
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/api/v1alpha1"
+	"github.com/actions-runner-controller/actions-runner-controller/github"
+	"github.com/actions-runner-controller/actions-runner-controller/github/fake"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRunnerReconciler_PauseScaleUpsOnRateLimit(t *testing.T) {
+	defer func() { rateLimitedUntil = (*github.Client).RateLimitedUntil }()
+
+	var (
+		reset       time.Time
+		rateLimited *github.Client
+	)
+
+	rateLimitedUntil = func(c *github.Client) (time.Time, bool) {
+		return reset, c == rateLimited && !reset.IsZero()
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	runner := &v1alpha1.Runner{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test1"},
+		Spec:       v1alpha1.RunnerSpec{RunnerConfig: v1alpha1.RunnerConfig{Repository: "test/valid"}},
+		Status: v1alpha1.RunnerStatus{Registration: v1alpha1.RunnerStatusRegistration{
+			Repository: "test/valid",
+			Token:      "token",
+			ExpiresAt:  metav1.NewTime(time.Now().Add(time.Hour)),
+		}},
+	}
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(runner).Build()
+
+	r := &RunnerReconciler{
+		Client:      c,
+		Log:         logr.Discard(),
+		Recorder:    record.NewFakeRecorder(10),
+		Scheme:      scheme,
+		RunnerImage: "example/runner:test",
+		DockerImage: "example/docker:test",
+
+		PauseScaleUpsOnRateLimit: true,
+	}
+
+	server := fake.NewServer(
+		fake.WithListRunnersResponse(http.StatusOK, fake.RunnersListBody),
+	)
+	defer server.Close()
+
+	ghc := newGithubClient(server)
+	rateLimited = ghc
+
+	key := types.NamespacedName{Namespace: runner.Namespace, Name: runner.Name}
+
+	podCreated := func() bool {
+		t.Helper()
+
+		var pod corev1.Pod
+		return c.Get(context.Background(), key, &pod) == nil
+	}
+
+	reset = time.Now().Add(10 * time.Minute)
+
+	res, err := r.processRunnerCreation(context.Background(), *runner, logr.Discard(), ghc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.RequeueAfter < 9*time.Minute || res.RequeueAfter > 10*time.Minute {
+		t.Errorf("expected the creation to be requeued until the rate limit is reset, got %v", res.RequeueAfter)
+	}
+
+	if podCreated() {
+		t.Fatalf("expected no runner pod to be created while the rate limit is exhausted")
+	}
+
+	reset = time.Time{}
+
+	if _, err := r.processRunnerCreation(context.Background(), *runner, logr.Discard(), ghc); err != nil {
+		t.Fatal(err)
+	}
+
+	if !podCreated() {
+		t.Errorf("expected the runner pod to be created once the rate limit is reset")
+	}
+}
+
+func TestScaleUpPauseDelay(t *testing.T) {
+	defer func() { rateLimitedUntil = (*github.Client).RateLimitedUntil }()
+
+	now := time.Now()
+
+	rateLimited, other := &github.Client{}, &github.Client{}
+
+	rateLimitedUntil = func(c *github.Client) (time.Time, bool) {
+		return now.Add(time.Millisecond), c == rateLimited
+	}
+
+	if d := scaleUpPauseDelay(logr.Discard(), false, rateLimited, now); d != 0 {
+		t.Errorf("expected scale ups not to be paused unless enabled, got %v", d)
+	}
+
+	if d := scaleUpPauseDelay(logr.Discard(), true, rateLimited, now); d != minScaleUpPauseDelay {
+		t.Errorf("expected the delay to be at least %v, got %v", minScaleUpPauseDelay, d)
+	}
+
+	if d := scaleUpPauseDelay(logr.Discard(), true, other, now); d != 0 {
+		t.Errorf("expected scale ups with other credentials not to be paused, got %v", d)
+	}
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// StartupReconcileRamp spreads the first reconciliations of the runners and runner pods that existed before the controller started
+// over the window, so that they don't all call GitHub API at once after a restart or an upgrade of the controller.
+// The same ramp is shared by the runner and runner pod controllers. Nil disables it.
+type StartupReconcileRamp struct {
+	start  time.Time
+	window time.Duration
+}
+
+// NewStartupReconcileRamp returns the ramp that makes the controllers spread the reconciliations of the objects that
+// existed before now over the window since now, by requeueing each of them until its own slot within the window.
+// The slot of an object is derived from its namespace and name, so that it stays the same across the reconciliations during the window.
+// Objects created after now aren't delayed. It returns nil for zero, which disables the ramp.
+// It should be called right before starting the controllers.
+func NewStartupReconcileRamp(window time.Duration) *StartupReconcileRamp {
+	if window <= 0 {
+		return nil
+	}
+
+	return &StartupReconcileRamp{start: time.Now(), window: window}
+}
+
+// delay returns the remaining duration until the slot of the object, or zero if it's due.
+func (r *StartupReconcileRamp) delay(obj client.Object, now time.Time) time.Duration {
+	if r == nil || !now.Before(r.start.Add(r.window)) {
+		return 0
+	}
+
+	if created := obj.GetCreationTimestamp(); !created.IsZero() && !created.Time.Before(r.start) {
+		return 0
+	}
+
+	hasher := fnv.New64a()
+	hasher.Write([]byte(obj.GetNamespace() + "/" + obj.GetName()))
+
+	slot := r.start.Add(time.Duration(hasher.Sum64() % uint64(r.window)))
+
+	return slot.Sub(now)
+}
+
+// startupReconcileDelay returns how long to requeue the reconciliation of the object for, per the startup reconcile ramp.
+func startupReconcileDelay(log logr.Logger, ramp *StartupReconcileRamp, obj client.Object, now time.Time) time.Duration {
+	d := ramp.delay(obj, now)
+	if d > 0 {
+		log.V(1).Info("Delaying the reconciliation to spread the reconciliations after the controller start", "delay", d)
+	}
+
+	return d
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStartupReconcileRamp_Staggered(t *testing.T) {
+	start := time.Now()
+	window := time.Minute
+
+	ramp := &StartupReconcileRamp{start: start, window: window}
+
+	delays := map[time.Duration]bool{}
+
+	for i := 0; i < 20; i++ {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: fmt.Sprintf("example-runnerset-%d", i)}}
+
+		d := ramp.delay(pod, start)
+		if d < 0 || d >= window {
+			t.Fatalf("delay of %s out of the window: %v", pod.Name, d)
+		}
+
+		delays[d] = true
+
+		// The slot stays the same across reconciliations, so the pod is reconciled once its slot comes.
+		if got := ramp.delay(pod, start.Add(d)); got != 0 {
+			t.Errorf("expected %s to be due at its slot, got delay %v", pod.Name, got)
+		}
+
+		if got := ramp.delay(pod, start.Add(window)); got != 0 {
+			t.Errorf("expected %s not to be delayed after the window, got %v", pod.Name, got)
+		}
+	}
+
+	if len(delays) < 15 {
+		t.Errorf("expected the reconciliations to be spread over the window, got %d distinct delays", len(delays))
+	}
+
+	created := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example-runnerset-new", CreationTimestamp: metav1.NewTime(start.Add(time.Second))}}
+
+	if got := ramp.delay(created, start.Add(2*time.Second)); got != 0 {
+		t.Errorf("expected the pod created after the start not to be delayed, got %v", got)
+	}
+}
+
+func TestRunnerPodReconciler_StartupReconcileRamp(t *testing.T) {
+	ramp := NewStartupReconcileRamp(time.Hour)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "example-runnerset-0",
+			Labels:    map[string]string{LabelKeyRunnerSetName: "example-runnerset"},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	r := &RunnerPodReconciler{Client: clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build(), Log: logr.Discard(), StartupReconcileRamp: ramp}
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ramp.delay(pod, time.Now())
+	if res.RequeueAfter <= 0 || res.RequeueAfter < want-time.Second || res.RequeueAfter > want+time.Second {
+		t.Errorf("unexpected requeue on the cold start: got %v, want about %v", res.RequeueAfter, want)
+	}
+
+	var got corev1.Pod
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Finalizers) != 0 {
+		t.Errorf("expected the delayed reconciliation not to touch the pod, got finalizers %v", got.Finalizers)
+	}
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// StoppedRunnerHistoryConfigMapKey is the key of the configmap data StoppedRunnerHistoryPersister saves the history into,
+	// as a JSON array of GracefulStopAuditRecord from the oldest to the newest.
+	StoppedRunnerHistoryConfigMapKey = "runners.json"
+
+	DefaultStoppedRunnerHistoryLimit      = 50
+	DefaultStoppedRunnerHistorySyncPeriod = time.Minute
+)
+
+// StoppedRunnerHistory keeps the records of the latest runners that completed or failed the unregistration, up to the limit.
+// The same history is shared by GracefulStopConfig, which adds the records, and StoppedRunnerHistoryPersister, which saves and restores them.
+type StoppedRunnerHistory struct {
+	mu      sync.Mutex
+	limit   int
+	records []GracefulStopAuditRecord
+
+	// version is incremented per record added, so that records added while saving aren't mistaken as saved.
+	version      int64
+	savedVersion int64
+}
+
+// NewStoppedRunnerHistory returns the history that keeps the records of the latest limit runners, pruning the oldest ones.
+func NewStoppedRunnerHistory(limit int) (*StoppedRunnerHistory, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid stopped runner history limit %d: must be positive", limit)
+	}
+
+	return &StoppedRunnerHistory{limit: limit}, nil
+}
+
+func (h *StoppedRunnerHistory) add(record GracefulStopAuditRecord) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records = append(h.records, record)
+	h.prune()
+	h.version++
+}
+
+// restore puts the records saved by a previous process before the records of this process.
+func (h *StoppedRunnerHistory) restore(saved []GracefulStopAuditRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records = append(append([]GracefulStopAuditRecord{}, saved...), h.records...)
+	h.prune()
+}
+
+// prune drops the oldest records beyond the limit. Must be called with h.mu held.
+func (h *StoppedRunnerHistory) prune() {
+	if over := len(h.records) - h.limit; over > 0 {
+		h.records = append([]GracefulStopAuditRecord{}, h.records[over:]...)
+	}
+}
+
+// snapshot returns the records from the oldest to the newest, along with the version of the history.
+func (h *StoppedRunnerHistory) snapshot() ([]GracefulStopAuditRecord, int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]GracefulStopAuditRecord{}, h.records...), h.version
+}
+
+// unsaved returns true if records have been added since the version was saved.
+func (h *StoppedRunnerHistory) unsaved() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.version != h.savedVersion
+}
+
+func (h *StoppedRunnerHistory) saved(version int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.savedVersion = version
+}
+
+// StoppedRunnerHistoryPersister saves the history of the runners stopped into a ConfigMap every SyncPeriod and on shutdown,
+// and restores it on start, so that the on-call can look back at the latest stopped runners without the controller logs,
+// e.g. with `kubectl get configmap NAME -o jsonpath='{.data.runners\.json}'`.
+// Like GracefulStopCountsPersister, it runs only on the leader.
+type StoppedRunnerHistoryPersister struct {
+	// Client writes the ConfigMap.
+	Client client.Client
+	// Reader reads the ConfigMap. It should bypass the cache, so that the controller doesn't need to watch all the ConfigMaps in the cluster.
+	Reader client.Reader
+	Log    logr.Logger
+
+	Namespace string
+	Name      string
+
+	SyncPeriod time.Duration
+
+	// History is the history to save and restore, which should be the StoppedRunnerHistory of the GracefulStopConfig of the controllers.
+	History *StoppedRunnerHistory
+}
+
+// Start implements manager.Runnable.
+func (p *StoppedRunnerHistoryPersister) Start(ctx context.Context) error {
+	if p.History == nil {
+		return nil
+	}
+
+	period := p.SyncPeriod
+	if period <= 0 {
+		period = DefaultStoppedRunnerHistorySyncPeriod
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	var restored bool
+
+	for {
+		if !restored {
+			// We never save before restoring, which would overwrite the saved history with the shorter history of this process.
+			if err := p.restore(ctx); err != nil {
+				p.Log.Error(err, "Failed to restore the stopped runner history. Retrying later.", "configmap", p.key())
+			} else {
+				restored = true
+			}
+		} else if err := p.save(ctx); err != nil {
+			p.Log.Error(err, "Failed to save the stopped runner history", "configmap", p.key())
+		}
+
+		select {
+		case <-ctx.Done():
+			if restored {
+				saveCtx, cancel := context.WithTimeout(context.Background(), gracefulStopCountsSaveTimeout)
+				if err := p.save(saveCtx); err != nil {
+					p.Log.Error(err, "Failed to save the stopped runner history on shutdown", "configmap", p.key())
+				}
+				cancel()
+			}
+
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *StoppedRunnerHistoryPersister) key() types.NamespacedName {
+	return types.NamespacedName{Namespace: p.Namespace, Name: p.Name}
+}
+
+func (p *StoppedRunnerHistoryPersister) restore(ctx context.Context) error {
+	var cm corev1.ConfigMap
+	if err := p.Reader.Get(ctx, p.key(), &cm); err != nil {
+		if kerrors.IsNotFound(err) {
+			// Nothing has been saved yet.
+			return nil
+		}
+
+		return err
+	}
+
+	var saved []GracefulStopAuditRecord
+
+	if v, ok := cm.Data[StoppedRunnerHistoryConfigMapKey]; ok {
+		if err := json.Unmarshal([]byte(v), &saved); err != nil {
+			return fmt.Errorf("invalid %s in configmap %s/%s: %w", StoppedRunnerHistoryConfigMapKey, cm.Namespace, cm.Name, err)
+		}
+	}
+
+	p.History.restore(saved)
+
+	p.Log.Info("Restored the stopped runner history", "configmap", p.key(), "records", len(saved))
+
+	return nil
+}
+
+// save saves the history, only when it has changed since the last save.
+func (p *StoppedRunnerHistoryPersister) save(ctx context.Context) error {
+	h := p.History
+
+	if !h.unsaved() {
+		return nil
+	}
+
+	records, version := h.snapshot()
+
+	v, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	if err := saveConfigMapData(ctx, p.Client, p.Reader, p.key(), map[string]string{StoppedRunnerHistoryConfigMapKey: string(v)}); err != nil {
+		return err
+	}
+
+	h.saved(version)
+
+	return nil
+}
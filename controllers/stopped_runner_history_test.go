@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func historyRunnerNames(records []GracefulStopAuditRecord) []string {
+	var names []string
+	for _, r := range records {
+		names = append(names, r.Runner)
+	}
+
+	return names
+}
+
+func TestStoppedRunnerHistory_Prune(t *testing.T) {
+	h, err := NewStoppedRunnerHistory(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"runner1", "runner2", "runner3", "runner4", "runner5"} {
+		h.add(GracefulStopAuditRecord{Runner: name})
+	}
+
+	records, _ := h.snapshot()
+	if d := cmp.Diff([]string{"runner3", "runner4", "runner5"}, historyRunnerNames(records)); d != "" {
+		t.Errorf("unexpected records (-want +got):\n%s", d)
+	}
+
+	// The records saved by the previous process are older than the ones of this process, so they're pruned first.
+	h, _ = NewStoppedRunnerHistory(3)
+	h.add(GracefulStopAuditRecord{Runner: "runner4"})
+	h.restore([]GracefulStopAuditRecord{{Runner: "runner1"}, {Runner: "runner2"}, {Runner: "runner3"}})
+
+	records, _ = h.snapshot()
+	if d := cmp.Diff([]string{"runner2", "runner3", "runner4"}, historyRunnerNames(records)); d != "" {
+		t.Errorf("unexpected records after restore (-want +got):\n%s", d)
+	}
+}
+
+func TestStoppedRunnerHistoryPersister_SaveAndRestore(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	c := clientfake.NewClientBuilder().WithScheme(scheme).Build()
+
+	before, _ := NewStoppedRunnerHistory(2)
+
+	p := &StoppedRunnerHistoryPersister{Client: c, Reader: c, Log: logr.Discard(), Namespace: "actions-runner-system", Name: "stopped-runners", History: before}
+
+	key := types.NamespacedName{Namespace: p.Namespace, Name: p.Name}
+
+	// Nothing is saved until a runner stops.
+	if err := p.save(context.Background()); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	var cm corev1.ConfigMap
+	if err := c.Get(context.Background(), key, &cm); err == nil {
+		t.Fatalf("expected the configmap not to be created for the empty history")
+	}
+
+	before.add(GracefulStopAuditRecord{Runner: "runner1", Phase: GracefulStopAuditPhaseCompleted})
+	before.add(GracefulStopAuditRecord{Runner: "runner2", Phase: GracefulStopAuditPhaseFailed, Error: "failed"})
+
+	if err := p.save(context.Background()); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	if err := c.Get(context.Background(), key, &cm); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unchanged history isn't saved again.
+	if err := p.save(context.Background()); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	var unchanged corev1.ConfigMap
+	if err := c.Get(context.Background(), key, &unchanged); err != nil {
+		t.Fatal(err)
+	}
+
+	if unchanged.ResourceVersion != cm.ResourceVersion {
+		t.Errorf("expected the unchanged history not to be saved")
+	}
+
+	after, _ := NewStoppedRunnerHistory(2)
+	after.add(GracefulStopAuditRecord{Runner: "runner3", Phase: GracefulStopAuditPhaseCompleted})
+
+	p.History = after
+
+	if err := p.restore(context.Background()); err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+
+	records, _ := after.snapshot()
+
+	want := []GracefulStopAuditRecord{
+		{Runner: "runner2", Phase: GracefulStopAuditPhaseFailed, Error: "failed"},
+		{Runner: "runner3", Phase: GracefulStopAuditPhaseCompleted},
+	}
+
+	if d := cmp.Diff(want, records); d != "" {
+		t.Errorf("unexpected records after restore (-want +got):\n%s", d)
+	}
+}
+
+func TestAuditGracefulStop_StoppedRunnerHistory(t *testing.T) {
+	history, err := NewStoppedRunnerHistory(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := GracefulStopConfig{StoppedRunnerHistory: history}
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "runner1"}}
+
+	now := time.Now()
+
+	auditGracefulStop(config, GracefulStopAuditPhaseStarted, now, "", "example", "", "runner1", pod, UnregistrationReasonScaleDown, 0, nil)
+	auditGracefulStop(config, GracefulStopAuditPhaseFailed, now, "", "example", "", "runner1", pod, UnregistrationReasonScaleDown, 3, errors.New("remove runner: 500"))
+
+	records, _ := history.snapshot()
+
+	want := []GracefulStopAuditRecord{{
+		Namespace:    "default",
+		Runner:       "runner1",
+		Organization: "example",
+		Phase:        GracefulStopAuditPhaseFailed,
+		Reason:       string(UnregistrationReasonScaleDown),
+		Timestamp:    now,
+		Attempts:     3,
+		Error:        "remove runner: 500",
+	}}
+
+	if d := cmp.Diff(want, records); d != "" {
+		t.Errorf("unexpected records (-want +got):\n%s", d)
+	}
+
+	if _, err := NewStoppedRunnerHistory(-1); err == nil {
+		t.Errorf("expected a negative limit to be rejected")
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ttlCache is an in-memory cache bounded in both size and age.
+// It evicts the least recently added entry once it reaches the size limit, and forgets entries after the TTL.
+// Keys must be comparable, as they are used as map keys.
+type ttlCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[interface{}]*list.Element
+}
+
+type ttlCacheEntry struct {
+	key     interface{}
+	value   interface{}
+	addedAt time.Time
+}
+
+func newTTLCache(size int, ttl time.Duration) *ttlCache {
+	return &ttlCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: map[interface{}]*list.Element{},
+	}
+}
+
+// add records the value for the key. Adding an existing key replaces the value and restarts its TTL.
+func (c *ttlCache) add(key, value interface{}, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+	}
+
+	c.entries[key] = c.order.PushBack(ttlCacheEntry{key: key, value: value, addedAt: now})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Front())
+	}
+}
+
+// get returns the value for the key unless it has been evicted or expired.
+func (c *ttlCache) get(key interface{}, now time.Time) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	return e.Value.(ttlCacheEntry).value, true
+}
+
+// pop is get that also forgets the key.
+func (c *ttlCache) pop(key interface{}, now time.Time) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.remove(e)
+
+	return e.Value.(ttlCacheEntry).value, true
+}
+
+// Must be called with c.mu held.
+func (c *ttlCache) expire(now time.Time) {
+	for e := c.order.Front(); e != nil; e = c.order.Front() {
+		if now.Sub(e.Value.(ttlCacheEntry).addedAt) < c.ttl {
+			return
+		}
+
+		c.remove(e)
+	}
+}
+
+// Must be called with c.mu held.
+func (c *ttlCache) remove(e *list.Element) {
+	delete(c.entries, e.Value.(ttlCacheEntry).key)
+	c.order.Remove(e)
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLCache(t *testing.T) {
+	now := time.Now()
+
+	c := newTTLCache(2, time.Minute)
+
+	c.add("a", 1, now)
+	c.add("b", 2, now.Add(30*time.Second))
+
+	// Adding an existing key replaces the value and restarts its TTL, which also makes it the most recently added one.
+	c.add("a", 3, now.Add(40*time.Second))
+
+	if v, ok := c.get("a", now.Add(time.Minute)); !ok || v != 3 {
+		t.Errorf("get(a) = %v, %v, want 3, true", v, ok)
+	}
+
+	c.add("c", 4, now.Add(time.Minute))
+
+	if _, ok := c.get("b", now.Add(time.Minute)); ok {
+		t.Errorf("b should have been evicted as the least recently added one")
+	}
+
+	if v, ok := c.pop("c", now.Add(time.Minute)); !ok || v != 4 {
+		t.Errorf("pop(c) = %v, %v, want 4, true", v, ok)
+	}
+
+	if _, ok := c.get("c", now.Add(time.Minute)); ok {
+		t.Errorf("c should have been forgotten once popped")
+	}
+
+	if _, ok := c.get("a", now.Add(100*time.Second)); ok {
+		t.Errorf("a should have been expired")
+	}
+}
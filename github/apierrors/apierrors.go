@@ -0,0 +1,240 @@
+// Package apierrors classifies the errors of GitHub API calls into typed errors,
+// so that callers can decide how to retry without inspecting go-github errors and HTTP responses themselves.
+//
+// Every error wraps the original error, so errors.As still finds e.g. the *github.ErrorResponse in the chain.
+package apierrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// RateLimited is returned when a GitHub API call failed due to the primary rate limit.
+// The caller is expected to retry after the rate limit is reset.
+type RateLimited struct {
+	Err error
+}
+
+func (e *RateLimited) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RateLimited) Unwrap() error {
+	return e.Err
+}
+
+// SecondaryRateLimited is returned when a GitHub API call failed due to the secondary rate limit, a.k.a. the abuse rate limit.
+// RetryAfter is the delay GitHub asked us to wait before retrying, or zero if GitHub didn't tell.
+type SecondaryRateLimited struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *SecondaryRateLimited) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SecondaryRateLimited) Unwrap() error {
+	return e.Err
+}
+
+// Transient is returned when a GitHub API call failed due to a network issue like a DNS resolution failure,
+// or a refused or reset connection. The caller is expected to retry later rather than treating it as an API error.
+type Transient struct {
+	Err error
+}
+
+func (e *Transient) Error() string {
+	return fmt.Sprintf("transient network error: %v", e.Err)
+}
+
+func (e *Transient) Unwrap() error {
+	return e.Err
+}
+
+// Forbidden is returned when a GitHub API call failed with 403 due to missing permissions, rather than rate limits.
+// Retrying won't help until the GitHub App or the token is granted the required permission.
+type Forbidden struct {
+	Operation string
+	Err       error
+}
+
+func (e *Forbidden) Error() string {
+	return fmt.Sprintf("permission denied to %s, the GitHub App needs the Administration (repository runners) or Self-hosted runners (organization runners) read and write permission, or the token needs the repo, admin:org, or manage_runners:enterprise scope: %v", e.Operation, e.Err)
+}
+
+func (e *Forbidden) Unwrap() error {
+	return e.Err
+}
+
+// NotFound is returned when a GitHub API call failed with 404, e.g. because the runner has already been removed.
+type NotFound struct {
+	Err error
+}
+
+func (e *NotFound) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NotFound) Unwrap() error {
+	return e.Err
+}
+
+// ScopeNotFound is returned when a GitHub API call failed with 404 because the enterprise, organization, or repository itself
+// doesn't exist or isn't visible to the credentials, e.g. because it has been deleted or renamed.
+// It's told apart from NotFound for a runner that has already been removed, as it's returned only for the calls without a runner in the path.
+// Retrying won't help until the scope is recreated or the runner is pointed at another scope.
+type ScopeNotFound struct {
+	// Scope describes the scope, e.g. "repository owner/repo".
+	Scope string
+	Err   error
+}
+
+func (e *ScopeNotFound) Error() string {
+	return fmt.Sprintf("%s not found on GitHub, it may have been deleted or renamed: %v", e.Scope, e.Err)
+}
+
+func (e *ScopeNotFound) Unwrap() error {
+	return e.Err
+}
+
+// Busy is returned when GitHub refused to remove a runner with 422 because the runner is running a job.
+// The caller is expected to retry after the job completes.
+type Busy struct {
+	Err error
+}
+
+func (e *Busy) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Busy) Unwrap() error {
+	return e.Err
+}
+
+// Classify wraps err returned by the GitHub API call named op in the error type that tells why the call failed.
+// err is returned as-is when it's nil, already classified, or none of the types applies.
+//
+// Network errors caused by the caller cancelling ctx are returned as-is, as retrying them won't help.
+func Classify(ctx context.Context, op string, err error) error {
+	if err == nil || isClassified(err) {
+		return err
+	}
+
+	// Note that errors.Is(err, &github.RateLimitError{}) never matches, as RateLimitError.Is compares the rate and the response too.
+	var (
+		rateLimitErr      *github.RateLimitError
+		abuseRateLimitErr *github.AbuseRateLimitError
+		resErr            *github.ErrorResponse
+	)
+
+	switch {
+	case errors.As(err, &rateLimitErr):
+		return &RateLimited{Err: err}
+	case errors.As(err, &abuseRateLimitErr):
+		return &SecondaryRateLimited{RetryAfter: abuseRateLimitErr.GetRetryAfter(), Err: err}
+	case errors.As(err, &resErr) && resErr.Response != nil:
+		switch resErr.Response.StatusCode {
+		case http.StatusForbidden:
+			if looksRateLimited(resErr) {
+				return err
+			}
+
+			return &Forbidden{Operation: op, Err: err}
+		case http.StatusNotFound:
+			return &NotFound{Err: err}
+		}
+
+		return err
+	}
+
+	if isNetworkError(ctx, err) {
+		return &Transient{Err: err}
+	}
+
+	return err
+}
+
+// ClassifyRemoveRunner is Classify for the GitHub API call to remove a runner,
+// which fails with 422 while the runner is running a job.
+func ClassifyRemoveRunner(ctx context.Context, err error) error {
+	var resErr *github.ErrorResponse
+	if !isClassified(err) && errors.As(err, &resErr) && resErr.Response != nil && resErr.Response.StatusCode == http.StatusUnprocessableEntity {
+		return &Busy{Err: err}
+	}
+
+	return Classify(ctx, "remove runner", err)
+}
+
+// ClassifyListRunners is Classify for the GitHub API call to list the runners of the scope,
+// which fails with 404 only when the scope itself is not found.
+func ClassifyListRunners(ctx context.Context, scope string, err error) error {
+	var resErr *github.ErrorResponse
+	if !isClassified(err) && errors.As(err, &resErr) && resErr.Response != nil && resErr.Response.StatusCode == http.StatusNotFound {
+		return &ScopeNotFound{Scope: scope, Err: err}
+	}
+
+	return Classify(ctx, "list runners", err)
+}
+
+func isClassified(err error) bool {
+	var (
+		rateLimited          *RateLimited
+		secondaryRateLimited *SecondaryRateLimited
+		transient            *Transient
+		forbidden            *Forbidden
+		notFound             *NotFound
+		scopeNotFound        *ScopeNotFound
+		busy                 *Busy
+	)
+
+	return errors.As(err, &rateLimited) ||
+		errors.As(err, &secondaryRateLimited) ||
+		errors.As(err, &transient) ||
+		errors.As(err, &forbidden) ||
+		errors.As(err, &notFound) ||
+		errors.As(err, &scopeNotFound) ||
+		errors.As(err, &busy)
+}
+
+// looksRateLimited returns true if the 403 response is due to rate limits.
+//
+// GitHub responds with 403 to both missing permissions and exceeded rate limits.
+// go-github already turns the latter into RateLimitError or AbuseRateLimitError, but we also look for the rate limit
+// headers and the message ourselves, so that a rate limit is never mistaken for missing permissions.
+func looksRateLimited(resErr *github.ErrorResponse) bool {
+	h := resErr.Response.Header
+
+	return h.Get("X-RateLimit-Remaining") == "0" || h.Get("Retry-After") != "" || strings.Contains(strings.ToLower(resErr.Message), "rate limit")
+}
+
+// isNetworkError returns true when the API call failed before getting any response from GitHub
+// due to a network issue that is likely to go away by retrying.
+func isNetworkError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var (
+		dnsErr *net.DNSError
+		opErr  *net.OpError
+		netErr net.Error
+	)
+
+	return errors.As(err, &dnsErr) ||
+		errors.As(err, &opErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.As(err, &netErr) && netErr.Timeout()
+}
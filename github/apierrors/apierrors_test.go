@@ -0,0 +1,186 @@
+package apierrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+)
+
+func errorResponse(status int, header http.Header, message string) *github.ErrorResponse {
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &github.ErrorResponse{
+		Response: &http.Response{StatusCode: status, Header: header, Request: &http.Request{Method: http.MethodGet}},
+		Message:  message,
+	}
+}
+
+func TestClassify(t *testing.T) {
+	retryAfter := time.Minute
+
+	tests := []struct {
+		name  string
+		err   error
+		check func(error) bool
+	}{
+		{
+			name: "rate limited",
+			err:  fmt.Errorf("failed to list runners: %w", &github.RateLimitError{Response: &http.Response{StatusCode: http.StatusForbidden}}),
+			check: func(err error) bool {
+				var e *RateLimited
+				return errors.As(err, &e)
+			},
+		},
+		{
+			name: "secondary rate limited",
+			err:  &github.AbuseRateLimitError{Response: &http.Response{StatusCode: http.StatusForbidden}, RetryAfter: &retryAfter},
+			check: func(err error) bool {
+				var e *SecondaryRateLimited
+				return errors.As(err, &e) && e.RetryAfter == retryAfter
+			},
+		},
+		{
+			name: "transient",
+			err:  &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+			check: func(err error) bool {
+				var e *Transient
+				return errors.As(err, &e)
+			},
+		},
+		{
+			name: "unexpected eof",
+			err:  io.ErrUnexpectedEOF,
+			check: func(err error) bool {
+				var e *Transient
+				return errors.As(err, &e)
+			},
+		},
+		{
+			name: "forbidden",
+			err:  errorResponse(http.StatusForbidden, nil, "Resource not accessible by integration"),
+			check: func(err error) bool {
+				var e *Forbidden
+				return errors.As(err, &e) && e.Operation == "list runners"
+			},
+		},
+		{
+			name: "403 with rate limit headers is not forbidden",
+			err:  errorResponse(http.StatusForbidden, http.Header{"X-Ratelimit-Remaining": []string{"0"}}, ""),
+			check: func(err error) bool {
+				var e *Forbidden
+				return !errors.As(err, &e)
+			},
+		},
+		{
+			name: "403 with rate limit message is not forbidden",
+			err:  errorResponse(http.StatusForbidden, nil, "You have exceeded a secondary rate limit"),
+			check: func(err error) bool {
+				var e *Forbidden
+				return !errors.As(err, &e)
+			},
+		},
+		{
+			name: "not found",
+			err:  errorResponse(http.StatusNotFound, nil, "Not Found"),
+			check: func(err error) bool {
+				var e *NotFound
+				return errors.As(err, &e)
+			},
+		},
+		{
+			name: "422 is not busy out of remove runner",
+			err:  errorResponse(http.StatusUnprocessableEntity, nil, "Bad request"),
+			check: func(err error) bool {
+				return !isClassified(err)
+			},
+		},
+		{
+			name: "server error",
+			err:  errorResponse(http.StatusInternalServerError, nil, ""),
+			check: func(err error) bool {
+				return !isClassified(err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify(context.Background(), "list runners", tt.err)
+
+			if !tt.check(got) {
+				t.Errorf("unexpected classification: %T: %v", got, got)
+			}
+
+			if !errors.Is(got, tt.err) {
+				t.Errorf("expected the classified error to wrap the original error: %v", got)
+			}
+		})
+	}
+}
+
+func TestClassify_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Classify(ctx, "list runners", &net.OpError{Op: "dial", Err: context.Canceled})
+
+	var e *Transient
+	if errors.As(err, &e) {
+		t.Errorf("expected errors due to the cancelled context not to be transient: %v", err)
+	}
+}
+
+func TestClassify_Idempotent(t *testing.T) {
+	err := Classify(context.Background(), "remove runner", errorResponse(http.StatusNotFound, nil, "Not Found"))
+	wrapped := fmt.Errorf("failed to remove runner: %w", err)
+
+	if got := Classify(context.Background(), "remove runner", wrapped); got != wrapped {
+		t.Errorf("expected the classified error to be returned as-is, got %v", got)
+	}
+}
+
+func TestClassifyRemoveRunner(t *testing.T) {
+	err := ClassifyRemoveRunner(context.Background(), errorResponse(http.StatusUnprocessableEntity, nil, "Bad request - Runner \"test1\" is still running a job\""))
+
+	var busy *Busy
+	if !errors.As(err, &busy) {
+		t.Errorf("expected 422 to be busy, got %T: %v", err, err)
+	}
+
+	err = ClassifyRemoveRunner(context.Background(), errorResponse(http.StatusForbidden, nil, "Resource not accessible by integration"))
+
+	var forbidden *Forbidden
+	if !errors.As(err, &forbidden) || forbidden.Operation != "remove runner" {
+		t.Errorf("expected 403 to be forbidden to remove runner, got %T: %v", err, err)
+	}
+}
+
+func TestClassifyListRunners(t *testing.T) {
+	err := ClassifyListRunners(context.Background(), "repository test/deleted", fmt.Errorf("failed to list runners: %w", errorResponse(http.StatusNotFound, nil, "Not Found")))
+
+	var scopeNotFound *ScopeNotFound
+	if !errors.As(err, &scopeNotFound) || scopeNotFound.Scope != "repository test/deleted" {
+		t.Errorf("expected 404 to be the scope not found, got %T: %v", err, err)
+	}
+
+	var notFound *NotFound
+	if errors.As(err, &notFound) {
+		t.Errorf("expected the scope not found not to be mistaken for a runner not found: %v", err)
+	}
+
+	err = ClassifyListRunners(context.Background(), "repository test/valid", errorResponse(http.StatusForbidden, nil, "Resource not accessible by integration"))
+
+	var forbidden *Forbidden
+	if !errors.As(err, &forbidden) || forbidden.Operation != "list runners" {
+		t.Errorf("expected 403 to be forbidden to list runners, got %T: %v", err, err)
+	}
+}
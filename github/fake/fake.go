@@ -21,6 +21,14 @@ const (
     {"id": 2, "name": "test2", "os": "linux", "status": "offline", "busy": false}
   ]
 }
+`
+
+	RateLimitsBody = `
+{
+  "resources": {
+    "core": {"limit": 5000, "remaining": 4999, "reset": 1372700873}
+  }
+}
 `
 )
 
@@ -73,6 +81,17 @@ func (h *MapHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// OAuthScopesHandler responds with the X-OAuth-Scopes header to emulate a request authenticated with a personal access token.
+type OAuthScopesHandler struct {
+	Scopes string
+}
+
+func (h *OAuthScopesHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("X-OAuth-Scopes", h.Scopes)
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, RateLimitsBody)
+}
+
 type ServerConfig struct {
 	*FixedResponses
 }
@@ -199,11 +218,27 @@ func NewServer(opts ...Option) *httptest.Server {
 			Body:   "",
 		},
 
+		// For RateLimits, which is used to validate token scopes
+		"/rate_limit": &Handler{
+			Status: http.StatusOK,
+			Body:   RateLimitsBody,
+		},
+
 		// For auto-scaling based on the number of queued(pending) workflow runs
 		"/repos/test/valid/actions/runs": config.FixedResponses.ListRepositoryWorkflowRuns,
+	}
+
+	// For auto-scaling based on the number of queued(pending) workflow jobs
+	if config.FixedResponses.ListWorkflowJobs != nil {
+		routes["/repos/test/valid/actions/runs/"] = config.FixedResponses.ListWorkflowJobs
+	}
+
+	if config.FixedResponses.RemoveRunner != nil {
+		routes["/repos/test/valid/actions/runners/1"] = config.FixedResponses.RemoveRunner
+	}
 
-		// For auto-scaling based on the number of queued(pending) workflow jobs
-		"/repos/test/valid/actions/runs/": config.FixedResponses.ListWorkflowJobs,
+	if config.FixedResponses.RateLimits != nil {
+		routes["/rate_limit"] = config.FixedResponses.RateLimits
 	}
 
 	mux := http.NewServeMux()
@@ -4,8 +4,10 @@ import "net/http"
 
 type FixedResponses struct {
 	ListRepositoryWorkflowRuns *Handler
-	ListWorkflowJobs           *MapHandler
+	ListWorkflowJobs           http.Handler
 	ListRunners                http.Handler
+	RemoveRunner               http.Handler
+	RateLimits                 http.Handler
 }
 
 type Option func(*ServerConfig)
@@ -46,3 +48,46 @@ func WithFixedResponses(responses *FixedResponses) Option {
 		c.FixedResponses = responses
 	}
 }
+
+func WithRemoveRunnerResponse(status int, body string) Option {
+	return func(c *ServerConfig) {
+		c.FixedResponses.RemoveRunner = &Handler{
+			Status: status,
+			Body:   body,
+		}
+	}
+}
+
+// WithOAuthScopes makes the fake server respond to the rate limits API with the X-OAuth-Scopes header
+// that GitHub returns for requests authenticated with a personal access token.
+func WithOAuthScopes(scopes string) Option {
+	return func(c *ServerConfig) {
+		c.FixedResponses.RateLimits = &OAuthScopesHandler{
+			Scopes: scopes,
+		}
+	}
+}
+
+// WithListRunnersHandler makes the fake server respond to the list runners API with the handler,
+// which is typically a ScriptedHandler.
+func WithListRunnersHandler(h http.Handler) Option {
+	return func(c *ServerConfig) {
+		c.FixedResponses.ListRunners = h
+	}
+}
+
+// WithRemoveRunnerHandler makes the fake server respond to the remove runner API for the runner with ID 1 with the handler,
+// which is typically a ScriptedHandler.
+func WithRemoveRunnerHandler(h http.Handler) Option {
+	return func(c *ServerConfig) {
+		c.FixedResponses.RemoveRunner = h
+	}
+}
+
+// WithListWorkflowJobsHandler makes the fake server respond to the list workflow jobs API with the handler,
+// which is typically a ScriptedHandler.
+func WithListWorkflowJobsHandler(h http.Handler) Option {
+	return func(c *ServerConfig) {
+		c.FixedResponses.ListWorkflowJobs = h
+	}
+}
@@ -0,0 +1,111 @@
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Response is a canned response of ScriptedHandler.
+type Response struct {
+	Status int
+	Body   string
+	Header http.Header
+}
+
+// RateLimitExceededResponse returns a response that go-github turns into *github.RateLimitError.
+//
+// The rate limit is reported to have been reset already, so that go-github keeps sending subsequent requests
+// rather than failing them locally until the reset time.
+func RateLimitExceededResponse() Response {
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", "5000")
+	h.Set("X-RateLimit-Remaining", "0")
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+
+	return Response{
+		Status: http.StatusForbidden,
+		Body:   `{"message": "API rate limit exceeded"}`,
+		Header: h,
+	}
+}
+
+// SecondaryRateLimitExceededResponse returns a response that go-github turns into *github.AbuseRateLimitError,
+// asking the client to retry after the duration.
+func SecondaryRateLimitExceededResponse(retryAfter time.Duration) Response {
+	h := http.Header{}
+	h.Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+
+	return Response{
+		Status: http.StatusForbidden,
+		Body:   `{"message": "You have exceeded a secondary rate limit", "documentation_url": "https://docs.github.com/rest/overview/resources-in-the-rest-api#abuse-rate-limits"}`,
+		Header: h,
+	}
+}
+
+// RunnerBusyResponse returns a response that GitHub returns on an attempt to remove a runner that is running a job.
+func RunnerBusyResponse(name string) Response {
+	return Response{
+		Status: http.StatusUnprocessableEntity,
+		Body:   fmt.Sprintf(`{"message": "Bad request - Runner \"%s\" is still running a job\""}`, name),
+	}
+}
+
+// Call is a request recorded by ScriptedHandler.
+type Call struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+}
+
+// ScriptedHandler responds to requests with Responses in order, recording each request.
+// Once all the responses are used up, the last one is repeated.
+type ScriptedHandler struct {
+	Responses []Response
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+func NewScriptedHandler(responses ...Response) *ScriptedHandler {
+	return &ScriptedHandler{Responses: responses}
+}
+
+func (h *ScriptedHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mu.Lock()
+	n := len(h.calls)
+	h.calls = append(h.calls, Call{Method: req.Method, Path: req.URL.Path, Query: req.URL.Query(), Header: req.Header.Clone()})
+	h.mu.Unlock()
+
+	if len(h.Responses) == 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if n >= len(h.Responses) {
+		n = len(h.Responses) - 1
+	}
+
+	res := h.Responses[n]
+
+	for k, vs := range res.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+
+	w.WriteHeader(res.Status)
+	fmt.Fprint(w, res.Body)
+}
+
+// Calls returns the requests handled so far.
+func (h *ScriptedHandler) Calls() []Call {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]Call(nil), h.calls...)
+}
@@ -2,23 +2,32 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/actions-runner-controller/actions-runner-controller/github/apierrors"
 	"github.com/actions-runner-controller/actions-runner-controller/github/metrics"
 	"github.com/actions-runner-controller/actions-runner-controller/logging"
 	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/go-logr/logr"
 	"github.com/google/go-github/v39/github"
 	"github.com/gregjones/httpcache"
+	"golang.org/x/net/http/httpproxy"
 	"golang.org/x/oauth2"
 )
 
+const (
+	// https://docs.github.com/en/developers/apps/building-oauth-apps/scopes-for-oauth-apps#requesting-updated-scopes
+	headerOAuthScopes = "X-Oauth-Scopes"
+)
+
 // Config contains configuration for Github client
 type Config struct {
 	EnterpriseURL     string `split_words:"true"`
@@ -32,9 +41,66 @@ type Config struct {
 	BasicauthPassword string `split_words:"true"`
 	RunnerGitHubURL   string `split_words:"true"`
 
+	// RequestsPerMinute caps the number of ListRunners and RemoveRunner API calls made per minute.
+	// Zero disables the cap.
+	RequestsPerMinute int `split_words:"true"`
+	// RequestsBurst is the number of API calls that can be made at once before RequestsPerMinute kicks in.
+	// Defaults to 1.
+	RequestsBurst int `split_words:"true"`
+	// OrganizationRequestsPerMinute reserves the part of RequestsPerMinute for each of the organizations, keyed by the organization name,
+	// so that API calls for one busy organization can't starve the others.
+	// API calls for a repository count toward the organization owning the repository.
+	// The reservation is the minimum, not the cap: an organization that used up its own reservation also makes calls
+	// from the remainder of RequestsPerMinute while no other call is waiting for it, and otherwise waits only for its own reservation.
+	// The rest of the organizations, repositories, and enterprises share the remainder, so the reservations must sum under RequestsPerMinute.
+	OrganizationRequestsPerMinute map[string]int `split_words:"true"`
+	// DisableRequestLimiterMetrics stops the request limiters of the client from reporting to the metrics,
+	// for clients in addition to the controller-wide one, which would otherwise overwrite the metrics of each other.
+	DisableRequestLimiterMetrics bool `ignored:"true"`
+
+	// DebugLog logs the ListRunners and RemoveRunner API calls at V(2), with credentials redacted.
+	DebugLog bool `split_words:"true"`
+
+	// ListRunnersTimeout is the timeout of each ListRunners API call, per page of runners.
+	// Zero disables the timeout.
+	ListRunnersTimeout time.Duration `split_words:"true"`
+	// RemoveRunnerTimeout is the timeout of each RemoveRunner API call.
+	// Zero disables the timeout.
+	RemoveRunnerTimeout time.Duration `split_words:"true"`
+
+	// ProxyURL is the URL of the proxy for GitHub API calls, like http://proxy.example.com:3128 or socks5://proxy.example.com:1080.
+	// When empty, the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY envvars are honored instead.
+	ProxyURL string `split_words:"true"`
+	// NoProxy is the comma-separated hosts, domains, IP addresses, and CIDRs that bypass ProxyURL, in the same format as NO_PROXY.
+	NoProxy string `split_words:"true"`
+
+	// ListRunnersPath overrides the path of the ListRunners API relative to the API base URL, for GitHub Enterprise Server versions
+	// that serve it under a different path. {scope} is replaced with repos/OWNER/REPO, orgs/ORG, or enterprises/ENTERPRISE.
+	// Defaults to DefaultListRunnersPath.
+	ListRunnersPath string `split_words:"true"`
+	// RemoveRunnerPath is like ListRunnersPath but for the RemoveRunner API. {runner_id} is replaced with the ID of the runner.
+	// Defaults to DefaultRemoveRunnerPath.
+	RemoveRunnerPath string `split_words:"true"`
+
+	// Transport is the base transport GitHub API calls are made with, e.g. to add mTLS to the egress proxy or custom retries.
+	// Requests go through the metrics, logging, caching, and authentication transports in this order before reaching Transport,
+	// so Transport sees the authenticated requests that missed the cache. Mutually exclusive with ProxyURL.
+	// Defaults to http.DefaultTransport.
+	Transport http.RoundTripper `ignored:"true"`
+
 	Log *logr.Logger
 }
 
+const (
+	// DefaultListRunnersPath is the path of the ListRunners API on GitHub and GitHub Enterprise Server.
+	DefaultListRunnersPath = "{scope}/actions/runners"
+	// DefaultRemoveRunnerPath is the path of the RemoveRunner API on GitHub and GitHub Enterprise Server.
+	DefaultRemoveRunnerPath = "{scope}/actions/runners/{runner_id}"
+
+	pathPlaceholderScope    = "{scope}"
+	pathPlaceholderRunnerID = "{runner_id}"
+)
+
 // Client wraps GitHub client with some additional
 type Client struct {
 	*github.Client
@@ -42,35 +108,263 @@ type Client struct {
 	mu        sync.Mutex
 	// GithubBaseURL to Github without API suffix.
 	GithubBaseURL string
+
+	limiter *requestLimiter
+	// orgLimiters are the request limiters reserved for the organizations, keyed by the lowercased organization names.
+	orgLimiters map[string]*requestLimiter
+
+	listRunnersTimeout  time.Duration
+	removeRunnerTimeout time.Duration
+
+	// listRunnersPath and removeRunnerPath are the overridden API paths. Empty ones use the go-github defaults.
+	listRunnersPath  string
+	removeRunnerPath string
+
+	// runnerGroups caches runner groups resolved by name. Use runnerGroupCache() to access it.
+	runnerGroups *runnerGroupCache
+
+	// rateLimitBreaker opens while the rate limit of the credentials of the client is exhausted.
+	rateLimitBreaker *rateLimitBreaker
 }
 
 type BasicAuthTransport struct {
 	Username string
 	Password string
+
+	// Transport is the underlying transport. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
 }
 
 func (p BasicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.SetBasicAuth(p.Username, p.Password)
-	return http.DefaultTransport.RoundTrip(req)
+
+	if p.Transport == nil {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	return p.Transport.RoundTrip(req)
+}
+
+type cacheBypassKey struct{}
+
+// WithoutCache returns a context that makes GitHub API calls revalidate cached responses with GitHub,
+// so that the results reflect changes made within the cache duration.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+type cacheInvalidationKey struct{}
+
+// WithCacheInvalidation returns a context that makes GitHub API calls drop the cached responses to the requests before making them.
+// Unlike WithoutCache, the responses are fetched from scratch without revalidating the cached ones, so that a stale cache entry
+// GitHub keeps revalidating as unchanged, or that outlives its max-age due to clock issues, is replaced with a fresh response.
+func WithCacheInvalidation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheInvalidationKey{}, true)
+}
+
+// cacheBypassTransport marks requests made with WithoutCache as no-cache for the underlying httpcache transport,
+// and drops the cached responses to requests made with WithCacheInvalidation from Cache.
+type cacheBypassTransport struct {
+	Transport http.RoundTripper
+	Cache     httpcache.Cache
+}
+
+func (t cacheBypassTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Cache != nil && req.Context().Value(cacheInvalidationKey{}) != nil {
+		t.Cache.Delete(cacheKey(req))
+	}
+
+	if req.Context().Value(cacheBypassKey{}) != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("Cache-Control", "no-cache")
+	}
+
+	return t.Transport.RoundTrip(req)
+}
+
+// cacheKey returns the key httpcache stores the response to the request with.
+func cacheKey(req *http.Request) string {
+	if req.Method == http.MethodGet {
+		return req.URL.String()
+	}
+
+	return req.Method + " " + req.URL.String()
+}
+
+type runnersListAgeKey struct{}
+
+// RunnersListAge tells how old the runners listed by ListRunners and ListRunnersWithFilter are.
+// GitHub allows caching the list for up to a minute, so a runner registered within the time may be missing in the list.
+type RunnersListAge struct {
+	// FromCache is true when any page of the list was served from the HTTP cache, including ones revalidated with GitHub.
+	FromCache bool
+	// Age is the time since GitHub produced the oldest page of the list, derived from the Date response header.
+	// It's zero when unknown.
+	Age time.Duration
+}
+
+// WithRunnersListAge returns a context that makes ListRunners and ListRunnersWithFilter record the age of the listed runners
+// into the returned RunnersListAge, so that the caller can tell if a runner missing in the list may be due to the cache.
+func WithRunnersListAge(ctx context.Context) (context.Context, *RunnersListAge) {
+	age := &RunnersListAge{}
+
+	return context.WithValue(ctx, runnersListAgeKey{}, age), age
+}
+
+func recordRunnersListAge(ctx context.Context, res *http.Response, now time.Time) {
+	age, ok := ctx.Value(runnersListAgeKey{}).(*RunnersListAge)
+	if !ok || res == nil {
+		return
+	}
+
+	if res.Header.Get(httpcache.XFromCache) != "" {
+		age.FromCache = true
+	}
+
+	if date, err := http.ParseTime(res.Header.Get("Date")); err == nil {
+		if d := now.Sub(date); d > age.Age {
+			age.Age = d
+		}
+	}
+}
+
+// Validate returns an error if the config has invalid values that would otherwise surface only on GitHub API calls.
+func (c *Config) Validate() error {
+	if c.ListRunnersTimeout < 0 {
+		return fmt.Errorf("list runners timeout must not be negative: %s", c.ListRunnersTimeout)
+	}
+
+	if c.RemoveRunnerTimeout < 0 {
+		return fmt.Errorf("remove runner timeout must not be negative: %s", c.RemoveRunnerTimeout)
+	}
+
+	if len(c.OrganizationRequestsPerMinute) > 0 {
+		if c.RequestsPerMinute <= 0 {
+			return errors.New("organization requests per minute require requests per minute to be set")
+		}
+
+		var reserved int
+		for org, n := range c.OrganizationRequestsPerMinute {
+			if org == "" || n <= 0 {
+				return fmt.Errorf("invalid organization requests per minute %q: %d: the organization must not be empty and the requests per minute must be positive", org, n)
+			}
+
+			reserved += n
+		}
+
+		if reserved >= c.RequestsPerMinute {
+			return fmt.Errorf("organization requests per minute sum to %d, which must be less than the requests per minute %d", reserved, c.RequestsPerMinute)
+		}
+	}
+
+	if c.ProxyURL != "" && c.Transport != nil {
+		return errors.New("proxy url can't be used with a custom transport: configure the proxy in the transport instead")
+	}
+
+	if c.ProxyURL != "" {
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid proxy url: %w", err)
+		}
+
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("invalid proxy url %q: scheme must be one of http, https, and socks5", logging.SanitizeURL(u))
+		}
+
+		if u.Host == "" {
+			return fmt.Errorf("invalid proxy url %q: missing host", logging.SanitizeURL(u))
+		}
+	}
+
+	if err := validateRunnersPath("list runners", c.ListRunnersPath); err != nil {
+		return err
+	}
+
+	if err := validateRunnersPath("remove runner", c.RemoveRunnerPath, pathPlaceholderRunnerID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateRunnersPath returns an error if the overridden API path can't be resolved against the API base URL,
+// or misses any of the required placeholders.
+func validateRunnersPath(api, path string, required ...string) error {
+	if path == "" {
+		return nil
+	}
+
+	u, err := url.Parse(strings.NewReplacer(pathPlaceholderScope, "scope", pathPlaceholderRunnerID, "1").Replace(path))
+	if err != nil {
+		return fmt.Errorf("invalid %s path %q: %w", api, path, err)
+	}
+
+	if u.IsAbs() || u.Host != "" || strings.HasPrefix(path, "/") || u.RawQuery != "" {
+		return fmt.Errorf("invalid %s path %q: must be relative to the API base URL without the leading slash and the query", api, path)
+	}
+
+	for _, p := range append([]string{pathPlaceholderScope}, required...) {
+		if !strings.Contains(path, p) {
+			return fmt.Errorf("invalid %s path %q: missing %s", api, path, p)
+		}
+	}
+
+	return nil
+}
+
+// baseTransport returns the transport GitHub API calls are made with, before authentication, caching, logging, and metrics.
+func (c *Config) baseTransport() http.RoundTripper {
+	if c.Transport != nil {
+		return c.Transport
+	}
+
+	if c.ProxyURL == "" {
+		return http.DefaultTransport
+	}
+
+	proxy := (&httpproxy.Config{
+		HTTPProxy:  c.ProxyURL,
+		HTTPSProxy: c.ProxyURL,
+		NoProxy:    c.NoProxy,
+	}).ProxyFunc()
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+
+	return tr
 }
 
-// NewClient creates a Github Client
+// NewClient creates a Github Client.
+//
+// Each API call goes through the transports in this order: metrics, logging, debug logging when DebugLog is set,
+// caching, authentication, and finally the base transport, which is Transport when set.
 func (c *Config) NewClient() (*Client, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	base := c.baseTransport()
+
 	var transport http.RoundTripper
 	if len(c.BasicauthUsername) > 0 && len(c.BasicauthPassword) > 0 {
-		transport = BasicAuthTransport{Username: c.BasicauthUsername, Password: c.BasicauthPassword}
+		transport = BasicAuthTransport{Username: c.BasicauthUsername, Password: c.BasicauthPassword, Transport: base}
 	} else if len(c.Token) > 0 {
-		transport = oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: c.Token})).Transport
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: base})
+		transport = oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: c.Token})).Transport
 	} else {
 		var tr *ghinstallation.Transport
 
 		if _, err := os.Stat(c.AppPrivateKey); err == nil {
-			tr, err = ghinstallation.NewKeyFromFile(http.DefaultTransport, c.AppID, c.AppInstallationID, c.AppPrivateKey)
+			tr, err = ghinstallation.NewKeyFromFile(base, c.AppID, c.AppInstallationID, c.AppPrivateKey)
 			if err != nil {
 				return nil, fmt.Errorf("authentication failed: using private key at %s: %v", c.AppPrivateKey, err)
 			}
 		} else {
-			tr, err = ghinstallation.New(http.DefaultTransport, c.AppID, c.AppInstallationID, []byte(c.AppPrivateKey))
+			tr, err = ghinstallation.New(base, c.AppID, c.AppInstallationID, []byte(c.AppPrivateKey))
 			if err != nil {
 				return nil, fmt.Errorf("authentication failed: using private key of size %d (%s...): %v", len(c.AppPrivateKey), strings.Split(c.AppPrivateKey, "\n")[0], err)
 			}
@@ -86,9 +380,16 @@ func (c *Config) NewClient() (*Client, error) {
 		transport = tr
 	}
 
-	cached := httpcache.NewTransport(httpcache.NewMemoryCache())
-	cached.Transport = transport
-	loggingTransport := logging.Transport{Transport: cached, Log: c.Log}
+	cache := httpcache.NewMemoryCache()
+	cached := httpcache.NewTransport(cache)
+	breaker := newRateLimitBreaker()
+	cached.Transport = rateLimitBreakerTransport{Transport: transport, breaker: breaker}
+	uncacheable := cacheBypassTransport{Transport: cached, Cache: cache}
+	var debuggable http.RoundTripper = uncacheable
+	if c.DebugLog {
+		debuggable = logging.DebugTransport{Transport: uncacheable, Log: c.Log}
+	}
+	loggingTransport := logging.Transport{Transport: debuggable, Log: c.Log}
 	metricsTransport := metrics.Transport{Transport: loggingTransport}
 	httpClient := &http.Client{Transport: metricsTransport}
 
@@ -137,14 +438,39 @@ func (c *Config) NewClient() (*Client, error) {
 
 	client.UserAgent = "actions-runner-controller"
 
+	var (
+		limiter     *requestLimiter
+		orgLimiters map[string]*requestLimiter
+	)
+	if c.RequestsPerMinute > 0 {
+		limiter, orgLimiters = newOrganizationRequestLimiters(c.RequestsPerMinute, c.RequestsBurst, c.OrganizationRequestsPerMinute, !c.DisableRequestLimiterMetrics)
+	}
+
 	return &Client{
-		Client:        client,
-		regTokens:     map[string]*github.RegistrationToken{},
-		mu:            sync.Mutex{},
-		GithubBaseURL: githubBaseURL,
+		Client:              client,
+		regTokens:           map[string]*github.RegistrationToken{},
+		mu:                  sync.Mutex{},
+		GithubBaseURL:       githubBaseURL,
+		limiter:             limiter,
+		orgLimiters:         orgLimiters,
+		listRunnersTimeout:  c.ListRunnersTimeout,
+		removeRunnerTimeout: c.RemoveRunnerTimeout,
+		listRunnersPath:     c.ListRunnersPath,
+		removeRunnerPath:    c.RemoveRunnerPath,
+		rateLimitBreaker:    breaker,
 	}, nil
 }
 
+// RunnerAPI is the part of the GitHub API that ARC uses to unregister runners.
+// Client is the default implementation. It allows unregistration to be tested against an in-memory implementation.
+type RunnerAPI interface {
+	ListRunners(ctx context.Context, enterprise, org, repo string) ([]*github.Runner, error)
+	ListRunnersWithFilter(ctx context.Context, enterprise, org, repo string, filter RunnerFilter) ([]*github.Runner, error)
+	RemoveRunner(ctx context.Context, enterprise, org, repo string, runnerID int64) error
+}
+
+var _ RunnerAPI = &Client{}
+
 // GetRegistrationToken returns a registration token tied with the name of repository and runner.
 func (c *Client) GetRegistrationToken(ctx context.Context, enterprise, org, repo, name string) (*github.RegistrationToken, error) {
 	c.mu.Lock()
@@ -207,6 +533,45 @@ func (c *Client) RemoveRunner(ctx context.Context, enterprise, org, repo string,
 
 // ListRunners returns a list of runners of specified owner/repository name.
 func (c *Client) ListRunners(ctx context.Context, enterprise, org, repo string) ([]*github.Runner, error) {
+	return c.ListRunnersWithFilter(ctx, enterprise, org, repo, RunnerFilter{})
+}
+
+// RunnerFilter narrows down the runners returned by ListRunnersWithFilter.
+// Empty fields match any runner.
+type RunnerFilter struct {
+	// Name is the exact name of the runner.
+	Name string
+	// Status is either "online" or "offline".
+	Status string
+	// All keeps listing the rest of the pages after the runner with the Name is found,
+	// so that all the runners with the Name are returned when GitHub lists more than one runner with the name,
+	// e.g. when the name is reused across runner groups.
+	All bool
+}
+
+func (f RunnerFilter) matches(runner *github.Runner) bool {
+	if f.Name != "" && runner.GetName() != f.Name {
+		return false
+	}
+
+	if f.Status != "" && runner.GetStatus() != f.Status {
+		return false
+	}
+
+	return true
+}
+
+// ListRunnersWithFilter returns the runners in the scope that match the filter.
+//
+// The runner name is sent to GitHub as the name query parameter, so that GitHub returns only the matching runner
+// rather than all the runners in the scope.
+// GitHub API has no way to filter runners by status, and older GitHub Enterprise Server versions ignore the name parameter,
+// so the filter is always applied to the listed runners on our side as well.
+//
+// Unless the filter sets All, the pagination stops as soon as a runner with the name is found.
+// That matters for large scopes like enterprises with thousands of runners, when GitHub ignores the name parameter.
+// Runner names aren't guaranteed to be unique within a scope though, so set All to find the duplicates.
+func (c *Client) ListRunnersWithFilter(ctx context.Context, enterprise, org, repo string, filter RunnerFilter) ([]*github.Runner, error) {
 	enterprise, owner, repo, err := getEnterpriseOrganizationAndRepo(enterprise, org, repo)
 
 	if err != nil {
@@ -217,14 +582,22 @@ func (c *Client) ListRunners(ctx context.Context, enterprise, org, repo string)
 
 	opts := github.ListOptions{PerPage: 100}
 	for {
-		list, res, err := c.listRunners(ctx, enterprise, owner, repo, &opts)
+		list, res, err := c.listRunners(ctx, enterprise, owner, repo, filter.Name, &opts)
 
 		if err != nil {
 			return runners, fmt.Errorf("failed to list runners: %w", err)
 		}
 
-		runners = append(runners, list.Runners...)
-		if res.NextPage == 0 {
+		found := false
+		for _, runner := range list.Runners {
+			if filter.Name != "" && runner.GetName() == filter.Name {
+				found = true
+			}
+			if filter.matches(runner) {
+				runners = append(runners, runner)
+			}
+		}
+		if (found && !filter.All) || res.NextPage == 0 {
 			break
 		}
 		opts.Page = res.NextPage
@@ -276,6 +649,108 @@ func (c *Client) ListRunnerGroupRepositoryAccesses(ctx context.Context, org stri
 	return repos, nil
 }
 
+// ValidateTokenScopes verifies that the token used by the client has the OAuth scopes required to
+// register and remove self-hosted runners for the enterprise, organization, or repository.
+//
+// GitHub tells the scopes only for OAuth and personal access tokens.
+// For other credentials like GitHub App installation tokens, this function assumes that the permissions are sufficient.
+func (c *Client) ValidateTokenScopes(ctx context.Context, enterprise, org, repo string) error {
+	_, res, err := c.Client.RateLimits(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get token scopes: %w", err)
+	}
+
+	header, ok := res.Header[headerOAuthScopes]
+	if !ok {
+		return nil
+	}
+
+	var granted []string
+	for _, h := range header {
+		for _, s := range strings.Split(h, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				granted = append(granted, s)
+			}
+		}
+	}
+
+	required := requiredTokenScopes(enterprise, org, repo)
+
+	for _, g := range granted {
+		for _, r := range required {
+			if g == r {
+				return nil
+			}
+		}
+	}
+
+	return &InsufficientTokenScopes{Required: required, Granted: granted}
+}
+
+// CheckRunnerPermissions verifies that the credentials of the client can list and remove runners in the enterprise, organization, or repository,
+// without changing any runner.
+//
+// The permission to remove runners is probed by creating a remove token, which requires the same permission but doesn't remove anything.
+// The token expires an hour later without being used.
+// It returns a *PermissionDenied or an *InsufficientTokenScopes error when the credentials lack the permission.
+func (c *Client) CheckRunnerPermissions(ctx context.Context, enterprise, org, repo string) error {
+	enterprise, owner, repo, err := getEnterpriseOrganizationAndRepo(enterprise, org, repo)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ValidateTokenScopes(ctx, enterprise, owner, repo); err != nil {
+		return err
+	}
+
+	if _, _, err := c.listRunners(ctx, enterprise, owner, repo, "", &github.ListOptions{PerPage: 1}); err != nil {
+		return fmt.Errorf("failed to list runners: %w", err)
+	}
+
+	if err := c.waitForRequest(ctx, owner); err != nil {
+		return err
+	}
+
+	if _, err := c.createRemoveToken(ctx, enterprise, owner, repo); err != nil {
+		return fmt.Errorf("failed to create remove token: %w", apierrors.Classify(ctx, "remove runners", err))
+	}
+
+	return nil
+}
+
+// requiredTokenScopes returns the scopes any of which grants the permission to manage runners in the scope.
+func requiredTokenScopes(enterprise, org, repo string) []string {
+	if len(repo) > 0 {
+		return []string{"repo"}
+	}
+	if len(org) > 0 {
+		return []string{"admin:org"}
+	}
+	return []string{"manage_runners:enterprise", "admin:enterprise"}
+}
+
+// DiscardRegistrationToken drops the registration token for the scope cached by GetRegistrationToken, if any.
+//
+// GitHub provides no API to revoke a registration token. It can only be left to expire, which happens an hour after its creation.
+// So this is the best we can do to reduce the exposure of the token, so that it is never handed out to new runners again.
+// It returns true when a token that had not expired yet was discarded. Discarding an expired token or a token that was
+// never cached is a no-op.
+func (c *Client) DiscardRegistrationToken(enterprise, org, repo string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := getRegistrationKey(org, repo, enterprise)
+
+	rt, ok := c.regTokens[key]
+	if !ok {
+		return false
+	}
+
+	delete(c.regTokens, key)
+
+	return rt.GetExpiresAt().After(time.Now())
+}
+
 // cleanup removes expired registration tokens.
 func (c *Client) cleanup() {
 	c.mu.Lock()
@@ -301,24 +776,197 @@ func (c *Client) createRegistrationToken(ctx context.Context, enterprise, org, r
 	return c.Client.Enterprise.CreateRegistrationToken(ctx, enterprise)
 }
 
-func (c *Client) removeRunner(ctx context.Context, enterprise, org, repo string, runnerID int64) (*github.Response, error) {
+func (c *Client) createRemoveToken(ctx context.Context, enterprise, org, repo string) (*github.Response, error) {
 	if len(repo) > 0 {
-		return c.Client.Actions.RemoveRunner(ctx, org, repo, runnerID)
+		_, res, err := c.Client.Actions.CreateRemoveToken(ctx, org, repo)
+		return res, err
 	}
 	if len(org) > 0 {
-		return c.Client.Actions.RemoveOrganizationRunner(ctx, org, runnerID)
+		_, res, err := c.Client.Actions.CreateOrganizationRemoveToken(ctx, org)
+		return res, err
+	}
+
+	// go-github v39 has no function for the enterprise remove token.
+	req, err := c.Client.NewRequest(http.MethodPost, fmt.Sprintf("enterprises/%v/actions/runners/remove-token", enterprise), nil)
+	if err != nil {
+		return nil, err
 	}
-	return c.Client.Enterprise.RemoveRunner(ctx, enterprise, runnerID)
+
+	return c.Client.Do(ctx, req, &github.RemoveToken{})
+}
+
+// waitForRequest blocks until the client is allowed to make another rate-limited API call for the organization.
+// org is empty for enterprise API calls.
+func (c *Client) waitForRequest(ctx context.Context, org string) error {
+	if c.limiter == nil {
+		return nil
+	}
+
+	var err error
+
+	if l, ok := c.orgLimiters[strings.ToLower(org)]; ok && org != "" {
+		err = l.WaitOrBorrow(ctx, c.limiter)
+	} else {
+		err = c.limiter.Wait(ctx)
+	}
+
+	if err != nil {
+		return fmt.Errorf("waiting for the github api request limiter: %w", err)
+	}
+
+	return nil
+}
+
+// withCallTimeout returns the context for a single GitHub API call that is cancelled after the timeout.
+// Zero timeout means no timeout.
+func withCallTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (c *Client) listRunners(ctx context.Context, enterprise, org, repo string, opts *github.ListOptions) (*github.Runners, *github.Response, error) {
+// wrapCallTimeout annotates err with the timeout when the API call failed because callCtx timed out,
+// rather than because the caller cancelled ctx.
+func wrapCallTimeout(ctx, callCtx context.Context, op string, timeout time.Duration, err error) error {
+	if err == nil || ctx.Err() != nil || !errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	return fmt.Errorf("%s timed out after %s: %w", op, timeout, err)
+}
+
+func (c *Client) removeRunner(ctx context.Context, enterprise, org, repo string, runnerID int64) (*github.Response, error) {
+	if err := c.waitForRequest(ctx, org); err != nil {
+		return nil, err
+	}
+
+	callCtx, cancel := withCallTimeout(ctx, c.removeRunnerTimeout)
+	defer cancel()
+
+	var (
+		res *github.Response
+		err error
+	)
+
+	if c.removeRunnerPath != "" {
+		res, err = c.removeRunnerByPath(callCtx, enterprise, org, repo, runnerID)
+	} else if len(repo) > 0 {
+		res, err = c.Client.Actions.RemoveRunner(callCtx, org, repo, runnerID)
+	} else if len(org) > 0 {
+		res, err = c.Client.Actions.RemoveOrganizationRunner(callCtx, org, runnerID)
+	} else {
+		res, err = c.Client.Enterprise.RemoveRunner(callCtx, enterprise, runnerID)
+	}
+
+	err = wrapCallTimeout(ctx, callCtx, "remove runner", c.removeRunnerTimeout, err)
+
+	return res, apierrors.ClassifyRemoveRunner(ctx, err)
+}
+
+func (c *Client) listRunners(ctx context.Context, enterprise, org, repo, name string, opts *github.ListOptions) (*github.Runners, *github.Response, error) {
+	if err := c.waitForRequest(ctx, org); err != nil {
+		return nil, nil, err
+	}
+
+	callCtx, cancel := withCallTimeout(ctx, c.listRunnersTimeout)
+	defer cancel()
+
+	var (
+		runners *github.Runners
+		res     *github.Response
+		err     error
+	)
+
+	if len(name) > 0 || c.listRunnersPath != "" {
+		runners, res, err = c.listRunnersByName(callCtx, enterprise, org, repo, name, opts)
+	} else if len(repo) > 0 {
+		runners, res, err = c.Client.Actions.ListRunners(callCtx, org, repo, opts)
+	} else if len(org) > 0 {
+		runners, res, err = c.Client.Actions.ListOrganizationRunners(callCtx, org, opts)
+	} else {
+		runners, res, err = c.Client.Enterprise.ListRunners(callCtx, enterprise, opts)
+	}
+
+	if res != nil {
+		recordRunnersListAge(ctx, res.Response, time.Now())
+	}
+
+	err = wrapCallTimeout(ctx, callCtx, "list runners", c.listRunnersTimeout, err)
+
+	return runners, res, apierrors.ClassifyListRunners(ctx, scopeName(enterprise, org, repo), err)
+}
+
+// listRunnersByName is equivalent to the ListRunners functions of go-github, except that it sends the name query parameter,
+// which go-github v39 has no option for, and honors the overridden path.
+// The name query parameter is omitted when name is empty.
+func (c *Client) listRunnersByName(ctx context.Context, enterprise, org, repo, name string, opts *github.ListOptions) (*github.Runners, *github.Response, error) {
+	path := c.listRunnersPath
+	if path == "" {
+		path = DefaultListRunnersPath
+	}
+
+	u := runnersPath(path, enterprise, org, repo, 0)
+
+	q := url.Values{}
+	if len(name) > 0 {
+		q.Set("name", name)
+	}
+	if opts.PerPage > 0 {
+		q.Set("per_page", strconv.Itoa(opts.PerPage))
+	}
+	if opts.Page > 0 {
+		q.Set("page", strconv.Itoa(opts.Page))
+	}
+
+	req, err := c.Client.NewRequest("GET", u+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	runners := new(github.Runners)
+	res, err := c.Client.Do(ctx, req, runners)
+	if err != nil {
+		return nil, res, err
+	}
+
+	return runners, res, nil
+}
+
+// removeRunnerByPath is equivalent to the RemoveRunner functions of go-github, except that it uses the overridden path.
+func (c *Client) removeRunnerByPath(ctx context.Context, enterprise, org, repo string, runnerID int64) (*github.Response, error) {
+	req, err := c.Client.NewRequest("DELETE", runnersPath(c.removeRunnerPath, enterprise, org, repo, runnerID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Client.Do(ctx, req, nil)
+}
+
+// runnersPath fills the placeholders of the runners API path for the scope and the runner.
+func runnersPath(path, enterprise, org, repo string, runnerID int64) string {
+	var scope string
 	if len(repo) > 0 {
-		return c.Client.Actions.ListRunners(ctx, org, repo, opts)
+		scope = fmt.Sprintf("repos/%v/%v", org, repo)
+	} else if len(org) > 0 {
+		scope = fmt.Sprintf("orgs/%v", org)
+	} else {
+		scope = fmt.Sprintf("enterprises/%v", enterprise)
 	}
-	if len(org) > 0 {
-		return c.Client.Actions.ListOrganizationRunners(ctx, org, opts)
+
+	return strings.NewReplacer(pathPlaceholderScope, scope, pathPlaceholderRunnerID, strconv.FormatInt(runnerID, 10)).Replace(path)
+}
+
+// scopeName describes the scope of the runners for error messages.
+func scopeName(enterprise, org, repo string) string {
+	if len(repo) > 0 {
+		return fmt.Sprintf("repository %s/%s", org, repo)
+	} else if len(org) > 0 {
+		return fmt.Sprintf("organization %s", org)
 	}
-	return c.Client.Enterprise.ListRunners(ctx, enterprise, opts)
+
+	return fmt.Sprintf("enterprise %s", enterprise)
 }
 
 func (c *Client) ListRepositoryWorkflowRuns(ctx context.Context, user string, repoName string) ([]*github.WorkflowRun, error) {
@@ -420,6 +1068,23 @@ func (e *RunnerNotFound) Error() string {
 	return fmt.Sprintf("runner %q not found", e.runnerName)
 }
 
+type InsufficientTokenScopes struct {
+	Required []string
+	Granted  []string
+}
+
+func (e *InsufficientTokenScopes) Error() string {
+	return fmt.Sprintf("token has insufficient scopes: any of %v is required but granted scopes are %v", e.Required, e.Granted)
+}
+
+// TransientNetworkError is returned when a GitHub API call failed due to a network issue.
+// It's kept for compatibility. See apierrors.Transient.
+type TransientNetworkError = apierrors.Transient
+
+// PermissionDenied is returned when a GitHub API call failed with 403 due to missing permissions, rather than rate limits.
+// It's kept for compatibility. See apierrors.Forbidden.
+type PermissionDenied = apierrors.Forbidden
+
 type RunnerOffline struct {
 	runnerName string
 }
@@ -428,20 +1093,31 @@ func (e *RunnerOffline) Error() string {
 	return fmt.Sprintf("runner %q offline", e.runnerName)
 }
 
+// IsRunnerBusy returns true if the runner registered with the name is running a job, without changing anything on GitHub.
+// It lists the runners the same way as GetRunner does, so the ListRunners responses cached for up to 60 seconds are reused.
+// It returns RunnerNotFound if the runner isn't registered, and the busy flag along with RunnerOffline if it's offline.
 func (r *Client) IsRunnerBusy(ctx context.Context, enterprise, org, repo, name string) (bool, error) {
-	runners, err := r.ListRunners(ctx, enterprise, org, repo)
+	runner, err := r.GetRunner(ctx, enterprise, org, repo, name)
+
+	return runner.GetBusy(), err
+}
+
+// GetRunner returns the runner registered with the name.
+// It returns RunnerNotFound if the runner isn't registered, and the runner along with RunnerOffline if it's offline.
+func (r *Client) GetRunner(ctx context.Context, enterprise, org, repo, name string) (*github.Runner, error) {
+	runners, err := r.ListRunnersWithFilter(ctx, enterprise, org, repo, RunnerFilter{Name: name})
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	for _, runner := range runners {
 		if runner.GetName() == name {
 			if runner.GetStatus() == "offline" {
-				return runner.GetBusy(), &RunnerOffline{runnerName: name}
+				return runner, &RunnerOffline{runnerName: name}
 			}
-			return runner.GetBusy(), nil
+			return runner, nil
 		}
 	}
 
-	return false, &RunnerNotFound{runnerName: name}
+	return nil, &RunnerNotFound{runnerName: name}
 }
@@ -13,7 +13,7 @@ import (
 )
 
 func init() {
-	metrics.Registry.MustRegister(metricRateLimit, metricRateLimitRemaining)
+	metrics.Registry.MustRegister(metricRateLimit, metricRateLimitRemaining, metricRequestLimiterWaitingRequests, metricOrganizationRequestLimiterWaitingRequests, metricRateLimitBreakerOpen)
 }
 
 var (
@@ -30,6 +30,25 @@ var (
 			Help: "The number of requests remaining in the current rate limit window",
 		},
 	)
+	metricRequestLimiterWaitingRequests = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "github_request_limiter_waiting_requests",
+			Help: "The number of requests of the controller-wide GitHub API client waiting for the configured requests-per-minute cap",
+		},
+	)
+	metricOrganizationRequestLimiterWaitingRequests = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_organization_request_limiter_waiting_requests",
+			Help: "The number of requests of the controller-wide GitHub API client waiting for the requests per minute reserved for the organization",
+		},
+		[]string{"organization"},
+	)
+	metricRateLimitBreakerOpen = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "github_rate_limit_breaker_open",
+			Help: "The number of GitHub API credentials whose rate limit is exhausted until it's reset as seen in the responses to the controller, during which scale ups of the runners using the credentials are paused with --pause-scale-ups-on-rate-limit",
+		},
+	)
 )
 
 const (
@@ -61,3 +80,22 @@ func parseResponse(resp *http.Response) {
 		metricRateLimitRemaining.Set(float64(rateLimitRemaining))
 	}
 }
+
+// SetRequestLimiterWaitingRequests records the number of requests waiting for the client-side request limiter.
+func SetRequestLimiterWaitingRequests(waiting int) {
+	metricRequestLimiterWaitingRequests.Set(float64(waiting))
+}
+
+// SetOrganizationRequestLimiterWaitingRequests records the number of requests waiting for the client-side request limiter reserved for the organization.
+func SetOrganizationRequestLimiterWaitingRequests(organization string, waiting int) {
+	metricOrganizationRequestLimiterWaitingRequests.WithLabelValues(organization).Set(float64(waiting))
+}
+
+// RecordRateLimitBreakerChange records that the rate limit breaker of a GitHub API client opened or closed.
+func RecordRateLimitBreakerChange(open bool) {
+	if open {
+		metricRateLimitBreakerOpen.Inc()
+	} else {
+		metricRateLimitBreakerOpen.Dec()
+	}
+}
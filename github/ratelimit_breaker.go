@@ -0,0 +1,152 @@
+package github
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/metrics"
+)
+
+// DefaultRateLimitBreakerOpenDuration is how long the rate limit breaker stays open
+// when GitHub tells neither when the rate limit is reset nor how long to wait before retrying.
+const DefaultRateLimitBreakerOpenDuration = time.Minute
+
+// rateLimitBreaker is the circuit breaker that opens when GitHub API responses tell that the rate limit is exhausted,
+// and closes when the rate limit is reset or a response tells that the quota is back.
+//
+// GitHub API rate limits are per credentials, so each Client has its own breaker, shared by all the controllers using the client,
+// so that e.g. the rate limit hit by the runner controller also pauses the scale ups of the runner set controller with the same credentials,
+// while runners using other credentials keep being scaled up.
+type rateLimitBreaker struct {
+	mu sync.Mutex
+
+	// openUntil is when the rate limit is expected to be reset. Zero while the breaker is closed.
+	openUntil time.Time
+
+	now func() time.Time
+
+	// report records whether the breaker is open whenever it changes.
+	report func(open bool)
+}
+
+func newRateLimitBreaker() *rateLimitBreaker {
+	return &rateLimitBreaker{
+		now:    time.Now,
+		report: metrics.RecordRateLimitBreakerChange,
+	}
+}
+
+// RateLimitedUntil returns when the GitHub API rate limit hit by the client is expected to be reset,
+// and true as long as the time hasn't come yet. Callers use it to pause work that only makes sense with the API quota left,
+// like creating runner pods that need to be registered to GitHub.
+func (c *Client) RateLimitedUntil() (time.Time, bool) {
+	return c.rateLimitBreaker.openUntilNow()
+}
+
+func (b *rateLimitBreaker) openUntilNow() (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return time.Time{}, false
+	}
+
+	if !b.now().Before(b.openUntil) {
+		b.setOpenUntil(time.Time{})
+		return time.Time{}, false
+	}
+
+	return b.openUntil, true
+}
+
+// Close stops the client from reporting its rate limit breaker to the metrics,
+// so that the client that's replaced by another, e.g. for updated credentials, isn't counted as open forever.
+// The client keeps working afterwards.
+func (c *Client) Close() {
+	c.rateLimitBreaker.close()
+}
+
+// close stops reporting, reporting the breaker as closed first if it's open.
+func (b *rateLimitBreaker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.openUntil.IsZero() && b.report != nil {
+		b.report(false)
+	}
+
+	b.report = nil
+}
+
+// observe opens or closes the breaker according to the rate limit headers of the response.
+func (b *rateLimitBreaker) observe(resp *http.Response) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	remaining := resp.Header.Get(headerRateLimitRemaining)
+
+	if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && isRateLimitStatus(resp.StatusCode) {
+		// The secondary rate limit tells how long to wait instead of when it's reset.
+		b.setOpenUntil(now.Add(time.Duration(retryAfter) * time.Second))
+		return
+	}
+
+	if remaining == "0" {
+		until := now.Add(DefaultRateLimitBreakerOpenDuration)
+		if reset, err := strconv.ParseInt(resp.Header.Get(headerRateLimitReset), 10, 64); err == nil {
+			until = time.Unix(reset, 0)
+		}
+
+		if !until.After(now) {
+			until = time.Time{}
+		}
+
+		b.setOpenUntil(until)
+		return
+	}
+
+	if remaining != "" && !isRateLimitStatus(resp.StatusCode) {
+		b.setOpenUntil(time.Time{})
+	}
+}
+
+// Must be called with b.mu held.
+func (b *rateLimitBreaker) setOpenUntil(until time.Time) {
+	wasOpen := !b.openUntil.IsZero()
+
+	b.openUntil = until
+
+	if open := !until.IsZero(); open != wasOpen && b.report != nil {
+		b.report(open)
+	}
+}
+
+func isRateLimitStatus(code int) bool {
+	return code == http.StatusForbidden || code == http.StatusTooManyRequests
+}
+
+const (
+	headerRateLimitRemaining = "X-RateLimit-Remaining"
+	headerRateLimitReset     = "X-RateLimit-Reset"
+)
+
+// rateLimitBreakerTransport feeds the responses of GitHub API calls to the rate limit breaker.
+// It's placed under the HTTP cache, so that responses served from the cache with outdated rate limit headers are never observed.
+type rateLimitBreakerTransport struct {
+	Transport http.RoundTripper
+
+	breaker *rateLimitBreaker
+}
+
+func (t rateLimitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Transport.RoundTrip(req)
+	if resp != nil {
+		t.breaker.observe(resp)
+	}
+
+	return resp, err
+}
@@ -0,0 +1,120 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func rateLimitResponse(code int, headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: code, Header: http.Header{}}
+	for k, v := range headers {
+		resp.Header.Set(k, v)
+	}
+
+	return resp
+}
+
+func TestRateLimitBreaker(t *testing.T) {
+	now := time.Now()
+
+	var reported []bool
+
+	b := newRateLimitBreaker()
+	b.now = func() time.Time { return now }
+	b.report = func(open bool) { reported = append(reported, open) }
+
+	expectOpenUntil := func(want time.Time) {
+		t.Helper()
+
+		until, open := b.openUntilNow()
+		if open != !want.IsZero() || !until.Equal(want) {
+			t.Errorf("unexpected state of the breaker: got open = %v until %v, want until %v", open, until, want)
+		}
+	}
+
+	b.observe(rateLimitResponse(http.StatusOK, map[string]string{"X-RateLimit-Remaining": "10"}))
+	expectOpenUntil(time.Time{})
+
+	reset := now.Add(30 * time.Minute).Truncate(time.Second)
+
+	// The last request allowed before the reset succeeds with no quota left.
+	b.observe(rateLimitResponse(http.StatusOK, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(reset.Unix(), 10)}))
+	expectOpenUntil(reset)
+
+	// A response failed for another reason doesn't tell the quota is back.
+	b.observe(rateLimitResponse(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "5"}))
+	expectOpenUntil(reset)
+
+	b.observe(rateLimitResponse(http.StatusOK, map[string]string{"X-RateLimit-Remaining": "4999"}))
+	expectOpenUntil(time.Time{})
+
+	b.observe(rateLimitResponse(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "100", "Retry-After": "60"}))
+	expectOpenUntil(now.Add(time.Minute))
+
+	// The breaker closes by itself once the rate limit is reset, even without any response.
+	now = now.Add(time.Minute)
+	expectOpenUntil(time.Time{})
+
+	if got, want := reported, []bool{true, false, true, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected reported states: got %v, want %v", got, want)
+	}
+}
+
+func TestRateLimitBreaker_Close(t *testing.T) {
+	now := time.Now()
+
+	var reported []bool
+
+	b := newRateLimitBreaker()
+	b.now = func() time.Time { return now }
+	b.report = func(open bool) { reported = append(reported, open) }
+
+	b.observe(rateLimitResponse(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "Retry-After": "60"}))
+	b.close()
+
+	// The closed breaker still opens and closes, but isn't reported anymore.
+	b.observe(rateLimitResponse(http.StatusOK, map[string]string{"X-RateLimit-Remaining": "4999"}))
+	b.observe(rateLimitResponse(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "Retry-After": "60"}))
+
+	if _, open := b.openUntilNow(); !open {
+		t.Error("expected the breaker to keep working after close")
+	}
+
+	if got, want := reported, []bool{true, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected reported states: got %v, want %v", got, want)
+	}
+}
+
+func TestRateLimitedUntil(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message": "API rate limit exceeded"}`))
+	}))
+	defer srv.Close()
+
+	client := newTestClientForServer(t, srv)
+
+	if _, err := client.ListRunners(context.Background(), "", "", "test/valid"); err == nil {
+		t.Fatal("expected the rate limit error but got none")
+	}
+
+	until, ok := client.RateLimitedUntil()
+	if !ok || !until.Equal(reset) {
+		t.Errorf("RateLimitedUntil() = %v, %v, want %v, true", until, ok, reset)
+	}
+
+	// Another client, e.g. one created from the credentials of another tenant, has its own rate limit.
+	if until, ok := newTestClient().RateLimitedUntil(); ok {
+		t.Errorf("expected the rate limit of another client not to be exhausted, got RateLimitedUntil() = %v, %v", until, ok)
+	}
+}
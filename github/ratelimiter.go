@@ -0,0 +1,132 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/actions-runner-controller/actions-runner-controller/github/metrics"
+	"golang.org/x/time/rate"
+)
+
+// requestLimiter caps the rate of GitHub API requests made by the client.
+//
+// It lets up to `burst` requests through at once and refills at the configured rate.
+// Each gated request blocks until it's allowed or the context is done.
+type requestLimiter struct {
+	*rate.Limiter
+
+	// waiting is the number of requests waiting for the limiter.
+	waiting int64
+
+	// report records the number of waiting requests whenever it changes. Nil disables it.
+	report func(waiting int)
+}
+
+func newRequestLimiter(requestsPerMinute, burst int) *requestLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &requestLimiter{
+		Limiter: rate.NewLimiter(rate.Limit(float64(requestsPerMinute)/60), burst),
+	}
+}
+
+// newOrganizationRequestLimiters returns the request limiters that guarantee the requests per minute for each of the organizations,
+// keyed by the lowercased organization names, along with the shared limiter for the rest of the requestsPerMinute.
+// The limiters report to the metrics when reportMetrics is true.
+func newOrganizationRequestLimiters(requestsPerMinute, burst int, reservations map[string]int, reportMetrics bool) (*requestLimiter, map[string]*requestLimiter) {
+	shared := requestsPerMinute
+
+	var limiters map[string]*requestLimiter
+
+	if len(reservations) > 0 {
+		limiters = make(map[string]*requestLimiter, len(reservations))
+	}
+
+	for org, reserved := range reservations {
+		org := strings.ToLower(org)
+
+		l := newRequestLimiter(reserved, burst)
+		if reportMetrics {
+			l.report = func(waiting int) {
+				metrics.SetOrganizationRequestLimiterWaitingRequests(org, waiting)
+			}
+		}
+
+		limiters[org] = l
+		shared -= reserved
+	}
+
+	l := newRequestLimiter(shared, burst)
+	if reportMetrics {
+		l.report = metrics.SetRequestLimiterWaitingRequests
+	}
+
+	return l, limiters
+}
+
+// Wait blocks until a request is allowed to be made, or the context is done.
+func (l *requestLimiter) Wait(ctx context.Context) error {
+	l.reportWaiting(atomic.AddInt64(&l.waiting, 1))
+	defer func() {
+		l.reportWaiting(atomic.AddInt64(&l.waiting, -1))
+	}()
+
+	return l.Limiter.Wait(ctx)
+}
+
+// WaitOrBorrow blocks until a request is allowed by the limiter, or the context is done,
+// except that the request is let through right away when the limiter has no capacity left but the fallback limiter
+// has capacity to spare, i.e. no other request is waiting for it.
+func (l *requestLimiter) WaitOrBorrow(ctx context.Context, fallback *requestLimiter) error {
+	r := l.Limiter.Reserve()
+	if !r.OK() {
+		return fallback.Wait(ctx)
+	}
+
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	if fallback.Allow() {
+		r.Cancel()
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		r.Cancel()
+		return fmt.Errorf("rate: Wait(n=1) would exceed context deadline")
+	}
+
+	l.reportWaiting(atomic.AddInt64(&l.waiting, 1))
+	defer func() {
+		l.reportWaiting(atomic.AddInt64(&l.waiting, -1))
+	}()
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+// Waiting returns the number of requests waiting for the limiter.
+func (l *requestLimiter) Waiting() int {
+	return int(atomic.LoadInt64(&l.waiting))
+}
+
+func (l *requestLimiter) reportWaiting(waiting int64) {
+	if l.report != nil {
+		l.report(int(waiting))
+	}
+}
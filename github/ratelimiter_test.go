@@ -0,0 +1,227 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestLimiter_Burst(t *testing.T) {
+	l := newRequestLimiter(1, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatalf("[%d] unexpected error: %v", i, err)
+		}
+	}
+
+	if l.Allow() {
+		t.Errorf("expected the limiter to disallow requests after exhausting the burst")
+	}
+}
+
+func TestRequestLimiter_BlocksWhenExhausted(t *testing.T) {
+	// 600 requests per minute refills a token every 100ms
+	l := newRequestLimiter(600, 1)
+
+	ctx := context.Background()
+
+	if err := l.Wait(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Now()
+
+	if err := l.Wait(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the limiter to block until refill, but it returned in %s", elapsed)
+	}
+}
+
+func TestRequestLimiter_RespectsContext(t *testing.T) {
+	l := newRequestLimiter(1, 1)
+
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		errCh := make(chan error)
+		go func() {
+			errCh <- l.Wait(ctx)
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+
+		select {
+		case err := <-errCh:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the limiter did not return on context cancellation")
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+
+		// The limiter fails immediately when the wait would exceed the deadline.
+		if err := l.Wait(ctx); err == nil {
+			t.Errorf("expected the limiter to fail on deadline")
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("the limiter did not return on deadline: %s", elapsed)
+		}
+	})
+
+	if waiting := l.Waiting(); waiting != 0 {
+		t.Errorf("expected waiters that gave up not to be counted as waiting, got %d", waiting)
+	}
+}
+
+func TestClient_RequestsPerMinute(t *testing.T) {
+	c := Config{
+		Token:             "token",
+		RequestsPerMinute: 1,
+		RequestsBurst:     1,
+	}
+	client, err := c.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Client.BaseURL = baseURL
+
+	if _, err := client.ListRunners(context.Background(), "", "", "test/valid"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err = client.RemoveRunner(ctx, "", "", "test/valid", int64(1))
+	if err == nil || !strings.Contains(err.Error(), "request limiter") {
+		t.Errorf("expected RemoveRunner to be blocked by the limiter, but got: %v", err)
+	}
+}
+
+func TestClient_DisableRequestLimiterMetrics(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		c := Config{
+			Token:                         "token",
+			RequestsPerMinute:             60,
+			OrganizationRequestsPerMinute: map[string]int{"org1": 10},
+			DisableRequestLimiterMetrics:  disabled,
+		}
+		client, err := c.NewClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reported := client.limiter.report != nil; reported == disabled {
+			t.Errorf("DisableRequestLimiterMetrics = %v: unexpected metrics of the shared limiter: reported = %v", disabled, reported)
+		}
+
+		if reported := client.orgLimiters["org1"].report != nil; reported == disabled {
+			t.Errorf("DisableRequestLimiterMetrics = %v: unexpected metrics of the organization limiter: reported = %v", disabled, reported)
+		}
+	}
+}
+
+func TestClient_OrganizationRequestsPerMinute(t *testing.T) {
+	c := Config{
+		Token:             "token",
+		RequestsPerMinute: 1200,
+		RequestsBurst:     1,
+		// 600 requests per minute refills a token every 100ms, and the rest of the organizations share the other 600.
+		OrganizationRequestsPerMinute: map[string]int{"Busy": 600},
+	}
+	client, err := c.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	// The busy organization queues up requests for a second under contention,
+	// after borrowing the idle shared token.
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		go func() {
+			_ = client.waitForRequest(ctx, "busy")
+			done <- struct{}{}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	start := time.Now()
+
+	if err := client.waitForRequest(ctx, "other"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The other organization waits at most for the shared token to refill, not for the queue of the busy one.
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("expected the other organization not to wait for the busy one, but it waited %s", elapsed)
+	}
+
+	if waiting := client.orgLimiters["busy"].Waiting(); waiting < 5 {
+		t.Errorf("expected the busy organization to have waiters queued on its own reservation, got %d", waiting)
+	}
+
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+}
+
+func TestClient_OrganizationRequestsPerMinute_BorrowsIdleCapacity(t *testing.T) {
+	c := Config{
+		Token:                         "token",
+		RequestsPerMinute:             2,
+		RequestsBurst:                 1,
+		OrganizationRequestsPerMinute: map[string]int{"busy": 1},
+	}
+	client, err := c.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first request uses the reservation of the organization, and the second one the idle remainder.
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := client.waitForRequest(ctx, "busy")
+		cancel()
+
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := client.waitForRequest(ctx, "busy"); err == nil {
+		t.Error("expected the third request to wait for the reservation once the remainder is used up")
+	}
+}
@@ -0,0 +1,182 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// DefaultRunnerGroupCacheTTL is the duration a runner group resolved by its name is cached for.
+const DefaultRunnerGroupCacheTTL = 10 * time.Minute
+
+// RunnerGroupNotFound is returned when no runner group with the name is visible to the organization.
+type RunnerGroupNotFound struct {
+	Organization string
+	Name         string
+}
+
+func (e *RunnerGroupNotFound) Error() string {
+	return fmt.Sprintf("runner group %q not found in organization %q", e.Name, e.Organization)
+}
+
+// runnerGroupCache caches runner groups per organization and group name,
+// so that repeated reconciliations don't need to list all the runner groups to resolve a group name to its ID.
+type runnerGroupCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]runnerGroupCacheEntry
+}
+
+type runnerGroupCacheEntry struct {
+	group     *github.RunnerGroup
+	expiresAt time.Time
+}
+
+func newRunnerGroupCache(ttl time.Duration) *runnerGroupCache {
+	if ttl <= 0 {
+		ttl = DefaultRunnerGroupCacheTTL
+	}
+
+	return &runnerGroupCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]runnerGroupCacheEntry{},
+	}
+}
+
+func runnerGroupCacheKey(org, name string) string {
+	return org + "/" + name
+}
+
+func (c *runnerGroupCache) get(org, name string) (*github.RunnerGroup, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := runnerGroupCacheKey(org, name)
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if !c.now().Before(e.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return e.group, true
+}
+
+func (c *runnerGroupCache) add(org, name string, group *github.RunnerGroup) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[runnerGroupCacheKey(org, name)] = runnerGroupCacheEntry{
+		group:     group,
+		expiresAt: c.now().Add(c.ttl),
+	}
+}
+
+func (c *runnerGroupCache) invalidate(org, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, runnerGroupCacheKey(org, name))
+}
+
+func (c *Client) runnerGroupCache() *runnerGroupCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.runnerGroups == nil {
+		c.runnerGroups = newRunnerGroupCache(DefaultRunnerGroupCacheTTL)
+	}
+
+	return c.runnerGroups
+}
+
+// GetRunnerGroupByName returns the runner group with the name that is visible to the organization,
+// including the ones inherited from the enterprise.
+//
+// The result is cached for DefaultRunnerGroupCacheTTL so that it doesn't list runner groups on every call.
+// It returns RunnerGroupNotFound when there's no such runner group.
+func (c *Client) GetRunnerGroupByName(ctx context.Context, org, name string) (*github.RunnerGroup, error) {
+	cache := c.runnerGroupCache()
+
+	if group, ok := cache.get(org, name); ok {
+		return group, nil
+	}
+
+	groups, err := c.ListOrganizationRunnerGroups(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range groups {
+		if group.GetName() == name {
+			cache.add(org, name, group)
+
+			return group, nil
+		}
+	}
+
+	// We don't cache negative results, so that a newly created runner group is picked up immediately.
+	return nil, &RunnerGroupNotFound{Organization: org, Name: name}
+}
+
+// ListRunnerGroupRunners returns the runners in the organization runner group with the name.
+//
+// The group ID is resolved via GetRunnerGroupByName.
+// When the cached group ID no longer exists on GitHub, because e.g. the group has been renamed or deleted,
+// the cache entry is invalidated and the group name is resolved again.
+func (c *Client) ListRunnerGroupRunners(ctx context.Context, org, group string) ([]*github.Runner, error) {
+	for attempt := 0; ; attempt++ {
+		rg, err := c.GetRunnerGroupByName(ctx, org, group)
+		if err != nil {
+			return nil, err
+		}
+
+		runners, err := c.listRunnerGroupRunners(ctx, org, rg.GetID())
+		if err == nil {
+			return runners, nil
+		}
+
+		var e *github.ErrorResponse
+		if !errors.As(err, &e) || e.Response == nil || e.Response.StatusCode != http.StatusNotFound {
+			return nil, err
+		}
+
+		c.runnerGroupCache().invalidate(org, group)
+
+		if attempt > 0 {
+			return nil, &RunnerGroupNotFound{Organization: org, Name: group}
+		}
+	}
+}
+
+func (c *Client) listRunnerGroupRunners(ctx context.Context, org string, groupID int64) ([]*github.Runner, error) {
+	var runners []*github.Runner
+
+	opts := github.ListOptions{PerPage: 100}
+	for {
+		list, res, err := c.Client.Actions.ListRunnerGroupRunners(ctx, org, groupID, &opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list runner group runners: %w", err)
+		}
+
+		runners = append(runners, list.Runners...)
+		if res.NextPage == 0 {
+			break
+		}
+
+		opts.Page = res.NextPage
+	}
+
+	return runners, nil
+}
@@ -0,0 +1,120 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type runnerGroupsServer struct {
+	// groupID is the ID of the runner group named "group1".
+	// A runner group with any other ID is treated as not found.
+	groupID int64
+
+	listGroupsCalls int32
+}
+
+func (s *runnerGroupsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/orgs/test/actions/runner-groups":
+		atomic.AddInt32(&s.listGroupsCalls, 1)
+		fmt.Fprintf(w, `{"total_count": 2, "runner_groups": [{"id": 1, "name": "Default"}, {"id": %d, "name": "group1"}]}`, atomic.LoadInt64(&s.groupID))
+	case fmt.Sprintf("/orgs/test/actions/runner-groups/%d/runners", atomic.LoadInt64(&s.groupID)):
+		fmt.Fprint(w, `{"total_count": 1, "runners": [{"id": 10, "name": "runner1", "os": "linux", "status": "online", "busy": false}]}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	}
+}
+
+func newRunnerGroupsTestClient(t *testing.T, s *runnerGroupsServer) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	client := newTestClient()
+	baseURL, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Client.BaseURL = baseURL
+
+	return client
+}
+
+func TestGetRunnerGroupByName(t *testing.T) {
+	s := &runnerGroupsServer{groupID: 2}
+	client := newRunnerGroupsTestClient(t, s)
+
+	now := time.Now()
+	cache := client.runnerGroupCache()
+	cache.now = func() time.Time { return now }
+
+	group, err := client.GetRunnerGroupByName(context.Background(), "test", "group1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if group.GetID() != 2 {
+		t.Errorf("unexpected group id: got %d, want 2", group.GetID())
+	}
+
+	// Cache hit
+	if _, err := client.GetRunnerGroupByName(context.Background(), "test", "group1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&s.listGroupsCalls); got != 1 {
+		t.Errorf("unexpected number of runner group listings on cache hit: got %d, want 1", got)
+	}
+
+	// Cache miss after the TTL
+	now = now.Add(DefaultRunnerGroupCacheTTL)
+
+	if _, err := client.GetRunnerGroupByName(context.Background(), "test", "group1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&s.listGroupsCalls); got != 2 {
+		t.Errorf("unexpected number of runner group listings after the cache expired: got %d, want 2", got)
+	}
+
+	// Not found
+	_, err = client.GetRunnerGroupByName(context.Background(), "test", "group2")
+	var notFound *RunnerGroupNotFound
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected RunnerGroupNotFound but got %T: %v", err, err)
+	}
+}
+
+func TestListRunnerGroupRunners(t *testing.T) {
+	s := &runnerGroupsServer{groupID: 2}
+	client := newRunnerGroupsTestClient(t, s)
+
+	runners, err := client.ListRunnerGroupRunners(context.Background(), "test", "group1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(runners) != 1 || runners[0].GetName() != "runner1" {
+		t.Errorf("unexpected runners: %v", runners)
+	}
+
+	// The group is recreated with another ID, which makes the cached ID to result in 404.
+	atomic.StoreInt64(&s.groupID, 3)
+
+	if _, err := client.ListRunnerGroupRunners(context.Background(), "test", "group1"); err != nil {
+		t.Fatalf("unexpected error after the group is recreated: %v", err)
+	}
+	if got := atomic.LoadInt32(&s.listGroupsCalls); got != 2 {
+		t.Errorf("unexpected number of runner group listings: got %d, want 2", got)
+	}
+
+	group, ok := client.runnerGroupCache().get("test", "group1")
+	if !ok || group.GetID() != 3 {
+		t.Errorf("expected the cache to be updated with the new group id, but got %v", group)
+	}
+}
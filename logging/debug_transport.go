@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/gregjones/httpcache"
+)
+
+const redacted = "REDACTED"
+
+// debugResponseHeaders are the response headers worth seeing when diagnosing runner API calls,
+// mostly about rate limits and caching.
+var debugResponseHeaders = []string{
+	"X-RateLimit-Limit",
+	"X-RateLimit-Remaining",
+	"X-RateLimit-Used",
+	"X-RateLimit-Reset",
+	"X-RateLimit-Resource",
+	"Retry-After",
+	"Cache-Control",
+	"ETag",
+	"Last-Modified",
+	"Date",
+	"Age",
+	httpcache.XFromCache,
+	"X-GitHub-Request-Id",
+}
+
+// debugRequestHeaders are the request headers worth seeing when diagnosing runner API calls.
+// Authorization is logged only as whether it's set.
+var debugRequestHeaders = []string{
+	"Cache-Control",
+	"If-None-Match",
+	"If-Modified-Since",
+	"Authorization",
+}
+
+// sensitiveQueryParams are the query parameters that can contain credentials.
+var sensitiveQueryParams = []string{"access_token", "token", "client_id", "client_secret", "jwt"}
+
+// runnerAPIPath matches the paths of the GitHub API calls to list and remove runners,
+// but not the ones to create registration and remove tokens.
+var runnerAPIPath = regexp.MustCompile(`/actions/runners(/[0-9]+)?/?$`)
+
+// DebugTransport logs the GitHub API calls to list and remove runners at V(2), for diagnosing unregistration issues.
+// It logs sanitized URLs, status codes, and the request and response headers relevant to rate limits and caching.
+// Credentials in the URL and the headers are redacted.
+type DebugTransport struct {
+	Transport http.RoundTripper
+
+	Log *logr.Logger
+}
+
+func (t DebugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Transport.RoundTrip(req)
+
+	if t.Log != nil && runnerAPIPath.MatchString(req.URL.Path) {
+		t.log(req, resp, err)
+	}
+
+	return resp, err
+}
+
+func (t DebugTransport) log(req *http.Request, resp *http.Response, err error) {
+	args := []interface{}{"method", req.Method, "url", SanitizeURL(req.URL)}
+
+	for _, h := range debugRequestHeaders {
+		if v := req.Header.Get(h); v != "" {
+			if h == "Authorization" {
+				v = redacted
+			}
+			args = append(args, "request_"+headerArgName(h), v)
+		}
+	}
+
+	if err != nil {
+		t.Log.V(2).Info("GitHub API call failed", append(args, "error", err.Error())...)
+		return
+	}
+
+	args = append(args, "status", resp.StatusCode)
+
+	for _, h := range debugResponseHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			args = append(args, headerArgName(h), v)
+		}
+	}
+
+	t.Log.V(2).Info("GitHub API call", args...)
+}
+
+// SanitizeURL returns the URL with the user info and the credentials in the query redacted.
+func SanitizeURL(u *url.URL) string {
+	sanitized := *u
+
+	if sanitized.User != nil {
+		sanitized.User = url.User(redacted)
+	}
+
+	q := sanitized.Query()
+	changed := false
+	for _, p := range sensitiveQueryParams {
+		if q.Has(p) {
+			q.Set(p, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		sanitized.RawQuery = q.Encode()
+	}
+
+	return sanitized.String()
+}
+
+func headerArgName(h string) string {
+	return strings.ReplaceAll(strings.ToLower(h), "-", "_")
+}
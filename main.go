@@ -17,9 +17,12 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,15 +32,23 @@ import (
 	"github.com/actions-runner-controller/actions-runner-controller/logging"
 	"github.com/kelseyhightower/envconfig"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	// +kubebuilder:scaffold:imports
 )
 
 const (
 	defaultRunnerImage = "summerwind/actions-runner:latest"
 	defaultDockerImage = "docker:dind"
+
+	// preflightTimeout is the timeout of the permission check on startup.
+	preflightTimeout = 30 * time.Second
+
+	// gracefulStopAuditWebhookSecretEnvName is the envvar of the secret to sign graceful stop audit webhook requests with.
+	gracefulStopAuditWebhookSecretEnvName = "GRACEFUL_STOP_AUDIT_WEBHOOK_SECRET"
 )
 
 var (
@@ -69,12 +80,17 @@ func main() {
 		ghClient *github.Client
 
 		metricsAddr          string
+		probeAddr            string
 		enableLeaderElection bool
 		leaderElectionId     string
 		syncPeriod           time.Duration
 
 		gitHubAPICacheDuration time.Duration
 
+		preflightScopes commaSeparatedStringSlice
+		preflightFatal  bool
+		preflightReadyz bool
+
 		runnerImage            string
 		runnerImagePullSecrets stringSlice
 
@@ -83,7 +99,29 @@ func main() {
 		namespace            string
 		logLevel             string
 
+		namespaceCredentialsSecretName string
+
 		commonRunnerLabels commaSeparatedStringSlice
+
+		runnerStatusUpdateWindow       time.Duration
+		maxUnregistrationsPerReconcile int
+		startupReconcileRamp           time.Duration
+		ephemeralRunnerMaxIdle         time.Duration
+		pauseScaleUpsOnRateLimit       bool
+		ghostRunnerGracePeriod         time.Duration
+		gracefulStopAnnotationPrefix   string
+		enablePreUnregistrationExec    bool
+
+		gracefulStop      controllers.GracefulStopConfig
+		nodeDrain         controllers.NodeDrainConfig
+		drainOnPVCReclaim bool
+		scaleDownScoring  controllers.ScaleDownScoring
+
+		gracefulStopAuditWebhookURL string
+		gracefulStopCountsConfigMap string
+
+		stoppedRunnerHistoryConfigMap string
+		stoppedRunnerHistoryLimit     int
 	)
 
 	var c github.Config
@@ -94,6 +132,7 @@ func main() {
 	}
 
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&probeAddr, "health-probe-addr", ":8081", "The address the health probe endpoints /healthz and /readyz bind to. Set to 0 to disable them")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&leaderElectionId, "leader-election-id", "actions-runner-controller", "Controller id for leader election.")
@@ -110,10 +149,67 @@ func main() {
 	flag.StringVar(&c.BasicauthUsername, "github-basicauth-username", c.BasicauthUsername, "Username for GitHub basic auth to use instead of PAT or GitHub APP in case it's running behind a proxy API")
 	flag.StringVar(&c.BasicauthPassword, "github-basicauth-password", c.BasicauthPassword, "Password for GitHub basic auth to use instead of PAT or GitHub APP in case it's running behind a proxy API")
 	flag.StringVar(&c.RunnerGitHubURL, "runner-github-url", c.RunnerGitHubURL, "GitHub URL to be used by runners during registration")
+	flag.IntVar(&c.RequestsPerMinute, "github-api-requests-per-minute", c.RequestsPerMinute, "The maximum number of GitHub API calls to list and remove runners the controller makes per minute. Calls exceeding the cap wait until allowed. Set to 0 to disable the cap")
+	flag.IntVar(&c.RequestsBurst, "github-api-requests-burst", c.RequestsBurst, "The number of GitHub API calls to list and remove runners that can be made at once before github-api-requests-per-minute kicks in. Defaults to 1")
+	flag.Var((*organizationRequestsPerMinute)(&c.OrganizationRequestsPerMinute), "github-api-organization-requests-per-minute", "Comma-separated ORG:N pairs, e.g. org1:100,org2:50, that reserve N of github-api-requests-per-minute for each organization, so that GitHub API calls for one busy organization can't starve the others on a GitHub App shared across organizations. Calls for a repository count toward the organization owning it. Each reservation is the minimum, not the cap: an organization that used up its reservation also makes calls from the remainder of github-api-requests-per-minute while no other call is waiting for it, and otherwise waits only for its own reservation. The others share the remainder, so the reservations must sum under github-api-requests-per-minute")
+	flag.BoolVar(&c.DebugLog, "github-api-debug-log", c.DebugLog, "Logs the GitHub API calls to list and remove runners with the URLs, the status codes, and the rate limit and cache headers, at --log-level=-2 or more verbose. Credentials are redacted")
+	flag.DurationVar(&c.ListRunnersTimeout, "github-api-list-runners-timeout", c.ListRunnersTimeout, "The timeout of each GitHub API call to list runners, per page of runners, e.g. 20s. A timed out call is retried like one failed due to a network error. Set to 0 to disable the timeout")
+	flag.DurationVar(&c.RemoveRunnerTimeout, "github-api-remove-runner-timeout", c.RemoveRunnerTimeout, "The timeout of each GitHub API call to remove a runner, e.g. 10s. A timed out call is retried like one failed due to a network error. Set to 0 to disable the timeout")
+	flag.StringVar(&c.ProxyURL, "github-api-proxy-url", c.ProxyURL, "The URL of the proxy for GitHub API calls, e.g. http://proxy.example.com:3128 or socks5://proxy.example.com:1080. The scheme must be one of http, https, and socks5. Defaults to HTTPS_PROXY and HTTP_PROXY envvars")
+	flag.StringVar(&c.NoProxy, "github-api-no-proxy", c.NoProxy, "Comma-separated hosts, domains, IP addresses, and CIDRs that bypass github-api-proxy-url, in the same format as NO_PROXY envvar. Used only with github-api-proxy-url")
+	flag.StringVar(&c.ListRunnersPath, "github-api-list-runners-path", c.ListRunnersPath, fmt.Sprintf("Overrides the path of the GitHub API to list runners relative to the API base URL, for GitHub Enterprise Server versions that serve it under a different path. {scope} is replaced with repos/OWNER/REPO, orgs/ORG, or enterprises/ENTERPRISE. Defaults to %s", github.DefaultListRunnersPath))
+	flag.StringVar(&c.RemoveRunnerPath, "github-api-remove-runner-path", c.RemoveRunnerPath, fmt.Sprintf("Overrides the path of the GitHub API to remove a runner like github-api-list-runners-path. {runner_id} is replaced with the ID of the runner. Defaults to %s", github.DefaultRemoveRunnerPath))
+	flag.Var(&preflightScopes, "github-api-preflight-scopes", "Comma-separated scopes to check on startup that the GitHub API credentials can list and remove runners in, each one of OWNER/REPO, ORG, and enterprises/ENTERPRISE. Set to empty to skip the check")
+	flag.BoolVar(&preflightFatal, "github-api-preflight-fatal", false, "Exits on startup when github-api-preflight-scopes finds the GitHub API credentials lack the permissions, instead of logging the error")
+	flag.BoolVar(&preflightReadyz, "github-api-preflight-readyz", false, "Fails /readyz while github-api-preflight-scopes finds the GitHub API credentials lack the permissions, rechecking every minute until the permissions are fixed. Failures to check for other reasons, like network errors, don't fail /readyz")
 	flag.DurationVar(&gitHubAPICacheDuration, "github-api-cache-duration", 0, "The duration until the GitHub API cache expires. Setting this to e.g. 10m results in the controller tries its best not to make the same API call within 10m to reduce the chance of being rate-limited. Defaults to mostly the same value as sync-period. If you're tweaking this in order to make autoscaling more responsive, you'll probably want to tweak sync-period, too")
 	flag.DurationVar(&syncPeriod, "sync-period", 10*time.Minute, "Determines the minimum frequency at which K8s resources managed by this controller are reconciled. When you use autoscaling, set to a lower value like 10 minute, because this corresponds to the minimum time to react on demand change. . If you're tweaking this in order to make autoscaling more responsive, you'll probably want to tweak github-api-cache-duration, too")
 	flag.Var(&commonRunnerLabels, "common-runner-labels", "Runner labels in the K1=V1,K2=V2,... format that are inherited all the runners created by the controller. See https://github.com/actions-runner-controller/actions-runner-controller/issues/321 for more information")
+	flag.StringVar(&namespaceCredentialsSecretName, "namespace-github-api-credentials-secret", "", "The name of the secret that provides the GitHub API credentials for runners in the namespace of the secret, for runners that don't specify spec.githubAPICredentialsFrom. Runners in namespaces without the secret use the controller-wide credentials. Set to empty to disable")
 	flag.StringVar(&namespace, "watch-namespace", "", "The namespace to watch for custom resources. Set to empty for letting it watch for all namespaces.")
+	flag.DurationVar(&gracefulStop.UnregistrationTimeout, "unregistration-timeout", controllers.DefaultUnregistrationTimeout, "The duration until ARC gives up retrying to unregister a runner and deletes the runner pod. Can be overridden per runner pod via the "+controllers.AnnotationKeyUnregistrationTimeout+" annotation")
+	flag.DurationVar(&gracefulStop.UnregistrationRetryDelay, "unregistration-retry-delay", controllers.DefaultUnregistrationRetryDelay, "The delay between retries while ARC is waiting for a runner to be unregistered")
+	flag.DurationVar(&gracefulStop.MaxUnregistrationRetryDelay, "unregistration-max-retry-delay", 0, "When greater than --unregistration-retry-delay or --busy-runner-poll-interval, ARC retries the unregistration of a runner at this delay on the start of the graceful stop, when the runner is likely still running a job, and shortens the delay linearly down to --unregistration-retry-delay or --busy-runner-poll-interval as the unregistration timeout approaches, to make fewer GitHub API calls early on while deleting the runner pod promptly in the end. Set to 0 to retry at the fixed delays")
+	flag.DurationVar(&gracefulStop.BusyRunnerPollInterval, "busy-runner-poll-interval", 0, "The delay between retries while ARC is waiting for a busy runner to finish its job before unregistering it. Defaults to the value of --unregistration-retry-delay")
+	flag.DurationVar(&gracefulStop.PatchConflictRetryDelay, "pod-patch-conflict-retry-delay", controllers.DefaultPatchConflictRetryDelay, "The delay until retrying the graceful stop of a runner after updating the annotations of the runner pod failed with a conflict, e.g. because another controller annotated the pod at the same time. The retry uses the latest pod")
+	flag.DurationVar(&gracefulStop.MinRateLimitRetryDelay, "min-rate-limit-retry-delay", controllers.DefaultMinRateLimitRetryDelay, "The minimum the "+controllers.AnnotationKeyRateLimitRetryDelay+" annotation of a runner pod can shorten the delay until retrying the unregistration of the runner after hitting GitHub API rate limits to, so that runners prioritized that way can't exhaust the rate limit shared with other runners")
+	flag.DurationVar(&gracefulStop.RegistrationRaceGracePeriod, "registration-race-grace-period", 0, "The duration since the runner pod creation during which ARC waits for a runner that is not found on GitHub to register, instead of deleting the runner pod. Set to e.g. 1m if runners can take a while to register. Set to 0 to disable")
+	flag.DurationVar(&gracefulStop.PostUnregistrationDelay, "post-unregistration-delay", 0, "The delay between a successful runner unregistration and the runner pod deletion, e.g. for log shippers within the pod to flush the tail of the runner logs. Set to 0 to delete the pod as soon as the runner is unregistered")
+	flag.DurationVar(&gracefulStop.UnregistrationStartJitter, "unregistration-start-jitter", 0, "The maximum of the random delay before the first attempt to unregister each runner, e.g. 15s, so that runners stopped at once on a scale down don't call GitHub API at the same time. The delay counts toward --unregistration-timeout. Set to 0 to disable")
+	flag.DurationVar(&gracefulStop.UnregistrationProgressLogInterval, "unregistration-progress-log-interval", controllers.DefaultUnregistrationProgressLogInterval, "The interval of logging that the unregistration of each runner is still in progress at info level. The repeated logs in between are emitted at --log-level=debug. Set to 0 to log every one at info level")
+	flag.DurationVar(&runnerStatusUpdateWindow, "runner-status-update-window", controllers.DefaultRunnerStatusUpdateWindow, "The window within which the status updates of each runner are coalesced to reduce the load on the Kubernetes API server. Updates that don't change the runner status are skipped, and updates of the unregistration attempts are written at most once per runner within the window. Set to 0 to only skip updates that don't change the status")
+	flag.DurationVar(&ephemeralRunnerMaxIdle, "ephemeral-runner-max-idle", 0, "The duration an ephemeral runner of a RunnerDeployment or a RunnerReplicaSet can stay idle without running any job since the registration, e.g. 30m. Idle runners beyond it are gracefully stopped and recreated, so that fresh runners pick up jobs. Set to 0 to keep idle runners forever")
+	flag.DurationVar(&startupReconcileRamp, "startup-reconcile-ramp", 0, "Spreads the first reconciliations of the runners and runner pods that existed before the controller started over this duration since the start, e.g. 5m, so that they don't all call the GitHub API at once after a restart or an upgrade of the controller. Set to 0 to disable")
+	flag.IntVar(&maxUnregistrationsPerReconcile, "max-unregistrations-per-reconcile", 0, "The maximum number of runners of a RunnerReplicaSet being unregistered at a time. On a large scale-down, each reconcile starts unregistering only as many runners as this allows, counting ones still being unregistered, and leaves the rest to subsequent reconciles, to bound the GitHub API calls made at once. Set to 0 to disable the limit")
+	flag.Float64Var(&scaleDownScoring.NodeDensityWeight, "scale-down-node-density-weight", 0, "The weight of the number of runners of a RunnerReplicaSet on the node of an idle runner, in the score ARC picks idle runners to stop on a scale-down by at random, so that runners on the most-loaded nodes are preferred. When both this and --scale-down-idleness-weight are 0, idle runners are stopped in the listed order")
+	flag.Float64Var(&scaleDownScoring.IdlenessWeight, "scale-down-idleness-weight", 0, "The weight of how long an idle runner has been idle, in the score ARC picks idle runners to stop on a scale-down by at random, so that the longest-idle runners are preferred. See --scale-down-node-density-weight")
+	flag.IntVar(&gracefulStop.MaxUnregistrationAttempts, "max-unregistration-attempts", 0, "The number of failed attempts to unregister a runner, excluding ones due to rate limits, network errors, GitHub server errors, and busy runners, until ARC gives up and marks the runner as UnregistrationFailed. Set to 0 to retry forever")
+	flag.BoolVar(&gracefulStop.RequireReadyToStop, "require-ready-to-stop", false, fmt.Sprintf("Holds the graceful stop of each runner until its runner pod is annotated with %s, so that external tooling can decide when each runner drains", controllers.AnnotationKeyReadyToStop))
+	flag.BoolVar(&gracefulStop.ConfirmUnregistration, "confirm-unregistration", false, fmt.Sprintf("Lists runners bypassing the cache after each successful runner removal, up to %d times, to confirm that the runner has disappeared on GitHub before deleting the runner pod. This costs extra GitHub API calls per unregistration", controllers.DefaultUnregistrationConfirmationAttempts))
+	flag.BoolVar(&gracefulStop.DisableInlineUnregistration, "disable-inline-unregistration", false, fmt.Sprintf("Skips removing runners from GitHub while gracefully stopping them, so that reconciliations don't wait for the GitHub API. Instead, offline runners that ARC no longer runs are removed from GitHub in batch every %s", controllers.DefaultOfflineRunnerCleanupInterval))
+	flag.BoolVar(&pauseScaleUpsOnRateLimit, "pause-scale-ups-on-rate-limit", false, "Pauses creating runner pods while the GitHub API rate limit is exhausted, as the runners can't be registered until it's reset anyway, and resumes once it's reset. Graceful stops of existing runners continue during the pause")
+	flag.BoolVar(&gracefulStop.SkipBusyRunnerRemoval, "skip-busy-runner-removal", false, "Sees the busy flag of the runner listed on GitHub before removing it on graceful stops, and waits for a busy runner to finish its job without calling the GitHub API to remove it, which fails for busy runners anyway")
+	flag.DurationVar(&ghostRunnerGracePeriod, "ghost-runner-grace-period", 0, fmt.Sprintf("Enables removing ghost runners, which are offline runners on GitHub that are named after a RunnerDeployment, a RunnerReplicaSet, or a RunnerSet but have no runner pod, e.g. after node crashes. They are checked every %s and removed once they stay ghosts for the grace period, e.g. 10m. Also delays the batch removal of --disable-inline-unregistration. Set to 0 to disable, unless --disable-inline-unregistration is set", controllers.DefaultOfflineRunnerCleanupInterval))
+	flag.Var((*commaSeparatedStringSlice)(&gracefulStop.RunnerOwnership.NamePrefixes), "managed-runner-name-prefixes", "Comma-separated prefixes of the names of the runners managed by this ARC. When this or --managed-runner-labels is set, ARC refuses to remove a runner from GitHub unless its name has any of the prefixes or it has any of the labels, so that runners registered manually or by another ARC installation with the same names as runner pods are left intact")
+	flag.Var((*commaSeparatedStringSlice)(&gracefulStop.RunnerOwnership.Labels), "managed-runner-labels", "Comma-separated runner labels that mark the runners managed by this ARC. See --managed-runner-name-prefixes")
+	flag.StringVar(&gracefulStop.RunnerNameSuffixPattern, "runner-name-suffix-pattern", "", "The regular expression that matches the suffix GitHub may append to the name of a runner registered with a name already taken, e.g. -\\d+. When set, a runner not found by the name of its runner pod on unregistration is looked up by the name followed by a suffix fully matching the pattern, and ARC refuses to unregister it when more than one runner matches. Set to empty to disable")
+	flag.StringVar(&gracefulStop.RunnerNameTemplate, "runner-name-template", "", "The Go template that renders the name of a runner registered on GitHub from the name of its runner pod, e.g. cluster-a-{{ .Name }}, for runners registered with transformed names so that multiple clusters can register runners into the same organization. The runner is looked up by the rendered name on unregistration. Set to empty to look up the runner by the name of its runner pod")
+	flag.DurationVar(&gracefulStop.RunnerPodNeverCreatedGracePeriod, "runner-pod-never-created-grace-period", 0, "How long to wait, since the creation of the runner or the runner pod, for a runner pod that is missing or still pending to start and register the runner, before concluding on unregistration that the runner will never be registered. Useful in clusters where runner pods can be pending long under the scheduling pressure, e.g. waiting for spot instances. Set to 0 to conclude immediately")
+	flag.StringVar((*string)(&gracefulStop.PodDeletionPropagationPolicy), "pod-deletion-propagation-policy", "", "The propagation policy to delete runner pods with once they're gracefully stopped, one of Foreground, Background, and Orphan. Useful to control the deletion order of the dependents of runner pods, e.g. persistent volume claims. Defaults to the default of the API server")
+	flag.StringVar((*string)(&gracefulStop.DuplicateRunnerNamePolicy), "duplicate-runner-name-policy", string(controllers.DuplicateRunnerNamePolicyFail), fmt.Sprintf("How to unregister a runner when GitHub lists more than one runner with its name. %q refuses to guess which one to remove and retries with an error. %q removes all of them. %q removes the online runner along with the offline ones, and fails if more than one of them are online", controllers.DuplicateRunnerNamePolicyFail, controllers.DuplicateRunnerNamePolicyRemoveAll, controllers.DuplicateRunnerNamePolicyRemoveOfflineOnly))
+	flag.StringVar((*string)(&gracefulStop.TerminatingPodUnregistration), "terminating-pod-unregistration", string(controllers.TerminatingPodUnregistrationGraceful), fmt.Sprintf("How to unregister a runner whose pod is already terminating, e.g. due to a node eviction. %q gracefully stops the runner as usual. %q tries to remove the runner from GitHub once without retrying. %q skips removing the runner from GitHub, leaving it registered as offline until it's removed", controllers.TerminatingPodUnregistrationGraceful, controllers.TerminatingPodUnregistrationBestEffort, controllers.TerminatingPodUnregistrationSkip))
+	flag.StringVar(&gracefulStopAnnotationPrefix, "graceful-stop-annotation-prefix", controllers.DefaultGracefulStopAnnotationPrefix, "The prefix of the unregistration-start-timestamp and unregistration-complete-timestamp annotations ARC adds to runner pods, to avoid collisions with annotations of other tools. The annotations without any prefix written by older versions of ARC are still read and migrated. Set to empty to use the annotations without any prefix")
+	flag.StringVar(&gracefulStop.GitHubRunnerLabelsAnnotation, "github-runner-labels-annotation", controllers.DefaultGitHubRunnerLabelsAnnotation, "The annotation ARC records the labels of the runner registered on GitHub to on the runner pod, as a JSON array, whenever it sees the runner registered. Set to empty to disable it")
+	flag.StringVar(&gracefulStop.ShutdownLogMarker, "verify-shutdown-log-marker", "", "The regular expression that must match the tail of the logs of the runner container before ARC completes the unregistration of the runner and deletes the runner pod, e.g. the line the runner prints once it finished a job, to not delete runner pods that are still e.g. uploading artifacts although GitHub reports the runners idle. Set to empty to disable")
+	flag.DurationVar(&gracefulStop.ShutdownLogMarkerTimeout, "verify-shutdown-log-marker-timeout", controllers.DefaultShutdownLogMarkerTimeout, "The duration since the start of the graceful stop of a runner until ARC gives up waiting for --verify-shutdown-log-marker and completes the unregistration anyway")
+	flag.BoolVar(&enablePreUnregistrationExec, "enable-pre-unregistration-exec", false, fmt.Sprintf("Runs spec.preUnregistrationExec of runners in the runner containers via the pod exec API before removing the runners from GitHub. The controller needs the create permission on pods/exec for it. Each command blocks the reconciliation of the runner for up to %s", controllers.MaxPreUnregistrationExecTimeout))
+	flag.BoolVar(&nodeDrain.Enabled, "drain-runners-on-unschedulable-nodes", false, "Watches nodes and gracefully stops runners on nodes that became unschedulable due to e.g. cordon, drain, or cluster-autoscaler scale down, instead of waiting for the runner pods to be evicted")
+	flag.IntVar(&nodeDrain.MaxConcurrentDrains, "max-concurrent-node-drains", controllers.DefaultMaxConcurrentNodeDrains, "The maximum number of runners gracefully stopped at the same time due to --drain-runners-on-unschedulable-nodes, to avoid bursts of GitHub and Kubernetes API calls")
+	flag.BoolVar(&drainOnPVCReclaim, "drain-runners-on-pvc-reclaim", false, "Watches persistent volume claims and gracefully stops RunnerSet runners using claims annotated with "+controllers.AnnotationKeyReclaimPVC+" or being deleted, deleting the claims only after the runners are unregistered")
+	flag.StringVar(&gracefulStopAuditWebhookURL, "graceful-stop-audit-webhook-url", "", "The URL to POST a JSON record to on each graceful stop transition of a runner, i.e. started, completed, and failed, for shipping runner lifecycle events to an external audit system. Failed requests are retried with an exponential backoff. Requests are signed with HMAC-SHA256 into the "+controllers.GracefulStopAuditSignatureHeader+" header when "+gracefulStopAuditWebhookSecretEnvName+" envvar is set. Set to empty to disable")
+	flag.StringVar(&stoppedRunnerHistoryConfigMap, "stopped-runner-history-configmap", "", fmt.Sprintf("The NAMESPACE/NAME of the configmap to keep the records of the latest runners that completed or failed the unregistration in, as a JSON array under the %s key, for post-mortems without the controller logs. The configmap is created if missing. Set to empty to disable", controllers.StoppedRunnerHistoryConfigMapKey))
+	flag.IntVar(&stoppedRunnerHistoryLimit, "stopped-runner-history-limit", controllers.DefaultStoppedRunnerHistoryLimit, "The number of the latest stopped runners kept in --stopped-runner-history-configmap. The oldest records are pruned beyond it")
+	flag.StringVar(&gracefulStopCountsConfigMap, "graceful-stop-counts-configmap", "", "The NAMESPACE/NAME of the configmap to save the cumulative graceful stop counts of runners into, so that the totals served at "+controllers.GracefulStopSummaryPath+" survive controller restarts. The configmap is created if missing. Set to empty to disable")
 	flag.StringVar(&logLevel, "log-level", logging.LogLevelDebug, `The verbosity of the logging. Valid values are "debug", "info", "warn", "error". Defaults to "debug".`)
 	flag.Parse()
 
@@ -121,38 +217,133 @@ func main() {
 
 	c.Log = &logger
 
+	if err := controllers.SetGracefulStopAnnotationPrefix(gracefulStopAnnotationPrefix); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	if err := scaleDownScoring.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
 	ghClient, err = c.NewClient()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error: Client creation failed.", err)
 		os.Exit(1)
 	}
 
+	preflight := &controllers.GitHubPermissionsPreflight{
+		GitHubClient: ghClient,
+		Log:          logger.WithName("preflight"),
+	}
+
+	for _, s := range preflightScopes {
+		scope, err := controllers.ParsePreflightScope(s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+
+		preflight.Scopes = append(preflight.Scopes, scope)
+	}
+
+	if len(preflight.Scopes) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+		err := preflight.Run(ctx)
+		cancel()
+
+		if preflightFatal && controllers.IsPreflightPermissionError(err) {
+			fmt.Fprintln(os.Stderr, "Error: GitHub API credentials lack the permissions to manage runners.", err)
+			os.Exit(1)
+		}
+	}
+
 	ctrl.SetLogger(logger)
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		LeaderElection:     enableLeaderElection,
-		LeaderElectionID:   leaderElectionId,
-		Port:               9443,
-		SyncPeriod:         &syncPeriod,
-		Namespace:          namespace,
+		Scheme:                 scheme,
+		MetricsBindAddress:     metricsAddr,
+		HealthProbeBindAddress: probeAddr,
+		LeaderElection:         enableLeaderElection,
+		LeaderElectionID:       leaderElectionId,
+		Port:                   9443,
+		SyncPeriod:             &syncPeriod,
+		Namespace:              namespace,
 	})
 	if err != nil {
 		log.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	multiClient := controllers.NewMultiGitHubClient(mgr.GetClient(), ghClient, c)
+	multiClient.NamespaceCredentialsSecretName = namespaceCredentialsSecretName
+
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		log.Error(err, "unable to create kubernetes clientset to read and exec into runner pods")
+		os.Exit(1)
+	}
+
+	if enablePreUnregistrationExec {
+		gracefulStop.PodExecutor = &controllers.ClientsetPodExecutor{Config: mgr.GetConfig(), Clientset: clientset}
+	}
+
+	if gracefulStop.ShutdownLogMarker != "" {
+		gracefulStop.PodLogReader = &controllers.ClientsetPodLogReader{Clientset: clientset}
+	}
+
+	if gracefulStopAuditWebhookURL != "" {
+		auditWebhook := &controllers.GracefulStopAuditWebhook{
+			URL:    gracefulStopAuditWebhookURL,
+			Secret: []byte(os.Getenv(gracefulStopAuditWebhookSecretEnvName)),
+			Log:    log.WithName("gracefulstopaudit"),
+		}
+
+		if err = mgr.Add(auditWebhook); err != nil {
+			log.Error(err, "unable to add runnable", "runnable", "GracefulStopAuditWebhook")
+			os.Exit(1)
+		}
+
+		gracefulStop.AuditSink = auditWebhook
+	}
+
+	if stoppedRunnerHistoryConfigMap != "" {
+		gracefulStop.StoppedRunnerHistory, err = controllers.NewStoppedRunnerHistory(stoppedRunnerHistoryLimit)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := gracefulStop.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	startupRamp := controllers.NewStartupReconcileRamp(startupReconcileRamp)
+
 	runnerReconciler := &controllers.RunnerReconciler{
 		Client:               mgr.GetClient(),
 		Log:                  log.WithName("runner"),
 		Scheme:               mgr.GetScheme(),
-		GitHubClient:         ghClient,
+		GitHubClient:         multiClient,
 		DockerImage:          dockerImage,
 		DockerRegistryMirror: dockerRegistryMirror,
 		// Defaults for self-hosted runner containers
 		RunnerImage:            runnerImage,
 		RunnerImagePullSecrets: runnerImagePullSecrets,
+
+		GracefulStopConfig: gracefulStop,
+
+		PauseScaleUpsOnRateLimit: pauseScaleUpsOnRateLimit,
+		StartupReconcileRamp:     startupRamp,
+
+		EphemeralRunnerMaxIdle: ephemeralRunnerMaxIdle,
+
+		NodeDrain: nodeDrain,
+
+		StatusUpdateWindow: runnerStatusUpdateWindow,
 	}
 
 	if err = runnerReconciler.SetupWithManager(mgr); err != nil {
@@ -164,7 +355,10 @@ func main() {
 		Client:       mgr.GetClient(),
 		Log:          log.WithName("runnerreplicaset"),
 		Scheme:       mgr.GetScheme(),
-		GitHubClient: ghClient,
+		GitHubClient: multiClient,
+
+		MaxUnregistrationsPerReconcile: maxUnregistrationsPerReconcile,
+		ScaleDownScoring:               scaleDownScoring,
 	}
 
 	if err = runnerReplicaSetReconciler.SetupWithManager(mgr); err != nil {
@@ -177,6 +371,7 @@ func main() {
 		Log:                log.WithName("runnerdeployment"),
 		Scheme:             mgr.GetScheme(),
 		CommonRunnerLabels: commonRunnerLabels,
+		GitHubClient:       multiClient,
 	}
 
 	if err = runnerDeploymentReconciler.SetupWithManager(mgr); err != nil {
@@ -192,9 +387,14 @@ func main() {
 		DockerImage:          dockerImage,
 		DockerRegistryMirror: dockerRegistryMirror,
 		GitHubBaseURL:        ghClient.GithubBaseURL,
+		GitHubClient:         multiClient,
 		// Defaults for self-hosted runner containers
 		RunnerImage:            runnerImage,
 		RunnerImagePullSecrets: runnerImagePullSecrets,
+
+		GracefulStopConfig: gracefulStop,
+
+		PauseScaleUpsOnRateLimit: pauseScaleUpsOnRateLimit,
 	}
 
 	if err = runnerSetReconciler.SetupWithManager(mgr); err != nil {
@@ -212,11 +412,65 @@ func main() {
 	log.Info(
 		"Initializing actions-runner-controller",
 		"github-api-cache-duration", gitHubAPICacheDuration,
+		"github-api-debug-log", c.DebugLog,
+		"github-api-list-runners-timeout", c.ListRunnersTimeout,
+		"github-api-remove-runner-timeout", c.RemoveRunnerTimeout,
+		"github-api-proxy-url", sanitizedProxyURL(c.ProxyURL),
+		"github-api-no-proxy", c.NoProxy,
+		"github-api-list-runners-path", c.ListRunnersPath,
+		"github-api-remove-runner-path", c.RemoveRunnerPath,
+		"github-api-preflight-scopes", preflightScopes,
+		"github-api-preflight-fatal", preflightFatal,
+		"github-api-preflight-readyz", preflightReadyz,
 		"sync-period", syncPeriod,
 		"runner-image", runnerImage,
 		"docker-image", dockerImage,
 		"common-runnner-labels", commonRunnerLabels,
 		"watch-namespace", namespace,
+		"namespace-github-api-credentials-secret", namespaceCredentialsSecretName,
+		"unregistration-timeout", gracefulStop.UnregistrationTimeout,
+		"unregistration-retry-delay", gracefulStop.UnregistrationRetryDelay,
+		"unregistration-max-retry-delay", gracefulStop.MaxUnregistrationRetryDelay,
+		"pod-patch-conflict-retry-delay", gracefulStop.PatchConflictRetryDelay,
+		"min-rate-limit-retry-delay", gracefulStop.MinRateLimitRetryDelay,
+		"busy-runner-poll-interval", gracefulStop.BusyRunnerPollInterval,
+		"registration-race-grace-period", gracefulStop.RegistrationRaceGracePeriod,
+		"post-unregistration-delay", gracefulStop.PostUnregistrationDelay,
+		"unregistration-start-jitter", gracefulStop.UnregistrationStartJitter,
+		"unregistration-progress-log-interval", gracefulStop.UnregistrationProgressLogInterval,
+		"runner-status-update-window", runnerStatusUpdateWindow,
+		"runner-name-suffix-pattern", gracefulStop.RunnerNameSuffixPattern,
+		"runner-name-template", gracefulStop.RunnerNameTemplate,
+		"runner-pod-never-created-grace-period", gracefulStop.RunnerPodNeverCreatedGracePeriod,
+		"pod-deletion-propagation-policy", gracefulStop.PodDeletionPropagationPolicy,
+		"terminating-pod-unregistration", gracefulStop.TerminatingPodUnregistration,
+		"duplicate-runner-name-policy", gracefulStop.DuplicateRunnerNamePolicy,
+		"max-unregistration-attempts", gracefulStop.MaxUnregistrationAttempts,
+		"require-ready-to-stop", gracefulStop.RequireReadyToStop,
+		"max-unregistrations-per-reconcile", maxUnregistrationsPerReconcile,
+		"scale-down-node-density-weight", scaleDownScoring.NodeDensityWeight,
+		"scale-down-idleness-weight", scaleDownScoring.IdlenessWeight,
+		"startup-reconcile-ramp", startupReconcileRamp,
+		"ephemeral-runner-max-idle", ephemeralRunnerMaxIdle,
+		"confirm-unregistration", gracefulStop.ConfirmUnregistration,
+		"disable-inline-unregistration", gracefulStop.DisableInlineUnregistration,
+		"skip-busy-runner-removal", gracefulStop.SkipBusyRunnerRemoval,
+		"pause-scale-ups-on-rate-limit", pauseScaleUpsOnRateLimit,
+		"ghost-runner-grace-period", ghostRunnerGracePeriod,
+		"graceful-stop-annotation-prefix", gracefulStopAnnotationPrefix,
+		"github-runner-labels-annotation", gracefulStop.GitHubRunnerLabelsAnnotation,
+		"verify-shutdown-log-marker", gracefulStop.ShutdownLogMarker,
+		"verify-shutdown-log-marker-timeout", gracefulStop.ShutdownLogMarkerTimeout,
+		"enable-pre-unregistration-exec", enablePreUnregistrationExec,
+		"managed-runner-name-prefixes", gracefulStop.RunnerOwnership.NamePrefixes,
+		"managed-runner-labels", gracefulStop.RunnerOwnership.Labels,
+		"drain-runners-on-unschedulable-nodes", nodeDrain.Enabled,
+		"max-concurrent-node-drains", nodeDrain.MaxConcurrentDrains,
+		"drain-runners-on-pvc-reclaim", drainOnPVCReclaim,
+		"graceful-stop-audit-webhook-enabled", gracefulStopAuditWebhookURL != "",
+		"graceful-stop-counts-configmap", gracefulStopCountsConfigMap,
+		"stopped-runner-history-configmap", stoppedRunnerHistoryConfigMap,
+		"stopped-runner-history-limit", stoppedRunnerHistoryLimit,
 	)
 
 	horizontalRunnerAutoscaler := &controllers.HorizontalRunnerAutoscalerReconciler{
@@ -231,7 +485,14 @@ func main() {
 		Client:       mgr.GetClient(),
 		Log:          log.WithName("runnerpod"),
 		Scheme:       mgr.GetScheme(),
-		GitHubClient: ghClient,
+		GitHubClient: multiClient,
+
+		GracefulStopConfig: gracefulStop,
+
+		StartupReconcileRamp: startupRamp,
+
+		NodeDrain:         nodeDrain,
+		DrainOnPVCReclaim: drainOnPVCReclaim,
 	}
 
 	if err = runnerPodReconciler.SetupWithManager(mgr); err != nil {
@@ -239,6 +500,96 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err = mgr.Add(&controllers.UnregistrationPhaseMetricsSyncer{
+		Client:                mgr.GetClient(),
+		Log:                   log.WithName("unregistrationphasemetrics"),
+		UnregistrationTimeout: gracefulStop.UnregistrationTimeout,
+	}); err != nil {
+		log.Error(err, "unable to add runnable", "runnable", "UnregistrationPhaseMetricsSyncer")
+		os.Exit(1)
+	}
+
+	if gracefulStopCountsConfigMap != "" {
+		ns, name, ok := splitNamespacedName(gracefulStopCountsConfigMap)
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Error:", fmt.Errorf("invalid --graceful-stop-counts-configmap %q: must be in the form of NAMESPACE/NAME", gracefulStopCountsConfigMap))
+			os.Exit(1)
+		}
+
+		if err = mgr.Add(&controllers.GracefulStopCountsPersister{
+			Client:    mgr.GetClient(),
+			Reader:    mgr.GetAPIReader(),
+			Log:       log.WithName("gracefulstopcounts"),
+			Namespace: ns,
+			Name:      name,
+		}); err != nil {
+			log.Error(err, "unable to add runnable", "runnable", "GracefulStopCountsPersister")
+			os.Exit(1)
+		}
+	}
+
+	if stoppedRunnerHistoryConfigMap != "" {
+		ns, name, ok := splitNamespacedName(stoppedRunnerHistoryConfigMap)
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Error:", fmt.Errorf("invalid --stopped-runner-history-configmap %q: must be in the form of NAMESPACE/NAME", stoppedRunnerHistoryConfigMap))
+			os.Exit(1)
+		}
+
+		if err = mgr.Add(&controllers.StoppedRunnerHistoryPersister{
+			Client:    mgr.GetClient(),
+			Reader:    mgr.GetAPIReader(),
+			Log:       log.WithName("stoppedrunnerhistory"),
+			Namespace: ns,
+			Name:      name,
+			History:   gracefulStop.StoppedRunnerHistory,
+		}); err != nil {
+			log.Error(err, "unable to add runnable", "runnable", "StoppedRunnerHistoryPersister")
+			os.Exit(1)
+		}
+	}
+
+	if err = mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		log.Error(err, "unable to add healthz check", "check", "ping")
+		os.Exit(1)
+	}
+
+	if preflightReadyz && len(preflight.Scopes) > 0 {
+		if err = mgr.AddReadyzCheck("github-api-permissions", preflight.ReadyzCheck); err != nil {
+			log.Error(err, "unable to add readyz check", "check", "github-api-permissions")
+			os.Exit(1)
+		}
+	}
+
+	if err = mgr.AddMetricsExtraHandler(controllers.GracefulStopStatePath, &controllers.GracefulStopStateHandler{
+		Client:                mgr.GetClient(),
+		Log:                   log.WithName("gracefulstopstate"),
+		UnregistrationTimeout: gracefulStop.UnregistrationTimeout,
+	}); err != nil {
+		log.Error(err, "unable to add metrics handler", "path", controllers.GracefulStopStatePath)
+		os.Exit(1)
+	}
+
+	if err = mgr.AddMetricsExtraHandler(controllers.GracefulStopSummaryPath, &controllers.GracefulStopSummaryHandler{
+		Client:                mgr.GetClient(),
+		Log:                   log.WithName("gracefulstopsummary"),
+		UnregistrationTimeout: gracefulStop.UnregistrationTimeout,
+	}); err != nil {
+		log.Error(err, "unable to add metrics handler", "path", controllers.GracefulStopSummaryPath)
+		os.Exit(1)
+	}
+
+	if gracefulStop.DisableInlineUnregistration || ghostRunnerGracePeriod > 0 {
+		if err = mgr.Add(&controllers.OfflineRunnerCleaner{
+			Client:       mgr.GetClient(),
+			GitHubClient: multiClient,
+			Log:          log.WithName("offlinerunnercleaner"),
+			GracePeriod:  ghostRunnerGracePeriod,
+		}); err != nil {
+			log.Error(err, "unable to add runnable", "runnable", "OfflineRunnerCleaner")
+			os.Exit(1)
+		}
+	}
+
 	if err = horizontalRunnerAutoscaler.SetupWithManager(mgr); err != nil {
 		log.Error(err, "unable to create controller", "controller", "HorizontalRunnerAutoscaler")
 		os.Exit(1)
@@ -291,3 +642,60 @@ func (s *commaSeparatedStringSlice) Set(value string) error {
 	}
 	return nil
 }
+
+// organizationRequestsPerMinute parses the comma-separated ORG:N pairs, in the same format as GITHUB_ORGANIZATION_REQUESTS_PER_MINUTE envvar.
+type organizationRequestsPerMinute map[string]int
+
+func (m *organizationRequestsPerMinute) String() string {
+	return fmt.Sprintf("%v", map[string]int(*m))
+}
+
+func (m *organizationRequestsPerMinute) Set(value string) error {
+	if *m == nil {
+		*m = map[string]int{}
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		if pair == "" {
+			continue
+		}
+
+		org, v := pair, ""
+		if i := strings.LastIndex(pair, ":"); i >= 0 {
+			org, v = pair[:i], pair[i+1:]
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid organization requests per minute %q: must be ORG:N", pair)
+		}
+
+		(*m)[org] = n
+	}
+
+	return nil
+}
+
+// sanitizedProxyURL returns the proxy URL with the credentials redacted, for logging.
+func sanitizedProxyURL(proxyURL string) string {
+	if proxyURL == "" {
+		return ""
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return "<invalid>"
+	}
+
+	return logging.SanitizeURL(u)
+}
+
+// splitNamespacedName splits the NAMESPACE/NAME into the namespace and the name.
+func splitNamespacedName(v string) (string, string, bool) {
+	parts := strings.Split(v, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
@@ -96,6 +96,20 @@ if [ "${DISABLE_RUNNER_UPDATE:-}" == "true" ]; then
   echo "Passing --disableupdate to config.sh to disable automatic runner updates."
 fi
 
+if [ -n "${RUNNER_LABELS_FILE:-}" ]; then
+  log "Waiting until the runner labels computed from the label templates are available at ${RUNNER_LABELS_FILE}"
+  timeout 120s bash -c 'until [ -s "${RUNNER_LABELS_FILE}" ]; do sleep 1; done'
+  if [ -s "${RUNNER_LABELS_FILE}" ]; then
+    computed_labels=$(jq -r 'join(",")' "${RUNNER_LABELS_FILE}")
+    if [ -n "${computed_labels}" ]; then
+      RUNNER_LABELS="${RUNNER_LABELS:+${RUNNER_LABELS},}${computed_labels}"
+      log "Registering the runner with the computed labels ${computed_labels}"
+    fi
+  else
+    error "Timed out waiting for the runner labels computed from the label templates. Registering the runner without them"
+  fi
+fi
+
 retries_left=10
 while [[ ${retries_left} -gt 0 ]]; do
   log "Configuring the runner."